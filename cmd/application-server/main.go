@@ -48,15 +48,20 @@ func main() {
         log.Fatal().Err(err).Msg("Failed to connect to database")
     }
     defer store.Close()
+    store.SetRetryPolicy(storage.RetryPolicyFromConfig(cfg.Database))
+    store.SetPoolConfig(storage.PoolConfigFromConfig(cfg.Database))
 
     log.Info().Msg("Connected to database")
+    
+    // Device sessions go through the Redis cache when redis.addr is set, shared with the network server
+    sessionStore := storage.WithSessionCache(store, cfg)
 
     // Create context
     ctx, cancel := context.WithCancel(context.Background())
     defer cancel()
 
     // Start REST API server
-    apiServer := api.NewRESTServer(cfg, store)
+    apiServer := api.NewRESTServer(cfg, sessionStore)
 
     // WaitGroup for services
     var wg sync.WaitGroup
@@ -72,13 +77,29 @@ func main() {
         }
     }()
 
+    // Start Web UI server
+    if cfg.Web.Port != 0 {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            addr := fmt.Sprintf("%s:%d", cfg.Web.Host, cfg.Web.Port)
+            if err := apiServer.ListenAndServeWeb(addr); err != nil {
+                log.Fatal().Err(err).Msg("Web UI server failed")
+            }
+        }()
+    }
+
     // Optional: Start NATS subscriber
     if cfg.NATS.URL != "" {
         log.Info().Str("url", cfg.NATS.URL).Msg("Connecting to NATS...")
         
-        nc, err := nats.Connect(cfg.NATS.URL,
+        natsAuth, err := cfg.NATS.AuthOptions(config.ServiceApplicationServer)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to load NATS credentials")
+        }
+        
+        natsOpts := append([]nats.Option{
             nats.Name("lorawan-application-server"),
-            nats.UserInfo(cfg.NATS.Username, cfg.NATS.Password),
             nats.ReconnectWait(cfg.NATS.ReconnectInterval),
             nats.MaxReconnects(cfg.NATS.MaxReconnects),
             nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
@@ -93,13 +114,15 @@ func main() {
                     Str("subject", sub.Subject).
                     Msg("NATS error")
             }),
-        )
+        }, natsAuth...)
+        nc, err := nats.Connect(cfg.NATS.URL, natsOpts...)
         
         if err != nil {
             log.Warn().Err(err).Msg("Failed to connect to NATS, continuing without NATS support")
         } else {
             defer nc.Close()
             log.Info().Msg("Connected to NATS")
+            apiServer.SetNATS(nc)
 
             // Start NATS subscriber
             subscriber := server.NewNATSSubscriber(nc, store)
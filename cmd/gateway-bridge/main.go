@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -13,7 +14,9 @@ import (
 
 	"github.com/lorawan-server/lorawan-server-pro/internal/config"
 	"github.com/lorawan-server/lorawan-server-pro/internal/gateway"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
 
 func main() {
@@ -38,6 +41,7 @@ func main() {
 		level = zerolog.InfoLevel
 	}
 	zerolog.SetGlobalLevel(level)
+	logging.SetFrameSampling(cfg.Log.SampleRate)
 
 	log.Info().Msg("LoRaWAN Gateway Bridge 启动中...")
 
@@ -47,16 +51,21 @@ func main() {
 		log.Fatal().Err(err).Msg("连接数据库失败")
 	}
 	defer store.Close()
+	store.SetRetryPolicy(storage.RetryPolicyFromConfig(cfg.Database))
+	store.SetPoolConfig(storage.PoolConfigFromConfig(cfg.Database))
 
 	log.Info().Msg("已连接到数据库")
 
 	// 连接 NATS
-	nc, err := nats.Connect(cfg.NATS.URL,
+	natsAuth, err := cfg.NATS.AuthOptions(config.ServiceGatewayBridge)
+	if err != nil {
+		log.Fatal().Err(err).Msg("加载 NATS 凭据失败")
+	}
+	nc, err := nats.Connect(cfg.NATS.URL, append([]nats.Option{
 		nats.Name("lorawan-gateway-bridge"),
-		nats.UserInfo(cfg.NATS.Username, cfg.NATS.Password),
 		nats.ReconnectWait(cfg.NATS.ReconnectInterval),
 		nats.MaxReconnects(cfg.NATS.MaxReconnects),
-	)
+	}, natsAuth...)...)
 
 	if err != nil {
 		log.Fatal().Err(err).Msg("连接 NATS 失败")
@@ -66,18 +75,39 @@ func main() {
 	log.Info().Msg("已连接到 NATS")
 
 	// 创建 UDP 包转发器 - 传递存储接口
-	forwarder, err := gateway.NewUDPPacketForwarder(cfg.Gateway.UDPBind, nc, store)
+	forwarder, err := gateway.NewUDPPacketForwarder(cfg.Gateway.BindAddresses(), nc, store)
 	if err != nil {
 		log.Fatal().Err(err).Msg("创建 UDP 转发器失败")
 	}
 
+	if cfg.Gateway.DropOversizedFrames {
+		region := lorawan.GetRegionConfiguration(cfg.Network.Band)
+		forwarder.SetMaxPHYPayloadSize(region.MaxPHYPayloadSize())
+		log.Info().Str("region", region.Name).Int("max", region.MaxPHYPayloadSize()).Msg("启用上行帧长度检查")
+	}
+
+	forwarder.SetDownlinkTiming(cfg.Gateway.DownlinkTiming)
+	forwarder.SetGatewayIDFormat(cfg.Gateway.IDFormat)
+	forwarder.SetTempAlertThreshold(cfg.Gateway.TempAlertThreshold)
+	forwarder.SetAutoRegister(cfg.Gateway.AutoRegister)
+	if cfg.Gateway.AutoRegister.Enabled {
+		log.Info().
+			Str("tenant", cfg.Gateway.AutoRegister.TenantID).
+			Strs("allowPrefixes", cfg.Gateway.AutoRegister.AllowPrefixes).
+			Msg("启用网关自动注册")
+	} else {
+		log.Info().Msg("网关自动注册未启用，丢弃未注册网关的数据")
+	}
+
 	// 创建上下文
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// 启动服务
+	stopped := make(chan struct{})
 	go func() {
-		if err := forwarder.Start(ctx); err != nil {
+		defer close(stopped)
+		if err := forwarder.Start(ctx); err != nil && err != context.Canceled {
 			log.Error().Err(err).Msg("UDP 转发器停止")
 		}
 	}()
@@ -89,8 +119,13 @@ func main() {
 	sig := <-sigChan
 	log.Info().Str("signal", sig.String()).Msg("收到信号，正在关闭...")
 
-	// 取消上下文
+	// 取消上下文，等待进行中的下行发送完成
 	cancel()
 
-	log.Info().Msg("Gateway Bridge 已停止")
+	select {
+	case <-stopped:
+		log.Info().Msg("Gateway Bridge 已停止")
+	case <-time.After(cfg.Gateway.ShutdownAfter()):
+		log.Warn().Dur("timeout", cfg.Gateway.ShutdownAfter()).Msg("等待下行发送完成超时，强制退出")
+	}
 }
@@ -13,6 +13,8 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/metrics"
 	"github.com/lorawan-server/lorawan-server-pro/internal/network"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 )
@@ -41,6 +43,7 @@ func main() {
 		level = zerolog.InfoLevel
 	}
 	zerolog.SetGlobalLevel(level)
+	logging.SetFrameSampling(cfg.Log.SampleRate)
 
 	// 如果只是显示配置，打印后退出
 	if *showConfig {
@@ -78,18 +81,25 @@ func main() {
 		log.Fatal().Err(err).Msg("连接数据库失败")
 	}
 	defer store.Close()
+	store.SetRetryPolicy(storage.RetryPolicyFromConfig(cfg.Database))
+	store.SetPoolConfig(storage.PoolConfigFromConfig(cfg.Database))
 
 	// 连接NATS
-	nc, err := nats.Connect(cfg.NATS.URL,
+	natsAuth, err := cfg.NATS.AuthOptions(config.ServiceNetworkServer)
+	if err != nil {
+		log.Fatal().Err(err).Msg("加载NATS凭据失败")
+	}
+	nc, err := nats.Connect(cfg.NATS.URL, append([]nats.Option{
 		nats.ReconnectWait(cfg.NATS.ReconnectInterval),
-		nats.MaxReconnects(cfg.NATS.MaxReconnects))
+		nats.MaxReconnects(cfg.NATS.MaxReconnects),
+	}, natsAuth...)...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("连接NATS失败")
 	}
 	defer nc.Close()
 
 	// 创建处理器
-	processor := network.NewProcessor(nc, store, cfg)
+	processor := network.NewProcessor(nc, storage.WithSessionCache(store, cfg), cfg)
 
 	// 启动处理器
 	ctx, cancel := context.WithCancel(context.Background())
@@ -99,8 +109,21 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Prometheus 指标接口
+	if cfg.Metrics.Addr != "" {
+		storage.RegisterResilienceMetrics("lorawan_ns", store.ResilienceStats)
+		go func() {
+			log.Info().Str("addr", cfg.Metrics.Addr).Msg("Prometheus 指标接口启动")
+			if err := metrics.ListenAndServe(ctx, cfg.Metrics.Addr); err != nil {
+				log.Error().Err(err).Str("addr", cfg.Metrics.Addr).Msg("Prometheus 指标接口启动失败")
+			}
+		}()
+	}
+
 	// 启动处理器协程
+	processorDone := make(chan struct{})
 	go func() {
+		defer close(processorDone)
 		if err := processor.Start(ctx); err != nil {
 			log.Error().Err(err).Msg("处理器启动失败")
 			cancel()
@@ -116,6 +139,8 @@ func main() {
 	}
 
 	cancel()
+	// 等待处理器退出，确保缓冲的上行帧写入数据库
+	<-processorDone
 	log.Info().Msg("Network Server 已关闭")
 }
 
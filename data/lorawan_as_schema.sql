@@ -96,7 +96,10 @@ CREATE TABLE public.applications (
     mqtt_integration jsonb DEFAULT '{}'::jsonb,
     payload_codec character varying(50) DEFAULT 'NONE'::character varying,
     payload_decoder text,
-    payload_encoder text
+    payload_encoder text,
+    confirmed_timeout integer DEFAULT 0 NOT NULL,
+    forward_phy_payload boolean DEFAULT false NOT NULL,
+    forward_fields jsonb
 );
 
 
@@ -160,7 +163,22 @@ CREATE TABLE public.device_profiles (
     ping_slot_freq integer DEFAULT 0,
     supports_class_c boolean DEFAULT false,
     class_c_timeout integer DEFAULT 0,
-    uplink_interval integer DEFAULT 0
+    uplink_interval integer DEFAULT 0,
+    adr_mode character varying(10) DEFAULT 'auto'::character varying,
+    max_downlink_dr integer,
+    max_uplink_rate integer DEFAULT 0 NOT NULL,
+    max_nb_trans integer DEFAULT 0 NOT NULL,
+    abp_only boolean DEFAULT false NOT NULL,
+    max_downlink_queue_age integer DEFAULT 0 NOT NULL,
+    downlink_code_rate character varying(8) DEFAULT ''::character varying NOT NULL,
+    supported_data_rates integer[] DEFAULT '{}'::integer[] NOT NULL,
+    device_class character varying(1) DEFAULT 'A'::character varying NOT NULL,
+    fcnt_resets_allowed boolean DEFAULT false NOT NULL,
+    rx1_delay integer DEFAULT 0 NOT NULL,
+    rx2_dr integer,
+    rx2_freq integer DEFAULT 0 NOT NULL,
+    supports_cflist boolean,
+    join_accept_rx2 character varying(10) DEFAULT ''::character varying NOT NULL
 );
 
 
@@ -189,10 +207,13 @@ CREATE TABLE public.device_sessions (
     tx_power smallint DEFAULT 14,
     dr smallint DEFAULT 0,
     adr boolean DEFAULT false,
+    nb_trans smallint DEFAULT 1,
     max_supported_dr smallint DEFAULT 5,
+    mac_version character varying(16) DEFAULT ''::character varying NOT NULL,
     last_dev_status_request timestamp without time zone,
     created_at timestamp without time zone DEFAULT now() NOT NULL,
     updated_at timestamp without time zone DEFAULT now() NOT NULL,
+    uplink_received boolean,
     CONSTRAINT device_sessions_dev_addr_check CHECK ((length(dev_addr) = 4)),
     CONSTRAINT device_sessions_dev_eui_check CHECK ((length(dev_eui) = 8)),
     CONSTRAINT device_sessions_join_eui_check CHECK ((length(join_eui) = 8))
@@ -228,6 +249,10 @@ CREATE TABLE public.devices (
     n_f_cnt_down integer DEFAULT 0,
     a_f_cnt_down integer DEFAULT 0,
     dr integer,
+    last_downlink jsonb,
+    last_error jsonb,
+    join_nonce integer DEFAULT 0 NOT NULL,
+    forward_disabled boolean DEFAULT false NOT NULL,
     CONSTRAINT devices_dev_addr_check CHECK ((length(dev_addr) = 4)),
     CONSTRAINT devices_dev_eui_check CHECK ((length(dev_eui) = 8)),
     CONSTRAINT devices_join_eui_check CHECK ((length(join_eui) = 8))
@@ -253,12 +278,33 @@ CREATE TABLE public.downlink_frames (
     transmitted_at timestamp without time zone,
     acked_at timestamp without time zone,
     reference character varying(255),
+    expired_at timestamp without time zone,
     CONSTRAINT downlink_frames_f_port_check CHECK (((f_port >= 1) AND (f_port <= 223)))
 );
 
 
 ALTER TABLE public.downlink_frames OWNER TO lorawan;
 
+--
+-- Name: downlink_templates; Type: TABLE; Schema: public; Owner: lorawan
+--
+
+CREATE TABLE public.downlink_templates (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    created_at timestamp without time zone DEFAULT now() NOT NULL,
+    updated_at timestamp without time zone DEFAULT now() NOT NULL,
+    application_id uuid NOT NULL,
+    name character varying(100) NOT NULL,
+    description text,
+    f_port integer NOT NULL,
+    data bytea NOT NULL,
+    confirmed boolean DEFAULT false NOT NULL,
+    CONSTRAINT downlink_templates_f_port_check CHECK (((f_port >= 1) AND (f_port <= 223)))
+);
+
+
+ALTER TABLE public.downlink_templates OWNER TO lorawan;
+
 --
 -- Name: event_logs; Type: TABLE; Schema: public; Owner: lorawan
 --
@@ -280,6 +326,27 @@ CREATE TABLE public.event_logs (
 
 ALTER TABLE public.event_logs OWNER TO lorawan;
 
+--
+-- Name: frame_logs; Type: TABLE; Schema: public; Owner: lorawan
+--
+
+CREATE TABLE public.frame_logs (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    "time" timestamp without time zone DEFAULT now() NOT NULL,
+    direction character varying(10) NOT NULL,
+    gateway_id character varying(32) NOT NULL,
+    phy_payload text NOT NULL,
+    frequency double precision,
+    data_rate character varying(20),
+    rssi integer,
+    snr double precision,
+    result character varying(200) NOT NULL,
+    trace_id character varying(32)
+);
+
+
+ALTER TABLE public.frame_logs OWNER TO lorawan;
+
 --
 -- Name: gateway_sessions; Type: TABLE; Schema: public; Owner: lorawan
 --
@@ -297,6 +364,26 @@ CREATE TABLE public.gateway_sessions (
 
 ALTER TABLE public.gateway_sessions OWNER TO lorawan;
 
+--
+-- Name: gateway_stats; Type: TABLE; Schema: public; Owner: lorawan
+--
+
+CREATE TABLE public.gateway_stats (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    gateway_id bytea NOT NULL,
+    "time" timestamp without time zone DEFAULT now() NOT NULL,
+    rx_packets_received integer DEFAULT 0 NOT NULL,
+    rx_packets_valid integer DEFAULT 0 NOT NULL,
+    tx_packets_emitted integer DEFAULT 0 NOT NULL,
+    latitude double precision,
+    longitude double precision,
+    metadata jsonb DEFAULT '{}'::jsonb,
+    CONSTRAINT gateway_stats_gateway_id_check CHECK ((length(gateway_id) = 8))
+);
+
+
+ALTER TABLE public.gateway_stats OWNER TO lorawan;
+
 --
 -- Name: gateways; Type: TABLE; Schema: public; Owner: lorawan
 --
@@ -318,6 +405,8 @@ CREATE TABLE public.gateways (
     gateway_profile_id uuid,
     tags jsonb DEFAULT '{}'::jsonb,
     metadata jsonb DEFAULT '{}'::jsonb,
+    labels jsonb DEFAULT '{}'::jsonb,
+    radios jsonb,
     CONSTRAINT gateways_gateway_id_check CHECK ((length(gateway_id) = 8))
 );
 
@@ -339,6 +428,42 @@ CREATE TABLE public.mac_command_queue (
 
 ALTER TABLE public.mac_command_queue OWNER TO lorawan;
 
+--
+-- Name: multicast_group_devices; Type: TABLE; Schema: public; Owner: lorawan
+--
+
+CREATE TABLE public.multicast_group_devices (
+    multicast_group_id uuid NOT NULL,
+    dev_eui bytea NOT NULL,
+    created_at timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.multicast_group_devices OWNER TO lorawan;
+
+--
+-- Name: multicast_groups; Type: TABLE; Schema: public; Owner: lorawan
+--
+
+CREATE TABLE public.multicast_groups (
+    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+    created_at timestamp without time zone DEFAULT now() NOT NULL,
+    updated_at timestamp without time zone DEFAULT now() NOT NULL,
+    application_id uuid NOT NULL,
+    name character varying(100) NOT NULL,
+    mc_addr bytea NOT NULL,
+    mc_nwk_s_key character varying(64) NOT NULL,
+    mc_app_s_key character varying(64) NOT NULL,
+    f_cnt bigint DEFAULT 0 NOT NULL,
+    group_type character varying(1) DEFAULT 'C'::character varying NOT NULL,
+    dr smallint DEFAULT 0 NOT NULL,
+    frequency bigint DEFAULT 0 NOT NULL,
+    CONSTRAINT multicast_groups_mc_addr_check CHECK ((length(mc_addr) = 4))
+);
+
+
+ALTER TABLE public.multicast_groups OWNER TO lorawan;
+
 --
 -- Name: tenants; Type: TABLE; Schema: public; Owner: lorawan
 --
@@ -357,7 +482,8 @@ CREATE TABLE public.tenants (
     billing_email character varying(255),
     billing_plan character varying(50),
     is_active boolean DEFAULT true,
-    suspended_at timestamp without time zone
+    suspended_at timestamp without time zone,
+    allowed_regions text[]
 );
 
 
@@ -388,6 +514,20 @@ CREATE TABLE public.uplink_frames (
 
 ALTER TABLE public.uplink_frames OWNER TO lorawan;
 
+--
+-- Name: used_dev_nonces; Type: TABLE; Schema: public; Owner: lorawan
+--
+
+CREATE TABLE public.used_dev_nonces (
+    join_eui bytea NOT NULL,
+    dev_eui bytea NOT NULL,
+    dev_nonce integer NOT NULL,
+    created_at timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.used_dev_nonces OWNER TO lorawan;
+
 --
 -- Name: users; Type: TABLE; Schema: public; Owner: lorawan
 --
@@ -493,6 +633,22 @@ ALTER TABLE ONLY public.downlink_frames
     ADD CONSTRAINT downlink_frames_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: downlink_templates downlink_templates_application_id_name_key; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.downlink_templates
+    ADD CONSTRAINT downlink_templates_application_id_name_key UNIQUE (application_id, name);
+
+
+--
+-- Name: downlink_templates downlink_templates_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.downlink_templates
+    ADD CONSTRAINT downlink_templates_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: event_logs event_logs_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
 --
@@ -501,6 +657,14 @@ ALTER TABLE ONLY public.event_logs
     ADD CONSTRAINT event_logs_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: frame_logs frame_logs_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.frame_logs
+    ADD CONSTRAINT frame_logs_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: gateway_sessions gateway_sessions_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
 --
@@ -509,6 +673,14 @@ ALTER TABLE ONLY public.gateway_sessions
     ADD CONSTRAINT gateway_sessions_pkey PRIMARY KEY (gateway_id);
 
 
+--
+-- Name: gateway_stats gateway_stats_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.gateway_stats
+    ADD CONSTRAINT gateway_stats_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: gateways gateways_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
 --
@@ -525,6 +697,22 @@ ALTER TABLE ONLY public.mac_command_queue
     ADD CONSTRAINT mac_command_queue_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: multicast_group_devices multicast_group_devices_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.multicast_group_devices
+    ADD CONSTRAINT multicast_group_devices_pkey PRIMARY KEY (multicast_group_id, dev_eui);
+
+
+--
+-- Name: multicast_groups multicast_groups_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.multicast_groups
+    ADD CONSTRAINT multicast_groups_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: tenants tenants_name_key; Type: CONSTRAINT; Schema: public; Owner: lorawan
 --
@@ -549,6 +737,14 @@ ALTER TABLE ONLY public.uplink_frames
     ADD CONSTRAINT uplink_frames_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: used_dev_nonces used_dev_nonces_pkey; Type: CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.used_dev_nonces
+    ADD CONSTRAINT used_dev_nonces_pkey PRIMARY KEY (join_eui, dev_eui, dev_nonce);
+
+
 --
 -- Name: users users_email_key; Type: CONSTRAINT; Schema: public; Owner: lorawan
 --
@@ -706,6 +902,20 @@ CREATE INDEX idx_event_logs_tenant_id ON public.event_logs USING btree (tenant_i
 CREATE INDEX idx_event_logs_type ON public.event_logs USING btree (type);
 
 
+--
+-- Name: idx_frame_logs_time; Type: INDEX; Schema: public; Owner: lorawan
+--
+
+CREATE INDEX idx_frame_logs_time ON public.frame_logs USING btree ("time");
+
+
+--
+-- Name: idx_gateway_stats_gateway_time; Type: INDEX; Schema: public; Owner: lorawan
+--
+
+CREATE INDEX idx_gateway_stats_gateway_time ON public.gateway_stats USING btree (gateway_id, "time");
+
+
 --
 -- Name: idx_mac_command_queue_created_at; Type: INDEX; Schema: public; Owner: lorawan
 --
@@ -720,6 +930,20 @@ CREATE INDEX idx_mac_command_queue_created_at ON public.mac_command_queue USING
 CREATE INDEX idx_mac_command_queue_dev_eui ON public.mac_command_queue USING btree (dev_eui);
 
 
+--
+-- Name: idx_multicast_group_devices_dev_eui; Type: INDEX; Schema: public; Owner: lorawan
+--
+
+CREATE INDEX idx_multicast_group_devices_dev_eui ON public.multicast_group_devices USING btree (dev_eui);
+
+
+--
+-- Name: idx_multicast_groups_application_id; Type: INDEX; Schema: public; Owner: lorawan
+--
+
+CREATE INDEX idx_multicast_groups_application_id ON public.multicast_groups USING btree (application_id);
+
+
 --
 -- Name: idx_uplink_frames_application_id; Type: INDEX; Schema: public; Owner: lorawan
 --
@@ -741,6 +965,13 @@ CREATE INDEX idx_uplink_frames_dev_eui ON public.uplink_frames USING btree (dev_
 CREATE INDEX idx_uplink_frames_received_at ON public.uplink_frames USING btree (received_at);
 
 
+--
+-- Name: idx_used_dev_nonces_dev_eui; Type: INDEX; Schema: public; Owner: lorawan
+--
+
+CREATE INDEX idx_used_dev_nonces_dev_eui ON public.used_dev_nonces USING btree (dev_eui);
+
+
 --
 -- Name: applications update_applications_updated_at; Type: TRIGGER; Schema: public; Owner: lorawan
 --
@@ -762,6 +993,13 @@ CREATE TRIGGER update_device_sessions_updated_at BEFORE UPDATE ON public.device_
 CREATE TRIGGER update_devices_updated_at BEFORE UPDATE ON public.devices FOR EACH ROW EXECUTE FUNCTION public.update_updated_at();
 
 
+--
+-- Name: downlink_templates update_downlink_templates_updated_at; Type: TRIGGER; Schema: public; Owner: lorawan
+--
+
+CREATE TRIGGER update_downlink_templates_updated_at BEFORE UPDATE ON public.downlink_templates FOR EACH ROW EXECUTE FUNCTION public.update_updated_at();
+
+
 --
 -- Name: gateway_sessions update_gateway_sessions_updated_at; Type: TRIGGER; Schema: public; Owner: lorawan
 --
@@ -838,6 +1076,14 @@ ALTER TABLE ONLY public.devices
     ADD CONSTRAINT devices_tenant_id_fkey FOREIGN KEY (tenant_id) REFERENCES public.tenants(id) ON DELETE CASCADE;
 
 
+--
+-- Name: downlink_templates downlink_templates_application_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.downlink_templates
+    ADD CONSTRAINT downlink_templates_application_id_fkey FOREIGN KEY (application_id) REFERENCES public.applications(id) ON DELETE CASCADE;
+
+
 --
 -- Name: event_logs event_logs_application_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
 --
@@ -862,6 +1108,38 @@ ALTER TABLE ONLY public.gateways
     ADD CONSTRAINT gateways_tenant_id_fkey FOREIGN KEY (tenant_id) REFERENCES public.tenants(id) ON DELETE CASCADE;
 
 
+--
+-- Name: multicast_group_devices multicast_group_devices_dev_eui_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.multicast_group_devices
+    ADD CONSTRAINT multicast_group_devices_dev_eui_fkey FOREIGN KEY (dev_eui) REFERENCES public.devices(dev_eui) ON DELETE CASCADE;
+
+
+--
+-- Name: multicast_group_devices multicast_group_devices_multicast_group_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.multicast_group_devices
+    ADD CONSTRAINT multicast_group_devices_multicast_group_id_fkey FOREIGN KEY (multicast_group_id) REFERENCES public.multicast_groups(id) ON DELETE CASCADE;
+
+
+--
+-- Name: multicast_groups multicast_groups_application_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.multicast_groups
+    ADD CONSTRAINT multicast_groups_application_id_fkey FOREIGN KEY (application_id) REFERENCES public.applications(id) ON DELETE CASCADE;
+
+
+--
+-- Name: used_dev_nonces used_dev_nonces_dev_eui_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
+--
+
+ALTER TABLE ONLY public.used_dev_nonces
+    ADD CONSTRAINT used_dev_nonces_dev_eui_fkey FOREIGN KEY (dev_eui) REFERENCES public.devices(dev_eui) ON DELETE CASCADE;
+
+
 --
 -- Name: users users_tenant_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: lorawan
 --
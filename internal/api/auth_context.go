@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+type authContextKey int
+
+const (
+	userContextKey authContextKey = iota
+	tenantContextKey
+)
+
+// withAuth returns ctx carrying the authenticated user and tenant
+func withAuth(ctx context.Context, user *models.User, tenant *models.Tenant) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, user)
+	return context.WithValue(ctx, tenantContextKey, tenant)
+}
+
+// userFromContext returns the user authenticated by authMiddleware, nil on public routes
+func userFromContext(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// tenantFromContext returns the authenticated user's tenant, nil for
+// administrators that do not belong to a tenant
+func tenantFromContext(r *http.Request) *models.Tenant {
+	tenant, _ := r.Context().Value(tenantContextKey).(*models.Tenant)
+	return tenant
+}
+
+// canAccessTenant reports whether the authenticated user may act on resources of
+// tenantID: administrators on any tenant, other users only on their own
+func canAccessTenant(r *http.Request, tenantID uuid.UUID) bool {
+	user := userFromContext(r)
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin {
+		return true
+	}
+	tenant := tenantFromContext(r)
+	return tenant != nil && tenant.ID == tenantID
+}
+
+// canAccessApplication reports whether the authenticated user may act on the
+// application; unknown applications are not accessible
+func (s *RESTServer) canAccessApplication(r *http.Request, applicationID uuid.UUID) (bool, error) {
+	app, err := s.store.GetApplication(r.Context(), applicationID)
+	if err == storage.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return canAccessTenant(r, app.TenantID), nil
+}
+
+// canAccessDevice reports whether the authenticated user may act on the device,
+// which belongs to the tenant of its application
+func (s *RESTServer) canAccessDevice(r *http.Request, device *models.Device) (bool, error) {
+	return s.canAccessApplication(r, device.ApplicationID)
+}
+
+// requestTenantID resolves the tenant a request operates on. Tenant users are
+// scoped to their own tenant; administrators may pick one with ?tenant_id= and
+// otherwise use their own. It writes the error response when there is none.
+func (s *RESTServer) requestTenantID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	user := userFromContext(r)
+	tenant := tenantFromContext(r)
+
+	if v := r.URL.Query().Get("tenant_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid tenant_id")
+			return uuid.Nil, false
+		}
+		if user == nil || (!user.IsAdmin && (tenant == nil || tenant.ID != id)) {
+			s.respondError(w, http.StatusForbidden, "access to tenant denied")
+			return uuid.Nil, false
+		}
+		return id, true
+	}
+
+	if tenant == nil {
+		s.respondError(w, http.StatusBadRequest, "tenant_id is required")
+		return uuid.Nil, false
+	}
+	return tenant.ID, true
+}
+
+// deviceAccessMiddleware guards the devices/{dev_eui} routes: devices of
+// other tenants respond as not found
+func (s *RESTServer) deviceAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+			return
+		}
+
+		device, err := s.store.GetDevice(r.Context(), devEUI)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				s.respondError(w, http.StatusNotFound, "device not found")
+				return
+			}
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		allowed, err := s.canAccessDevice(r, device)
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !allowed {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// applicationAccessMiddleware guards the applications/{id} routes:
+// applications of other tenants respond as not found
+func (s *RESTServer) applicationAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid application id")
+			return
+		}
+
+		app, err := s.store.GetApplication(r.Context(), id)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				s.respondError(w, http.StatusNotFound, "application not found")
+				return
+			}
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !canAccessTenant(r, app.TenantID) {
+			s.respondError(w, http.StatusNotFound, "application not found")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gatewayAccessMiddleware guards the gateways/{gateway_id} routes: gateways
+// of other tenants respond as not found
+func (s *RESTServer) gatewayAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatewayID, err := lorawan.ParseGatewayID(chi.URLParam(r, "gateway_id"))
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid gateway_id")
+			return
+		}
+
+		gateway, err := s.store.GetGateway(r.Context(), gatewayID)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				s.respondError(w, http.StatusNotFound, "gateway not found")
+				return
+			}
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !canAccessTenant(r, gateway.TenantID) {
+			s.respondError(w, http.StatusNotFound, "gateway not found")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// multicastGroupAccessMiddleware guards the multicast-groups/{id} routes:
+// groups of other tenants' applications respond as not found
+func (s *RESTServer) multicastGroupAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid multicast group id")
+			return
+		}
+
+		group, err := s.store.GetMulticastGroup(r.Context(), id)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				s.respondError(w, http.StatusNotFound, "multicast group not found")
+				return
+			}
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		app, err := s.store.GetApplication(r.Context(), group.ApplicationID)
+		if err != nil && err != storage.ErrNotFound {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if app == nil || !canAccessTenant(r, app.TenantID) {
+			s.respondError(w, http.StatusNotFound, "multicast group not found")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deviceProfileAccessMiddleware guards the device-profiles/{id} routes:
+// profiles of other tenants respond as not found, shared profiles pass
+func (s *RESTServer) deviceProfileAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.getDeviceProfile(w, r); !ok {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// tenantFixture holds one tenant's resources, all reachable through the router
+type tenantFixture struct {
+	owner       *models.User
+	outsider    *models.User
+	app         *models.Application
+	profile     *models.DeviceProfile
+	gatewayID   models.EUI64
+	devAddr     models.DevAddr
+	group       *models.MulticastGroup
+	downlinkID  uuid.UUID
+	otherTenant *models.Tenant
+}
+
+// newAuthTestServer creates a server that issues and accepts real tokens
+func newAuthTestServer(t *testing.T) (*RESTServer, *storagetest.MemoryStore) {
+	t.Helper()
+
+	store := storagetest.New()
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret", AccessTokenTTL: time.Hour, RefreshTokenTTL: time.Hour}}
+	return NewRESTServer(cfg, store), store
+}
+
+// seedTenants stores a tenant owning a device, gateway, profile, multicast
+// group and pending downlink, plus a user of a second tenant
+func seedTenants(t *testing.T, store *storagetest.MemoryStore) *tenantFixture {
+	t.Helper()
+
+	ctx := context.Background()
+	f := &tenantFixture{
+		gatewayID: models.EUI64{0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		devAddr:   models.DevAddr{0x26, 0x01, 0x1b, 0xda},
+	}
+
+	tenant := &models.Tenant{Name: "tenant"}
+	f.otherTenant = &models.Tenant{Name: "other"}
+	for _, tn := range []*models.Tenant{tenant, f.otherTenant} {
+		if err := store.CreateTenant(ctx, tn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.owner = &models.User{Email: "owner@example.com", IsActive: true, TenantID: &tenant.ID}
+	f.outsider = &models.User{Email: "outsider@example.com", IsActive: true, TenantID: &f.otherTenant.ID}
+	for _, u := range []*models.User{f.owner, f.outsider} {
+		if err := store.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.app = &models.Application{Name: "app"}
+	f.app.TenantID = tenant.ID
+	store.CreateApplication(ctx, f.app)
+	f.profile = &models.DeviceProfile{Name: "profile", TenantID: &tenant.ID, RFRegion: "CN470"}
+	store.CreateDeviceProfile(ctx, f.profile)
+
+	device := &models.Device{DevEUI: models.EUI64(testDevEUI), Name: "device", ApplicationID: f.app.ID, DeviceProfileID: f.profile.ID}
+	device.TenantID = tenant.ID
+	store.CreateDevice(ctx, device)
+	store.SaveDeviceSession(ctx, &models.DeviceSession{DevEUI: models.EUI64(testDevEUI), DevAddr: f.devAddr})
+
+	gateway := &models.Gateway{GatewayID: f.gatewayID, Name: "gateway"}
+	gateway.TenantID = tenant.ID
+	store.CreateGateway(ctx, gateway)
+
+	f.group = &models.MulticastGroup{ApplicationID: f.app.ID, Name: "group", McNwkSKey: testKey, McAppSKey: testKey}
+	store.CreateMulticastGroup(ctx, f.group)
+
+	downlink := &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), ApplicationID: f.app.ID, FPort: 10}
+	store.CreateDownlinkFrame(ctx, downlink)
+	f.downlinkID = downlink.ID
+	return f
+}
+
+// serveRouter sends a request through the full router, authenticated with token when set
+func serveRouter(s *RESTServer, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	s, store := newAuthTestServer(t)
+	f := seedTenants(t, store)
+
+	token, _, err := s.auth.GenerateTokenPair(f.owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled := &models.User{Email: "disabled@example.com", TenantID: f.owner.TenantID}
+	store.CreateUser(context.Background(), disabled)
+	disabledToken, _, _ := s.auth.GenerateTokenPair(disabled)
+	unknownToken, _, _ := s.auth.GenerateTokenPair(&models.User{ID: uuid.New()})
+	foreignToken, _, _ := NewRESTServer(&config.Config{JWT: config.JWTConfig{Secret: "other-secret", AccessTokenTTL: time.Hour}}, store).auth.GenerateTokenPair(f.owner)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"valid token", "Bearer " + token, http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic " + token, http.StatusUnauthorized},
+		{"malformed token", "Bearer nope", http.StatusUnauthorized},
+		{"token signed with another secret", "Bearer " + foreignToken, http.StatusUnauthorized},
+		{"deleted user", "Bearer " + unknownToken, http.StatusUnauthorized},
+		{"disabled user", "Bearer " + disabledToken, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestTenantAccess(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         func(f *tenantFixture) string
+		body         func(f *tenantFixture) interface{}
+		wantOwner    int
+		wantOutsider int
+	}{
+		{"get device", http.MethodGet, func(f *tenantFixture) string { return "/api/v1/devices/" + testDevEUI.String() }, nil, http.StatusOK, http.StatusNotFound},
+		{"list devices", http.MethodGet, func(f *tenantFixture) string { return "/api/v1/devices?application_id=" + f.app.ID.String() }, nil, http.StatusOK, http.StatusNotFound},
+		{"create device", http.MethodPost, func(f *tenantFixture) string { return "/api/v1/devices" }, func(f *tenantFixture) interface{} {
+			return map[string]interface{}{"dev_eui": "70b3d57ed0000002", "name": "new", "application_id": f.app.ID, "device_profile_id": f.profile.ID}
+		}, http.StatusCreated, http.StatusBadRequest},
+		{"get application", http.MethodGet, func(f *tenantFixture) string { return "/api/v1/applications/" + f.app.ID.String() }, nil, http.StatusOK, http.StatusNotFound},
+		{"get gateway", http.MethodGet, func(f *tenantFixture) string { return "/api/v1/gateways/" + f.gatewayID.String() }, nil, http.StatusOK, http.StatusNotFound},
+		{"get device profile", http.MethodGet, func(f *tenantFixture) string { return "/api/v1/device-profiles/" + f.profile.ID.String() }, nil, http.StatusOK, http.StatusNotFound},
+		{"delete device profile", http.MethodDelete, func(f *tenantFixture) string { return "/api/v1/device-profiles/" + f.profile.ID.String() }, nil, http.StatusNoContent, http.StatusNotFound},
+		{"get multicast group", http.MethodGet, func(f *tenantFixture) string { return "/api/v1/multicast-groups/" + f.group.ID.String() }, nil, http.StatusOK, http.StatusNotFound},
+		{"delete multicast group", http.MethodDelete, func(f *tenantFixture) string { return "/api/v1/multicast-groups/" + f.group.ID.String() }, nil, http.StatusNoContent, http.StatusNotFound},
+		{"cancel downlink", http.MethodDelete, func(f *tenantFixture) string { return "/api/v1/downlinks/" + f.downlinkID.String() }, nil, http.StatusNoContent, http.StatusNotFound},
+		{"downlink by DevAddr", http.MethodPost, func(f *tenantFixture) string { return "/api/v1/downlinks/dev-addr/" + f.devAddr.String() }, func(f *tenantFixture) interface{} {
+			return map[string]interface{}{"fPort": 10, "data": "0102"}
+		}, http.StatusAccepted, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		for _, asOwner := range []bool{true, false} {
+			who, want := "outsider", tt.wantOutsider
+			if asOwner {
+				who, want = "owner", tt.wantOwner
+			}
+			t.Run(tt.name+"/"+who, func(t *testing.T) {
+				s, store := newAuthTestServer(t)
+				f := seedTenants(t, store)
+				user := f.outsider
+				if asOwner {
+					user = f.owner
+				}
+				token, _, _ := s.auth.GenerateTokenPair(user)
+
+				var body interface{}
+				if tt.body != nil {
+					body = tt.body(f)
+				}
+				w := serveRouter(s, tt.method, tt.path(f), token, body)
+				if w.Code != want {
+					t.Fatalf("status = %d, want %d: %s", w.Code, want, w.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestListMulticastGroupsTenantScope(t *testing.T) {
+	s, store := newAuthTestServer(t)
+	f := seedTenants(t, store)
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		wantTotal int
+	}{
+		{"owner", f.owner, 1},
+		{"outsider", f.outsider, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, _ := s.auth.GenerateTokenPair(tt.user)
+			w := serveRouter(s, http.MethodGet, "/api/v1/multicast-groups", token, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var resp struct {
+				Total int `json:"total"`
+			}
+			json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&resp)
+			if resp.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", resp.Total, tt.wantTotal)
+			}
+			// listings never carry the group session keys
+			if strings.Contains(w.Body.String(), "mcNwkSKey") || strings.Contains(w.Body.String(), "mcAppSKey") {
+				t.Errorf("list response exposes session keys: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestRequestLoggerRedactsAccessToken(t *testing.T) {
+	var buf bytes.Buffer
+	logger := middleware.RequestLogger(redactedLogFormatter{
+		&middleware.DefaultLogFormatter{Logger: stdlog.New(&buf, "", 0), NoColor: true},
+	})
+
+	var seen string
+	handler := logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Query().Get("access_token")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/events/stream?type=uplink&access_token=secret-token", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("log exposes the token: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "access_token=REDACTED") || !strings.Contains(buf.String(), "type=uplink") {
+		t.Errorf("log = %s, want the redacted URI", buf.String())
+	}
+	// the handler still authenticates with the real token
+	if seen != "secret-token" {
+		t.Errorf("handler saw access_token %q", seen)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/gateway"
+	"github.com/lorawan-server/lorawan-server-pro/internal/network"
+)
+
+// debugRequestTimeout bounds the wait for each service to answer
+const debugRequestTimeout = 2 * time.Second
+
+// HandleDebugCaches returns the sizes and a sample of the Network Server's
+// in-memory caches and the Gateway Bridge's gateway map. A service that does
+// not answer is reported with an error instead of failing the whole request.
+func (s *RESTServer) HandleDebugCaches(w http.ResponseWriter, r *http.Request) {
+	nc := s.nc.Load()
+	if nc == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "cache inspection requires a NATS connection")
+		return
+	}
+
+	var ns network.CacheDebugInfo
+	var bridge gateway.GatewayMapInfo
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"networkServer": debugRequest(nc, network.CacheDebugSubject, &ns),
+		"gatewayBridge": debugRequest(nc, gateway.CacheDebugSubject, &bridge),
+	})
+}
+
+// debugRequest asks a service for its state, returning the decoded reply or an error object
+func debugRequest(nc *nats.Conn, subject string, v interface{}) interface{} {
+	reply, err := nc.Request(subject, nil, debugRequestTimeout)
+	if err != nil {
+		return map[string]string{"error": "no response: " + err.Error()}
+	}
+	if err := json.Unmarshal(reply.Data, v); err != nil {
+		return map[string]string{"error": "invalid response: " + err.Error()}
+	}
+	return v
+}
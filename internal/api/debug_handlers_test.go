@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/gateway"
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+	"github.com/lorawan-server/lorawan-server-pro/internal/network"
+)
+
+func TestHandleDebugCaches(t *testing.T) {
+	var nsInfo network.CacheDebugInfo
+	nsInfo.DeviceRxCache.Size = 1
+	nsInfo.DeviceRxCache.Sample = []network.DeviceRxCacheRow{{DevEUI: testDevEUI.String(), GatewayID: "0102030405060708", Candidates: 2}}
+	nsInfo.JoinCache = network.CacheKeys{Size: 1, Sample: []string{"join"}}
+	nsReply, _ := json.Marshal(nsInfo)
+	bridgeReply, _ := json.Marshal(gateway.GatewayMapInfo{Size: 1, Sample: []gateway.GatewayMapRow{{GatewayID: "0102030405060708", PullAddr: "10.0.0.1:1700"}}})
+
+	tests := []struct {
+		name        string
+		noNATS      bool
+		bridge      []byte // nil means the bridge does not answer
+		want        int
+		bridgeError string
+	}{
+		{"both services", false, bridgeReply, http.StatusOK, ""},
+		{"bridge not answering", false, nil, http.StatusOK, "no response"},
+		{"invalid bridge reply", false, []byte("{"), http.StatusOK, "invalid response"},
+		{"no NATS", true, nil, http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			srv := natstest.Run(t)
+			if !tt.noNATS {
+				s.SetNATS(srv.Conn(t))
+			}
+
+			nc := srv.Conn(t)
+			nc.Subscribe(network.CacheDebugSubject, func(msg *nats.Msg) { msg.Respond(nsReply) })
+			if tt.bridge != nil {
+				nc.Subscribe(gateway.CacheDebugSubject, func(msg *nats.Msg) { msg.Respond(tt.bridge) })
+			}
+			nc.Flush()
+
+			w := serve(s.HandleDebugCaches, newRequest(http.MethodGet, nil, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				NetworkServer struct {
+					network.CacheDebugInfo
+					Error string `json:"error"`
+				} `json:"networkServer"`
+				GatewayBridge struct {
+					gateway.GatewayMapInfo
+					Error string `json:"error"`
+				} `json:"gatewayBridge"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			ns := resp.NetworkServer
+			if ns.Error != "" || ns.DeviceRxCache.Size != 1 || len(ns.DeviceRxCache.Sample) != 1 || ns.DeviceRxCache.Sample[0].Candidates != 2 || ns.JoinCache.Size != 1 {
+				t.Errorf("networkServer = %+v", ns)
+			}
+
+			bridge := resp.GatewayBridge
+			if tt.bridgeError != "" {
+				if !strings.HasPrefix(bridge.Error, tt.bridgeError) {
+					t.Errorf("gatewayBridge error = %q, want %q", bridge.Error, tt.bridgeError)
+				}
+				return
+			}
+			if bridge.Error != "" || bridge.Size != 1 || bridge.Sample[0].PullAddr != "10.0.0.1:1700" {
+				t.Errorf("gatewayBridge = %+v", bridge)
+			}
+		})
+	}
+}
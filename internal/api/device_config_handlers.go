@@ -0,0 +1,568 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/auth"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// deviceConfigVersion is the format version of exported device configurations
+const deviceConfigVersion = 1
+
+// Key policies for device configuration export
+const (
+	keyPolicyMask      = "mask"
+	keyPolicyPlain     = "plain"
+	keyPolicyEncrypted = "encrypted"
+)
+
+// exportPassphraseHeader carries the passphrase for encrypted key export and import
+const exportPassphraseHeader = "X-Export-Passphrase"
+
+// deviceConfig is a self-contained device configuration that can be imported on another server
+type deviceConfig struct {
+	Version    int                   `json:"version"`
+	ExportedAt time.Time             `json:"exportedAt"`
+	KeyPolicy  string                `json:"keyPolicy"`
+	Device     *models.Device        `json:"device"`
+	Profile    *models.DeviceProfile `json:"profile,omitempty"`
+	Keys       *deviceConfigKeys     `json:"keys,omitempty"`
+	Session    *deviceConfigSession  `json:"session,omitempty"`
+}
+
+// deviceConfigKeys holds root keys and ABP session keys, protected per KeyPolicy
+type deviceConfigKeys struct {
+	AppKey      string `json:"appKey,omitempty"`
+	NwkKey      string `json:"nwkKey,omitempty"`
+	AppSKey     string `json:"appSKey,omitempty"`
+	NwkSEncKey  string `json:"nwkSEncKey,omitempty"`
+	SNwkSIntKey string `json:"sNwkSIntKey,omitempty"`
+	FNwkSIntKey string `json:"fNwkSIntKey,omitempty"`
+}
+
+// deviceConfigSession is the exported form of the current device session
+type deviceConfigSession struct {
+	DevAddr     string `json:"devAddr"`
+	JoinEUI     string `json:"joinEUI"`
+	FNwkSIntKey string `json:"fNwkSIntKey,omitempty"`
+	SNwkSIntKey string `json:"sNwkSIntKey,omitempty"`
+	NwkSEncKey  string `json:"nwkSEncKey,omitempty"`
+	AppSKey     string `json:"appSKey,omitempty"`
+	FCntUp      uint32 `json:"fCntUp"`
+	NFCntDown   uint32 `json:"nFCntDown"`
+	AFCntDown   uint32 `json:"aFCntDown"`
+	ConfFCnt    uint32 `json:"confFCnt"`
+	RX1Delay    uint8  `json:"rx1Delay"`
+	RX1DROffset uint8  `json:"rx1DROffset"`
+	RX2DR       uint8  `json:"rx2DR"`
+	RX2Freq     uint32 `json:"rx2Freq"`
+	TXPower     uint8  `json:"txPower"`
+	DR          uint8  `json:"dr"`
+	ADR         bool   `json:"adr"`
+
+	// UplinkReceived is whether FCntUp has been used; older exports fall back to FCntUp > 0
+	UplinkReceived *bool `json:"uplinkReceived,omitempty"`
+}
+
+// keyCodec applies a key policy to individual key strings
+type keyCodec struct {
+	policy string
+	secret []byte
+}
+
+func newKeyCodec(policy, passphrase string) (*keyCodec, error) {
+	c := &keyCodec{policy: policy}
+	switch policy {
+	case keyPolicyMask, keyPolicyPlain:
+	case keyPolicyEncrypted:
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s header is required for encrypted keys", exportPassphraseHeader)
+		}
+		sum := sha256.Sum256([]byte(passphrase))
+		c.secret = sum[:]
+	default:
+		return nil, fmt.Errorf("unsupported key policy %q", policy)
+	}
+	return c, nil
+}
+
+func (c *keyCodec) seal(key string) (string, error) {
+	if key == "" || c.policy == keyPolicyMask {
+		return "", nil
+	}
+	if c.policy == keyPolicyPlain {
+		return key, nil
+	}
+	ciphertext, err := crypto.Encrypt(c.secret, []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// open reverses seal and validates the result as an AES-128 key
+func (c *keyCodec) open(name, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	key := value
+	if c.policy == keyPolicyEncrypted {
+		ciphertext, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid encoding", name)
+		}
+		plaintext, err := crypto.Decrypt(c.secret, ciphertext)
+		if err != nil {
+			return "", fmt.Errorf("%s: decryption failed", name)
+		}
+		key = string(plaintext)
+	}
+	if _, err := lorawan.ParseAES128Key(key); err != nil {
+		return "", fmt.Errorf("%s: invalid AES-128 key", name)
+	}
+	return key, nil
+}
+
+func (c *keyCodec) sealAll(keys ...*string) error {
+	for _, k := range keys {
+		sealed, err := c.seal(*k)
+		if err != nil {
+			return err
+		}
+		*k = sealed
+	}
+	return nil
+}
+
+func derefKey(k *string) string {
+	if k == nil {
+		return ""
+	}
+	return *k
+}
+
+func keyPtr(k string) *string {
+	if k == "" {
+		return nil
+	}
+	return &k
+}
+
+// HandleExportDeviceConfig exports the device, its profile, keys and session as one document
+func (s *RESTServer) HandleExportDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	policy := r.URL.Query().Get("keys")
+	if policy == "" {
+		policy = keyPolicyMask
+	}
+	if policy == keyPolicyPlain {
+		if user := userFromContext(r); user == nil || !user.IsAdmin {
+			s.respondError(w, http.StatusForbidden, "plain key export requires admin")
+			return
+		}
+	}
+	codec, err := newKeyCodec(policy, r.Header.Get(exportPassphraseHeader))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	allowed, err := s.canAccessDevice(r, device)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !allowed {
+		s.respondError(w, http.StatusNotFound, "device not found")
+		return
+	}
+
+	doc := &deviceConfig{
+		Version:    deviceConfigVersion,
+		ExportedAt: time.Now().UTC(),
+		KeyPolicy:  policy,
+		Device:     device,
+	}
+
+	profile, err := s.store.GetDeviceProfile(ctx, device.DeviceProfileID)
+	if err != nil && err != storage.ErrNotFound {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	doc.Profile = profile
+
+	keys := &deviceConfigKeys{
+		AppSKey:     derefKey(device.AppSKey),
+		NwkSEncKey:  derefKey(device.NwkSEncKey),
+		SNwkSIntKey: derefKey(device.SNwkSIntKey),
+		FNwkSIntKey: derefKey(device.FNwkSIntKey),
+	}
+	rootKeys, err := s.store.GetDeviceKeys(ctx, devEUI)
+	if err != nil && err != storage.ErrNotFound {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rootKeys != nil {
+		keys.AppKey = rootKeys.AppKey
+		keys.NwkKey = rootKeys.NwkKey
+	}
+	if err := codec.sealAll(&keys.AppKey, &keys.NwkKey, &keys.AppSKey,
+		&keys.NwkSEncKey, &keys.SNwkSIntKey, &keys.FNwkSIntKey); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if policy != keyPolicyMask {
+		doc.Keys = keys
+	}
+
+	session, err := s.store.GetDeviceSession(ctx, devEUI)
+	if err != nil && err != storage.ErrNotFound {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if session != nil {
+		exported := &deviceConfigSession{
+			DevAddr:     hex.EncodeToString(session.DevAddr[:]),
+			JoinEUI:     session.JoinEUI.String(),
+			FNwkSIntKey: session.FNwkSIntKey,
+			SNwkSIntKey: session.SNwkSIntKey,
+			NwkSEncKey:  session.NwkSEncKey,
+			AppSKey:     session.AppSKey,
+			FCntUp:      session.FCntUp,
+			NFCntDown:   session.NFCntDown,
+			AFCntDown:   session.AFCntDown,
+			ConfFCnt:    session.ConfFCnt,
+			RX1Delay:    session.RX1Delay,
+			RX1DROffset: session.RX1DROffset,
+			RX2DR:       session.RX2DR,
+			RX2Freq:     session.RX2Freq,
+			TXPower:     session.TXPower,
+			DR:          session.DR,
+			ADR:         session.ADR,
+		}
+		exported.UplinkReceived = &session.UplinkReceived
+		if err := codec.sealAll(&exported.FNwkSIntKey, &exported.SNwkSIntKey,
+			&exported.NwkSEncKey, &exported.AppSKey); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		doc.Session = exported
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=device_%s_config.json", devEUI))
+	s.respondJSON(w, http.StatusOK, doc)
+}
+
+// HandleImportDeviceConfig recreates a device from an exported configuration
+func (s *RESTServer) HandleImportDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var doc deviceConfig
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if doc.Version != deviceConfigVersion {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("unsupported config version %d", doc.Version))
+		return
+	}
+	if doc.Device == nil {
+		s.respondError(w, http.StatusBadRequest, "device is required")
+		return
+	}
+	if doc.Device.DevEUI == (models.EUI64{}) {
+		s.respondError(w, http.StatusBadRequest, "device.devEUI is required")
+		return
+	}
+	if doc.Device.Name == "" {
+		s.respondError(w, http.StatusBadRequest, "device name is required")
+		return
+	}
+
+	onConflict := r.URL.Query().Get("on_conflict")
+	if onConflict == "" {
+		onConflict = "fail"
+	}
+	if onConflict != "fail" && onConflict != "overwrite" {
+		s.respondError(w, http.StatusBadRequest, "on_conflict must be fail or overwrite")
+		return
+	}
+
+	codec, err := newKeyCodec(doc.KeyPolicy, r.Header.Get(exportPassphraseHeader))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 先解出全部密钥，任何一个无效都拒绝导入
+	var keys deviceConfigKeys
+	if doc.Keys != nil {
+		for _, k := range []struct {
+			name     string
+			src, dst *string
+		}{
+			{"appKey", &doc.Keys.AppKey, &keys.AppKey},
+			{"nwkKey", &doc.Keys.NwkKey, &keys.NwkKey},
+			{"appSKey", &doc.Keys.AppSKey, &keys.AppSKey},
+			{"nwkSEncKey", &doc.Keys.NwkSEncKey, &keys.NwkSEncKey},
+			{"sNwkSIntKey", &doc.Keys.SNwkSIntKey, &keys.SNwkSIntKey},
+			{"fNwkSIntKey", &doc.Keys.FNwkSIntKey, &keys.FNwkSIntKey},
+		} {
+			if *k.dst, err = codec.open("keys."+k.name, *k.src); err != nil {
+				s.respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	var session *models.DeviceSession
+	var skipped []string
+	if doc.Session != nil {
+		if doc.KeyPolicy == keyPolicyMask {
+			skipped = append(skipped, "session")
+		} else {
+			session, err = importedSession(codec, doc.Session)
+			if err != nil {
+				s.respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			session.DevEUI = doc.Device.DevEUI
+		}
+	}
+	if doc.KeyPolicy == keyPolicyMask {
+		skipped = append(skipped, "keys")
+	}
+
+	applicationID := doc.Device.ApplicationID
+	if v := r.URL.Query().Get("application_id"); v != "" {
+		if applicationID, err = uuid.Parse(v); err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid application_id")
+			return
+		}
+	}
+	app, err := s.store.GetApplication(ctx, applicationID)
+	if err != nil || !canAccessTenant(r, app.TenantID) {
+		s.respondError(w, http.StatusBadRequest, "application not found")
+		return
+	}
+
+	// 目标服务器没有该配置文件时按导出内容创建（保留原 ID）
+	profileID := doc.Device.DeviceProfileID
+	profile, err := s.store.GetDeviceProfile(ctx, profileID)
+	if err == storage.ErrNotFound {
+		if doc.Profile == nil || doc.Profile.ID != profileID {
+			s.respondError(w, http.StatusBadRequest, "device profile not found and not included in config")
+			return
+		}
+		profile = doc.Profile
+		if profile.TenantID != nil {
+			profile.TenantID = &app.TenantID
+		}
+		if status, err := s.checkTenantRegion(ctx, app.TenantID, profile.RFRegion); err != nil {
+			s.respondError(w, status, err.Error())
+			return
+		}
+		if err := s.store.CreateDeviceProfile(ctx, profile); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if profile.TenantID != nil && !canAccessTenant(r, *profile.TenantID) {
+		s.respondError(w, http.StatusBadRequest, "device profile not found")
+		return
+	} else if status, err := s.checkTenantRegion(ctx, app.TenantID, profile.RFRegion); err != nil {
+		s.respondError(w, status, err.Error())
+		return
+	}
+
+	device := doc.Device
+	device.TenantID = app.TenantID
+	device.ApplicationID = app.ID
+	device.LastDownlink = nil
+	device.Application = nil
+	device.Profile = nil
+	device.AppSKey = keyPtr(keys.AppSKey)
+	device.NwkSEncKey = keyPtr(keys.NwkSEncKey)
+	device.SNwkSIntKey = keyPtr(keys.SNwkSIntKey)
+	device.FNwkSIntKey = keyPtr(keys.FNwkSIntKey)
+	if session != nil {
+		devAddr := session.DevAddr
+		device.DevAddr = &devAddr
+	}
+
+	devEUI := lorawan.EUI64(device.DevEUI)
+	existing, err := s.store.GetDevice(ctx, devEUI)
+	if err == nil {
+		// 其他租户的设备不能被覆盖
+		allowed, err := s.canAccessDevice(r, existing)
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !allowed {
+			s.respondError(w, http.StatusConflict, fmt.Sprintf("device %s already exists", devEUI))
+			return
+		}
+	}
+	switch {
+	case err == storage.ErrNotFound:
+		device.ID = uuid.Nil
+		if err := s.store.CreateDevice(ctx, device); err != nil {
+			if err == storage.ErrDuplicateKey {
+				s.respondError(w, http.StatusConflict, "device already exists")
+				return
+			}
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case err != nil:
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	case onConflict == "fail":
+		s.respondError(w, http.StatusConflict, fmt.Sprintf("device %s already exists", devEUI))
+		return
+	default:
+		device.ID = existing.ID
+		device.CreatedAt = existing.CreatedAt
+		if err := s.store.UpdateDevice(ctx, device); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if keys.AppKey != "" {
+		rootKeys := &models.DeviceKeys{
+			DevEUI: device.DevEUI,
+			AppKey: keys.AppKey,
+			NwkKey: keys.NwkKey,
+		}
+		if err := s.store.SetDeviceKeys(ctx, rootKeys); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if session != nil {
+		if err := s.store.SaveDeviceSession(ctx, session); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	details := models.Variables{
+		"keyPolicy":  doc.KeyPolicy,
+		"exportedAt": doc.ExportedAt,
+		"overwrite":  existing != nil,
+	}
+	if claims, ok := ctx.Value("claims").(*auth.Claims); ok {
+		details["userId"] = claims.UserID.String()
+		details["email"] = claims.Email
+	}
+	event := &models.EventLog{
+		ApplicationID: &device.ApplicationID,
+		DevEUI:        &device.DevEUI,
+		Type:          models.EventTypeAPICall,
+		Level:         models.EventLevelInfo,
+		Code:          "DEVICE_CONFIG_IMPORTED",
+		Description:   "Device configuration imported",
+		Details:       details,
+	}
+	if err := s.store.CreateEventLog(ctx, event); err != nil {
+		log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("记录设备配置导入审计日志失败")
+	}
+
+	status := http.StatusCreated
+	if existing != nil {
+		status = http.StatusOK
+	}
+	s.respondJSON(w, status, map[string]interface{}{
+		"device":  device,
+		"session": session != nil,
+		"skipped": skipped,
+	})
+}
+
+// importedSession converts an exported session back into a device session
+func importedSession(codec *keyCodec, exported *deviceConfigSession) (*models.DeviceSession, error) {
+	devAddr, err := parseDevAddr(exported.DevAddr)
+	if err != nil {
+		return nil, fmt.Errorf("session.devAddr: invalid DevAddr")
+	}
+	joinEUI, err := parseEUI64(exported.JoinEUI)
+	if err != nil {
+		return nil, fmt.Errorf("session.joinEUI: invalid JoinEUI")
+	}
+
+	session := &models.DeviceSession{
+		DevAddr:     models.DevAddr(devAddr),
+		JoinEUI:     models.EUI64(joinEUI),
+		FCntUp:      exported.FCntUp,
+		NFCntDown:   exported.NFCntDown,
+		AFCntDown:   exported.AFCntDown,
+		ConfFCnt:    exported.ConfFCnt,
+		RX1Delay:    exported.RX1Delay,
+		RX1DROffset: exported.RX1DROffset,
+		RX2DR:       exported.RX2DR,
+		RX2Freq:     exported.RX2Freq,
+		TXPower:     exported.TXPower,
+		DR:          exported.DR,
+		ADR:         exported.ADR,
+		CreatedAt:   time.Now(),
+	}
+	session.UplinkReceived = exported.FCntUp > 0
+	if exported.UplinkReceived != nil {
+		session.UplinkReceived = *exported.UplinkReceived
+	}
+	for _, k := range []struct {
+		name string
+		src  string
+		dst  *string
+	}{
+		{"fNwkSIntKey", exported.FNwkSIntKey, &session.FNwkSIntKey},
+		{"sNwkSIntKey", exported.SNwkSIntKey, &session.SNwkSIntKey},
+		{"nwkSEncKey", exported.NwkSEncKey, &session.NwkSEncKey},
+		{"appSKey", exported.AppSKey, &session.AppSKey},
+	} {
+		key, err := codec.open("session."+k.name, k.src)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, fmt.Errorf("session.%s is required", k.name)
+		}
+		*k.dst = key
+	}
+
+	return session, nil
+}
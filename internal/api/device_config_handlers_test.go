@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+var testAdmin = &models.User{ID: uuid.New(), IsAdmin: true}
+
+// seedConfigServer creates a tenant with one application on a new server
+func seedConfigServer(t *testing.T) (*RESTServer, *storagetest.MemoryStore, *models.Application) {
+	t.Helper()
+
+	s, store := newTestServer(t)
+	ctx := context.Background()
+	tenant := &models.Tenant{Name: "tenant"}
+	if err := store.CreateTenant(ctx, tenant); err != nil {
+		t.Fatal(err)
+	}
+	app := &models.Application{Name: "app"}
+	app.TenantID = tenant.ID
+	if err := store.CreateApplication(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+	return s, store, app
+}
+
+// seedExportDevice stores an activated OTAA device with a profile, root keys and a session
+func seedExportDevice(t *testing.T, store *storagetest.MemoryStore, app *models.Application) *models.DeviceSession {
+	t.Helper()
+
+	ctx := context.Background()
+	profile := &models.DeviceProfile{Name: "class-a", RFRegion: "CN470", MACVersion: "1.0.3"}
+	if err := store.CreateDeviceProfile(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	device := &models.Device{
+		DevEUI:          models.EUI64(testDevEUI),
+		Name:            "meter",
+		ApplicationID:   app.ID,
+		DeviceProfileID: profile.ID,
+	}
+	device.TenantID = app.TenantID
+	if err := store.CreateDevice(ctx, device); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDeviceKeys(ctx, &models.DeviceKeys{DevEUI: device.DevEUI, AppKey: testKey}); err != nil {
+		t.Fatal(err)
+	}
+	session := &models.DeviceSession{
+		DevEUI:         device.DevEUI,
+		DevAddr:        models.DevAddr{0x26, 0x01, 0x1b, 0xda},
+		FNwkSIntKey:    "000102030405060708090a0b0c0d0e0f",
+		SNwkSIntKey:    "000102030405060708090a0b0c0d0e0f",
+		NwkSEncKey:     "000102030405060708090a0b0c0d0e0f",
+		AppSKey:        "0f0e0d0c0b0a09080706050403020100",
+		FCntUp:         120,
+		NFCntDown:      7,
+		AFCntDown:      33,
+		UplinkReceived: true,
+		RX1Delay:       1,
+		RX2Freq:        505300000,
+	}
+	if err := store.SaveDeviceSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// exportDeviceConfig exports testDevEUI from s with the key policy and passphrase
+func exportDeviceConfig(t *testing.T, s *RESTServer, policy, passphrase string) []byte {
+	t.Helper()
+
+	r := newRequest(http.MethodGet, nil, map[string]string{"dev_eui": testDevEUI.String()})
+	r.URL.RawQuery = "keys=" + policy
+	if passphrase != "" {
+		r.Header.Set(exportPassphraseHeader, passphrase)
+	}
+	w := serve(s.HandleExportDeviceConfig, withUser(r, testAdmin, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status = %d: %s", w.Code, w.Body)
+	}
+	return w.Body.Bytes()
+}
+
+// importDeviceConfig posts an exported document to s
+func importDeviceConfig(s *RESTServer, doc []byte, query, passphrase string) (int, string) {
+	r := newRequest(http.MethodPost, json.RawMessage(doc), nil)
+	r.URL.RawQuery = query
+	if passphrase != "" {
+		r.Header.Set(exportPassphraseHeader, passphrase)
+	}
+	w := serve(s.HandleImportDeviceConfig, withUser(r, testAdmin, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestDeviceConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		passphrase  string
+		wantKeys    bool
+		wantSession bool
+	}{
+		{"plain keys", keyPolicyPlain, "", true, true},
+		{"encrypted keys", keyPolicyEncrypted, "correct horse", true, true},
+		{"masked keys", keyPolicyMask, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcStore, srcApp := seedConfigServer(t)
+			want := seedExportDevice(t, srcStore, srcApp)
+			doc := exportDeviceConfig(t, src, tt.policy, tt.passphrase)
+
+			var exported deviceConfig
+			if err := json.Unmarshal(doc, &exported); err != nil {
+				t.Fatal(err)
+			}
+			if tt.policy != keyPolicyPlain && strings.Contains(string(doc), testKey) {
+				t.Errorf("%s export contains the plain AppKey", tt.policy)
+			}
+
+			dst, dstStore, dstApp := seedConfigServer(t)
+			code, body := importDeviceConfig(dst, doc, "application_id="+dstApp.ID.String(), tt.passphrase)
+			if code != http.StatusCreated {
+				t.Fatalf("import status = %d: %s", code, body)
+			}
+
+			ctx := context.Background()
+			device, err := dstStore.GetDevice(ctx, testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if device.Name != "meter" || device.ApplicationID != dstApp.ID || device.TenantID != dstApp.TenantID {
+				t.Errorf("imported device = %+v", device)
+			}
+			profile, err := dstStore.GetDeviceProfile(ctx, device.DeviceProfileID)
+			if err != nil || profile.Name != "class-a" || profile.RFRegion != "CN470" {
+				t.Errorf("imported profile = %+v, %v", profile, err)
+			}
+
+			keys, err := dstStore.GetDeviceKeys(ctx, testDevEUI)
+			if gotKeys := err == nil && keys.AppKey == testKey; gotKeys != tt.wantKeys {
+				t.Errorf("root keys imported = %v, want %v", gotKeys, tt.wantKeys)
+			}
+
+			session, err := dstStore.GetDeviceSession(ctx, testDevEUI)
+			if (err == nil) != tt.wantSession {
+				t.Fatalf("session imported = %v, want %v", err == nil, tt.wantSession)
+			}
+			if !tt.wantSession {
+				return
+			}
+			if session.DevAddr != want.DevAddr || session.AppSKey != want.AppSKey || session.NwkSEncKey != want.NwkSEncKey ||
+				session.FCntUp != want.FCntUp || session.NFCntDown != want.NFCntDown || session.AFCntDown != want.AFCntDown ||
+				!session.UplinkReceived || session.RX2Freq != want.RX2Freq {
+				t.Errorf("imported session = %+v, want %+v", session, want)
+			}
+			if device.DevAddr == nil || *device.DevAddr != want.DevAddr {
+				t.Errorf("device DevAddr = %v, want %s", device.DevAddr, want.DevAddr)
+			}
+		})
+	}
+}
+
+func TestImportDeviceConfigConflict(t *testing.T) {
+	src, srcStore, srcApp := seedConfigServer(t)
+	seedExportDevice(t, srcStore, srcApp)
+	doc := exportDeviceConfig(t, src, keyPolicyPlain, "")
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"first import", "", http.StatusCreated},
+		{"existing device", "", http.StatusConflict},
+		{"explicit fail", "on_conflict=fail", http.StatusConflict},
+		{"overwrite", "on_conflict=overwrite", http.StatusOK},
+		{"invalid policy", "on_conflict=merge", http.StatusBadRequest},
+	}
+
+	dst, _, dstApp := seedConfigServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := "application_id=" + dstApp.ID.String()
+			if tt.query != "" {
+				query += "&" + tt.query
+			}
+			if code, body := importDeviceConfig(dst, doc, query, ""); code != tt.want {
+				t.Errorf("status = %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestImportDeviceConfigInvalid(t *testing.T) {
+	src, srcStore, srcApp := seedConfigServer(t)
+	seedExportDevice(t, srcStore, srcApp)
+	encrypted := exportDeviceConfig(t, src, keyPolicyEncrypted, "secret")
+
+	var doc map[string]interface{}
+	json.Unmarshal(exportDeviceConfig(t, src, keyPolicyPlain, ""), &doc)
+	modified := func(change func(doc map[string]interface{})) []byte {
+		var cp map[string]interface{}
+		b, _ := json.Marshal(doc)
+		json.Unmarshal(b, &cp)
+		change(cp)
+		b, _ = json.Marshal(cp)
+		return b
+	}
+
+	tests := []struct {
+		name       string
+		doc        []byte
+		passphrase string
+	}{
+		{"wrong passphrase", encrypted, "guess"},
+		{"missing passphrase", encrypted, ""},
+		{"unsupported version", modified(func(d map[string]interface{}) { d["version"] = 2 }), ""},
+		{"no device", modified(func(d map[string]interface{}) { delete(d, "device") }), ""},
+		{"invalid key", modified(func(d map[string]interface{}) { d["keys"].(map[string]interface{})["appKey"] = "00" }), ""},
+		{"invalid session DevAddr", modified(func(d map[string]interface{}) { d["session"].(map[string]interface{})["devAddr"] = "xyz" }), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, dstStore, dstApp := seedConfigServer(t)
+			if code, body := importDeviceConfig(dst, tt.doc, "application_id="+dstApp.ID.String(), tt.passphrase); code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", code, body)
+			}
+			if _, err := dstStore.GetDevice(context.Background(), testDevEUI); err == nil {
+				t.Error("device created by a rejected import")
+			}
+		})
+	}
+}
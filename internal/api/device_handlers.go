@@ -9,8 +9,10 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/lorawan-server/lorawan-server-pro/internal/geolocation"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
 
 // HandleListDevices lists devices
@@ -28,6 +30,15 @@ func (s *RESTServer) HandleListDevices(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusBadRequest, "invalid application_id")
 		return
 	}
+	allowed, err := s.canAccessApplication(r, appID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !allowed {
+		s.respondError(w, http.StatusNotFound, "application not found")
+		return
+	}
 
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	if limit == 0 {
@@ -57,14 +68,14 @@ func (s *RESTServer) HandleCreateDevice(w http.ResponseWriter, r *http.Request)
 		DeviceProfileID uuid.UUID `json:"device_profile_id" validate:"required"`
 
 		// OTAA keys
-		AppKey  string `json:"app_key,omitempty" validate:"omitempty,len=32"`
-		NwkKey  string `json:"nwk_key,omitempty" validate:"omitempty,len=32"`
+		AppKey  string `json:"app_key,omitempty" validate:"omitempty,aeskey"`
+		NwkKey  string `json:"nwk_key,omitempty" validate:"omitempty,aeskey"`
 		JoinEUI string `json:"join_eui,omitempty" validate:"omitempty,len=16"`
 
 		// ABP params
 		DevAddr string `json:"dev_addr,omitempty" validate:"omitempty,len=8"`
-		AppSKey string `json:"app_s_key,omitempty" validate:"omitempty,len=32"`
-		NwkSKey string `json:"nwk_s_key,omitempty" validate:"omitempty,len=32"`
+		AppSKey string `json:"app_s_key,omitempty" validate:"omitempty,aeskey"`
+		NwkSKey string `json:"nwk_s_key,omitempty" validate:"omitempty,aeskey"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -86,11 +97,22 @@ func (s *RESTServer) HandleCreateDevice(w http.ResponseWriter, r *http.Request)
 
 	// Get application to determine tenant
 	app, err := s.store.GetApplication(r.Context(), req.ApplicationID)
-	if err != nil {
+	if err != nil || !canAccessTenant(r, app.TenantID) {
 		s.respondError(w, http.StatusBadRequest, "application not found")
 		return
 	}
 
+	// Check the profile region against the tenant's licensed regions
+	profile, err := s.store.GetDeviceProfile(r.Context(), req.DeviceProfileID)
+	if err != nil || (profile.TenantID != nil && *profile.TenantID != app.TenantID) {
+		s.respondError(w, http.StatusBadRequest, "device profile not found")
+		return
+	}
+	if status, err := s.checkTenantRegion(r.Context(), app.TenantID, profile.RFRegion); err != nil {
+		s.respondError(w, status, err.Error())
+		return
+	}
+
 	device := &models.Device{
 		DevEUI:      models.EUI64(devEUI),
 		Name:        req.Name,
@@ -194,6 +216,8 @@ func (s *RESTServer) HandleUpdateDevice(w http.ResponseWriter, r *http.Request)
 		Name        string `json:"name" validate:"required"`
 		Description string `json:"description"`
 		IsDisabled  bool   `json:"is_disabled"`
+		// 省略时保持不变
+		ForwardDisabled *bool `json:"forward_disabled"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -219,6 +243,9 @@ func (s *RESTServer) HandleUpdateDevice(w http.ResponseWriter, r *http.Request)
 	device.Name = req.Name
 	device.Description = req.Description
 	device.IsDisabled = req.IsDisabled
+	if req.ForwardDisabled != nil {
+		device.ForwardDisabled = *req.ForwardDisabled
+	}
 
 	if err := s.store.UpdateDevice(ctx, device); err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
@@ -251,6 +278,52 @@ func (s *RESTServer) HandleDeleteDevice(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// HandlePurgeDevice deletes a device together with its keys, sessions, frames and history
+func (s *RESTServer) HandlePurgeDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	// Purging cannot be undone, so check ownership before touching any table
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	allowed, err := s.canAccessDevice(r, device)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !allowed {
+		s.respondError(w, http.StatusNotFound, "device not found")
+		return
+	}
+
+	counts, err := s.store.PurgeDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"dev_eui": devEUI.String(),
+		"deleted": counts,
+	})
+}
+
 // HandleActivateDevice activates a device
 func (s *RESTServer) HandleActivateDevice(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -314,6 +387,36 @@ func (s *RESTServer) HandleActivateDevice(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// HandleResetDeviceDevAddr clears the stored DevAddr so the next join allocates a new one
+func (s *RESTServer) HandleResetDeviceDevAddr(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	device.DevAddr = nil
+
+	if err := s.store.UpdateDevice(ctx, device); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // HandleGetDeviceKeys gets device keys
 func (s *RESTServer) HandleGetDeviceKeys(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -353,8 +456,8 @@ func (s *RESTServer) HandleSetDeviceKeys(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
-		AppKey string `json:"app_key"`
-		NwkKey string `json:"nwk_key"`
+		AppKey string `json:"app_key" validate:"required,aeskey"`
+		NwkKey string `json:"nwk_key" validate:"aeskey"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -362,6 +465,11 @@ func (s *RESTServer) HandleSetDeviceKeys(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := s.validator.Validate(req); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	keys := &models.DeviceKeys{
 		DevEUI: models.EUI64(devEUI),
 		AppKey: req.AppKey,
@@ -415,3 +523,112 @@ func (s *RESTServer) HandleListDeviceDownlinks(w http.ResponseWriter, r *http.Re
 		"total":     len(response),
 	})
 }
+
+// HandleGetDeviceLocation resolves the device location from recent uplinks
+func (s *RESTServer) HandleGetDeviceLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUIStr := chi.URLParam(r, "dev_eui")
+	devEUI, err := parseEUI64(devEUIStr)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	frames, _, err := s.store.ListUplinkFrames(ctx, devEUI, s.geo.MaxFrames(), 0)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Attach gateway locations to each reception
+	gateways := make(map[string]*models.Gateway)
+	var rxInfo []geolocation.RXInfo
+	for _, frame := range frames {
+		for _, rx := range frameRXInfo(frame) {
+			gw, ok := gateways[rx.GatewayID]
+			if !ok {
+				if gwEUI, err := lorawan.ParseGatewayID(rx.GatewayID); err == nil {
+					gw, _ = s.store.GetGateway(ctx, gwEUI)
+				}
+				gateways[rx.GatewayID] = gw
+			}
+			if gw == nil || gw.Location == nil {
+				continue
+			}
+
+			rx.Latitude = gw.Location.Latitude
+			rx.Longitude = gw.Location.Longitude
+			rx.Altitude = gw.Location.Altitude
+			rx.Time = frame.ReceivedAt
+			rxInfo = append(rxInfo, rx)
+		}
+	}
+
+	lat, lon, err := s.geo.ForTenant(device.TenantID).Resolve(rxInfo)
+	if err != nil {
+		if err == geolocation.ErrNoLocation {
+			s.respondError(w, http.StatusNotFound, "no gateway location available")
+			return
+		}
+		s.respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"devEUI":    devEUIStr,
+		"latitude":  lat,
+		"longitude": lon,
+		"gateways":  len(rxInfo),
+		"frames":    len(frames),
+	})
+}
+
+// frameRXInfo extracts per-gateway reception info stored with an uplink frame
+func frameRXInfo(frame *models.UplinkFrame) []geolocation.RXInfo {
+	var raw []byte
+	switch v := frame.RXInfo.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		raw = data
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+
+	var result []geolocation.RXInfo
+	for _, item := range items {
+		gatewayID, _ := item["gatewayID"].(string)
+		if gatewayID == "" {
+			continue
+		}
+		rssi, _ := item["rssi"].(float64)
+		snr, _ := item["snr"].(float64)
+		result = append(result, geolocation.RXInfo{
+			GatewayID: gatewayID,
+			RSSI:      rssi,
+			SNR:       snr,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+var testDevEUI = lorawan.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x01}
+
+const testKey = "2b7e151628aed2a6abf7158809cf4f3c"
+
+func TestResetDeviceDevAddr(t *testing.T) {
+	tests := []struct {
+		name   string
+		devEUI string
+		want   int
+	}{
+		{"existing device", testDevEUI.String(), http.StatusNoContent},
+		{"unknown device", "0000000000000002", http.StatusNotFound},
+		{"invalid dev_eui", "zz", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			devAddr := models.DevAddr{0x01, 0x02, 0x03, 0x04}
+			store.CreateDevice(context.Background(), &models.Device{DevEUI: models.EUI64(testDevEUI), DevAddr: &devAddr})
+
+			w := serve(s.HandleResetDeviceDevAddr, newRequest(http.MethodDelete, nil, map[string]string{"dev_eui": tt.devEUI}))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			device, _ := store.GetDevice(context.Background(), testDevEUI)
+			if reset := device.DevAddr == nil; reset != (tt.want == http.StatusNoContent) {
+				t.Errorf("DevAddr = %v after status %d", device.DevAddr, w.Code)
+			}
+		})
+	}
+}
+
+func TestPurgeDevice(t *testing.T) {
+	tests := []struct {
+		name       string
+		sameTenant bool
+		admin      bool
+		want       int
+	}{
+		{"tenant user", true, false, http.StatusOK},
+		{"administrator", false, true, http.StatusOK},
+		{"other tenant", false, false, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			ctx := context.Background()
+
+			tenant := &models.Tenant{Name: "tenant"}
+			store.CreateTenant(ctx, tenant)
+			app := &models.Application{Name: "app"}
+			app.TenantID = tenant.ID
+			store.CreateApplication(ctx, app)
+
+			device := &models.Device{DevEUI: models.EUI64(testDevEUI), ApplicationID: app.ID}
+			device.TenantID = tenant.ID
+			store.CreateDevice(ctx, device)
+			store.SetDeviceKeys(ctx, &models.DeviceKeys{DevEUI: models.EUI64(testDevEUI)})
+			store.SaveDeviceSession(ctx, &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)})
+			store.SaveUplinkFrame(ctx, &models.UplinkFrame{DevEUI: models.EUI64(testDevEUI)})
+			store.CreateDownlinkFrame(ctx, &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), IsPending: true})
+			store.EnqueueMACCommand(ctx, &models.MACCommandQueueItem{DevEUI: models.EUI64(testDevEUI)})
+			store.RecordDevNonce(ctx, lorawan.EUI64{}, testDevEUI, 1)
+
+			userTenant := &models.Tenant{Name: "other"}
+			if tt.sameTenant {
+				userTenant = tenant
+			}
+			r := newRequest(http.MethodPost, nil, map[string]string{"dev_eui": testDevEUI.String()})
+			w := serve(s.HandlePurgeDevice, withUser(r, &models.User{IsAdmin: tt.admin}, userTenant))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			purged := tt.want == http.StatusOK
+			_, err := store.GetDevice(ctx, testDevEUI)
+			if gone := err == storage.ErrNotFound; gone != purged {
+				t.Fatalf("device gone = %v, want %v", gone, purged)
+			}
+			if !purged {
+				return
+			}
+			if _, err := store.GetDeviceKeys(ctx, testDevEUI); err != storage.ErrNotFound {
+				t.Error("device keys left after purge")
+			}
+			if _, err := store.GetDeviceSession(ctx, testDevEUI); err != storage.ErrNotFound {
+				t.Error("device session left after purge")
+			}
+			if _, n, _ := store.ListUplinkFrames(ctx, testDevEUI, 0, 0); n != 0 {
+				t.Errorf("%d uplink frames left after purge", n)
+			}
+			if frames, _ := store.GetPendingDownlinks(ctx, testDevEUI); len(frames) != 0 {
+				t.Errorf("%d downlinks left after purge", len(frames))
+			}
+			if items, _ := store.GetPendingMACCommands(ctx, testDevEUI); len(items) != 0 {
+				t.Errorf("%d MAC commands left after purge", len(items))
+			}
+			if used, _ := store.DevNonceUsed(ctx, lorawan.EUI64{}, testDevEUI, 1); used {
+				t.Error("DevNonce left after purge")
+			}
+		})
+	}
+}
+
+func TestCreateDeviceKeyValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string]interface{}
+		want int
+	}{
+		{"valid OTAA keys", map[string]interface{}{"app_key": testKey, "nwk_key": testKey}, http.StatusCreated},
+		{"valid ABP keys", map[string]interface{}{"dev_addr": "26011bda", "app_s_key": testKey, "nwk_s_key": testKey}, http.StatusCreated},
+		{"app_key not hex", map[string]interface{}{"app_key": "zz" + testKey[2:]}, http.StatusBadRequest},
+		{"nwk_key too short", map[string]interface{}{"app_key": testKey, "nwk_key": testKey[:30]}, http.StatusBadRequest},
+		{"app_s_key not hex", map[string]interface{}{"dev_addr": "26011bda", "app_s_key": "x" + testKey[1:], "nwk_s_key": testKey}, http.StatusBadRequest},
+		{"nwk_s_key too long", map[string]interface{}{"dev_addr": "26011bda", "app_s_key": testKey, "nwk_s_key": testKey + "00"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			ctx := context.Background()
+			tenant := &models.Tenant{Name: "tenant"}
+			store.CreateTenant(ctx, tenant)
+			app := &models.Application{Name: "app"}
+			app.TenantID = tenant.ID
+			store.CreateApplication(ctx, app)
+			profile := &models.DeviceProfile{Name: "profile", TenantID: &tenant.ID}
+			store.CreateDeviceProfile(ctx, profile)
+
+			body := map[string]interface{}{
+				"dev_eui":           testDevEUI.String(),
+				"name":              "device",
+				"application_id":    app.ID,
+				"device_profile_id": profile.ID,
+			}
+			for k, v := range tt.keys {
+				body[k] = v
+			}
+			w := serve(s.HandleCreateDevice, withUser(newRequest(http.MethodPost, body, nil), &models.User{}, tenant))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			if _, err := store.GetDevice(ctx, testDevEUI); (err == nil) != (tt.want == http.StatusCreated) {
+				t.Errorf("device stored = %v after status %d", err == nil, w.Code)
+			}
+		})
+	}
+}
+
+func TestSetDeviceKeysValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"valid", map[string]interface{}{"app_key": testKey, "nwk_key": testKey}, http.StatusNoContent},
+		{"app key only", map[string]interface{}{"app_key": testKey}, http.StatusNoContent},
+		{"missing app key", map[string]interface{}{"nwk_key": testKey}, http.StatusBadRequest},
+		{"app key not hex", map[string]interface{}{"app_key": "zz" + testKey[2:]}, http.StatusBadRequest},
+		{"nwk key odd length", map[string]interface{}{"app_key": testKey, "nwk_key": testKey[:31]}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			store.CreateDevice(context.Background(), &models.Device{DevEUI: models.EUI64(testDevEUI)})
+
+			w := serve(s.HandleSetDeviceKeys, newRequest(http.MethodPut, tt.body, map[string]string{"dev_eui": testDevEUI.String()}))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			keys, err := store.GetDeviceKeys(context.Background(), testDevEUI)
+			if stored := err == nil && keys.AppKey != ""; stored != (tt.want == http.StatusNoContent) {
+				t.Errorf("keys stored = %v after status %d", stored, w.Code)
+			}
+		})
+	}
+}
+
+func TestUpdateDeviceForwardDisabled(t *testing.T) {
+	muted, unmuted := true, false
+
+	tests := []struct {
+		name    string
+		initial bool
+		set     *bool // nil omits forward_disabled
+		want    bool
+	}{
+		{"mute", false, &muted, true},
+		{"unmute", true, &unmuted, false},
+		{"omitted keeps muted", true, nil, true},
+		{"omitted keeps unmuted", false, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			store.CreateDevice(context.Background(), &models.Device{DevEUI: models.EUI64(testDevEUI), Name: "device", ForwardDisabled: tt.initial})
+
+			body := map[string]interface{}{"name": "device"}
+			if tt.set != nil {
+				body["forward_disabled"] = *tt.set
+			}
+			w := serve(s.HandleUpdateDevice, newRequest(http.MethodPut, body, map[string]string{"dev_eui": testDevEUI.String()}))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			device, _ := store.GetDevice(context.Background(), testDevEUI)
+			if device.ForwardDisabled != tt.want {
+				t.Errorf("ForwardDisabled = %v, want %v", device.ForwardDisabled, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
@@ -12,8 +13,11 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/lorawan-server/lorawan-server-pro/internal/codec"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/network"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage" // Add this import
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
 
 // HandleSendDownlink sends downlink data
@@ -28,10 +32,18 @@ func (s *RESTServer) HandleSendDownlink(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
-		FPort     uint8  `json:"fPort" validate:"required,min=1,max=223"`
-		Data      string `json:"data" validate:"required"` // hex encoded
+		FPort     uint8  `json:"fPort"`
+		Data      string `json:"data"` // hex encoded
 		Confirmed bool   `json:"confirmed"`
 		Reference string `json:"reference,omitempty"`
+
+		// 由应用的 PayloadCodec 编码，data 为空时使用
+		Object map[string]interface{} `json:"object,omitempty"`
+
+		// 诊断用：强制指定下行频率/速率/窗口
+		Frequency uint32 `json:"frequency,omitempty"`
+		DataRate  *int   `json:"dataRate,omitempty"`
+		Window    string `json:"window,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -39,11 +51,34 @@ func (s *RESTServer) HandleSendDownlink(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := s.validator.Validate(req); err != nil {
+	// 应用下行只能使用 1-223；FPort 0 只用于 MAC 命令，须通过 mac-command 接口下发
+	if !lorawan.ValidApplicationFPort(req.FPort) {
+		s.respondError(w, http.StatusBadRequest, "fPort must be between 1 and 223, MAC commands use the mac-command endpoint")
+		return
+	}
+
+	override := &network.DownlinkOverride{
+		Frequency: req.Frequency,
+		DataRate:  req.DataRate,
+		Window:    req.Window,
+	}
+	if err := override.Validate(s.config); err != nil {
 		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// 覆盖参数需要直接转发给 Network Server
+	nc := s.nc.Load()
+	if !override.Empty() && nc == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "downlink overrides require a NATS connection")
+		return
+	}
+
+	if req.Data == "" && req.Object == nil {
+		s.respondError(w, http.StatusBadRequest, "data or object is required")
+		return
+	}
+
 	// Decode data
 	data, err := hex.DecodeString(req.Data)
 	if err != nil {
@@ -64,6 +99,28 @@ func (s *RESTServer) HandleSendDownlink(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if req.Data == "" {
+		app, err := s.store.GetApplication(ctx, device.ApplicationID)
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		data, err = codec.EncodeObject(app.PayloadCodec, app.PayloadEncoder, req.FPort, req.Object)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(data) > 242 {
+			s.respondError(w, http.StatusBadRequest, "data too large (max 242 bytes)")
+			return
+		}
+	}
+
+	if err := s.checkDownlinkPayloadSize(ctx, device, override, len(data)); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Create downlink frame
 	frame := &models.DownlinkFrame{
 		DevEUI:        device.DevEUI,
@@ -74,27 +131,25 @@ func (s *RESTServer) HandleSendDownlink(w http.ResponseWriter, r *http.Request)
 		Reference:     req.Reference,
 	}
 
-	if err := s.store.CreateDownlinkFrame(ctx, frame); err != nil {
+	if err := s.queueDownlink(ctx, frame, nil); err != nil {
 		s.respondError(w, http.StatusInternalServerError, "failed to queue downlink")
 		return
 	}
 
-	// Log event
-	event := &models.EventLog{
-		ApplicationID: &device.ApplicationID,
-		DevEUI:        &device.DevEUI,
-		Type:          models.EventTypeDownlinkQueued,
-		Level:         models.EventLevelInfo,
-		Description:   "Downlink queued",
-		Details: models.Variables{
-			"id":        frame.ID,
+	if !override.Empty() {
+		nsMsg, _ := json.Marshal(map[string]interface{}{
+			"devEUI":    devEUI.String(),
 			"fPort":     req.FPort,
-			"dataSize":  len(data),
+			"data":      data,
 			"confirmed": req.Confirmed,
-			"reference": req.Reference,
-		},
+			"id":        frame.ID.String(),
+			"override":  override,
+		})
+		if err := nc.Publish(fmt.Sprintf("ns.device.%s.tx", devEUI.String()), nsMsg); err != nil {
+			s.respondError(w, http.StatusInternalServerError, "failed to forward downlink")
+			return
+		}
 	}
-	s.store.CreateEventLog(ctx, event)
 
 	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
 		"id":      frame.ID,
@@ -103,6 +158,57 @@ func (s *RESTServer) HandleSendDownlink(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// checkDownlinkPayloadSize rejects payloads larger than the maximum of the
+// device's current downlink data rate. Devices without a session are not
+// checked here; the Network Server holds back oversized downlinks when it
+// schedules them.
+func (s *RESTServer) checkDownlinkPayloadSize(ctx context.Context, device *models.Device, override *network.DownlinkOverride, size int) error {
+	session, err := s.store.GetDeviceSession(ctx, lorawan.EUI64(device.DevEUI))
+	if err != nil {
+		return nil
+	}
+
+	var profile *models.DeviceProfile
+	if p, err := s.store.GetDeviceProfile(ctx, device.DeviceProfileID); err == nil {
+		profile = p
+	}
+
+	maxSize, dr := network.MaxDownlinkPayloadSize(s.config, session, profile, override)
+	if size > maxSize {
+		return fmt.Errorf("data too large for DR%d (max %d bytes, got %d)", dr, maxSize, size)
+	}
+	return nil
+}
+
+// queueDownlink stores a downlink frame for the network server and logs the DOWNLINK_QUEUED event
+func (s *RESTServer) queueDownlink(ctx context.Context, frame *models.DownlinkFrame, details models.Variables) error {
+	if err := s.store.CreateDownlinkFrame(ctx, frame); err != nil {
+		return err
+	}
+
+	if details == nil {
+		details = models.Variables{}
+	}
+	details["id"] = frame.ID
+	details["fPort"] = frame.FPort
+	details["dataSize"] = len(frame.Data)
+	details["confirmed"] = frame.Confirmed
+	details["reference"] = frame.Reference
+
+	// Log event
+	event := &models.EventLog{
+		ApplicationID: &frame.ApplicationID,
+		DevEUI:        &frame.DevEUI,
+		Type:          models.EventTypeDownlinkQueued,
+		Level:         models.EventLevelInfo,
+		Description:   "Downlink queued",
+		Details:       details,
+	}
+	s.store.CreateEventLog(ctx, event)
+
+	return nil
+}
+
 // HandleListDownlinks lists pending downlinks
 func (s *RESTServer) HandleListDownlinks(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -157,6 +263,33 @@ func (s *RESTServer) HandleCancelDownlink(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// 其他租户设备的下行按不存在处理
+	frame, err := s.store.GetDownlinkFrame(ctx, downlinkID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "downlink not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	device, err := s.store.GetDevice(ctx, lorawan.EUI64(frame.DevEUI))
+	if err != nil && err != storage.ErrNotFound {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	allowed := false
+	if device != nil {
+		if allowed, err = s.canAccessDevice(r, device); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if !allowed {
+		s.respondError(w, http.StatusNotFound, "downlink not found")
+		return
+	}
+
 	if err := s.store.DeleteDownlinkFrame(ctx, downlinkID); err != nil {
 		if err == storage.ErrNotFound {
 			s.respondError(w, http.StatusNotFound, "downlink not found")
@@ -322,3 +455,110 @@ func ptrToInt(p *uint8) int {
 	}
 	return int(*p)
 }
+
+// HandleSendDownlinkByDevAddr resolves a DevAddr to its device and queues the downlink for it.
+// When several devices share the DevAddr the dev_eui query parameter selects one.
+func (s *RESTServer) HandleSendDownlinkByDevAddr(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devAddr, err := parseDevAddr(chi.URLParam(r, "dev_addr"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_addr")
+		return
+	}
+
+	// 已入网会话和 ABP 设备都可能持有该 DevAddr
+	var candidates []string
+	seen := make(map[string]bool)
+	sessions, err := s.store.GetDeviceSessionByDevAddr(ctx, devAddr)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, session := range sessions {
+		if eui := session.DevEUI.String(); !seen[eui] {
+			seen[eui] = true
+			candidates = append(candidates, eui)
+		}
+	}
+	devices, err := s.store.GetDeviceByDevAddr(ctx, devAddr)
+	if err != nil && err != storage.ErrNotFound {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, device := range devices {
+		if eui := device.DevEUI.String(); !seen[eui] {
+			seen[eui] = true
+			candidates = append(candidates, eui)
+		}
+	}
+
+	// DevAddr 路由不经过 deviceAccessMiddleware，其他租户的设备不参与匹配
+	candidates, err = s.accessibleDevEUIs(r, candidates)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	seen = make(map[string]bool)
+	for _, eui := range candidates {
+		seen[eui] = true
+	}
+
+	var devEUI string
+	if want := r.URL.Query().Get("dev_eui"); want != "" {
+		eui, err := parseEUI64(want)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+			return
+		}
+		devEUI = eui.String()
+		if !seen[devEUI] {
+			s.respondError(w, http.StatusNotFound, fmt.Sprintf("device %s does not use dev_addr %s", devEUI, devAddr))
+			return
+		}
+	} else {
+		switch len(candidates) {
+		case 0:
+			s.respondError(w, http.StatusNotFound, "no device with this dev_addr")
+			return
+		case 1:
+			devEUI = candidates[0]
+		default:
+			s.respondJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":   "dev_addr is shared by several devices, specify dev_eui",
+				"devEUIs": candidates,
+			})
+			return
+		}
+	}
+
+	// 其余校验和入队与按 DevEUI 下发相同
+	chi.RouteContext(ctx).URLParams.Add("dev_eui", devEUI)
+	s.HandleSendDownlink(w, r)
+}
+
+// accessibleDevEUIs keeps the DevEUIs of devices the authenticated user may act on
+func (s *RESTServer) accessibleDevEUIs(r *http.Request, devEUIs []string) ([]string, error) {
+	var allowed []string
+	for _, v := range devEUIs {
+		eui, err := parseEUI64(v)
+		if err != nil {
+			continue
+		}
+		device, err := s.store.GetDevice(r.Context(), eui)
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.canAccessDevice(r, device)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			allowed = append(allowed, v)
+		}
+	}
+	return allowed, nil
+}
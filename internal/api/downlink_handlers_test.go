@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestSendDownlinkFPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		fPort    int
+		want     int
+		wantBody string
+	}{
+		{"MAC command port", 0, http.StatusBadRequest, "mac-command endpoint"},
+		{"first application port", 1, http.StatusAccepted, ""},
+		{"last application port", 223, http.StatusAccepted, ""},
+		{"test protocol port", 224, http.StatusBadRequest, "between 1 and 223"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			store.CreateDevice(context.Background(), &models.Device{DevEUI: models.EUI64(testDevEUI), Name: "test"})
+
+			r := newRequest(http.MethodPost, map[string]interface{}{"fPort": tt.fPort, "data": "0102"}, map[string]string{"dev_eui": testDevEUI.String()})
+			w := serve(s.HandleSendDownlink, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to mention %q", w.Body, tt.wantBody)
+			}
+
+			frames := store.DownlinkFrames()
+			if queued := len(frames) > 0; queued != (tt.want == http.StatusAccepted) {
+				t.Errorf("downlink queued = %v after status %d", queued, w.Code)
+			}
+		})
+	}
+}
+
+func TestSendMulticastDownlinkFPort(t *testing.T) {
+	tests := []struct {
+		fPort int
+		want  int
+	}{
+		{0, http.StatusBadRequest},
+		{224, http.StatusBadRequest},
+		// valid ports get as far as the NATS check
+		{1, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		s, _ := newTestServer(t)
+		r := newRequest(http.MethodPost, map[string]interface{}{"fPort": tt.fPort, "data": "0102"}, nil)
+		if w := serve(s.HandleSendMulticastDownlink, r); w.Code != tt.want {
+			t.Errorf("fPort %d: status = %d, want %d: %s", tt.fPort, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestSendDownlinkByDevAddr(t *testing.T) {
+	devAddr := models.DevAddr{0x26, 0x01, 0x1b, 0xda}
+	otherEUI := models.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x02}
+
+	tests := []struct {
+		name    string
+		setup   func(store *storagetest.MemoryStore)
+		devAddr string
+		query   string
+		want    int
+		wantEUI models.EUI64 // device the downlink is queued for
+	}{
+		{"joined device", func(store *storagetest.MemoryStore) {
+			store.SaveDeviceSession(context.Background(), &models.DeviceSession{DevEUI: models.EUI64(testDevEUI), DevAddr: devAddr})
+		}, "26011bda", "", http.StatusAccepted, models.EUI64(testDevEUI)},
+		{"ABP device", func(store *storagetest.MemoryStore) {
+			device, _ := store.GetDevice(context.Background(), testDevEUI)
+			device.DevAddr = &devAddr
+			store.UpdateDevice(context.Background(), device)
+		}, "26011bda", "", http.StatusAccepted, models.EUI64(testDevEUI)},
+		{"shared without dev_eui", sharedDevAddr(devAddr, otherEUI), "26011bda", "", http.StatusConflict, models.EUI64{}},
+		{"shared with dev_eui", sharedDevAddr(devAddr, otherEUI), "26011bda", "dev_eui=" + otherEUI.String(), http.StatusAccepted, otherEUI},
+		{"dev_eui not using the DevAddr", sharedDevAddr(devAddr, otherEUI), "26011bda", "dev_eui=0000000000000009", http.StatusNotFound, models.EUI64{}},
+		{"unknown DevAddr", func(store *storagetest.MemoryStore) {}, "26011bdb", "", http.StatusNotFound, models.EUI64{}},
+		{"invalid DevAddr", func(store *storagetest.MemoryStore) {}, "nope", "", http.StatusBadRequest, models.EUI64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store, app := seedConfigServer(t)
+			ctx := context.Background()
+			store.CreateDevice(ctx, &models.Device{DevEUI: models.EUI64(testDevEUI), Name: "test", ApplicationID: app.ID})
+			store.CreateDevice(ctx, &models.Device{DevEUI: otherEUI, Name: "other", ApplicationID: app.ID})
+			tt.setup(store)
+
+			r := newRequest(http.MethodPost, map[string]interface{}{"fPort": 10, "data": "0102"}, map[string]string{"dev_addr": tt.devAddr})
+			r.URL.RawQuery = tt.query
+			w := serve(s.HandleSendDownlinkByDevAddr, withUser(r, testAdmin, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			frames := store.DownlinkFrames()
+			if tt.want != http.StatusAccepted {
+				if len(frames) != 0 {
+					t.Errorf("queued %d downlinks on status %d", len(frames), w.Code)
+				}
+				if tt.want == http.StatusConflict && !strings.Contains(w.Body.String(), otherEUI.String()) {
+					t.Errorf("conflict response does not list the candidates: %s", w.Body)
+				}
+				return
+			}
+			if len(frames) != 1 || frames[0].DevEUI != tt.wantEUI || frames[0].FPort != 10 {
+				t.Errorf("queued frames = %+v, want one for %s", frames, tt.wantEUI)
+			}
+		})
+	}
+}
+
+// sharedDevAddr gives testDevEUI a session and other an ABP assignment with the same DevAddr
+func sharedDevAddr(devAddr models.DevAddr, other models.EUI64) func(store *storagetest.MemoryStore) {
+	return func(store *storagetest.MemoryStore) {
+		ctx := context.Background()
+		store.SaveDeviceSession(ctx, &models.DeviceSession{DevEUI: models.EUI64(testDevEUI), DevAddr: devAddr})
+		device, _ := store.GetDevice(ctx, lorawan.EUI64(other))
+		device.DevAddr = &devAddr
+		store.UpdateDevice(ctx, device)
+	}
+}
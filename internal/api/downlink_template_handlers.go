@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+// downlinkTemplateRequest is the body for creating or updating a downlink template
+type downlinkTemplateRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description"`
+	FPort       uint8  `json:"fPort" validate:"required,min=1,max=223"`
+	Data        string `json:"data" validate:"required"` // hex encoded
+	Confirmed   bool   `json:"confirmed"`
+}
+
+// apply validates the request and copies it onto the template
+func (req *downlinkTemplateRequest) apply(s *RESTServer, tmpl *models.DownlinkTemplate) error {
+	if err := s.validator.Validate(req); err != nil {
+		return err
+	}
+	// 模板名出现在 URL 路径中
+	if len(req.Name) > 100 || strings.ContainsAny(req.Name, "/?#") {
+		return fmt.Errorf("name must be at most 100 characters and must not contain '/', '?' or '#'")
+	}
+	if req.FPort > 223 {
+		return fmt.Errorf("fPort must be between 1 and 223")
+	}
+	data, err := hex.DecodeString(req.Data)
+	if err != nil {
+		return fmt.Errorf("invalid hex data")
+	}
+	if len(data) > 242 {
+		return fmt.Errorf("data too large (max 242 bytes)")
+	}
+
+	tmpl.Name = req.Name
+	tmpl.Description = req.Description
+	tmpl.FPort = int(req.FPort)
+	tmpl.Data = data
+	tmpl.Confirmed = req.Confirmed
+	return nil
+}
+
+func downlinkTemplateResponse(tmpl *models.DownlinkTemplate) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            tmpl.ID,
+		"applicationId": tmpl.ApplicationID,
+		"name":          tmpl.Name,
+		"description":   tmpl.Description,
+		"fPort":         tmpl.FPort,
+		"data":          hex.EncodeToString(tmpl.Data),
+		"confirmed":     tmpl.Confirmed,
+		"createdAt":     tmpl.CreatedAt,
+		"updatedAt":     tmpl.UpdatedAt,
+	}
+}
+
+// getDownlinkTemplate loads the template named in the URL, writing the error response on failure
+func (s *RESTServer) getDownlinkTemplate(w http.ResponseWriter, r *http.Request) (*models.DownlinkTemplate, bool) {
+	appID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid application id")
+		return nil, false
+	}
+
+	tmpl, err := s.store.GetDownlinkTemplate(r.Context(), appID, chi.URLParam(r, "name"))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "downlink template not found")
+			return nil, false
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	return tmpl, true
+}
+
+// HandleListDownlinkTemplates lists an application's downlink templates
+func (s *RESTServer) HandleListDownlinkTemplates(w http.ResponseWriter, r *http.Request) {
+	appID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid application id")
+		return
+	}
+
+	templates, err := s.store.ListDownlinkTemplates(r.Context(), appID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := make([]map[string]interface{}, len(templates))
+	for i, tmpl := range templates {
+		response[i] = downlinkTemplateResponse(tmpl)
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"templates": response,
+		"total":     len(response),
+	})
+}
+
+// HandleCreateDownlinkTemplate creates a downlink template for an application
+func (s *RESTServer) HandleCreateDownlinkTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	appID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid application id")
+		return
+	}
+
+	var req downlinkTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if _, err := s.store.GetApplication(ctx, appID); err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "application not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tmpl := &models.DownlinkTemplate{ApplicationID: appID}
+	if err := req.apply(s, tmpl); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.CreateDownlinkTemplate(ctx, tmpl); err != nil {
+		if err == storage.ErrDuplicateKey {
+			s.respondError(w, http.StatusConflict, "downlink template with this name already exists")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusCreated, downlinkTemplateResponse(tmpl))
+}
+
+// HandleGetDownlinkTemplate gets a downlink template by name
+func (s *RESTServer) HandleGetDownlinkTemplate(w http.ResponseWriter, r *http.Request) {
+	tmpl, ok := s.getDownlinkTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, downlinkTemplateResponse(tmpl))
+}
+
+// HandleUpdateDownlinkTemplate replaces a downlink template
+func (s *RESTServer) HandleUpdateDownlinkTemplate(w http.ResponseWriter, r *http.Request) {
+	var req downlinkTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	tmpl, ok := s.getDownlinkTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := req.apply(s, tmpl); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.UpdateDownlinkTemplate(r.Context(), tmpl); err != nil {
+		switch err {
+		case storage.ErrDuplicateKey:
+			s.respondError(w, http.StatusConflict, "downlink template with this name already exists")
+		case storage.ErrNotFound:
+			s.respondError(w, http.StatusNotFound, "downlink template not found")
+		default:
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, downlinkTemplateResponse(tmpl))
+}
+
+// HandleDeleteDownlinkTemplate deletes a downlink template
+func (s *RESTServer) HandleDeleteDownlinkTemplate(w http.ResponseWriter, r *http.Request) {
+	tmpl, ok := s.getDownlinkTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteDownlinkTemplate(r.Context(), tmpl.ID); err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "downlink template not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSendDownlinkTemplate queues a downlink to a device from one of its application's templates
+func (s *RESTServer) HandleSendDownlinkTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	// 请求体可省略
+	var req struct {
+		Reference string `json:"reference,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	tmpl, err := s.store.GetDownlinkTemplate(ctx, device.ApplicationID, name)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, fmt.Sprintf("application has no downlink template %q", name))
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.checkDownlinkPayloadSize(ctx, device, nil, len(tmpl.Data)); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	frame := &models.DownlinkFrame{
+		DevEUI:        device.DevEUI,
+		ApplicationID: device.ApplicationID,
+		FPort:         tmpl.FPort,
+		Data:          tmpl.Data,
+		Confirmed:     tmpl.Confirmed,
+		Reference:     req.Reference,
+	}
+	if err := s.queueDownlink(ctx, frame, models.Variables{"template": tmpl.Name}); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to queue downlink")
+		return
+	}
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"id":       frame.ID,
+		"template": tmpl.Name,
+		"message":  "Downlink queued successfully",
+		"status":   "pending",
+	})
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// seedTemplateApp stores an application with a "reboot" template and testDevEUI in it
+func seedTemplateApp(t *testing.T, store *storagetest.MemoryStore) *models.Application {
+	t.Helper()
+
+	ctx := context.Background()
+	app := &models.Application{Name: "app"}
+	if err := store.CreateApplication(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+	store.CreateDownlinkTemplate(ctx, &models.DownlinkTemplate{ApplicationID: app.ID, Name: "reboot", FPort: 10, Data: []byte{0xde, 0xad}, Confirmed: true})
+	store.CreateDevice(ctx, &models.Device{DevEUI: models.EUI64(testDevEUI), Name: "test", ApplicationID: app.ID})
+	return app
+}
+
+func TestCreateDownlinkTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		app  string // "" is the seeded application
+		body map[string]interface{}
+		want int
+	}{
+		{"created", "", map[string]interface{}{"name": "set interval 60s", "fPort": 2, "data": "013c"}, http.StatusCreated},
+		{"duplicate name", "", map[string]interface{}{"name": "reboot", "fPort": 2, "data": "01"}, http.StatusConflict},
+		{"name with slash", "", map[string]interface{}{"name": "a/b", "fPort": 2, "data": "01"}, http.StatusBadRequest},
+		{"missing name", "", map[string]interface{}{"fPort": 2, "data": "01"}, http.StatusBadRequest},
+		{"MAC command port", "", map[string]interface{}{"name": "mac", "fPort": 0, "data": "01"}, http.StatusBadRequest},
+		{"test protocol port", "", map[string]interface{}{"name": "test", "fPort": 224, "data": "01"}, http.StatusBadRequest},
+		{"invalid hex", "", map[string]interface{}{"name": "bad", "fPort": 2, "data": "zz"}, http.StatusBadRequest},
+		{"too large", "", map[string]interface{}{"name": "big", "fPort": 2, "data": string(bytes.Repeat([]byte("00"), 243))}, http.StatusBadRequest},
+		{"unknown application", uuid.NewString(), map[string]interface{}{"name": "reboot", "fPort": 2, "data": "01"}, http.StatusNotFound},
+		{"invalid application id", "nope", map[string]interface{}{"name": "reboot", "fPort": 2, "data": "01"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			app := seedTemplateApp(t, store)
+			appID := tt.app
+			if appID == "" {
+				appID = app.ID.String()
+			}
+
+			w := serve(s.HandleCreateDownlinkTemplate, newRequest(http.MethodPost, tt.body, map[string]string{"id": appID}))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			tmpl, err := store.GetDownlinkTemplate(context.Background(), app.ID, "set interval 60s")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tmpl.FPort != 2 || !bytes.Equal(tmpl.Data, []byte{0x01, 0x3c}) || tmpl.Confirmed {
+				t.Errorf("stored template = %+v", tmpl)
+			}
+		})
+	}
+}
+
+func TestDownlinkTemplateCRUD(t *testing.T) {
+	s, store := newTestServer(t)
+	app := seedTemplateApp(t, store)
+	params := func(name string) map[string]string {
+		return map[string]string{"id": app.ID.String(), "name": name}
+	}
+
+	w := serve(s.HandleGetDownlinkTemplate, newRequest(http.MethodGet, nil, params("reboot")))
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got["data"] != "dead" || got["fPort"] != float64(10) || got["confirmed"] != true {
+		t.Fatalf("get = %d %s", w.Code, w.Body)
+	}
+	if w := serve(s.HandleGetDownlinkTemplate, newRequest(http.MethodGet, nil, params("missing"))); w.Code != http.StatusNotFound {
+		t.Errorf("get missing = %d, want 404", w.Code)
+	}
+
+	update := map[string]interface{}{"name": "restart", "fPort": 11, "data": "beef"}
+	if w := serve(s.HandleUpdateDownlinkTemplate, newRequest(http.MethodPut, update, params("reboot"))); w.Code != http.StatusOK {
+		t.Fatalf("update = %d %s", w.Code, w.Body)
+	}
+	tmpl, err := store.GetDownlinkTemplate(context.Background(), app.ID, "restart")
+	if err != nil || tmpl.FPort != 11 || !bytes.Equal(tmpl.Data, []byte{0xbe, 0xef}) || tmpl.Confirmed {
+		t.Errorf("renamed template = %+v, %v", tmpl, err)
+	}
+
+	w = serve(s.HandleListDownlinkTemplates, newRequest(http.MethodGet, nil, map[string]string{"id": app.ID.String()}))
+	var list struct {
+		Templates []map[string]interface{} `json:"templates"`
+		Total     int                      `json:"total"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || list.Total != 1 || list.Templates[0]["name"] != "restart" {
+		t.Errorf("list = %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(s.HandleDeleteDownlinkTemplate, newRequest(http.MethodDelete, nil, params("restart"))); w.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", w.Code, w.Body)
+	}
+	if w := serve(s.HandleDeleteDownlinkTemplate, newRequest(http.MethodDelete, nil, params("restart"))); w.Code != http.StatusNotFound {
+		t.Errorf("delete again = %d, want 404", w.Code)
+	}
+}
+
+func TestSendDownlinkTemplate(t *testing.T) {
+	otherEUI := models.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x02}
+
+	tests := []struct {
+		name     string
+		devEUI   string
+		template string
+		want     int
+	}{
+		{"by name", testDevEUI.String(), "reboot", http.StatusAccepted},
+		{"unknown template", testDevEUI.String(), "shutdown", http.StatusNotFound},
+		// templates belong to the device's application
+		{"other application's device", otherEUI.String(), "reboot", http.StatusNotFound},
+		{"unknown device", "0807060504030201", "reboot", http.StatusNotFound},
+		{"invalid dev_eui", "nope", "reboot", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			seedTemplateApp(t, store)
+			other := &models.Application{Name: "other"}
+			store.CreateApplication(context.Background(), other)
+			store.CreateDevice(context.Background(), &models.Device{DevEUI: otherEUI, Name: "other", ApplicationID: other.ID})
+
+			r := newRequest(http.MethodPost, map[string]interface{}{"reference": "ticket-42"}, map[string]string{"dev_eui": tt.devEUI, "name": tt.template})
+			w := serve(s.HandleSendDownlinkTemplate, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			frames := store.DownlinkFrames()
+			if tt.want != http.StatusAccepted {
+				if len(frames) != 0 {
+					t.Errorf("%d downlinks queued after status %d", len(frames), w.Code)
+				}
+				return
+			}
+			if len(frames) != 1 {
+				t.Fatalf("%d downlinks queued, want 1", len(frames))
+			}
+			f := frames[0]
+			if f.DevEUI != models.EUI64(testDevEUI) || f.FPort != 10 || !bytes.Equal(f.Data, []byte{0xde, 0xad}) || !f.Confirmed || f.Reference != "ticket-42" || !f.IsPending {
+				t.Errorf("queued frame = %+v", f)
+			}
+		})
+	}
+}
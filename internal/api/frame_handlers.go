@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/auth"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+// HandleReplayUplinkFrame re-publishes a stored uplink to the application
+// integrations (HTTP/MQTT) without going through the network server
+func (s *RESTServer) HandleReplayUplinkFrame(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	frameID, err := uuid.Parse(chi.URLParam(r, "frame_id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid frame_id")
+		return
+	}
+
+	nc := s.nc.Load()
+	if nc == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "replay requires a NATS connection")
+		return
+	}
+
+	frame, err := s.store.GetUplinkFrame(ctx, frameID)
+	if err == storage.ErrNotFound || (err == nil && frame.DevEUI != models.EUI64(devEUI)) {
+		s.respondError(w, http.StatusNotFound, "frame not found")
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 与 Network Server 发布的上行消息格式一致
+	msg := map[string]interface{}{
+		"applicationID": frame.ApplicationID.String(),
+		"devEUI":        frame.DevEUI.String(),
+		"devAddr":       frame.DevAddr.String(),
+		"fCnt":          frame.FCnt,
+		"fPort":         frame.FPort,
+		"data":          frame.Data,
+		"phyPayload":    frame.PHYPayload,
+		"rxInfo":        frame.RXInfo,
+		"adr":           frame.ADR,
+		"replay":        true,
+		"frameID":       frame.ID.String(),
+		"receivedAt":    frame.ReceivedAt,
+	}
+	data, _ := json.Marshal(msg)
+
+	subject := fmt.Sprintf("application.%s.device.%s.replay", frame.ApplicationID, frame.DevEUI)
+	if err := nc.Publish(subject, data); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to publish replay")
+		return
+	}
+
+	details := models.Variables{
+		"frameId": frame.ID.String(),
+		"fCnt":    frame.FCnt,
+	}
+	if claims, ok := ctx.Value("claims").(*auth.Claims); ok {
+		details["userId"] = claims.UserID.String()
+		details["email"] = claims.Email
+	}
+	event := &models.EventLog{
+		ApplicationID: &frame.ApplicationID,
+		DevEUI:        &frame.DevEUI,
+		Type:          models.EventTypeAPICall,
+		Level:         models.EventLevelInfo,
+		Code:          "UPLINK_REPLAYED",
+		Description:   fmt.Sprintf("Uplink frame %s replayed to integrations", frame.ID),
+		Details:       details,
+	}
+	if err := s.store.CreateEventLog(ctx, event); err != nil {
+		log.Error().Err(err).Str("devEUI", frame.DevEUI.String()).Msg("记录上行重放审计日志失败")
+	}
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"frame_id": frame.ID,
+		"subject":  subject,
+	})
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/integration"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// saveTestUplinkFrame stores an uplink of a new application for the replay tests
+func saveTestUplinkFrame(t *testing.T, store *storagetest.MemoryStore, app *models.Application) *models.UplinkFrame {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := store.CreateApplication(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+	fPort := uint8(10)
+	frame := &models.UplinkFrame{
+		DevEUI:        models.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		DevAddr:       models.DevAddr{0x26, 0x01, 0x02, 0x03},
+		ApplicationID: app.ID,
+		FCnt:          42,
+		FPort:         &fPort,
+		Data:          []byte{0x01, 0x67, 0x00, 0xfa},
+		RXInfo:        []map[string]interface{}{{"gatewayID": "0102030405060708", "rssi": -60}},
+	}
+	if err := store.CreateUplinkFrame(ctx, frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestReplayUplinkFrame(t *testing.T) {
+	srv := natstest.Run(t)
+	s, store := newTestServer(t)
+	frame := saveTestUplinkFrame(t, store, &models.Application{Name: "replay"})
+
+	tests := []struct {
+		name    string
+		devEUI  string
+		frameID string
+		noNATS  bool
+		want    int
+	}{
+		{"replayed", frame.DevEUI.String(), frame.ID.String(), false, http.StatusAccepted},
+		{"other device", "0807060504030201", frame.ID.String(), false, http.StatusNotFound},
+		{"unknown frame", frame.DevEUI.String(), uuid.NewString(), false, http.StatusNotFound},
+		{"invalid frame id", frame.DevEUI.String(), "nope", false, http.StatusBadRequest},
+		{"invalid dev_eui", "nope", frame.ID.String(), false, http.StatusBadRequest},
+		{"no NATS", frame.DevEUI.String(), frame.ID.String(), true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.noNATS {
+				s.SetNATS(nil)
+			} else {
+				s.SetNATS(srv.Conn(t))
+			}
+			nc := srv.Conn(t)
+			sub, err := nc.SubscribeSync("application.*.device.*.replay")
+			if err != nil {
+				t.Fatal(err)
+			}
+			nc.Flush()
+
+			r := newRequest(http.MethodPost, nil, map[string]string{"dev_eui": tt.devEUI, "frame_id": tt.frameID})
+			w := serve(s.HandleReplayUplinkFrame, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			msg, err := sub.NextMsg(200 * time.Millisecond)
+			if tt.want != http.StatusAccepted {
+				if err == nil {
+					t.Errorf("published %s on a failed replay", msg.Subject)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("replay not published")
+			}
+
+			wantSubject := "application." + frame.ApplicationID.String() + ".device." + frame.DevEUI.String() + ".replay"
+			if msg.Subject != wantSubject {
+				t.Errorf("subject = %q, want %q", msg.Subject, wantSubject)
+			}
+			var up integration.UplinkData
+			if err := json.Unmarshal(msg.Data, &up); err != nil {
+				t.Fatal(err)
+			}
+			if !up.Replay || up.FCnt != frame.FCnt || !bytes.Equal(up.Data, frame.Data) || up.FPort == nil || *up.FPort != 10 {
+				t.Errorf("replayed uplink = %+v", up)
+			}
+			if len(up.RxInfo) != 1 || up.RxInfo[0]["gatewayID"] != "0102030405060708" {
+				t.Errorf("rxInfo = %v", up.RxInfo)
+			}
+
+			events, _, _ := store.ListEventLogs(context.Background(), storage.EventLogFilters{}, 10, 0)
+			if len(events) == 0 || events[0].Code != "UPLINK_REPLAYED" {
+				t.Errorf("no UPLINK_REPLAYED event logged")
+			}
+		})
+	}
+}
+
+func TestReplayUplinkFrameAdminOnly(t *testing.T) {
+	s, store := newTestServer(t)
+	frame := saveTestUplinkFrame(t, store, &models.Application{Name: "replay"})
+
+	tests := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{"anonymous", nil, http.StatusForbidden},
+		{"user", &models.User{ID: uuid.New()}, http.StatusForbidden},
+		{"admin", &models.User{ID: uuid.New(), IsAdmin: true}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(http.MethodPost, nil, map[string]string{"dev_eui": frame.DevEUI.String(), "frame_id": frame.ID.String()})
+			if tt.user != nil {
+				r = withUser(r, tt.user, nil)
+			}
+			w := httptest.NewRecorder()
+			s.adminMiddleware(http.HandlerFunc(s.HandleReplayUplinkFrame)).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayUplinkFrameForwardedToHTTP(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var data map[string]interface{}
+		json.Unmarshal(body, &data)
+		received <- data
+	}))
+	defer sink.Close()
+
+	srv := natstest.Run(t)
+	s, store := newTestServer(t)
+	s.SetNATS(srv.Conn(t))
+	frame := saveTestUplinkFrame(t, store, &models.Application{
+		Name:            "replay",
+		HTTPIntegration: &models.Variables{"enabled": true, "endpoint": sink.URL},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	forwarder := integration.NewForwarderService(srv.Conn(t), store)
+	go forwarder.Start(ctx)
+	time.Sleep(50 * time.Millisecond) // let the forwarder subscribe
+
+	r := newRequest(http.MethodPost, nil, map[string]string{"dev_eui": frame.DevEUI.String(), "frame_id": frame.ID.String()})
+	if w := serve(s.HandleReplayUplinkFrame, r); w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	select {
+	case data := <-received:
+		if data["devEUI"] != frame.DevEUI.String() || data["fCnt"] != float64(frame.FCnt) || data["data"] != "AWcA+g==" {
+			t.Errorf("forwarded %v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("replayed uplink not forwarded to the HTTP integration")
+	}
+}
@@ -2,22 +2,29 @@ package api
 
 import (
     "encoding/json"
+    "fmt"
+    "io"
     "net/http"
     "strconv"
+    "strings"
+    "time"
 
     "github.com/go-chi/chi/v5"
     "github.com/google/uuid"
 
     "github.com/lorawan-server/lorawan-server-pro/internal/models"
     "github.com/lorawan-server/lorawan-server-pro/internal/storage"
+    "github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
 
 // HandleListGateways lists gateways
 func (s *RESTServer) HandleListGateways(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
 
-    // TODO: Get from auth context
-    tenantID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+    tenantID, ok := s.requestTenantID(w, r)
+    if !ok {
+        return
+    }
 
     limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
     if limit == 0 {
@@ -25,27 +32,115 @@ func (s *RESTServer) HandleListGateways(w http.ResponseWriter, r *http.Request)
     }
     offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-    gateways, total, err := s.store.ListGateways(ctx, tenantID, limit, offset)
+    onlineSince := time.Now().Add(-s.config.Gateway.OfflineAfter())
+
+    filters, err := parseGatewayFilters(r)
+    if err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    filters.OnlineSince = onlineSince
+
+    gateways, total, err := s.store.ListGateways(ctx, tenantID, filters, limit, offset)
     if err != nil {
         s.respondError(w, http.StatusInternalServerError, err.Error())
         return
     }
 
+    items := make([]gatewayWithStatus, 0, len(gateways))
+    for _, gw := range gateways {
+        items = append(items, gatewayWithStatus{Gateway: gw, Status: gatewayStatus(gw, onlineSince)})
+    }
+
     s.respondJSON(w, http.StatusOK, map[string]interface{}{
-        "gateways": gateways,
+        "gateways": items,
         "total":    total,
     })
 }
 
+// Gateway status values
+const (
+    gatewayStatusOnline  = "online"
+    gatewayStatusOffline = "offline"
+)
+
+// gatewayWithStatus is a listed gateway with its online status
+type gatewayWithStatus struct {
+    *models.Gateway
+    Status string `json:"status"`
+}
+
+// gatewayStatus is online when the gateway was last seen after onlineSince
+func gatewayStatus(gw *models.Gateway, onlineSince time.Time) string {
+    if gw.LastSeenAt != nil && gw.LastSeenAt.After(onlineSince) {
+        return gatewayStatusOnline
+    }
+    return gatewayStatusOffline
+}
+
+// parseGatewayFilters reads status, last_seen_after, last_seen_before, sort and order
+func parseGatewayFilters(r *http.Request) (storage.GatewayFilters, error) {
+    q := r.URL.Query()
+    var filters storage.GatewayFilters
+
+    switch status := q.Get("status"); status {
+    case "":
+    case gatewayStatusOnline, gatewayStatusOffline:
+        online := status == gatewayStatusOnline
+        filters.Online = &online
+    default:
+        return filters, fmt.Errorf("status must be online or offline")
+    }
+
+    for _, p := range []struct {
+        name string
+        dst  **time.Time
+    }{
+        {"last_seen_after", &filters.LastSeenAfter},
+        {"last_seen_before", &filters.LastSeenBefore},
+    } {
+        if v := q.Get(p.name); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                return filters, fmt.Errorf("%s must be an RFC3339 timestamp", p.name)
+            }
+            *p.dst = &t
+        }
+    }
+
+    switch sortBy := q.Get("sort"); sortBy {
+    case "", storage.GatewaySortCreatedAt:
+        filters.SortBy = storage.GatewaySortCreatedAt
+    case storage.GatewaySortLastSeen, storage.GatewaySortName:
+        filters.SortBy = sortBy
+    default:
+        return filters, fmt.Errorf("sort must be created_at, last_seen or name")
+    }
+
+    // 默认按时间倒序、按名称正序
+    switch order := q.Get("order"); order {
+    case "":
+        filters.Desc = filters.SortBy != storage.GatewaySortName
+    case "asc", "desc":
+        filters.Desc = order == "desc"
+    default:
+        return filters, fmt.Errorf("order must be asc or desc")
+    }
+
+    return filters, nil
+}
+
 // HandleCreateGateway creates a gateway
 func (s *RESTServer) HandleCreateGateway(w http.ResponseWriter, r *http.Request) {
     var req struct {
-        GatewayID   string  `json:"gateway_id" validate:"required,len=16"`
+        GatewayID   string  `json:"gateway_id" validate:"required"`
         Name        string  `json:"name" validate:"required"`
         Description string  `json:"description"`
         Latitude    float64 `json:"latitude"`
         Longitude   float64 `json:"longitude"`
         Altitude    float64 `json:"altitude"`
+        Labels      map[string]string `json:"labels"`
+        Radios      models.GatewayRadios `json:"radios"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -58,14 +153,21 @@ func (s *RESTServer) HandleCreateGateway(w http.ResponseWriter, r *http.Request)
         return
     }
 
-    gatewayID, err := parseEUI64(req.GatewayID)
+    if err := validateGatewayRadios(req.Radios); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    gatewayID, err := lorawan.ParseGatewayID(req.GatewayID)
     if err != nil {
         s.respondError(w, http.StatusBadRequest, "invalid gateway_id")
         return
     }
 
-    // TODO: Get from auth context
-    tenantID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+    tenantID, ok := s.requestTenantID(w, r)
+    if !ok {
+        return
+    }
 
     gateway := &models.Gateway{
         GatewayID: models.EUI64(gatewayID),
@@ -74,6 +176,8 @@ func (s *RESTServer) HandleCreateGateway(w http.ResponseWriter, r *http.Request)
         },
         Name:        req.Name,
         Description: req.Description,
+        Labels:      gatewayLabels(req.Labels),
+        Radios:      req.Radios,
     }
 
     // Handle location
@@ -102,7 +206,7 @@ func (s *RESTServer) HandleGetGateway(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
 
     gatewayIDStr := chi.URLParam(r, "gateway_id")
-    gatewayID, err := parseEUI64(gatewayIDStr)
+    gatewayID, err := lorawan.ParseGatewayID(gatewayIDStr)
     if err != nil {
         s.respondError(w, http.StatusBadRequest, "invalid gateway_id")
         return
@@ -126,7 +230,7 @@ func (s *RESTServer) HandleUpdateGateway(w http.ResponseWriter, r *http.Request)
     ctx := r.Context()
 
     gatewayIDStr := chi.URLParam(r, "gateway_id")
-    gatewayID, err := parseEUI64(gatewayIDStr)
+    gatewayID, err := lorawan.ParseGatewayID(gatewayIDStr)
     if err != nil {
         s.respondError(w, http.StatusBadRequest, "invalid gateway_id")
         return
@@ -138,6 +242,8 @@ func (s *RESTServer) HandleUpdateGateway(w http.ResponseWriter, r *http.Request)
         Latitude    float64 `json:"latitude"`
         Longitude   float64 `json:"longitude"`
         Altitude    float64 `json:"altitude"`
+        Labels      map[string]string `json:"labels"`
+        Radios      models.GatewayRadios `json:"radios"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -150,6 +256,11 @@ func (s *RESTServer) HandleUpdateGateway(w http.ResponseWriter, r *http.Request)
         return
     }
 
+    if err := validateGatewayRadios(req.Radios); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
     gateway, err := s.store.GetGateway(ctx, gatewayID)
     if err != nil {
         if err == storage.ErrNotFound {
@@ -162,6 +273,12 @@ func (s *RESTServer) HandleUpdateGateway(w http.ResponseWriter, r *http.Request)
 
     gateway.Name = req.Name
     gateway.Description = req.Description
+    if req.Labels != nil {
+        gateway.Labels = gatewayLabels(req.Labels)
+    }
+    if req.Radios != nil {
+        gateway.Radios = req.Radios
+    }
 
     // Update location
     if req.Latitude != 0 || req.Longitude != 0 || req.Altitude != 0 {
@@ -185,7 +302,7 @@ func (s *RESTServer) HandleDeleteGateway(w http.ResponseWriter, r *http.Request)
     ctx := r.Context()
 
     gatewayIDStr := chi.URLParam(r, "gateway_id")
-    gatewayID, err := parseEUI64(gatewayIDStr)
+    gatewayID, err := lorawan.ParseGatewayID(gatewayIDStr)
     if err != nil {
         s.respondError(w, http.StatusBadRequest, "invalid gateway_id")
         return
@@ -203,60 +320,336 @@ func (s *RESTServer) HandleDeleteGateway(w http.ResponseWriter, r *http.Request)
     w.WriteHeader(http.StatusNoContent)
 }
 
-// HandleListDeviceProfiles lists device profiles
-func (s *RESTServer) HandleListDeviceProfiles(w http.ResponseWriter, r *http.Request) {
-    // TODO: Implement device profiles list
+// Gateway stats series limits
+const (
+    defaultGatewayStatsPeriod   = 24 * time.Hour
+    maxGatewayStatsPeriod       = 7 * 24 * time.Hour
+    defaultGatewayStatsInterval = time.Hour
+    minGatewayStatsInterval     = time.Minute
+)
+
+// HandleGetGatewayStats returns the gateway's rx/tx counters summed per interval over the
+// last period (query "period", default 24h, max 7 days; "interval", default 1h, min 1m)
+func (s *RESTServer) HandleGetGatewayStats(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+
+    gatewayIDStr := chi.URLParam(r, "gateway_id")
+    gatewayID, err := lorawan.ParseGatewayID(gatewayIDStr)
+    if err != nil {
+        s.respondError(w, http.StatusBadRequest, "invalid gateway_id")
+        return
+    }
+
+    period := defaultGatewayStatsPeriod
+    if v := r.URL.Query().Get("period"); v != "" {
+        if period, err = time.ParseDuration(v); err != nil || period <= 0 || period > maxGatewayStatsPeriod {
+            s.respondError(w, http.StatusBadRequest, "period must be a duration between 0 and 168h")
+            return
+        }
+    }
+    interval := defaultGatewayStatsInterval
+    if v := r.URL.Query().Get("interval"); v != "" {
+        if interval, err = time.ParseDuration(v); err != nil || interval < minGatewayStatsInterval || interval > period {
+            s.respondError(w, http.StatusBadRequest, "interval must be a duration between 1m and period")
+            return
+        }
+    }
+
+    to := time.Now()
+    from := to.Add(-period)
+    series, err := s.store.GetGatewayStats(ctx, gatewayID, from, to, interval)
+    if err != nil {
+        s.respondError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+
     s.respondJSON(w, http.StatusOK, map[string]interface{}{
-        "profiles": []map[string]interface{}{
-            {
-                "id":          "44444444-4444-4444-4444-444444444444",
-                "name":        "Default Profile",
-                "description": "Default device profile for Class A devices",
-            },
-        },
-        "total": 1,
+        "gatewayId": gatewayID.String(),
+        "from":      from,
+        "to":        to,
+        "interval":  interval.String(),
+        "stats":     series,
     })
 }
 
-// HandleCreateDeviceProfile creates device profile
-func (s *RESTServer) HandleCreateDeviceProfile(w http.ResponseWriter, r *http.Request) {
-    s.respondJSON(w, http.StatusCreated, map[string]string{
-        "message": "create device profile not implemented",
+// gatewayLabels converts API labels to the stored form
+func gatewayLabels(labels map[string]string) models.Variables {
+    if labels == nil {
+        return nil
+    }
+    v := make(models.Variables, len(labels))
+    for key, value := range labels {
+        v[key] = value
+    }
+    return v
+}
+
+// maxGatewayRFChains bounds the rfch of a radio (two per SX1301/SX1302 concentrator)
+const maxGatewayRFChains = 8
+
+// validateGatewayRadios checks rfch values and frequency ranges of a radio configuration
+func validateGatewayRadios(radios models.GatewayRadios) error {
+    for i, radio := range radios {
+        if radio.RFCh >= maxGatewayRFChains {
+            return fmt.Errorf("radios[%d]: rfch must be between 0 and %d", i, maxGatewayRFChains-1)
+        }
+        if radio.MinFrequency == 0 || radio.MaxFrequency < radio.MinFrequency {
+            return fmt.Errorf("radios[%d]: minFrequency must be set and not above maxFrequency", i)
+        }
+    }
+    return nil
+}
+
+// HandleListDeviceProfiles lists the tenant's device profiles. Administrators
+// see all profiles unless they filter with ?tenant_id=
+func (s *RESTServer) HandleListDeviceProfiles(w http.ResponseWriter, r *http.Request) {
+    limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+    if limit == 0 {
+        limit = 20
+    }
+    offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+    
+    var tenantID *uuid.UUID
+    if user := userFromContext(r); user == nil || !user.IsAdmin || r.URL.Query().Get("tenant_id") != "" {
+        id, ok := s.requestTenantID(w, r)
+        if !ok {
+            return
+        }
+        tenantID = &id
+    }
+    
+    profiles, total, err := s.store.ListDeviceProfiles(r.Context(), tenantID, limit, offset)
+    if err != nil {
+        s.respondError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    
+    s.respondJSON(w, http.StatusOK, map[string]interface{}{
+        "profiles": profiles,
+        "total":    total,
+        "limit":    limit,
+        "offset":   offset,
     })
 }
 
-// HandleGetDeviceProfile gets device profile
-func (s *RESTServer) HandleGetDeviceProfile(w http.ResponseWriter, r *http.Request) {
+// validateDeviceProfile checks the fields shared by create and update
+func validateDeviceProfile(p *models.DeviceProfile) error {
+    if p.Name == "" {
+        return fmt.Errorf("name is required")
+    }
+    
+    if !isSupportedRegion(p.RFRegion) {
+        return fmt.Errorf("unsupported region: %s", p.RFRegion)
+    }
+    
+    if !p.ADRMode.Valid() {
+        return fmt.Errorf("adrMode must be one of on, off, auto")
+    }
+    
+    if !p.DeviceClass.Valid() {
+        return fmt.Errorf("deviceClass must be one of A, B, C")
+    }
+    
+    if p.MaxDownlinkDR != nil && (*p.MaxDownlinkDR < 0 || *p.MaxDownlinkDR > 15) {
+        return fmt.Errorf("maxDownlinkDR must be between 0 and 15")
+    }
+    
+    if p.MaxUplinkRate < 0 {
+        return fmt.Errorf("maxUplinkRate must not be negative")
+    }
+    
+    if p.MaxNbTrans < 0 || p.MaxNbTrans > 15 {
+        return fmt.Errorf("maxNbTrans must be between 0 and 15")
+    }
+    
+    if p.MaxDownlinkQueueAge < 0 {
+        return fmt.Errorf("maxDownlinkQueueAge must not be negative")
+    }
+    
+    if p.DownlinkCodeRate != "" && !lorawan.ValidCodeRate(p.DownlinkCodeRate) {
+        return fmt.Errorf("downlinkCodeRate must be one of 4/5, 4/6, 4/7, 4/8")
+    }
+    
+    for _, dr := range p.SupportedDataRates {
+        if dr < 0 || dr > 15 {
+            return fmt.Errorf("supportedDataRates must be between 0 and 15")
+        }
+    }
+    
+    if p.RX1Delay < 0 || p.RX1Delay > 15 {
+        return fmt.Errorf("rx1Delay must be between 0 and 15")
+    }
+    
+    if p.RX2DR != nil {
+        region := lorawan.GetRegionConfiguration(strings.ToUpper(p.RFRegion))
+        if _, ok := region.DataRateString(*p.RX2DR); !ok {
+            return fmt.Errorf("rx2DR %d is not valid for region %s", *p.RX2DR, region.Name)
+        }
+    }
+    
+    if p.RX2Frequency < 0 {
+        return fmt.Errorf("rx2Frequency must not be negative")
+    }
+    
+    switch p.JoinAcceptRX2 {
+    case "", "auto", "always", "off":
+    default:
+        return fmt.Errorf("joinAcceptRX2 must be one of auto, always, off")
+    }
+    
+    return nil
+}
+
+// HandleCreateDeviceProfile creates device profile, optionally starting from
+// a factory preset (?preset=<id>) with the request body as overrides
+func (s *RESTServer) HandleCreateDeviceProfile(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
+    
+    var req models.DeviceProfile
+    presetID := r.URL.Query().Get("preset")
+    if presetID != "" {
+        preset, ok := findDeviceProfilePreset(presetID)
+        if !ok {
+            s.respondError(w, http.StatusNotFound, "device profile preset not found")
+            return
+        }
+        req = preset.Profile
+    }
+    
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !(presetID != "" && err == io.EOF) {
+        s.respondError(w, http.StatusBadRequest, "invalid request body")
+        return
+    }
+    
+    if err := validateDeviceProfile(&req); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    
+    // Only administrators may create a profile for another tenant
+    if user := userFromContext(r); req.TenantID == nil || user == nil || !user.IsAdmin {
+        tenantID, ok := s.requestTenantID(w, r)
+        if !ok {
+            return
+        }
+        req.TenantID = &tenantID
+    }
+    
+    if status, err := s.checkTenantRegion(ctx, *req.TenantID, req.RFRegion); err != nil {
+        s.respondError(w, status, err.Error())
+        return
+    }
+    
+    req.ID = uuid.Nil
+    if err := s.store.CreateDeviceProfile(ctx, &req); err != nil {
+        if err == storage.ErrDuplicateKey {
+            s.respondError(w, http.StatusConflict, "device profile already exists")
+            return
+        }
+        s.respondError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    
+    s.respondJSON(w, http.StatusCreated, req)
+}
 
+// getDeviceProfile loads the device profile named by the {id} URL parameter,
+// writing the error response when it cannot
+func (s *RESTServer) getDeviceProfile(w http.ResponseWriter, r *http.Request) (*models.DeviceProfile, bool) {
     id, err := uuid.Parse(chi.URLParam(r, "id"))
     if err != nil {
         s.respondError(w, http.StatusBadRequest, "invalid profile id")
-        return
+        return nil, false
     }
 
-    profile, err := s.store.GetDeviceProfile(ctx, id)
+    profile, err := s.store.GetDeviceProfile(r.Context(), id)
     if err != nil {
         if err == storage.ErrNotFound {
             s.respondError(w, http.StatusNotFound, "device profile not found")
-            return
+            return nil, false
         }
         s.respondError(w, http.StatusInternalServerError, err.Error())
+        return nil, false
+    }
+    // Shared profiles have no tenant; profiles of other tenants respond as not found
+    if profile.TenantID != nil && !canAccessTenant(r, *profile.TenantID) {
+        s.respondError(w, http.StatusNotFound, "device profile not found")
+        return nil, false
+    }
+
+    return profile, true
+}
+
+// HandleGetDeviceProfile gets device profile
+func (s *RESTServer) HandleGetDeviceProfile(w http.ResponseWriter, r *http.Request) {
+    profile, ok := s.getDeviceProfile(w, r)
+    if !ok {
         return
     }
 
     s.respondJSON(w, http.StatusOK, profile)
 }
 
-// HandleUpdateDeviceProfile updates device profile
+// HandleUpdateDeviceProfile updates device profile. Fields missing from the
+// body keep their current values; the tenant cannot be changed.
 func (s *RESTServer) HandleUpdateDeviceProfile(w http.ResponseWriter, r *http.Request) {
-    s.respondJSON(w, http.StatusOK, map[string]string{
-        "message": "update device profile not implemented",
-    })
+    ctx := r.Context()
+
+    profile, ok := s.getDeviceProfile(w, r)
+    if !ok {
+        return
+    }
+
+    req := *profile
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.respondError(w, http.StatusBadRequest, "invalid request body")
+        return
+    }
+    req.ID, req.TenantID, req.CreatedAt = profile.ID, profile.TenantID, profile.CreatedAt
+
+    if err := validateDeviceProfile(&req); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if req.TenantID != nil && !strings.EqualFold(req.RFRegion, profile.RFRegion) {
+        if status, err := s.checkTenantRegion(ctx, *req.TenantID, req.RFRegion); err != nil {
+            s.respondError(w, status, err.Error())
+            return
+        }
+    }
+
+    if err := s.store.UpdateDeviceProfile(ctx, &req); err != nil {
+        if err == storage.ErrNotFound {
+            s.respondError(w, http.StatusNotFound, "device profile not found")
+            return
+        }
+        s.respondError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+
+    s.respondJSON(w, http.StatusOK, req)
 }
 
-// HandleDeleteDeviceProfile deletes device profile
+// HandleDeleteDeviceProfile deletes device profile that no device uses
 func (s *RESTServer) HandleDeleteDeviceProfile(w http.ResponseWriter, r *http.Request) {
+    profile, ok := s.getDeviceProfile(w, r)
+    if !ok {
+        return
+    }
+
+    if err := s.store.DeleteDeviceProfile(r.Context(), profile.ID); err != nil {
+        switch err {
+        case storage.ErrNotFound:
+            s.respondError(w, http.StatusNotFound, "device profile not found")
+        case storage.ErrInvalidData:
+            s.respondError(w, http.StatusConflict, "device profile is still used by devices")
+        default:
+            s.respondError(w, http.StatusInternalServerError, err.Error())
+        }
+        return
+    }
+
     w.WriteHeader(http.StatusNoContent)
 }
 
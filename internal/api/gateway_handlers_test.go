@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestValidateDeviceProfile(t *testing.T) {
+	valid := func() *models.DeviceProfile {
+		return &models.DeviceProfile{Name: "profile", RFRegion: "CN470"}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(p *models.DeviceProfile)
+		wantErr bool
+	}{
+		{"valid", func(p *models.DeviceProfile) {}, false},
+		{"adr mode unset", func(p *models.DeviceProfile) { p.ADRMode = "" }, false},
+		{"adr mode off", func(p *models.DeviceProfile) { p.ADRMode = models.ADRModeOff }, false},
+		{"adr mode on", func(p *models.DeviceProfile) { p.ADRMode = models.ADRModeOn }, false},
+		{"adr mode unknown", func(p *models.DeviceProfile) { p.ADRMode = "sometimes" }, true},
+		{"downlink code rate", func(p *models.DeviceProfile) { p.DownlinkCodeRate = "4/8" }, false},
+		{"downlink code rate invalid", func(p *models.DeviceProfile) { p.DownlinkCodeRate = "4/9" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.modify(p)
+			if err := validateDeviceProfile(p); (err != nil) != tt.wantErr {
+				t.Errorf("validateDeviceProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateGatewayRadios(t *testing.T) {
+	tests := []struct {
+		name    string
+		radios  models.GatewayRadios
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"two chains", models.GatewayRadios{{RFCh: 0, MinFrequency: 470000000, MaxFrequency: 479900000}, {RFCh: 1, MinFrequency: 480000000, MaxFrequency: 489900000}}, false},
+		{"single frequency", models.GatewayRadios{{RFCh: 0, MinFrequency: 500300000, MaxFrequency: 500300000}}, false},
+		{"last rfch", models.GatewayRadios{{RFCh: maxGatewayRFChains - 1, MinFrequency: 470000000, MaxFrequency: 510000000}}, false},
+		{"rfch too large", models.GatewayRadios{{RFCh: maxGatewayRFChains, MinFrequency: 470000000, MaxFrequency: 510000000}}, true},
+		{"missing min frequency", models.GatewayRadios{{RFCh: 0, MaxFrequency: 510000000}}, true},
+		{"inverted range", models.GatewayRadios{{RFCh: 0, MinFrequency: 510000000, MaxFrequency: 470000000}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateGatewayRadios(tt.radios); (err != nil) != tt.wantErr {
+				t.Errorf("validateGatewayRadios() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleListGatewaysFilters(t *testing.T) {
+	s, store := newTestServer(t)
+	tenant := &models.Tenant{}
+	tenant.ID = uuid.New()
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	for i, gw := range []struct {
+		name     string
+		lastSeen *time.Time
+	}{
+		{"alpha", ago(time.Minute)},
+		{"charlie", ago(time.Hour)},
+		{"bravo", nil},
+	} {
+		gateway := &models.Gateway{GatewayID: models.EUI64{byte(i + 1)}, Name: gw.name, LastSeenAt: gw.lastSeen}
+		gateway.TenantID = tenant.ID
+		gateway.CreatedAt = now.Add(time.Duration(i-10) * time.Hour)
+		if err := store.CreateGateway(context.Background(), gateway); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Another tenant's gateway is never listed
+	other := &models.Gateway{GatewayID: models.EUI64{0xff}, Name: "other", LastSeenAt: ago(time.Minute)}
+	other.TenantID = uuid.New()
+	store.CreateGateway(context.Background(), other)
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantNames  []string
+	}{
+		{"default newest first", url.Values{}, http.StatusOK, []string{"bravo", "charlie", "alpha"}},
+		{"online", url.Values{"status": {"online"}}, http.StatusOK, []string{"alpha"}},
+		{"offline by name", url.Values{"status": {"offline"}, "sort": {"name"}}, http.StatusOK, []string{"bravo", "charlie"}},
+		{"name descending", url.Values{"sort": {"name"}, "order": {"desc"}}, http.StatusOK, []string{"charlie", "bravo", "alpha"}},
+		{"last seen", url.Values{"sort": {"last_seen"}}, http.StatusOK, []string{"alpha", "charlie", "bravo"}},
+		{"last seen ascending, never seen last", url.Values{"sort": {"last_seen"}, "order": {"asc"}}, http.StatusOK, []string{"charlie", "alpha", "bravo"}},
+		{"last seen after", url.Values{"last_seen_after": {ago(30 * time.Minute).Format(time.RFC3339)}}, http.StatusOK, []string{"alpha"}},
+		{"last seen before", url.Values{"last_seen_before": {ago(30 * time.Minute).Format(time.RFC3339)}}, http.StatusOK, []string{"charlie"}},
+		{"invalid status", url.Values{"status": {"asleep"}}, http.StatusBadRequest, nil},
+		{"invalid sort", url.Values{"sort": {"rssi"}}, http.StatusBadRequest, nil},
+		{"invalid order", url.Values{"order": {"up"}}, http.StatusBadRequest, nil},
+		{"invalid time", url.Values{"last_seen_after": {"yesterday"}}, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withUser(newRequest(http.MethodGet, nil, nil), &models.User{}, tenant)
+			r.URL.RawQuery = tt.query.Encode()
+			w := serve(s.HandleListGateways, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Gateways []struct {
+					Name   string `json:"name"`
+					Status string `json:"status"`
+				} `json:"gateways"`
+				Total int `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, gw := range resp.Gateways {
+				names = append(names, gw.Name)
+				wantStatus := "offline"
+				if gw.Name == "alpha" {
+					wantStatus = "online"
+				}
+				if gw.Status != wantStatus {
+					t.Errorf("%s status = %q, want %q", gw.Name, gw.Status, wantStatus)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) || resp.Total != len(tt.wantNames) {
+				t.Errorf("gateways = %v (total %d), want %v", names, resp.Total, tt.wantNames)
+			}
+		})
+	}
+}
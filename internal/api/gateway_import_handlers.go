@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// maxGatewayImportRows limits the number of gateways in one import request
+const maxGatewayImportRows = 1000
+
+// gatewayImportColumns are the CSV columns of a gateway import, in order
+var gatewayImportColumns = []string{"gateway_id", "name", "description", "latitude", "longitude", "altitude", "region", "labels"}
+
+// gatewayImportRecord is one gateway in an import request
+type gatewayImportRecord struct {
+	GatewayID   string            `json:"gateway_id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Latitude    float64           `json:"latitude"`
+	Longitude   float64           `json:"longitude"`
+	Altitude    float64           `json:"altitude"`
+	Region      string            `json:"region"`
+	Labels      map[string]string `json:"labels"`
+
+	parseErr error // CSV 字段无法解析
+}
+
+// gatewayImportResult reports the outcome of one import row
+type gatewayImportResult struct {
+	Row       int    `json:"row"`
+	GatewayID string `json:"gatewayId,omitempty"`
+	Created   bool   `json:"created"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HandleImportGateways creates gateways in bulk from a CSV or JSON body.
+// Rows are validated first and created in one transaction: if any row fails
+// nothing is created and the per-row report says why.
+func (s *RESTServer) HandleImportGateways(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	records, err := parseGatewayImport(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(records) == 0 {
+		s.respondError(w, http.StatusBadRequest, "no gateways to import")
+		return
+	}
+	if len(records) > maxGatewayImportRows {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("at most %d gateways per import", maxGatewayImportRows))
+		return
+	}
+
+	tenantID, ok := s.requestTenantID(w, r)
+	if !ok {
+		return
+	}
+
+	tenant, err := s.store.GetTenant(ctx, tenantID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusBadRequest, "tenant not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]gatewayImportResult, len(records))
+	gateways := make([]*models.Gateway, len(records))
+	seen := make(map[lorawan.EUI64]int, len(records))
+	failed := 0
+
+	for i, rec := range records {
+		results[i].Row = i + 1
+		results[i].GatewayID = rec.GatewayID
+		gw, err := s.gatewayFromImport(tenant, rec)
+		if err == nil {
+			results[i].GatewayID = gw.GatewayID.String()
+			if first, dup := seen[lorawan.EUI64(gw.GatewayID)]; dup {
+				err = fmt.Errorf("duplicate of row %d", first)
+			} else {
+				seen[lorawan.EUI64(gw.GatewayID)] = i + 1
+			}
+		}
+		if err == nil {
+			if _, getErr := s.store.GetGateway(ctx, lorawan.EUI64(gw.GatewayID)); getErr == nil {
+				err = fmt.Errorf("gateway already exists")
+			} else if getErr != storage.ErrNotFound {
+				s.respondError(w, http.StatusInternalServerError, getErr.Error())
+				return
+			}
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			failed++
+			continue
+		}
+		gateways[i] = gw
+	}
+
+	if failed > 0 {
+		s.respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"created": 0,
+			"failed":  failed,
+			"results": results,
+		})
+		return
+	}
+
+	if status, err := s.checkGatewayQuota(ctx, tenant, len(gateways)); err != nil {
+		s.respondError(w, status, err.Error())
+		return
+	}
+
+	txStore, err := s.store.BeginTx(ctx)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer txStore.Rollback()
+
+	for i, gw := range gateways {
+		if err := txStore.CreateGateway(ctx, gw); err != nil {
+			if err != storage.ErrDuplicateKey {
+				s.respondError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			// 校验之后被并发创建
+			results[i].Error = "gateway already exists"
+			s.respondJSON(w, http.StatusConflict, map[string]interface{}{
+				"created": 0,
+				"failed":  1,
+				"results": results,
+			})
+			return
+		}
+	}
+
+	if err := txStore.Commit(); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range results {
+		results[i].Created = true
+	}
+	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"created": len(gateways),
+		"failed":  0,
+		"results": results,
+	})
+}
+
+// gatewayFromImport validates an import record and builds the gateway to create
+func (s *RESTServer) gatewayFromImport(tenant *models.Tenant, rec gatewayImportRecord) (*models.Gateway, error) {
+	if rec.parseErr != nil {
+		return nil, rec.parseErr
+	}
+	gatewayID, err := lorawan.ParseGatewayID(rec.GatewayID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gateway_id")
+	}
+	if strings.TrimSpace(rec.Name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if rec.Latitude < -90 || rec.Latitude > 90 || rec.Longitude < -180 || rec.Longitude > 180 {
+		return nil, fmt.Errorf("latitude must be between -90 and 90, longitude between -180 and 180")
+	}
+
+	gateway := &models.Gateway{
+		GatewayID: models.EUI64(gatewayID),
+		TenantModel: models.TenantModel{
+			TenantID: tenant.ID,
+		},
+		Name:        rec.Name,
+		Description: rec.Description,
+		Labels:      gatewayLabels(rec.Labels),
+	}
+
+	if rec.Region != "" {
+		if !isSupportedRegion(rec.Region) {
+			return nil, fmt.Errorf("unsupported region: %s", rec.Region)
+		}
+		if !tenant.AllowsRegion(rec.Region) {
+			return nil, fmt.Errorf("region %s is not allowed for this tenant", rec.Region)
+		}
+		gateway.Metadata = models.Variables{"region": strings.ToUpper(rec.Region)}
+	}
+
+	if rec.Latitude != 0 || rec.Longitude != 0 || rec.Altitude != 0 {
+		gateway.Location = &models.Location{
+			Latitude:  rec.Latitude,
+			Longitude: rec.Longitude,
+			Altitude:  rec.Altitude,
+		}
+	}
+
+	return gateway, nil
+}
+
+// checkGatewayQuota checks that the tenant may own adding more gateways
+func (s *RESTServer) checkGatewayQuota(ctx context.Context, tenant *models.Tenant, adding int) (int, error) {
+	if !tenant.CanHaveGateways {
+		return http.StatusForbidden, fmt.Errorf("tenant cannot have gateways")
+	}
+	if tenant.MaxGatewayCount <= 0 {
+		return http.StatusOK, nil
+	}
+
+	_, total, err := s.store.ListGateways(ctx, tenant.ID, storage.GatewayFilters{}, 1, 0)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if int(total)+adding > tenant.MaxGatewayCount {
+		return http.StatusForbidden, fmt.Errorf("gateway quota exceeded: %d of %d in use, %d requested",
+			total, tenant.MaxGatewayCount, adding)
+	}
+	return http.StatusOK, nil
+}
+
+// parseGatewayImport reads import records from a text/csv or JSON body.
+// JSON is an array of records; CSV has a header row with gatewayImportColumns
+// and labels written as key=value pairs separated by ";".
+func parseGatewayImport(r *http.Request) ([]gatewayImportRecord, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		var records []gatewayImportRecord
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			return nil, fmt.Errorf("invalid request body")
+		}
+		return records, nil
+	}
+
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := index["gateway_id"]; !ok {
+		return nil, fmt.Errorf("CSV header must include gateway_id (columns: %s)", strings.Join(gatewayImportColumns, ","))
+	}
+
+	var records []gatewayImportRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(records) >= maxGatewayImportRows {
+			return nil, fmt.Errorf("at most %d gateways per import", maxGatewayImportRows)
+		}
+
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		rec := gatewayImportRecord{
+			GatewayID:   field("gateway_id"),
+			Name:        field("name"),
+			Description: field("description"),
+			Region:      field("region"),
+		}
+		for _, f := range []struct {
+			name string
+			dst  *float64
+		}{
+			{"latitude", &rec.Latitude},
+			{"longitude", &rec.Longitude},
+			{"altitude", &rec.Altitude},
+		} {
+			if v := field(f.name); v != "" {
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil && rec.parseErr == nil {
+					rec.parseErr = fmt.Errorf("%s must be a number", f.name)
+				}
+				*f.dst = n
+			}
+		}
+		if v := field("labels"); v != "" {
+			rec.Labels = make(map[string]string)
+			for _, pair := range strings.Split(v, ";") {
+				key, value, ok := strings.Cut(pair, "=")
+				if !ok || strings.TrimSpace(key) == "" {
+					if rec.parseErr == nil {
+						rec.parseErr = fmt.Errorf("labels must be key=value pairs separated by ;")
+					}
+					continue
+				}
+				rec.Labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+func TestParseGatewayImportCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []gatewayImportRecord
+		wantErr bool
+	}{
+		{
+			name: "all columns",
+			body: "gateway_id,name,description,latitude,longitude,altitude,region,labels\n" +
+				"0102030405060708,roof,north side,31.23,121.47,12,CN470,site=sh-01; floor=12\n",
+			want: []gatewayImportRecord{{GatewayID: "0102030405060708", Name: "roof", Description: "north side", Latitude: 31.23, Longitude: 121.47, Altitude: 12,
+				Region: "CN470", Labels: map[string]string{"site": "sh-01", "floor": "12"}}},
+		},
+		{
+			name: "columns in any order",
+			body: "Name, Gateway_ID\nroof, 0102030405060708\n",
+			want: []gatewayImportRecord{{GatewayID: "0102030405060708", Name: "roof"}},
+		},
+		{"header only", "gateway_id,name\n", nil, false},
+		{"empty body", "", nil, false},
+		{"missing gateway_id column", "name\nroof\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "text/csv")
+			got, err := parseGatewayImport(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGatewayImport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGatewayImport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleImportGateways(t *testing.T) {
+	const csvHeader = "gateway_id,name,latitude,longitude,altitude,region,labels\n"
+
+	type rowResult struct {
+		Row       int    `json:"row"`
+		GatewayID string `json:"gatewayId"`
+		Created   bool   `json:"created"`
+		Error     string `json:"error"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		tenant      models.Tenant
+		existing    bool // 0102030405060799 is already registered
+		want        int
+		wantResults []rowResult
+	}{
+		{
+			name:        "JSON",
+			contentType: "application/json",
+			body:        `[{"gateway_id":"0102030405060701","name":"roof","latitude":31.23,"longitude":121.47,"altitude":12,"region":"cn470","labels":{"site":"sh-01"}},{"gateway_id":"01:02:03:04:05:06:07:02","name":"basement"}]`,
+			tenant:      models.Tenant{CanHaveGateways: true},
+			want:        http.StatusCreated,
+			wantResults: []rowResult{{1, "0102030405060701", true, ""}, {2, "0102030405060702", true, ""}},
+		},
+		{
+			name:        "CSV",
+			contentType: "text/csv",
+			body:        csvHeader + "0102030405060701,roof,31.23,121.47,12,CN470,site=sh-01\n0102030405060702,basement,,,,,\n",
+			tenant:      models.Tenant{CanHaveGateways: true, MaxGatewayCount: 2},
+			want:        http.StatusCreated,
+			wantResults: []rowResult{{1, "0102030405060701", true, ""}, {2, "0102030405060702", true, ""}},
+		},
+		{
+			// Any invalid row rejects the whole import
+			name:        "mixed valid and invalid rows",
+			contentType: "text/csv",
+			body: csvHeader +
+				"0102030405060701,roof,31.23,121.47,12,CN470,site=sh-01\n" +
+				"not-an-eui,bad id,,,,,\n" +
+				"0102030405060703,,,,,,\n" +
+				"0102030405060704,far north,91,0,0,,\n" +
+				"0102030405060705,us,,,,US915,\n" +
+				"0102030405060706,bad number,north,,,,\n" +
+				"0102030405060707,bad labels,,,,,site\n" +
+				"0102030405060701,copy,,,,,\n" +
+				"0102030405060799,existing,,,,,\n",
+			tenant:   models.Tenant{CanHaveGateways: true, AllowedRegions: []string{"CN470"}},
+			existing: true,
+			want:     http.StatusUnprocessableEntity,
+			wantResults: []rowResult{
+				{1, "0102030405060701", false, ""},
+				{2, "not-an-eui", false, "invalid gateway_id"},
+				{3, "0102030405060703", false, "name is required"},
+				{4, "0102030405060704", false, "latitude must be between -90 and 90, longitude between -180 and 180"},
+				{5, "0102030405060705", false, "region US915 is not allowed for this tenant"},
+				{6, "0102030405060706", false, "latitude must be a number"},
+				{7, "0102030405060707", false, "labels must be key=value pairs separated by ;"},
+				{8, "0102030405060701", false, "duplicate of row 1"},
+				{9, "0102030405060799", false, "gateway already exists"},
+			},
+		},
+		{
+			name:        "quota exceeded",
+			contentType: "application/json",
+			body:        `[{"gateway_id":"0102030405060701","name":"roof"},{"gateway_id":"0102030405060702","name":"basement"}]`,
+			tenant:      models.Tenant{CanHaveGateways: true, MaxGatewayCount: 2},
+			existing:    true,
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "tenant cannot have gateways",
+			contentType: "application/json",
+			body:        `[{"gateway_id":"0102030405060701","name":"roof"}]`,
+			tenant:      models.Tenant{},
+			want:        http.StatusForbidden,
+		},
+		{"no rows", "text/csv", csvHeader, models.Tenant{CanHaveGateways: true}, false, http.StatusBadRequest, nil},
+		{"invalid JSON", "application/json", `{"gateway_id":"0102030405060701"}`, models.Tenant{CanHaveGateways: true}, false, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			ctx := context.Background()
+			tenant := tt.tenant
+			tenant.Name = "tenant"
+			if err := store.CreateTenant(ctx, &tenant); err != nil {
+				t.Fatal(err)
+			}
+			if tt.existing {
+				existing := &models.Gateway{GatewayID: models.EUI64{1, 2, 3, 4, 5, 6, 7, 0x99}, Name: "existing", TenantModel: models.TenantModel{TenantID: tenant.ID}}
+				if err := store.CreateGateway(ctx, existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := serve(s.HandleImportGateways, withUser(r, &models.User{}, &tenant))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			var resp struct {
+				Created int         `json:"created"`
+				Failed  int         `json:"failed"`
+				Results []rowResult `json:"results"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if !reflect.DeepEqual(resp.Results, tt.wantResults) {
+				t.Errorf("results = %+v, want %+v", resp.Results, tt.wantResults)
+			}
+
+			// Only a fully valid import creates gateways
+			wantTotal := int64(0)
+			if tt.want == http.StatusCreated {
+				wantTotal = int64(len(tt.wantResults))
+			}
+			if tt.existing {
+				wantTotal++
+			}
+			if _, total, _ := store.ListGateways(ctx, tenant.ID, storage.GatewayFilters{}, 100, 0); total != wantTotal {
+				t.Errorf("%d gateways stored, want %d", total, wantTotal)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			gw, err := store.GetGateway(ctx, [8]byte{1, 2, 3, 4, 5, 6, 7, 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gw.Name != "roof" || gw.TenantID != tenant.ID || gw.Location == nil || gw.Location.Latitude != 31.23 || gw.Location.Altitude != 12 {
+				t.Errorf("imported gateway = %+v", gw)
+			}
+			if gw.Labels["site"] != "sh-01" || gw.Metadata["region"] != "CN470" {
+				t.Errorf("labels %v metadata %v, want site=sh-01 region=CN470", gw.Labels, gw.Metadata)
+			}
+			if gw, _ := store.GetGateway(ctx, [8]byte{1, 2, 3, 4, 5, 6, 7, 2}); gw == nil || gw.Location != nil {
+				t.Errorf("gateway without coordinates = %+v", gw)
+			}
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
+    "context"
     "fmt"
     "encoding/hex"
     "encoding/json"
     "net/http"
     "strconv"
+    "strings"
     "time"
 
     "github.com/go-chi/chi/v5"
@@ -91,16 +93,9 @@ func (s *RESTServer) HandleRefresh(w http.ResponseWriter, r *http.Request) {
     })
 }
 
-// HandleGetCurrentUser gets current user
+// HandleGetCurrentUser gets the authenticated user
 func (s *RESTServer) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
-    // TODO: Get from context
-    s.respondJSON(w, http.StatusOK, map[string]interface{}{
-        "id":       "22222222-2222-2222-2222-222222222222",
-        "email":    "admin@example.com",
-        "name":     "Administrator",
-        "role":     "admin",
-        "is_admin": true,
-    })
+    s.respondJSON(w, http.StatusOK, userFromContext(r))
 }
 
 // ========== Tenant handlers ==========
@@ -134,6 +129,7 @@ func (s *RESTServer) HandleCreateTenant(w http.ResponseWriter, r *http.Request)
         Description     string `json:"description"`
         MaxDeviceCount  int    `json:"max_device_count" validate:"min=0"`
         MaxGatewayCount int    `json:"max_gateway_count" validate:"min=0"`
+        AllowedRegions  []string `json:"allowed_regions"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -146,12 +142,18 @@ func (s *RESTServer) HandleCreateTenant(w http.ResponseWriter, r *http.Request)
         return
     }
 
+    if err := validateRegions(req.AllowedRegions); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
     tenant := &models.Tenant{
         Name:            req.Name,
         Description:     req.Description,
         MaxDeviceCount:  req.MaxDeviceCount,
         MaxGatewayCount: req.MaxGatewayCount,
         CanHaveGateways: req.MaxGatewayCount > 0,
+        AllowedRegions:  req.AllowedRegions,
     }
 
     if tenant.MaxDeviceCount == 0 {
@@ -212,6 +214,7 @@ func (s *RESTServer) HandleUpdateTenant(w http.ResponseWriter, r *http.Request)
         MaxDeviceCount  int    `json:"max_device_count" validate:"min=0"`
         MaxGatewayCount int    `json:"max_gateway_count" validate:"min=0"`
         CanHaveGateways bool   `json:"can_have_gateways"`
+        AllowedRegions  []string `json:"allowed_regions"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -224,6 +227,11 @@ func (s *RESTServer) HandleUpdateTenant(w http.ResponseWriter, r *http.Request)
         return
     }
 
+    if err := validateRegions(req.AllowedRegions); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
     tenant, err := s.store.GetTenant(ctx, id)
     if err != nil {
         if err == storage.ErrNotFound {
@@ -239,6 +247,7 @@ func (s *RESTServer) HandleUpdateTenant(w http.ResponseWriter, r *http.Request)
     tenant.MaxDeviceCount = req.MaxDeviceCount
     tenant.MaxGatewayCount = req.MaxGatewayCount
     tenant.CanHaveGateways = req.CanHaveGateways || req.MaxGatewayCount > 0
+    tenant.AllowedRegions = req.AllowedRegions
 
     if err := s.store.UpdateTenant(ctx, tenant); err != nil {
         s.respondError(w, http.StatusInternalServerError, err.Error())
@@ -276,8 +285,10 @@ func (s *RESTServer) HandleDeleteTenant(w http.ResponseWriter, r *http.Request)
 func (s *RESTServer) HandleListApplications(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
 
-    // TODO: Get from auth context
-    tenantID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+    tenantID, ok := s.requestTenantID(w, r)
+    if !ok {
+        return
+    }
 
     limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
     if limit == 0 {
@@ -300,8 +311,12 @@ func (s *RESTServer) HandleListApplications(w http.ResponseWriter, r *http.Reque
 // HandleCreateApplication creates an application
 func (s *RESTServer) HandleCreateApplication(w http.ResponseWriter, r *http.Request) {
     var req struct {
-        Name        string `json:"name" validate:"required,min=3,max=100"`
-        Description string `json:"description"`
+        Name              string `json:"name" validate:"required,min=3,max=100"`
+        Description       string `json:"description"`
+        ConfirmedTimeout  int    `json:"confirmed_timeout"`
+        ForwardPHYPayload bool   `json:"forward_phy_payload"`
+        
+        ForwardFields *models.ForwardFieldFilter `json:"forward_fields"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -314,15 +329,30 @@ func (s *RESTServer) HandleCreateApplication(w http.ResponseWriter, r *http.Requ
         return
     }
 
-    // TODO: Get from auth context
-    tenantID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+    if err := validateConfirmedTimeout(req.ConfirmedTimeout); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if err := req.ForwardFields.Validate(); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    tenantID, ok := s.requestTenantID(w, r)
+    if !ok {
+        return
+    }
 
     app := &models.Application{
         TenantModel: models.TenantModel{
             TenantID: tenantID,
         },
-        Name:        req.Name,
-        Description: req.Description,
+        Name:              req.Name,
+        Description:       req.Description,
+        ConfirmedTimeout:  req.ConfirmedTimeout,
+        ForwardPHYPayload: req.ForwardPHYPayload,
+        ForwardFields:     req.ForwardFields,
     }
 
     if err := s.store.CreateApplication(r.Context(), app); err != nil {
@@ -371,8 +401,13 @@ func (s *RESTServer) HandleUpdateApplication(w http.ResponseWriter, r *http.Requ
     }
 
     var req struct {
-        Name        string `json:"name" validate:"required,min=3,max=100"`
-        Description string `json:"description"`
+        Name              string `json:"name" validate:"required,min=3,max=100"`
+        Description       string `json:"description"`
+        ConfirmedTimeout  *int   `json:"confirmed_timeout"`
+        ForwardPHYPayload *bool  `json:"forward_phy_payload"`
+        
+        // 传入空对象清除过滤
+        ForwardFields *models.ForwardFieldFilter `json:"forward_fields"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -385,6 +420,18 @@ func (s *RESTServer) HandleUpdateApplication(w http.ResponseWriter, r *http.Requ
         return
     }
 
+    if req.ConfirmedTimeout != nil {
+        if err := validateConfirmedTimeout(*req.ConfirmedTimeout); err != nil {
+            s.respondError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+    }
+
+    if err := req.ForwardFields.Validate(); err != nil {
+        s.respondError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
     app, err := s.store.GetApplication(ctx, id)
     if err != nil {
         if err == storage.ErrNotFound {
@@ -397,6 +444,18 @@ func (s *RESTServer) HandleUpdateApplication(w http.ResponseWriter, r *http.Requ
 
     app.Name = req.Name
     app.Description = req.Description
+    if req.ConfirmedTimeout != nil {
+        app.ConfirmedTimeout = *req.ConfirmedTimeout
+    }
+    if req.ForwardPHYPayload != nil {
+        app.ForwardPHYPayload = *req.ForwardPHYPayload
+    }
+    if req.ForwardFields != nil {
+        app.ForwardFields = req.ForwardFields
+        if app.ForwardFields.Empty() {
+            app.ForwardFields = nil
+        }
+    }
 
     if err := s.store.UpdateApplication(ctx, app); err != nil {
         s.respondError(w, http.StatusInternalServerError, err.Error())
@@ -632,10 +691,21 @@ func (s *RESTServer) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
 
 // HandleHealth health check
 func (s *RESTServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
-    s.respondJSON(w, http.StatusOK, map[string]interface{}{
+    health := map[string]interface{}{
         "status": "healthy",
         "time":   time.Now(),
-    })
+    }
+    if pool, ok := s.store.(interface{ PoolStats() storage.PoolStats }); ok {
+        health["databasePool"] = pool.PoolStats()
+    }
+    if rs, ok := s.store.(interface{ ResilienceStats() storage.ResilienceStats }); ok {
+        stats := rs.ResilienceStats()
+        health["databaseResilience"] = stats
+        if stats.BreakerOpen {
+            health["status"] = "degraded"
+        }
+    }
+    s.respondJSON(w, http.StatusOK, health)
 }
 
 // HandleRoot root handler
@@ -672,6 +742,57 @@ func (s *RESTServer) respondError(w http.ResponseWriter, status int, message str
 
 // ========== Helper functions ==========
 
+// supportedRegions lists the regions the server can operate in
+var supportedRegions = []string{"EU868", "US915", "CN470"}
+
+// validateRegions checks that all regions are supported
+func validateRegions(regions []string) error {
+    for _, region := range regions {
+        if !isSupportedRegion(region) {
+            return fmt.Errorf("unsupported region: %s", region)
+        }
+    }
+    return nil
+}
+
+// maxConfirmedTimeout bounds the confirmed downlink ACK timeout (seconds)
+const maxConfirmedTimeout = 24 * 60 * 60
+
+// validateConfirmedTimeout checks the confirmed downlink ACK timeout
+func validateConfirmedTimeout(seconds int) error {
+    if seconds < 0 || seconds > maxConfirmedTimeout {
+        return fmt.Errorf("confirmed_timeout must be between 0 and %d seconds", maxConfirmedTimeout)
+    }
+    return nil
+}
+
+// isSupportedRegion checks whether a region is supported
+func isSupportedRegion(region string) bool {
+    for _, r := range supportedRegions {
+        if strings.EqualFold(r, region) {
+            return true
+        }
+    }
+    return false
+}
+
+// checkTenantRegion checks that the tenant is licensed for the region
+func (s *RESTServer) checkTenantRegion(ctx context.Context, tenantID uuid.UUID, region string) (int, error) {
+    tenant, err := s.store.GetTenant(ctx, tenantID)
+    if err != nil {
+        if err == storage.ErrNotFound {
+            return http.StatusBadRequest, fmt.Errorf("tenant not found")
+        }
+        return http.StatusInternalServerError, err
+    }
+
+    if !tenant.AllowsRegion(region) {
+        return http.StatusForbidden, fmt.Errorf("region %s is not allowed for this tenant", region)
+    }
+
+    return http.StatusOK, nil
+}
+
 // parseEUI64 parses EUI64
 func parseEUI64(s string) (lorawan.EUI64, error) {
     var eui lorawan.EUI64
@@ -13,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
+	"github.com/lorawan-server/lorawan-server-pro/internal/integration"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 )
@@ -20,9 +21,15 @@ import (
 // Integration 相关的数据结构
 type HTTPIntegration struct {
 	Enabled  bool              `json:"enabled"`
-	Endpoint string            `json:"endpoint"`
+	Endpoint string            `json:"endpoint"` // 单个地址（旧格式），可改用 endpoints
 	Headers  map[string]string `json:"headers"`
 	Timeout  int               `json:"timeout"` // 秒
+
+	// 多个转发地址，上行分别 POST 到每个启用的地址
+	Endpoints []integration.HTTPEndpoint `json:"endpoints"`
+
+	MaxAttempts int `json:"maxAttempts,omitempty"` // 失败重试的最多尝试次数，0 为默认 3 次
+	RetryDelay  int `json:"retryDelay,omitempty"`  // 首次重试间隔（毫秒），0 为默认 500ms
 }
 
 type MQTTIntegration struct {
@@ -64,6 +71,8 @@ func (s *RESTServer) HandleGetIntegrations(w http.ResponseWriter, r *http.Reques
 		httpBytes, _ := json.Marshal(*app.HTTPIntegration)
 		json.Unmarshal(httpBytes, &httpConfig)
 	}
+	// 旧格式的单个 endpoint 同时以数组形式返回
+	httpConfig.Endpoints = httpEndpointList(httpConfig)
 
 	if app.MQTTIntegration != nil && len(*app.MQTTIntegration) > 0 {
 		mqttBytes, _ := json.Marshal(*app.MQTTIntegration)
@@ -96,8 +105,23 @@ func (s *RESTServer) HandleUpdateHTTPIntegration(w http.ResponseWriter, r *http.
 	}
 
 	// 验证配置
-	if req.Enabled && req.Endpoint == "" {
-		s.respondError(w, http.StatusBadRequest, "endpoint is required when integration is enabled")
+	for i, endpoint := range req.Endpoints {
+		if endpoint.Enabled && endpoint.Endpoint == "" {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("endpoints[%d].endpoint is required when the endpoint is enabled", i))
+			return
+		}
+	}
+	if req.Enabled && req.Endpoint == "" && len(req.Endpoints) == 0 {
+		s.respondError(w, http.StatusBadRequest, "endpoint or endpoints is required when integration is enabled")
+		return
+	}
+
+	if req.MaxAttempts < 0 || req.MaxAttempts > 10 {
+		s.respondError(w, http.StatusBadRequest, "maxAttempts must be between 0 and 10")
+		return
+	}
+	if req.RetryDelay < 0 {
+		s.respondError(w, http.StatusBadRequest, "retryDelay must not be negative")
 		return
 	}
 
@@ -123,6 +147,15 @@ func (s *RESTServer) HandleUpdateHTTPIntegration(w http.ResponseWriter, r *http.
 		"headers":  req.Headers,
 		"timeout":  req.Timeout,
 	}
+	if req.MaxAttempts > 0 {
+		httpIntegration["maxAttempts"] = req.MaxAttempts
+	}
+	if req.RetryDelay > 0 {
+		httpIntegration["retryDelay"] = req.RetryDelay
+	}
+	if len(req.Endpoints) > 0 {
+		httpIntegration["endpoints"] = req.Endpoints
+	}
 
 	app.HTTPIntegration = &httpIntegration
 
@@ -282,21 +315,50 @@ func (s *RESTServer) testHTTPIntegration(app *models.Application) error {
 
 	jsonData, _ := json.Marshal(testPayload)
 
-	// 创建 HTTP 请求
-	req, err := http.NewRequest("POST", config.Endpoint, bytes.NewBuffer(jsonData))
+	// 发送请求
+	client := &http.Client{
+		Timeout: time.Duration(config.Timeout) * time.Second,
+	}
+
+	// 逐个测试启用的地址
+	tested := 0
+	for _, endpoint := range httpEndpointList(config) {
+		if !endpoint.Enabled {
+			continue
+		}
+		tested++
+		if err := postTestPayload(client, config, endpoint, jsonData); err != nil {
+			return fmt.Errorf("%s: %w", endpoint.Endpoint, err)
+		}
+	}
+	if tested == 0 {
+		return fmt.Errorf("no enabled HTTP endpoint")
+	}
+
+	return nil
+}
+
+// httpEndpointList 数组形式的转发地址，与转发服务的解析一致
+func httpEndpointList(config HTTPIntegration) []integration.HTTPEndpoint {
+	c := integration.HTTPConfig{Endpoint: config.Endpoint, Endpoints: config.Endpoints}
+	return c.EndpointList()
+}
+
+// postTestPayload 向一个地址发送测试数据
+func postTestPayload(client *http.Client, config HTTPIntegration, endpoint integration.HTTPEndpoint, jsonData []byte) error {
+	req, err := http.NewRequest("POST", endpoint.Endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
 
 	// 设置 headers
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(integration.PayloadVersionHeader, integration.PayloadVersion)
 	for k, v := range config.Headers {
 		req.Header.Set(k, v)
 	}
-
-	// 发送请求
-	client := &http.Client{
-		Timeout: time.Duration(config.Timeout) * time.Second,
+	for k, v := range endpoint.Headers {
+		req.Header.Set(k, v)
 	}
 
 	resp, err := client.Do(req)
@@ -308,7 +370,6 @@ func (s *RESTServer) testHTTPIntegration(app *models.Application) error {
 	if resp.StatusCode >= 400 {
 		return fmt.Errorf("HTTP request failed with status: %d", resp.StatusCode)
 	}
-
 	return nil
 }
 
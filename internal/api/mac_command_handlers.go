@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/auth"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// linkADRReqParams is the structured form of a LinkADRReq
+type linkADRReqParams struct {
+	DataRate   uint8  `json:"data_rate"`
+	TXPower    uint8  `json:"tx_power"`
+	ChMask     uint16 `json:"ch_mask"`
+	ChMaskCntl uint8  `json:"ch_mask_cntl"`
+	NbTrans    uint8  `json:"nb_trans"`
+}
+
+func (p linkADRReqParams) payload() ([]byte, error) {
+	if p.DataRate > 15 || p.TXPower > 15 {
+		return nil, fmt.Errorf("data_rate and tx_power must be between 0 and 15")
+	}
+	if p.ChMaskCntl > 7 || p.NbTrans > 15 {
+		return nil, fmt.Errorf("ch_mask_cntl must be between 0 and 7, nb_trans between 0 and 15")
+	}
+	return []byte{
+		p.DataRate<<4 | p.TXPower,
+		byte(p.ChMask),
+		byte(p.ChMask >> 8),
+		p.ChMaskCntl<<4 | p.NbTrans,
+	}, nil
+}
+
+// HandleQueueMACCommand queues a MAC command to ride in the device's next downlink FOpts
+func (s *RESTServer) HandleQueueMACCommand(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	var req struct {
+		CID        *uint8            `json:"cid"`
+		Payload    string            `json:"payload"`
+		LinkADRReq *linkADRReqParams `json:"link_adr_req"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var cmd lorawan.MACCommand
+	switch {
+	case req.LinkADRReq != nil:
+		payload, err := req.LinkADRReq.payload()
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cmd = lorawan.MACCommand{CID: lorawan.LinkADRReq, Payload: payload}
+	case req.CID != nil:
+		payload, err := hex.DecodeString(req.Payload)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "payload must be hex encoded")
+			return
+		}
+		cmd = lorawan.MACCommand{CID: *req.CID, Payload: payload}
+	default:
+		s.respondError(w, http.StatusBadRequest, "cid or link_adr_req is required")
+		return
+	}
+
+	expected := lorawan.DownlinkMACCommandPayloadLength(cmd.CID)
+	if expected < 0 {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("unsupported downlink MAC command: 0x%02x", cmd.CID))
+		return
+	}
+	if len(cmd.Payload) != expected {
+		s.respondError(w, http.StatusBadRequest,
+			fmt.Sprintf("MAC command 0x%02x requires %d payload bytes, got %d", cmd.CID, expected, len(cmd.Payload)))
+		return
+	}
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	item := &models.MACCommandQueueItem{
+		DevEUI:  device.DevEUI,
+		CID:     cmd.CID,
+		Payload: cmd.Payload,
+	}
+	if err := s.store.EnqueueMACCommand(ctx, item); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 审计：记录操作人和命令内容
+	details := models.Variables{
+		"cid":     cmd.CID,
+		"payload": hex.EncodeToString(cmd.Payload),
+	}
+	if claims, ok := ctx.Value("claims").(*auth.Claims); ok {
+		details["userId"] = claims.UserID.String()
+		details["email"] = claims.Email
+	}
+	event := &models.EventLog{
+		ApplicationID: &device.ApplicationID,
+		DevEUI:        &device.DevEUI,
+		Type:          models.EventTypeAPICall,
+		Level:         models.EventLevelInfo,
+		Code:          "MAC_COMMAND_QUEUED",
+		Description:   fmt.Sprintf("MAC command 0x%02x queued", cmd.CID),
+		Details:       details,
+	}
+	if err := s.store.CreateEventLog(ctx, event); err != nil {
+		log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("记录 MAC 命令审计日志失败")
+	}
+
+	s.respondJSON(w, http.StatusAccepted, item)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestQueueMACCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		devEUI      string
+		body        map[string]interface{}
+		want        int
+		wantCID     byte
+		wantPayload []byte
+	}{
+		{
+			name:   "structured LinkADRReq",
+			devEUI: testDevEUI.String(),
+			body: map[string]interface{}{"link_adr_req": map[string]interface{}{
+				"data_rate": 5, "tx_power": 2, "ch_mask": 0x00ff, "ch_mask_cntl": 0, "nb_trans": 1,
+			}},
+			want:        http.StatusAccepted,
+			wantCID:     lorawan.LinkADRReq,
+			wantPayload: []byte{0x52, 0xff, 0x00, 0x01},
+		},
+		{
+			name:        "raw DevStatusReq",
+			devEUI:      testDevEUI.String(),
+			body:        map[string]interface{}{"cid": lorawan.DevStatusReq},
+			want:        http.StatusAccepted,
+			wantCID:     lorawan.DevStatusReq,
+			wantPayload: []byte{},
+		},
+		{
+			name:        "raw RXTimingSetupReq",
+			devEUI:      testDevEUI.String(),
+			body:        map[string]interface{}{"cid": lorawan.RXTimingSetupReq, "payload": "02"},
+			want:        http.StatusAccepted,
+			wantCID:     lorawan.RXTimingSetupReq,
+			wantPayload: []byte{0x02},
+		},
+		{"wrong payload length", testDevEUI.String(), map[string]interface{}{"cid": lorawan.RXTimingSetupReq, "payload": "0203"}, http.StatusBadRequest, 0, nil},
+		{"payload not hex", testDevEUI.String(), map[string]interface{}{"cid": lorawan.RXTimingSetupReq, "payload": "zz"}, http.StatusBadRequest, 0, nil},
+		{"unsupported cid", testDevEUI.String(), map[string]interface{}{"cid": 0x7f}, http.StatusBadRequest, 0, nil},
+		{"no command", testDevEUI.String(), map[string]interface{}{}, http.StatusBadRequest, 0, nil},
+		{"link adr data rate out of range", testDevEUI.String(), map[string]interface{}{"link_adr_req": map[string]interface{}{"data_rate": 16}}, http.StatusBadRequest, 0, nil},
+		{"unknown device", "0000000000000002", map[string]interface{}{"cid": lorawan.DevStatusReq}, http.StatusNotFound, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			ctx := context.Background()
+			store.CreateDevice(ctx, &models.Device{DevEUI: models.EUI64(testDevEUI)})
+
+			w := serve(s.HandleQueueMACCommand, newRequest(http.MethodPost, tt.body, map[string]string{"dev_eui": tt.devEUI}))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			items, _ := store.GetPendingMACCommands(ctx, testDevEUI)
+			if tt.want != http.StatusAccepted {
+				if len(items) != 0 {
+					t.Errorf("%d commands queued after a rejected request", len(items))
+				}
+				return
+			}
+			if len(items) != 1 || items[0].CID != tt.wantCID || !bytes.Equal(items[0].Payload, tt.wantPayload) {
+				t.Fatalf("queued %+v, want CID 0x%02x payload %x", items, tt.wantCID, tt.wantPayload)
+			}
+
+			// the request is audited
+			code := "MAC_COMMAND_QUEUED"
+			events, _, _ := store.ListEventLogs(ctx, storage.EventLogFilters{DevEUI: &testDevEUI}, 0, 0)
+			if len(events) != 1 || events[0].Code != code {
+				t.Errorf("events = %+v, want one %s audit event", events, code)
+			}
+		})
+	}
+}
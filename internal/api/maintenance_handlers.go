@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/auth"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/network"
+)
+
+// maintenanceTimeout bounds the wait for the Network Server to answer
+const maintenanceTimeout = 2 * time.Second
+
+// HandleGetMaintenance returns the Network Server's maintenance state
+func (s *RESTServer) HandleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	s.requestMaintenance(w, network.MaintenanceRequest{})
+}
+
+// HandleSetMaintenance enables or disables maintenance globally or for one gateway.
+// Class A downlinks stay queued until the device's first uplink after maintenance
+// ends; Class C downlinks are held and sent when it ends.
+func (s *RESTServer) HandleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		GatewayID string `json:"gateway_id"`
+		Enabled   *bool  `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Enabled == nil {
+		s.respondError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+
+	if !s.requestMaintenance(w, network.MaintenanceRequest{GatewayID: req.GatewayID, Enabled: req.Enabled}) {
+		return
+	}
+
+	// 审计：记录操作人
+	details := models.Variables{
+		"gatewayId": req.GatewayID,
+		"enabled":   *req.Enabled,
+	}
+	if claims, ok := ctx.Value("claims").(*auth.Claims); ok {
+		details["userId"] = claims.UserID.String()
+		details["email"] = claims.Email
+	}
+	scope := "all gateways"
+	if req.GatewayID != "" {
+		scope = "gateway " + req.GatewayID
+	}
+	event := &models.EventLog{
+		Type:        models.EventTypeAPICall,
+		Level:       models.EventLevelWarning,
+		Code:        "MAINTENANCE_MODE",
+		Description: fmt.Sprintf("Maintenance mode set to %t for %s", *req.Enabled, scope),
+		Details:     details,
+	}
+	if err := s.store.CreateEventLog(ctx, event); err != nil {
+		log.Error().Err(err).Msg("记录维护模式审计日志失败")
+	}
+}
+
+// requestMaintenance sends req to the Network Server and responds with its
+// maintenance status, returning false when the request failed
+func (s *RESTServer) requestMaintenance(w http.ResponseWriter, req network.MaintenanceRequest) bool {
+	nc := s.nc.Load()
+	if nc == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "maintenance mode requires a NATS connection")
+		return false
+	}
+
+	data, _ := json.Marshal(req)
+	reply, err := nc.Request(network.MaintenanceSubject, data, maintenanceTimeout)
+	if err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, "network server did not respond")
+		return false
+	}
+
+	var status network.MaintenanceStatus
+	if err := json.Unmarshal(reply.Data, &status); err != nil {
+		s.respondError(w, http.StatusBadGateway, "invalid response from network server")
+		return false
+	}
+	s.respondJSON(w, http.StatusOK, status)
+	return true
+}
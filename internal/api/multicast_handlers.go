@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/codec"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/network"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// multicastDownlinkTimeout bounds the wait for the Network Server to schedule a group downlink
+const multicastDownlinkTimeout = 5 * time.Second
+
+// multicastGroupRequest is the body for creating or updating a multicast group
+type multicastGroupRequest struct {
+	ApplicationID uuid.UUID `json:"applicationId" validate:"required"`
+	Name          string    `json:"name" validate:"required,max=100"`
+	McAddr        string    `json:"mcAddr" validate:"required,len=8"`
+	McNwkSKey     string    `json:"mcNwkSKey" validate:"required,aeskey"`
+	McAppSKey     string    `json:"mcAppSKey" validate:"required,aeskey"`
+	GroupType     string    `json:"groupType"` // C (default) / B
+	DR            *int      `json:"dr"`        // defaults to the RX2 data rate
+	Frequency     uint32    `json:"frequency"` // Hz, 0 uses the RX2 frequency
+	DevEUIs       []string  `json:"devEUIs"`
+}
+
+// apply validates the request and copies it onto the group. Members must be
+// devices of the group's application.
+func (req *multicastGroupRequest) apply(s *RESTServer, r *http.Request, group *models.MulticastGroup) error {
+	ctx := r.Context()
+
+	if err := s.validator.Validate(req); err != nil {
+		return err
+	}
+
+	mcAddr, err := hex.DecodeString(req.McAddr)
+	if err != nil {
+		return fmt.Errorf("invalid mcAddr")
+	}
+
+	groupType := models.MulticastGroupType(req.GroupType)
+	switch groupType {
+	case "":
+		groupType = models.MulticastGroupClassC
+	case models.MulticastGroupClassC:
+	case models.MulticastGroupClassB:
+		return fmt.Errorf("class B multicast groups are not supported yet")
+	default:
+		return fmt.Errorf("groupType must be C or B")
+	}
+
+	dr := s.defaultMulticastDR()
+	if req.DR != nil {
+		dr = *req.DR
+	}
+	override := &network.DownlinkOverride{Frequency: req.Frequency, DataRate: &dr}
+	if err := override.Validate(s.config); err != nil {
+		return err
+	}
+
+	app, err := s.store.GetApplication(ctx, req.ApplicationID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return fmt.Errorf("application not found")
+		}
+		return err
+	}
+	if !canAccessTenant(r, app.TenantID) {
+		return fmt.Errorf("application not found")
+	}
+
+	devEUIs := make([]models.EUI64, 0, len(req.DevEUIs))
+	for _, raw := range req.DevEUIs {
+		devEUI, err := parseEUI64(raw)
+		if err != nil {
+			return fmt.Errorf("invalid devEUI %q", raw)
+		}
+		device, err := s.store.GetDevice(ctx, devEUI)
+		if err == storage.ErrNotFound || (err == nil && device.ApplicationID != req.ApplicationID) {
+			return fmt.Errorf("device %s is not a device of application %s", raw, req.ApplicationID)
+		}
+		if err != nil {
+			return err
+		}
+		devEUIs = append(devEUIs, models.EUI64(devEUI))
+	}
+
+	group.ApplicationID = req.ApplicationID
+	group.Name = req.Name
+	copy(group.McAddr[:], mcAddr)
+	group.McNwkSKey = req.McNwkSKey
+	group.McAppSKey = req.McAppSKey
+	group.GroupType = groupType
+	group.DR = dr
+	group.Frequency = req.Frequency
+	group.DevEUIs = devEUIs
+	return nil
+}
+
+// defaultMulticastDR is the RX2 data rate of the configured band
+func (s *RESTServer) defaultMulticastDR() int {
+	band := s.config.Network.Band
+	if band == "" || band == "CN470" {
+		return s.config.CN470.RXWindows.RX2DataRate
+	}
+	return lorawan.GetRegionConfiguration(band).DefaultRX2DR
+}
+
+// multicastGroupResponse renders a group; the session keys are only included
+// when withKeys is set, i.e. for a single group rather than a listing
+func multicastGroupResponse(group *models.MulticastGroup, withKeys bool) map[string]interface{} {
+	devEUIs := make([]string, len(group.DevEUIs))
+	for i, devEUI := range group.DevEUIs {
+		devEUIs[i] = devEUI.String()
+	}
+
+	response := map[string]interface{}{
+		"id":            group.ID,
+		"applicationId": group.ApplicationID,
+		"name":          group.Name,
+		"mcAddr":        group.McAddr.String(),
+		"fCnt":          group.FCnt,
+		"groupType":     group.GroupType,
+		"dr":            group.DR,
+		"frequency":     group.Frequency,
+		"devEUIs":       devEUIs,
+		"createdAt":     group.CreatedAt,
+		"updatedAt":     group.UpdatedAt,
+	}
+	if withKeys {
+		response["mcNwkSKey"] = group.McNwkSKey
+		response["mcAppSKey"] = group.McAppSKey
+	}
+	return response
+}
+
+// getMulticastGroup loads the group in the URL, writing the error response on failure
+func (s *RESTServer) getMulticastGroup(w http.ResponseWriter, r *http.Request) (*models.MulticastGroup, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid multicast group id")
+		return nil, false
+	}
+
+	group, err := s.store.GetMulticastGroup(r.Context(), id)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "multicast group not found")
+			return nil, false
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	return group, true
+}
+
+// HandleListMulticastGroups lists the multicast groups of the user's tenant,
+// optionally of one application. Administrators see every tenant.
+func (s *RESTServer) HandleListMulticastGroups(w http.ResponseWriter, r *http.Request) {
+	var tenantID *uuid.UUID
+	if user := userFromContext(r); user == nil || !user.IsAdmin {
+		id := uuid.Nil
+		if tenant := tenantFromContext(r); tenant != nil {
+			id = tenant.ID
+		}
+		tenantID = &id
+	}
+
+	var applicationID *uuid.UUID
+	if v := r.URL.Query().Get("applicationId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid applicationId")
+			return
+		}
+		applicationID = &id
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit == 0 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	groups, total, err := s.store.ListMulticastGroups(r.Context(), tenantID, applicationID, limit, offset)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := make([]map[string]interface{}, len(groups))
+	for i, group := range groups {
+		response[i] = multicastGroupResponse(group, false)
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"multicastGroups": response,
+		"total":           total,
+	})
+}
+
+// HandleCreateMulticastGroup creates a multicast group
+func (s *RESTServer) HandleCreateMulticastGroup(w http.ResponseWriter, r *http.Request) {
+	var req multicastGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	group := &models.MulticastGroup{}
+	if err := req.apply(s, r, group); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.CreateMulticastGroup(r.Context(), group); err != nil {
+		switch err {
+		case storage.ErrDuplicateKey:
+			s.respondError(w, http.StatusConflict, "multicast group already exists")
+		case storage.ErrInvalidData:
+			s.respondError(w, http.StatusBadRequest, "application or device not found")
+		default:
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.respondJSON(w, http.StatusCreated, multicastGroupResponse(group, true))
+}
+
+// HandleGetMulticastGroup gets a multicast group with its members
+func (s *RESTServer) HandleGetMulticastGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.getMulticastGroup(w, r)
+	if !ok {
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, multicastGroupResponse(group, true))
+}
+
+// HandleUpdateMulticastGroup replaces a multicast group and its member list.
+// The frame counter is kept.
+func (s *RESTServer) HandleUpdateMulticastGroup(w http.ResponseWriter, r *http.Request) {
+	var req multicastGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	group, ok := s.getMulticastGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if err := req.apply(s, r, group); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.UpdateMulticastGroup(r.Context(), group); err != nil {
+		switch err {
+		case storage.ErrNotFound:
+			s.respondError(w, http.StatusNotFound, "multicast group not found")
+		case storage.ErrInvalidData:
+			s.respondError(w, http.StatusBadRequest, "application or device not found")
+		default:
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, multicastGroupResponse(group, true))
+}
+
+// HandleDeleteMulticastGroup deletes a multicast group
+func (s *RESTServer) HandleDeleteMulticastGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid multicast group id")
+		return
+	}
+
+	if err := s.store.DeleteMulticastGroup(r.Context(), id); err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "multicast group not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSendMulticastDownlink sends one downlink to all members of a group.
+// The Network Server encrypts it once with the group keys and transmits it
+// through every gateway that last heard a member.
+func (s *RESTServer) HandleSendMulticastDownlink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FPort uint8  `json:"fPort" validate:"required,min=1,max=223"`
+		Data  string `json:"data"` // hex encoded
+
+		// 由应用的 PayloadCodec 编码，data 为空时使用
+		Object map[string]interface{} `json:"object,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.validator.Validate(req); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !lorawan.ValidApplicationFPort(req.FPort) {
+		s.respondError(w, http.StatusBadRequest, "fPort must be between 1 and 223")
+		return
+	}
+	if req.Data == "" && req.Object == nil {
+		s.respondError(w, http.StatusBadRequest, "data or object is required")
+		return
+	}
+
+	nc := s.nc.Load()
+	if nc == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "multicast downlinks require a NATS connection")
+		return
+	}
+
+	group, ok := s.getMulticastGroup(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := hex.DecodeString(req.Data)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid hex data")
+		return
+	}
+	if req.Data == "" {
+		app, err := s.store.GetApplication(r.Context(), group.ApplicationID)
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		data, err = codec.EncodeObject(app.PayloadCodec, app.PayloadEncoder, req.FPort, req.Object)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	payload, _ := json.Marshal(network.MulticastDownlinkRequest{FPort: req.FPort, Data: data})
+	msg, err := nc.Request(network.MulticastDownlinkSubject(group.ID), payload, multicastDownlinkTimeout)
+	if err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, "network server did not respond: "+err.Error())
+		return
+	}
+
+	var reply network.MulticastDownlinkReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		s.respondError(w, http.StatusBadGateway, "invalid response from network server")
+		return
+	}
+	if reply.Status != "scheduled" {
+		s.respondError(w, http.StatusUnprocessableEntity, reply.Error)
+		return
+	}
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"multicastGroupId": group.ID,
+		"fCnt":             reply.FCnt,
+		"gateways":         reply.Gateways,
+		"status":           reply.Status,
+	})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+//go:embed presets/device_profiles.json
+var deviceProfilePresetsJSON []byte
+
+// DeviceProfilePreset is a factory device profile for a common sensor model
+type DeviceProfilePreset struct {
+	ID          string               `json:"id"`
+	Vendor      string               `json:"vendor"`
+	Model       string               `json:"model"`
+	Description string               `json:"description"`
+	Profile     models.DeviceProfile `json:"profile"`
+	// RXParams are the RX window settings the device ships with
+	RXParams presetRXParams `json:"rxParams"`
+}
+
+type presetRXParams struct {
+	RX1Delay     int    `json:"rx1Delay"`
+	RX1DROffset  int    `json:"rx1DROffset"`
+	RX2DR        int    `json:"rx2DR"`
+	RX2Frequency uint32 `json:"rx2Frequency"`
+}
+
+var deviceProfilePresets = mustLoadDeviceProfilePresets()
+
+func mustLoadDeviceProfilePresets() []DeviceProfilePreset {
+	var presets []DeviceProfilePreset
+	if err := json.Unmarshal(deviceProfilePresetsJSON, &presets); err != nil {
+		panic("invalid device profile presets: " + err.Error())
+	}
+	return presets
+}
+
+// findDeviceProfilePreset returns a copy of the preset with the given id
+func findDeviceProfilePreset(id string) (DeviceProfilePreset, bool) {
+	for _, p := range deviceProfilePresets {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return DeviceProfilePreset{}, false
+}
+
+// HandleListDeviceProfilePresets lists the factory device profile presets
+func (s *RESTServer) HandleListDeviceProfilePresets(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"presets": deviceProfilePresets,
+		"total":   len(deviceProfilePresets),
+	})
+}
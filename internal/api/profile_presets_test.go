@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestCreateDeviceProfileFromPreset(t *testing.T) {
+	preset := deviceProfilePresets[0]
+
+	tests := []struct {
+		name     string
+		preset   string
+		body     interface{}
+		want     int
+		wantName string
+	}{
+		{"preset only", preset.ID, nil, http.StatusCreated, preset.Profile.Name},
+		{"preset with overrides", preset.ID, map[string]interface{}{"name": "custom"}, http.StatusCreated, "custom"},
+		{"unknown preset", "no-such-preset", nil, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			tenant := &models.Tenant{Name: "tenant"}
+			store.CreateTenant(context.Background(), tenant)
+
+			r := newRequest(http.MethodPost, tt.body, nil)
+			r.URL.RawQuery = "preset=" + tt.preset
+			w := serve(s.HandleCreateDeviceProfile, withUser(r, &models.User{}, tenant))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			profiles, _, _ := store.ListDeviceProfiles(context.Background(), nil, 0, 0)
+			if len(profiles) != 1 {
+				t.Fatalf("%d profiles stored, want 1", len(profiles))
+			}
+			got := profiles[0]
+			if got.Name != tt.wantName || got.RFRegion != preset.Profile.RFRegion || got.MACVersion != preset.Profile.MACVersion ||
+				got.SupportsJoin != preset.Profile.SupportsJoin || got.MaxEIRP != preset.Profile.MaxEIRP {
+				t.Errorf("stored profile %+v does not match preset %+v", got, preset.Profile)
+			}
+			if got.TenantID == nil || *got.TenantID != tenant.ID {
+				t.Errorf("profile tenant = %v, want %s", got.TenantID, tenant.ID)
+			}
+		})
+	}
+}
+
+func TestDeviceProfilePresetsCreateValidProfiles(t *testing.T) {
+	s, _ := newTestServer(t)
+	w := serve(s.HandleListDeviceProfilePresets, newRequest(http.MethodGet, nil, nil))
+
+	var resp struct {
+		Presets []DeviceProfilePreset `json:"presets"`
+		Total   int                   `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total == 0 || len(resp.Presets) != resp.Total {
+		t.Fatalf("listed %d presets, total %d", len(resp.Presets), resp.Total)
+	}
+
+	// every preset must be usable without overrides
+	for _, preset := range resp.Presets {
+		s, store := newTestServer(t)
+		tenant := &models.Tenant{Name: "tenant"}
+		store.CreateTenant(context.Background(), tenant)
+
+		r := newRequest(http.MethodPost, nil, nil)
+		r.URL.RawQuery = "preset=" + preset.ID
+		if w := serve(s.HandleCreateDeviceProfile, withUser(r, &models.User{}, tenant)); w.Code != http.StatusCreated {
+			t.Errorf("preset %s: status = %d: %s", preset.ID, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestCreateDeviceProfileTenantRegion(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		region  string
+		want    int
+	}{
+		{"unrestricted tenant", nil, "EU868", http.StatusCreated},
+		{"allowed region", []string{"CN470"}, "CN470", http.StatusCreated},
+		{"allowed region ignores case", []string{"cn470"}, "CN470", http.StatusCreated},
+		{"disallowed region", []string{"CN470"}, "EU868", http.StatusForbidden},
+		{"unsupported region", nil, "XX123", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			tenant := &models.Tenant{Name: "tenant", AllowedRegions: tt.allowed}
+			store.CreateTenant(context.Background(), tenant)
+
+			r := newRequest(http.MethodPost, map[string]interface{}{
+				"name":     "profile",
+				"rfRegion": tt.region,
+			}, nil)
+			w := serve(s.HandleCreateDeviceProfile, withUser(r, &models.User{}, tenant))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			_, total, _ := store.ListDeviceProfiles(context.Background(), nil, 0, 0)
+			if created := tt.want == http.StatusCreated; (total == 1) != created {
+				t.Errorf("%d profiles stored, created = %v", total, created)
+			}
+		})
+	}
+}
+
+func TestCreateDeviceTenantRegion(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		region  string
+		want    int
+	}{
+		{"allowed region", []string{"CN470"}, "CN470", http.StatusCreated},
+		{"disallowed region", []string{"CN470"}, "EU868", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+			ctx := context.Background()
+
+			tenant := &models.Tenant{Name: "tenant", AllowedRegions: tt.allowed}
+			store.CreateTenant(ctx, tenant)
+			app := &models.Application{Name: "app"}
+			app.TenantID = tenant.ID
+			store.CreateApplication(ctx, app)
+			profile := &models.DeviceProfile{Name: "profile", TenantID: &tenant.ID, RFRegion: tt.region}
+			store.CreateDeviceProfile(ctx, profile)
+
+			w := serve(s.HandleCreateDevice, withUser(newRequest(http.MethodPost, map[string]interface{}{
+				"dev_eui":           "70b3d57ed0000001",
+				"name":              "device",
+				"application_id":    app.ID,
+				"device_profile_id": profile.ID,
+			}, nil), &models.User{}, tenant))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestTenantAllowsRegion(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		region  string
+		want    bool
+	}{
+		{nil, "EU868", true},
+		{[]string{"CN470", "EU868"}, "EU868", true},
+		{[]string{"CN470"}, "cn470", true},
+		{[]string{"CN470"}, "US915", false},
+	}
+
+	for _, tt := range tests {
+		tenant := &models.Tenant{ID: uuid.New(), AllowedRegions: tt.allowed}
+		if got := tenant.AllowsRegion(tt.region); got != tt.want {
+			t.Errorf("AllowsRegion(%q) with %v = %v, want %v", tt.region, tt.allowed, got, tt.want)
+		}
+	}
+}
@@ -21,10 +21,11 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 		// Users
 		r.Route("/users", func(r chi.Router) {
 			r.Use(s.authMiddleware)
-			r.Get("/", s.HandleListUsers)
-			r.Post("/", s.HandleCreateUser)
 			r.Get("/me", s.HandleGetCurrentUser)
+			r.With(s.adminMiddleware).Get("/", s.HandleListUsers)
+			r.With(s.adminMiddleware).Post("/", s.HandleCreateUser)
 			r.Route("/{id}", func(r chi.Router) {
+				r.Use(s.adminMiddleware)
 				r.Get("/", s.HandleGetUser)
 				r.Put("/", s.HandleUpdateUser)
 				r.Delete("/", s.HandleDeleteUser)
@@ -33,7 +34,7 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 
 		// Tenants
 		r.Route("/tenants", func(r chi.Router) {
-			r.Use(s.authMiddleware)
+			r.Use(s.authMiddleware, s.adminMiddleware)
 			r.Get("/", s.HandleListTenants)
 			r.Post("/", s.HandleCreateTenant)
 			r.Route("/{id}", func(r chi.Router) {
@@ -49,6 +50,7 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 			r.Get("/", s.HandleListApplications)
 			r.Post("/", s.HandleCreateApplication)
 			r.Route("/{id}", func(r chi.Router) {
+				r.Use(s.applicationAccessMiddleware)
 				r.Get("/", s.HandleGetApplication)
 				r.Put("/", s.HandleUpdateApplication)
 				r.Delete("/", s.HandleDeleteApplication)
@@ -59,6 +61,16 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 					r.Put("/mqtt", s.HandleUpdateMQTTIntegration)
 					r.Post("/test", s.HandleTestIntegration)
 				})
+				// Downlink templates
+				r.Route("/downlink-templates", func(r chi.Router) {
+					r.Get("/", s.HandleListDownlinkTemplates)
+					r.Post("/", s.HandleCreateDownlinkTemplate)
+					r.Route("/{name}", func(r chi.Router) {
+						r.Get("/", s.HandleGetDownlinkTemplate)
+						r.Put("/", s.HandleUpdateDownlinkTemplate)
+						r.Delete("/", s.HandleDeleteDownlinkTemplate)
+					})
+				})
 			})
 		})
 
@@ -67,21 +79,31 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 			r.Use(s.authMiddleware)
 			r.Get("/", s.HandleListDevices)
 			r.Post("/", s.HandleCreateDevice)
+			r.Post("/import-config", s.HandleImportDeviceConfig)
 			r.Route("/{dev_eui}", func(r chi.Router) {
+				r.Use(s.deviceAccessMiddleware)
 				r.Get("/", s.HandleGetDevice)
 				r.Put("/", s.HandleUpdateDevice)
 				r.Delete("/", s.HandleDeleteDevice)
+				r.Post("/purge", s.HandlePurgeDevice)
+				r.With(s.adminMiddleware).Post("/mac-command", s.HandleQueueMACCommand)
 				r.Post("/activate", s.HandleActivateDevice)
+				r.Delete("/dev-addr", s.HandleResetDeviceDevAddr)
 				// 添加这些路由
 				r.Get("/keys", s.HandleGetDeviceKeys)
 				r.Post("/keys", s.HandleSetDeviceKeys)
 				// Data management
 				r.Get("/data", s.HandleGetDeviceData)
 				r.Get("/export", s.HandleExportDeviceData)
+				r.Get("/export-config", s.HandleExportDeviceConfig)
+				r.Get("/location", s.HandleGetDeviceLocation)
+				r.Get("/events/stream", s.HandleStreamDeviceEvents)
+				r.With(s.adminMiddleware).Post("/frames/{frame_id}/replay", s.HandleReplayUplinkFrame)
 
 				// Downlink management
 				r.Post("/downlink", s.HandleSendDownlink)
 				r.Get("/downlink", s.HandleListDeviceDownlinks)
+				r.Post("/downlink/templates/{name}", s.HandleSendDownlinkTemplate)
 			})
 		})
 
@@ -89,6 +111,7 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 		r.Route("/downlinks", func(r chi.Router) {
 			r.Use(s.authMiddleware)
 			r.Delete("/{id}", s.HandleCancelDownlink)
+			r.Post("/dev-addr/{dev_addr}", s.HandleSendDownlinkByDevAddr)
 		})
 
 		// Gateways
@@ -96,10 +119,13 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 			r.Use(s.authMiddleware)
 			r.Get("/", s.HandleListGateways)
 			r.Post("/", s.HandleCreateGateway)
+			r.Post("/import", s.HandleImportGateways)
 			r.Route("/{gateway_id}", func(r chi.Router) {
+				r.Use(s.gatewayAccessMiddleware)
 				r.Get("/", s.HandleGetGateway)
 				r.Put("/", s.HandleUpdateGateway)
 				r.Delete("/", s.HandleDeleteGateway)
+				r.Get("/stats", s.HandleGetGatewayStats)
 			})
 		})
 
@@ -108,13 +134,42 @@ func (s *RESTServer) setupAPIRoutes(r chi.Router) {
 			r.Use(s.authMiddleware)
 			r.Get("/", s.HandleListDeviceProfiles)
 			r.Post("/", s.HandleCreateDeviceProfile)
+			r.Get("/presets", s.HandleListDeviceProfilePresets)
 			r.Route("/{id}", func(r chi.Router) {
+				r.Use(s.deviceProfileAccessMiddleware)
 				r.Get("/", s.HandleGetDeviceProfile)
 				r.Put("/", s.HandleUpdateDeviceProfile)
 				r.Delete("/", s.HandleDeleteDeviceProfile)
 			})
 		})
 
+		// Multicast groups
+		r.Route("/multicast-groups", func(r chi.Router) {
+			r.Use(s.authMiddleware)
+			r.Get("/", s.HandleListMulticastGroups)
+			r.Post("/", s.HandleCreateMulticastGroup)
+			r.Route("/{id}", func(r chi.Router) {
+				r.Use(s.multicastGroupAccessMiddleware)
+				r.Get("/", s.HandleGetMulticastGroup)
+				r.Put("/", s.HandleUpdateMulticastGroup)
+				r.Delete("/", s.HandleDeleteMulticastGroup)
+				r.Post("/downlink", s.HandleSendMulticastDownlink)
+			})
+		})
+
+		// Maintenance mode
+		r.Route("/maintenance", func(r chi.Router) {
+			r.Use(s.authMiddleware, s.adminMiddleware)
+			r.Get("/", s.HandleGetMaintenance)
+			r.Put("/", s.HandleSetMaintenance)
+		})
+
+		// Diagnostics
+		r.Route("/debug", func(r chi.Router) {
+			r.Use(s.authMiddleware, s.adminMiddleware)
+			r.Get("/caches", s.HandleDebugCaches)
+		})
+
 		// Events
 		r.Route("/events", func(r chi.Router) {
 			r.Use(s.authMiddleware)
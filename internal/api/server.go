@@ -2,19 +2,24 @@ package api
 
 import (
     "context"
+    stdlog "log"
     "net/http"
+    "net/url"
     "os"
-    "path/filepath"
     "strings"
+    "sync/atomic"
     "time"
 
     "github.com/go-chi/chi/v5"
     "github.com/go-chi/chi/v5/middleware"
     "github.com/go-chi/cors"
+    "github.com/nats-io/nats.go"
     "github.com/rs/zerolog/log"
 
     "github.com/lorawan-server/lorawan-server-pro/internal/auth"
     "github.com/lorawan-server/lorawan-server-pro/internal/config"
+    "github.com/lorawan-server/lorawan-server-pro/internal/geolocation"
+    "github.com/lorawan-server/lorawan-server-pro/internal/models"
     "github.com/lorawan-server/lorawan-server-pro/internal/storage"
     "github.com/lorawan-server/lorawan-server-pro/internal/validation"
 )
@@ -25,8 +30,11 @@ type RESTServer struct {
     store     storage.Store
     auth      *auth.JWTManager
     validator *validation.Validator
+    geo       *geolocation.Service
+    nc        atomic.Pointer[nats.Conn]
     router    chi.Router
     server    *http.Server
+    web       *http.Server
 }
 
 // NewRESTServer creates a new REST API server
@@ -36,6 +44,7 @@ func NewRESTServer(cfg *config.Config, store storage.Store) *RESTServer {
         store:     store,
         auth:      auth.NewJWTManager(&cfg.JWT),
         validator: validation.NewValidator(),
+        geo:       geolocation.NewService(cfg.Geolocation),
         router:    chi.NewRouter(),
     }
     
@@ -47,18 +56,28 @@ func NewRESTServer(cfg *config.Config, store storage.Store) *RESTServer {
         WriteTimeout: 15 * time.Second,
         IdleTimeout:  60 * time.Second,
     }
+    s.web = &http.Server{
+        ReadTimeout:  15 * time.Second,
+        WriteTimeout: 15 * time.Second,
+        IdleTimeout:  60 * time.Second,
+    }
     
     return s
 }
 
+// SetNATS sets the NATS connection used to forward downlinks to the network server
+func (s *RESTServer) SetNATS(nc *nats.Conn) {
+    s.nc.Store(nc)
+}
+
 // setupRoutes configures all routes
 func (s *RESTServer) setupRoutes() {
     // Middleware
     s.router.Use(middleware.RequestID)
     s.router.Use(middleware.RealIP)
-    s.router.Use(middleware.Logger)
+    s.router.Use(requestLogger)
     s.router.Use(middleware.Recoverer)
-    s.router.Use(middleware.Timeout(60 * time.Second))
+    s.router.Use(requestTimeout(60 * time.Second))
     
     // CORS
     s.router.Use(cors.Handler(cors.Options{
@@ -81,10 +100,7 @@ func (s *RESTServer) ListenAndServe(addr string) error {
     s.server.Addr = addr
     
     // 挂载静态文件服务 (Web UI)
-    webDir := s.config.Web.StaticDir
-    if envWebDir := os.Getenv("WEB_DIR"); envWebDir != "" {
-        webDir = envWebDir
-    }
+    webDir := s.webDir()
     
     // 检查 web 目录是否存在
     if _, err := os.Stat(webDir); os.IsNotExist(err) {
@@ -93,24 +109,7 @@ func (s *RESTServer) ListenAndServe(addr string) error {
         log.Info().Str("dir", webDir).Msg("Serving Web UI from directory")
         
         // 为所有非 API 路径提供静态文件
-        s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-            // API 路径由 chi 路由处理
-            if strings.HasPrefix(r.URL.Path, "/api/") {
-                s.router.ServeHTTP(w, r)
-                return
-            }
-            
-            // 其他路径提供静态文件
-            fs := http.FileServer(http.Dir(webDir))
-            
-            // 如果是根路径或没有扩展名的路径，尝试提供 index.html
-            if r.URL.Path == "/" || (!strings.Contains(r.URL.Path, ".") && r.URL.Path != "/") {
-                http.ServeFile(w, r, filepath.Join(webDir, "index.html"))
-                return
-            }
-            
-            fs.ServeHTTP(w, r)
-        })
+        s.server.Handler = s.webHandler(webDir)
     }
     
     log.Info().Str("addr", addr).Msg("Starting REST API server")
@@ -119,14 +118,76 @@ func (s *RESTServer) ListenAndServe(addr string) error {
 
 // Shutdown gracefully shuts down the server
 func (s *RESTServer) Shutdown(ctx context.Context) error {
+    if err := s.web.Shutdown(ctx); err != nil {
+        log.Warn().Err(err).Msg("Failed to shutdown Web UI server")
+    }
     return s.server.Shutdown(ctx)
 }
 
-// authMiddleware is the authentication middleware
+// requestTimeout bounds request handling time, except for event streams which
+// stay open until the client disconnects
+func requestTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+    limit := middleware.Timeout(timeout)
+    return func(next http.Handler) http.Handler {
+        limited := limit(next)
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if isEventStream(r) {
+                next.ServeHTTP(w, r)
+                return
+            }
+            limited.ServeHTTP(w, r)
+        })
+    }
+}
+
+// requestLogger is chi's request logger with the access_token query parameter
+// masked, so event stream tokens do not end up in the access log
+var requestLogger = middleware.RequestLogger(redactedLogFormatter{
+    &middleware.DefaultLogFormatter{Logger: stdlog.New(os.Stdout, "", stdlog.LstdFlags)},
+})
+
+// redactedLogFormatter hands the wrapped formatter a copy of the request whose
+// RequestURI has access_token replaced
+type redactedLogFormatter struct {
+    middleware.LogFormatter
+}
+
+func (f redactedLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+    if r.URL.Query().Has("access_token") {
+        redacted := *r
+        redacted.RequestURI = redactAccessToken(r.RequestURI)
+        r = &redacted
+    }
+    return f.LogFormatter.NewLogEntry(r)
+}
+
+// redactAccessToken replaces the value of the access_token query parameter in uri
+func redactAccessToken(uri string) string {
+    u, err := url.ParseRequestURI(uri)
+    if err != nil {
+        return uri
+    }
+    q := u.Query()
+    q.Set("access_token", "REDACTED")
+    u.RawQuery = q.Encode()
+    return u.RequestURI()
+}
+
+// authMiddleware validates the Bearer token, loads the user and tenant it was
+// issued for and makes them available through userFromContext and
+// tenantFromContext.
+//
+// Event streams may pass the token as ?access_token= since browsers cannot set
+// headers on an EventSource. requestLogger masks it, but proxies and load
+// balancers in front of the server log URLs on their own; such a token stays
+// usable until it expires, so keep jwt.access_token_ttl short where streams are used.
 func (s *RESTServer) authMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        // Get token from header
+        // Get token from header, or from the query for event streams
         authHeader := r.Header.Get("Authorization")
+        if token := r.URL.Query().Get("access_token"); authHeader == "" && token != "" && isEventStream(r) {
+            authHeader = "Bearer " + token
+        }
         if authHeader == "" {
             s.respondError(w, http.StatusUnauthorized, "missing authorization header")
             return
@@ -146,8 +207,49 @@ func (s *RESTServer) authMiddleware(next http.Handler) http.Handler {
             return
         }
         
-        // Add claims to context
+        // Load the user so disabled or deleted accounts lose access before the token expires
+        user, err := s.store.GetUser(r.Context(), claims.UserID)
+        if err != nil {
+            if err == storage.ErrNotFound {
+                s.respondError(w, http.StatusUnauthorized, "invalid token")
+                return
+            }
+            s.respondError(w, http.StatusInternalServerError, err.Error())
+            return
+        }
+        if !user.IsActive {
+            s.respondError(w, http.StatusForbidden, "account is disabled")
+            return
+        }
+        
+        var tenant *models.Tenant
+        if user.TenantID != nil {
+            tenant, err = s.store.GetTenant(r.Context(), *user.TenantID)
+            if err != nil {
+                if err == storage.ErrNotFound {
+                    s.respondError(w, http.StatusForbidden, "tenant not found")
+                    return
+                }
+                s.respondError(w, http.StatusInternalServerError, err.Error())
+                return
+            }
+        }
+        
+        // Add claims, user and tenant to context
         ctx := context.WithValue(r.Context(), "claims", claims)
+        ctx = withAuth(ctx, user, tenant)
         next.ServeHTTP(w, r.WithContext(ctx))
     })
 }
+
+// adminMiddleware only lets administrators through, must run after authMiddleware
+func (s *RESTServer) adminMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        user := userFromContext(r)
+        if user == nil || !user.IsAdmin {
+            s.respondError(w, http.StatusForbidden, "admin privileges required")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
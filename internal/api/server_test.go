@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// newTestServer creates a REST server on an in-memory store
+func newTestServer(t *testing.T) (*RESTServer, *storagetest.MemoryStore) {
+	t.Helper()
+
+	store := storagetest.New()
+	return NewRESTServer(&config.Config{}, store), store
+}
+
+// newRequest builds a request with body encoded as JSON and the given chi URL parameters
+func newRequest(method string, body interface{}, params map[string]string) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(method, "/", &buf)
+
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+// withUser authenticates r as user of tenant, as the auth middleware does
+func withUser(r *http.Request, user *models.User, tenant *models.Tenant) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	if tenant != nil {
+		ctx = context.WithValue(ctx, tenantContextKey, tenant)
+	}
+	return r.WithContext(ctx)
+}
+
+// serve records handler's response to r
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
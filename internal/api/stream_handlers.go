@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/codec"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+// deviceStreamEvents maps the event types a device stream can carry to the
+// NATS subject suffix the network server publishes them on
+var deviceStreamEvents = map[string]string{
+	"uplink": "rx",
+	"join":   "join",
+}
+
+// streamKeepAlive is how often an idle stream sends a comment so proxies keep it open
+const streamKeepAlive = 15 * time.Second
+
+// streamBuffer is how many NATS messages may queue for a slow client; further
+// messages are dropped for that client so NATS delivery is never blocked
+const streamBuffer = 64
+
+// isEventStream reports whether the request is for a server-sent events stream
+func isEventStream(r *http.Request) bool {
+	return strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/events/stream")
+}
+
+// parseStreamTypes parses the comma separated ?type= filter, all types when empty
+func parseStreamTypes(v string) ([]string, error) {
+	if v == "" {
+		return []string{"uplink", "join"}, nil
+	}
+	var types []string
+	for _, t := range strings.Split(v, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if _, ok := deviceStreamEvents[t]; !ok {
+			return nil, fmt.Errorf("unknown event type %q, expected uplink or join", t)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// HandleStreamDeviceEvents streams the device's uplinks and joins as
+// server-sent events until the client disconnects. Uplinks are decoded with
+// the application's payload codec. ?type=uplink,join selects the events.
+func (s *RESTServer) HandleStreamDeviceEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	nc := s.nc.Load()
+	if nc == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "event streams require a NATS connection")
+		return
+	}
+
+	devEUI, err := parseEUI64(chi.URLParam(r, "dev_eui"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid dev_eui")
+		return
+	}
+
+	types, err := parseStreamTypes(r.URL.Query().Get("type"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	app, err := s.store.GetApplication(ctx, device.ApplicationID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !canAccessTenant(r, app.TenantID) {
+		s.respondError(w, http.StatusNotFound, "device not found")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	msgs := make(chan *nats.Msg, streamBuffer)
+	for _, t := range types {
+		subject := fmt.Sprintf("application.*.device.%s.%s", devEUI.String(), deviceStreamEvents[t])
+		sub, err := nc.Subscribe(subject, func(m *nats.Msg) {
+			select {
+			case msgs <- m:
+			default:
+				log.Debug().Str("devEUI", devEUI.String()).Str("subject", m.Subject).Msg("Event stream client too slow, dropping event")
+			}
+		})
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer sub.Unsubscribe()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	rc.Flush()
+
+	log.Debug().Str("devEUI", devEUI.String()).Strs("types", types).Msg("Device event stream opened")
+	defer log.Debug().Str("devEUI", devEUI.String()).Msg("Device event stream closed")
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case msg := <-msgs:
+			event, data := streamEvent(app, msg)
+			if data == nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamEvent converts a NATS message to an SSE event name and JSON payload,
+// nil when the message cannot be parsed
+func streamEvent(app *models.Application, msg *nats.Msg) (string, []byte) {
+	if strings.HasSuffix(msg.Subject, ".join") {
+		return "join", msg.Data
+	}
+
+	var up struct {
+		DevEUI  string                   `json:"devEUI"`
+		DevAddr string                   `json:"devAddr"`
+		FCnt    uint32                   `json:"fCnt"`
+		FPort   *uint8                   `json:"fPort"`
+		Data    []byte                   `json:"data"`
+		Object  map[string]interface{}   `json:"object"`
+		RXInfo  []map[string]interface{} `json:"rxInfo"`
+		ADR     bool                     `json:"adr"`
+	}
+	if err := json.Unmarshal(msg.Data, &up); err != nil {
+		log.Warn().Err(err).Str("subject", msg.Subject).Msg("Failed to parse uplink for event stream")
+		return "", nil
+	}
+
+	if up.Object == nil && up.FPort != nil && len(up.Data) > 0 {
+		decoded, err := codec.DecodeObject(app.PayloadCodec, app.PayloadDecoder, *up.FPort, up.Data)
+		if err != nil {
+			log.Debug().Err(err).Str("devEUI", up.DevEUI).Msg("Failed to decode uplink for event stream")
+		}
+		up.Object = decoded
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"devEUI":     up.DevEUI,
+		"devAddr":    up.DevAddr,
+		"fCnt":       up.FCnt,
+		"fPort":      up.FPort,
+		"data":       hex.EncodeToString(up.Data),
+		"object":     up.Object,
+		"rxInfo":     up.RXInfo,
+		"adr":        up.ADR,
+		"receivedAt": time.Now(),
+	})
+	return "uplink", data
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// gzipExtensions are the static file types compressed on the fly
+var gzipExtensions = map[string]bool{
+	".html": true, ".js": true, ".mjs": true, ".css": true, ".json": true,
+	".svg": true, ".txt": true, ".map": true, ".xml": true, ".wasm": true,
+}
+
+// webDir returns the Web UI directory, WEB_DIR overrides web.static_dir
+func (s *RESTServer) webDir() string {
+	if dir := os.Getenv("WEB_DIR"); dir != "" {
+		return dir
+	}
+	return s.config.Web.StaticDir
+}
+
+// webHandler serves the API under /api/ and the Web UI from dir for everything else
+func (s *RESTServer) webHandler(dir string) http.Handler {
+	static := newStaticHandler(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			s.router.ServeHTTP(w, r)
+			return
+		}
+		static.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServeWeb serves the Web UI (and the API it calls) on the web port
+func (s *RESTServer) ListenAndServeWeb(addr string) error {
+	dir := s.webDir()
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		log.Warn().Str("dir", dir).Msg("Web directory not found, Web UI server not started")
+		return nil
+	}
+
+	s.web.Addr = addr
+	s.web.Handler = s.webHandler(dir)
+
+	log.Info().Str("addr", addr).Str("dir", dir).Msg("Starting Web UI server")
+	if err := s.web.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newStaticHandler serves files from dir with SPA fallback: paths without a file
+// extension that don't exist get index.html so client-side routes work on reload
+func newStaticHandler(dir string) http.Handler {
+	index := filepath.Join(dir, "index.html")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		urlPath := path.Clean("/" + r.URL.Path)
+		file := filepath.Join(dir, filepath.FromSlash(urlPath))
+
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			serveStatic(w, r, file)
+			return
+		}
+		if path.Ext(urlPath) != "" {
+			// 缺失的静态资源返回 404，不回退到 index.html
+			http.NotFound(w, r)
+			return
+		}
+
+		// index.html 可能随版本变化，不缓存
+		w.Header().Set("Cache-Control", "no-cache")
+		serveStatic(w, r, index)
+	})
+}
+
+// serveStatic serves one file, gzip compressed when the client accepts it
+func serveStatic(w http.ResponseWriter, r *http.Request, file string) {
+	if !gzipExtensions[strings.ToLower(filepath.Ext(file))] ||
+		!strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		http.ServeFile(w, r, file)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+
+	// 压缩后的长度未知，也不支持按字节范围读取
+	r.Header.Del("Range")
+	http.ServeFile(&gzipResponseWriter{ResponseWriter: w, writer: gz}, r, file)
+}
+
+// gzipResponseWriter writes the response body through a gzip writer
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	return g.writer.Write(b)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeWebDir creates a built Web UI with an index page, a script and an image
+func writeWebDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":    "<html>app</html>",
+		"assets/app.js": strings.Repeat("console.log('app');", 50),
+		"logo.png":      "\x89PNG",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWebHandler(t *testing.T) {
+	appJS := strings.Repeat("console.log('app');", 50)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		gzip         bool
+		want         int
+		wantBody     string // "" skips the body check
+		wantEncoding string
+	}{
+		{"root", http.MethodGet, "/", false, http.StatusOK, "<html>app</html>", ""},
+		{"asset", http.MethodGet, "/assets/app.js", false, http.StatusOK, appJS, ""},
+		{"asset gzip", http.MethodGet, "/assets/app.js", true, http.StatusOK, appJS, "gzip"},
+		{"image not compressed", http.MethodGet, "/logo.png", true, http.StatusOK, "\x89PNG", ""},
+		// Client-side routes get index.html
+		{"SPA route", http.MethodGet, "/devices/70b3d57ed0000001", false, http.StatusOK, "<html>app</html>", ""},
+		{"SPA route gzip", http.MethodGet, "/applications", true, http.StatusOK, "<html>app</html>", "gzip"},
+		{"directory", http.MethodGet, "/assets", false, http.StatusOK, "<html>app</html>", ""},
+		{"missing asset", http.MethodGet, "/assets/missing.js", false, http.StatusNotFound, "", ""},
+		{"path outside dir", http.MethodGet, "/../secret.txt", false, http.StatusNotFound, "", ""},
+		{"head", http.MethodHead, "/", false, http.StatusOK, "", ""},
+		{"post", http.MethodPost, "/", false, http.StatusMethodNotAllowed, "", ""},
+		// API paths never fall back to the Web UI
+		{"API", http.MethodGet, "/api/v1/health", false, http.StatusOK, "", ""},
+		{"unknown API path", http.MethodGet, "/api/v1/nope", false, http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			h := s.webHandler(writeWebDir(t))
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.URL.Path = tt.path
+			if tt.gzip {
+				r.Header.Set("Accept-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+
+			body := w.Body.String()
+			if tt.wantEncoding == "gzip" {
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, _ := io.ReadAll(gz)
+				body = string(b)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if strings.HasPrefix(tt.path, "/api/") && strings.Contains(body, "<html>app</html>") {
+				t.Error("API path served the Web UI")
+			}
+		})
+	}
+}
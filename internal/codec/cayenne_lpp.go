@@ -0,0 +1,300 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CayenneLPP 应用 PayloadCodec 字段取值，使用内置 Cayenne LPP 编解码
+const CayenneLPP = "cayenneLPP"
+
+// Cayenne LPP 数据类型
+const (
+	lppDigitalInput  byte = 0
+	lppDigitalOutput byte = 1
+	lppAnalogInput   byte = 2
+	lppAnalogOutput  byte = 3
+	lppIlluminance   byte = 101
+	lppPresence      byte = 102
+	lppTemperature   byte = 103
+	lppHumidity      byte = 104
+	lppAccelerometer byte = 113
+	lppBarometer     byte = 115
+	lppGyrometer     byte = 134
+	lppGPS           byte = 136
+)
+
+// lppType 描述一种 LPP 数据类型的编码方式
+type lppType struct {
+	name       string  // 解码后对象中的字段名
+	size       int     // 数据字节数
+	resolution float64 // 每个单位代表的值
+	signed     bool
+	axes       []string // 多轴数据的子字段名（加速度、陀螺仪）
+}
+
+var lppTypes = map[byte]lppType{
+	lppDigitalInput:  {name: "digitalInput", size: 1, resolution: 1},
+	lppDigitalOutput: {name: "digitalOutput", size: 1, resolution: 1},
+	lppAnalogInput:   {name: "analogInput", size: 2, resolution: 0.01, signed: true},
+	lppAnalogOutput:  {name: "analogOutput", size: 2, resolution: 0.01, signed: true},
+	lppIlluminance:   {name: "illuminanceSensor", size: 2, resolution: 1},
+	lppPresence:      {name: "presenceSensor", size: 1, resolution: 1},
+	lppTemperature:   {name: "temperatureSensor", size: 2, resolution: 0.1, signed: true},
+	lppHumidity:      {name: "humiditySensor", size: 1, resolution: 0.5},
+	lppAccelerometer: {name: "accelerometer", size: 6, resolution: 0.001, signed: true, axes: []string{"x", "y", "z"}},
+	lppBarometer:     {name: "barometer", size: 2, resolution: 0.1},
+	lppGyrometer:     {name: "gyrometer", size: 6, resolution: 0.01, signed: true, axes: []string{"x", "y", "z"}},
+	lppGPS:           {name: "gpsLocation", size: 9},
+}
+
+// DecodeCayenneLPP 把 LPP 帧解码为 {类型: {通道: 值}} 结构，例如
+// {"temperatureSensor": {"3": 27.2}, "gpsLocation": {"1": {"latitude": .., "longitude": .., "altitude": ..}}}
+func DecodeCayenneLPP(data []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for i := 0; i < len(data); {
+		if i+2 > len(data) {
+			return nil, fmt.Errorf("lpp: truncated header at byte %d", i)
+		}
+		channel := strconv.Itoa(int(data[i]))
+		typ, ok := lppTypes[data[i+1]]
+		if !ok {
+			return nil, fmt.Errorf("lpp: unknown data type %d at byte %d", data[i+1], i+1)
+		}
+		i += 2
+
+		if i+typ.size > len(data) {
+			return nil, fmt.Errorf("lpp: truncated %s value on channel %s", typ.name, channel)
+		}
+		value := data[i : i+typ.size]
+		i += typ.size
+
+		channels, _ := result[typ.name].(map[string]interface{})
+		if channels == nil {
+			channels = make(map[string]interface{})
+			result[typ.name] = channels
+		}
+		channels[channel] = typ.decode(value)
+	}
+
+	return result, nil
+}
+
+func (t lppType) decode(b []byte) interface{} {
+	if t.name == "gpsLocation" {
+		return map[string]interface{}{
+			"latitude":  decodeFixed(b[0:3], 0.0001, true),
+			"longitude": decodeFixed(b[3:6], 0.0001, true),
+			"altitude":  decodeFixed(b[6:9], 0.01, true),
+		}
+	}
+
+	if len(t.axes) > 0 {
+		n := t.size / len(t.axes)
+		axes := make(map[string]interface{}, len(t.axes))
+		for j, axis := range t.axes {
+			axes[axis] = decodeFixed(b[j*n:(j+1)*n], t.resolution, t.signed)
+		}
+		return axes
+	}
+
+	return decodeFixed(b, t.resolution, t.signed)
+}
+
+// EncodeCayenneLPP 把 DecodeCayenneLPP 格式的对象编码为 LPP 帧，按类型和通道排序输出
+func EncodeCayenneLPP(obj map[string]interface{}) ([]byte, error) {
+	byName := make(map[string]byte, len(lppTypes))
+	for code, typ := range lppTypes {
+		byName[typ.name] = code
+	}
+
+	type entry struct {
+		channel int
+		code    byte
+		value   interface{}
+	}
+	var entries []entry
+
+	for name, v := range obj {
+		code, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("lpp: unknown data type %q", name)
+		}
+		channels, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("lpp: %s must be an object keyed by channel", name)
+		}
+		for ch, value := range channels {
+			channel, err := strconv.Atoi(ch)
+			if err != nil || channel < 0 || channel > 255 {
+				return nil, fmt.Errorf("lpp: invalid channel %q for %s", ch, name)
+			}
+			entries = append(entries, entry{channel: channel, code: code, value: value})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].code != entries[j].code {
+			return entries[i].code < entries[j].code
+		}
+		return entries[i].channel < entries[j].channel
+	})
+
+	var out []byte
+	for _, e := range entries {
+		typ := lppTypes[e.code]
+		value, err := typ.encode(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("lpp: %s channel %d: %w", typ.name, e.channel, err)
+		}
+		out = append(out, byte(e.channel), e.code)
+		out = append(out, value...)
+	}
+
+	return out, nil
+}
+
+func (t lppType) encode(v interface{}) ([]byte, error) {
+	if t.name == "gpsLocation" {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected latitude/longitude/altitude object")
+		}
+		var out []byte
+		for _, f := range []struct {
+			key        string
+			resolution float64
+		}{{"latitude", 0.0001}, {"longitude", 0.0001}, {"altitude", 0.01}} {
+			n, err := toFloat(m[f.key])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.key, err)
+			}
+			b, err := encodeFixed(n, 3, f.resolution, true)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.key, err)
+			}
+			out = append(out, b...)
+		}
+		return out, nil
+	}
+
+	if len(t.axes) > 0 {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected x/y/z object")
+		}
+		n := t.size / len(t.axes)
+		var out []byte
+		for _, axis := range t.axes {
+			f, err := toFloat(m[axis])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", axis, err)
+			}
+			b, err := encodeFixed(f, n, t.resolution, t.signed)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", axis, err)
+			}
+			out = append(out, b...)
+		}
+		return out, nil
+	}
+
+	f, err := toFloat(v)
+	if err != nil {
+		return nil, err
+	}
+	return encodeFixed(f, t.size, t.resolution, t.signed)
+}
+
+// decodeFixed 解码大端定点数
+func decodeFixed(b []byte, resolution float64, signed bool) float64 {
+	var raw int64
+	for _, c := range b {
+		raw = raw<<8 | int64(c)
+	}
+	if signed && len(b) > 0 && b[0]&0x80 != 0 {
+		raw -= 1 << (8 * uint(len(b)))
+	}
+	return roundTo(float64(raw)*resolution, resolution)
+}
+
+// encodeFixed 编码为大端定点数
+func encodeFixed(v float64, size int, resolution float64, signed bool) ([]byte, error) {
+	raw := int64(math.Round(v / resolution))
+
+	bits := uint(8 * size)
+	min, max := int64(0), int64(1)<<bits-1
+	if signed {
+		min, max = -(int64(1) << (bits - 1)), int64(1)<<(bits-1)-1
+	}
+	if raw < min || raw > max {
+		return nil, fmt.Errorf("value %v out of range", v)
+	}
+
+	out := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		out[i] = byte(raw)
+		raw >>= 8
+	}
+	return out, nil
+}
+
+// roundTo 去掉定点换算带来的浮点误差
+func roundTo(v, resolution float64) float64 {
+	if resolution >= 1 {
+		return math.Round(v)
+	}
+	scale := math.Round(1 / resolution)
+	return math.Round(v*scale) / scale
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	case nil:
+		return 0, fmt.Errorf("missing value")
+	default:
+		return 0, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// EncodeObject 使用应用配置的 PayloadCodec 把下行对象编码为 FRMPayload；
+// 未使用内置编解码时执行应用的 PayloadEncoder 脚本
+func EncodeObject(payloadCodec, encoder string, fPort uint8, obj map[string]interface{}) ([]byte, error) {
+	switch {
+	case payloadCodec == CayenneLPP:
+		return EncodeCayenneLPP(obj)
+	case encoder != "":
+		return EncodeJavaScript(encoder, fPort, obj)
+	default:
+		return nil, fmt.Errorf("payload codec %q cannot encode objects", payloadCodec)
+	}
+}
+
+// DecodeObject 使用应用配置的 PayloadCodec 把上行 FRMPayload 解码为对象；
+// 未使用内置编解码时执行应用的 PayloadDecoder 脚本，两者都未配置时返回 nil
+func DecodeObject(payloadCodec, decoder string, fPort uint8, data []byte) (map[string]interface{}, error) {
+	switch {
+	case payloadCodec == CayenneLPP:
+		return DecodeCayenneLPP(data)
+	case decoder != "":
+		return DecodeJavaScript(decoder, fPort, data)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,114 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type obj = map[string]interface{}
+
+var lppGolden = []struct {
+	name string
+	hex  string
+	want obj
+}{
+	{"digital input", "000001", obj{"digitalInput": obj{"0": 1.0}}},
+	{"digital output", "010100", obj{"digitalOutput": obj{"1": 0.0}}},
+	{"analog input negative", "0202ff38", obj{"analogInput": obj{"2": -2.0}}},
+	{"analog output", "0303012c", obj{"analogOutput": obj{"3": 3.0}}},
+	{"illuminance", "046501f4", obj{"illuminanceSensor": obj{"4": 500.0}}},
+	{"presence", "056601", obj{"presenceSensor": obj{"5": 1.0}}},
+	{"temperature", "03670110", obj{"temperatureSensor": obj{"3": 27.2}}},
+	{"temperature negative", "0167ffd7", obj{"temperatureSensor": obj{"1": -4.1}}},
+	{"humidity", "066861", obj{"humiditySensor": obj{"6": 48.5}}},
+	{"accelerometer", "067104d2fb2e0000", obj{"accelerometer": obj{"6": obj{"x": 1.234, "y": -1.234, "z": 0.0}}}},
+	{"barometer", "0773277f", obj{"barometer": obj{"7": 1011.1}}},
+	{"gyrometer", "08860064ff9c0000", obj{"gyrometer": obj{"8": obj{"x": 1.0, "y": -1.0, "z": 0.0}}}},
+	{"gps", "018806765ff2960a0003e8", obj{"gpsLocation": obj{"1": obj{"latitude": 42.3519, "longitude": -87.9094, "altitude": 10.0}}}},
+	{"multiple channels", "03670110056700ff", obj{"temperatureSensor": obj{"3": 27.2, "5": 25.5}}},
+	{"empty", "", obj{}},
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeCayenneLPP(t *testing.T) {
+	for _, tt := range lppGolden {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCayenneLPP(decodeHex(t, tt.hex))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCayenneLPP(%s) = %v, want %v", tt.hex, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCayenneLPPInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"truncated header", "01"},
+		{"truncated value", "036701"},
+		{"truncated after valid entry", "0367011005"},
+		{"truncated gps", "018806765ff2960a00"},
+		{"unknown type", "01ff00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := DecodeCayenneLPP(decodeHex(t, tt.hex)); err == nil {
+				t.Errorf("DecodeCayenneLPP(%s) = %v, want error", tt.hex, got)
+			}
+		})
+	}
+}
+
+func TestEncodeCayenneLPP(t *testing.T) {
+	for _, tt := range lppGolden {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeCayenneLPP(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decodeHex(t, tt.hex); !bytes.Equal(got, want) {
+				t.Errorf("EncodeCayenneLPP(%v) = %x, want %x", tt.want, got, want)
+			}
+		})
+	}
+}
+
+func TestEncodeCayenneLPPInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  obj
+	}{
+		{"unknown type", obj{"windSpeed": obj{"1": 3.0}}},
+		{"not keyed by channel", obj{"temperatureSensor": 27.2}},
+		{"invalid channel", obj{"temperatureSensor": obj{"256": 27.2}}},
+		{"out of range", obj{"humiditySensor": obj{"1": 130.0}}},
+		{"negative unsigned", obj{"illuminanceSensor": obj{"1": -1.0}}},
+		{"missing axis", obj{"accelerometer": obj{"1": obj{"x": 1.0, "y": 1.0}}}},
+		{"unsupported value", obj{"presenceSensor": obj{"1": "yes"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := EncodeCayenneLPP(tt.obj); err == nil {
+				t.Errorf("EncodeCayenneLPP(%v) = %x, want error", tt.obj, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// scriptTimeout 单次编解码脚本的最长执行时间，超时中断脚本
+	scriptTimeout = 100 * time.Millisecond
+	// scriptMaxCallStack 脚本调用栈深度上限，防止无限递归
+	scriptMaxCallStack = 256
+)
+
+// DecodeJavaScript 执行应用 PayloadDecoder 脚本中的 Decode(bytes, fPort)，返回解码后的对象。
+// bytes 为数字数组；脚本须返回一个对象
+func DecodeJavaScript(script string, fPort uint8, data []byte) (map[string]interface{}, error) {
+	result, err := runScript(script, "Decode", func(vm *goja.Runtime) []goja.Value {
+		items := make([]interface{}, len(data))
+		for i, b := range data {
+			items[i] = int64(b)
+		}
+		return []goja.Value{vm.NewArray(items...), vm.ToValue(fPort)}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Decode must return an object, got %T", result)
+	}
+	return obj, nil
+}
+
+// EncodeJavaScript 执行应用 PayloadEncoder 脚本中的 Encode(object, fPort)，返回 FRMPayload。
+// 脚本须返回 0-255 的数字数组
+func EncodeJavaScript(script string, fPort uint8, obj map[string]interface{}) ([]byte, error) {
+	result, err := runScript(script, "Encode", func(vm *goja.Runtime) []goja.Value {
+		return []goja.Value{vm.ToValue(obj), vm.ToValue(fPort)}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Encode must return an array of bytes, got %T", result)
+	}
+	data := make([]byte, len(items))
+	for i, item := range items {
+		n, err := toFloat(item)
+		if err != nil || n < 0 || n > 255 || n != math.Trunc(n) {
+			return nil, fmt.Errorf("Encode result[%d]: %v is not a byte", i, item)
+		}
+		data[i] = byte(n)
+	}
+	return data, nil
+}
+
+// runScript 在独立的运行时中执行脚本并调用其中的函数 fn。每次调用使用新的运行时，脚本之间
+// 不共享状态，也没有文件、网络等宿主接口；超过 scriptTimeout 时中断
+func runScript(script, fn string, args func(vm *goja.Runtime) []goja.Value) (result interface{}, err error) {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(scriptMaxCallStack)
+
+	timer := time.AfterFunc(scriptTimeout, func() {
+		vm.Interrupt(fmt.Sprintf("script timeout after %s", scriptTimeout))
+	})
+	defer timer.Stop()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("script panic: %v", r)
+		}
+	}()
+
+	if _, err := vm.RunString(script); err != nil {
+		return nil, fmt.Errorf("run script: %w", err)
+	}
+
+	call, ok := goja.AssertFunction(vm.Get(fn))
+	if !ok {
+		return nil, fmt.Errorf("script does not define function %s", fn)
+	}
+	v, err := call(goja.Undefined(), args(vm)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, fmt.Errorf("%s returned no value", fn)
+	}
+	return v.Export(), nil
+}
@@ -1,14 +1,19 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log" // 添加这行
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
 
 // Config represents the application configuration
@@ -24,6 +29,9 @@ type Config struct {
 	Network  NetworkConfig  `yaml:"network"`
 	Gateway  GatewayConfig  `yaml:"gateway"`
 	CN470    CN470Config    `yaml:"cn470"` // 新增CN470配置
+	Metrics  MetricsConfig  `yaml:"metrics"`
+
+	Geolocation GeolocationConfig `yaml:"geolocation"`
 }
 
 // ServerConfig represents server configuration
@@ -41,8 +49,8 @@ type APIConfig struct {
 // WebConfig represents web UI configuration
 type WebConfig struct {
 	Host      string `yaml:"host"`
-	Port      int    `yaml:"port"`
-	StaticDir string `yaml:"static_dir"`
+	Port      int    `yaml:"port"`       // Web UI 端口，0 表示不单独提供 Web UI
+	StaticDir string `yaml:"static_dir"` // 单页应用目录，WEB_DIR 环境变量可覆盖
 }
 
 // DatabaseConfig represents database configuration
@@ -51,6 +59,27 @@ type DatabaseConfig struct {
 	MaxOpenConns    int           `yaml:"max_open_conns"`
 	MaxIdleConns    int           `yaml:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+
+	// 临时错误重试与熔断
+	MaxRetries       int           `yaml:"max_retries"`
+	RetryBackoff     time.Duration `yaml:"retry_backoff"`
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+
+	UplinkBatch UplinkBatchConfig `yaml:"uplink_batch"`
+}
+
+// UplinkBatchConfig 上行帧异步批量写入配置，默认关闭（同步写入）
+type UplinkBatchConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Size      int           `yaml:"size"`       // 达到多少条立即写入
+	Interval  time.Duration `yaml:"interval"`   // 最长缓冲时间
+	QueueSize int           `yaml:"queue_size"` // 缓冲队列长度，满时阻塞调用方
+}
+
+// MetricsConfig Prometheus 指标接口配置
+type MetricsConfig struct {
+	Addr string `yaml:"addr"` // /metrics 监听地址（如 ":9100"），为空不启动
 }
 
 // RedisConfig represents Redis configuration
@@ -67,8 +96,18 @@ type NATSConfig struct {
 	ClientID          string        `yaml:"client_id"`
 	Username          string        `yaml:"username"`
 	Password          string        `yaml:"password"`
+	Token             string        `yaml:"token"`
+	CredsFile         string        `yaml:"creds_file"` // NATS JWT 凭据文件（.creds）
+	NKeyFile          string        `yaml:"nkey_file"`  // NKey 种子文件
 	MaxReconnects     int           `yaml:"max_reconnects"`
 	ReconnectInterval time.Duration `yaml:"reconnect_interval"`
+
+	// 网络服务器上行订阅使用的队列组，多个实例配置相同的组时由 NATS 分摊上行
+	QueueGroup string `yaml:"queue_group"`
+
+	// 按服务（network-server / gateway-bridge / application-server）覆盖的凭据，
+	// 多租户共享 NATS 时每个服务或租户部署使用独立账号
+	Services map[string]NATSCredentials `yaml:"services"`
 }
 
 // JWTConfig represents JWT configuration
@@ -80,25 +119,292 @@ type JWTConfig struct {
 
 // LogConfig represents logging configuration
 type LogConfig struct {
-	Level  string `yaml:"level"`
-	Format string `yaml:"format"`
+	Level      string `yaml:"level"`
+	Format     string `yaml:"format"`
+	SampleRate uint32 `yaml:"sample_rate"` // 逐帧日志每 N 条输出 1 条，0 或 1 不采样
+
+	FrameLog FrameLogConfig `yaml:"frame_log"`
+}
+
+// Frame log sinks
+const (
+	FrameLogSinkFile     = "file"
+	FrameLogSinkDatabase = "database"
+)
+
+// FrameLogConfig 协议调试用的帧日志：逐帧记录原始 PHYPayload、方向、网关、频率、速率和处理结果，与应用日志分开
+type FrameLogConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Sink      string        `yaml:"sink"`       // file（默认）| database（frame_logs 表）
+	Dir       string        `yaml:"dir"`        // file 模式的目录，按天写 frames-YYYY-MM-DD.jsonl，默认 logs/frames
+	Retention time.Duration `yaml:"retention"`  // 保留时长，默认 72h
+	QueueSize int           `yaml:"queue_size"` // 写入队列长度，满时丢弃，默认 10000
 }
 
+// DefaultNetID 未配置 net_id 时使用的 NetID（类型 0，用于实验和私有网络）
+const DefaultNetID = "000000"
+
 // NetworkConfig represents network server configuration
 type NetworkConfig struct {
-	NetID               string        `yaml:"net_id"`
+	NetID               string        `yaml:"net_id"` // 6 位十六进制，JOIN ACCEPT 下发，DevAddr 按其 NwkID 前缀分配
 	DeduplicationWindow time.Duration `yaml:"deduplication_window"`
 	DeviceSessionTTL    time.Duration `yaml:"device_session_ttl"`
 	Band                string        `yaml:"band"`
 	ADREnabled          bool          `yaml:"adr_enabled"`
+
+	ReuseDevAddrOnRejoin bool `yaml:"reuse_dev_addr_on_rejoin"` // 重新入网时沿用设备原 DevAddr
+
+	// 按租户划分的 DevAddr 区间，入网时在设备所属租户的区间内分配；未配置区间的租户避开所有已分配区间
+	DevAddrRanges []DevAddrRange `yaml:"dev_addr_ranges"`
+
+	// 应用下行最长排队时间，超过后标记过期不再发送；0 表示不限制，设备配置文件可单独设置
+	MaxDownlinkQueueAge time.Duration `yaml:"max_downlink_queue_age"`
+
+	// 维护模式：暂停下行发送（仍接收上行），结束维护时发送暂存的下行
+	Maintenance         bool     `yaml:"maintenance"`          // 全局维护
+	MaintenanceGateways []string `yaml:"maintenance_gateways"` // 处于维护中的网关
+
+	// JOIN 首个副本到达后等待其他网关副本的时间，之后选择信号最好的网关发送 JOIN Accept；默认 200ms
+	JoinCollectWindow time.Duration `yaml:"join_collect_window"`
+
+	// JOIN Accept 的 RX2 发送策略: auto（默认，网关无法在 RX1 频率发送时改用 RX2）/ always（RX1 之外再发一次 RX2）/ off（只发 RX1）；设备配置文件可单独设置
+	JoinAcceptRX2 string `yaml:"join_accept_rx2"`
+
+	// 下行 LoRa 编码率（4/5、4/6、4/7、4/8），与上行无关；为空时沿用上行编码率，设备配置文件可单独设置
+	DownlinkCodeRate string `yaml:"downlink_code_rate"`
+
+	// 网关时间戳不可靠时的定时下行策略: immediate（默认，改为即时发送）/ rx2（即时发送到 RX2 频率）/ off
+	DownlinkTimingGate string `yaml:"downlink_timing_gate"`
+
+	// 网关时钟告警：时间戳漂移超过阈值或重置时发布事件
+	ClockAlerts         bool          `yaml:"clock_alerts"`
+	ClockDriftThreshold time.Duration `yaml:"clock_drift_threshold"` // 默认 500ms
+
+	// 带 FPort 但 FRMPayload 为空的上行（轮询/心跳）: forward（默认，标记 empty 后转发给应用）/ drop
+	EmptyPayloadUplinks string `yaml:"empty_payload_uplinks"`
+
+	// 确认下行等待设备 ACK 的时长，超时标记失败；应用 confirmedTimeout 非 0 时覆盖，0 表示不限时
+	ConfirmedDownlinkTimeout time.Duration `yaml:"confirmed_downlink_timeout"`
+
+	// 应用层时钟同步（FPort 202）：由网络服务器按网关 GPS 时间应答 AppTimeReq
+	AppClockSync bool `yaml:"app_clock_sync"`
+
+	// 每个上行都检查应用下行队列并在 RX 窗口发送，不必等待 MAC 命令或确认上行；受 mac.max_duty_cycle 限制
+	OpportunisticDownlink bool `yaml:"opportunistic_downlink"`
+
+	// 按下行速率的最大负载打包 MAC 命令和应用下行，放不下的顺延到后续下行并设置 FPending；关闭时 MAC 命令和应用下行分开发送
+	PackDownlinks bool `yaml:"pack_downlinks"`
+
+	// 调试日志中列出下行候选网关的 RSSI/SNR 和选择原因
+	GatewaySelectionLog bool `yaml:"gateway_selection_log"`
+
+	// 每个设备每分钟最多处理的上行数（去重之后），超出的丢弃并记录事件；设备配置文件可单独设置，0 表示不限制
+	MaxUplinksPerMinute int `yaml:"max_uplinks_per_minute"`
+
+	// 重放检查（DevNonce、帧计数器）的布隆过滤器快速路径，确定没见过的键不再查询数据库
+	ReplayFilter ReplayFilterConfig `yaml:"replay_filter"`
+}
+
+// ReplayFilterConfig 重放检查布隆过滤器配置，默认关闭（每次都查询数据库）
+type ReplayFilterConfig struct {
+	Enabled           bool    `yaml:"enabled"`
+	Entries           int     `yaml:"entries"`             // 预计键数，默认 1000000
+	FalsePositiveRate float64 `yaml:"false_positive_rate"` // 误判率，误判时回退到数据库查询，默认 0.001
 }
 
 // GatewayConfig represents gateway bridge configuration
 type GatewayConfig struct {
 	UDPBind       string        `yaml:"udp_bind"`
+	UDPBinds      []string      `yaml:"udp_binds"` // 多个监听地址，配置后忽略 udp_bind
 	StatsInterval time.Duration `yaml:"stats_interval"`
 	PingInterval  time.Duration `yaml:"ping_interval"`
 	PushTimeout   time.Duration `yaml:"push_timeout"`
+
+	// 超过此时间没有收到网关数据视为离线，默认 5m
+	OfflineTimeout time.Duration `yaml:"offline_timeout"`
+
+	DropOversizedFrames bool `yaml:"drop_oversized_frames"` // 丢弃超过频段最大长度的上行帧
+
+	// stat 上报的集中器温度超过此值（℃）时告警，0 表示不告警
+	TempAlertThreshold float64 `yaml:"temp_alert_threshold"`
+
+	// NATS 主题和消息中网关 ID 的格式: lower（默认）| upper | colon；下行请求接受任意格式
+	IDFormat string `yaml:"id_format"`
+
+	// context 模式定时下行的时间余量，可按网关ID覆盖
+	DownlinkTiming DownlinkTimingConfig `yaml:"downlink_timing"`
+
+	// 未注册网关的自动注册；未启用时丢弃未注册网关的数据
+	AutoRegister GatewayAutoRegisterConfig `yaml:"auto_register"`
+
+	// 停止时等待进行中的下行发送完成的最长时间，默认 10s
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DownlinkTimingConfig context 模式定时下行的时间余量
+type DownlinkTimingConfig struct {
+	MinPrepareTime    time.Duration `yaml:"min_prepare_time"`   // 下行距上行的最小准备时间，默认 200ms
+	MinSafeDelay      time.Duration `yaml:"min_safe_delay"`     // 计数器回绕后允许的最小时间戳，默认 50ms
+	OverflowThreshold uint32        `yaml:"overflow_threshold"` // 上行时间戳超过此值改用即时发送，默认 4000000000
+
+	Gateways map[string]DownlinkTimingConfig `yaml:"gateways"` // 按网关ID覆盖，未设置的字段沿用全局值
+}
+
+// 定时下行余量的合理范围
+const (
+	maxMinPrepareTime        = 2 * time.Second
+	maxMinSafeDelay          = time.Second
+	minOverflowThreshold     = uint32(1 << 31)
+	defaultOverflowThreshold = uint32(4000000000)
+)
+
+// ForGateway 返回网关生效的时间余量：默认值 <- 全局配置 <- 网关覆盖
+func (t DownlinkTimingConfig) ForGateway(gatewayID string) DownlinkTimingConfig {
+	effective := DownlinkTimingConfig{
+		MinPrepareTime:    200 * time.Millisecond,
+		MinSafeDelay:      50 * time.Millisecond,
+		OverflowThreshold: defaultOverflowThreshold,
+	}
+	effective.merge(t)
+	if o, ok := t.Gateways[strings.ToLower(gatewayID)]; ok {
+		effective.merge(o)
+	}
+	return effective
+}
+
+// merge 用 o 中设置的字段覆盖 t
+func (t *DownlinkTimingConfig) merge(o DownlinkTimingConfig) {
+	if o.MinPrepareTime != 0 {
+		t.MinPrepareTime = o.MinPrepareTime
+	}
+	if o.MinSafeDelay != 0 {
+		t.MinSafeDelay = o.MinSafeDelay
+	}
+	if o.OverflowThreshold != 0 {
+		t.OverflowThreshold = o.OverflowThreshold
+	}
+}
+
+// validate 检查余量范围，网关ID统一为小写
+func (t *DownlinkTimingConfig) validate() error {
+	check := func(name string, c DownlinkTimingConfig) error {
+		if c.MinPrepareTime < 0 || c.MinPrepareTime > maxMinPrepareTime {
+			return fmt.Errorf("%s: min_prepare_time must be between 0 and %s", name, maxMinPrepareTime)
+		}
+		if c.MinSafeDelay < 0 || c.MinSafeDelay > maxMinSafeDelay {
+			return fmt.Errorf("%s: min_safe_delay must be between 0 and %s", name, maxMinSafeDelay)
+		}
+		if c.OverflowThreshold != 0 && c.OverflowThreshold < minOverflowThreshold {
+			return fmt.Errorf("%s: overflow_threshold must be at least %d", name, minOverflowThreshold)
+		}
+		return nil
+	}
+
+	if err := check("downlink_timing", *t); err != nil {
+		return err
+	}
+
+	gateways := make(map[string]DownlinkTimingConfig, len(t.Gateways))
+	for id, o := range t.Gateways {
+		if len(o.Gateways) > 0 {
+			return fmt.Errorf("downlink_timing.gateways.%s: nested gateways not allowed", id)
+		}
+		if err := check("downlink_timing.gateways."+id, o); err != nil {
+			return err
+		}
+		gateways[strings.ToLower(id)] = o
+	}
+	t.Gateways = gateways
+
+	return nil
+}
+
+// GatewayAutoRegisterConfig 未注册网关的自动注册
+type GatewayAutoRegisterConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	TenantID      string   `yaml:"tenant_id"`      // 自动注册的网关所属租户，启用时必填
+	AllowPrefixes []string `yaml:"allow_prefixes"` // 允许自动注册的网关 ID 前缀（十六进制），为空不限制
+}
+
+// Allows 网关是否允许自动注册，gatewayID 为 16 位十六进制
+func (a GatewayAutoRegisterConfig) Allows(gatewayID string) bool {
+	if !a.Enabled {
+		return false
+	}
+	if len(a.AllowPrefixes) == 0 {
+		return true
+	}
+	gatewayID = strings.ToLower(gatewayID)
+	for _, prefix := range a.AllowPrefixes {
+		if strings.HasPrefix(gatewayID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 校验租户 ID 和前缀，前缀统一为小写且去掉分隔符
+func (a *GatewayAutoRegisterConfig) validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if _, err := uuid.Parse(a.TenantID); err != nil {
+		return fmt.Errorf("auto_register: tenant_id must be a tenant UUID")
+	}
+
+	prefixes := make([]string, 0, len(a.AllowPrefixes))
+	for _, prefix := range a.AllowPrefixes {
+		p := strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(prefix))
+		if _, err := hex.DecodeString(p + strings.Repeat("0", len(p)%2)); err != nil || p == "" || len(p) > 16 {
+			return fmt.Errorf("auto_register: invalid allow_prefixes entry %q", prefix)
+		}
+		prefixes = append(prefixes, p)
+	}
+	a.AllowPrefixes = prefixes
+
+	return nil
+}
+
+// GeolocationConfig 设备定位配置
+type GeolocationConfig struct {
+	MaxFrames int                         `yaml:"max_frames"` // 参与定位的最近上行帧数
+	Default   GeolocatorConfig            `yaml:"default"`
+	Tenants   map[string]GeolocatorConfig `yaml:"tenants"` // 按租户ID覆盖
+}
+
+// GeolocatorConfig 定位解析器配置
+type GeolocatorConfig struct {
+	Type    string        `yaml:"type"` // rssi_centroid | http
+	URL     string        `yaml:"url"`
+	Token   string        `yaml:"token"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// BindAddresses 返回网关桥需要监听的全部 UDP 地址
+func (g *GatewayConfig) BindAddresses() []string {
+	if len(g.UDPBinds) > 0 {
+		return g.UDPBinds
+	}
+	if g.UDPBind != "" {
+		return []string{g.UDPBind}
+	}
+	return []string{"0.0.0.0:1700"}
+}
+
+// OfflineAfter 返回判定网关离线的时间
+func (g *GatewayConfig) OfflineAfter() time.Duration {
+	if g.OfflineTimeout > 0 {
+		return g.OfflineTimeout
+	}
+	return 5 * time.Minute
+}
+
+// ShutdownAfter 返回停止时等待进行中的下行发送完成的最长时间
+func (g *GatewayConfig) ShutdownAfter() time.Duration {
+	if g.ShutdownTimeout > 0 {
+		return g.ShutdownTimeout
+	}
+	return 10 * time.Second
 }
 
 // === 新增CN470相关配置结构 ===
@@ -156,7 +462,7 @@ type CN470TDD struct {
 
 // CN470RXWindows RX窗口配置
 type CN470RXWindows struct {
-	RX1Delay         int    `yaml:"rx1_delay"`          // RX1延迟（秒）
+	RX1Delay         int    `yaml:"rx1_delay"`          // 数据下行RX1延迟（秒），JOIN ACCEPT 的 RxDelay 取此值
 	RX2Delay         int    `yaml:"rx2_delay"`          // RX2延迟（秒）
 	JoinAcceptDelay1 int    `yaml:"join_accept_delay1"` // JOIN ACCEPT RX1延迟（秒）
 	JoinAcceptDelay2 int    `yaml:"join_accept_delay2"` // JOIN ACCEPT RX2延迟（秒）
@@ -172,6 +478,7 @@ type CN470Channels struct {
 	ChannelSpacing       uint32 `yaml:"channel_spacing"`
 	ChannelHopping       bool   `yaml:"channel_hopping"`
 	EnabledSubBands      []int  `yaml:"enabled_sub_bands"`
+	CFListChannels       int    `yaml:"cflist_channels"` // JOIN ACCEPT CFList 下发的信道数（1-5，默认5）
 }
 
 // CN470ADR ADR配置
@@ -193,6 +500,12 @@ type CN470MAC struct {
 	SupportsJoin        bool `yaml:"supports_join"`
 	SupportsClassB      bool `yaml:"supports_class_b"`
 	SupportsClassC      bool `yaml:"supports_class_c"`
+
+	// Class B 信标和 ping slot 的频率（Hz）与数据速率；信标频率为 0 时使用 RX2 频率，ping slot 频率为 0 时使用信标频率
+	BeaconFrequency   uint32 `yaml:"beacon_frequency"`
+	BeaconDataRate    int    `yaml:"beacon_data_rate"`
+	PingSlotFrequency uint32 `yaml:"ping_slot_frequency"`
+	PingSlotDataRate  int    `yaml:"ping_slot_data_rate"`
 }
 
 // === CN470配置方法 ===
@@ -286,6 +599,38 @@ func Load(filename string) (*Config, error) {
 		return nil, fmt.Errorf("CN470 config validation failed: %w", err)
 	}
 
+	if err := cfg.Gateway.DownlinkTiming.validate(); err != nil {
+		return nil, fmt.Errorf("gateway config validation failed: %w", err)
+	}
+	if !lorawan.ValidGatewayIDFormat(cfg.Gateway.IDFormat) {
+		return nil, fmt.Errorf("gateway config validation failed: unknown id_format %q", cfg.Gateway.IDFormat)
+	}
+	if err := cfg.Gateway.AutoRegister.validate(); err != nil {
+		return nil, fmt.Errorf("gateway config validation failed: %w", err)
+	}
+
+	if cfg.Network.NetID == "" {
+		cfg.Network.NetID = DefaultNetID
+	}
+	netID, err := lorawan.ParseNetID(cfg.Network.NetID)
+	if err != nil {
+		return nil, fmt.Errorf("network config validation failed: %w", err)
+	}
+	if err := validateDevAddrRanges(cfg.Network.DevAddrRanges, netID); err != nil {
+		return nil, fmt.Errorf("network config validation failed: %w", err)
+	}
+	switch cfg.Log.FrameLog.Sink {
+	case "", FrameLogSinkFile, FrameLogSinkDatabase:
+	default:
+		return nil, fmt.Errorf("log config validation failed: unknown frame_log sink %q", cfg.Log.FrameLog.Sink)
+	}
+	if cfg.Network.ReplayFilter.FalsePositiveRate < 0 || cfg.Network.ReplayFilter.FalsePositiveRate >= 1 {
+		return nil, fmt.Errorf("network config validation failed: replay_filter.false_positive_rate must be in [0, 1)")
+	}
+	if cfg.Network.DownlinkCodeRate != "" && !lorawan.ValidCodeRate(cfg.Network.DownlinkCodeRate) {
+		return nil, fmt.Errorf("network config validation failed: invalid downlink_code_rate %q", cfg.Network.DownlinkCodeRate)
+	}
+
 	return &cfg, nil
 }
 
@@ -506,6 +851,7 @@ func (c *Config) PrintConfigSummary() {
 	fmt.Printf("=== LoRaWAN Server Configuration ===\n")
 	fmt.Printf("Server: %s v%s\n", c.Server.Name, c.Server.Version)
 	fmt.Printf("Network Band: %s\n", c.Network.Band)
+	fmt.Printf("NetID: %s\n", c.Network.NetID)
 
 	if c.Network.Band == "CN470" {
 		fmt.Printf("CN470 Mode: %s\n", c.CN470.GetCN470Mode())
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGatewayConfigBindAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  GatewayConfig
+		want []string
+	}{
+		{"default", GatewayConfig{}, []string{"0.0.0.0:1700"}},
+		{"single", GatewayConfig{UDPBind: "127.0.0.1:1700"}, []string{"127.0.0.1:1700"}},
+		{
+			"list overrides single",
+			GatewayConfig{UDPBind: "127.0.0.1:1700", UDPBinds: []string{"0.0.0.0:1700", "[::]:1700"}},
+			[]string{"0.0.0.0:1700", "[::]:1700"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.BindAddresses(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BindAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownlinkTimingForGateway(t *testing.T) {
+	cfg := DownlinkTimingConfig{
+		MinPrepareTime: 300 * time.Millisecond,
+		Gateways: map[string]DownlinkTimingConfig{
+			"0102030405060708": {MinSafeDelay: 10 * time.Millisecond, OverflowThreshold: 4200000000},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     DownlinkTimingConfig
+		gateway string
+		want    DownlinkTimingConfig
+	}{
+		{"defaults", DownlinkTimingConfig{}, "0102030405060708",
+			DownlinkTimingConfig{MinPrepareTime: 200 * time.Millisecond, MinSafeDelay: 50 * time.Millisecond, OverflowThreshold: 4000000000}},
+		{"global", cfg, "aabbccddeeff0011",
+			DownlinkTimingConfig{MinPrepareTime: 300 * time.Millisecond, MinSafeDelay: 50 * time.Millisecond, OverflowThreshold: 4000000000}},
+		{"gateway override", cfg, "0102030405060708",
+			DownlinkTimingConfig{MinPrepareTime: 300 * time.Millisecond, MinSafeDelay: 10 * time.Millisecond, OverflowThreshold: 4200000000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.ForGateway(tt.gateway); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForGateway(%q) = %+v, want %+v", tt.gateway, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownlinkTimingValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DownlinkTimingConfig
+		wantErr bool
+	}{
+		{"unset", DownlinkTimingConfig{}, false},
+		{"in range", DownlinkTimingConfig{MinPrepareTime: 2 * time.Second, MinSafeDelay: time.Second, OverflowThreshold: 1 << 31}, false},
+		{"negative prepare time", DownlinkTimingConfig{MinPrepareTime: -time.Millisecond}, true},
+		{"prepare time too long", DownlinkTimingConfig{MinPrepareTime: 3 * time.Second}, true},
+		{"safe delay too long", DownlinkTimingConfig{MinSafeDelay: 2 * time.Second}, true},
+		{"threshold too low", DownlinkTimingConfig{OverflowThreshold: 1000}, true},
+		{"invalid gateway override", DownlinkTimingConfig{Gateways: map[string]DownlinkTimingConfig{
+			"0102030405060708": {MinSafeDelay: 2 * time.Second},
+		}}, true},
+		{"nested gateways", DownlinkTimingConfig{Gateways: map[string]DownlinkTimingConfig{
+			"0102030405060708": {Gateways: map[string]DownlinkTimingConfig{"aa": {}}},
+		}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownlinkTimingGatewayIDCaseInsensitive(t *testing.T) {
+	cfg := DownlinkTimingConfig{Gateways: map[string]DownlinkTimingConfig{
+		"AABBCCDDEEFF0011": {MinPrepareTime: 500 * time.Millisecond},
+	}}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"aabbccddeeff0011", "AABBCCDDEEFF0011"} {
+		if got := cfg.ForGateway(id).MinPrepareTime; got != 500*time.Millisecond {
+			t.Errorf("ForGateway(%q).MinPrepareTime = %s, want 500ms", id, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// DevAddrRange 分配给某个租户的 DevAddr 区间（含两端），十六进制 8 位
+type DevAddrRange struct {
+	TenantID string `yaml:"tenant_id"`
+	Start    string `yaml:"start"`
+	End      string `yaml:"end"`
+}
+
+// Bounds 解析区间的起止地址
+func (r DevAddrRange) Bounds() (start, end uint32, err error) {
+	if start, err = parseDevAddr(r.Start); err != nil {
+		return 0, 0, fmt.Errorf("start: %w", err)
+	}
+	if end, err = parseDevAddr(r.End); err != nil {
+		return 0, 0, fmt.Errorf("end: %w", err)
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("start %s is after end %s", r.Start, r.End)
+	}
+	return start, end, nil
+}
+
+func parseDevAddr(s string) (uint32, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return 0, fmt.Errorf("invalid DevAddr %q", s)
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// validateDevAddrRanges 每个租户最多一个区间，区间之间不能重叠，且都在 NetID 的地址前缀内
+func validateDevAddrRanges(ranges []DevAddrRange, netID lorawan.NetID) error {
+	prefix, mask := netID.DevAddrPrefix()
+
+	type bounds struct {
+		start, end uint32
+		tenant     string
+	}
+	parsed := make([]bounds, 0, len(ranges))
+	tenants := make(map[uuid.UUID]bool, len(ranges))
+
+	for i, r := range ranges {
+		tenantID, err := uuid.Parse(r.TenantID)
+		if err != nil {
+			return fmt.Errorf("dev_addr_ranges[%d]: invalid tenant_id %q", i, r.TenantID)
+		}
+		if tenants[tenantID] {
+			return fmt.Errorf("dev_addr_ranges[%d]: tenant %s has more than one range", i, tenantID)
+		}
+		tenants[tenantID] = true
+
+		start, end, err := r.Bounds()
+		if err != nil {
+			return fmt.Errorf("dev_addr_ranges[%d]: %w", i, err)
+		}
+		if start&mask != prefix || end&mask != prefix {
+			return fmt.Errorf("dev_addr_ranges[%d]: range is outside the DevAddr prefix %08x/%d of NetID %s",
+				i, prefix, bits.OnesCount32(mask), netID)
+		}
+		parsed = append(parsed, bounds{start: start, end: end, tenant: r.TenantID})
+	}
+
+	sort.Slice(parsed, func(i, j int) bool { return parsed[i].start < parsed[j].start })
+	for i := 1; i < len(parsed); i++ {
+		if parsed[i].start <= parsed[i-1].end {
+			return fmt.Errorf("dev_addr_ranges of tenants %s and %s overlap", parsed[i-1].tenant, parsed[i].tenant)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestValidateDevAddrRanges(t *testing.T) {
+	const (
+		tenantA = "11111111-1111-1111-1111-111111111111"
+		tenantB = "22222222-2222-2222-2222-222222222222"
+	)
+
+	tests := []struct {
+		name    string
+		ranges  []DevAddrRange
+		netID   lorawan.NetID
+		wantErr bool
+	}{
+		{"none", nil, lorawan.NetID{}, false},
+		{"adjacent", []DevAddrRange{
+			{TenantID: tenantA, Start: "01000000", End: "010000ff"},
+			{TenantID: tenantB, Start: "01000100", End: "01ffffff"},
+		}, lorawan.NetID{}, false},
+		{"overlap", []DevAddrRange{
+			{TenantID: tenantA, Start: "01000000", End: "01000100"},
+			{TenantID: tenantB, Start: "01000100", End: "01ffffff"},
+		}, lorawan.NetID{}, true},
+		{"contained", []DevAddrRange{
+			{TenantID: tenantB, Start: "01000010", End: "01000020"},
+			{TenantID: tenantA, Start: "01000000", End: "010000ff"},
+		}, lorawan.NetID{}, true},
+		{"tenant with two ranges", []DevAddrRange{
+			{TenantID: tenantA, Start: "01000000", End: "010000ff"},
+			{TenantID: tenantA, Start: "01000100", End: "010001ff"},
+		}, lorawan.NetID{}, true},
+		{"invalid tenant", []DevAddrRange{{TenantID: "tenant", Start: "01000000", End: "010000ff"}}, lorawan.NetID{}, true},
+		{"invalid address", []DevAddrRange{{TenantID: tenantA, Start: "010000", End: "010000ff"}}, lorawan.NetID{}, true},
+		{"start after end", []DevAddrRange{{TenantID: tenantA, Start: "010000ff", End: "01000000"}}, lorawan.NetID{}, true},
+		{"outside NetID prefix", []DevAddrRange{{TenantID: tenantA, Start: "01000000", End: "02000000"}}, lorawan.NetID{}, true},
+		{"inside type 1 prefix", []DevAddrRange{{TenantID: tenantA, Start: "80000000", End: "800000ff"}}, lorawan.NetID{0x20, 0x00, 0x00}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDevAddrRanges(tt.ranges, tt.netID); (err != nil) != tt.wantErr {
+				t.Errorf("validateDevAddrRanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
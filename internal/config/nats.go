@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// 各服务在 nats.services 中的名称
+const (
+	ServiceNetworkServer     = "network-server"
+	ServiceGatewayBridge     = "gateway-bridge"
+	ServiceApplicationServer = "application-server"
+)
+
+// NATSCredentials NATS 连接凭据，优先级 creds_file > nkey_file > token > username/password
+type NATSCredentials struct {
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	Token     string `yaml:"token"`
+	CredsFile string `yaml:"creds_file"`
+	NKeyFile  string `yaml:"nkey_file"`
+}
+
+func (c NATSCredentials) empty() bool {
+	return c == NATSCredentials{}
+}
+
+// CredentialsFor 返回服务使用的凭据：nats.services 中配置了该服务时整体替换全局凭据
+func (c NATSConfig) CredentialsFor(service string) NATSCredentials {
+	if creds, ok := c.Services[service]; ok && !creds.empty() {
+		return creds
+	}
+	return NATSCredentials{
+		Username:  c.Username,
+		Password:  c.Password,
+		Token:     c.Token,
+		CredsFile: c.CredsFile,
+		NKeyFile:  c.NKeyFile,
+	}
+}
+
+// AuthOptions 返回服务连接 NATS 的认证选项，没有配置凭据时为空
+func (c NATSConfig) AuthOptions(service string) ([]nats.Option, error) {
+	creds := c.CredentialsFor(service)
+
+	switch {
+	case creds.CredsFile != "":
+		return []nats.Option{nats.UserCredentials(creds.CredsFile)}, nil
+	case creds.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(creds.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("nats nkey_file: %w", err)
+		}
+		return []nats.Option{opt}, nil
+	case creds.Token != "":
+		return []nats.Option{nats.Token(creds.Token)}, nil
+	case creds.Username != "":
+		return []nats.Option{nats.UserInfo(creds.Username, creds.Password)}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+)
+
+func TestNATSCredentialsFor(t *testing.T) {
+	cfg := NATSConfig{
+		Username: "shared",
+		Password: "shared-pass",
+		Services: map[string]NATSCredentials{
+			ServiceNetworkServer: {Token: "ns-token"},
+			ServiceGatewayBridge: {},
+		},
+	}
+
+	tests := []struct {
+		service string
+		want    NATSCredentials
+	}{
+		{ServiceNetworkServer, NATSCredentials{Token: "ns-token"}},
+		{ServiceGatewayBridge, NATSCredentials{Username: "shared", Password: "shared-pass"}},
+		{ServiceApplicationServer, NATSCredentials{Username: "shared", Password: "shared-pass"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			if got := cfg.CredentialsFor(tt.service); got != tt.want {
+				t.Errorf("CredentialsFor(%q) = %+v, want %+v", tt.service, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNATSAuthOptionsConnect(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      NATSConfig
+		service  string
+		wantUser string
+		wantPass string
+		wantTok  string
+	}{
+		{"no credentials", NATSConfig{}, ServiceNetworkServer, "", "", ""},
+		{"global user", NATSConfig{Username: "lorawan", Password: "secret"}, ServiceNetworkServer, "lorawan", "secret", ""},
+		{"global token", NATSConfig{Token: "t0ken"}, ServiceGatewayBridge, "", "", "t0ken"},
+		{"token wins over user", NATSConfig{Username: "lorawan", Password: "secret", Token: "t0ken"}, ServiceGatewayBridge, "", "", "t0ken"},
+		{
+			"per-service credentials",
+			NATSConfig{
+				Username: "shared",
+				Password: "shared-pass",
+				Services: map[string]NATSCredentials{
+					ServiceApplicationServer: {Username: "tenant-a", Password: "tenant-a-pass"},
+				},
+			},
+			ServiceApplicationServer, "tenant-a", "tenant-a-pass", "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.cfg.AuthOptions(tt.service)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv := natstest.Run(t)
+			srv.Conn(t, opts...).Flush()
+
+			connects := srv.Connects()
+			if len(connects) != 1 {
+				t.Fatalf("got %d CONNECTs, want 1", len(connects))
+			}
+			got := connects[0]
+			if got.User != tt.wantUser || got.Pass != tt.wantPass || got.AuthToken != tt.wantTok {
+				t.Errorf("CONNECT = %+v, want user %q pass %q token %q", got, tt.wantUser, tt.wantPass, tt.wantTok)
+			}
+		})
+	}
+}
+
+func TestNATSAuthOptionsFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		creds    NATSCredentials
+		wantOpts int
+		wantErr  bool
+	}{
+		{"creds file", NATSCredentials{CredsFile: "/etc/nats/ns.creds", Token: "ignored"}, 1, false},
+		{"missing nkey seed", NATSCredentials{NKeyFile: filepath.Join(t.TempDir(), "missing.nk")}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NATSConfig{Services: map[string]NATSCredentials{ServiceNetworkServer: tt.creds}}
+			opts, err := cfg.AuthOptions(ServiceNetworkServer)
+			if (err != nil) != tt.wantErr || len(opts) != tt.wantOpts {
+				t.Errorf("AuthOptions() = %d options, %v, want %d, wantErr %v", len(opts), err, tt.wantOpts, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Package framelog 协议调试用的帧日志：逐帧记录上行和下行的原始 PHYPayload 与处理结果，
+// 写入独立的文件或 frame_logs 表，与应用日志分开并按保留时长清理
+package framelog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+const (
+	defaultDir       = "logs/frames"
+	defaultRetention = 72 * time.Hour
+	defaultQueueSize = 10000
+
+	batchSize     = 100
+	flushInterval = time.Second
+	pruneInterval = time.Hour
+)
+
+// Sink 帧日志的存储位置
+type Sink interface {
+	Write(ctx context.Context, records []*models.FrameLog) error
+	Prune(ctx context.Context, before time.Time) error
+	Close() error
+}
+
+// Logger 异步写入帧日志，队列满时丢弃记录，不阻塞帧处理
+type Logger struct {
+	sink      Sink
+	retention time.Duration
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan *models.FrameLog
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// New 按配置创建帧日志，未启用时返回 nil（nil Logger 的方法都是空操作）
+func New(cfg config.FrameLogConfig, store storage.Store) (*Logger, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var sink Sink
+	switch cfg.Sink {
+	case "", config.FrameLogSinkFile:
+		dir := cfg.Dir
+		if dir == "" {
+			dir = defaultDir
+		}
+		fileSink, err := NewFileSink(dir)
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	case config.FrameLogSinkDatabase:
+		sink = NewStoreSink(store)
+	default:
+		return nil, fmt.Errorf("unknown frame log sink %q", cfg.Sink)
+	}
+
+	return NewLogger(sink, cfg.Retention, cfg.QueueSize), nil
+}
+
+// NewLogger 创建写入 sink 的帧日志并启动写入协程
+func NewLogger(sink Sink, retention time.Duration, queueSize int) *Logger {
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	l := &Logger{
+		sink:      sink,
+		retention: retention,
+		queue:     make(chan *models.FrameLog, queueSize),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Log 记录一帧
+func (l *Logger) Log(rec *models.FrameLog) {
+	if l == nil {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+
+	select {
+	case l.queue <- rec:
+	default:
+		if l.dropped.Add(1)%1000 == 1 {
+			log.Warn().Uint64("dropped", l.dropped.Load()).Msg("帧日志队列已满，丢弃记录")
+		}
+	}
+}
+
+// Close 停止记录，写完队列中的记录后关闭 sink
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+
+	<-l.done
+	return l.sink.Close()
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+
+	l.prune()
+
+	batch := make([]*models.FrameLog, 0, batchSize)
+	for {
+		select {
+		case rec, ok := <-l.queue:
+			if !ok {
+				l.write(batch)
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= batchSize {
+				l.write(batch)
+				batch = batch[:0]
+			}
+		case <-flush.C:
+			if len(batch) > 0 {
+				l.write(batch)
+				batch = batch[:0]
+			}
+		case <-prune.C:
+			l.prune()
+		}
+	}
+}
+
+func (l *Logger) write(batch []*models.FrameLog) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := l.sink.Write(ctx, batch); err != nil {
+		log.Error().Err(err).Int("frames", len(batch)).Msg("写入帧日志失败")
+	}
+}
+
+func (l *Logger) prune() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := l.sink.Prune(ctx, time.Now().Add(-l.retention)); err != nil {
+		log.Error().Err(err).Msg("清理过期帧日志失败")
+	}
+}
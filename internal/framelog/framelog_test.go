@@ -0,0 +1,206 @@
+package framelog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// memorySink 在内存中记录写入的帧
+type memorySink struct {
+	mu      sync.Mutex
+	records []*models.FrameLog
+	pruned  []time.Time
+	closed  bool
+}
+
+func (s *memorySink) Write(ctx context.Context, records []*models.FrameLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *memorySink) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruned = append(s.pruned, before)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.FrameLogConfig
+		wantSink interface{}
+		wantErr  bool
+	}{
+		{"disabled", config.FrameLogConfig{Sink: config.FrameLogSinkDatabase}, nil, false},
+		{"default file sink", config.FrameLogConfig{Enabled: true}, &FileSink{}, false},
+		{"file sink", config.FrameLogConfig{Enabled: true, Sink: config.FrameLogSinkFile}, &FileSink{}, false},
+		{"database sink", config.FrameLogConfig{Enabled: true, Sink: config.FrameLogSinkDatabase}, &StoreSink{}, false},
+		{"unknown sink", config.FrameLogConfig{Enabled: true, Sink: "syslog"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Dir = t.TempDir()
+			l, err := New(cfg, storagetest.New())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantSink == nil {
+				if l != nil {
+					t.Errorf("New() = %+v, want nil", l)
+				}
+				return
+			}
+			defer l.Close()
+			if got, want := reflect.TypeOf(l.sink), reflect.TypeOf(tt.wantSink); got != want {
+				t.Errorf("sink = %s, want %s", got, want)
+			}
+			if l.retention != defaultRetention || cap(l.queue) != defaultQueueSize {
+				t.Errorf("retention %s queue %d, want defaults", l.retention, cap(l.queue))
+			}
+		})
+	}
+}
+
+func TestLoggerWritesFrames(t *testing.T) {
+	sink := &memorySink{}
+	l := NewLogger(sink, time.Hour, 0)
+
+	// 超过一批的记录分批写入
+	for i := 0; i < batchSize+5; i++ {
+		l.Log(&models.FrameLog{Direction: models.FrameDirectionUplink, GatewayID: "gw", Result: "ok"})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 关闭后的记录丢弃
+	l.Log(&models.FrameLog{Direction: models.FrameDirectionDownlink})
+
+	if len(sink.records) != batchSize+5 {
+		t.Fatalf("%d frames written, want %d", len(sink.records), batchSize+5)
+	}
+	for _, rec := range sink.records {
+		if rec.Time.IsZero() || rec.Direction != models.FrameDirectionUplink {
+			t.Fatalf("frame = %+v", rec)
+		}
+	}
+	if !sink.closed {
+		t.Error("sink not closed")
+	}
+	// 启动时按保留时长清理一次
+	if len(sink.pruned) != 1 || time.Since(sink.pruned[0]) < time.Hour-time.Minute {
+		t.Errorf("pruned before %v, want about an hour ago", sink.pruned)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Log(&models.FrameLog{})
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(filepath.Join(dir, "frames"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -5)
+	records := []*models.FrameLog{
+		{Time: old, Direction: models.FrameDirectionUplink, PHYPayload: "40"},
+		{Time: now, Direction: models.FrameDirectionUplink, PHYPayload: "41", TraceID: "0123456789abcdef"},
+		{Time: now, Direction: models.FrameDirectionDownlink, PHYPayload: "60"},
+	}
+	if err := sink.Write(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每天一个 JSON Lines 文件
+	oldFile := filepath.Join(dir, "frames", "frames-"+old.Format(fileDateLayout)+".jsonl")
+	todayFile := filepath.Join(dir, "frames", "frames-"+now.Format(fileDateLayout)+".jsonl")
+	if got := readFrames(t, oldFile); len(got) != 1 || got[0].PHYPayload != "40" {
+		t.Errorf("%s = %+v", oldFile, got)
+	}
+	got := readFrames(t, todayFile)
+	if len(got) != 2 || got[0].PHYPayload != "41" || got[0].TraceID != "0123456789abcdef" || got[1].Direction != models.FrameDirectionDownlink {
+		t.Errorf("%s = %+v", todayFile, got)
+	}
+
+	// 只删除超过保留时长的文件
+	if err := sink.Prune(context.Background(), now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "frames", "*.jsonl"))
+	sort.Strings(matches)
+	if len(matches) != 1 || matches[0] != todayFile {
+		t.Errorf("files after prune = %v, want %s", matches, todayFile)
+	}
+}
+
+func readFrames(t *testing.T, file string) []models.FrameLog {
+	t.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var frames []models.FrameLog
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec models.FrameLog
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		frames = append(frames, rec)
+	}
+	return frames
+}
+
+func TestStoreSink(t *testing.T) {
+	store := storagetest.New()
+	sink := NewStoreSink(store)
+	ctx := context.Background()
+
+	now := time.Now()
+	records := []*models.FrameLog{
+		{Time: now.Add(-100 * time.Hour), Direction: models.FrameDirectionUplink},
+		{Time: now, Direction: models.FrameDirectionDownlink},
+	}
+	if err := sink.Write(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Prune(ctx, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.FrameLogs(); len(got) != 1 || got[0].Direction != models.FrameDirectionDownlink {
+		t.Errorf("frame logs after prune = %+v", got)
+	}
+}
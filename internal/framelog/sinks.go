@@ -0,0 +1,126 @@
+package framelog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+// fileDateLayout 帧日志文件名中的日期，每天一个文件
+const fileDateLayout = "2006-01-02"
+
+// FileSink 按天把帧日志写成 JSON Lines 文件 frames-YYYY-MM-DD.jsonl
+type FileSink struct {
+	dir  string
+	day  string
+	file *os.File
+}
+
+// NewFileSink 创建写入 dir 的文件 sink，目录不存在时创建
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create frame log dir: %w", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+// Write 追加记录，跨天时切换到新文件
+func (s *FileSink) Write(ctx context.Context, records []*models.FrameLog) error {
+	for _, rec := range records {
+		day := rec.Time.Format(fileDateLayout)
+		if s.file == nil || day != s.day {
+			if err := s.open(day); err != nil {
+				return err
+			}
+		}
+
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := s.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileSink) open(day string) error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, "frames-"+day+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open frame log file: %w", err)
+	}
+	s.file = f
+	s.day = day
+	return nil
+}
+
+// Prune 删除最后一天早于 before 的文件
+func (s *FileSink) Prune(ctx context.Context, before time.Time) error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "frames-*.jsonl"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "frames-"), ".jsonl")
+		day, err := time.ParseInLocation(fileDateLayout, name, time.Local)
+		if err != nil {
+			continue
+		}
+		if day.AddDate(0, 0, 1).Before(before) && name != s.day {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close 关闭当前文件
+func (s *FileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// StoreSink 把帧日志写入数据库 frame_logs 表
+type StoreSink struct {
+	store storage.Store
+}
+
+// NewStoreSink 创建写入数据库的 sink
+func NewStoreSink(store storage.Store) *StoreSink {
+	return &StoreSink{store: store}
+}
+
+// Write 批量插入记录
+func (s *StoreSink) Write(ctx context.Context, records []*models.FrameLog) error {
+	return s.store.SaveFrameLogs(ctx, records)
+}
+
+// Prune 删除早于 before 的记录
+func (s *StoreSink) Prune(ctx context.Context, before time.Time) error {
+	_, err := s.store.DeleteFrameLogsBefore(ctx, before)
+	return err
+}
+
+// Close 数据库连接由调用方关闭
+func (s *StoreSink) Close() error {
+	return nil
+}
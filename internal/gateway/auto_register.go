@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+const (
+	// gatewayAdmissionTTL 网关是否已注册的缓存时间，通过 API 注册或删除网关后最多延迟这么久生效
+	gatewayAdmissionTTL = time.Minute
+
+	// unknownGatewayWarnInterval 同一个未注册网关的丢弃告警间隔
+	unknownGatewayWarnInterval = 5 * time.Minute
+)
+
+// gatewayAdmission 网关准入：已注册的网关，或允许自动注册的网关
+type gatewayAdmission struct {
+	autoRegister config.GatewayAutoRegisterConfig
+	tenantID     uuid.UUID
+
+	mu       sync.Mutex
+	known    map[string]admissionEntry
+	lastWarn map[string]time.Time
+}
+
+type admissionEntry struct {
+	registered bool
+	at         time.Time
+}
+
+func newGatewayAdmission() *gatewayAdmission {
+	return &gatewayAdmission{
+		known:    make(map[string]admissionEntry),
+		lastWarn: make(map[string]time.Time),
+	}
+}
+
+// SetAutoRegister 设置未注册网关的自动注册策略
+func (u *UDPPacketForwarder) SetAutoRegister(cfg config.GatewayAutoRegisterConfig) {
+	u.admission.autoRegister = cfg
+	u.admission.tenantID, _ = uuid.Parse(cfg.TenantID)
+}
+
+// admitGateway 网关的数据是否处理：已在服务器注册，或允许自动注册。
+// 查询数据库失败时放行，避免数据库抖动导致所有网关掉线
+func (u *UDPPacketForwarder) admitGateway(gatewayMAC [8]byte) bool {
+	if u.store == nil {
+		return true
+	}
+
+	eui := lorawan.EUI64(gatewayMAC)
+	id := eui.String()
+	if u.admission.autoRegister.Allows(id) {
+		return true
+	}
+
+	registered, ok := u.admission.cached(id)
+	if !ok {
+		_, err := u.store.GetGateway(context.Background(), eui)
+		if err != nil && err != storage.ErrNotFound {
+			log.Error().Err(err).Str("gateway", id).Msg("查询网关失败，暂时放行")
+			return true
+		}
+		registered = err == nil
+		u.admission.remember(id, registered)
+	}
+
+	if !registered && u.admission.shouldWarn(id) {
+		log.Warn().
+			Str("gateway", id).
+			Bool("autoRegister", u.admission.autoRegister.Enabled).
+			Msg("网关未注册且不允许自动注册，丢弃其数据")
+	}
+	return registered
+}
+
+// canAutoRegister 未注册的网关是否自动注册，返回所属租户
+func (u *UDPPacketForwarder) canAutoRegister(eui lorawan.EUI64) (uuid.UUID, bool) {
+	return u.admission.tenantID, u.admission.autoRegister.Allows(eui.String())
+}
+
+func (a *gatewayAdmission) cached(id string) (registered, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.known[id]
+	if !ok || time.Since(e.at) > gatewayAdmissionTTL {
+		return false, false
+	}
+	return e.registered, true
+}
+
+func (a *gatewayAdmission) remember(id string, registered bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.known[id] = admissionEntry{registered: registered, at: time.Now()}
+}
+
+// shouldWarn 同一网关每 unknownGatewayWarnInterval 只告警一次
+func (a *gatewayAdmission) shouldWarn(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.lastWarn[id]; ok && time.Since(last) < unknownGatewayWarnInterval {
+		return false
+	}
+	a.lastWarn[id] = time.Now()
+	return true
+}
+
+// sweep 清理过期的缓存和告警记录，避免伪造的网关 ID 使其无限增长
+func (a *gatewayAdmission) sweep() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, e := range a.known {
+		if time.Since(e.at) > gatewayAdmissionTTL {
+			delete(a.known, id)
+		}
+	}
+	for id, last := range a.lastWarn {
+		if time.Since(last) > unknownGatewayWarnInterval {
+			delete(a.lastWarn, id)
+		}
+	}
+}
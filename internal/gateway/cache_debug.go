@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// CacheDebugSubject 查询网关桥网关表的 NATS 主题（request/reply）
+const CacheDebugSubject = "bridge.debug.caches"
+
+// gatewaySampleSize 返回的网关样本数
+const gatewaySampleSize = 20
+
+// GatewayMapInfo 网关桥内存中的网关表
+type GatewayMapInfo struct {
+	Size   int             `json:"size"`
+	Sample []GatewayMapRow `json:"sample"`
+}
+
+// GatewayMapRow 网关表中的一条记录
+type GatewayMapRow struct {
+	GatewayID string    `json:"gatewayID"`
+	PushAddr  string    `json:"pushAddr,omitempty"`
+	PullAddr  string    `json:"pullAddr,omitempty"`
+	LastSeen  time.Time `json:"lastSeen"`
+	PullData  time.Time `json:"pullData"`
+	HasStat   bool      `json:"hasStat"`
+}
+
+// gatewayMapInfo 汇总网关表，最近活跃的网关在前
+func (u *UDPPacketForwarder) gatewayMapInfo() GatewayMapInfo {
+	u.mu.RLock()
+	rows := make([]GatewayMapRow, 0, len(u.gateways))
+	for id, gw := range u.gateways {
+		row := GatewayMapRow{
+			GatewayID: id,
+			LastSeen:  gw.LastSeen,
+			PullData:  gw.PullData,
+			HasStat:   gw.LastStat != nil,
+		}
+		if gw.PushAddr != nil {
+			row.PushAddr = gw.PushAddr.String()
+		}
+		if gw.PullAddr != nil {
+			row.PullAddr = gw.PullAddr.String()
+		}
+		rows = append(rows, row)
+	}
+	u.mu.RUnlock()
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].LastSeen.After(rows[j].LastSeen) })
+	info := GatewayMapInfo{Size: len(rows), Sample: rows}
+	if len(rows) > gatewaySampleSize {
+		info.Sample = rows[:gatewaySampleSize]
+	}
+	return info
+}
+
+// serveCacheDebug 回复网关表查询
+func (u *UDPPacketForwarder) serveCacheDebug(ctx context.Context) {
+	sub, err := u.nc.Subscribe(CacheDebugSubject, func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			return
+		}
+		data, _ := json.Marshal(u.gatewayMapInfo())
+		if err := msg.Respond(data); err != nil {
+			log.Error().Err(err).Msg("回复网关表失败")
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("订阅网关表查询失败")
+		return
+	}
+
+	<-ctx.Done()
+	sub.Unsubscribe()
+}
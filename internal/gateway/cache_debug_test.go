@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGatewayMapInfo(t *testing.T) {
+	u, _ := newTestForwarder(t, "gateway.*.rx")
+	first, second := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}, [8]byte{1, 2, 3, 4, 5, 6, 7, 9}
+	gw := pullGateway(t, u, first)
+
+	time.Sleep(10 * time.Millisecond)
+	gw.Write(semtechPacket(PullData, 0x1001, second, nil))
+	if ack, _ := readUDP(t, gw); len(ack) != 4 || ack[3] != PullAck {
+		t.Fatalf("got %x, want PULL_ACK", ack)
+	}
+
+	info := u.gatewayMapInfo()
+	if info.Size != 2 || len(info.Sample) != 2 {
+		t.Fatalf("gatewayMapInfo() = %+v, want 2 gateways", info)
+	}
+	// 最近活跃的网关在前
+	if info.Sample[0].GatewayID != "0102030405060709" || info.Sample[1].GatewayID != "0102030405060708" {
+		t.Errorf("sample not ordered by last seen: %+v", info.Sample)
+	}
+	for _, row := range info.Sample {
+		if row.PullAddr != gw.LocalAddr().String() || row.PushAddr != "" || row.HasStat {
+			t.Errorf("row = %+v, want PULL address %s only", row, gw.LocalAddr())
+		}
+	}
+}
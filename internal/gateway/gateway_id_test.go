@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestGatewayIDFormat(t *testing.T) {
+	mac := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0xab, 0xcd, 0xef}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "0102030405abcdef"},
+		{lorawan.GatewayIDLower, "0102030405abcdef"},
+		{lorawan.GatewayIDUpper, "0102030405ABCDEF"},
+		{lorawan.GatewayIDColon, "01:02:03:04:05:ab:cd:ef"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			u, sub := newTestForwarder(t, "gateway.*.rx")
+			u.SetGatewayIDFormat(tt.format)
+			gw := pullGateway(t, u, mac)
+
+			body, _ := json.Marshal(map[string]interface{}{"rxpk": []interface{}{testRXPacket([]byte{0x40, 0x01})}})
+			gw.Write(semtechPacket(PushData, 0x2000, mac, body))
+			if ack, _ := readUDP(t, gw); len(ack) != 4 || ack[3] != PushAck {
+				t.Fatalf("got %x, want PUSH_ACK", ack)
+			}
+
+			msg, err := sub.NextMsg(time.Second)
+			if err != nil {
+				t.Fatal("uplink not forwarded")
+			}
+			if msg.Subject != "gateway."+tt.want+".rx" {
+				t.Errorf("subject = %q, want gateway.%s.rx", msg.Subject, tt.want)
+			}
+			var rx models.GatewayRXMessage
+			json.Unmarshal(msg.Data, &rx)
+			if rx.GatewayID != tt.want {
+				t.Errorf("gatewayID = %q, want %q", rx.GatewayID, tt.want)
+			}
+
+			// 切换格式前的小写 ID 仍能下发到网关
+			for _, id := range []string{tt.want, lorawan.FormatGatewayID(mac, lorawan.GatewayIDLower)} {
+				u.sendDownlink(id, &models.GatewayTXMessage{TXPK: models.TXPacket{Imme: true, Freq: 500.3, Data: "AQID"}})
+				if resp, _ := readUDP(t, gw); len(resp) < 4 || resp[3] != PullResp {
+					t.Errorf("downlink to %s: got %x, want PULL_RESP", id, resp)
+				}
+			}
+		})
+	}
+}
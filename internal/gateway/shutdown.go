@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+// readTimeout UDP 读取超时，读取循环至少每隔这么久检查一次是否需要退出
+const readTimeout = time.Second
+
+// inflightTracker 跟踪正在处理的上行包和下行发送，关闭 socket 前等待它们完成
+type inflightTracker struct {
+	mu      sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// begin 开始一次处理，正在关闭时返回 false，调用方不再处理；返回 true 时处理完成后须调用 done
+func (t *inflightTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *inflightTracker) done() {
+	t.wg.Done()
+}
+
+// drain 拒绝新的处理并等待进行中的处理完成
+func (t *inflightTracker) drain() {
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+	t.wg.Wait()
+}
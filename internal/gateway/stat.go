@@ -0,0 +1,213 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// GatewayStat 网关 stat 报文解析结果（Semtech UDP 协议）
+type GatewayStat struct {
+	Time string  `json:"time,omitempty"`
+	Lati float64 `json:"lati,omitempty"`
+	Long float64 `json:"long,omitempty"`
+	Alti int     `json:"alti,omitempty"`
+
+	// 上行统计
+	RXNb uint64 `json:"rxnb"` // 收到的射频包数
+	RXOK uint64 `json:"rxok"` // CRC 正确的包数
+	RXFW uint64 `json:"rxfw"` // 已转发的包数
+
+	// 下行统计
+	ACKR float64 `json:"ackr"` // 上行数据报被 ACK 的百分比
+	DWNb uint64  `json:"dwnb"` // 网关收到的下行数
+	TXNb uint64  `json:"txnb"` // 实际发射的包数
+
+	// 硬件状态，部分网关（SX1302、带 GPS 的工业网关）才上报
+	Temp     *float64 `json:"temp,omitempty"` // 集中器温度（℃）
+	LPPS     *uint64  `json:"lpps,omitempty"` // 收到的 GPS PPS 脉冲数
+	HAL      string   `json:"hal,omitempty"`  // HAL 版本
+	FPGA     *uint64  `json:"fpga,omitempty"` // FPGA 版本
+	DSP      *uint64  `json:"dsp,omitempty"`  // DSP 固件版本
+	Platform string   `json:"pfrm,omitempty"` // 网关平台描述
+
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// parseStat 从 stat JSON 对象解析网关状态
+func parseStat(stat map[string]interface{}) *GatewayStat {
+	s := &GatewayStat{
+		Lati:       getFloat64(stat, "lati"),
+		Long:       getFloat64(stat, "long"),
+		Alti:       int(getFloat64(stat, "alti")),
+		RXNb:       getUint64(stat, "rxnb"),
+		RXOK:       getUint64(stat, "rxok"),
+		RXFW:       getUint64(stat, "rxfw"),
+		ACKR:       getFloat64(stat, "ackr"),
+		DWNb:       getUint64(stat, "dwnb"),
+		TXNb:       getUint64(stat, "txnb"),
+		ReceivedAt: time.Now(),
+	}
+
+	if t, ok := stat["time"].(string); ok {
+		s.Time = t
+	}
+
+	if v, ok := stat["temp"].(float64); ok {
+		s.Temp = &v
+	}
+	s.LPPS = optionalUint64(stat, "lpps")
+	s.FPGA = optionalUint64(stat, "fpga")
+	s.DSP = optionalUint64(stat, "dsp")
+	s.HAL, _ = stat["hal"].(string)
+	s.Platform, _ = stat["pfrm"].(string)
+
+	return s
+}
+
+// optionalUint64 读取可选的数值字段，不存在时返回 nil
+func optionalUint64(m map[string]interface{}, key string) *uint64 {
+	v, ok := m[key].(float64)
+	if !ok {
+		return nil
+	}
+	n := uint64(v)
+	return &n
+}
+
+// OverTemperature 集中器温度是否超过阈值，未上报温度或阈值为 0 时返回 false
+func (s *GatewayStat) OverTemperature(threshold float64) bool {
+	return threshold != 0 && s.Temp != nil && *s.Temp > threshold
+}
+
+// TXRatio 实际发射数与收到下行数之比，没有下行时返回 -1
+func (s *GatewayStat) TXRatio() float64 {
+	if s.DWNb == 0 {
+		return -1
+	}
+	return float64(s.TXNb) / float64(s.DWNb)
+}
+
+// DownlinkHealthy 网关是否发射了收到的全部下行
+func (s *GatewayStat) DownlinkHealthy() bool {
+	return s.DWNb == 0 || s.TXNb >= s.DWNb
+}
+
+// toVariables 转换为网关元数据中保存的格式
+func (s *GatewayStat) toVariables() map[string]interface{} {
+	vars := map[string]interface{}{
+		"time":       s.Time,
+		"rxnb":       s.RXNb,
+		"rxok":       s.RXOK,
+		"rxfw":       s.RXFW,
+		"ackr":       s.ACKR,
+		"dwnb":       s.DWNb,
+		"txnb":       s.TXNb,
+		"txRatio":    s.TXRatio(),
+		"healthy":    s.DownlinkHealthy(),
+		"receivedAt": s.ReceivedAt,
+	}
+
+	// 硬件状态只在网关上报时包含
+	if s.Temp != nil {
+		vars["temp"] = *s.Temp
+	}
+	if s.LPPS != nil {
+		vars["lpps"] = *s.LPPS
+	}
+	if s.HAL != "" {
+		vars["hal"] = s.HAL
+	}
+	if s.FPGA != nil {
+		vars["fpga"] = *s.FPGA
+	}
+	if s.DSP != nil {
+		vars["dsp"] = *s.DSP
+	}
+	if s.Platform != "" {
+		vars["pfrm"] = s.Platform
+	}
+	return vars
+}
+
+// setGatewayStat 把最近一次 stat 写入网关元数据
+func setGatewayStat(gateway *models.Gateway, stat *GatewayStat) {
+	if stat == nil {
+		return
+	}
+	if gateway.Metadata == nil {
+		gateway.Metadata = make(models.Variables)
+	}
+	gateway.Metadata["stat"] = stat.toVariables()
+}
+
+// TempAlert 集中器温度超过阈值或恢复正常时发布的告警
+type TempAlert struct {
+	GatewayID string    `json:"gatewayId"`
+	Temp      float64   `json:"temp"`
+	Threshold float64   `json:"threshold"`
+	Over      bool      `json:"over"` // false 表示已恢复
+	Time      time.Time `json:"time"`
+}
+
+// publishTempAlert 发布 gateway.<id>.health 事件并写入事件日志
+func (u *UDPPacketForwarder) publishTempAlert(gatewayID string, temp float64, over bool) {
+	alert := TempAlert{
+		GatewayID: gatewayID,
+		Temp:      temp,
+		Threshold: u.tempAlertThreshold,
+		Over:      over,
+		Time:      time.Now(),
+	}
+
+	logEvent := log.Info()
+	level, code, state := models.EventLevelInfo, "GATEWAY_TEMP_NORMAL", "back to normal"
+	if over {
+		logEvent = log.Warn()
+		level, code, state = models.EventLevelWarning, "GATEWAY_TEMP_HIGH", "above threshold"
+	}
+	logEvent.
+		Str("gateway", gatewayID).
+		Float64("temp", temp).
+		Float64("threshold", u.tempAlertThreshold).
+		Bool("over", over).
+		Msg("网关集中器温度告警")
+
+	subject := fmt.Sprintf("gateway.%s.health", gatewayID)
+	data, _ := json.Marshal(alert)
+	if err := u.nc.Publish(subject, data); err != nil {
+		log.Error().Err(err).Str("subject", subject).Msg("发布网关温度告警失败")
+	}
+
+	if u.store == nil {
+		return
+	}
+	event := &models.EventLog{
+		Type:        models.EventTypeGatewayHealth,
+		Level:       level,
+		Code:        code,
+		Description: fmt.Sprintf("Gateway %s concentrator temperature %.1f°C %s (%.1f°C)", gatewayID, temp, state, u.tempAlertThreshold),
+		Details: models.Variables{
+			"temp":      temp,
+			"threshold": u.tempAlertThreshold,
+		},
+	}
+	if id, err := lorawan.ParseGatewayID(gatewayID); err == nil {
+		gwID := models.EUI64(id)
+		event.GatewayID = &gwID
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := u.store.CreateEventLog(ctx, event); err != nil {
+			log.Error().Err(err).Str("gateway", gatewayID).Msg("记录网关温度告警失败")
+		}
+	}()
+}
@@ -0,0 +1,231 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+func decodeStat(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var stat map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &stat); err != nil {
+		t.Fatalf("decode stat: %v", err)
+	}
+	return stat
+}
+
+func TestParseStat(t *testing.T) {
+	stat := parseStat(decodeStat(t, `{
+		"time": "2024-01-02 03:04:05 GMT",
+		"lati": 31.23, "long": 121.47, "alti": 12,
+		"rxnb": 120, "rxok": 110, "rxfw": 108,
+		"ackr": 97.5, "dwnb": 20, "txnb": 18
+	}`))
+
+	if stat.Time != "2024-01-02 03:04:05 GMT" {
+		t.Errorf("Time = %q", stat.Time)
+	}
+	if stat.Lati != 31.23 || stat.Long != 121.47 || stat.Alti != 12 {
+		t.Errorf("position = %v, %v, %v", stat.Lati, stat.Long, stat.Alti)
+	}
+	if stat.RXNb != 120 || stat.RXOK != 110 || stat.RXFW != 108 {
+		t.Errorf("uplink counters = %d/%d/%d, want 120/110/108", stat.RXNb, stat.RXOK, stat.RXFW)
+	}
+	if stat.ACKR != 97.5 || stat.DWNb != 20 || stat.TXNb != 18 {
+		t.Errorf("downlink counters = %v/%d/%d, want 97.5/20/18", stat.ACKR, stat.DWNb, stat.TXNb)
+	}
+	if stat.ReceivedAt.IsZero() {
+		t.Error("ReceivedAt not set")
+	}
+
+	vars := stat.toVariables()
+	if vars["dwnb"] != uint64(20) || vars["txnb"] != uint64(18) || vars["ackr"] != 97.5 {
+		t.Errorf("variables = %v", vars)
+	}
+	if vars["txRatio"] != 0.9 || vars["healthy"] != false {
+		t.Errorf("txRatio = %v, healthy = %v, want 0.9, false", vars["txRatio"], vars["healthy"])
+	}
+}
+
+func TestGatewayStatDownlinkHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		dwnb    uint64
+		txnb    uint64
+		ratio   float64
+		healthy bool
+	}{
+		{"no downlinks", 0, 0, -1, true},
+		{"all transmitted", 10, 10, 1, true},
+		{"some dropped", 10, 5, 0.5, false},
+		{"none transmitted", 4, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GatewayStat{DWNb: tt.dwnb, TXNb: tt.txnb}
+			if got := s.TXRatio(); got != tt.ratio {
+				t.Errorf("TXRatio() = %v, want %v", got, tt.ratio)
+			}
+			if got := s.DownlinkHealthy(); got != tt.healthy {
+				t.Errorf("DownlinkHealthy() = %v, want %v", got, tt.healthy)
+			}
+		})
+	}
+}
+
+func TestParseStatHealthFields(t *testing.T) {
+	stat := parseStat(decodeStat(t, `{
+		"time": "2024-01-02 03:04:05 GMT",
+		"rxnb": 1, "dwnb": 0, "txnb": 0,
+		"temp": 48.5, "lpps": 3600, "hal": "5.1.0",
+		"fpga": 31, "dsp": 0, "pfrm": "SX1302 Corecell"
+	}`))
+
+	if stat.Temp == nil || *stat.Temp != 48.5 {
+		t.Errorf("Temp = %v, want 48.5", stat.Temp)
+	}
+	if stat.LPPS == nil || *stat.LPPS != 3600 {
+		t.Errorf("LPPS = %v, want 3600", stat.LPPS)
+	}
+	if stat.FPGA == nil || *stat.FPGA != 31 {
+		t.Errorf("FPGA = %v, want 31", stat.FPGA)
+	}
+	// 0 也是有效的版本号
+	if stat.DSP == nil || *stat.DSP != 0 {
+		t.Errorf("DSP = %v, want 0", stat.DSP)
+	}
+	if stat.HAL != "5.1.0" || stat.Platform != "SX1302 Corecell" {
+		t.Errorf("HAL, Platform = %q, %q", stat.HAL, stat.Platform)
+	}
+
+	vars := stat.toVariables()
+	want := map[string]interface{}{"temp": 48.5, "lpps": uint64(3600), "hal": "5.1.0", "fpga": uint64(31), "dsp": uint64(0), "pfrm": "SX1302 Corecell"}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("variables[%s] = %v, want %v", k, vars[k], v)
+		}
+	}
+
+	gateway := &models.Gateway{}
+	setGatewayStat(gateway, stat)
+	if saved, _ := gateway.Metadata["stat"].(map[string]interface{}); saved["temp"] != 48.5 {
+		t.Errorf("metadata stat = %v", gateway.Metadata["stat"])
+	}
+}
+
+func TestParseStatWithoutHealthFields(t *testing.T) {
+	stat := parseStat(decodeStat(t, `{"time": "2024-01-02 03:04:05 GMT", "rxnb": 1}`))
+
+	if stat.Temp != nil || stat.LPPS != nil || stat.FPGA != nil || stat.DSP != nil || stat.HAL != "" || stat.Platform != "" {
+		t.Errorf("health fields = %+v, want none", stat)
+	}
+	vars := stat.toVariables()
+	for _, k := range []string{"temp", "lpps", "hal", "fpga", "dsp", "pfrm"} {
+		if _, ok := vars[k]; ok {
+			t.Errorf("variables contain %s without it being reported", k)
+		}
+	}
+}
+
+func TestGatewayStatOverTemperature(t *testing.T) {
+	temp := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name      string
+		temp      *float64
+		threshold float64
+		want      bool
+	}{
+		{"above", temp(70), 60, true},
+		{"at threshold", temp(60), 60, false},
+		{"below", temp(50), 60, false},
+		{"not reported", nil, 60, false},
+		{"alert disabled", temp(70), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GatewayStat{Temp: tt.temp}
+			if got := s.OverTemperature(tt.threshold); got != tt.want {
+				t.Errorf("OverTemperature(%v) = %v, want %v", tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleStatTempAlert(t *testing.T) {
+	srv := natstest.Run(t)
+	store := storagetest.New()
+	u, err := NewUDPPacketForwarder([]string{"127.0.0.1:0"}, srv.Conn(t), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeConns(u.conns) })
+	u.SetTempAlertThreshold(60)
+	u.gateways[testGatewayID] = &GatewayInfo{}
+
+	nc := srv.Conn(t)
+	alerts, err := nc.SubscribeSync("gateway." + testGatewayID + ".health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+
+	// 只在超过阈值和恢复时告警
+	steps := []struct {
+		stat     string
+		wantSent bool
+		wantOver bool
+	}{
+		{`{"temp": 50}`, false, false},
+		{`{"temp": 65}`, true, true},
+		{`{"temp": 70}`, false, false},
+		{`{"rxnb": 1}`, false, false},
+		{`{"temp": 55}`, true, false},
+		{`{"temp": 52}`, false, false},
+	}
+
+	for i, step := range steps {
+		u.handleStat(testGatewayID, decodeStat(t, step.stat))
+
+		msg, err := alerts.NextMsg(200 * time.Millisecond)
+		if !step.wantSent {
+			if err == nil {
+				t.Errorf("step %d: unexpected alert %s", i, msg.Data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: no alert", i)
+		}
+		var alert TempAlert
+		json.Unmarshal(msg.Data, &alert)
+		if alert.Over != step.wantOver || alert.Threshold != 60 || alert.GatewayID != testGatewayID {
+			t.Errorf("step %d: alert = %+v", i, alert)
+		}
+	}
+
+	// 告警同时写入事件日志
+	var events []*models.EventLog
+	for deadline := time.Now().Add(2 * time.Second); len(events) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		events, _, _ = store.ListEventLogs(context.Background(), storage.EventLogFilters{}, 10, 0)
+	}
+	codes := map[string]bool{}
+	for _, e := range events {
+		if e.Type != models.EventTypeGatewayHealth || e.GatewayID == nil {
+			t.Errorf("event = %+v", e)
+		}
+		codes[e.Code] = true
+	}
+	if len(events) != 2 || !codes["GATEWAY_TEMP_HIGH"] || !codes["GATEWAY_TEMP_NORMAL"] {
+		t.Errorf("event codes = %v, want GATEWAY_TEMP_HIGH and GATEWAY_TEMP_NORMAL", codes)
+	}
+}
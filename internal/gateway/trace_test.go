@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestUplinkTraceID(t *testing.T) {
+	traceIDPattern := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	u, sub := newTestForwarder(t, "gateway.*.rx")
+
+	// 每个上行生成自己的追踪 ID
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		u.handleRXPacket(testGatewayID, testRXPacket([]byte{0x40, byte(i)}))
+		rx := nextRX(t, sub)
+		if rx == nil {
+			t.Fatal("uplink not forwarded")
+		}
+		if !traceIDPattern.MatchString(rx.TraceID) {
+			t.Fatalf("trace ID = %q", rx.TraceID)
+		}
+		if seen[rx.TraceID] {
+			t.Errorf("trace ID %s reused", rx.TraceID)
+		}
+		seen[rx.TraceID] = true
+	}
+}
+
+func TestDownlinkLogsTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	logging.SetFrameSampling(0)
+	t.Cleanup(func() {
+		log.Logger = saved
+		logging.SetFrameSampling(0)
+	})
+
+	tests := []struct {
+		name    string
+		traceID string
+	}{
+		{"traced", "0123456789abcdef"},
+		{"untraced", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			u, _ := newTestForwarder(t, "gateway.*.rx")
+			mac := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+			gw := pullGateway(t, u, mac)
+
+			u.sendDownlink(testGatewayID, &models.GatewayTXMessage{TXPK: models.TXPacket{Imme: true, Freq: 500.3, Data: "AQID"}, TraceID: tt.traceID})
+			if resp, _ := readUDP(t, gw); len(resp) < 4 || resp[3] != PullResp {
+				t.Fatalf("got %x, want PULL_RESP", resp)
+			}
+
+			// 下行的处理和发送日志带上行的追踪 ID
+			for _, msg := range []string{"处理下行数据请求", "PULL_RESP 已发送"} {
+				found := false
+				for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+					var entry map[string]interface{}
+					if json.Unmarshal(line, &entry) != nil || entry["message"] != msg {
+						continue
+					}
+					found = true
+					if got, _ := entry[logging.TraceIDField].(string); got != tt.traceID {
+						t.Errorf("log %q has trace ID %q, want %q", msg, got, tt.traceID)
+					}
+				}
+				if !found {
+					t.Errorf("log %q not written", msg)
+				}
+			}
+		})
+	}
+}
@@ -6,17 +6,21 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 
-	"github.com/google/uuid"
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
@@ -37,12 +41,25 @@ const (
 
 // UDPPacketForwarder 处理 Semtech UDP 协议
 type UDPPacketForwarder struct {
-	conn     *net.UDPConn
+	conns    []*net.UDPConn
 	nc       *nats.Conn
 	store    storage.Store
 	gateways map[string]*GatewayInfo
 	mu       sync.RWMutex
 	tokens   map[uint16]time.Time
+
+	maxPHYPayload    int    // 0 表示不检查
+	droppedOversized uint64 // 因超长被丢弃的上行帧数
+
+	timing config.DownlinkTimingConfig // context 模式定时下行余量
+
+	idFormat string // NATS 主题和消息中的网关 ID 格式
+
+	tempAlertThreshold float64 // 集中器温度告警阈值（℃），0 表示不告警
+
+	admission *gatewayAdmission // 未注册网关的准入和自动注册
+
+	inflight inflightTracker // 正在处理的上行包和下行发送，停止时等待完成
 }
 
 // GatewayInfo 网关信息
@@ -50,63 +67,122 @@ type GatewayInfo struct {
 	GatewayID      string
 	PushAddr       *net.UDPAddr // PUSH_DATA 地址（上行）
 	PullAddr       *net.UDPAddr // PULL_DATA 地址（下行）
+	PullConn       *net.UDPConn // 收到 PULL_DATA 的监听 socket，下行从这里发出
 	LastSeen       time.Time
 	PullData       time.Time
 	PullTokenBytes [2]byte
 	ProtocolVer    uint8
+	LastStat       *GatewayStat // 最近一次 stat 报文
+	OverTemp       bool         // 集中器温度超过告警阈值
 }
 
-// NewUDPPacketForwarder 创建 UDP 包转发器
-func NewUDPPacketForwarder(bindAddr string, nc *nats.Conn, store storage.Store) (*UDPPacketForwarder, error) {
-	addr, err := net.ResolveUDPAddr("udp", bindAddr)
-	if err != nil {
-		return nil, err
+// NewUDPPacketForwarder 创建 UDP 包转发器，每个绑定地址一个监听 socket
+func NewUDPPacketForwarder(bindAddrs []string, nc *nats.Conn, store storage.Store) (*UDPPacketForwarder, error) {
+	if len(bindAddrs) == 0 {
+		return nil, fmt.Errorf("no UDP bind address configured")
 	}
 
-	conn, err := net.ListenUDP("udp", addr)
-	if err != nil {
-		return nil, err
+	var conns []*net.UDPConn
+	for _, bindAddr := range bindAddrs {
+		addr, err := net.ResolveUDPAddr("udp", bindAddr)
+		if err != nil {
+			closeConns(conns)
+			return nil, fmt.Errorf("resolve %s: %w", bindAddr, err)
+		}
+
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			closeConns(conns)
+			return nil, fmt.Errorf("listen %s: %w", bindAddr, err)
+		}
+		conns = append(conns, conn)
 	}
 
 	return &UDPPacketForwarder{
-		conn:     conn,
-		nc:       nc,
-		store:    store,
-		gateways: make(map[string]*GatewayInfo),
-		tokens:   make(map[uint16]time.Time),
+		conns:     conns,
+		nc:        nc,
+		store:     store,
+		gateways:  make(map[string]*GatewayInfo),
+		tokens:    make(map[uint16]time.Time),
+		admission: newGatewayAdmission(),
 	}, nil
 }
 
+func closeConns(conns []*net.UDPConn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
 // Start 启动 UDP 服务器
 func (u *UDPPacketForwarder) Start(ctx context.Context) error {
-	log.Info().Str("addr", u.conn.LocalAddr().String()).Msg("Gateway Bridge UDP 服务器启动")
-
 	// 启动下行数据处理
 	go u.handleDownlink(ctx)
 
 	// 启动网关清理
 	go u.cleanupGateways(ctx)
 
-	// 处理上行 UDP 包
+	// 管理端查询网关表
+	go u.serveCacheDebug(ctx)
+
+	// 每个监听地址一个读取循环
+	var readers sync.WaitGroup
+	for _, conn := range u.conns {
+		log.Info().Str("addr", conn.LocalAddr().String()).Msg("Gateway Bridge UDP 服务器启动")
+		readers.Add(1)
+		go func(conn *net.UDPConn) {
+			defer readers.Done()
+			u.readLoop(ctx, conn)
+		}(conn)
+	}
+
+	<-ctx.Done()
+
+	// 读取循环在读取超时后退出，再等待进行中的上行处理和下行发送完成后关闭 socket
+	readers.Wait()
+	log.Info().Msg("UDP 读取已停止，等待进行中的下行发送完成")
+	u.inflight.drain()
+	closeConns(u.conns)
+	log.Info().Msg("Gateway Bridge UDP 服务器已关闭")
+	return ctx.Err()
+}
+
+// readLoop 处理单个 socket 的上行 UDP 包
+func (u *UDPPacketForwarder) readLoop(ctx context.Context, conn *net.UDPConn) {
 	buf := make([]byte, 65507)
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			n, addr, err := u.conn.ReadFromUDP(buf)
-			if err != nil {
-				log.Error().Err(err).Msg("读取 UDP 包错误")
+		if ctx.Err() != nil {
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
 				continue
 			}
+			log.Error().Err(err).Str("addr", conn.LocalAddr().String()).Msg("读取 UDP 包错误")
+			continue
+		}
 
-			go u.handlePacket(buf[:n], addr)
+		// 复制数据，buf 会被下一次读取覆盖
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		if !u.inflight.begin() {
+			return
 		}
+		go func() {
+			defer u.inflight.done()
+			u.handlePacket(conn, data, addr)
+		}()
 	}
 }
 
 // handlePacket 处理接收到的包
-func (u *UDPPacketForwarder) handlePacket(data []byte, addr *net.UDPAddr) {
+func (u *UDPPacketForwarder) handlePacket(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
 	if len(data) < 4 {
 		return
 	}
@@ -126,11 +202,11 @@ func (u *UDPPacketForwarder) handlePacket(data []byte, addr *net.UDPAddr) {
 
 	switch identifier {
 	case PushData:
-		u.handlePushData(data, addr, token)
+		u.handlePushData(conn, data, addr, token)
 	case PullData:
-		u.handlePullData(data, addr, token)
+		u.handlePullData(conn, data, addr, token)
 	case TxAck:
-		u.handleTxAck(data, addr, token)
+		u.handleTxAck(conn, data, addr, token)
 	default:
 		log.Warn().
 			Uint8("type", identifier).
@@ -140,7 +216,7 @@ func (u *UDPPacketForwarder) handlePacket(data []byte, addr *net.UDPAddr) {
 }
 
 // handlePushData 处理 PUSH_DATA
-func (u *UDPPacketForwarder) handlePushData(data []byte, addr *net.UDPAddr, token uint16) {
+func (u *UDPPacketForwarder) handlePushData(conn *net.UDPConn, data []byte, addr *net.UDPAddr, token uint16) {
 	if len(data) < 12 {
 		return
 	}
@@ -148,7 +224,12 @@ func (u *UDPPacketForwarder) handlePushData(data []byte, addr *net.UDPAddr, toke
 	// 解析网关 MAC
 	var gatewayMAC [8]byte
 	copy(gatewayMAC[:], data[4:12])
-	gatewayID := fmt.Sprintf("%016x", gatewayMAC)
+	gatewayID := lorawan.FormatGatewayID(gatewayMAC, u.idFormat)
+
+	// 未注册且不允许自动注册的网关：不应答、不转发
+	if !u.admitGateway(gatewayMAC) {
+		return
+	}
 
 	// 更新网关信息
 	u.mu.Lock()
@@ -169,40 +250,41 @@ func (u *UDPPacketForwarder) handlePushData(data []byte, addr *net.UDPAddr, toke
 	ack[0] = ProtocolVersion
 	binary.BigEndian.PutUint16(ack[1:3], token)
 	ack[3] = PushAck
-	u.conn.WriteToUDP(ack, addr)
-
-	// 更新数据库中的网关状态
-	go u.updateGatewayInDB(gatewayID)
+	conn.WriteToUDP(ack, addr)
 
 	// 解析 JSON 数据
+	var payload map[string]interface{}
 	if len(data) > 12 {
-		var payload map[string]interface{}
 		if err := json.Unmarshal(data[12:], &payload); err != nil {
 			log.Error().Err(err).Msg("解析 PUSH_DATA JSON 失败")
+			go u.updateGatewayInDB(gatewayID)
 			return
 		}
+	}
 
-		// 处理接收到的数据包
-		if rxpk, ok := payload["rxpk"].([]interface{}); ok {
-			for _, pkt := range rxpk {
-				u.handleRXPacket(gatewayID, pkt)
-			}
-		}
+	// 先处理状态信息，写库时带上最新统计
+	if stat, ok := payload["stat"].(map[string]interface{}); ok {
+		u.handleStat(gatewayID, stat)
+	}
+
+	// 更新数据库中的网关状态
+	go u.updateGatewayInDB(gatewayID)
 
-		// 处理状态信息
-		if stat, ok := payload["stat"].(map[string]interface{}); ok {
-			u.handleStat(gatewayID, stat)
+	// 处理接收到的数据包
+	if rxpk, ok := payload["rxpk"].([]interface{}); ok {
+		for _, pkt := range rxpk {
+			u.handleRXPacket(gatewayID, pkt)
 		}
 	}
 
-	log.Debug().
+	logging.Frame().Debug().
 		Str("gateway", gatewayID).
 		Str("pushAddr", addr.String()).
 		Msg("收到 PUSH_DATA")
 }
 
 // handlePullData 处理 PULL_DATA
-func (u *UDPPacketForwarder) handlePullData(data []byte, addr *net.UDPAddr, token uint16) {
+func (u *UDPPacketForwarder) handlePullData(conn *net.UDPConn, data []byte, addr *net.UDPAddr, token uint16) {
 	if len(data) < 12 {
 		return
 	}
@@ -210,7 +292,11 @@ func (u *UDPPacketForwarder) handlePullData(data []byte, addr *net.UDPAddr, toke
 	// 解析网关 MAC
 	var gatewayMAC [8]byte
 	copy(gatewayMAC[:], data[4:12])
-	gatewayID := fmt.Sprintf("%016x", gatewayMAC)
+	gatewayID := lorawan.FormatGatewayID(gatewayMAC, u.idFormat)
+
+	if !u.admitGateway(gatewayMAC) {
+		return
+	}
 
 	// 更新网关信息
 	u.mu.Lock()
@@ -223,6 +309,7 @@ func (u *UDPPacketForwarder) handlePullData(data []byte, addr *net.UDPAddr, toke
 		u.gateways[gatewayID] = gw
 	}
 	gw.PullAddr = addr // 只更新 PULL 地址
+	gw.PullConn = conn
 	gw.LastSeen = time.Now()
 	gw.PullData = time.Now()
 	gw.PullTokenBytes[0] = data[1]
@@ -234,18 +321,43 @@ func (u *UDPPacketForwarder) handlePullData(data []byte, addr *net.UDPAddr, toke
 	ack[0] = ProtocolVersion
 	binary.BigEndian.PutUint16(ack[1:3], token)
 	ack[3] = PullAck
-	u.conn.WriteToUDP(ack, addr)
+	conn.WriteToUDP(ack, addr)
 
 	// 更新数据库中的网关状态
 	go u.updateGatewayInDB(gatewayID)
 
-	log.Debug().
+	logging.Frame().Debug().
 		Str("gateway", gatewayID).
 		Str("pullAddr", addr.String()).
 		Hex("token", data[1:3]).
 		Msg("收到 PULL_DATA，更新下行地址")
 }
 
+// SetMaxPHYPayloadSize 设置上行 PHYPayload 最大长度，0 表示不检查
+func (u *UDPPacketForwarder) SetMaxPHYPayloadSize(size int) {
+	u.maxPHYPayload = size
+}
+
+// SetDownlinkTiming 设置 context 模式定时下行的时间余量
+func (u *UDPPacketForwarder) SetDownlinkTiming(timing config.DownlinkTimingConfig) {
+	u.timing = timing
+}
+
+// SetGatewayIDFormat 设置网关 ID 格式（lower / upper / colon）
+func (u *UDPPacketForwarder) SetGatewayIDFormat(format string) {
+	u.idFormat = format
+}
+
+// SetTempAlertThreshold 设置集中器温度告警阈值（℃），0 表示不告警
+func (u *UDPPacketForwarder) SetTempAlertThreshold(threshold float64) {
+	u.tempAlertThreshold = threshold
+}
+
+// DroppedOversized 返回因超长被丢弃的上行帧数
+func (u *UDPPacketForwarder) DroppedOversized() uint64 {
+	return atomic.LoadUint64(&u.droppedOversized)
+}
+
 // handleRXPacket 处理接收包
 func (u *UDPPacketForwarder) handleRXPacket(gatewayID string, pkt interface{}) {
 	pktMap, ok := pkt.(map[string]interface{})
@@ -254,7 +366,7 @@ func (u *UDPPacketForwarder) handleRXPacket(gatewayID string, pkt interface{}) {
 	}
 	// 添加日志
 	if tmst, ok := pktMap["tmst"]; ok {
-		log.Debug().
+		logging.Frame().Debug().
 			Interface("tmst", tmst).
 			Interface("type", fmt.Sprintf("%T", tmst)).
 			Msg("收到的上行时间戳")
@@ -278,6 +390,24 @@ func (u *UDPPacketForwarder) handleRXPacket(gatewayID string, pkt interface{}) {
 		return
 	}
 
+	// 丢弃超过频段物理上限的帧
+	if u.maxPHYPayload > 0 {
+		if dataStr, ok := pktMap["data"].(string); ok {
+			if size := base64.StdEncoding.DecodedLen(len(dataStr)); size > u.maxPHYPayload {
+				if phy, err := base64.StdEncoding.DecodeString(dataStr); err == nil && len(phy) > u.maxPHYPayload {
+					dropped := atomic.AddUint64(&u.droppedOversized, 1)
+					log.Warn().
+						Str("gateway", gatewayID).
+						Int("size", len(phy)).
+						Int("max", u.maxPHYPayload).
+						Uint64("dropped", dropped).
+						Msg("上行帧超过最大长度，已丢弃")
+					return
+				}
+			}
+		}
+	}
+
 	// ✅ 创建 context，确保 tmst 是 float64
 	context := map[string]interface{}{
 		"gateway_id": gatewayID,
@@ -286,12 +416,21 @@ func (u *UDPPacketForwarder) handleRXPacket(gatewayID string, pkt interface{}) {
 	contextBytes, _ := json.Marshal(context)
 	contextB64 := base64.StdEncoding.EncodeToString(contextBytes)
 
-	// 构建 NATS 消息
-	msg := map[string]interface{}{
-		"gatewayID": gatewayID,
-		"rxpk":      pktMap,
-		"context":   contextB64, // ✅ 添加 context
-		"timestamp": time.Now().Unix(),
+	rxpk, err := models.DecodeRXPacket(pktMap)
+	if err != nil {
+		log.Error().Err(err).Str("gateway", gatewayID).Msg("解析 rxpk 失败")
+		return
+	}
+
+	// 构建 NATS 消息，追踪 ID 随上行及其下行传递
+	traceID := logging.NewTraceID()
+	msg := models.GatewayRXMessage{
+		Version:   models.GatewayProtocolVersion,
+		GatewayID: gatewayID,
+		RXPK:      rxpk,
+		Context:   contextB64, // ✅ 添加 context
+		Timestamp: time.Now().Unix(),
+		TraceID:   traceID,
 	}
 
 	data, err := json.Marshal(msg)
@@ -311,7 +450,8 @@ func (u *UDPPacketForwarder) handleRXPacket(gatewayID string, pkt interface{}) {
 	if dataStr, ok := pktMap["data"].(string); ok {
 		phyPayload, err := base64.StdEncoding.DecodeString(dataStr)
 		if err == nil {
-			log.Info().
+			logging.Frame().Info().
+				Str(logging.TraceIDField, traceID).
 				Str("gateway", gatewayID).
 				Float64("freq", getFloat64(pktMap, "freq")).
 				Float64("rssi", getFloat64(pktMap, "rssi")).
@@ -324,10 +464,33 @@ func (u *UDPPacketForwarder) handleRXPacket(gatewayID string, pkt interface{}) {
 
 // handleStat 处理状态信息
 func (u *UDPPacketForwarder) handleStat(gatewayID string, stat map[string]interface{}) {
+	parsed := parseStat(stat)
+	overTemp := parsed.OverTemperature(u.tempAlertThreshold)
+
+	// 只在超过阈值和恢复时告警一次
+	tempChanged := false
+	u.mu.Lock()
+	if gw, ok := u.gateways[gatewayID]; ok {
+		gw.LastStat = parsed
+		tempChanged = gw.OverTemp != overTemp && parsed.Temp != nil
+		if tempChanged {
+			gw.OverTemp = overTemp
+		}
+	}
+	u.mu.Unlock()
+
 	// 构建状态消息
 	msg := map[string]interface{}{
 		"gatewayID": gatewayID,
 		"stat":      stat,
+		"parsed":    parsed,
+		"downlink": map[string]interface{}{
+			"ackr":    parsed.ACKR,
+			"dwnb":    parsed.DWNb,
+			"txnb":    parsed.TXNb,
+			"txRatio": parsed.TXRatio(),
+			"healthy": parsed.DownlinkHealthy(),
+		},
 		"timestamp": time.Now().Unix(),
 	}
 
@@ -342,13 +505,28 @@ func (u *UDPPacketForwarder) handleStat(gatewayID string, stat map[string]interf
 
 	log.Debug().
 		Str("gateway", gatewayID).
-		Uint64("rxnb", getUint64(stat, "rxnb")).
-		Uint64("rxok", getUint64(stat, "rxok")).
+		Uint64("rxnb", parsed.RXNb).
+		Uint64("rxok", parsed.RXOK).
+		Float64("ackr", parsed.ACKR).
+		Uint64("dwnb", parsed.DWNb).
+		Uint64("txnb", parsed.TXNb).
 		Msg("收到网关状态")
+
+	if !parsed.DownlinkHealthy() {
+		log.Warn().
+			Str("gateway", gatewayID).
+			Uint64("dwnb", parsed.DWNb).
+			Uint64("txnb", parsed.TXNb).
+			Msg("网关未发射全部下行")
+	}
+
+	if tempChanged {
+		u.publishTempAlert(gatewayID, *parsed.Temp, overTemp)
+	}
 }
 
 // handleTxAck 处理 TX_ACK
-func (u *UDPPacketForwarder) handleTxAck(data []byte, addr *net.UDPAddr, token uint16) {
+func (u *UDPPacketForwarder) handleTxAck(conn *net.UDPConn, data []byte, addr *net.UDPAddr, token uint16) {
 	if len(data) < 12 {
 		return
 	}
@@ -356,7 +534,7 @@ func (u *UDPPacketForwarder) handleTxAck(data []byte, addr *net.UDPAddr, token u
 	// 解析网关 MAC
 	var gatewayMAC [8]byte
 	copy(gatewayMAC[:], data[4:12])
-	gatewayID := fmt.Sprintf("%016x", gatewayMAC)
+	gatewayID := lorawan.FormatGatewayID(gatewayMAC, u.idFormat)
 
 	var txAckData map[string]interface{}
 	if len(data) > 12 {
@@ -374,7 +552,7 @@ func (u *UDPPacketForwarder) handleTxAck(data []byte, addr *net.UDPAddr, token u
 	subject := fmt.Sprintf("gateway.%s.txack", gatewayID)
 	u.nc.Publish(subject, msgData)
 
-	log.Debug().
+	logging.Frame().Debug().
 		Str("gateway", gatewayID).
 		Uint16("token", token).
 		Interface("ack", txAckData).
@@ -387,24 +565,36 @@ func (u *UDPPacketForwarder) handleDownlink(ctx context.Context) {
 
 	// 订阅下行消息
 	sub, err := u.nc.Subscribe("gateway.*.tx", func(msg *nats.Msg) {
-		log.Info().
+		logging.Frame().Info().
 			Str("subject", msg.Subject).
 			Int("size", len(msg.Data)).
 			Msg("收到 NATS 下行消息")
 
-		var txMsg map[string]interface{}
+		var txMsg models.GatewayTXMessage
 		if err := json.Unmarshal(msg.Data, &txMsg); err != nil {
 			log.Error().Err(err).Msg("解析下行消息失败")
 			return
 		}
 
-		gatewayID, ok := txMsg["gatewayID"].(string)
-		if !ok {
+		if txMsg.GatewayID == "" {
 			log.Error().Msg("下行消息缺少 gatewayID")
 			return
 		}
 
-		u.sendDownlink(gatewayID, txMsg)
+		if !models.GatewayProtocolCompatible(txMsg.Version) {
+			log.Warn().
+				Str("gateway", txMsg.GatewayID).
+				Int("version", txMsg.Version).
+				Int("supported", models.GatewayProtocolVersion).
+				Msg("网络服务器消息版本高于网关桥支持的版本，请升级网关桥")
+		}
+
+		if !u.inflight.begin() {
+			log.Warn().Str("gateway", txMsg.GatewayID).Msg("Gateway Bridge 正在关闭，丢弃下行")
+			return
+		}
+		defer u.inflight.done()
+		u.sendDownlink(txMsg.GatewayID, &txMsg)
 	})
 
 	if err != nil {
@@ -417,8 +607,16 @@ func (u *UDPPacketForwarder) handleDownlink(ctx context.Context) {
 }
 
 // sendDownlink 发送下行数据
-func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]interface{}) {
-	log.Info().
+func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg *models.GatewayTXMessage) {
+	// 兼容其他格式的网关 ID（如切换格式前的小写十六进制）
+	if normalized, err := lorawan.NormalizeGatewayID(gatewayID, u.idFormat); err == nil {
+		gatewayID = normalized
+	}
+
+	// 上行带来的追踪 ID，随下行日志输出
+	traceCtx := logging.WithTraceID(context.Background(), txMsg.TraceID)
+
+	logging.FrameCtx(traceCtx).Info().
 		Str("gateway", gatewayID).
 		Interface("txMsg", txMsg).
 		Msg("处理下行数据请求")
@@ -428,30 +626,30 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 	u.mu.RUnlock()
 
 	if !exists {
-		log.Warn().
+		logging.Ctx(traceCtx).Warn().
 			Str("gateway", gatewayID).
 			Msg("网关不存在")
 		return
 	}
 
 	if gw.PullAddr == nil {
-		log.Warn().
+		logging.Ctx(traceCtx).Warn().
 			Str("gateway", gatewayID).
 			Bool("hasPushAddr", gw.PushAddr != nil).
 			Msg("网关没有 PULL 地址（未收到 PULL_DATA）")
 		return
 	}
 
-	// 从消息中提取 txpk
-	txpk, ok := txMsg["txpk"].(map[string]interface{})
-	if !ok {
-		log.Error().Msg("消息中没有 txpk 字段")
+	txpk := txMsg.TXPK
+	if txpk.Data == "" {
+		logging.Ctx(traceCtx).Error().Msg("下行消息的 txpk 没有数据")
 		return
 	}
 
 	// ✅ 新增：检查是否有 context 和 timing 信息
-	contextStr, hasContext := txMsg["context"].(string)
-	timing, hasTiming := txMsg["timing"].(map[string]interface{})
+	contextStr := txMsg.Context
+	hasContext := contextStr != ""
+	hasTiming := txMsg.Timing != nil
 
 	// 构建 PULL_RESP
 	resp := bytes.NewBuffer(nil)
@@ -461,10 +659,13 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 	resp.WriteByte(PullResp)
 
 	// ✅ 添加常量定义
-	const MAX_TIMESTAMP = uint64(4294967295)      // uint32 最大值
-	const OVERFLOW_THRESHOLD = uint64(4000000000) // 40亿，接近溢出的阈值
-	const MIN_PREPARE_TIME = uint64(200000)       // 200ms 最小准备时间
-	const MIN_SAFE_DELAY = uint64(50000)          // 50ms 最小安全延迟
+	const MAX_TIMESTAMP = uint64(4294967295) // uint32 最大值
+
+	// 时间余量来自配置（可按网关覆盖），单位微秒
+	margins := u.timing.ForGateway(gatewayID)
+	OVERFLOW_THRESHOLD := uint64(margins.OverflowThreshold)           // 接近溢出的阈值
+	MIN_PREPARE_TIME := uint64(margins.MinPrepareTime.Microseconds()) // 最小准备时间
+	MIN_SAFE_DELAY := uint64(margins.MinSafeDelay.Microseconds())     // 最小安全延迟
 
 	var jsonStr string
 
@@ -478,7 +679,7 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 				// 从 context 中获取原始时间戳
 				if uplinkTmst, ok := context["tmst"].(float64); ok {
 					// 获取延迟时间
-					if delayStr, ok := timing["delay"].(string); ok {
+					if delayStr := txMsg.Timing.Delay; delayStr != "" {
 						// 解析延迟（如 "1s" 或 "1000ms"）
 						var delayUs uint64
 						if strings.HasSuffix(delayStr, "ms") {
@@ -493,13 +694,13 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 
 						// ✅ 新增：检查时间戳年龄，避免使用过期的时间戳
 						if uplinkTmstUint < 60000000 { // 60秒
-							log.Warn().
+							logging.Ctx(traceCtx).Warn().
 								Uint64("uplinkTmst", uplinkTmstUint).
 								Msg("上行时间戳太小，使用即时发送")
 							jsonStr = u.createImmediateTxpk(txpk)
 						} else if uplinkTmstUint > OVERFLOW_THRESHOLD {
 							// 时间戳过大，使用即时发送
-							log.Warn().
+							logging.Ctx(traceCtx).Warn().
 								Uint64("uplinkTmst", uplinkTmstUint).
 								Str("gateway", gatewayID).
 								Msg("时间戳接近溢出，改用即时发送")
@@ -515,28 +716,28 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 
 								// 确保有足够的时间
 								if downlinkTmst < MIN_SAFE_DELAY {
-									log.Warn().
+									logging.Ctx(traceCtx).Warn().
 										Uint64("wrappedTmst", downlinkTmst).
 										Msg("溢出后时间不足，使用即时发送")
 									jsonStr = u.createImmediateTxpk(txpk)
 								} else {
 									// 使用溢出后的时间戳
 									jsonStr = u.createDelayedTxpk(txpk, downlinkTmst)
-									log.Info().
+									logging.Ctx(traceCtx).Info().
 										Uint64("originalTmst", uplinkTmstUint+delayUs).
 										Uint64("wrappedTmst", downlinkTmst).
 										Msg("时间戳溢出，使用模运算处理")
 								}
 							} else if downlinkTmst < uplinkTmstUint+MIN_PREPARE_TIME {
 								// ✅ 确保有足够的准备时间
-								log.Warn().
+								logging.Ctx(traceCtx).Warn().
 									Uint64("delay", delayUs).
 									Msg("延迟太短，增加最小准备时间")
 								downlinkTmst = uplinkTmstUint + MIN_PREPARE_TIME
 								jsonStr = u.createDelayedTxpk(txpk, downlinkTmst)
 							} else if downlinkTmst < uplinkTmstUint {
 								// 下行时间戳小于上行时间戳（不应该发生）
-								log.Error().
+								logging.Ctx(traceCtx).Error().
 									Uint64("uplinkTmst", uplinkTmstUint).
 									Uint64("downlinkTmst", downlinkTmst).
 									Msg("计算错误：下行时间戳小于上行时间戳")
@@ -544,7 +745,7 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 							} else {
 								// 正常情况
 								jsonStr = u.createDelayedTxpk(txpk, downlinkTmst)
-								log.Info().
+								logging.FrameCtx(traceCtx).Info().
 									Str("gateway", gatewayID).
 									Str("mode", "context_delay").
 									Uint64("uplinkTmst", uplinkTmstUint).
@@ -560,43 +761,37 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 
 		// 如果 context 解析失败，继续使用原有逻辑
 		if jsonStr == "" {
-			log.Warn().Msg("context 解析失败，回退到原有逻辑")
+			logging.Ctx(traceCtx).Warn().Msg("context 解析失败，回退到原有逻辑")
 		}
 	}
 
 	// 如果没有使用 context 方式，使用原有逻辑
 	if jsonStr == "" {
 		// 检查是否是即时发送模式
-		if imme, ok := txpk["imme"].(bool); ok && imme {
+		if txpk.Imme {
 			// 即时发送模式
 			jsonStr = u.createImmediateTxpk(txpk)
-			log.Info().
+			logging.FrameCtx(traceCtx).Info().
 				Str("gateway", gatewayID).
 				Str("mode", "immediate").
 				Msg("使用即时发送模式")
+		} else if txpk.Tmms != nil {
+			// GPS 时间发送模式，网关按 GPS 绝对时间发送
+			jsonStr = u.createGPSTxpk(txpk)
+			logging.FrameCtx(traceCtx).Info().
+				Str("gateway", gatewayID).
+				Uint64("tmms", *txpk.Tmms).
+				Msg("使用 GPS 时间发送模式")
 		} else {
 			// 延时发送模式，需要 tmst
-			var tmstValue uint64
-			switch v := txpk["tmst"].(type) {
-			case float64:
-				tmstValue = uint64(v)
-			case uint64:
-				tmstValue = v
-			case int64:
-				tmstValue = uint64(v)
-			case nil:
-				log.Error().Msg("延时发送模式但 tmst 为 null")
-				return
-			default:
-				log.Error().
-					Interface("tmst", v).
-					Str("type", fmt.Sprintf("%T", v)).
-					Msg("无法解析 tmst 值")
+			if txpk.Tmst == nil {
+				logging.Ctx(traceCtx).Error().Msg("延时发送模式但 tmst 为 null")
 				return
 			}
+			tmstValue := uint64(*txpk.Tmst)
 
 			jsonStr = u.createDelayedTxpk(txpk, tmstValue)
-			log.Info().
+			logging.FrameCtx(traceCtx).Info().
 				Str("gateway", gatewayID).
 				Uint64("tmst", tmstValue).
 				Msg("使用延时发送模式")
@@ -605,10 +800,14 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 
 	resp.Write([]byte(jsonStr))
 
-	// 发送到网关的 PULL 地址
-	n, err := u.conn.WriteToUDP(resp.Bytes(), gw.PullAddr)
+	// 从收到 PULL_DATA 的 socket 发送到网关的 PULL 地址
+	conn := gw.PullConn
+	if conn == nil {
+		conn = u.conns[0]
+	}
+	n, err := conn.WriteToUDP(resp.Bytes(), gw.PullAddr)
 	if err != nil {
-		log.Error().
+		logging.Ctx(traceCtx).Error().
 			Err(err).
 			Str("gateway", gatewayID).
 			Str("pullAddr", gw.PullAddr.String()).
@@ -616,7 +815,7 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 		return
 	}
 
-	log.Info().
+	logging.FrameCtx(traceCtx).Info().
 		Str("gateway", gatewayID).
 		Int("bytes", n).
 		Str("pullAddr", gw.PullAddr.String()).
@@ -626,63 +825,35 @@ func (u *UDPPacketForwarder) sendDownlink(gatewayID string, txMsg map[string]int
 }
 
 // 辅助函数：创建即时发送的txpk
-func (u *UDPPacketForwarder) createImmediateTxpk(txpk map[string]interface{}) string {
-	return fmt.Sprintf(`{"txpk":{"imme":true,"rfch":%d,"powe":%d,"ant":%d,"brd":%d,"freq":%.1f,"modu":"%v","datr":"%v","codr":"%v","ipol":%v,"size":%d,"data":"%v"}}`,
-		getInt(txpk, "rfch"),
-		getInt(txpk, "powe"),
-		getInt(txpk, "ant"),
-		getInt(txpk, "brd"),
-		txpk["freq"],
-		txpk["modu"],
-		txpk["datr"],
-		txpk["codr"],
-		txpk["ipol"],
-		getInt(txpk, "size"),
-		txpk["data"],
-	)
+func (u *UDPPacketForwarder) createImmediateTxpk(txpk models.TXPacket) string {
+	txpk.Imme = true
+	txpk.Tmst = nil
+	txpk.Tmms = nil
+	return pullRespJSON(txpk)
 }
 
 // 辅助函数：创建延时发送的txpk
-func (u *UDPPacketForwarder) createDelayedTxpk(txpk map[string]interface{}, tmst uint64) string {
-	return fmt.Sprintf(`{"txpk":{"imme":false,"rfch":%d,"powe":%d,"ant":%d,"brd":%d,"tmst":%d,"freq":%.1f,"modu":"%v","datr":"%v","codr":"%v","ipol":%v,"size":%d,"data":"%v"}}`,
-		getInt(txpk, "rfch"),
-		getInt(txpk, "powe"),
-		getInt(txpk, "ant"),
-		getInt(txpk, "brd"),
-		tmst,
-		txpk["freq"],
-		txpk["modu"],
-		txpk["datr"],
-		txpk["codr"],
-		txpk["ipol"],
-		getInt(txpk, "size"),
-		txpk["data"],
-	)
+func (u *UDPPacketForwarder) createDelayedTxpk(txpk models.TXPacket, tmst uint64) string {
+	ts := uint32(tmst)
+	txpk.Imme = false
+	txpk.Tmst = &ts
+	txpk.Tmms = nil
+	return pullRespJSON(txpk)
 }
 
-// 添加辅助函数
-func getInt(m map[string]interface{}, key string) int {
-	switch v := m[key].(type) {
-	case float64:
-		return int(v)
-	case int:
-		return v
-	case int64:
-		return int(v)
-	case string:
-		if i, err := strconv.Atoi(v); err == nil {
-			return i
-		}
-	}
-
-	// 添加调试日志
-	log.Warn().
-		Str("key", key).
-		Interface("value", m[key]).
-		Interface("type", fmt.Sprintf("%T", m[key])).
-		Msg("getInt 无法转换，返回默认值 0")
+// 辅助函数：创建按 GPS 时间发送的txpk
+func (u *UDPPacketForwarder) createGPSTxpk(txpk models.TXPacket) string {
+	txpk.Imme = false
+	txpk.Tmst = nil
+	return pullRespJSON(txpk)
+}
 
-	return 0
+// pullRespJSON PULL_RESP 的 JSON 负载
+func pullRespJSON(txpk models.TXPacket) string {
+	data, _ := json.Marshal(struct {
+		TXPK models.TXPacket `json:"txpk"`
+	}{txpk})
+	return string(data)
 }
 
 // cleanupGateways 清理离线网关
@@ -704,6 +875,7 @@ func (u *UDPPacketForwarder) cleanupGateways(ctx context.Context) {
 				}
 			}
 			u.mu.Unlock()
+			u.admission.sweep()
 		}
 	}
 }
@@ -717,39 +889,39 @@ func (u *UDPPacketForwarder) updateGatewayInDB(gatewayID string) {
 
 	ctx := context.Background()
 
-	// 解析网关ID
-	var gwID models.EUI64
-
-	// 从十六进制字符串解析
-	if len(gatewayID) != 16 {
-		log.Error().Str("gateway", gatewayID).Msg("无效的网关ID长度")
+	// 解析网关ID，数据库中与格式无关
+	eui, err := lorawan.ParseGatewayID(gatewayID)
+	if err != nil {
+		log.Error().Err(err).Str("gateway", gatewayID).Msg("解析网关ID失败")
 		return
 	}
+	gwID := models.EUI64(eui)
 
-	// 解析十六进制字符串到字节数组
-	for i := 0; i < 8; i++ {
-		var b byte
-		_, err := fmt.Sscanf(gatewayID[i*2:i*2+2], "%02x", &b)
-		if err != nil {
-			log.Error().Err(err).Str("gateway", gatewayID).Msg("解析网关ID失败")
-			return
-		}
-		gwID[i] = b
+	// 最近一次 stat 统计
+	var lastStat *GatewayStat
+	u.mu.RLock()
+	if gw, ok := u.gateways[gatewayID]; ok {
+		lastStat = gw.LastStat
 	}
+	u.mu.RUnlock()
 
 	// 获取或创建网关
 	gateway, err := u.store.GetGateway(ctx, lorawan.EUI64(gwID))
 	if err != nil {
 		if err == storage.ErrNotFound {
-			// 网关不存在，创建新网关
-			log.Info().Str("gateway", gatewayID).Msg("自动注册新网关")
+			// 网关不存在，允许自动注册时在配置的租户下创建
+			tenantID, ok := u.canAutoRegister(eui)
+			if !ok {
+				return
+			}
+			log.Info().Str("gateway", gatewayID).Str("tenant", tenantID.String()).Msg("自动注册新网关")
 
 			gateway = &models.Gateway{
 				GatewayID:   gwID,
-				Name:        fmt.Sprintf("Gateway %s", gatewayID[:8]),
+				Name:        fmt.Sprintf("Gateway %s", eui.String()[:8]),
 				Description: "Auto-registered gateway",
 				TenantModel: models.TenantModel{
-					TenantID: uuid.MustParse("11111111-1111-1111-1111-111111111111"),
+					TenantID: tenantID,
 				},
 			}
 
@@ -757,12 +929,14 @@ func (u *UDPPacketForwarder) updateGatewayInDB(gatewayID string) {
 			now := time.Now()
 			gateway.FirstSeenAt = &now
 			gateway.LastSeenAt = &now
+			setGatewayStat(gateway, lastStat)
 
 			if err := u.store.CreateGateway(ctx, gateway); err != nil {
 				log.Error().Err(err).Str("gateway", gatewayID).Msg("创建网关失败")
 				return
 			}
 
+			u.admission.remember(eui.String(), true)
 			log.Info().Str("gateway", gatewayID).Msg("网关已自动注册")
 		} else {
 			log.Error().Err(err).Str("gateway", gatewayID).Msg("获取网关失败")
@@ -777,6 +951,7 @@ func (u *UDPPacketForwarder) updateGatewayInDB(gatewayID string) {
 		if gateway.FirstSeenAt == nil {
 			gateway.FirstSeenAt = &now
 		}
+		setGatewayStat(gateway, lastStat)
 
 		// 更新网关
 		if err := u.store.UpdateGateway(ctx, gateway); err != nil {
@@ -0,0 +1,302 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+const testGatewayID = "0102030405060708"
+
+// newTestForwarder creates a forwarder on a random local port publishing to a test
+// NATS server, and a client subscribed to subject on the same server
+func newTestForwarder(t *testing.T, subject string) (*UDPPacketForwarder, *nats.Subscription) {
+	t.Helper()
+
+	srv := natstest.Run(t)
+	u, err := NewUDPPacketForwarder([]string{"127.0.0.1:0"}, srv.Conn(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeConns(u.conns) })
+
+	nc := srv.Conn(t)
+	sub, err := nc.SubscribeSync(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+	return u, sub
+}
+
+// testRXPacket returns an rxpk as decoded from a PUSH_DATA JSON body
+func testRXPacket(phy []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"tmst": float64(1000000),
+		"chan": float64(2),
+		"rfch": float64(0),
+		"freq": 486.3,
+		"stat": float64(1),
+		"modu": "LORA",
+		"datr": "SF7BW125",
+		"codr": "4/5",
+		"rssi": float64(-60),
+		"lsnr": 9.5,
+		"size": float64(len(phy)),
+		"data": base64.StdEncoding.EncodeToString(phy),
+	}
+}
+
+// nextRX waits for the forwarded uplink, nil when none arrives
+func nextRX(t *testing.T, sub *nats.Subscription) *models.GatewayRXMessage {
+	t.Helper()
+
+	msg, err := sub.NextMsg(200 * time.Millisecond)
+	if err != nil {
+		return nil
+	}
+	var rx models.GatewayRXMessage
+	if err := json.Unmarshal(msg.Data, &rx); err != nil {
+		t.Fatalf("decode rx message: %v", err)
+	}
+	return &rx
+}
+
+func TestHandleRXPacketMaxPHYPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int
+		size      int
+		forwarded bool
+	}{
+		{"check disabled", 0, 300, true},
+		{"within limit", 64, 64, true},
+		{"oversized", 64, 65, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, sub := newTestForwarder(t, "gateway.*.rx")
+			u.SetMaxPHYPayloadSize(tt.max)
+
+			phy := bytes.Repeat([]byte{0x40}, tt.size)
+			u.handleRXPacket(testGatewayID, testRXPacket(phy))
+
+			rx := nextRX(t, sub)
+			if (rx != nil) != tt.forwarded {
+				t.Fatalf("forwarded = %v, want %v", rx != nil, tt.forwarded)
+			}
+			if rx != nil && rx.RXPK.Data != base64.StdEncoding.EncodeToString(phy) {
+				t.Errorf("forwarded data = %q", rx.RXPK.Data)
+			}
+
+			wantDropped := uint64(0)
+			if !tt.forwarded {
+				wantDropped = 1
+			}
+			if got := u.DroppedOversized(); got != wantDropped {
+				t.Errorf("DroppedOversized() = %d, want %d", got, wantDropped)
+			}
+		})
+	}
+}
+
+// semtechPacket builds a PUSH_DATA/PULL_DATA header followed by body
+func semtechPacket(identifier byte, token uint16, gatewayMAC [8]byte, body []byte) []byte {
+	pkt := []byte{ProtocolVersion, byte(token >> 8), byte(token), identifier}
+	pkt = append(pkt, gatewayMAC[:]...)
+	return append(pkt, body...)
+}
+
+// readUDP reads one packet, failing the test on timeout
+func readUDP(t *testing.T, conn *net.UDPConn) ([]byte, *net.UDPAddr) {
+	t.Helper()
+
+	buf := make([]byte, 65507)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, addr, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read from %s: %v", conn.LocalAddr(), err)
+	}
+	return buf[:n], addr
+}
+
+func TestMultipleBindAddresses(t *testing.T) {
+	u, err := NewUDPPacketForwarder([]string{"127.0.0.1:0", "127.0.0.1:0"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.conns) != 2 {
+		t.Fatalf("%d sockets bound, want 2", len(u.conns))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var readers sync.WaitGroup
+	for _, conn := range u.conns {
+		readers.Add(1)
+		go func(conn *net.UDPConn) {
+			defer readers.Done()
+			u.readLoop(ctx, conn)
+		}(conn)
+	}
+	t.Cleanup(func() {
+		cancel()
+		readers.Wait()
+		closeConns(u.conns)
+	})
+
+	// 每个网关向不同的监听地址发送 PULL_DATA
+	gateways := make([]*net.UDPConn, len(u.conns))
+	for i, bind := range u.conns {
+		gw, err := net.DialUDP("udp", nil, bind.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { gw.Close() })
+		gateways[i] = gw
+
+		mac := [8]byte{1, 2, 3, 4, 5, 6, 7, byte(i)}
+		gw.Write(semtechPacket(PullData, uint16(0x1000+i), mac, nil))
+
+		ack, from := readUDP(t, gw)
+		if len(ack) != 4 || ack[3] != PullAck {
+			t.Fatalf("gateway %d: got %x, want PULL_ACK", i, ack)
+		}
+		if from.String() != bind.LocalAddr().String() {
+			t.Errorf("gateway %d: PULL_ACK from %s, want %s", i, from, bind.LocalAddr())
+		}
+	}
+
+	// 下行从收到该网关 PULL_DATA 的 socket 发出
+	for i, gw := range gateways {
+		mac := [8]byte{1, 2, 3, 4, 5, 6, 7, byte(i)}
+		u.sendDownlink(lorawan.FormatGatewayID(mac, ""), &models.GatewayTXMessage{
+			TXPK: models.TXPacket{Imme: true, Freq: 506.7, Data: "AQID"},
+		})
+
+		resp, from := readUDP(t, gw)
+		if len(resp) < 4 || resp[3] != PullResp {
+			t.Fatalf("gateway %d: got %x, want PULL_RESP", i, resp)
+		}
+		if from.String() != u.conns[i].LocalAddr().String() {
+			t.Errorf("gateway %d: PULL_RESP from %s, want %s", i, from, u.conns[i].LocalAddr())
+		}
+	}
+}
+
+// pullGateway starts the read loops and registers a gateway with PULL_DATA, returning
+// the gateway's socket for reading PULL_RESP
+func pullGateway(t *testing.T, u *UDPPacketForwarder, mac [8]byte) *net.UDPConn {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var readers sync.WaitGroup
+	for _, conn := range u.conns {
+		readers.Add(1)
+		go func(conn *net.UDPConn) {
+			defer readers.Done()
+			u.readLoop(ctx, conn)
+		}(conn)
+	}
+	t.Cleanup(func() {
+		cancel()
+		closeConns(u.conns)
+		readers.Wait()
+	})
+
+	gw, err := net.DialUDP("udp", nil, u.conns[0].LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gw.Close() })
+
+	gw.Write(semtechPacket(PullData, 0x1000, mac, nil))
+	if ack, _ := readUDP(t, gw); len(ack) != 4 || ack[3] != PullAck {
+		t.Fatalf("got %x, want PULL_ACK", ack)
+	}
+	return gw
+}
+
+func TestDownlinkTimingMargins(t *testing.T) {
+	mac := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	nearWrap := uint32(4294900000) // 100ms 后回绕到 32704
+
+	tests := []struct {
+		name       string
+		timing     config.DownlinkTimingConfig
+		uplinkTmst uint32
+		delay      string
+		wantTmst   uint32 // 0 表示即时发送
+	}{
+		{"default delayed", config.DownlinkTimingConfig{}, 100000000, "1000ms", 101000000},
+		{"default prepare time", config.DownlinkTimingConfig{}, 100000000, "100ms", 100200000},
+		{"shorter prepare time", config.DownlinkTimingConfig{MinPrepareTime: 50 * time.Millisecond}, 100000000, "100ms", 100100000},
+		{"longer prepare time", config.DownlinkTimingConfig{MinPrepareTime: 1500 * time.Millisecond}, 100000000, "1s", 101500000},
+		{"default overflow threshold", config.DownlinkTimingConfig{}, 4100000000, "1s", 0},
+		{"raised overflow threshold", config.DownlinkTimingConfig{OverflowThreshold: 4200000000}, 4100000000, "1s", 4101000000},
+		{"lowered overflow threshold", config.DownlinkTimingConfig{OverflowThreshold: 3000000000}, 3500000000, "1s", 0},
+		{"wrap within default safe delay", config.DownlinkTimingConfig{OverflowThreshold: 4294967295}, nearWrap, "100ms", 0},
+		{"wrap with shorter safe delay", config.DownlinkTimingConfig{OverflowThreshold: 4294967295, MinSafeDelay: 10 * time.Millisecond}, nearWrap, "100ms", 32704},
+		{"gateway override", config.DownlinkTimingConfig{
+			Gateways: map[string]config.DownlinkTimingConfig{
+				lorawan.FormatGatewayID(mac, ""): {MinPrepareTime: 50 * time.Millisecond},
+			},
+		}, 100000000, "100ms", 100100000},
+		{"other gateway override", config.DownlinkTimingConfig{
+			Gateways: map[string]config.DownlinkTimingConfig{
+				"aabbccddeeff0011": {MinPrepareTime: 50 * time.Millisecond},
+			},
+		}, 100000000, "100ms", 100200000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := NewUDPPacketForwarder([]string{"127.0.0.1:0"}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.SetDownlinkTiming(tt.timing)
+			gw := pullGateway(t, u, mac)
+
+			uplinkCtx, _ := json.Marshal(map[string]interface{}{"tmst": tt.uplinkTmst})
+			u.sendDownlink(lorawan.FormatGatewayID(mac, ""), &models.GatewayTXMessage{
+				TXPK:    models.TXPacket{Freq: 500.3, Data: "AQID"},
+				Context: base64.StdEncoding.EncodeToString(uplinkCtx),
+				Timing:  &models.TXTiming{Delay: tt.delay},
+			})
+
+			resp, _ := readUDP(t, gw)
+			if len(resp) < 4 || resp[3] != PullResp {
+				t.Fatalf("got %x, want PULL_RESP", resp)
+			}
+			var body struct {
+				TXPK models.TXPacket `json:"txpk"`
+			}
+			if err := json.Unmarshal(resp[4:], &body); err != nil {
+				t.Fatalf("decode PULL_RESP: %v", err)
+			}
+
+			if tt.wantTmst == 0 {
+				if !body.TXPK.Imme || body.TXPK.Tmst != nil {
+					t.Errorf("txpk imme = %v, tmst = %v, want immediate", body.TXPK.Imme, body.TXPK.Tmst)
+				}
+				return
+			}
+			if body.TXPK.Imme || body.TXPK.Tmst == nil || *body.TXPK.Tmst != tt.wantTmst {
+				t.Errorf("txpk imme = %v, tmst = %v, want %d", body.TXPK.Imme, body.TXPK.Tmst, tt.wantTmst)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package geolocation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+// ErrNoLocation 没有足够的网关位置信息
+var ErrNoLocation = errors.New("no gateway location available")
+
+// RXInfo 单个网关对一次上行的接收信息
+type RXInfo struct {
+	GatewayID string    `json:"gatewayID"`
+	RSSI      float64   `json:"rssi"`
+	SNR       float64   `json:"snr"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  float64   `json:"altitude"`
+	Timestamp uint64    `json:"timestamp,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Geolocator 设备定位解析器
+type Geolocator interface {
+	Resolve(frames []RXInfo) (lat, lon float64, err error)
+}
+
+// RSSICentroid 按 RSSI 加权的网关质心定位
+type RSSICentroid struct{}
+
+// Resolve 计算 RSSI 加权质心，信号越强的网关权重越大
+func (RSSICentroid) Resolve(frames []RXInfo) (float64, float64, error) {
+	var sumW, sumLat, sumLon float64
+
+	for _, f := range frames {
+		if f.Latitude == 0 && f.Longitude == 0 {
+			continue
+		}
+		// dBm 转换为线性功率作为权重
+		w := math.Pow(10, f.RSSI/10)
+		sumW += w
+		sumLat += f.Latitude * w
+		sumLon += f.Longitude * w
+	}
+
+	if sumW == 0 {
+		return 0, 0, ErrNoLocation
+	}
+
+	return sumLat / sumW, sumLon / sumW, nil
+}
+
+// HTTPResolver 调用外部 HTTP 定位服务
+type HTTPResolver struct {
+	URL    string
+	Token  string
+	client *http.Client
+}
+
+// NewHTTPResolver 创建外部 HTTP 定位解析器
+func NewHTTPResolver(url, token string, timeout time.Duration) *HTTPResolver {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return &HTTPResolver{
+		URL:    url,
+		Token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Resolve 把接收信息 POST 给外部服务，期望返回 {"latitude":..,"longitude":..}
+func (h *HTTPResolver) Resolve(frames []RXInfo) (float64, float64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"rxInfo": frames,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("request resolver: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, 0, fmt.Errorf("resolver returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, 0, fmt.Errorf("decode response: %w", err)
+	}
+
+	return result.Latitude, result.Longitude, nil
+}
+
+// Service 按租户选择定位解析器
+type Service struct {
+	defaultGeo Geolocator
+	tenants    map[uuid.UUID]Geolocator
+	maxFrames  int
+}
+
+// NewService 根据配置创建定位服务
+func NewService(cfg config.GeolocationConfig) *Service {
+	s := &Service{
+		defaultGeo: newGeolocator(cfg.Default),
+		tenants:    make(map[uuid.UUID]Geolocator),
+		maxFrames:  cfg.MaxFrames,
+	}
+
+	if s.maxFrames <= 0 {
+		s.maxFrames = 10
+	}
+
+	for id, tc := range cfg.Tenants {
+		tenantID, err := uuid.Parse(id)
+		if err != nil {
+			log.Warn().Str("tenant", id).Msg("定位配置中的租户ID无效，已忽略")
+			continue
+		}
+		s.tenants[tenantID] = newGeolocator(tc)
+	}
+
+	return s
+}
+
+// Register 为租户注册定位解析器
+func (s *Service) Register(tenantID uuid.UUID, geo Geolocator) {
+	s.tenants[tenantID] = geo
+}
+
+// ForTenant 获取租户使用的定位解析器
+func (s *Service) ForTenant(tenantID uuid.UUID) Geolocator {
+	if geo, ok := s.tenants[tenantID]; ok {
+		return geo
+	}
+	return s.defaultGeo
+}
+
+// MaxFrames 参与定位的最近上行帧数
+func (s *Service) MaxFrames() int {
+	return s.maxFrames
+}
+
+func newGeolocator(cfg config.GeolocatorConfig) Geolocator {
+	switch cfg.Type {
+	case "http":
+		if cfg.URL == "" {
+			log.Warn().Msg("HTTP 定位服务未配置 URL，使用 RSSI 质心定位")
+			return RSSICentroid{}
+		}
+		return NewHTTPResolver(cfg.URL, cfg.Token, cfg.Timeout)
+	default:
+		return RSSICentroid{}
+	}
+}
@@ -0,0 +1,161 @@
+package geolocation
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+func TestRSSICentroidResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  []RXInfo
+		lat     float64
+		lon     float64
+		wantErr error
+	}{
+		{
+			name:    "no frames",
+			wantErr: ErrNoLocation,
+		},
+		{
+			name:    "gateways without location",
+			frames:  []RXInfo{{GatewayID: "a", RSSI: -80}},
+			wantErr: ErrNoLocation,
+		},
+		{
+			name:   "single gateway",
+			frames: []RXInfo{{GatewayID: "a", RSSI: -80, Latitude: 31, Longitude: 121}},
+			lat:    31,
+			lon:    121,
+		},
+		{
+			name: "equal RSSI is the midpoint",
+			frames: []RXInfo{
+				{GatewayID: "a", RSSI: -90, Latitude: 30, Longitude: 120},
+				{GatewayID: "b", RSSI: -90, Latitude: 32, Longitude: 122},
+			},
+			lat: 31,
+			lon: 121,
+		},
+		{
+			// 10 dB 更强的网关权重是另一个的 10 倍
+			name: "stronger gateway weighs more",
+			frames: []RXInfo{
+				{GatewayID: "a", RSSI: -80, Latitude: 30, Longitude: 120},
+				{GatewayID: "b", RSSI: -90, Latitude: 41, Longitude: 131},
+			},
+			lat: 31,
+			lon: 121,
+		},
+		{
+			name: "gateway without location is skipped",
+			frames: []RXInfo{
+				{GatewayID: "a", RSSI: -60},
+				{GatewayID: "b", RSSI: -90, Latitude: 31, Longitude: 121},
+			},
+			lat: 31,
+			lon: 121,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, err := RSSICentroid{}.Resolve(tt.frames)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if math.Abs(lat-tt.lat) > 1e-9 || math.Abs(lon-tt.lon) > 1e-9 {
+				t.Errorf("Resolve() = %v, %v, want %v, %v", lat, lon, tt.lat, tt.lon)
+			}
+		})
+	}
+}
+
+func TestHTTPResolver(t *testing.T) {
+	var gotAuth string
+	var gotFrames []RXInfo
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		var req struct {
+			RXInfo []RXInfo `json:"rxInfo"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		gotFrames = req.RXInfo
+		w.Write([]byte(`{"latitude": 22.5, "longitude": 114.1}`))
+	}))
+	defer srv.Close()
+
+	frames := []RXInfo{{GatewayID: "0102030405060708", RSSI: -70, Latitude: 22, Longitude: 114}}
+	lat, lon, err := NewHTTPResolver(srv.URL, "secret", 0).Resolve(frames)
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if lat != 22.5 || lon != 114.1 {
+		t.Errorf("Resolve() = %v, %v, want 22.5, 114.1", lat, lon)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	if len(gotFrames) != 1 || gotFrames[0].GatewayID != "0102030405060708" {
+		t.Errorf("resolver received %v", gotFrames)
+	}
+}
+
+func TestHTTPResolverErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, _, err := NewHTTPResolver(srv.URL, "", 0).Resolve(nil); err == nil {
+		t.Error("Resolve() succeeded on a 503 response")
+	}
+}
+
+type stubGeolocator struct{ lat, lon float64 }
+
+func (s stubGeolocator) Resolve([]RXInfo) (float64, float64, error) {
+	return s.lat, s.lon, nil
+}
+
+func TestServiceForTenant(t *testing.T) {
+	configured := uuid.New()
+	registered := uuid.New()
+	s := NewService(config.GeolocationConfig{
+		Tenants: map[string]config.GeolocatorConfig{
+			configured.String(): {Type: "http", URL: "http://resolver.example"},
+			"not-a-uuid":        {Type: "http", URL: "http://ignored.example"},
+		},
+	})
+	s.Register(registered, stubGeolocator{1, 2})
+
+	if _, ok := s.ForTenant(uuid.New()).(RSSICentroid); !ok {
+		t.Errorf("default tenant uses %T, want RSSICentroid", s.ForTenant(uuid.New()))
+	}
+	if _, ok := s.ForTenant(configured).(*HTTPResolver); !ok {
+		t.Errorf("configured tenant uses %T, want *HTTPResolver", s.ForTenant(configured))
+	}
+	if lat, lon, _ := s.ForTenant(registered).Resolve(nil); lat != 1 || lon != 2 {
+		t.Errorf("registered tenant resolved %v, %v, want the stub", lat, lon)
+	}
+	if len(s.tenants) != 2 {
+		t.Errorf("%d tenants configured, want the invalid ID skipped", len(s.tenants))
+	}
+	if s.MaxFrames() != 10 {
+		t.Errorf("MaxFrames() = %d, want default 10", s.MaxFrames())
+	}
+}
+
+func TestNewGeolocatorHTTPWithoutURL(t *testing.T) {
+	if _, ok := newGeolocator(config.GeolocatorConfig{Type: "http"}).(RSSICentroid); !ok {
+		t.Error("http resolver without a URL should fall back to the RSSI centroid")
+	}
+}
@@ -0,0 +1,32 @@
+package integration
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// forwardingMuted 设备关闭了集成转发（forward_disabled）时返回 true，上行仍由网络服务器保存；
+// DevEUI 无法解析或查询设备失败时照常转发
+func (s *ForwarderService) forwardingMuted(ctx context.Context, devEUIStr string) bool {
+	b, err := hex.DecodeString(devEUIStr)
+	if err != nil || len(b) != 8 {
+		return false
+	}
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], b)
+
+	device, err := s.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		log.Warn().Err(err).Str("devEUI", devEUIStr).Msg("查询设备失败，照常转发")
+		return false
+	}
+	if device.ForwardDisabled {
+		log.Debug().Str("devEUI", devEUIStr).Msg("设备已关闭集成转发，跳过")
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+func TestForwardDisabledDeviceMuted(t *testing.T) {
+	const devEUI = "70b3d57ed0000001"
+
+	tests := []struct {
+		name          string
+		event         string
+		device        bool // false means the device is not in the store
+		muted         bool
+		replay        bool
+		wantForwarded bool
+	}{
+		{"uplink", "rx", true, false, false, true},
+		{"muted uplink", "rx", true, true, false, false},
+		// Replays are requested explicitly through the API
+		{"muted replay", "rx", true, true, true, true},
+		{"unknown device", "rx", false, false, false, true},
+		{"join", "join", true, false, false, true},
+		{"muted join", "join", true, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, received := httpSink(t)
+			store := storagetest.New()
+			ctx := context.Background()
+			app := &models.Application{
+				Name:            "muted",
+				HTTPIntegration: &models.Variables{"enabled": true, "endpoint": sink.URL},
+			}
+			if err := store.CreateApplication(ctx, app); err != nil {
+				t.Fatal(err)
+			}
+			if tt.device {
+				device := &models.Device{DevEUI: models.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x01}, ApplicationID: app.ID, Name: "device", ForwardDisabled: tt.muted}
+				if err := store.CreateDevice(ctx, device); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var data []byte
+			s := NewForwarderService(nil, store)
+			subject := "application." + app.ID.String() + ".device." + devEUI + "." + tt.event
+			if tt.event == "join" {
+				data, _ = json.Marshal(map[string]interface{}{"devEUI": devEUI, "devAddr": "01020304"})
+				s.handleJoinEvent(&nats.Msg{Subject: subject, Data: data})
+			} else {
+				data, _ = json.Marshal(map[string]interface{}{"devEUI": devEUI, "fCnt": 1, "data": []byte{0xab}, "replay": tt.replay})
+				s.handleUplinkData(&nats.Msg{Subject: subject, Data: data})
+			}
+
+			select {
+			case <-received:
+				if !tt.wantForwarded {
+					t.Error("muted device forwarded")
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tt.wantForwarded {
+					t.Error("not forwarded")
+				}
+			}
+		})
+	}
+}
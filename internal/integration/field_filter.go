@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"strings"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// alwaysForwarded 识别设备所需的字段，不受过滤影响
+var alwaysForwarded = map[string]bool{
+	"applicationID": true,
+	"devEUI":        true,
+}
+
+// filterForwardFields 按应用的字段过滤规则裁剪转发数据，rxInfo 会被复制，不修改共享的上行数据
+func filterForwardFields(data map[string]interface{}, filter *models.ForwardFieldFilter) map[string]interface{} {
+	if filter.Empty() {
+		return data
+	}
+
+	if len(filter.Allow) > 0 {
+		allowed := make(map[string]bool, len(filter.Allow))
+		for _, name := range filter.Allow {
+			allowed[name] = true
+		}
+		for key := range data {
+			if !allowed[key] && !alwaysForwarded[key] {
+				delete(data, key)
+			}
+		}
+	}
+
+	var rxInfoBlock []string
+	for _, name := range filter.Block {
+		if field, ok := strings.CutPrefix(name, "rxInfo."); ok {
+			rxInfoBlock = append(rxInfoBlock, field)
+			continue
+		}
+		if !alwaysForwarded[name] {
+			delete(data, name)
+		}
+	}
+
+	if rxInfo, ok := data["rxInfo"].([]map[string]interface{}); ok && len(rxInfoBlock) > 0 {
+		filtered := make([]map[string]interface{}, len(rxInfo))
+		for i, info := range rxInfo {
+			entry := make(map[string]interface{}, len(info))
+			for k, v := range info {
+				entry[k] = v
+			}
+			for _, field := range rxInfoBlock {
+				delete(entry, field)
+			}
+			filtered[i] = entry
+		}
+		data["rxInfo"] = filtered
+	}
+
+	return data
+}
@@ -0,0 +1,158 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+func TestFilterForwardFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     *models.ForwardFieldFilter
+		wantKeys   []string
+		wantRxInfo []map[string]interface{}
+	}{
+		{
+			name:       "no filter",
+			filter:     nil,
+			wantKeys:   []string{"applicationID", "data", "devEUI", "fCnt", "phyPayload", "rxInfo"},
+			wantRxInfo: []map[string]interface{}{{"gatewayID": "gw1", "rssi": -80, "location": "here"}},
+		},
+		{
+			name:     "allow keeps identity fields",
+			filter:   &models.ForwardFieldFilter{Allow: []string{"data"}},
+			wantKeys: []string{"applicationID", "data", "devEUI"},
+		},
+		{
+			name:       "block",
+			filter:     &models.ForwardFieldFilter{Block: []string{"phyPayload", "fCnt"}},
+			wantKeys:   []string{"applicationID", "data", "devEUI", "rxInfo"},
+			wantRxInfo: []map[string]interface{}{{"gatewayID": "gw1", "rssi": -80, "location": "here"}},
+		},
+		{
+			name:       "block rxInfo field",
+			filter:     &models.ForwardFieldFilter{Block: []string{"rxInfo.location"}},
+			wantKeys:   []string{"applicationID", "data", "devEUI", "fCnt", "phyPayload", "rxInfo"},
+			wantRxInfo: []map[string]interface{}{{"gatewayID": "gw1", "rssi": -80}},
+		},
+		{
+			name:       "allow and block",
+			filter:     &models.ForwardFieldFilter{Allow: []string{"data", "rxInfo"}, Block: []string{"rxInfo.rssi"}},
+			wantKeys:   []string{"applicationID", "data", "devEUI", "rxInfo"},
+			wantRxInfo: []map[string]interface{}{{"gatewayID": "gw1", "location": "here"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rxInfo := []map[string]interface{}{{"gatewayID": "gw1", "rssi": -80, "location": "here"}}
+			data := map[string]interface{}{
+				"applicationID": "app",
+				"devEUI":        "70b3d57ed0000001",
+				"fCnt":          1,
+				"data":          []byte{0xab},
+				"rxInfo":        rxInfo,
+				"phyPayload":    []byte{0x40},
+			}
+
+			got := filterForwardFields(data, tt.filter)
+
+			var keys []string
+			for k := range got {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if tt.wantRxInfo != nil && !reflect.DeepEqual(got["rxInfo"], tt.wantRxInfo) {
+				t.Errorf("rxInfo = %v, want %v", got["rxInfo"], tt.wantRxInfo)
+			}
+			// The uplink's rxInfo is shared with the other integrations
+			if _, ok := rxInfo[0]["location"]; !ok {
+				t.Error("filter modified the shared rxInfo")
+			}
+		})
+	}
+}
+
+func TestForwardFieldFilterValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *models.ForwardFieldFilter
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"allow", &models.ForwardFieldFilter{Allow: []string{"data", "rxInfo"}}, false},
+		{"block rxInfo field", &models.ForwardFieldFilter{Block: []string{"phyPayload", "rxInfo.location"}}, false},
+		{"allow rxInfo field", &models.ForwardFieldFilter{Allow: []string{"rxInfo.location"}}, true},
+		{"unknown allow", &models.ForwardFieldFilter{Allow: []string{"secret"}}, true},
+		{"unknown block", &models.ForwardFieldFilter{Block: []string{"rxInfo.secret"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForwardBlockedFieldsOmitted(t *testing.T) {
+	sink, received := httpSink(t)
+	store := storagetest.New()
+	app := &models.Application{
+		Name:              "filtered",
+		ForwardPHYPayload: true,
+		ForwardFields:     &models.ForwardFieldFilter{Block: []string{"phyPayload", "deviceName", "rxInfo.location"}},
+		HTTPIntegration:   &models.Variables{"enabled": true, "endpoint": sink.URL},
+	}
+	if err := store.CreateApplication(context.Background(), app); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"devEUI":     "70b3d57ed0000001",
+		"fCnt":       1,
+		"data":       []byte{0xab},
+		"phyPayload": []byte{0x40, 0xda},
+		"rxInfo":     []map[string]interface{}{{"gatewayID": "0102030405060708", "rssi": -80, "location": map[string]interface{}{"latitude": 30.5}}},
+	})
+	s := NewForwarderService(nil, store)
+	s.handleUplinkData(&nats.Msg{Subject: "application." + app.ID.String() + ".device.70b3d57ed0000001.rx", Data: data})
+
+	select {
+	case got := <-received:
+		for _, field := range []string{"phyPayload", "deviceName"} {
+			if _, ok := got[field]; ok {
+				t.Errorf("blocked field %s forwarded", field)
+			}
+		}
+		if got["data"] != "qw==" || got["devEUI"] != "70b3d57ed0000001" || got["fCnt"] != float64(1) {
+			t.Errorf("forwarded = %v", got)
+		}
+		rxInfo, _ := got["rxInfo"].([]interface{})
+		if len(rxInfo) != 1 {
+			t.Fatalf("rxInfo = %v", got["rxInfo"])
+		}
+		info := rxInfo[0].(map[string]interface{})
+		if _, ok := info["location"]; ok {
+			t.Error("blocked rxInfo.location forwarded")
+		}
+		if info["gatewayID"] != "0102030405060708" || info["rssi"] != float64(-80) {
+			t.Errorf("rxInfo = %v", info)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("uplink not forwarded")
+	}
+}
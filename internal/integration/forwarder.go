@@ -1,7 +1,6 @@
 package integration
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -16,6 +15,8 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 
+	"github.com/lorawan-server/lorawan-server-pro/internal/codec"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 )
@@ -31,6 +32,9 @@ type ForwarderService struct {
 	
 	// HTTP 客户端
 	httpClient *http.Client
+	
+	// 服务上下文，Start 时设置；HTTP 重试在关闭时停止等待
+	ctx context.Context
 }
 
 // NewForwarderService 创建转发服务
@@ -39,6 +43,7 @@ func NewForwarderService(nc *nats.Conn, store storage.Store) *ForwarderService {
 		nc:          nc,
 		store:       store,
 		mqttClients: make(map[uuid.UUID]mqtt.Client),
+		ctx:         context.Background(),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -47,12 +52,20 @@ func NewForwarderService(nc *nats.Conn, store storage.Store) *ForwarderService {
 
 // Start 启动转发服务
 func (s *ForwarderService) Start(ctx context.Context) error {
+	s.ctx = ctx
+	
 	// 订阅设备上行数据
 	sub, err := s.nc.Subscribe("application.*.device.*.rx", s.handleUplinkData)
 	if err != nil {
 		return fmt.Errorf("subscribe to uplink data: %w", err)
 	}
 
+	// 订阅重放的上行（只转发给集成，不经过网络层）
+	subReplay, err := s.nc.Subscribe("application.*.device.*.replay", s.handleUplinkData)
+	if err != nil {
+		return fmt.Errorf("subscribe to uplink replay: %w", err)
+	}
+
 	// 订阅入网事件
 	subJoin, err := s.nc.Subscribe("application.*.device.*.join", s.handleJoinEvent)
 	if err != nil {
@@ -69,6 +82,7 @@ func (s *ForwarderService) Start(ctx context.Context) error {
 	<-ctx.Done()
 	
 	sub.Unsubscribe()
+	subReplay.Unsubscribe()
 	subJoin.Unsubscribe()
 	s.closeAllMQTTConnections()
 	
@@ -114,9 +128,26 @@ func (s *ForwarderService) handleUplinkData(msg *nats.Msg) {
 		return
 	}
 
+	// 关闭了转发的设备不转发（通过 API 手动重放的上行除外）
+	if !uplinkData.Replay && s.forwardingMuted(ctx, uplinkData.DevEUI) {
+		return
+	}
+
+	// 原始 PHYPayload 只转发给开启了该选项的应用
+	if !app.ForwardPHYPayload {
+		uplinkData.PHYPayload = nil
+	}
+
 	// 执行 payload 解码（如果配置了）
-	if app.PayloadDecoder != "" && uplinkData.Data != nil {
-		decoded := s.decodePayload(app.PayloadDecoder, uplinkData.Data)
+	if app.PayloadCodec == codec.CayenneLPP && len(uplinkData.Data) > 0 {
+		decoded, err := codec.DecodeCayenneLPP(uplinkData.Data)
+		if err != nil {
+			log.Warn().Err(err).Str("devEUI", uplinkData.DevEUI).Msg("Cayenne LPP 解码失败")
+		} else {
+			uplinkData.Object = decoded
+		}
+	} else if app.PayloadDecoder != "" && len(uplinkData.Data) > 0 {
+		decoded := s.decodePayload(app.PayloadDecoder, uplinkData)
 		if decoded != nil {
 			uplinkData.Object = decoded
 		}
@@ -158,6 +189,10 @@ func (s *ForwarderService) handleJoinEvent(msg *nats.Msg) {
 		return
 	}
 
+	if s.forwardingMuted(ctx, joinEvent.DevEUI) {
+		return
+	}
+
 	// 转发入网事件
 	if s.isHTTPEnabled(app) {
 		go s.forwardJoinToHTTP(app, joinEvent)
@@ -170,6 +205,8 @@ func (s *ForwarderService) handleJoinEvent(msg *nats.Msg) {
 
 // forwardToHTTP 转发数据到 HTTP
 func (s *ForwarderService) forwardToHTTP(app *models.Application, data UplinkData) {
+	ctx := logging.WithTraceID(context.Background(), data.TraceID)
+
 	config := s.getHTTPConfig(app)
 	if config == nil || !config.Enabled {
 		return
@@ -190,56 +227,29 @@ func (s *ForwarderService) forwardToHTTP(app *models.Application, data UplinkDat
 		"adr":             data.ADR,
 		"timestamp":       time.Now(),
 	}
-
-	jsonData, err := json.Marshal(forwardData)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal forward data")
-		return
-	}
-
-	// 创建请求
-	req, err := http.NewRequest("POST", config.Endpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create HTTP request")
-		return
-	}
-
-	// 设置 headers
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range config.Headers {
-		req.Header.Set(k, v)
+	if len(data.PHYPayload) > 0 {
+		forwardData["phyPayload"] = data.PHYPayload
 	}
+	forwardData = filterForwardFields(forwardData, app.ForwardFields)
 
-	// 发送请求
-	resp, err := s.httpClient.Do(req)
+	jsonData, err := json.Marshal(forwardData)
 	if err != nil {
-		log.Error().
-			Err(err).
-			Str("endpoint", config.Endpoint).
-			Msg("Failed to forward data to HTTP")
-		
-		// TODO: 实现重试逻辑
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed to marshal forward data")
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		log.Error().
-			Int("status", resp.StatusCode).
-			Str("endpoint", config.Endpoint).
-			Msg("HTTP forward failed")
-		
-		// TODO: 实现错误处理和重试
-	} else {
-		log.Debug().
-			Str("devEUI", data.DevEUI).
-			Str("endpoint", config.Endpoint).
-			Msg("Data forwarded to HTTP successfully")
+	// 发送请求，失败时重试，重试耗尽后进入死信
+	headers := map[string]string{}
+	if data.TraceID != "" {
+		headers[TraceIDHeader] = data.TraceID
 	}
+	s.postToEndpoints(ctx, app, config, "up", data.DevEUI, jsonData, headers)
 }
 
 // forwardToMQTT 转发数据到 MQTT
 func (s *ForwarderService) forwardToMQTT(app *models.Application, data UplinkData) {
+	ctx := logging.WithTraceID(context.Background(), data.TraceID)
+
 	config := s.getMQTTConfig(app)
 	if config == nil || !config.Enabled {
 		return
@@ -275,10 +285,15 @@ func (s *ForwarderService) forwardToMQTT(app *models.Application, data UplinkDat
 		"adr":             data.ADR,
 		"timestamp":       time.Now(),
 	}
+	if len(data.PHYPayload) > 0 {
+		forwardData["phyPayload"] = data.PHYPayload
+	}
+	forwardData = filterForwardFields(forwardData, app.ForwardFields)
+	forwardData["version"] = PayloadVersion
 
 	jsonData, err := json.Marshal(forwardData)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal MQTT data")
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed to marshal MQTT data")
 		return
 	}
 
@@ -286,18 +301,18 @@ func (s *ForwarderService) forwardToMQTT(app *models.Application, data UplinkDat
 	token := client.Publish(topic, config.QoS, false, jsonData)
 	if token.WaitTimeout(5 * time.Second) {
 		if err := token.Error(); err != nil {
-			log.Error().
+			logging.Ctx(ctx).Error().
 				Err(err).
 				Str("topic", topic).
 				Msg("Failed to publish to MQTT")
 		} else {
-			log.Debug().
+			logging.Ctx(ctx).Debug().
 				Str("devEUI", data.DevEUI).
 				Str("topic", topic).
 				Msg("Data forwarded to MQTT successfully")
 		}
 	} else {
-		log.Error().
+		logging.Ctx(ctx).Error().
 			Str("topic", topic).
 			Msg("MQTT publish timeout")
 	}
@@ -325,30 +340,8 @@ func (s *ForwarderService) forwardJoinToHTTP(app *models.Application, event Join
 		return
 	}
 
-	// 创建请求
-	req, err := http.NewRequest("POST", config.Endpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return
-	}
-
-	// 设置 headers
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range config.Headers {
-		req.Header.Set(k, v)
-	}
-
-	// 发送请求
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to forward join event to HTTP")
-		return
-	}
-	defer resp.Body.Close()
-
-	log.Debug().
-		Str("devEUI", event.DevEUI).
-		Int("status", resp.StatusCode).
-		Msg("Join event forwarded to HTTP")
+	// 发送请求，失败时重试，重试耗尽后进入死信
+	s.postToEndpoints(context.Background(), app, config, "join", event.DevEUI, jsonData, nil)
 }
 
 // forwardJoinToMQTT 转发入网事件到 MQTT
@@ -376,6 +369,7 @@ func (s *ForwarderService) forwardJoinToMQTT(app *models.Application, event Join
 		"devEUI":          event.DevEUI,
 		"devAddr":         event.DevAddr,
 		"timestamp":       time.Now(),
+		"version":         PayloadVersion,
 	}
 
 	jsonData, _ := json.Marshal(forwardData)
@@ -477,11 +471,19 @@ func (s *ForwarderService) closeAllMQTTConnections() {
 	}
 }
 
-// decodePayload 解码 payload
-func (s *ForwarderService) decodePayload(decoder string, data []byte) map[string]interface{} {
-	// TODO: 实现 JavaScript 解码器
-	// 可以使用 goja 等 JavaScript 引擎
-	return nil
+// decodePayload 执行应用的 JavaScript 解码脚本，失败时返回 nil（仍转发原始数据）
+func (s *ForwarderService) decodePayload(decoder string, data UplinkData) map[string]interface{} {
+	var fPort uint8
+	if data.FPort != nil {
+		fPort = *data.FPort
+	}
+
+	decoded, err := codec.DecodeJavaScript(decoder, fPort, data.Data)
+	if err != nil {
+		log.Warn().Err(err).Str("devEUI", data.DevEUI).Uint8("fPort", fPort).Msg("JavaScript 解码失败")
+		return nil
+	}
+	return decoded
 }
 
 // Helper functions
@@ -534,6 +536,9 @@ func (s *ForwarderService) getMQTTConfig(app *models.Application) *MQTTConfig {
 
 // Data structures
 
+// TraceIDHeader HTTP 集成携带上行追踪 ID 的请求头
+const TraceIDHeader = "X-LoRaWAN-Trace-ID"
+
 type UplinkData struct {
 	ApplicationID string                   `json:"applicationID"`
 	DevEUI        string                   `json:"devEUI"`
@@ -542,9 +547,13 @@ type UplinkData struct {
 	FCnt          uint32                   `json:"fCnt"`
 	FPort         *uint8                   `json:"fPort"`
 	Data          []byte                   `json:"data"`
+	Empty         bool                     `json:"empty,omitempty"` // FPort 存在但负载为空（轮询/心跳）
+	Replay        bool                     `json:"replay,omitempty"` // 通过 API 重放的历史上行
 	Object        map[string]interface{}   `json:"object,omitempty"`
 	RxInfo        []map[string]interface{} `json:"rxInfo"`
 	ADR           bool                     `json:"adr"`
+	PHYPayload    []byte                   `json:"phyPayload,omitempty"`
+	TraceID       string                   `json:"traceID,omitempty"` // 网关桥生成的上行追踪 ID
 }
 
 type JoinEvent struct {
@@ -555,9 +564,31 @@ type JoinEvent struct {
 
 type HTTPConfig struct {
 	Enabled  bool              `json:"enabled"`
-	Endpoint string            `json:"endpoint"`
-	Headers  map[string]string `json:"headers"`
+	Endpoint string            `json:"endpoint"` // 单个地址（旧格式），配置了 endpoints 时忽略
+	Headers  map[string]string `json:"headers"`  // 所有地址共用的请求头
 	Timeout  int               `json:"timeout"`
+
+	// 多个转发地址，每个上行分别 POST 到所有启用的地址
+	Endpoints []HTTPEndpoint `json:"endpoints,omitempty"`
+
+	// 网络错误和 5xx/429 时重试：最多尝试 maxAttempts 次（默认 3），间隔从 retryDelay 毫秒（默认 500）起指数增长并加随机抖动
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	RetryDelay  int `json:"retryDelay,omitempty"`
+}
+
+// HTTPEndpoint HTTP 集成的一个转发地址，Headers 覆盖 HTTPConfig 中的同名请求头
+type HTTPEndpoint struct {
+	Enabled  bool              `json:"enabled"`
+	Endpoint string            `json:"endpoint"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// EndpointList 返回数组形式的转发地址；只配置了旧格式 endpoint 时转换为一个启用的地址
+func (c *HTTPConfig) EndpointList() []HTTPEndpoint {
+	if len(c.Endpoints) > 0 || c.Endpoint == "" {
+		return c.Endpoints
+	}
+	return []HTTPEndpoint{{Enabled: true, Endpoint: c.Endpoint}}
 }
 
 type MQTTConfig struct {
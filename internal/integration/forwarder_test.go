@@ -0,0 +1,82 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// httpSink records the JSON bodies posted to it
+func httpSink(t *testing.T) (*httptest.Server, chan map[string]interface{}) {
+	t.Helper()
+
+	received := make(chan map[string]interface{}, 4)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var data map[string]interface{}
+		json.Unmarshal(body, &data)
+		received <- data
+	}))
+	t.Cleanup(sink.Close)
+	return sink, received
+}
+
+func TestForwardPHYPayload(t *testing.T) {
+	phyPayload := []byte{0x40, 0xda, 0x1b, 0x01, 0x26, 0x00, 0x01, 0x00, 0x01, 0xab, 0x12, 0x34, 0x56, 0x78}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		sent    []byte
+		want    interface{} // nil means the field is absent
+	}{
+		{"enabled", true, phyPayload, "QNobASYAAQABqxI0Vng="},
+		{"disabled", false, phyPayload, nil},
+		{"enabled without payload", true, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, received := httpSink(t)
+			store := storagetest.New()
+			app := &models.Application{
+				Name:              "raw",
+				ForwardPHYPayload: tt.enabled,
+				HTTPIntegration:   &models.Variables{"enabled": true, "endpoint": sink.URL},
+			}
+			if err := store.CreateApplication(context.Background(), app); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := json.Marshal(map[string]interface{}{
+				"devEUI":     "70b3d57ed0000001",
+				"fCnt":       1,
+				"data":       []byte{0xab},
+				"phyPayload": tt.sent,
+			})
+			s := NewForwarderService(nil, store)
+			s.handleUplinkData(&nats.Msg{Subject: "application." + app.ID.String() + ".device.70b3d57ed0000001.rx", Data: data})
+
+			select {
+			case got := <-received:
+				if v, ok := got["phyPayload"]; ok != (tt.want != nil) || (ok && v != tt.want) {
+					t.Errorf("phyPayload = %v (present %v), want %v", v, ok, tt.want)
+				}
+				if got["data"] != "qw==" {
+					t.Errorf("data = %v", got["data"])
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("uplink not forwarded")
+			}
+		})
+	}
+}
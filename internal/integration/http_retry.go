@@ -0,0 +1,184 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+const (
+	defaultHTTPMaxAttempts = 3
+	defaultHTTPRetryDelay  = 500 * time.Millisecond
+	// maxHTTPRetryDelay 指数退避的间隔上限
+	maxHTTPRetryDelay = 30 * time.Second
+)
+
+// DeadLetterSubject HTTP 集成重试耗尽后发布失败事件的 NATS 主题
+func DeadLetterSubject(appID, devEUI string) string {
+	return fmt.Sprintf("application.%s.device.%s.deadletter", appID, devEUI)
+}
+
+// DeadLetter 发布到死信主题的失败事件，Payload 为原本要 POST 的请求体
+type DeadLetter struct {
+	ApplicationID string          `json:"applicationID"`
+	DevEUI        string          `json:"devEUI"`
+	Event         string          `json:"event"` // up / join
+	Endpoint      string          `json:"endpoint"`
+	Status        int             `json:"status,omitempty"` // 最后一次响应的状态码，网络错误时为 0
+	Error         string          `json:"error"`
+	Attempts      int             `json:"attempts"`
+	Payload       json.RawMessage `json:"payload"`
+	FailedAt      time.Time       `json:"failedAt"`
+}
+
+// postToEndpoints 把 body 并发 POST 到所有启用的地址，各地址独立重试，一个地址失败不影响其他地址
+func (s *ForwarderService) postToEndpoints(ctx context.Context, app *models.Application, config *HTTPConfig, event, devEUI string, body []byte, headers map[string]string) {
+	var wg sync.WaitGroup
+	for _, endpoint := range config.EndpointList() {
+		if !endpoint.Enabled || endpoint.Endpoint == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(endpoint HTTPEndpoint) {
+			defer wg.Done()
+			if s.postWithRetry(ctx, app, config, endpoint, event, devEUI, body, headers) {
+				logging.Ctx(ctx).Debug().
+					Str("devEUI", devEUI).
+					Str("event", event).
+					Str("endpoint", endpoint.Endpoint).
+					Msg("Data forwarded to HTTP successfully")
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+// postWithRetry 把 body POST 到 endpoint，网络错误和 5xx/429 按指数退避加抖动重试。
+// 服务关闭时停止等待；最终失败时发布到死信主题并返回 false
+func (s *ForwarderService) postWithRetry(ctx context.Context, app *models.Application, config *HTTPConfig, endpoint HTTPEndpoint, event, devEUI string, body []byte, headers map[string]string) bool {
+	maxAttempts := config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultHTTPMaxAttempts
+	}
+	delay := defaultHTTPRetryDelay
+	if config.RetryDelay > 0 {
+		delay = time.Duration(config.RetryDelay) * time.Millisecond
+	}
+
+	var status, attempts int
+	var lastErr error
+	for attempts < maxAttempts {
+		attempts++
+		var retryable bool
+		status, retryable, lastErr = s.post(config, endpoint, body, headers)
+		if lastErr == nil {
+			return true
+		}
+
+		logging.Ctx(ctx).Warn().
+			Err(lastErr).
+			Str("devEUI", devEUI).
+			Str("endpoint", endpoint.Endpoint).
+			Int("status", status).
+			Int("attempt", attempts).
+			Int("maxAttempts", maxAttempts).
+			Msg("HTTP forward failed")
+		if !retryable || attempts == maxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(retryBackoff(delay, attempts)):
+		case <-s.ctx.Done():
+			lastErr = fmt.Errorf("%w (retry cancelled on shutdown)", lastErr)
+			attempts = maxAttempts
+		}
+	}
+
+	logging.Ctx(ctx).Error().
+		Err(lastErr).
+		Str("devEUI", devEUI).
+		Str("endpoint", endpoint.Endpoint).
+		Int("status", status).
+		Int("attempts", attempts).
+		Msg("HTTP forward retries exhausted, publishing to dead-letter subject")
+	s.publishDeadLetter(ctx, &DeadLetter{
+		ApplicationID: app.ID.String(),
+		DevEUI:        devEUI,
+		Event:         event,
+		Endpoint:      endpoint.Endpoint,
+		Status:        status,
+		Error:         lastErr.Error(),
+		Attempts:      attempts,
+		Payload:       body,
+		FailedAt:      time.Now(),
+	})
+	return false
+}
+
+// post 发送一次请求，返回状态码、失败时是否值得重试以及错误
+func (s *ForwarderService) post(config *HTTPConfig, endpoint HTTPEndpoint, body []byte, headers map[string]string) (int, bool, error) {
+	req, err := http.NewRequestWithContext(s.ctx, "POST", endpoint.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(PayloadVersionHeader, PayloadVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range config.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range endpoint.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return resp.StatusCode, retryable, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, false, nil
+}
+
+// retryBackoff 第 attempt 次失败后的等待时间：base * 2^(attempt-1)，不超过上限，再取 [50%, 100%] 的随机抖动
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxHTTPRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxHTTPRetryDelay {
+		d = maxHTTPRetryDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (s *ForwarderService) publishDeadLetter(ctx context.Context, dl *DeadLetter) {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return
+	}
+	subject := DeadLetterSubject(dl.ApplicationID, dl.DevEUI)
+	if err := s.nc.Publish(subject, data); err != nil {
+		logging.Ctx(ctx).Error().
+			Err(err).
+			Str("subject", subject).
+			Str("devEUI", dl.DevEUI).
+			Msg("Failed to publish dead letter")
+	}
+}
@@ -0,0 +1,7 @@
+package integration
+
+// PayloadVersion 转发给集成的数据格式版本，字段增删或含义变化时递增
+const PayloadVersion = "1"
+
+// PayloadVersionHeader HTTP 集成携带格式版本的请求头；MQTT 数据中为 version 字段
+const PayloadVersionHeader = "X-LoRaWAN-Payload-Version"
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+// fakeMQTTClient records published payloads; other mqtt.Client methods are not used
+type fakeMQTTClient struct {
+	mqtt.Client
+	published chan []byte
+}
+
+func (c *fakeMQTTClient) IsConnected() bool { return true }
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.published <- payload.([]byte)
+	return doneToken{}
+}
+
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+func (doneToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func TestPayloadVersion(t *testing.T) {
+	const devEUI = "70b3d57ed0000001"
+
+	tests := []struct {
+		name  string
+		event string // last subject token
+		data  interface{}
+	}{
+		{"uplink", "rx", map[string]interface{}{"devEUI": devEUI, "fCnt": 1, "data": []byte{0xab}}},
+		{"join", "join", map[string]interface{}{"devEUI": devEUI, "devAddr": "01020304"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := make(chan http.Header, 1)
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers <- r.Header
+			}))
+			defer sink.Close()
+
+			store := storagetest.New()
+			app := &models.Application{
+				Name:            "versioned",
+				HTTPIntegration: &models.Variables{"enabled": true, "endpoint": sink.URL},
+				MQTTIntegration: &models.Variables{"enabled": true, "brokerUrl": "tcp://127.0.0.1:1883", "topicPattern": "application/{app_id}/device/{dev_eui}/up"},
+			}
+			if err := store.CreateApplication(context.Background(), app); err != nil {
+				t.Fatal(err)
+			}
+
+			s := NewForwarderService(nil, store)
+			client := &fakeMQTTClient{published: make(chan []byte, 1)}
+			s.mqttClients[app.ID] = client
+
+			data, _ := json.Marshal(tt.data)
+			msg := &nats.Msg{Subject: "application." + app.ID.String() + ".device." + devEUI + "." + tt.event, Data: data}
+			if tt.event == "join" {
+				s.handleJoinEvent(msg)
+			} else {
+				s.handleUplinkData(msg)
+			}
+
+			select {
+			case h := <-headers:
+				if got := h.Get(PayloadVersionHeader); got != PayloadVersion {
+					t.Errorf("%s = %q, want %q", PayloadVersionHeader, got, PayloadVersion)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("not forwarded over HTTP")
+			}
+
+			select {
+			case payload := <-client.published:
+				var got map[string]interface{}
+				json.Unmarshal(payload, &got)
+				if got["version"] != PayloadVersion {
+					t.Errorf("MQTT version = %v, want %q", got["version"], PayloadVersion)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("not published over MQTT")
+			}
+		})
+	}
+}
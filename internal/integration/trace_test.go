@@ -0,0 +1,54 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+func TestForwardTraceIDHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		traceID string
+	}{
+		{"traced uplink", "0123456789abcdef"},
+		{"untraced uplink", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := make(chan http.Header, 1)
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers <- r.Header
+			}))
+			defer sink.Close()
+
+			store := storagetest.New()
+			app := &models.Application{Name: "traced", HTTPIntegration: &models.Variables{"enabled": true, "endpoint": sink.URL}}
+			if err := store.CreateApplication(context.Background(), app); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := json.Marshal(map[string]interface{}{"devEUI": "70b3d57ed0000001", "fCnt": 1, "data": []byte{0xab}, "traceID": tt.traceID})
+			s := NewForwarderService(nil, store)
+			s.handleUplinkData(&nats.Msg{Subject: "application." + app.ID.String() + ".device.70b3d57ed0000001.rx", Data: data})
+
+			select {
+			case h := <-headers:
+				if got := h.Get(TraceIDHeader); got != tt.traceID {
+					t.Errorf("%s = %q, want %q", TraceIDHeader, got, tt.traceID)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("uplink not forwarded")
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var frameLogger atomic.Pointer[zerolog.Logger]
+
+// SetFrameSampling 配置逐帧热路径日志的采样率，Debug 和 Info 各自每 N 条只输出 1 条，
+// N <= 1 时不采样。Warn 及以上级别始终输出。需要在设置 log.Logger 之后调用。
+func SetFrameSampling(n uint32) {
+	l := log.Logger
+	if n > 1 {
+		// 每个级别单独计数，交替输出的 Debug/Info 不会有一个级别被完全丢弃
+		l = l.Sample(zerolog.LevelSampler{
+			DebugSampler: &zerolog.BasicSampler{N: n},
+			InfoSampler:  &zerolog.BasicSampler{N: n},
+		})
+	}
+	frameLogger.Store(&l)
+}
+
+// Frame 返回逐帧热路径使用的采样日志器
+func Frame() *zerolog.Logger {
+	if l := frameLogger.Load(); l != nil {
+		return l
+	}
+	return &log.Logger
+}
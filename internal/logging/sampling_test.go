@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// captureLogs sends the global logger to a buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() {
+		log.Logger = saved
+		frameLogger.Store(nil)
+	})
+	return &buf
+}
+
+func TestSetFrameSampling(t *testing.T) {
+	const events = 100
+
+	tests := []struct {
+		name      string
+		n         uint32
+		wantDebug int
+		wantInfo  int
+	}{
+		{"disabled", 0, events, events},
+		{"every entry", 1, events, events},
+		{"one in ten", 10, events / 10, events / 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t)
+			SetFrameSampling(tt.n)
+
+			for i := 0; i < events; i++ {
+				Frame().Debug().Msg("debug")
+				Frame().Info().Msg("info")
+				Frame().Warn().Msg("warn")
+			}
+
+			out := buf.String()
+			if got := strings.Count(out, `"level":"debug"`); got != tt.wantDebug {
+				t.Errorf("%d debug entries, want %d", got, tt.wantDebug)
+			}
+			if got := strings.Count(out, `"level":"info"`); got != tt.wantInfo {
+				t.Errorf("%d info entries, want %d", got, tt.wantInfo)
+			}
+			if got := strings.Count(out, `"level":"warn"`); got != events {
+				t.Errorf("%d warn entries, want all %d", got, events)
+			}
+		})
+	}
+}
+
+func TestFrameWithoutSampling(t *testing.T) {
+	buf := captureLogs(t)
+
+	Frame().Info().Msg("info")
+	if !strings.Contains(buf.String(), `"message":"info"`) {
+		t.Errorf("Frame() before SetFrameSampling wrote %q, want the global logger", buf)
+	}
+}
+
+func TestFrameCtxTraceID(t *testing.T) {
+	buf := captureLogs(t)
+	SetFrameSampling(1)
+
+	FrameCtx(WithTraceID(context.Background(), "0011223344556677")).Info().Msg("traced")
+	FrameCtx(context.Background()).Info().Msg("untraced")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"traceID":"0011223344556677"`) || strings.Contains(lines[1], "traceID") {
+		t.Errorf("logged %q", lines)
+	}
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// TraceIDField 追踪 ID 在 NATS 消息、rxInfo 和日志中的字段名。
+// 网关桥在收到上行时生成，经网络服务器、应用服务器一直带到集成转发
+const TraceIDField = "traceID"
+
+type traceIDKey struct{}
+
+// NewTraceID 生成 16 位十六进制追踪 ID
+func NewTraceID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithTraceID 把追踪 ID 放入 context，traceID 为空时原样返回
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceID 返回 context 中的追踪 ID，没有时为空
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// Ctx 返回带 context 中追踪 ID 字段的日志器
+func Ctx(ctx context.Context) *zerolog.Logger {
+	return withTraceID(&log.Logger, ctx)
+}
+
+// FrameCtx 返回带追踪 ID 字段的逐帧采样日志器
+func FrameCtx(ctx context.Context) *zerolog.Logger {
+	return withTraceID(Frame(), ctx)
+}
+
+func withTraceID(l *zerolog.Logger, ctx context.Context) *zerolog.Logger {
+	id := TraceID(ctx)
+	if id == "" {
+		return l
+	}
+	traced := l.With().Str(TraceIDField, id).Logger()
+	return &traced
+}
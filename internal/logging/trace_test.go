@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestCtxTraceID(t *testing.T) {
+	tests := []struct {
+		name    string
+		traceID string
+	}{
+		{"traced", "0123456789abcdef"},
+		{"untraced", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t)
+			ctx := WithTraceID(context.Background(), tt.traceID)
+			if got := TraceID(ctx); got != tt.traceID {
+				t.Errorf("TraceID() = %q, want %q", got, tt.traceID)
+			}
+
+			Ctx(ctx).Info().Msg("uplink")
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := entry[TraceIDField]
+			if tt.traceID == "" && ok {
+				t.Errorf("untraced log has %s = %v", TraceIDField, got)
+			} else if tt.traceID != "" && got != tt.traceID {
+				t.Errorf("%s = %v, want %s", TraceIDField, got, tt.traceID)
+			}
+		})
+	}
+}
+
+func TestNewTraceID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	a, b := NewTraceID(), NewTraceID()
+	if !pattern.MatchString(a) || !pattern.MatchString(b) {
+		t.Fatalf("NewTraceID() = %q, %q", a, b)
+	}
+	if a == b {
+		t.Errorf("NewTraceID() returned %s twice", a)
+	}
+}
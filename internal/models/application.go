@@ -1,6 +1,11 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"github.com/google/uuid"
 )
 
@@ -20,10 +25,83 @@ type Application struct {
 	PayloadDecoder string `json:"payloadDecoder,omitempty" db:"payload_decoder"`
 	PayloadEncoder string `json:"payloadEncoder,omitempty" db:"payload_encoder"`
 
+	// 确认下行等待设备 ACK 的秒数，超时标记失败；0 使用网络服务器全局配置
+	ConfirmedTimeout int `json:"confirmedTimeout" db:"confirmed_timeout"`
+
+	// 转发给集成的上行消息中附带 base64 编码的原始 PHYPayload（加密）
+	ForwardPHYPayload bool `json:"forwardPHYPayload" db:"forward_phy_payload"`
+
+	// 转发给 HTTP/MQTT 集成的上行字段过滤，为空时转发全部字段
+	ForwardFields *ForwardFieldFilter `json:"forwardFields,omitempty" db:"forward_fields"`
+
 	// Statistics
 	DeviceCount int `json:"deviceCount,omitempty"`
 }
 
+// ForwardFields 可过滤的上行转发字段；rxInfo.<字段> 表示每个网关接收信息中的字段
+var ForwardFields = []string{
+	"applicationName", "deviceName", "devAddr", "fCnt", "fPort", "data",
+	"object", "rxInfo", "adr", "timestamp", "phyPayload",
+	"rxInfo.location", "rxInfo.labels", "rxInfo.gatewayName", "rxInfo.gatewayID",
+	"rxInfo.rssi", "rxInfo.lsnr",
+}
+
+// ForwardFieldFilter 上行转发字段白名单/黑名单。Allow 非空时只转发其中的顶层字段，
+// Block 中的字段始终去掉；devEUI 和 applicationID 用于识别设备，不能过滤
+type ForwardFieldFilter struct {
+	Allow []string `json:"allow,omitempty"`
+	Block []string `json:"block,omitempty"`
+}
+
+// Empty 是否未配置任何过滤
+func (f *ForwardFieldFilter) Empty() bool {
+	return f == nil || (len(f.Allow) == 0 && len(f.Block) == 0)
+}
+
+// Validate 检查字段名是否可过滤
+func (f *ForwardFieldFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	known := make(map[string]bool, len(ForwardFields))
+	for _, name := range ForwardFields {
+		known[name] = true
+	}
+	for _, name := range f.Allow {
+		if !known[name] || strings.Contains(name, ".") {
+			return fmt.Errorf("forward field %q cannot be allowlisted", name)
+		}
+	}
+	for _, name := range f.Block {
+		if !known[name] {
+			return fmt.Errorf("unknown forward field %q", name)
+		}
+	}
+	return nil
+}
+
+// Value implements driver.Valuer interface
+func (f *ForwardFieldFilter) Value() (driver.Value, error) {
+	if f.Empty() {
+		return nil, nil
+	}
+	return json.Marshal(f)
+}
+
+// Scan implements sql.Scanner interface
+func (f *ForwardFieldFilter) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, f)
+	case string:
+		return json.Unmarshal([]byte(data), f)
+	default:
+		return fmt.Errorf("unsupported forward fields type %T", value)
+	}
+}
+
 // Integration represents an application integration
 type Integration struct {
 	BaseModel
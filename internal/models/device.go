@@ -3,6 +3,7 @@ package models
 import (
     "database/sql/driver"
     "encoding/hex"
+    "encoding/json"
     "fmt"
     "time"
     
@@ -89,6 +90,7 @@ type Device struct {
     
     // Status
     IsDisabled      bool       `json:"isDisabled" db:"is_disabled"`
+    ForwardDisabled bool       `json:"forwardDisabled" db:"forward_disabled"` // 仍处理并保存上行，但不转发给应用集成
     LastSeenAt      *time.Time `json:"lastSeenAt,omitempty" db:"last_seen_at"`
     
     // Battery
@@ -109,11 +111,100 @@ type Device struct {
     // Settings
     DR          *int `json:"dr,omitempty" db:"dr"`
     
+    // Last downlink
+    LastDownlink *DeviceLastDownlink `json:"lastDownlink,omitempty" db:"last_downlink"`
+    
+    // Last uplink processing error
+    LastError    *DeviceLastError    `json:"lastError,omitempty" db:"last_error"`
+    
     // Relations
     Application *Application `json:"application,omitempty"`
     Profile     *DeviceProfile `json:"profile,omitempty"`
 }
 
+// DeviceLastDownlink represents the last downlink sent to a device
+type DeviceLastDownlink struct {
+    Time        time.Time  `json:"time"`
+    FPort       *uint8     `json:"fPort,omitempty"`
+    FCnt        uint32     `json:"fCnt"`
+    Confirmed   bool       `json:"confirmed"`
+    GatewayID   string     `json:"gatewayId"`
+    ID          string     `json:"id,omitempty"` // 应用下行队列中的帧 ID
+    
+    // Gateway TX_ACK
+    TxAcked     bool       `json:"txAcked"`
+    TxError     string     `json:"txError,omitempty"`
+    
+    // Device ACK (confirmed downlinks only)
+    Acked       bool       `json:"acked"`
+    AckedAt     *time.Time `json:"ackedAt,omitempty"`
+    
+    // 超时未收到设备 ACK（含重传）
+    Failed      bool       `json:"failed"`
+    FailedAt    *time.Time `json:"failedAt,omitempty"`
+}
+
+// Value implements driver.Valuer interface
+func (d *DeviceLastDownlink) Value() (driver.Value, error) {
+    if d == nil {
+        return nil, nil
+    }
+    return json.Marshal(d)
+}
+
+// Scan implements sql.Scanner interface
+func (d *DeviceLastDownlink) Scan(value interface{}) error {
+    switch data := value.(type) {
+    case nil:
+        return nil
+    case []byte:
+        return json.Unmarshal(data, d)
+    case string:
+        return json.Unmarshal([]byte(data), d)
+    default:
+        return fmt.Errorf("unsupported last downlink type %T", value)
+    }
+}
+
+// Device last error codes
+const (
+    DeviceErrorMICFailure     = "MIC_FAILURE"
+    DeviceErrorDecryptFailure = "DECRYPT_FAILURE"
+    DeviceErrorFCntRejected   = "FCNT_REJECTED"
+    DeviceErrorDevNonceReplay = "DEVNONCE_REPLAY"
+)
+
+// DeviceLastError represents the last uplink processing failure of a device
+type DeviceLastError struct {
+    Time        time.Time  `json:"time"`
+    Code        string     `json:"code"`
+    Message     string     `json:"message"`
+    FCnt        *uint32    `json:"fCnt,omitempty"`
+    GatewayID   string     `json:"gatewayId,omitempty"`
+}
+
+// Value implements driver.Valuer interface
+func (d *DeviceLastError) Value() (driver.Value, error) {
+    if d == nil {
+        return nil, nil
+    }
+    return json.Marshal(d)
+}
+
+// Scan implements sql.Scanner interface
+func (d *DeviceLastError) Scan(value interface{}) error {
+    switch data := value.(type) {
+    case nil:
+        return nil
+    case []byte:
+        return json.Unmarshal(data, d)
+    case string:
+        return json.Unmarshal([]byte(data), d)
+    default:
+        return fmt.Errorf("unsupported last error type %T", value)
+    }
+}
+
 // DeviceKeys represents device root keys (for OTAA)
 type DeviceKeys struct {
     DevEUI   EUI64     `json:"devEUI" db:"dev_eui"`
@@ -167,6 +258,103 @@ type DeviceProfile struct {
     
     // Uplink interval
     UplinkInterval       int        `json:"uplinkInterval" db:"uplink_interval"`
+    
+    // ADR: on / off / auto（auto 跟随全局配置）
+    ADRMode              ADRMode    `json:"adrMode,omitempty" db:"adr_mode"`
+    
+    // 下行数据速率上限（RX1），为空表示不限制
+    MaxDownlinkDR        *int       `json:"maxDownlinkDR,omitempty" db:"max_downlink_dr"`
+    
+    // 每分钟最多处理的上行数，0 使用网络服务器全局配置
+    MaxUplinkRate        int        `json:"maxUplinkRate" db:"max_uplink_rate"`
+    
+    // ADR 可下发的最大 NbTrans（上行重传次数），0 表示 ADR 不调整 NbTrans
+    MaxNbTrans           int        `json:"maxNbTrans" db:"max_nb_trans"`
+    
+    // 仅 ABP 激活，拒绝 JOIN 请求
+    ABPOnly              bool       `json:"abpOnly" db:"abp_only"`
+    
+    // 应用下行最长排队时间（秒），超过后不再发送，0 使用网络服务器全局配置
+    MaxDownlinkQueueAge  int        `json:"maxDownlinkQueueAge" db:"max_downlink_queue_age"`
+    
+    // 下行 LoRa 编码率（如 4/6），为空使用网络服务器全局配置
+    DownlinkCodeRate     string     `json:"downlinkCodeRate,omitempty" db:"downlink_code_rate"`
+    
+    // 设备支持的数据速率（如 [0,1,2,3]），ADR 和 RX1 下行只使用其中的速率，为空表示不限制
+    SupportedDataRates   []int64    `json:"supportedDataRates,omitempty" db:"supported_data_rates"`
+    
+    // 设备工作类别 A / B / C，为空等同 A；C 类设备的应用下行立即在 RX2 发送
+    DeviceClass          DeviceClass `json:"deviceClass,omitempty" db:"device_class"`
+    
+    // 允许设备重启后帧计数器从 0 重新开始（上次 FCnt 为 1 时收到 fcnt=0），默认拒绝
+    FCntResetsAllowed    bool       `json:"fCntResetsAllowed" db:"fcnt_resets_allowed"`
+    
+    // JOIN ACCEPT 下发的数据 RX1 延迟（1-15 秒），0 使用网络服务器全局配置
+    RX1Delay             int        `json:"rx1Delay" db:"rx1_delay"`
+    
+    // 设备的 RX2 数据速率，JOIN ACCEPT 中下发；为空使用频段/全局配置
+    RX2DR                *int       `json:"rx2DR,omitempty" db:"rx2_dr"`
+    
+    // 设备出厂设置的 RX2 频率（Hz），0 使用频段/全局配置
+    RX2Frequency         int        `json:"rx2Frequency" db:"rx2_freq"`
+    
+    // JOIN ACCEPT 是否携带 CFList，为空时由 DISABLE_CFLIST 环境变量决定；个别设备型号收到 CFList 后工作异常
+    SupportsCFList       *bool      `json:"supportsCFList,omitempty" db:"supports_cflist"`
+    
+    // JOIN ACCEPT 的 RX2 发送策略 auto / always / off，为空使用网络服务器全局配置
+    JoinAcceptRX2        string     `json:"joinAcceptRX2,omitempty" db:"join_accept_rx2"`
+}
+
+// DeviceClass 设备工作类别
+type DeviceClass string
+
+const (
+    DeviceClassA DeviceClass = "A"
+    DeviceClassB DeviceClass = "B"
+    DeviceClassC DeviceClass = "C"
+)
+
+// Valid 是否为支持的设备类别，空值等同 A
+func (c DeviceClass) Valid() bool {
+    switch c {
+    case "", DeviceClassA, DeviceClassB, DeviceClassC:
+        return true
+    }
+    return false
+}
+
+// ADRMode 设备配置文件的 ADR 策略
+type ADRMode string
+
+const (
+    ADRModeAuto ADRMode = "auto"
+    ADRModeOn   ADRMode = "on"
+    ADRModeOff  ADRMode = "off"
+)
+
+// Valid 是否为支持的 ADR 策略，空值等同 auto
+func (m ADRMode) Valid() bool {
+    switch m {
+    case "", ADRModeAuto, ADRModeOn, ADRModeOff:
+        return true
+    }
+    return false
+}
+
+// Resolve 结合全局开关和上行 FCtrl.ADR 决定是否执行 ADR
+func (m ADRMode) Resolve(globalEnabled, uplinkADR bool) bool {
+    // 设备未请求 ADR 时网络不能调整其速率
+    if !uplinkADR {
+        return false
+    }
+    switch m {
+    case ADRModeOn:
+        return true
+    case ADRModeOff:
+        return false
+    default:
+        return globalEnabled
+    }
 }
 
 
@@ -2,6 +2,8 @@ package models
 
 import (
     "time"
+    
+    "github.com/google/uuid"
 )
 
 // DeviceSession represents an active device session
@@ -10,6 +12,7 @@ type DeviceSession struct {
     DevEUI      EUI64
     DevAddr     DevAddr
     JoinEUI     EUI64
+    MACVersion  string // LoRaWAN version negotiated at join, e.g. "1.1.0"; empty for 1.0.x
     
     // Session keys (stored as hex strings)
     FNwkSIntKey string
@@ -18,12 +21,16 @@ type DeviceSession struct {
     AppSKey     string
     
     // Frame counters
-    FCntUp      uint32
+    FCntUp      uint32 // last accepted uplink counter, meaningful once UplinkReceived is set
     FCntDown    uint32
     NFCntDown   uint32
     AFCntDown   uint32
     ConfFCnt    uint32
     
+    // UplinkReceived is set once an uplink has been accepted since the join. Until then
+    // FCntUp 0 has not been used, so the first uplink may carry FCnt 0.
+    UplinkReceived bool
+    
     // RX windows
     RX1Delay       uint8
     RX1DROffset    uint8
@@ -47,6 +54,15 @@ type DeviceSession struct {
     UpdatedAt           time.Time
 }
 
+// MACCommandQueueItem is a MAC command waiting to be sent in the next downlink FOpts
+type MACCommandQueueItem struct {
+    ID        uuid.UUID `json:"id" db:"id"`
+    DevEUI    EUI64     `json:"devEUI" db:"dev_eui"`
+    CID       uint8     `json:"cid" db:"cid"`
+    Payload   []byte    `json:"payload" db:"payload"`
+    CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
 // ADRHistory represents ADR history entry
 type ADRHistory struct {
     FCnt         uint32  `json:"fCnt"`
@@ -39,14 +39,33 @@ const (
     EventTypeGatewayUp      EventType = "GATEWAY_UP"
     EventTypeGatewayDown    EventType = "GATEWAY_DOWN"
     EventTypeGatewayStats   EventType = "GATEWAY_STATS"
+    EventTypeGatewayClock   EventType = "GATEWAY_CLOCK"
+    EventTypeGatewayHealth  EventType = "GATEWAY_HEALTH"
     
     // System events
     EventTypeAPICall        EventType = "API_CALL"
     EventTypeIntegration    EventType = "INTEGRATION"
     EventTypeDownlinkQueued EventType = "DOWNLINK_QUEUED"
     EventTypeDownlinkAck    EventType = "DOWNLINK_ACK"
+    
+    // Downlink lifecycle: QUEUED -> SCHEDULED -> TX -> ACK, or FAILED / EXPIRED
+    EventTypeDownlinkScheduled EventType = "DOWNLINK_SCHEDULED"
+    EventTypeDownlinkTx        EventType = "DOWNLINK_TX"
+    EventTypeDownlinkFailed    EventType = "DOWNLINK_FAILED"
+    EventTypeDownlinkExpired   EventType = "DOWNLINK_EXPIRED"
 )
 
+// DownlinkEvent is a downlink lifecycle event published on downlink.<devEUI>.<type>
+type DownlinkEvent struct {
+    Type      EventType `json:"type"`
+    DevEUI    string    `json:"devEUI"`
+    ID        string    `json:"id,omitempty"`
+    FCnt      uint32    `json:"fCnt"`
+    GatewayID string    `json:"gatewayID,omitempty"`
+    Error     string    `json:"error,omitempty"`
+    Time      time.Time `json:"time"`
+}
+
 // EventLevel represents event severity levels
 type EventLevel string
 
@@ -58,11 +58,27 @@ type DownlinkFrame struct {
     CreatedAt       time.Time    `json:"createdAt" db:"created_at"`
     TransmittedAt   *time.Time   `json:"transmittedAt,omitempty" db:"transmitted_at"`
     AckedAt         *time.Time   `json:"acknowledgedAt,omitempty" db:"acked_at"`
+    ExpiredAt       *time.Time   `json:"expiredAt,omitempty" db:"expired_at"` // 超过最大排队时间，未发送
     
     // Reference
     Reference       string       `json:"reference,omitempty" db:"reference"`
 }
 
+// DownlinkTemplate is a named application downlink, e.g. a "reboot" command
+type DownlinkTemplate struct {
+    ID              uuid.UUID    `json:"id" db:"id"`
+    CreatedAt       time.Time    `json:"createdAt" db:"created_at"`
+    UpdatedAt       time.Time    `json:"updatedAt" db:"updated_at"`
+    ApplicationID   uuid.UUID    `json:"applicationId" db:"application_id"`
+    Name            string       `json:"name" db:"name"`
+    Description     string       `json:"description,omitempty" db:"description"`
+    
+    // Frame data
+    FPort           int          `json:"fPort" db:"f_port"`
+    Data            []byte       `json:"data" db:"data"`
+    Confirmed       bool         `json:"confirmed" db:"confirmed"`
+}
+
 // RXInfo represents receive information
 type RXInfo struct {
     GatewayID       EUI64        `json:"gatewayID"`
@@ -130,3 +146,23 @@ func (f *UplinkFrame) GetSNR() float64 {
     
     return 0
 }
+
+// Frame log directions
+const (
+    FrameDirectionUplink   = "uplink"
+    FrameDirectionDownlink = "downlink"
+)
+
+// FrameLog is a per-frame protocol debugging record of the frame logger
+type FrameLog struct {
+    Time        time.Time  `json:"time" db:"time"`
+    Direction   string     `json:"direction" db:"direction"`
+    GatewayID   string     `json:"gatewayId" db:"gateway_id"`
+    PHYPayload  string     `json:"phyPayload" db:"phy_payload"` // hex
+    Frequency   float64    `json:"frequency" db:"frequency"`    // MHz
+    DataRate    string     `json:"dataRate" db:"data_rate"`
+    RSSI        *int       `json:"rssi,omitempty" db:"rssi"`
+    SNR         *float64   `json:"snr,omitempty" db:"snr"`
+    Result      string     `json:"result" db:"result"`
+    TraceID     string     `json:"traceId,omitempty" db:"trace_id"`
+}
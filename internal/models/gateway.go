@@ -1,6 +1,9 @@
 package models
 
 import (
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
     "time"
     
     "github.com/google/uuid"
@@ -22,6 +25,9 @@ type Gateway struct {
     MinFrequency      uint32     `json:"minFrequency,omitempty" db:"min_frequency"`
     MaxFrequency      uint32     `json:"maxFrequency,omitempty" db:"max_frequency"`
     
+    // RF chains able to transmit, used to pick the txpk rfch for a downlink frequency
+    Radios            GatewayRadios `json:"radios,omitempty" db:"radios"`
+    
     // Status
     LastSeenAt        *time.Time `json:"lastSeenAt,omitempty" db:"last_seen_at"`
     FirstSeenAt       *time.Time `json:"firstSeenAt,omitempty" db:"first_seen_at"`
@@ -33,6 +39,9 @@ type Gateway struct {
     // Metadata
     Tags              Variables  `json:"tags,omitempty" db:"tags"`
     Metadata          Variables  `json:"metadata,omitempty" db:"metadata"`
+    
+    // Labels (site, owner, network...) travel with the gateway's uplink metadata
+    Labels            Variables  `json:"labels,omitempty" db:"labels"`
 }
 
 // Location represents a geographic location
@@ -44,6 +53,71 @@ type Location struct {
     Accuracy  int     `json:"accuracy,omitempty" db:"accuracy"`
 }
 
+// Value implements driver.Valuer interface
+func (l *Location) Value() (driver.Value, error) {
+    if l == nil {
+        return nil, nil
+    }
+    return json.Marshal(l)
+}
+
+// Scan implements sql.Scanner interface
+func (l *Location) Scan(value interface{}) error {
+    switch data := value.(type) {
+    case nil:
+        return nil
+    case []byte:
+        return json.Unmarshal(data, l)
+    case string:
+        return json.Unmarshal([]byte(data), l)
+    default:
+        return fmt.Errorf("unsupported location type %T", value)
+    }
+}
+
+// GatewayRadio is the downlink frequency range of one gateway RF chain
+type GatewayRadio struct {
+    RFCh         uint8  `json:"rfch"`
+    MinFrequency uint32 `json:"minFrequency"`
+    MaxFrequency uint32 `json:"maxFrequency"`
+}
+
+// GatewayRadios is the radio configuration of a gateway
+type GatewayRadios []GatewayRadio
+
+// RFChain returns the RF chain that transmits on freq (Hz)
+func (r GatewayRadios) RFChain(freq uint32) (uint8, bool) {
+    for _, radio := range r {
+        if freq >= radio.MinFrequency && freq <= radio.MaxFrequency {
+            return radio.RFCh, true
+        }
+    }
+    return 0, false
+}
+
+// Value implements driver.Valuer interface
+func (r GatewayRadios) Value() (driver.Value, error) {
+    if r == nil {
+        return nil, nil
+    }
+    return json.Marshal(r)
+}
+
+// Scan implements sql.Scanner interface
+func (r *GatewayRadios) Scan(value interface{}) error {
+    switch data := value.(type) {
+    case nil:
+        *r = nil
+        return nil
+    case []byte:
+        return json.Unmarshal(data, r)
+    case string:
+        return json.Unmarshal([]byte(data), r)
+    default:
+        return fmt.Errorf("unsupported radios type %T", value)
+    }
+}
+
 // GatewayStats represents gateway statistics
 type GatewayStats struct {
     ID                uuid.UUID  `json:"id" db:"id"`
@@ -55,6 +129,10 @@ type GatewayStats struct {
     RXPacketsValid    int        `json:"rxPacketsValid" db:"rx_packets_valid"`
     TXPacketsEmitted  int        `json:"txPacketsEmitted" db:"tx_packets_emitted"`
     
+    // Location reported in the stat frame, nil when the gateway has no GPS fix
+    Latitude          *float64   `json:"latitude,omitempty" db:"latitude"`
+    Longitude         *float64   `json:"longitude,omitempty" db:"longitude"`
+    
     // Metadata
     Metadata          Variables  `json:"metadata,omitempty" db:"metadata"`
 }
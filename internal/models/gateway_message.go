@@ -0,0 +1,141 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// GatewayProtocolVersion 网关桥与网络服务器之间 gateway.<id>.rx / gateway.<id>.tx 消息的格式版本，
+// 字段不兼容变化时递增。旧版本程序发出的消息没有 version 字段（为 0），按版本 1 处理
+const GatewayProtocolVersion = 1
+
+// GatewayProtocolCompatible 对端消息版本是否可以处理
+func GatewayProtocolCompatible(version int) bool {
+	return version <= GatewayProtocolVersion
+}
+
+// GatewayRXMessage 网关桥发布到 gateway.<id>.rx 的上行
+type GatewayRXMessage struct {
+	Version   int      `json:"version"`
+	GatewayID string   `json:"gatewayID"`
+	RXPK      RXPacket `json:"rxpk"`
+	Context   string   `json:"context,omitempty"` // base64 JSON，定时下行时原样带回
+	Timestamp int64    `json:"timestamp"`
+	TraceID   string   `json:"traceID,omitempty"`
+}
+
+// RXPacket Semtech UDP 协议的 rxpk
+type RXPacket struct {
+	Time string     `json:"time,omitempty"`
+	Tmst uint32     `json:"tmst"`
+	Tmms *uint64    `json:"tmms,omitempty"` // GPS 同步的网关才有
+	Chan int        `json:"chan"`
+	RFCh int        `json:"rfch"`
+	Freq float64    `json:"freq"` // MHz
+	Stat int        `json:"stat"`
+	Modu string     `json:"modu"`
+	DatR DataRateID `json:"datr"`
+	CodR string     `json:"codr,omitempty"`
+	RSSI float64    `json:"rssi"`
+	LSNR float64    `json:"lsnr"`
+	Size int        `json:"size"`
+	Data string     `json:"data"` // base64 PHYPayload
+}
+
+// DataRateID rxpk/txpk 的 datr：LoRa 为 "SF7BW125" 字符串，FSK 为比特率数字
+type DataRateID string
+
+// UnmarshalJSON 同时接受字符串和数字
+func (d *DataRateID) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*d = DataRateID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("datr must be a string or number: %s", b)
+	}
+	*d = DataRateID(n.String())
+	return nil
+}
+
+// MarshalJSON FSK 比特率按数字输出
+func (d DataRateID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.ParseUint(string(d), 10, 32); err == nil {
+		return []byte(d), nil
+	}
+	return json.Marshal(string(d))
+}
+
+// DecodeRXPacket 把网关推送的 rxpk（已解析为通用 JSON 值）转换为 RXPacket
+func DecodeRXPacket(v interface{}) (RXPacket, error) {
+	var pkt RXPacket
+	data, err := json.Marshal(v)
+	if err != nil {
+		return pkt, err
+	}
+	err = json.Unmarshal(data, &pkt)
+	return pkt, err
+}
+
+// RxInfo 转换为网络服务器内部使用的 rxInfo，数值统一为 float64（与 JSON 解码结果一致）
+func (p RXPacket) RxInfo() map[string]interface{} {
+	info := map[string]interface{}{
+		"tmst": float64(p.Tmst),
+		"chan": float64(p.Chan),
+		"rfch": float64(p.RFCh),
+		"freq": p.Freq,
+		"stat": float64(p.Stat),
+		"modu": p.Modu,
+		"datr": string(p.DatR),
+		"codr": p.CodR,
+		"rssi": p.RSSI,
+		"lsnr": p.LSNR,
+		"size": float64(p.Size),
+		"data": p.Data,
+	}
+	if p.Time != "" {
+		info["time"] = p.Time
+	}
+	if p.Tmms != nil {
+		info["tmms"] = float64(*p.Tmms)
+	}
+	return info
+}
+
+// GatewayTXMessage 网络服务器发布到 gateway.<id>.tx 的下行
+type GatewayTXMessage struct {
+	Version   int       `json:"version"`
+	GatewayID string    `json:"gatewayID"`
+	TXPK      TXPacket  `json:"txpk"`
+	Context   string    `json:"context,omitempty"` // 上行的 context，与 Timing 一起使用时按上行时间戳定时
+	Timing    *TXTiming `json:"timing,omitempty"`
+	TraceID   string    `json:"traceID,omitempty"`
+}
+
+// TXTiming context 模式下相对上行的发送延迟
+type TXTiming struct {
+	Delay string `json:"delay"` // 如 "1000ms"
+}
+
+// TXPacket Semtech UDP 协议的 txpk
+type TXPacket struct {
+	Imme bool       `json:"imme"`
+	Tmst *uint32    `json:"tmst,omitempty"` // 非即时发送时的网关时间戳
+	Tmms *uint64    `json:"tmms,omitempty"` // 按 GPS 时间发送（自 GPS 起点的毫秒数），与 tmst 二选一
+	Freq float64    `json:"freq"`           // MHz
+	RFCh int        `json:"rfch"`
+	Powe int        `json:"powe"`
+	Ant  int        `json:"ant"`
+	Brd  int        `json:"brd"`
+	Modu string     `json:"modu"`
+	DatR DataRateID `json:"datr"`
+	CodR string     `json:"codr"`
+	IPol bool       `json:"ipol"`
+	Prea int        `json:"prea,omitempty"` // 前导码长度，为 0 时由网关使用默认值
+	NCRC bool       `json:"ncrc,omitempty"` // 不带 CRC 发送（Class B 信标）
+	Size int        `json:"size"`
+	Data string     `json:"data"` // base64 PHYPayload
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGatewayProtocolCompatible(t *testing.T) {
+	tests := []struct {
+		version int
+		want    bool
+	}{
+		{0, true}, // 旧版本没有 version 字段
+		{GatewayProtocolVersion, true},
+		{GatewayProtocolVersion + 1, false},
+	}
+
+	for _, tt := range tests {
+		if got := GatewayProtocolCompatible(tt.version); got != tt.want {
+			t.Errorf("GatewayProtocolCompatible(%d) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestDataRateIDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    DataRateID
+		wantErr bool
+	}{
+		{"LoRa", `"SF7BW125"`, "SF7BW125", false},
+		{"FSK", `50000`, "50000", false},
+		{"invalid", `true`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got DataRateID
+			err := json.Unmarshal([]byte(tt.raw), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %q, want %q", tt.raw, got, tt.want)
+			}
+			// 按原格式输出
+			if out, _ := json.Marshal(got); string(out) != tt.raw {
+				t.Errorf("Marshal(%q) = %s, want %s", got, out, tt.raw)
+			}
+		})
+	}
+}
+
+func TestGatewayRXMessageUnmarshal(t *testing.T) {
+	tmms := uint64(1234567890123)
+
+	tests := []struct {
+		name string
+		raw  string
+		want GatewayRXMessage
+	}{
+		{
+			name: "current bridge",
+			raw:  `{"version":1,"gatewayID":"0102030405060708","rxpk":{"tmst":100000000,"tmms":1234567890123,"chan":2,"rfch":1,"freq":470.3,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","rssi":-60,"lsnr":9.5,"size":2,"data":"QAE="},"context":"e30=","timestamp":1700000000,"traceID":"0123456789abcdef"}`,
+			want: GatewayRXMessage{Version: 1, GatewayID: "0102030405060708", Context: "e30=", Timestamp: 1700000000, TraceID: "0123456789abcdef",
+				RXPK: RXPacket{Tmst: 100000000, Tmms: &tmms, Chan: 2, RFCh: 1, Freq: 470.3, Stat: 1, Modu: "LORA", DatR: "SF7BW125", CodR: "4/5", RSSI: -60, LSNR: 9.5, Size: 2, Data: "QAE="}},
+		},
+		{
+			// 旧版网关桥：没有 version、traceID，FSK 速率为数字
+			name: "legacy bridge",
+			raw:  `{"gatewayID":"0102030405060708","rxpk":{"tmst":5,"freq":470.3,"modu":"FSK","datr":50000,"rssi":-80,"data":"QAE="}}`,
+			want: GatewayRXMessage{GatewayID: "0102030405060708", RXPK: RXPacket{Tmst: 5, Freq: 470.3, Modu: "FSK", DatR: "50000", RSSI: -80, Data: "QAE="}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got GatewayRXMessage
+			if err := json.Unmarshal([]byte(tt.raw), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+
+			// 编码后再解码不丢字段
+			data, _ := json.Marshal(got)
+			var again GatewayRXMessage
+			if err := json.Unmarshal(data, &again); err != nil || !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("round trip = %+v, %v", again, err)
+			}
+		})
+	}
+}
+
+func TestDecodeRXPacket(t *testing.T) {
+	// 网关推送的 rxpk 经 JSON 解码后数值都是 float64
+	var v interface{}
+	json.Unmarshal([]byte(`{"tmst":100000000,"freq":470.3,"datr":"SF12BW125","rssi":-110,"lsnr":-7.5,"size":3,"data":"QAEC"}`), &v)
+
+	pkt, err := DecodeRXPacket(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RXPacket{Tmst: 100000000, Freq: 470.3, DatR: "SF12BW125", RSSI: -110, LSNR: -7.5, Size: 3, Data: "QAEC"}
+	if !reflect.DeepEqual(pkt, want) {
+		t.Errorf("DecodeRXPacket() = %+v, want %+v", pkt, want)
+	}
+
+	if _, err := DecodeRXPacket(map[string]interface{}{"tmst": "soon"}); err == nil {
+		t.Error("DecodeRXPacket() accepted a string tmst")
+	}
+}
+
+func TestRXPacketRxInfo(t *testing.T) {
+	tmms := uint64(42)
+
+	tests := []struct {
+		name string
+		pkt  RXPacket
+		want map[string]interface{}
+	}{
+		{"without time", RXPacket{Tmst: 100, Chan: 1, Freq: 470.3, DatR: "SF7BW125", RSSI: -60, LSNR: 9.5, Size: 2, Data: "QAE="},
+			map[string]interface{}{"tmst": float64(100), "chan": float64(1), "rfch": float64(0), "freq": 470.3, "stat": float64(0), "modu": "", "datr": "SF7BW125", "codr": "", "rssi": -60.0, "lsnr": 9.5, "size": float64(2), "data": "QAE="}},
+		{"with time and tmms", RXPacket{Time: "2024-01-01T00:00:00Z", Tmms: &tmms},
+			map[string]interface{}{"tmst": float64(0), "chan": float64(0), "rfch": float64(0), "freq": 0.0, "stat": float64(0), "modu": "", "datr": "", "codr": "", "rssi": 0.0, "lsnr": 0.0, "size": float64(0), "data": "", "time": "2024-01-01T00:00:00Z", "tmms": float64(42)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pkt.RxInfo(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RxInfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayTXMessageMarshal(t *testing.T) {
+	tmst := uint32(101000000)
+
+	tests := []struct {
+		name string
+		msg  GatewayTXMessage
+		want string
+	}{
+		{"immediate", GatewayTXMessage{Version: 1, GatewayID: "0102030405060708", TXPK: TXPacket{Imme: true, Freq: 500.3, Powe: 19, Modu: "LORA", DatR: "SF7BW125", CodR: "4/5", IPol: true, Size: 3, Data: "AQID"}},
+			`{"version":1,"gatewayID":"0102030405060708","txpk":{"imme":true,"freq":500.3,"rfch":0,"powe":19,"ant":0,"brd":0,"modu":"LORA","datr":"SF7BW125","codr":"4/5","ipol":true,"size":3,"data":"AQID"}}`},
+		{"timed FSK", GatewayTXMessage{Version: 1, GatewayID: "0102030405060708", TXPK: TXPacket{Tmst: &tmst, Freq: 500.3, Modu: "FSK", DatR: "50000", Size: 3, Data: "AQID"}, Context: "e30=", Timing: &TXTiming{Delay: "1000ms"}, TraceID: "0123456789abcdef"},
+			`{"version":1,"gatewayID":"0102030405060708","txpk":{"imme":false,"tmst":101000000,"freq":500.3,"rfch":0,"powe":0,"ant":0,"brd":0,"modu":"FSK","datr":50000,"codr":"","ipol":false,"size":3,"data":"AQID"},"context":"e30=","timing":{"delay":"1000ms"},"traceID":"0123456789abcdef"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() = %s\nwant %s", data, tt.want)
+			}
+
+			var got GatewayTXMessage
+			if err := json.Unmarshal(data, &got); err != nil || !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("round trip = %+v, %v", got, err)
+			}
+		})
+	}
+}
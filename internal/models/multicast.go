@@ -0,0 +1,36 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// MulticastGroupType 组播组的发送方式
+type MulticastGroupType string
+
+const (
+	// MulticastGroupClassC 组播下行立即发送，成员设备须工作在 C 类
+	MulticastGroupClassC MulticastGroupType = "C"
+	// MulticastGroupClassB 组播下行安排到组的 ping slot（暂未支持）
+	MulticastGroupClassB MulticastGroupType = "B"
+)
+
+// MulticastGroup 组播组：成员设备共享 McAddr 和组播会话密钥，一次下行同时送达所有成员
+type MulticastGroup struct {
+	BaseModel
+	ApplicationID uuid.UUID `json:"applicationId" db:"application_id"`
+	Name          string    `json:"name" db:"name"`
+
+	// 组播会话，密钥以十六进制保存
+	McAddr    DevAddr `json:"mcAddr" db:"mc_addr"`
+	McNwkSKey string  `json:"mcNwkSKey" db:"mc_nwk_s_key"`
+	McAppSKey string  `json:"mcAppSKey" db:"mc_app_s_key"`
+	FCnt      uint32  `json:"fCnt" db:"f_cnt"` // 下一个组播下行使用的帧计数器
+
+	// 发送方式和下行参数，Frequency 为 0 时使用 RX2 频率
+	GroupType MulticastGroupType `json:"groupType" db:"group_type"`
+	DR        int                `json:"dr" db:"dr"`
+	Frequency uint32             `json:"frequency" db:"frequency"`
+
+	// 成员设备
+	DevEUIs []EUI64 `json:"devEUIs"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+    "strings"
     "time"
     
     "github.com/google/uuid"
@@ -23,6 +24,7 @@ type Tenant struct {
     // Features
     CanHaveGateways  bool        `json:"canHaveGateways" db:"can_have_gateways"`
     PrivateGateways  bool        `json:"privateGateways" db:"private_gateways"`
+    AllowedRegions   []string    `json:"allowedRegions,omitempty" db:"allowed_regions"` // 空表示不限制
     
     // Billing
     BillingEmail     string      `json:"billingEmail,omitempty" db:"billing_email"`
@@ -33,6 +35,19 @@ type Tenant struct {
     SuspendedAt      *time.Time  `json:"suspendedAt,omitempty" db:"suspended_at"`
 }
 
+// AllowsRegion checks whether the tenant may operate in the given region
+func (t *Tenant) AllowsRegion(region string) bool {
+    if len(t.AllowedRegions) == 0 {
+        return true
+    }
+    for _, allowed := range t.AllowedRegions {
+        if strings.EqualFold(allowed, region) {
+            return true
+        }
+    }
+    return false
+}
+
 // TenantUser represents a user-tenant association
 type TenantUser struct {
     UserID           uuid.UUID   `json:"userId" db:"user_id"`
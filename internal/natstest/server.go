@@ -0,0 +1,332 @@
+// Package natstest provides a minimal in-process NATS server for tests. It speaks
+// enough of the client protocol for nats.go to connect, subscribe (including wildcards
+// and queue groups), publish with or without headers, and make requests; there is no
+// clustering, JetStream or authentication.
+package natstest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ConnectInfo is the part of a client's CONNECT message recorded by the server
+type ConnectInfo struct {
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	Pass      string `json:"pass"`
+	AuthToken string `json:"auth_token"`
+}
+
+// Server is a running test server
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	clients  map[*client]struct{}
+	nextID   int
+	connects []ConnectInfo
+	queues   map[string]int // round-robin position per subject and queue group
+}
+
+type client struct {
+	id   int
+	conn net.Conn
+	wmu  sync.Mutex
+	w    *bufio.Writer
+	subs map[string]*subscription // by sid, guarded by Server.mu
+}
+
+type subscription struct {
+	client    *client
+	sid       string
+	subject   string
+	queue     string
+	max       int // 0 means unlimited
+	delivered int
+}
+
+// Run starts a server on a random local port and stops it when the test ends
+func Run(t testing.TB) *Server {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("natstest: listen: %v", err)
+	}
+
+	s := &Server{
+		ln:      ln,
+		clients: make(map[*client]struct{}),
+		queues:  make(map[string]int),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URL is the address clients connect to
+func (s *Server) URL() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+// Conn connects a client, closed when the test ends
+func (s *Server) Conn(t testing.TB, opts ...nats.Option) *nats.Conn {
+	t.Helper()
+
+	nc, err := nats.Connect(s.URL(), append([]nats.Option{nats.NoReconnect()}, opts...)...)
+	if err != nil {
+		t.Fatalf("natstest: connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+// Connects returns the CONNECT messages received so far, in order
+func (s *Server) Connects() []ConnectInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ConnectInfo(nil), s.connects...)
+}
+
+// Close stops the server and disconnects all clients
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &client{conn: conn, w: bufio.NewWriter(conn), subs: make(map[string]*subscription)}
+		s.mu.Lock()
+		s.nextID++
+		c.id = s.nextID
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(c)
+		}()
+	}
+}
+
+func (s *Server) serve(c *client) {
+	defer func() {
+		c.conn.Close()
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	port := s.ln.Addr().(*net.TCPAddr).Port
+	c.write(fmt.Sprintf("INFO {\"server_id\":\"natstest\",\"server_name\":\"natstest\",\"version\":\"2.10.0\","+
+		"\"proto\":1,\"host\":\"127.0.0.1\",\"port\":%d,\"headers\":true,\"max_payload\":1048576}\r\n", port), nil)
+
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op, rest, _ := strings.Cut(line, " ")
+		args := strings.Fields(rest)
+
+		switch strings.ToUpper(op) {
+		case "CONNECT":
+			var info ConnectInfo
+			json.Unmarshal([]byte(rest), &info)
+			s.mu.Lock()
+			s.connects = append(s.connects, info)
+			s.mu.Unlock()
+		case "PING":
+			c.write("PONG\r\n", nil)
+		case "PONG":
+		case "SUB":
+			s.subscribe(c, args)
+		case "UNSUB":
+			s.unsubscribe(c, args)
+		case "PUB":
+			if len(args) < 2 {
+				return
+			}
+			size, _ := strconv.Atoi(args[len(args)-1])
+			payload, err := readPayload(r, size)
+			if err != nil {
+				return
+			}
+			s.route(args[0], reply(args, 2), -1, payload)
+		case "HPUB":
+			if len(args) < 3 {
+				return
+			}
+			hdrSize, _ := strconv.Atoi(args[len(args)-2])
+			size, _ := strconv.Atoi(args[len(args)-1])
+			payload, err := readPayload(r, size)
+			if err != nil {
+				return
+			}
+			s.route(args[0], reply(args, 3), hdrSize, payload)
+		default:
+			c.write("-ERR 'Unknown Protocol Operation'\r\n", nil)
+		}
+	}
+}
+
+// reply returns the optional reply subject of a PUB/HPUB with n required arguments
+func reply(args []string, n int) string {
+	if len(args) > n {
+		return args[1]
+	}
+	return ""
+}
+
+func readPayload(r *bufio.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size+2) // payload and the trailing CRLF
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+func (s *Server) subscribe(c *client, args []string) {
+	if len(args) < 2 {
+		return
+	}
+	sub := &subscription{client: c, subject: args[0], sid: args[len(args)-1]}
+	if len(args) > 2 {
+		sub.queue = args[1]
+	}
+
+	s.mu.Lock()
+	c.subs[sub.sid] = sub
+	s.mu.Unlock()
+}
+
+func (s *Server) unsubscribe(c *client, args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := c.subs[args[0]]
+	if !ok {
+		return
+	}
+	if len(args) > 1 {
+		if max, err := strconv.Atoi(args[1]); err == nil && max > sub.delivered {
+			sub.max = max
+			return
+		}
+	}
+	delete(c.subs, sub.sid)
+}
+
+// route delivers a message to every matching plain subscription and one member of
+// each matching queue group; hdrSize < 0 means the message has no headers
+func (s *Server) route(subject, replyTo string, hdrSize int, payload []byte) {
+	s.mu.Lock()
+	var targets []*subscription
+	groups := make(map[string][]*subscription)
+	for c := range s.clients {
+		for _, sub := range c.subs {
+			if !subjectMatches(sub.subject, subject) {
+				continue
+			}
+			if sub.queue == "" {
+				targets = append(targets, sub)
+			} else {
+				key := sub.subject + " " + sub.queue
+				groups[key] = append(groups[key], sub)
+			}
+		}
+	}
+	for key, members := range groups {
+		sortSubscriptions(members)
+		n := s.queues[key]
+		s.queues[key] = n + 1
+		targets = append(targets, members[n%len(members)])
+	}
+	for _, sub := range targets {
+		sub.delivered++
+		if sub.max > 0 && sub.delivered >= sub.max {
+			delete(sub.client.subs, sub.sid)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sub := range targets {
+		head := "MSG " + subject + " " + sub.sid
+		if replyTo != "" {
+			head += " " + replyTo
+		}
+		if hdrSize >= 0 {
+			head = "H" + head + " " + strconv.Itoa(hdrSize)
+		}
+		sub.client.write(head+" "+strconv.Itoa(len(payload))+"\r\n", payload)
+	}
+}
+
+// sortSubscriptions orders queue group members by client and sid so round-robin is stable
+func sortSubscriptions(subs []*subscription) {
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].client.id != subs[j].client.id {
+			return subs[i].client.id < subs[j].client.id
+		}
+		return subs[i].sid < subs[j].sid
+	})
+}
+
+func (c *client) write(head string, payload []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	c.w.WriteString(head)
+	if payload != nil {
+		c.w.Write(payload)
+		c.w.WriteString("\r\n")
+	}
+	c.w.Flush()
+}
+
+// subjectMatches reports whether subject matches pattern, which may contain the
+// * (one token) and > (all remaining tokens) wildcards
+func subjectMatches(pattern, subject string) bool {
+	p := strings.Split(pattern, ".")
+	s := strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || (token != "*" && token != s[i]) {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
@@ -0,0 +1,91 @@
+package natstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"gateway.a.rx", "gateway.a.rx", true},
+		{"gateway.*.rx", "gateway.a.rx", true},
+		{"gateway.*.rx", "gateway.a.tx", false},
+		{"gateway.>", "gateway.a.rx", true},
+		{"gateway.>", "gateway", false},
+		{"gateway.*", "gateway.a.rx", false},
+		{"gateway.a.rx", "gateway.a", false},
+	}
+
+	for _, tt := range tests {
+		if got := subjectMatches(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("subjectMatches(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	s := Run(t)
+	sub := s.Conn(t)
+	pub := s.Conn(t, nats.Name("publisher"))
+
+	msgs, err := sub.SubscribeSync("device.*.up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Flush()
+
+	out := nats.NewMsg("device.a.up")
+	out.Header.Set("trace", "abc")
+	out.Data = []byte("hello")
+	pub.PublishMsg(out)
+	pub.Publish("device.a.down", []byte("ignored"))
+	pub.Flush()
+
+	msg, err := msgs.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != "hello" || msg.Header.Get("trace") != "abc" {
+		t.Errorf("received %q with headers %v", msg.Data, msg.Header)
+	}
+	if _, err := msgs.NextMsg(50 * time.Millisecond); err == nil {
+		t.Error("received a message on a non-matching subject")
+	}
+
+	if connects := s.Connects(); len(connects) != 2 || connects[1].Name != "publisher" {
+		t.Errorf("Connects() = %+v", connects)
+	}
+}
+
+func TestQueueGroupAndRequest(t *testing.T) {
+	s := Run(t)
+	a, b := s.Conn(t), s.Conn(t)
+
+	counts := make(chan string, 10)
+	for name, nc := range map[string]*nats.Conn{"a": a, "b": b} {
+		name := name
+		nc.QueueSubscribe("work", "workers", func(m *nats.Msg) {
+			counts <- name
+			m.Respond([]byte(name))
+		})
+		nc.Flush()
+	}
+
+	client := s.Conn(t)
+	got := map[string]int{}
+	for i := 0; i < 4; i++ {
+		reply, err := client.Request("work", nil, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[string(reply.Data)]++
+	}
+	if got["a"] != 2 || got["b"] != 2 {
+		t.Errorf("queue members handled %v, want 2 each", got)
+	}
+}
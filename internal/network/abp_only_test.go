@@ -0,0 +1,70 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+func TestABPOnlyJoinRefused(t *testing.T) {
+	tests := []struct {
+		name         string
+		abpOnly      bool
+		wantAccepted bool
+	}{
+		{"OTAA profile", false, true},
+		{"ABP only profile", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", ABPOnly: tt.abpOnly}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestOTAADevice(t, store)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+			// ABP 设备已有的会话
+			abp := saveTestSession(t, store, testDevEUI, "")
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			p.handleJoinRequest(newTestJoinRequest(t, 0x0001), testGatewayID, testRxInfo())
+
+			if accepted := nextTX(t, txs) != nil; accepted != tt.wantAccepted {
+				t.Fatalf("JOIN ACCEPT sent = %v, want %v", accepted, tt.wantAccepted)
+			}
+			session, err := store.GetDeviceSession(ctx, testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replaced := session.DevAddr != abp.DevAddr; replaced != tt.wantAccepted {
+				t.Errorf("ABP session replaced = %v, want %v", replaced, tt.wantAccepted)
+			}
+
+			eventType := models.EventTypeJoin
+			events, _, _ := store.ListEventLogs(ctx, storage.EventLogFilters{Type: &eventType}, 10, 0)
+			rejected := 0
+			for _, event := range events {
+				if event.Code == "JOIN_REJECTED_ABP_ONLY" {
+					rejected++
+				}
+			}
+			wantRejected, wantNonce := 1, byte(1)
+			if tt.wantAccepted {
+				wantRejected, wantNonce = 0, 2
+			}
+			if rejected != wantRejected {
+				t.Errorf("%d JOIN_REJECTED_ABP_ONLY events, want %d", rejected, wantRejected)
+			}
+
+			// 被拒绝的 JOIN 不消耗 JoinNonce
+			if nonce, _ := p.nextJoinNonce(ctx, testDevEUI); nonce != [3]byte{wantNonce} {
+				t.Errorf("next JoinNonce = %x, want %d", nonce, wantNonce)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// ackResendMinInterval 同一确认上行再次到达的间隔超过此时间视为设备重传，
+// 更短的间隔是其他网关收到的副本
+const ackResendMinInterval = time.Second
+
+// sentACKTTL 已发送 ACK 的缓存时间，覆盖设备的确认上行重传周期
+const sentACKTTL = time.Minute
+
+// sentACK 已发送的确认上行 ACK，设备重传时原样重发，不再分配下行计数器
+type sentACK struct {
+	mu       sync.Mutex
+	devEUI   lorawan.EUI64
+	devAddr  lorawan.DevAddr
+	phy      lorawan.PHYPayload
+	fCntDown uint32
+	rx1Delay time.Duration
+	sentAt   time.Time
+}
+
+// rememberACK 记录确认上行（按去重键）对应的 ACK
+func (p *Processor) rememberACK(uplinkKey string, ack *sentACK) {
+	ack.sentAt = time.Now()
+	p.ackCache.Set(uplinkKey, ack, sentACKTTL)
+}
+
+// resendACK 设备没收到 ACK 而重传确认上行时，经本次接收的网关重发原 ACK。
+// 返回 false 表示没有缓存的 ACK，由调用方按普通上行处理
+func (p *Processor) resendACK(uplinkKey string, gatewayID string, rxInfo map[string]interface{}) bool {
+	v, ok := p.ackCache.Get(uplinkKey)
+	if !ok {
+		return false
+	}
+	ack := v.(*sentACK)
+
+	ack.mu.Lock()
+	if time.Since(ack.sentAt) < ackResendMinInterval {
+		// 多网关副本，ACK 已经发出
+		ack.mu.Unlock()
+		return true
+	}
+	ack.sentAt = time.Now()
+	ack.mu.Unlock()
+
+	p.scheduleDownlink(gatewayID, ack.devAddr, ack.phy, rxInfo, ack.rx1Delay)
+
+	logging.Frame().Info().
+		Str("devEUI", ack.devEUI.String()).
+		Str("gatewayID", gatewayID).
+		Uint32("downlinkFCnt", ack.fCntDown).
+		Msg("设备重传确认上行，重发原 ACK")
+	return true
+}
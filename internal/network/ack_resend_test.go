@@ -0,0 +1,145 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestRetransmittedConfirmedUplinkReusesACK(t *testing.T) {
+	fPort := uint8(1)
+
+	tests := []struct {
+		name        string
+		aged        bool // 原 ACK 发出已超过 ackResendMinInterval，视为设备重传
+		afterWindow bool // 去重缓存已过期
+		fCnt        uint32
+		wantACK     bool
+		wantSame    bool
+	}{
+		{"retransmission", true, false, 1, true, true},
+		{"retransmission after dedup window", true, true, 1, true, true},
+		// 其他网关收到的副本，ACK 已经发出
+		{"copy from another gateway", false, false, 1, false, false},
+		{"next uplink", true, false, 2, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			uplink := newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1})
+			p.handleDataUp(uplink, testGatewayID, testRxInfo())
+			first := nextTX(t, txs)
+			if first == nil {
+				t.Fatal("no ACK sent")
+			}
+			_, firstMAC := decodeDownlink(t, first)
+			if !firstMAC.FHDR.FCtrl.ACK {
+				t.Fatal("first downlink is not an ACK")
+			}
+			session, _ := store.GetDeviceSession(ctx, testDevEUI)
+			nFCntDown := session.NFCntDown
+
+			if tt.aged {
+				p.ackCache.mu.Lock()
+				for _, item := range p.ackCache.items {
+					item.Value.(*sentACK).sentAt = time.Now().Add(-ackResendMinInterval)
+				}
+				p.ackCache.mu.Unlock()
+			}
+			if tt.afterWindow {
+				p.joinCache = NewSimpleCache()
+			}
+
+			p.handleDataUp(newTestUplink(t, lorawan.ConfirmedDataUp, tt.fCnt, &fPort, []byte{1}), testGatewayID, testRxInfo())
+			tx := nextTX(t, txs)
+			if (tx != nil) != tt.wantACK {
+				t.Fatalf("ACK sent = %v, want %v", tx != nil, tt.wantACK)
+			}
+			if tx == nil {
+				return
+			}
+
+			_, mac := decodeDownlink(t, tx)
+			session, _ = store.GetDeviceSession(ctx, testDevEUI)
+			if tt.wantSame {
+				if tx.TXPK.Data != first.TXPK.Data || mac.FHDR.FCnt != firstMAC.FHDR.FCnt {
+					t.Errorf("resent ACK FCnt %d (%s), want identical ACK FCnt %d (%s)", mac.FHDR.FCnt, tx.TXPK.Data, firstMAC.FHDR.FCnt, first.TXPK.Data)
+				}
+				if session.NFCntDown != nFCntDown {
+					t.Errorf("NFCntDown = %d after resend, want %d", session.NFCntDown, nFCntDown)
+				}
+				return
+			}
+			if mac.FHDR.FCnt != firstMAC.FHDR.FCnt+1 {
+				t.Errorf("ACK for the next uplink FCnt = %d, want %d", mac.FHDR.FCnt, firstMAC.FHDR.FCnt+1)
+			}
+		})
+	}
+}
+
+func TestConfirmedUplinkACKRidesOnQueuedFrame(t *testing.T) {
+	fPort := uint8(1)
+
+	tests := []struct {
+		name      string
+		queued    bool
+		wantFPort int16 // -1 表示没有 FPort
+	}{
+		{"queued frame", true, 5},
+		// 队列为空时单独发送 ACK
+		{"empty queue", false, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			if tt.queued {
+				store.CreateDownlinkFrame(ctx, &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), FPort: 5, Data: []byte{0xaa}})
+			}
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			p.handleDataUp(newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if extra := nextTX(t, txs); extra != nil {
+				t.Error("ACK and queued frame sent as separate downlinks")
+			}
+
+			_, mac := decodeDownlink(t, tx)
+			if !mac.FHDR.FCtrl.ACK {
+				t.Error("downlink does not acknowledge the confirmed uplink")
+			}
+			if got := getFPortValue(mac.FPort); got != tt.wantFPort {
+				t.Errorf("FPort = %d, want %d", got, tt.wantFPort)
+			}
+			if pending, _ := store.GetPendingDownlinks(ctx, testDevEUI); len(pending) != 0 {
+				t.Errorf("%d downlinks still pending", len(pending))
+			}
+
+			// 设备没收到时重传确认上行，重发同一帧
+			p.ackCache.mu.Lock()
+			for _, item := range p.ackCache.items {
+				item.Value.(*sentACK).sentAt = time.Now().Add(-ackResendMinInterval)
+			}
+			p.ackCache.mu.Unlock()
+			p.handleDataUp(newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+			if resent := nextTX(t, txs); resent == nil || resent.TXPK.Data != tx.TXPK.Data {
+				t.Errorf("retransmitted confirmed uplink did not resend the same downlink")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// globalADREnabled 全局 ADR 开关，CN470 还需要频段 ADR 配置开启
+func (p *Processor) globalADREnabled() bool {
+	if !p.config.Network.ADREnabled {
+		return false
+	}
+	if p.region.Name == "CN470" {
+		return p.config.CN470.ADR.Enabled
+	}
+	return true
+}
+
+// resolveADR 结合设备配置文件、全局开关和上行 FCtrl.ADR 决定本次是否执行 ADR
+func (p *Processor) resolveADR(ctx context.Context, session *models.DeviceSession, uplinkADR bool) bool {
+	if !uplinkADR {
+		return false
+	}
+
+	mode := models.ADRModeAuto
+	device, err := p.store.GetDevice(ctx, lorawan.EUI64(session.DevEUI))
+	if err == nil {
+		if profile, err := p.store.GetDeviceProfile(ctx, device.DeviceProfileID); err == nil {
+			mode = profile.ADRMode
+		}
+	}
+
+	enabled := mode.Resolve(p.globalADREnabled(), uplinkADR)
+	if !enabled {
+		log.Debug().
+			Str("devEUI", session.DevEUI.String()).
+			Str("adrMode", string(mode)).
+			Msg("设备请求 ADR，但配置禁用")
+	}
+	return enabled
+}
+
+// recordADRSample 用上行速率更新会话的当前 DR，并把本次上行的 SNR 记入 ADR 历史
+func (p *Processor) recordADRSample(session *models.DeviceSession, fCnt uint32, rxInfo map[string]interface{}) {
+	datr, _ := rxInfo["datr"].(string)
+	if dr, ok := p.getDRIndex(datr); ok {
+		session.DR = dr
+	}
+
+	if _, ok := rxInfo["lsnr"]; !ok {
+		return
+	}
+	p.macHandler.RecordUplink(session.DevEUI, models.ADRHistory{
+		FCnt:         fCnt,
+		MaxSNR:       getFloat64(rxInfo, "lsnr"),
+		TXPower:      session.TXPower,
+		GatewayCount: 1,
+	})
+}
+
+// logADRTarget 下行携带 LinkADRReq 时记录下发的目标速率和功率，便于调试 ADR
+func (p *Processor) logADRTarget(ctx context.Context, session *models.DeviceSession, cmds []lorawan.MACCommand) {
+	for _, cmd := range cmds {
+		if cmd.CID != lorawan.LinkADRReq || len(cmd.Payload) != 4 {
+			continue
+		}
+		logging.Ctx(ctx).Info().
+			Str("devEUI", session.DevEUI.String()).
+			Uint32("fCnt", session.NFCntDown).
+			Uint8("dr", session.DR).
+			Uint8("txPower", session.TXPower).
+			Uint8("targetDR", cmd.Payload[0]>>4).
+			Uint8("targetTXPower", cmd.Payload[0]&0x0F).
+			Uint8("nbTrans", cmd.Payload[3]&0x0F).
+			Msg("下行携带 LinkADRReq")
+	}
+}
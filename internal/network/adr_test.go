@@ -0,0 +1,77 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// adrTestConfig 启用 ADR，一个样本即可计算目标速率
+func adrTestConfig(globalADR bool) *config.Config {
+	cfg := &config.Config{}
+	cfg.Network.ADREnabled = globalADR
+	cfg.CN470.ADR = config.CN470ADR{
+		Enabled:     true,
+		TargetSNR:   -10,
+		HistorySize: 1,
+		MaxDataRate: 5,
+		MaxTXPower:  7,
+	}
+	return cfg
+}
+
+func hasLinkADRReq(cmds []lorawan.MACCommand) bool {
+	for _, cmd := range cmds {
+		if cmd.CID == lorawan.LinkADRReq {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProfileADRModeOverridesGlobalFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		globalADR bool
+		mode      models.ADRMode
+		uplinkADR bool
+		want      bool
+	}{
+		{"auto follows global on", true, models.ADRModeAuto, true, true},
+		{"auto follows global off", false, models.ADRModeAuto, true, false},
+		{"unset follows global on", true, "", true, true},
+		{"off overrides global on", true, models.ADRModeOff, true, false},
+		{"on overrides global off", false, models.ADRModeOn, true, true},
+		{"on without uplink ADR bit", true, models.ADRModeOn, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, _ := newTestProcessor(t, adrTestConfig(tt.globalADR))
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", ADRMode: tt.mode}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+
+			session := saveTestSession(t, store, testDevEUI, "")
+			// SNR 余量足够提高速率
+			p.recordADRSample(session, 1, map[string]interface{}{"datr": "SF12BW125", "lsnr": 10.0})
+
+			session.ADR = p.resolveADR(ctx, session, tt.uplinkADR)
+			if session.ADR != tt.want {
+				t.Errorf("resolveADR() = %v, want %v", session.ADR, tt.want)
+			}
+
+			cmds := p.macHandler.HandleUplink(session, profile, nil)
+			if got := hasLinkADRReq(cmds); got != tt.want {
+				t.Errorf("LinkADRReq sent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// CacheDebugSubject 查询处理器内存缓存状态的 NATS 主题（request/reply）
+const CacheDebugSubject = "ns.debug.caches"
+
+// cacheSampleSize 每个缓存返回的样本数
+const cacheSampleSize = 10
+
+// CacheDebugInfo 处理器内存缓存的大小和样本，不包含 rxInfo 等原始数据
+type CacheDebugInfo struct {
+	DeviceRxCache struct {
+		Size   int                `json:"size"`
+		Sample []DeviceRxCacheRow `json:"sample"`
+	} `json:"deviceRxCache"`
+
+	JoinCache    CacheKeys `json:"joinCache"`
+	GatewayCache CacheKeys `json:"gatewayCache"`
+	ProfileCache CacheKeys `json:"profileCache"`
+
+	Timestamps struct {
+		Size   int                 `json:"size"`
+		Sample []GatewayClockStats `json:"sample"`
+	} `json:"timestampTracker"`
+}
+
+// DeviceRxCacheRow 设备上行缓存中的一条记录
+type DeviceRxCacheRow struct {
+	DevEUI     string    `json:"devEUI"`
+	GatewayID  string    `json:"gatewayID"`
+	Candidates int       `json:"candidates"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// CacheKeys 缓存的有效条目数和部分键
+type CacheKeys struct {
+	Size   int      `json:"size"`
+	Sample []string `json:"sample"`
+}
+
+// debugKeys 返回未过期的条目数和按字典序的前 n 个键
+func (c *SimpleCache) debugKeys(n int) CacheKeys {
+	c.mu.RLock()
+	now := time.Now()
+	keys := make([]string, 0, len(c.items))
+	for key, item := range c.items {
+		if now.Before(item.Expiry) {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Strings(keys)
+	info := CacheKeys{Size: len(keys), Sample: keys}
+	if len(keys) > n {
+		info.Sample = keys[:n]
+	}
+	return info
+}
+
+// cacheDebugInfo 汇总各缓存的状态
+func (p *Processor) cacheDebugInfo() CacheDebugInfo {
+	var info CacheDebugInfo
+
+	p.rxCacheMutex.RLock()
+	rows := make([]DeviceRxCacheRow, 0, len(p.deviceRxCache))
+	for devEUI, rx := range p.deviceRxCache {
+		row := DeviceRxCacheRow{
+			DevEUI:    devEUI.String(),
+			GatewayID: rx.GatewayID,
+			Timestamp: rx.Timestamp,
+		}
+		if rx.Candidates != nil {
+			rx.Candidates.mu.Lock()
+			row.Candidates = len(rx.Candidates.list)
+			rx.Candidates.mu.Unlock()
+		}
+		rows = append(rows, row)
+	}
+	p.rxCacheMutex.RUnlock()
+
+	// 最近的上行在前
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Timestamp.After(rows[j].Timestamp) })
+	info.DeviceRxCache.Size = len(rows)
+	if len(rows) > cacheSampleSize {
+		rows = rows[:cacheSampleSize]
+	}
+	info.DeviceRxCache.Sample = rows
+
+	info.JoinCache = p.joinCache.debugKeys(cacheSampleSize)
+	info.GatewayCache = p.gatewayCache.debugKeys(cacheSampleSize)
+	info.ProfileCache = p.profileCache.debugKeys(cacheSampleSize)
+
+	stats := p.timestampTracker.Stats()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].GatewayID < stats[j].GatewayID })
+	info.Timestamps.Size = len(stats)
+	if len(stats) > cacheSampleSize {
+		stats = stats[:cacheSampleSize]
+	}
+	info.Timestamps.Sample = stats
+
+	return info
+}
+
+// handleCacheDebug 回复缓存状态
+func (p *Processor) handleCacheDebug(msg *nats.Msg) {
+	if msg.Reply == "" {
+		return
+	}
+	data, _ := json.Marshal(p.cacheDebugInfo())
+	if err := msg.Respond(data); err != nil {
+		log.Error().Err(err).Msg("回复缓存状态失败")
+	}
+}
@@ -0,0 +1,86 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestCacheDebugInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		devices     int
+		joins       int
+		expiredJoin bool
+		gateways    int
+		wantSample  int
+	}{
+		{"empty", 0, 0, false, 0, 0},
+		{"few entries", 3, 2, false, 1, 3},
+		// 超过样本数时只返回最近的 10 个
+		{"sampled", 12, 15, false, 12, 10},
+		{"expired join not listed", 1, 1, true, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, srv := newTestProcessor(t, nil)
+			for i := 0; i < tt.devices; i++ {
+				devEUI := lorawan.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, byte(i)}
+				cacheTestUplink(p, devEUI, testGatewayID)
+				p.deviceRxCache[devEUI].Timestamp = time.Now().Add(time.Duration(i) * time.Second)
+			}
+			for i := 0; i < tt.joins; i++ {
+				p.joinCache.Set(fmt.Sprintf("join:%02d", i), true, time.Minute)
+			}
+			if tt.expiredJoin {
+				p.joinCache.Set("join:expired", true, -time.Second)
+			}
+			for i := 0; i < tt.gateways; i++ {
+				p.timestampTracker.UpdateAndCheck(fmt.Sprintf("gw%02d", i), 1000000, false)
+			}
+
+			sub, _ := srv.Conn(t).Subscribe(CacheDebugSubject, p.handleCacheDebug)
+			defer sub.Unsubscribe()
+			reply, err := srv.Conn(t).Request(CacheDebugSubject, nil, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// rxInfo 等原始数据不返回
+			if strings.Contains(string(reply.Data), "tmst") || strings.Contains(string(reply.Data), "rxInfo\"") {
+				t.Errorf("reply contains raw uplink data: %s", reply.Data)
+			}
+
+			var info CacheDebugInfo
+			if err := json.Unmarshal(reply.Data, &info); err != nil {
+				t.Fatal(err)
+			}
+			if info.DeviceRxCache.Size != tt.devices || len(info.DeviceRxCache.Sample) != tt.wantSample {
+				t.Errorf("deviceRxCache size %d sample %d, want %d and %d", info.DeviceRxCache.Size, len(info.DeviceRxCache.Sample), tt.devices, tt.wantSample)
+			}
+			if tt.devices > 0 {
+				newest := info.DeviceRxCache.Sample[0]
+				if want := (lorawan.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, byte(tt.devices - 1)}).String(); newest.DevEUI != want || newest.GatewayID != testGatewayID {
+					t.Errorf("newest entry = %+v, want %s via %s", newest, want, testGatewayID)
+				}
+			}
+
+			wantJoins := min(tt.joins, cacheSampleSize)
+			if info.JoinCache.Size != tt.joins || len(info.JoinCache.Sample) != wantJoins {
+				t.Errorf("joinCache = %+v, want size %d", info.JoinCache, tt.joins)
+			}
+			if tt.joins > 0 && info.JoinCache.Sample[0] != "join:00" {
+				t.Errorf("joinCache sample not sorted: %v", info.JoinCache.Sample)
+			}
+
+			if info.Timestamps.Size != tt.gateways || len(info.Timestamps.Sample) != min(tt.gateways, cacheSampleSize) {
+				t.Errorf("timestampTracker size %d sample %d, want %d", info.Timestamps.Size, len(info.Timestamps.Sample), tt.gateways)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// cfListMaxChannels CFList 最多携带 5 个信道
+const cfListMaxChannels = 5
+
+// validateCFListChannels 校验 CFList 候选频率，确保下发的信道是启用信道的连续子集。
+// 不在启用信道中或硬件不支持的频率被剔除，剩余位置用启用信道补齐，频率依次紧凑排列。
+func (p *Processor) validateCFListChannels(candidates []uint32) []uint32 {
+	enabledUplink, _ := p.config.CN470.GetEnabledChannels()
+
+	enabled := make(map[uint32]bool, len(enabledUplink))
+	for _, freq := range enabledUplink {
+		enabled[freq] = true
+	}
+
+	maxChannels := p.config.CN470.Channels.CFListChannels
+	if maxChannels <= 0 || maxChannels > cfListMaxChannels {
+		maxChannels = cfListMaxChannels
+	}
+
+	used := make(map[uint32]bool)
+	var channels []uint32
+
+	accept := func(freq uint32) bool {
+		if used[freq] || !p.config.CN470.ValidateFrequency(freq) {
+			return false
+		}
+		if len(enabled) > 0 && !enabled[freq] {
+			return false
+		}
+		used[freq] = true
+		channels = append(channels, freq)
+		return true
+	}
+
+	// 第一个启用信道是设备已知的默认信道，不放入 CFList
+	if len(enabledUplink) > 0 {
+		used[enabledUplink[0]] = true
+	}
+
+	for _, freq := range candidates {
+		if len(channels) >= maxChannels {
+			break
+		}
+		if !accept(freq) {
+			log.Warn().
+				Uint32("freq", freq).
+				Msg("CFList 频率不在启用信道或硬件范围内，已剔除")
+		}
+	}
+
+	// 候选不足时用启用信道补齐
+	expected := maxChannels
+	if len(enabledUplink) > 0 {
+		if len(enabledUplink)-1 < expected {
+			expected = len(enabledUplink) - 1
+		}
+
+		for _, freq := range enabledUplink[1:] {
+			if len(channels) >= expected {
+				break
+			}
+			accept(freq)
+		}
+	}
+
+	if len(channels) < expected {
+		log.Warn().
+			Int("channels", len(channels)).
+			Int("expected", expected).
+			Int("candidates", len(candidates)).
+			Msg("CFList 可用信道少于预期")
+	}
+
+	return channels
+}
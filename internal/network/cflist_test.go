@@ -0,0 +1,62 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+// encodeCFList 按 CFList 格式（100Hz 单位，3 字节小端序）编码频率
+func encodeCFList(freqs ...uint32) []byte {
+	cfList := make([]byte, 16)
+	for i, freq := range freqs {
+		f := freq / 100
+		cfList[i*3], cfList[i*3+1], cfList[i*3+2] = byte(f), byte(f>>8), byte(f>>16)
+	}
+	return cfList
+}
+
+func TestGenerateCN470CFListCustomPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(c *config.CN470Config)
+		expected []byte
+	}{
+		{"custom plan", func(c *config.CN470Config) {}, encodeCFList(470500000, 470700000, 470900000, 471100000, 471300000)},
+		{"channel count", func(c *config.CN470Config) { c.Channels.CFListChannels = 3 }, encodeCFList(470500000, 470700000, 470900000)},
+		{"channel count above 5", func(c *config.CN470Config) { c.Channels.CFListChannels = 8 }, encodeCFList(470500000, 470700000, 470900000, 471100000, 471300000)},
+		{"spacing", func(c *config.CN470Config) {
+			c.Channels.ChannelSpacing = 400000
+			c.CustomFDD.UplinkEndFreq = 473100000
+			c.CustomFDD.DownlinkEndFreq = 503100000
+		},
+			encodeCFList(470700000, 471100000, 471500000, 471900000, 472300000)},
+		// 频段只有 4 个信道，第一个为默认信道
+		{"fewer enabled channels", func(c *config.CN470Config) { c.CustomFDD.UplinkEndFreq = 470900000 }, encodeCFList(470500000, 470700000, 470900000)},
+		{"unsupported hardware", func(c *config.CN470Config) { c.Hardware.SupportsTX470_490MHz = false }, encodeCFList()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{CN470: config.CN470Config{
+				Mode:     "CUSTOM_FDD",
+				Hardware: config.CN470HardwareConfig{SupportsTX470_490MHz: true},
+				CustomFDD: config.CN470CustomFDD{
+					UplinkStartFreq:   470300000,
+					UplinkEndFreq:     471900000,
+					DownlinkStartFreq: 500300000,
+					DownlinkEndFreq:   501900000,
+					UplinkChannels:    8,
+				},
+				Channels: config.CN470Channels{ChannelSpacing: 200000},
+			}}
+			tt.modify(&cfg.CN470)
+			p, _, _ := newTestProcessor(t, cfg)
+
+			if got := p.generateCN470CFList(); !bytes.Equal(got, tt.expected) {
+				t.Errorf("CFList = %x, want %x", got, tt.expected)
+			}
+		})
+	}
+}
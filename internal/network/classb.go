@@ -0,0 +1,243 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+const (
+	// classBMinLead ping slot 距现在的最短时间，留出下行经 NATS 和网关桥到达网关的时间
+	classBMinLead = time.Second
+	// beaconLead 提前多久把信标发给网关，由网关按时间戳发送
+	beaconLead = 5 * time.Second
+	// beaconPreamble 信标前导码长度（符号数）
+	beaconPreamble = 10
+)
+
+// errGatewayMaintenance 网关处于维护中，不安排 Class B 下行
+var errGatewayMaintenance = errors.New("网关处于维护中")
+
+// classBSlot 为下行选定的 ping slot
+type classBSlot struct {
+	gps     time.Duration // slot 起点（GPS 时间）
+	tmst    uint32        // 同一时刻的网关计数器
+	hasTmst bool          // 为 false 时按 GPS 时间（tmms）发送
+	freq    uint32        // Hz
+	dr      int
+}
+
+// ClassBScheduler 每个信标周期向 GPS 同步的网关发送 Class B 信标，
+// 并把 B 类设备的应用下行安排到设备的 ping slot
+type ClassBScheduler struct {
+	p *Processor
+
+	mu       sync.Mutex
+	reserved map[lorawan.EUI64]time.Duration // 设备已占用的最后一个 ping slot（GPS 时间）
+}
+
+// NewClassBScheduler creates the Class B scheduler of a processor
+func NewClassBScheduler(p *Processor) *ClassBScheduler {
+	return &ClassBScheduler{p: p, reserved: make(map[lorawan.EUI64]time.Duration)}
+}
+
+// beaconFrequency 信标频率（Hz），未配置时使用 RX2 频率
+func (s *ClassBScheduler) beaconFrequency() uint32 {
+	if freq := s.p.config.CN470.MAC.BeaconFrequency; freq > 0 {
+		return freq
+	}
+	return s.p.getRegionRX2Freq()
+}
+
+// pingSlotParams 设备的 ping slot 周期、频率和速率：设备配置文件设置了 PingSlotFreq 时使用配置文件的
+// 频率和速率，否则使用全局配置；配置文件的 PingSlotPeriod（periodicity 0-7）为 0 时使用全局周期
+func (s *ClassBScheduler) pingSlotParams(profile *models.DeviceProfile) (periodicity int, freq uint32, dr int) {
+	mac := s.p.config.CN470.MAC
+	periodicity, freq, dr = mac.PingSlotPeriodicity, mac.PingSlotFrequency, mac.PingSlotDataRate
+	if freq == 0 {
+		freq = s.beaconFrequency()
+	}
+
+	if profile == nil {
+		return periodicity, freq, dr
+	}
+	if profile.PingSlotPeriod > 0 {
+		periodicity = profile.PingSlotPeriod
+	}
+	if profile.PingSlotFreq > 0 {
+		freq, dr = uint32(profile.PingSlotFreq), profile.PingSlotDR
+	}
+	return periodicity, freq, dr
+}
+
+// Reserve 为设备选择经由该网关的下一个 ping slot。同一设备的多个下行依次占用后续的 slot，
+// 不会安排到同一个 slot
+func (s *ClassBScheduler) Reserve(gatewayID string, devEUI lorawan.EUI64, devAddr lorawan.DevAddr, profile *models.DeviceProfile) (classBSlot, error) {
+	if s.p.maintenance.active(gatewayID) {
+		return classBSlot{}, errGatewayMaintenance
+	}
+	periodicity, freq, dr := s.pingSlotParams(profile)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 已过去的占用不再约束，slot 起点之后 1ms 开始找下一个
+	var notBefore time.Duration
+	if last, ok := s.reserved[devEUI]; ok {
+		notBefore = last + time.Millisecond
+	}
+
+	gps, tmst, hasTmst, err := s.p.nextPingSlot(gatewayID, devAddr, periodicity, notBefore)
+	if err != nil {
+		return classBSlot{}, err
+	}
+	s.reserved[devEUI] = gps
+	return classBSlot{gps: gps, tmst: tmst, hasTmst: hasTmst, freq: freq, dr: dr}, nil
+}
+
+// Forget 清除设备的 ping slot 占用，重新入网后不再受旧的占用约束
+func (s *ClassBScheduler) Forget(devEUI lorawan.EUI64) {
+	s.mu.Lock()
+	delete(s.reserved, devEUI)
+	s.mu.Unlock()
+}
+
+// Schedule 把下行发布给网关，在 slot 时刻发送
+func (s *ClassBScheduler) Schedule(ctx context.Context, gatewayID string, devAddr lorawan.DevAddr, phy lorawan.PHYPayload, slot classBSlot) {
+	p := s.p
+	start := time.Now()
+
+	phyBytes, _ := phy.MarshalBinary()
+	dataRate := p.getDRString(uint8(slot.dr))
+	codeRate := p.downlinkCodeRate(ctx, devAddr, nil)
+	if airtime, err := lorawan.TimeOnAir(dataRate, codeRate, len(phyBytes), false); err == nil {
+		p.dutyCycle.Record(gatewayID, airtime)
+	}
+
+	rfCh := p.getGatewayMeta(ctx, gatewayID).rfChain(slot.freq)
+	txpk := loraTXPacket(float64(slot.freq)/1000000.0, rfCh, dataRate, codeRate, phyBytes)
+	setClassBTiming(&txpk, slot.gps, slot.tmst, slot.hasTmst)
+
+	if err := s.publish(ctx, gatewayID, txpk); err != nil {
+		p.logDownlinkFrame(ctx, gatewayID, txpk, "publish failed: "+err.Error())
+		return
+	}
+	p.logDownlinkFrame(ctx, gatewayID, txpk, "scheduled: ping slot "+lorawan.GPSToTime(slot.gps).Format(time.RFC3339Nano))
+	observeDownlinkScheduled("classb", start)
+
+	logging.FrameCtx(ctx).Info().
+		Str("devAddr", devAddr.String()).
+		Str("gateway", gatewayID).
+		Float64("freq", txpk.Freq).
+		Str("dataRate", dataRate).
+		Time("pingSlot", lorawan.GPSToTime(slot.gps)).
+		Bool("hasTmst", slot.hasTmst).
+		Dur("in", time.Until(lorawan.GPSToTime(slot.gps))).
+		Msg("Class B 下行安排到 ping slot")
+}
+
+// Run 每个信标周期在信标时刻前 beaconLead 向所有 GPS 同步的网关发送信标，直到 ctx 取消
+func (s *ClassBScheduler) Run(ctx context.Context) {
+	log.Info().
+		Uint32("beaconFrequency", s.beaconFrequency()).
+		Int("beaconDR", s.p.config.CN470.MAC.BeaconDataRate).
+		Msg("Class B 信标调度启动")
+
+	var last time.Duration
+	for {
+		// 发送时刻（信标前 beaconLead）在现在之后的第一个信标
+		beacon := lorawan.BeaconStart(lorawan.TimeToGPS(time.Now())+beaconLead) + lorawan.BeaconPeriod
+		if beacon <= last {
+			beacon = last + lorawan.BeaconPeriod
+		}
+
+		timer := time.NewTimer(time.Until(lorawan.GPSToTime(beacon - beaconLead)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.sendBeacons(ctx, beacon)
+		last = beacon
+	}
+}
+
+// sendBeacons 向所有 GPS 同步且不在维护中的网关发送 beacon 时刻的信标
+func (s *ClassBScheduler) sendBeacons(ctx context.Context, beacon time.Duration) {
+	p := s.p
+	freq := s.beaconFrequency()
+	dataRate := p.getDRString(uint8(p.config.CN470.MAC.BeaconDataRate))
+
+	for _, gatewayID := range p.gpsTime.LockedGateways() {
+		if p.maintenance.active(gatewayID) {
+			continue
+		}
+		tmst, hasTmst := p.gpsTime.TmstAt(gatewayID, beacon)
+
+		meta := p.getGatewayMeta(ctx, gatewayID)
+		var lat, lng float64
+		if meta != nil && meta.Location != nil {
+			lat, lng = meta.Location.Latitude, meta.Location.Longitude
+		}
+		payload := lorawan.BeaconPayload(beacon, p.region.Name, lat, lng)
+
+		txpk := loraTXPacket(float64(freq)/1000000.0, meta.rfChain(freq), dataRate, defaultCodeRate, payload)
+		txpk.IPol = false
+		txpk.NCRC = true
+		txpk.Prea = beaconPreamble
+		setClassBTiming(&txpk, beacon, tmst, hasTmst)
+
+		if err := s.publish(ctx, gatewayID, txpk); err != nil {
+			continue
+		}
+		downlinksScheduled.WithLabelValues("beacon").Inc()
+
+		logging.Frame().Debug().
+			Str("gateway", gatewayID).
+			Time("beacon", lorawan.GPSToTime(beacon)).
+			Hex("payload", payload).
+			Msg("发送 Class B 信标")
+	}
+}
+
+// publish 把 txpk 发布到网关的下行主题
+func (s *ClassBScheduler) publish(ctx context.Context, gatewayID string, txpk models.TXPacket) error {
+	msg := models.GatewayTXMessage{
+		Version:   models.GatewayProtocolVersion,
+		GatewayID: gatewayID,
+		TXPK:      txpk,
+		TraceID:   logging.TraceID(ctx),
+	}
+
+	data, _ := json.Marshal(msg)
+	subject := fmt.Sprintf("gateway.%s.tx", gatewayID)
+	if err := s.p.nc.Publish(subject, data); err != nil {
+		logging.Ctx(ctx).Error().
+			Err(err).
+			Str("subject", subject).
+			Msg("发布下行消息失败")
+		return err
+	}
+	return nil
+}
+
+// setClassBTiming 有网关计数器参考时按 tmst 发送，否则按 GPS 时间（tmms）发送
+func setClassBTiming(txpk *models.TXPacket, gps time.Duration, tmst uint32, hasTmst bool) {
+	if hasTmst {
+		txpk.Tmst = &tmst
+		return
+	}
+	tmms := uint64(gps / time.Millisecond)
+	txpk.Tmms = &tmms
+}
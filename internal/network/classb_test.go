@@ -0,0 +1,212 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// classBTestConfig 启用 Class B，ping slot 周期 2^5 秒（1024 个时隙）
+func classBTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.CN470.MAC.SupportsClassB = true
+	cfg.CN470.MAC.PingSlotPeriodicity = 5
+	cfg.CN470.MAC.BeaconFrequency = 505300000
+	cfg.CN470.MAC.BeaconDataRate = 2
+	cfg.CN470.MAC.PingSlotDataRate = 2
+	return cfg
+}
+
+// checkPingSlot 检查 slot 落在设备在所在信标周期内的 ping slot 上
+func checkPingSlot(t *testing.T, slot time.Duration, devAddr lorawan.DevAddr, periodicity int) {
+	t.Helper()
+
+	beacon := lorawan.BeaconStart(slot)
+	offset, _ := lorawan.PingOffset(beacon, devAddr, periodicity)
+	period, _ := lorawan.PingPeriod(periodicity)
+	since := slot - beacon - lorawan.BeaconReserved
+	if since < 0 || since%lorawan.PingSlotLength != 0 {
+		t.Fatalf("slot %s is not on the ping slot grid", slot)
+	}
+	if n := int(since / lorawan.PingSlotLength); n < offset || (n-offset)%period != 0 {
+		t.Errorf("slot %d, want offset %d + n*%d", n, offset, period)
+	}
+}
+
+func TestClassBPingSlotParams(t *testing.T) {
+	tests := []struct {
+		name            string
+		pingSlotFreq    uint32
+		profile         *models.DeviceProfile
+		wantPeriodicity int
+		wantFreq        uint32
+		wantDR          int
+	}{
+		// 未配置 ping slot 频率时使用信标频率
+		{"defaults", 0, nil, 5, 505300000, 2},
+		{"configured frequency", 471900000, nil, 5, 471900000, 2},
+		{"profile periodicity", 0, &models.DeviceProfile{PingSlotPeriod: 7}, 7, 505300000, 2},
+		{"profile frequency and DR", 471900000, &models.DeviceProfile{PingSlotFreq: 506700000, PingSlotDR: 3}, 5, 506700000, 3},
+		// 配置文件只设置速率不生效
+		{"profile DR without frequency", 0, &models.DeviceProfile{PingSlotDR: 3}, 5, 505300000, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := classBTestConfig()
+			cfg.CN470.MAC.PingSlotFrequency = tt.pingSlotFreq
+			p, _, _ := newTestProcessor(t, cfg)
+
+			periodicity, freq, dr := p.classB.pingSlotParams(tt.profile)
+			if periodicity != tt.wantPeriodicity || freq != tt.wantFreq || dr != tt.wantDR {
+				t.Errorf("pingSlotParams() = %d, %d, %d, want %d, %d, %d", periodicity, freq, dr, tt.wantPeriodicity, tt.wantFreq, tt.wantDR)
+			}
+		})
+	}
+}
+
+func TestClassBSchedulerReserve(t *testing.T) {
+	p, _, _ := newTestProcessor(t, classBTestConfig())
+	otherDevEUI := lorawan.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x02}
+	otherDevAddr := lorawan.DevAddr{0x01, 0x02, 0x03, 0x04}
+
+	if _, err := p.classB.Reserve(testGatewayID, testDevEUI, testDevAddr, nil); err == nil {
+		t.Fatal("Reserve() without GPS time succeeded")
+	}
+
+	gps := 1451260818*time.Second + 500*time.Millisecond
+	p.gpsTime.UpdateFromRX(testGatewayID, uint64(gps/time.Millisecond), 100000000, time.Now())
+
+	// 同一设备的下行依次占用后续的 slot
+	var slots []time.Duration
+	for i := 0; i < 3; i++ {
+		slot, err := p.classB.Reserve(testGatewayID, testDevEUI, testDevAddr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPingSlot(t, slot.gps, testDevAddr, 5)
+		if slot.freq != 505300000 || slot.dr != 2 {
+			t.Errorf("slot freq, dr = %d, %d", slot.freq, slot.dr)
+		}
+		if wantTmst, _ := p.gpsTime.TmstAt(testGatewayID, slot.gps); !slot.hasTmst || slot.tmst != wantTmst {
+			t.Errorf("slot tmst = %d, %v, want %d", slot.tmst, slot.hasTmst, wantTmst)
+		}
+		if i > 0 && slot.gps <= slots[i-1] {
+			t.Errorf("slot %d at %s, not after %s", i, slot.gps, slots[i-1])
+		}
+		slots = append(slots, slot.gps)
+	}
+	if slots[0] < gps+classBMinLead {
+		t.Errorf("first slot %s earlier than %s", slots[0], gps+classBMinLead)
+	}
+
+	// 其他设备不受占用影响
+	other, err := p.classB.Reserve(testGatewayID, otherDevEUI, otherDevAddr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPingSlot(t, other.gps, otherDevAddr, 5)
+	if other.gps > slots[1] {
+		t.Errorf("other device slot %s delayed by reservations of %s", other.gps, testDevEUI)
+	}
+
+	// 重新入网后从最早的 slot 开始
+	p.classB.Forget(testDevEUI)
+	slot, err := p.classB.Reserve(testGatewayID, testDevEUI, testDevAddr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.gps > slots[0] {
+		t.Errorf("slot after Forget = %s, want %s", slot.gps, slots[0])
+	}
+
+	setMaintenance(p, testGatewayID, true)
+	if _, err := p.classB.Reserve(testGatewayID, testDevEUI, testDevAddr, nil); err != errGatewayMaintenance {
+		t.Errorf("Reserve() during maintenance error = %v, want %v", err, errGatewayMaintenance)
+	}
+}
+
+func TestClassBDownlinkScheduledInPingSlot(t *testing.T) {
+	p, store, srv := newTestProcessor(t, classBTestConfig())
+	ctx := context.Background()
+
+	profile := &models.DeviceProfile{Name: "class b", DeviceClass: models.DeviceClassB}
+	store.CreateDeviceProfile(ctx, profile)
+	device := createTestDevice(t, store, testDevEUI)
+	device.DeviceProfileID = profile.ID
+	store.UpdateDevice(ctx, device)
+	saveTestSession(t, store, testDevEUI, "")
+	cacheTestUplink(p, testDevEUI, testGatewayID)
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+	gps := 1451260818 * time.Second
+	p.gpsTime.UpdateFromRX(testGatewayID, uint64(gps/time.Millisecond), 100000000, time.Now())
+
+	data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}})
+	p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+
+	tx := nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("no downlink sent")
+	}
+	if tx.TXPK.Imme || tx.TXPK.Tmst == nil {
+		t.Fatalf("Class B downlink not timed: imme %v, tmst %v", tx.TXPK.Imme, tx.TXPK.Tmst)
+	}
+	if tx.TXPK.Freq != 505.3 || tx.TXPK.DatR != "SF10BW125" {
+		t.Errorf("txpk freq, datr = %v, %s, want 505.3, SF10BW125", tx.TXPK.Freq, tx.TXPK.DatR)
+	}
+	// 网关计数器换算回 GPS 时间
+	slot := gps + time.Duration(*tx.TXPK.Tmst-100000000)*time.Microsecond
+	checkPingSlot(t, slot, testDevAddr, 5)
+}
+
+func TestClassBSendBeacons(t *testing.T) {
+	p, _, srv := newTestProcessor(t, classBTestConfig())
+	txs := subscribeSync(t, srv, "gateway.*.tx")
+	beacon := 1451260928 * time.Second
+
+	// 只有 tmms 同步的网关发送信标，维护中的网关跳过
+	gps := beacon - 10*time.Second
+	p.gpsTime.UpdateFromRX(testGatewayID, uint64(gps/time.Millisecond), 100000000, time.Now())
+	p.gpsTime.UpdateFromRX("0807060504030201", uint64(gps/time.Millisecond), 100000000, time.Now())
+	p.gpsTime.UpdateFromStat("1111111111111111", "2026-01-01 00:00:00 GMT", time.Now())
+	setMaintenance(p, "0807060504030201", true)
+
+	p.classB.sendBeacons(context.Background(), beacon)
+
+	tx := nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("no beacon sent")
+	}
+	if tx.GatewayID != testGatewayID {
+		t.Errorf("beacon sent to %s, want %s", tx.GatewayID, testGatewayID)
+	}
+	if extra := nextTX(t, txs); extra != nil {
+		t.Errorf("beacon also sent to %s", extra.GatewayID)
+	}
+
+	txpk := tx.TXPK
+	if txpk.Freq != 505.3 || txpk.DatR != "SF10BW125" {
+		t.Errorf("beacon freq, datr = %v, %s", txpk.Freq, txpk.DatR)
+	}
+	if txpk.IPol || !txpk.NCRC || txpk.Prea != beaconPreamble {
+		t.Errorf("beacon ipol, ncrc, prea = %v, %v, %d", txpk.IPol, txpk.NCRC, txpk.Prea)
+	}
+	if txpk.Tmst == nil || *txpk.Tmst != 110000000 {
+		t.Errorf("beacon tmst = %v, want 110000000", txpk.Tmst)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(txpk.Data)
+	if want := lorawan.BeaconPayload(beacon, "CN470", 0, 0); !bytes.Equal(payload, want) {
+		t.Errorf("beacon payload = %x, want %x", payload, want)
+	}
+}
@@ -0,0 +1,125 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// 时钟告警原因
+const (
+	ClockAlertDrift = "drift" // 漂移超过阈值，时间戳变为不可靠
+	ClockAlertReset = "reset" // 检测到时间戳重置（网关重启或计数器回绕）
+)
+
+// ClockAlert 网关时钟变为不可靠或重置时产生的告警
+type ClockAlert struct {
+	GatewayID  string    `json:"gatewayId"`
+	Reason     string    `json:"reason"`
+	Drift      int64     `json:"drift"` // 测得的漂移（微秒）
+	ResetCount int       `json:"resetCount"`
+	DriftCount int       `json:"driftCount"`
+	Time       time.Time `json:"time"`
+}
+
+func newClockAlert(reason, gatewayID string, drift int64, info *GatewayTimestampInfo) *ClockAlert {
+	return &ClockAlert{
+		GatewayID:  gatewayID,
+		Reason:     reason,
+		Drift:      drift,
+		ResetCount: info.ResetCount,
+		DriftCount: info.DriftCount,
+		Time:       time.Now(),
+	}
+}
+
+// GatewayClockStats 单个网关的时钟统计
+type GatewayClockStats struct {
+	GatewayID  string `json:"gatewayId"`
+	Drift      int64  `json:"drift"`
+	ResetCount int    `json:"resetCount"`
+	DriftCount int    `json:"driftCount"`
+	Reliable   bool   `json:"reliable"`
+}
+
+// Stats 返回所有网关的漂移/重置计数快照
+func (t *TimestampTracker) Stats() []GatewayClockStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats := make([]GatewayClockStats, 0, len(t.gatewayTimestamps))
+	for gwID, info := range t.gatewayTimestamps {
+		stats = append(stats, GatewayClockStats{
+			GatewayID:  gwID,
+			Drift:      info.TimestampDrift,
+			ResetCount: info.ResetCount,
+			DriftCount: info.DriftCount,
+			Reliable:   info.IsReliable,
+		})
+	}
+	return stats
+}
+
+// publishClockAlert 发布 gateway.<id>.clock 事件并写入事件日志
+func (p *Processor) publishClockAlert(alert ClockAlert) {
+	subject := fmt.Sprintf("gateway.%s.clock", alert.GatewayID)
+	data, _ := json.Marshal(alert)
+	if err := p.nc.Publish(subject, data); err != nil {
+		log.Error().Err(err).Str("subject", subject).Msg("发布网关时钟告警失败")
+	}
+
+	event := &models.EventLog{
+		Type:        models.EventTypeGatewayClock,
+		Level:       models.EventLevelWarning,
+		Code:        "GATEWAY_CLOCK_" + strings.ToUpper(alert.Reason),
+		Description: fmt.Sprintf("Gateway %s clock %s, drift %dus", alert.GatewayID, alert.Reason, alert.Drift),
+		Details: models.Variables{
+			"reason":     alert.Reason,
+			"drift":      alert.Drift,
+			"resetCount": alert.ResetCount,
+			"driftCount": alert.DriftCount,
+		},
+	}
+	if id, err := lorawan.ParseGatewayID(alert.GatewayID); err == nil {
+		gwID := models.EUI64(id)
+		event.GatewayID = &gwID
+	}
+
+	// 回调发生在上行处理路径上，事件日志异步写入
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.store.CreateEventLog(ctx, event); err != nil {
+			log.Error().Err(err).Str("gateway", alert.GatewayID).Msg("记录网关时钟告警失败")
+		}
+	}()
+}
+
+// publishClockStats 定期发布各网关的漂移/重置计数（ns.metrics.gateway_clock）
+func (p *Processor) publishClockStats(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := p.timestampTracker.Stats()
+			if len(stats) == 0 {
+				continue
+			}
+			data, _ := json.Marshal(stats)
+			if err := p.nc.Publish("ns.metrics.gateway_clock", data); err != nil {
+				log.Error().Err(err).Msg("发布网关时钟统计失败")
+			}
+		}
+	}
+}
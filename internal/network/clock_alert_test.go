@@ -0,0 +1,81 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+)
+
+func TestClockDriftAlert(t *testing.T) {
+	const lastTmst = 1000000000
+
+	tests := []struct {
+		name     string
+		alerts   bool
+		reliable bool
+		elapsed  int64 // 两次上行之间网关计数器的增量（微秒），系统时间相隔 2s
+		reason   string
+	}{
+		{"within threshold", true, true, 2050000, ""},
+		{"drift over threshold", true, true, 2300000, ClockAlertDrift},
+		{"negative drift", true, true, 1700000, ClockAlertDrift},
+		// 已经不可靠时不重复告警
+		{"already unreliable", true, false, 2300000, ""},
+		{"reset", true, true, -20000000, ClockAlertReset},
+		{"alerts disabled", false, true, 2300000, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.ClockAlerts = tt.alerts
+			cfg.Network.ClockDriftThreshold = 100 * time.Millisecond
+			p, store, srv := newTestProcessor(t, cfg)
+			sub := subscribeSync(t, srv, "gateway.*.clock")
+
+			p.timestampTracker.gatewayTimestamps[testGatewayID] = &GatewayTimestampInfo{
+				LastUplink:     lastTmst,
+				LastUplinkTime: time.Now().Add(-2 * time.Second),
+				IsReliable:     tt.reliable,
+				WarmupCount:    3,
+			}
+			p.timestampTracker.UpdateAndCheck(testGatewayID, uint64(lastTmst+tt.elapsed), false)
+
+			msg, err := sub.NextMsg(200 * time.Millisecond)
+			if tt.reason == "" {
+				if err == nil {
+					t.Errorf("unexpected clock alert %s", msg.Data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("no clock alert published")
+			}
+			if msg.Subject != "gateway."+testGatewayID+".clock" {
+				t.Errorf("subject = %s", msg.Subject)
+			}
+			var alert ClockAlert
+			json.Unmarshal(msg.Data, &alert)
+			if alert.GatewayID != testGatewayID || alert.Reason != tt.reason {
+				t.Errorf("alert = %+v, want reason %s", alert, tt.reason)
+			}
+
+			// 事件日志异步写入
+			eventType := models.EventTypeGatewayClock
+			var events []*models.EventLog
+			for i := 0; i < 50 && len(events) == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+				events, _, _ = store.ListEventLogs(context.Background(), storage.EventLogFilters{Type: &eventType}, 10, 0)
+			}
+			if len(events) != 1 || events[0].Code != "GATEWAY_CLOCK_"+strings.ToUpper(tt.reason) {
+				t.Errorf("events = %+v, want one %s clock event", events, tt.reason)
+			}
+		})
+	}
+}
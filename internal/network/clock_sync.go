@@ -0,0 +1,72 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// serverGPSTime 返回上行接收时刻的网络 GPS 时间：优先使用网关上报的 GPS 时间，否则使用本机时钟
+func (p *Processor) serverGPSTime(gatewayID string, receivedAt time.Time) time.Duration {
+	if gps, ok := p.gpsTime.GPSTime(gatewayID, receivedAt); ok {
+		return gps
+	}
+	return lorawan.TimeToGPS(receivedAt)
+}
+
+// handleClockSyncUplink 处理应用层时钟同步端口（202）的上行，
+// 应答经 ns.device.<devEUI>.tx 进入下行流程
+func (p *Processor) handleClockSyncUplink(session *models.DeviceSession, gatewayID string, data []byte, receivedAt time.Time) {
+	devEUI := lorawan.EUI64(session.DevEUI)
+
+	reqs, err := lorawan.ParseClockSyncRequests(data)
+	if err != nil {
+		log.Warn().Err(err).Str("devEUI", devEUI.String()).Msg("解析时钟同步请求失败")
+	}
+
+	var answer []byte
+	for _, req := range reqs {
+		switch req.CID {
+		case lorawan.ClockSyncPackageVersion:
+			answer = append(answer, lorawan.ClockSyncPackageVersionAns()...)
+		case lorawan.ClockSyncAppTime:
+			correction := lorawan.AppTimeCorrection(req.AppTime.DeviceTime, p.serverGPSTime(gatewayID, receivedAt))
+
+			logging.Frame().Info().
+				Str("devEUI", devEUI.String()).
+				Uint32("deviceTime", req.AppTime.DeviceTime).
+				Int32("correction", correction).
+				Bool("ansRequired", req.AppTime.AnsRequired).
+				Msg("收到 AppTimeReq")
+
+			// 时钟已同步且设备不要求应答时不发送
+			if correction == 0 && !req.AppTime.AnsRequired {
+				continue
+			}
+			ans, _ := lorawan.AppTimeAns{TimeCorrection: correction, TokenAns: req.AppTime.TokenReq}.MarshalBinary()
+			answer = append(answer, ans...)
+		}
+	}
+
+	if len(answer) == 0 {
+		return
+	}
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"devEUI":    hex.EncodeToString(devEUI[:]),
+		"fPort":     lorawan.ClockSyncFPort,
+		"data":      answer,
+		"confirmed": false,
+	})
+	subject := fmt.Sprintf("ns.device.%s.tx", hex.EncodeToString(devEUI[:]))
+	if err := p.nc.Publish(subject, msg); err != nil {
+		log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("发送时钟同步应答失败")
+	}
+}
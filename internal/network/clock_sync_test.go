@@ -0,0 +1,80 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestHandleClockSyncUplink(t *testing.T) {
+	receivedAt := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gps := lorawan.TimeToGPS(receivedAt) + 3*time.Second // 网关 GPS 时间与本机时钟不同
+
+	tests := []struct {
+		name      string
+		gatewayID string // 空表示网关没有 GPS 时间
+		data      []byte
+		want      []byte // nil 表示不应答
+	}{
+		{
+			"correction from gateway GPS time", testGatewayID,
+			[]byte{0x01, 0x15, 0x7b, 0x80, 0x56, 0x02}, // 比网关 GPS 时间慢 128 秒
+			[]byte{0x01, 0x80, 0x00, 0x00, 0x00, 0x02},
+		},
+		{
+			"correction from local clock", "",
+			[]byte{0x01, 0x15, 0x7b, 0x80, 0x56, 0x02},
+			[]byte{0x01, 0x7d, 0x00, 0x00, 0x00, 0x02},
+		},
+		{"in sync without answer required", testGatewayID, []byte{0x01, 0x95, 0x7b, 0x80, 0x56, 0x04}, nil},
+		{
+			"in sync with answer required", testGatewayID,
+			[]byte{0x01, 0x95, 0x7b, 0x80, 0x56, 0x14},
+			[]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x04},
+		},
+		{"package version", testGatewayID, []byte{0x00}, []byte{0x00, 0x01, 0x01}},
+		{"invalid command", testGatewayID, []byte{0x7f}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, srv := newTestProcessor(t, nil)
+			if tt.gatewayID != "" {
+				p.gpsTime.UpdateFromRX(tt.gatewayID, uint64(gps/time.Millisecond), 100000000, receivedAt)
+			}
+			sub := subscribeSync(t, srv, "ns.device.*.tx")
+
+			session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+			p.handleClockSyncUplink(session, testGatewayID, tt.data, receivedAt)
+
+			msg, err := sub.NextMsg(200 * time.Millisecond)
+			if (err == nil) != (tt.want != nil) {
+				t.Fatalf("answered = %v, want %v", err == nil, tt.want != nil)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			if want := "ns.device." + hex.EncodeToString(testDevEUI[:]) + ".tx"; msg.Subject != want {
+				t.Errorf("subject = %q, want %q", msg.Subject, want)
+			}
+			var req struct {
+				FPort     uint8  `json:"fPort"`
+				Data      []byte `json:"data"`
+				Confirmed bool   `json:"confirmed"`
+			}
+			json.Unmarshal(msg.Data, &req)
+			if req.FPort != lorawan.ClockSyncFPort || req.Confirmed {
+				t.Errorf("fPort = %d, confirmed = %v", req.FPort, req.Confirmed)
+			}
+			if !bytes.Equal(req.Data, tt.want) {
+				t.Errorf("answer = %x, want %x", req.Data, tt.want)
+			}
+		})
+	}
+}
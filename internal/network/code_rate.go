@@ -0,0 +1,29 @@
+package network
+
+import (
+	"context"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// defaultCodeRate 未配置且上行没有编码率时使用的下行编码率
+const defaultCodeRate = "4/5"
+
+// downlinkCodeRate 返回下行 txpk 的编码率：设备配置文件优先于全局配置，
+// 都未配置时沿用上行编码率
+func (p *Processor) downlinkCodeRate(ctx context.Context, devAddr lorawan.DevAddr, rxInfo map[string]interface{}) string {
+	if sessions, err := p.store.GetDeviceSessionByDevAddr(ctx, devAddr); err == nil && len(sessions) == 1 {
+		if profile := p.deviceProfile(ctx, lorawan.EUI64(sessions[0].DevEUI)); profile != nil && profile.DownlinkCodeRate != "" {
+			return profile.DownlinkCodeRate
+		}
+	}
+
+	if p.config.Network.DownlinkCodeRate != "" {
+		return p.config.Network.DownlinkCodeRate
+	}
+
+	if codr, ok := rxInfo["codr"].(string); ok && codr != "" {
+		return codr
+	}
+	return defaultCodeRate
+}
@@ -0,0 +1,62 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestDownlinkCodeRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		uplinkCodr string // 空表示上行 rxInfo 没有 codr
+		configured string
+		profile    string
+		want       string
+	}{
+		{"uplink coding rate", "4/7", "", "", "4/7"},
+		{"default", "", "", "", "4/5"},
+		// 与上行无关
+		{"configured", "4/5", "4/6", "", "4/6"},
+		{"profile overrides config", "4/5", "4/6", "4/8", "4/8"},
+		{"profile without coding rate", "4/5", "4/6", "", "4/6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.DownlinkCodeRate = tt.configured
+			p, store, srv := newTestProcessor(t, cfg)
+			ctx := context.Background()
+			device := createTestDevice(t, store, testDevEUI)
+			profile := &models.DeviceProfile{Name: "codr", DownlinkCodeRate: tt.profile}
+			if err := store.CreateDeviceProfile(ctx, profile); err != nil {
+				t.Fatal(err)
+			}
+			device.DeviceProfileID = profile.ID
+			if err := store.UpdateDevice(ctx, device); err != nil {
+				t.Fatal(err)
+			}
+			session := saveTestSession(t, store, testDevEUI, "")
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			rxInfo := testRxInfo()
+			delete(rxInfo, "codr")
+			if tt.uplinkCodr != "" {
+				rxInfo["codr"] = tt.uplinkCodr
+			}
+			p.handleDownlink(session, testGatewayID, rxInfo, []lorawan.MACCommand{{CID: lorawan.DevStatusReq}}, false)
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("downlink not sent")
+			}
+			if tx.TXPK.CodR != tt.want {
+				t.Errorf("txpk codr = %q, want %q", tx.TXPK.CodR, tt.want)
+			}
+		})
+	}
+}
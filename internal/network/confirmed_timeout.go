@@ -0,0 +1,69 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// confirmedTimeout 返回设备确认下行的 ACK 超时：应用配置优先，否则使用全局配置
+func (p *Processor) confirmedTimeout(ctx context.Context, devEUI lorawan.EUI64) time.Duration {
+	timeout := p.config.Network.ConfirmedDownlinkTimeout
+
+	device, err := p.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		return timeout
+	}
+	app, err := p.store.GetApplication(ctx, device.ApplicationID)
+	if err != nil {
+		return timeout
+	}
+	if app.ConfirmedTimeout > 0 {
+		return time.Duration(app.ConfirmedTimeout) * time.Second
+	}
+	return timeout
+}
+
+// watchConfirmedDownlink 等待确认下行的设备 ACK，超时仍未确认则标记失败。
+// 超时从首次发送开始计算，重传同一 FCnt 的帧不会重新计时。
+func (p *Processor) watchConfirmedDownlink(devEUI lorawan.EUI64, sent *models.DeviceLastDownlink) {
+	timeout := p.confirmedTimeout(context.Background(), devEUI)
+	if timeout <= 0 {
+		return
+	}
+
+	time.Sleep(timeout - time.Since(sent.Time))
+
+	ctx := context.Background()
+	device, err := p.store.GetDevice(ctx, devEUI)
+	if err != nil {
+		log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("检查确认下行超时失败")
+		return
+	}
+
+	// 已被确认、已标记失败或已被更新的下行取代
+	last := device.LastDownlink
+	if last == nil || !last.Confirmed || last.FCnt != sent.FCnt || last.Acked || last.Failed {
+		return
+	}
+
+	now := time.Now()
+	last.Failed = true
+	last.FailedAt = &now
+
+	if err := p.store.UpdateDeviceLastDownlink(ctx, devEUI, last); err != nil {
+		log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("更新确认下行超时状态失败")
+	}
+
+	p.publishDownlinkEvent(models.EventTypeDownlinkFailed, devEUI, last, "ack timeout")
+
+	log.Warn().
+		Str("devEUI", devEUI.String()).
+		Uint32("fCnt", last.FCnt).
+		Dur("timeout", timeout).
+		Msg("确认下行超时未收到 ACK")
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestConfirmedTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		appTimeout int // 0 表示应用未配置；-1 表示设备没有应用
+		want       time.Duration
+	}{
+		{"no application", -1, 30 * time.Second},
+		{"application unset", 0, 30 * time.Second},
+		{"application override", 5, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.ConfirmedDownlinkTimeout = 30 * time.Second
+			p, store, _ := newTestProcessor(t, cfg)
+
+			device := &models.Device{DevEUI: models.EUI64(testDevEUI), Name: "test"}
+			if tt.appTimeout >= 0 {
+				app := &models.Application{Name: "test", ConfirmedTimeout: tt.appTimeout}
+				if err := store.CreateApplication(context.Background(), app); err != nil {
+					t.Fatal(err)
+				}
+				device.ApplicationID = app.ID
+			}
+			if err := store.CreateDevice(context.Background(), device); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := p.confirmedTimeout(context.Background(), testDevEUI); got != tt.want {
+				t.Errorf("confirmedTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmedDownlinkTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		confirmed  bool
+		update     func(last *models.DeviceLastDownlink) // 超时前设备状态的变化
+		wantFailed bool
+	}{
+		{"unacked", 50 * time.Millisecond, true, nil, true},
+		{"acked before timeout", 50 * time.Millisecond, true, func(last *models.DeviceLastDownlink) { last.Acked = true }, false},
+		{"superseded", 50 * time.Millisecond, true, func(last *models.DeviceLastDownlink) { last.FCnt++ }, false},
+		{"unconfirmed", 50 * time.Millisecond, false, nil, false},
+		{"timeout disabled", 0, true, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.ConfirmedDownlinkTimeout = tt.timeout
+			p, store, srv := newTestProcessor(t, cfg)
+			createTestDevice(t, store, testDevEUI)
+			events := subscribeSync(t, srv, "downlink.*.downlink_failed")
+
+			session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+			p.recordLastDownlink(session, testGatewayID, nil, 7, tt.confirmed, "frame-1")
+
+			if tt.update != nil {
+				device, _ := store.GetDevice(context.Background(), testDevEUI)
+				tt.update(device.LastDownlink)
+				store.UpdateDeviceLastDownlink(context.Background(), testDevEUI, device.LastDownlink)
+			}
+
+			msg, err := events.NextMsg(300 * time.Millisecond)
+			if (err == nil) != tt.wantFailed {
+				t.Fatalf("failed event published = %v, want %v", err == nil, tt.wantFailed)
+			}
+
+			device, _ := store.GetDevice(context.Background(), testDevEUI)
+			last := device.LastDownlink
+			if last.Failed != tt.wantFailed || (last.FailedAt != nil) != tt.wantFailed {
+				t.Errorf("LastDownlink = %+v, want failed %v", last, tt.wantFailed)
+			}
+			if !tt.wantFailed {
+				return
+			}
+
+			var event models.DownlinkEvent
+			json.Unmarshal(msg.Data, &event)
+			if event.FCnt != 7 || event.ID != "frame-1" {
+				t.Errorf("event = %+v", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"math/rand"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// maxDevAddrAttempts 随机避开其他租户区间、避开已使用地址的最大尝试次数
+const maxDevAddrAttempts = 32
+
+// loadNetID 解析配置的 NetID（未配置时为 000000），JOIN ACCEPT 和 DevAddr 分配都使用它
+func (p *Processor) loadNetID() error {
+	s := p.config.Network.NetID
+	if s == "" {
+		s = config.DefaultNetID
+	}
+	netID, err := lorawan.ParseNetID(s)
+	if err != nil {
+		return err
+	}
+	p.netID = netID
+
+	prefix, mask := netID.DevAddrPrefix()
+	log.Info().
+		Str("netID", netID.String()).
+		Int("type", netID.Type()).
+		Str("devAddrPrefix", fmt.Sprintf("%08x/%d", prefix, bits.OnesCount32(mask))).
+		Msg("NetID 已加载，DevAddr 在其前缀内分配")
+	return nil
+}
+
+type devAddrBounds struct {
+	start, end uint32
+}
+
+func (b devAddrBounds) contains(addr uint32) bool {
+	return addr >= b.start && addr <= b.end
+}
+
+// devAddrRange 返回租户配置的 DevAddr 区间，区间已在加载配置时校验
+func (p *Processor) devAddrRange(tenantID uuid.UUID) (devAddrBounds, bool) {
+	for _, r := range p.config.Network.DevAddrRanges {
+		if id, err := uuid.Parse(r.TenantID); err != nil || id != tenantID {
+			continue
+		}
+		start, end, err := r.Bounds()
+		if err != nil {
+			return devAddrBounds{}, false
+		}
+		return devAddrBounds{start: start, end: end}, true
+	}
+	return devAddrBounds{}, false
+}
+
+// inAnyDevAddrRange 地址是否落在任一租户的区间内
+func (p *Processor) inAnyDevAddrRange(addr uint32) bool {
+	for _, r := range p.config.Network.DevAddrRanges {
+		start, end, err := r.Bounds()
+		if err == nil && (devAddrBounds{start: start, end: end}).contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// devAddrAllowed 地址是否可以分配给该租户的设备：在租户区间内，租户未配置区间时
+// 在 NetID 的地址前缀内且不在其他租户的区间内
+func (p *Processor) devAddrAllowed(tenantID uuid.UUID, addr lorawan.DevAddr) bool {
+	n := binary.BigEndian.Uint32(addr[:])
+	if bounds, ok := p.devAddrRange(tenantID); ok {
+		return bounds.contains(n)
+	}
+	prefix, mask := p.netID.DevAddrPrefix()
+	return n&mask == prefix && !p.inAnyDevAddrRange(n)
+}
+
+// randomDevAddr 在租户区间内随机取一个地址；租户未配置区间时在 NetID 的地址前缀内取，
+// 并避开其他租户的区间
+func (p *Processor) randomDevAddr(tenantID uuid.UUID) uint32 {
+	if bounds, ok := p.devAddrRange(tenantID); ok {
+		return bounds.start + uint32(rand.Int63n(int64(bounds.end-bounds.start)+1))
+	}
+
+	prefix, mask := p.netID.DevAddrPrefix()
+	n := prefix | rand.Uint32()&^mask
+	for i := 0; i < maxDevAddrAttempts && p.inAnyDevAddrRange(n); i++ {
+		n = prefix | rand.Uint32()&^mask
+	}
+	return n
+}
+
+// generateDevAddr 为设备随机分配一个没有被其他设备会话使用的 DevAddr。
+// 多次尝试都冲突（地址空间接近用尽）时返回最后一个候选，由 DevAddr 相同的会话按 MIC 区分
+func (p *Processor) generateDevAddr(ctx context.Context, device *models.Device) lorawan.DevAddr {
+	var addr lorawan.DevAddr
+	for i := 0; i < maxDevAddrAttempts; i++ {
+		binary.BigEndian.PutUint32(addr[:], p.randomDevAddr(device.TenantID))
+		if !p.devAddrInUse(ctx, addr, device.DevEUI) {
+			return addr
+		}
+	}
+
+	log.Warn().
+		Str("devEUI", device.DevEUI.String()).
+		Str("devAddr", addr.String()).
+		Int("attempts", maxDevAddrAttempts).
+		Msg("DevAddr 多次冲突，分配的地址与其他设备重复")
+	return addr
+}
+
+// devAddrInUse 地址是否已被其他设备的会话使用，查询失败时视为未使用
+func (p *Processor) devAddrInUse(ctx context.Context, addr lorawan.DevAddr, devEUI models.EUI64) bool {
+	sessions, err := p.store.GetDeviceSessionByDevAddr(ctx, addr)
+	if err != nil {
+		return false
+	}
+	for _, session := range sessions {
+		if session.DevEUI != devEUI {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestAllocateDevAddrOnRejoin(t *testing.T) {
+	tenantID := uuid.New()
+	previous := models.DevAddr{0x01, 0x02, 0x03, 0x04} // NetID 000000 的地址前缀内
+
+	tests := []struct {
+		name     string
+		reuse    bool
+		previous *models.DevAddr
+		ranges   []config.DevAddrRange
+		wantSame bool
+	}{
+		{"reuse enabled", true, &previous, nil, true},
+		{"reuse disabled", false, &previous, nil, false},
+		{"never joined", true, nil, nil, false},
+		{"previous address outside tenant range", true, &previous, []config.DevAddrRange{
+			{TenantID: tenantID.String(), Start: "01000000", End: "010000ff"},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.ReuseDevAddrOnRejoin = tt.reuse
+			cfg.Network.DevAddrRanges = tt.ranges
+			p, _, _ := newTestProcessor(t, cfg)
+			if err := p.loadNetID(); err != nil {
+				t.Fatal(err)
+			}
+
+			device := &models.Device{DevEUI: models.EUI64(testDevEUI), DevAddr: tt.previous}
+			device.TenantID = tenantID
+			addr := p.allocateDevAddr(context.Background(), device)
+
+			if same := tt.previous != nil && addr == lorawan.DevAddr(*tt.previous); same != tt.wantSame {
+				t.Errorf("allocated %s, previous %v, want reused = %v", addr, tt.previous, tt.wantSame)
+			}
+			if !p.devAddrAllowed(tenantID, addr) {
+				t.Errorf("allocated %s is not allowed for the tenant", addr)
+			}
+		})
+	}
+}
+
+func TestGenerateDevAddrAvoidsAddressesInUse(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Network.DevAddrRanges = []config.DevAddrRange{{TenantID: uuid.Nil.String(), Start: "01000000", End: "01000001"}}
+	p, store, _ := newTestProcessor(t, cfg)
+	if err := p.loadNetID(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 区间内只剩 01000001 未被其他设备使用
+	store.SaveDeviceSession(context.Background(), &models.DeviceSession{
+		DevEUI:  models.EUI64{0xff},
+		DevAddr: models.DevAddr{0x01, 0x00, 0x00, 0x00},
+	})
+
+	addr := p.generateDevAddr(context.Background(), &models.Device{DevEUI: models.EUI64(testDevEUI)})
+	if got := binary.BigEndian.Uint32(addr[:]); got != 0x01000001 {
+		t.Errorf("allocated %08x, want 01000001", got)
+	}
+}
+
+func TestGenerateDevAddrInTenantRange(t *testing.T) {
+	tenantA, tenantB := uuid.New(), uuid.New()
+	ranges := []config.DevAddrRange{
+		{TenantID: tenantA.String(), Start: "01000000", End: "010000ff"},
+		{TenantID: tenantB.String(), Start: "01000100", End: "01ffffff"},
+	}
+
+	tests := []struct {
+		name     string
+		tenantID uuid.UUID
+		inRange  func(addr uint32) bool
+	}{
+		{"tenant A", tenantA, func(addr uint32) bool { return addr >= 0x01000000 && addr <= 0x010000ff }},
+		{"tenant B", tenantB, func(addr uint32) bool { return addr >= 0x01000100 && addr <= 0x01ffffff }},
+		// 未配置区间的租户在 NetID 前缀内分配，避开 A、B 的区间
+		{"tenant without range", uuid.New(), func(addr uint32) bool { return addr <= 0x00ffffff }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.DevAddrRanges = ranges
+			p, _, _ := newTestProcessor(t, cfg)
+			if err := p.loadNetID(); err != nil {
+				t.Fatal(err)
+			}
+
+			device := &models.Device{DevEUI: models.EUI64(testDevEUI)}
+			device.TenantID = tt.tenantID
+			for i := 0; i < 100; i++ {
+				addr := p.generateDevAddr(context.Background(), device)
+				if n := binary.BigEndian.Uint32(addr[:]); !tt.inRange(n) {
+					t.Fatalf("allocated %08x outside the tenant's range", n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// devNonceKey DevNonce 在重放过滤器中的键：JoinEUI | DevEUI | DevNonce
+func devNonceKey(joinEUI, devEUI lorawan.EUI64, devNonce uint16) []byte {
+	key := make([]byte, 0, 19)
+	key = append(key, 'n')
+	key = append(key, joinEUI[:]...)
+	key = append(key, devEUI[:]...)
+	return append(key, byte(devNonce), byte(devNonce>>8))
+}
+
+// checkDevNonce 校验 JOIN 的 DevNonce。1.0.x 设备的 DevNonce 不能重复使用；
+// 1.1 设备的 DevNonce 是计数器，必须大于上一次入网使用的值。
+// 只检查不记录，JOIN 确定被接受时再由 recordDevNonce 记录。
+// 返回拒绝原因，为空表示通过；存储出错时返回 error，JOIN 不再继续
+func (p *Processor) checkDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16, lorawan11 bool) (string, error) {
+	if lorawan11 {
+		last, err := p.store.LastDevNonce(ctx, joinEUI, devEUI)
+		if err == nil && devNonce <= last {
+			return fmt.Sprintf("DevNonce %d is not greater than the last used DevNonce %d", devNonce, last), nil
+		}
+		if err != nil && err != storage.ErrNotFound {
+			return "", err
+		}
+		return "", nil
+	}
+
+	seen, err := p.replayFilter.Seen(devNonceKey(joinEUI, devEUI, devNonce), func() (bool, error) {
+		return p.store.DevNonceUsed(ctx, joinEUI, devEUI, devNonce)
+	})
+	if err != nil {
+		return "", err
+	}
+	if seen {
+		return fmt.Sprintf("DevNonce %d has already been used", devNonce), nil
+	}
+	return "", nil
+}
+
+// recordDevNonce 记录被接受的 JOIN 的 DevNonce，失败的 JOIN 不占用 DevNonce。
+// 并发的相同 JOIN（如多实例各收到一份）由唯一约束兜底：只有一个能记录成功，
+// 另一个返回拒绝原因
+func (p *Processor) recordDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (string, error) {
+	recorded, err := p.store.RecordDevNonce(ctx, joinEUI, devEUI, devNonce)
+	if err != nil {
+		return "", err
+	}
+	p.replayFilter.Add(devNonceKey(joinEUI, devEUI, devNonce))
+	if !recorded {
+		return fmt.Sprintf("DevNonce %d has already been used", devNonce), nil
+	}
+	return "", nil
+}
+
+// rejectDevNonceReplay 记录因 DevNonce 重放被拒绝的 JOIN：可能是截获的 JOIN 被重放，
+// 也可能是设备错误地重复使用 DevNonce
+func (p *Processor) rejectDevNonceReplay(ctx context.Context, device *models.Device, joinEUI lorawan.EUI64, devNonce uint16, reason, gatewayID string) {
+	logging.Ctx(ctx).Warn().
+		Str("devEUI", device.DevEUI.String()).
+		Str("joinEUI", joinEUI.String()).
+		Uint16("devNonce", devNonce).
+		Str("gateway", gatewayID).
+		Str("reason", reason).
+		Msg("安全告警：DevNonce 重放，拒绝 JOIN REQUEST")
+
+	p.recordDeviceError(ctx, lorawan.EUI64(device.DevEUI), models.DeviceErrorDevNonceReplay, reason, nil, gatewayID)
+
+	event := &models.EventLog{
+		ApplicationID: &device.ApplicationID,
+		DevEUI:        &device.DevEUI,
+		Type:          models.EventTypeJoin,
+		Level:         models.EventLevelWarning,
+		Code:          "JOIN_REJECTED_DEVNONCE_REPLAY",
+		Description:   "Join request rejected: " + reason,
+		Details: models.Variables{
+			"joinEUI":   joinEUI.String(),
+			"devNonce":  devNonce,
+			"gatewayId": gatewayID,
+		},
+	}
+	if err := p.store.CreateEventLog(ctx, event); err != nil {
+		log.Error().Err(err).Str("devEUI", device.DevEUI.String()).Msg("记录 JOIN 拒绝事件失败")
+	}
+}
+
+// loadReplayFilter 用存储中已记录的 DevNonce 预热重放过滤器，完成前的检查都回退到存储
+func (p *Processor) loadReplayFilter(ctx context.Context) {
+	start := time.Now()
+	count := 0
+	err := p.store.ForEachDevNonce(ctx, func(joinEUI, devEUI lorawan.EUI64, devNonce uint16) {
+		p.replayFilter.Add(devNonceKey(joinEUI, devEUI, devNonce))
+		count++
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("预热重放过滤器失败，DevNonce 检查继续查询数据库")
+		return
+	}
+
+	p.replayFilter.markLoaded()
+	log.Info().
+		Int("devNonces", count).
+		Dur("took", time.Since(start)).
+		Msg("重放过滤器预热完成")
+}
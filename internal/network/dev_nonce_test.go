@@ -0,0 +1,204 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// failingJoinNonceStore 分配 JoinNonce 时出错，让 JOIN 在通过 DevNonce 检查后失败
+type failingJoinNonceStore struct {
+	storage.Store
+}
+
+func (s *failingJoinNonceStore) NextJoinNonce(ctx context.Context, devEUI lorawan.EUI64) (uint32, error) {
+	return 0, errors.New("join nonce unavailable")
+}
+
+// setupDevNonceDevice 创建 OTAA 设备，lorawan11 时使用 MAC 1.1 配置文件并以 testKey 作为 NwkKey
+func setupDevNonceDevice(t *testing.T, store *storagetest.MemoryStore, lorawan11 bool) {
+	t.Helper()
+
+	ctx := context.Background()
+	device := createTestOTAADevice(t, store)
+	if !lorawan11 {
+		return
+	}
+	profile := &models.DeviceProfile{Name: "1.1", MACVersion: "1.1.0"}
+	if err := store.CreateDeviceProfile(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	device.DeviceProfileID = profile.ID
+	if err := store.UpdateDevice(ctx, device); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDeviceKeys(ctx, &models.DeviceKeys{DevEUI: models.EUI64(testDevEUI), AppKey: testKey, NwkKey: testKey}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckDevNonce(t *testing.T) {
+	tests := []struct {
+		name         string
+		lorawan11    bool
+		replayFilter bool
+		used         []uint16
+		devNonce     uint16
+		wantReject   bool
+	}{
+		{"1.0 first join", false, false, nil, 5, false},
+		{"1.0 new nonce", false, false, []uint16{5, 9}, 7, false},
+		{"1.0 reused", false, false, []uint16{5, 9}, 5, true},
+		{"1.0 reused with replay filter", false, true, []uint16{5, 9}, 9, true},
+		{"1.0 new nonce with replay filter", false, true, []uint16{5, 9}, 7, false},
+		// 1.1 的 DevNonce 是计数器，没用过但更小的同样拒绝
+		{"1.1 first join", true, false, nil, 0, false},
+		{"1.1 greater", true, false, []uint16{5, 9}, 10, false},
+		{"1.1 last used", true, false, []uint16{5, 9}, 9, true},
+		{"1.1 smaller unused", true, false, []uint16{5, 9}, 7, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.ReplayFilter.Enabled = tt.replayFilter
+			p, store, _ := newTestProcessor(t, cfg)
+			ctx := context.Background()
+			var joinEUI lorawan.EUI64
+			for _, n := range tt.used {
+				store.RecordDevNonce(ctx, joinEUI, testDevEUI, n)
+			}
+			p.loadReplayFilter(ctx)
+
+			reason, err := p.checkDevNonce(ctx, joinEUI, testDevEUI, tt.devNonce, tt.lorawan11)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (reason != "") != tt.wantReject {
+				t.Errorf("checkDevNonce(%d) = %q, want rejected %v", tt.devNonce, reason, tt.wantReject)
+			}
+			// 检查本身不记录 DevNonce
+			if used, _ := store.DevNonceUsed(ctx, joinEUI, testDevEUI, tt.devNonce); used != containsDevNonce(tt.used, tt.devNonce) {
+				t.Errorf("DevNonce %d recorded by the check", tt.devNonce)
+			}
+		})
+	}
+}
+
+func containsDevNonce(nonces []uint16, n uint16) bool {
+	for _, v := range nonces {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestJoinDevNonceReplayRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		lorawan11   bool
+		devNonces   []uint16
+		wantAccepts []bool
+	}{
+		// 1.0.x 设备的 DevNonce 是随机数，只要没用过都接受
+		{"lorawan 1.0", false, []uint16{0x0100, 0x0002, 0x0100, 0x0001}, []bool{true, true, false, true}},
+		{"lorawan 1.1", true, []uint16{0x0001, 0x0002, 0x0002, 0x0001, 0x0005}, []bool{true, true, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+			setupDevNonceDevice(t, store, tt.lorawan11)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			rejected := 0
+			for i, devNonce := range tt.devNonces {
+				// 绕过 10 秒内相同 JOIN 的去重，模拟之后的重放
+				p.joinCache = NewSimpleCache()
+				p.handleJoinRequest(newTestJoinRequest(t, devNonce), testGatewayID, testRxInfo())
+
+				if accepted := nextTX(t, txs) != nil; accepted != tt.wantAccepts[i] {
+					t.Errorf("JOIN %d with DevNonce %d accepted = %v, want %v", i, devNonce, accepted, tt.wantAccepts[i])
+				}
+				if !tt.wantAccepts[i] {
+					rejected++
+				}
+			}
+
+			// 拒绝的 JOIN 记录为设备错误和安全事件
+			device, _ := store.GetDevice(ctx, testDevEUI)
+			if device.LastError == nil || device.LastError.Code != models.DeviceErrorDevNonceReplay {
+				t.Errorf("LastError = %+v, want %s", device.LastError, models.DeviceErrorDevNonceReplay)
+			}
+			events, _, _ := store.ListEventLogs(ctx, storage.EventLogFilters{}, 10, 0)
+			replays := 0
+			for _, e := range events {
+				if e.Code == "JOIN_REJECTED_DEVNONCE_REPLAY" && e.Level == models.EventLevelWarning {
+					replays++
+				}
+			}
+			if replays != rejected {
+				t.Errorf("%d DevNonce replay events, want %d", replays, rejected)
+			}
+		})
+	}
+}
+
+func TestDevNonceRecordedOnlyAfterSuccess(t *testing.T) {
+	tests := []struct {
+		name      string
+		lorawan11 bool
+		fail      func(p *Processor, store *storagetest.MemoryStore) *lorawan.PHYPayload
+	}{
+		{"MIC failure", false, func(p *Processor, store *storagetest.MemoryStore) *lorawan.PHYPayload {
+			phy := newTestJoinRequest(t, 0x0007)
+			phy.MIC[0] ^= 0xff
+			return phy
+		}},
+		{"JoinNonce allocation failure", false, func(p *Processor, store *storagetest.MemoryStore) *lorawan.PHYPayload {
+			p.store = &failingJoinNonceStore{Store: store}
+			return newTestJoinRequest(t, 0x0007)
+		}},
+		{"1.1 JoinNonce allocation failure", true, func(p *Processor, store *storagetest.MemoryStore) *lorawan.PHYPayload {
+			p.store = &failingJoinNonceStore{Store: store}
+			return newTestJoinRequest(t, 0x0007)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+			setupDevNonceDevice(t, store, tt.lorawan11)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+			var joinEUI lorawan.EUI64
+
+			p.handleJoinRequest(tt.fail(p, store), testGatewayID, testRxInfo())
+			if tx := nextTX(t, txs); tx != nil {
+				t.Fatal("failed JOIN accepted")
+			}
+			if used, _ := store.DevNonceUsed(ctx, joinEUI, testDevEUI, 0x0007); used {
+				t.Fatal("DevNonce of the failed JOIN recorded")
+			}
+
+			// 设备用同一个 DevNonce 重试，JOIN 成功后才记录
+			p.store = store
+			p.joinCache = NewSimpleCache()
+			p.handleJoinRequest(newTestJoinRequest(t, 0x0007), testGatewayID, testRxInfo())
+			if tx := nextTX(t, txs); tx == nil {
+				t.Fatal("retried JOIN not accepted")
+			}
+			if used, _ := store.DevNonceUsed(ctx, joinEUI, testDevEUI, 0x0007); !used {
+				t.Error("DevNonce of the accepted JOIN not recorded")
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// recordDeviceError 记录设备最近一次上行处理失败（MIC、解密、帧计数器），
+// 在设备详情中展示，排查密钥修改后设备掉线等问题时无需翻日志
+func (p *Processor) recordDeviceError(ctx context.Context, devEUI lorawan.EUI64, code, message string, fCnt *uint32, gatewayID string) {
+	p.setFrameResult(ctx, code)
+
+	lastError := &models.DeviceLastError{
+		Time:      time.Now(),
+		Code:      code,
+		Message:   message,
+		FCnt:      fCnt,
+		GatewayID: gatewayID,
+	}
+
+	if err := p.store.UpdateDeviceLastError(ctx, devEUI, lastError); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("devEUI", hex.EncodeToString(devEUI[:])).Msg("保存设备最近错误失败")
+	}
+}
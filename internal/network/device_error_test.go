@@ -0,0 +1,111 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestDeviceLastError(t *testing.T) {
+	const otherKey = "000102030405060708090a0b0c0d0e0f"
+	fPort := uint8(1)
+	fCnt5, fCnt7 := uint32(5), uint32(7)
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, store *storagetest.MemoryStore)
+		uplink   func(t *testing.T) *lorawan.PHYPayload
+		wantCode string // 空表示不记录错误
+		wantFCnt *uint32
+	}{
+		{
+			name: "uplink MIC failure",
+			setup: func(t *testing.T, store *storagetest.MemoryStore) {
+				// 手动修改过的会话密钥与设备不一致
+				session := saveTestSession(t, store, testDevEUI, "")
+				session.FNwkSIntKey, session.SNwkSIntKey = otherKey, otherKey
+				if err := store.SaveDeviceSession(context.Background(), session); err != nil {
+					t.Fatal(err)
+				}
+			},
+			uplink: func(t *testing.T) *lorawan.PHYPayload {
+				return newTestUplink(t, lorawan.UnconfirmedDataUp, 7, &fPort, []byte{1})
+			},
+			wantCode: models.DeviceErrorMICFailure,
+			wantFCnt: &fCnt7,
+		},
+		{
+			name: "frame counter rejected",
+			setup: func(t *testing.T, store *storagetest.MemoryStore) {
+				session := saveTestSession(t, store, testDevEUI, "")
+				session.FCntUp = 10
+				if err := store.SaveDeviceSession(context.Background(), session); err != nil {
+					t.Fatal(err)
+				}
+			},
+			uplink: func(t *testing.T) *lorawan.PHYPayload {
+				return newTestUplink(t, lorawan.UnconfirmedDataUp, 5, &fPort, []byte{1})
+			},
+			wantCode: models.DeviceErrorFCntRejected,
+			wantFCnt: &fCnt5,
+		},
+		{
+			name: "join MIC failure",
+			setup: func(t *testing.T, store *storagetest.MemoryStore) {
+				if err := store.SetDeviceKeys(context.Background(), &models.DeviceKeys{DevEUI: models.EUI64(testDevEUI), AppKey: otherKey}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			uplink:   func(t *testing.T) *lorawan.PHYPayload { return newTestJoinRequest(t, 0x0001) },
+			wantCode: models.DeviceErrorMICFailure,
+		},
+		{
+			name: "valid uplink",
+			setup: func(t *testing.T, store *storagetest.MemoryStore) {
+				saveTestSession(t, store, testDevEUI, "")
+			},
+			uplink: func(t *testing.T) *lorawan.PHYPayload {
+				return newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, _ := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			tt.setup(t, store)
+
+			phy := tt.uplink(t)
+			if phy.MHDR.MType == lorawan.JoinRequest {
+				p.handleJoinRequest(phy, testGatewayID, testRxInfo())
+			} else {
+				p.handleDataUp(phy, testGatewayID, testRxInfo())
+			}
+
+			device, err := store.GetDevice(context.Background(), testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode == "" {
+				if device.LastError != nil {
+					t.Errorf("LastError = %+v, want none", device.LastError)
+				}
+				return
+			}
+			lastError := device.LastError
+			if lastError == nil {
+				t.Fatal("LastError not recorded")
+			}
+			if lastError.Code != tt.wantCode || lastError.Message == "" || lastError.GatewayID != testGatewayID || lastError.Time.IsZero() {
+				t.Errorf("LastError = %+v, want code %s from %s", lastError, tt.wantCode, testGatewayID)
+			}
+			if (lastError.FCnt == nil) != (tt.wantFCnt == nil) || (lastError.FCnt != nil && *lastError.FCnt != *tt.wantFCnt) {
+				t.Errorf("LastError.FCnt = %v, want %v", lastError.FCnt, tt.wantFCnt)
+			}
+		})
+	}
+}
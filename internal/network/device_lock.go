@@ -0,0 +1,69 @@
+package network
+
+import (
+	"sync"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// deviceLock 单个设备的会话锁
+type deviceLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// deviceLocker 按 DevEUI 串行化设备会话的读-改-写，避免下行计数器被重复分配
+type deviceLocker struct {
+	mu    sync.Mutex
+	locks map[lorawan.EUI64]*deviceLock
+}
+
+func newDeviceLocker() *deviceLocker {
+	return &deviceLocker{locks: make(map[lorawan.EUI64]*deviceLock)}
+}
+
+// Lock 锁定设备，返回解锁函数
+func (l *deviceLocker) Lock(devEUI lorawan.EUI64) func() {
+	lock := l.acquire(devEUI)
+	lock.mu.Lock()
+	return l.unlocker(devEUI, lock)
+}
+
+// TryLock 设备未被锁定时锁定并返回解锁函数，否则立即返回 false
+func (l *deviceLocker) TryLock(devEUI lorawan.EUI64) (func(), bool) {
+	lock := l.acquire(devEUI)
+	if !lock.mu.TryLock() {
+		l.release(devEUI, lock)
+		return nil, false
+	}
+	return l.unlocker(devEUI, lock), true
+}
+
+func (l *deviceLocker) acquire(devEUI lorawan.EUI64) *deviceLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[devEUI]
+	if !ok {
+		lock = &deviceLock{}
+		l.locks[devEUI] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (l *deviceLocker) release(devEUI lorawan.EUI64, lock *deviceLock) {
+	l.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, devEUI)
+	}
+	l.mu.Unlock()
+}
+
+func (l *deviceLocker) unlocker(devEUI lorawan.EUI64, lock *deviceLock) func() {
+	return func() {
+		lock.mu.Unlock()
+		l.release(devEUI, lock)
+	}
+}
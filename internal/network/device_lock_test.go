@@ -0,0 +1,110 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestDeviceLocker(t *testing.T) {
+	l := newDeviceLocker()
+
+	unlock := l.Lock(testDevEUI)
+	if _, ok := l.TryLock(testDevEUI); ok {
+		t.Fatal("TryLock succeeded on a locked device")
+	}
+	other, ok := l.TryLock(lorawan.EUI64{2})
+	if !ok {
+		t.Fatal("TryLock failed on another device")
+	}
+	other()
+	unlock()
+
+	again, ok := l.TryLock(testDevEUI)
+	if !ok {
+		t.Fatal("TryLock failed after unlock")
+	}
+	again()
+
+	if n := len(l.locks); n != 0 {
+		t.Errorf("%d locks left after release, want 0", n)
+	}
+}
+
+// slowSessionStore delays session reads so concurrent requests overlap between
+// reading and saving the counters
+type slowSessionStore struct {
+	*storagetest.MemoryStore
+}
+
+func (s slowSessionStore) GetDeviceSession(ctx context.Context, devEUI lorawan.EUI64) (*models.DeviceSession, error) {
+	session, err := s.MemoryStore.GetDeviceSession(ctx, devEUI)
+	time.Sleep(time.Millisecond)
+	return session, err
+}
+
+func TestConcurrentDownlinkRequestsUseUniqueCounters(t *testing.T) {
+	const requests = 20
+
+	tests := []struct {
+		name       string
+		macVersion string
+	}{
+		{"LoRaWAN 1.0", ""},
+		{"LoRaWAN 1.1", "1.1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			p.store = slowSessionStore{store}
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, tt.macVersion)
+			cacheTestUplink(p, testDevEUI, testGatewayID)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			subject := fmt.Sprintf("ns.device.%s.tx", testDevEUI)
+			var wg sync.WaitGroup
+			for i := 0; i < requests; i++ {
+				data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{byte(i)}})
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p.handleDeviceDownlinkRequest(&nats.Msg{Subject: subject, Data: data})
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[uint16]bool)
+			for i := 0; i < requests; i++ {
+				tx := nextTX(t, txs)
+				if tx == nil {
+					t.Fatalf("received %d of %d downlinks", i, requests)
+				}
+				_, mac := decodeDownlink(t, tx)
+				if seen[mac.FHDR.FCnt] {
+					t.Errorf("FCnt %d used twice", mac.FHDR.FCnt)
+				}
+				seen[mac.FHDR.FCnt] = true
+			}
+
+			session, _ := store.GetDeviceSession(context.Background(), testDevEUI)
+			fCnt := session.NFCntDown
+			if tt.macVersion != "" {
+				fCnt = session.AFCntDown
+			}
+			if fCnt != requests {
+				t.Errorf("stored downlink counter = %d, want %d", fCnt, requests)
+			}
+		})
+	}
+}
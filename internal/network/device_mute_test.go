@@ -0,0 +1,30 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestForwardDisabledDeviceUplinkStored(t *testing.T) {
+	p, store, srv := newTestProcessor(t, nil)
+	ctx := context.Background()
+	device := createTestDevice(t, store, testDevEUI)
+	device.ForwardDisabled = true
+	store.UpdateDevice(ctx, device)
+	saveTestSession(t, store, testDevEUI, "")
+	ups := subscribeSync(t, srv, "application.*.device.*.rx")
+
+	// 关闭转发只影响集成，网络服务器照常保存并发布上行
+	fPort := uint8(1)
+	p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+
+	if _, err := ups.NextMsg(time.Second); err != nil {
+		t.Error("uplink of muted device not published")
+	}
+	if frames, _, _ := store.ListUplinkFrames(ctx, testDevEUI, 10, 0); len(frames) != 1 {
+		t.Errorf("%d uplink frames stored, want 1", len(frames))
+	}
+}
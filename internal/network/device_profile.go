@@ -0,0 +1,92 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// deviceProfileTTL 设备配置文件缓存时间，修改设备配置文件后最多延迟这么久生效
+const deviceProfileTTL = time.Minute
+
+// deviceProfile 返回设备的配置文件（带缓存），查询失败时返回 nil
+func (p *Processor) deviceProfile(ctx context.Context, devEUI lorawan.EUI64) *models.DeviceProfile {
+	key := devEUI.String()
+	if v, ok := p.profileCache.Get(key); ok {
+		profile, _ := v.(*models.DeviceProfile)
+		return profile
+	}
+
+	var profile *models.DeviceProfile
+	if device, err := p.store.GetDevice(ctx, devEUI); err == nil {
+		if dp, err := p.store.GetDeviceProfile(ctx, device.DeviceProfileID); err == nil {
+			profile = dp
+		}
+	}
+
+	p.profileCache.Set(key, profile, deviceProfileTTL)
+	return profile
+}
+
+// supports32BitFCnt 返回设备是否使用 32 位帧计数器（设备配置文件
+// supports_32_bit_f_cnt）。查询失败时按 32 位处理，与数据库默认值一致。
+func (p *Processor) supports32BitFCnt(ctx context.Context, devEUI lorawan.EUI64) bool {
+	if profile := p.deviceProfile(ctx, devEUI); profile != nil {
+		return profile.Supports32BitFCnt
+	}
+	return true
+}
+
+// fCntResetsAllowed 返回设备重启后帧计数器是否允许从 0 重新开始（设备配置文件
+// fcnt_resets_allowed）。查询失败时不允许，避免 fcnt=0 的重放被接受。
+func (p *Processor) fCntResetsAllowed(ctx context.Context, devEUI lorawan.EUI64) bool {
+	if profile := p.deviceProfile(ctx, devEUI); profile != nil {
+		return profile.FCntResetsAllowed
+	}
+	return false
+}
+
+// deviceRX2 设备的 RX2 频率和速率：设备配置文件中设置的优先，否则使用频段/全局配置
+func (p *Processor) deviceRX2(profile *models.DeviceProfile) (uint32, int) {
+	freq := p.getRegionRX2Freq()
+	if profile != nil && profile.RX2Frequency > 0 {
+		freq = uint32(profile.RX2Frequency)
+	}
+	return freq, profileRX2DR(profile, p.getRegionRX2DR())
+}
+
+// profileRX2DR 设备配置文件设置了 RX2 速率时返回该速率，否则返回 dr
+func profileRX2DR(profile *models.DeviceProfile, dr int) int {
+	if profile != nil && profile.RX2DR != nil {
+		return *profile.RX2DR
+	}
+	return dr
+}
+
+// rejectABPOnlyJoin 记录仅 ABP 设备的 JOIN 请求被拒绝
+func (p *Processor) rejectABPOnlyJoin(ctx context.Context, device *models.Device, devNonce [2]byte) {
+	log.Warn().
+		Str("devEUI", device.DevEUI.String()).
+		Hex("devNonce", devNonce[:]).
+		Msg("设备配置文件仅允许 ABP，拒绝 JOIN REQUEST")
+
+	event := &models.EventLog{
+		ApplicationID: &device.ApplicationID,
+		DevEUI:        &device.DevEUI,
+		Type:          models.EventTypeJoin,
+		Level:         models.EventLevelWarning,
+		Code:          "JOIN_REJECTED_ABP_ONLY",
+		Description:   "Join request rejected: device profile is ABP only",
+		Details: models.Variables{
+			"devNonce": hex.EncodeToString(devNonce[:]),
+		},
+	}
+	if err := p.store.CreateEventLog(ctx, event); err != nil {
+		log.Error().Err(err).Str("devEUI", device.DevEUI.String()).Msg("记录 JOIN 拒绝事件失败")
+	}
+}
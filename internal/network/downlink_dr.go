@@ -0,0 +1,104 @@
+package network
+
+import (
+	"context"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// getDRIndex 把 datr 字符串转换为当前频段的数据速率索引
+func (p *Processor) getDRIndex(datr string) (uint8, bool) {
+	for dr := uint8(0); dr < 16; dr++ {
+		if p.getDRString(dr) == datr {
+			return dr, true
+		}
+	}
+	return 0, false
+}
+
+// clampDR 把数据速率限制在设备配置文件的 max_downlink_dr 以内，maxDR 为空表示不限制
+func clampDR(dr uint8, maxDR *int) uint8 {
+	if maxDR != nil && *maxDR >= 0 && int(dr) > *maxDR {
+		return uint8(*maxDR)
+	}
+	return dr
+}
+
+// supportedDR 把数据速率限制在设备支持的速率集合内：取不超过 dr 的最大支持速率，
+// 支持的速率都大于 dr 时取其中最小的；supported 为空表示不限制
+func supportedDR(dr uint8, supported []int64) uint8 {
+	if len(supported) == 0 {
+		return dr
+	}
+
+	best, lowest := -1, -1
+	for _, s := range supported {
+		if s < 0 || s > 15 {
+			continue
+		}
+		if int(s) <= int(dr) && int(s) > best {
+			best = int(s)
+		}
+		if lowest < 0 || int(s) < lowest {
+			lowest = int(s)
+		}
+	}
+	if best >= 0 {
+		return uint8(best)
+	}
+	if lowest >= 0 {
+		return uint8(lowest)
+	}
+	return dr
+}
+
+// profileDR 按设备配置文件的支持速率限制 ADR 或下行使用的数据速率，profile 为空时原样返回
+func profileDR(dr uint8, profile *models.DeviceProfile) uint8 {
+	if profile == nil {
+		return dr
+	}
+	return supportedDR(dr, profile.SupportedDataRates)
+}
+
+// rx1DataRate 根据上行速率、会话 RX1DROffset 和设备配置文件的下行速率上限、支持速率计算 RX1 速率
+func (p *Processor) rx1DataRate(devAddr lorawan.DevAddr, uplinkDatr string) string {
+	uplinkDR, ok := p.getDRIndex(uplinkDatr)
+	if !ok {
+		return uplinkDatr
+	}
+
+	ctx := context.Background()
+	sessions, err := p.store.GetDeviceSessionByDevAddr(ctx, devAddr)
+	if err != nil || len(sessions) != 1 {
+		return uplinkDatr
+	}
+	session := sessions[0]
+
+	dr, err := p.region.GetRX1DataRateOffset(uplinkDR, session.RX1DROffset)
+	if err != nil {
+		return uplinkDatr
+	}
+
+	if profile := p.deviceProfile(ctx, lorawan.EUI64(session.DevEUI)); profile != nil {
+		if capped := clampDR(dr, profile.MaxDownlinkDR); capped != dr {
+			logging.Frame().Debug().
+				Str("devAddr", devAddr.String()).
+				Uint8("dr", dr).
+				Uint8("maxDownlinkDR", capped).
+				Msg("下行速率超过设备上限，已降低")
+			dr = capped
+		}
+		if supported := profileDR(dr, profile); supported != dr {
+			logging.Frame().Debug().
+				Str("devAddr", devAddr.String()).
+				Uint8("dr", dr).
+				Uint8("supportedDR", supported).
+				Msg("设备不支持该下行速率，已调整")
+			dr = supported
+		}
+	}
+
+	return p.getDRString(dr)
+}
@@ -0,0 +1,166 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestClampDR(t *testing.T) {
+	dr := func(n int) *int { return &n }
+
+	tests := []struct {
+		name  string
+		dr    uint8
+		maxDR *int
+		want  uint8
+	}{
+		{"no cap", 5, nil, 5},
+		{"capped", 5, dr(2), 2},
+		{"at cap", 2, dr(2), 2},
+		{"below cap", 1, dr(2), 1},
+		{"cap zero", 5, dr(0), 0},
+		{"negative cap ignored", 5, dr(-1), 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clampDR(tt.dr, tt.maxDR); got != tt.want {
+				t.Errorf("clampDR(%d) = %d, want %d", tt.dr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxDownlinkDRCapsRX1(t *testing.T) {
+	dr := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		maxDR    *int
+		offset   uint8
+		override map[string]interface{}
+		want     models.DataRateID
+	}{
+		// 上行 SF7BW125 为 CN470 DR5
+		{"no cap", nil, 0, nil, "SF7BW125"},
+		{"cap lowers DR", dr(2), 0, nil, "SF10BW125"},
+		{"cap at uplink DR", dr(5), 0, nil, "SF7BW125"},
+		{"cap above uplink DR", dr(7), 0, nil, "SF7BW125"},
+		{"offset below cap", dr(4), 2, nil, "SF9BW125"},
+		{"cap after offset", dr(2), 1, nil, "SF10BW125"},
+		{"explicit override not capped", dr(2), 0, map[string]interface{}{"frequency": 501100000, "dataRate": 5}, "SF7BW125"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, overrideTestConfig())
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", MaxDownlinkDR: tt.maxDR}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+
+			session := saveTestSession(t, store, testDevEUI, "")
+			session.RX1DROffset = tt.offset
+			store.SaveDeviceSession(ctx, session)
+			cacheTestUplink(p, testDevEUI, testGatewayID)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}, "override": tt.override})
+			p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if tx.TXPK.DatR != tt.want {
+				t.Errorf("txpk datr = %s, want %s", tx.TXPK.DatR, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportedDR(t *testing.T) {
+	tests := []struct {
+		name      string
+		dr        uint8
+		supported []int64
+		want      uint8
+	}{
+		{"not limited", 5, nil, 5},
+		{"clamped to max", 5, []int64{0, 1, 2, 3}, 3},
+		{"supported", 2, []int64{0, 1, 2, 3}, 2},
+		{"gap", 4, []int64{0, 2, 5}, 2},
+		// 支持的速率都大于 dr 时取最小的
+		{"all above", 1, []int64{3, 4, 5}, 3},
+		{"invalid ignored", 5, []int64{-1, 2, 16}, 2},
+		{"only invalid", 5, []int64{-1, 16}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := supportedDR(tt.dr, tt.supported); got != tt.want {
+				t.Errorf("supportedDR(%d, %v) = %d, want %d", tt.dr, tt.supported, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportedDataRatesLimitDownlinkDR(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported []int64
+		wantRX1   models.DataRateID
+		wantADRDR uint8
+	}{
+		// 上行 SF7BW125 为 CN470 DR5
+		{"not limited", nil, "SF7BW125", 5},
+		{"clamped to profile max DR3", []int64{0, 1, 2, 3}, "SF9BW125", 3},
+		{"uplink DR supported", []int64{3, 5}, "SF7BW125", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, overrideTestConfig())
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", SupportedDataRates: tt.supported}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+
+			session := saveTestSession(t, store, testDevEUI, "")
+			cacheTestUplink(p, testDevEUI, testGatewayID)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}})
+			p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if tx.TXPK.DatR != tt.wantRX1 {
+				t.Errorf("txpk datr = %s, want %s", tx.TXPK.DatR, tt.wantRX1)
+			}
+
+			session.DR = 5
+			req := p.macHandler.NbTransReq(session, profile, 1)
+			if req == nil {
+				t.Fatal("no LinkADRReq created")
+			}
+			if got := req.Payload[0] >> 4; got != tt.wantADRDR {
+				t.Errorf("LinkADRReq DR = %d, want %d", got, tt.wantADRDR)
+			}
+		})
+	}
+}
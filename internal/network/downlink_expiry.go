@@ -0,0 +1,60 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// maxDownlinkQueueAge 返回设备应用下行的最长排队时间：设备配置文件优先于全局配置，0 表示不限制
+func (p *Processor) maxDownlinkQueueAge(ctx context.Context, devEUI lorawan.EUI64) time.Duration {
+	if profile := p.deviceProfile(ctx, devEUI); profile != nil && profile.MaxDownlinkQueueAge > 0 {
+		return time.Duration(profile.MaxDownlinkQueueAge) * time.Second
+	}
+	return p.config.Network.MaxDownlinkQueueAge
+}
+
+// expireStaleDownlinks 把超过最长排队时间的应用下行标记为过期，返回仍可发送的下行
+func (p *Processor) expireStaleDownlinks(ctx context.Context, devEUI lorawan.EUI64, frames []*models.DownlinkFrame) []*models.DownlinkFrame {
+	maxAge := p.maxDownlinkQueueAge(ctx, devEUI)
+	if maxAge <= 0 || len(frames) == 0 {
+		return frames
+	}
+
+	now := time.Now()
+	fresh := frames[:0]
+	for _, frame := range frames {
+		age := now.Sub(frame.CreatedAt)
+		if age <= maxAge {
+			fresh = append(fresh, frame)
+			continue
+		}
+
+		expiredAt := now
+		frame.IsPending = false
+		frame.ExpiredAt = &expiredAt
+		if err := p.store.UpdateDownlinkFrame(ctx, frame); err != nil {
+			log.Error().Err(err).
+				Str("devEUI", devEUI.String()).
+				Str("frameID", frame.ID.String()).
+				Msg("标记过期下行失败")
+			continue
+		}
+
+		log.Info().
+			Str("devEUI", devEUI.String()).
+			Str("frameID", frame.ID.String()).
+			Dur("age", age).
+			Dur("maxAge", maxAge).
+			Msg("应用下行排队超时，不再发送")
+
+		p.publishDownlinkEvent(models.EventTypeDownlinkExpired, devEUI, &models.DeviceLastDownlink{ID: frame.ID.String()},
+			fmt.Sprintf("queued for %s, max age %s", age.Round(time.Second), maxAge))
+	}
+	return fresh
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestStaleQueuedDownlinkExpired(t *testing.T) {
+	tests := []struct {
+		name        string
+		globalAge   time.Duration
+		profileAge  int // 秒，0 使用全局配置
+		queuedFor   time.Duration
+		wantExpired bool
+	}{
+		{"no limit", 0, 0, 72 * time.Hour, false},
+		{"within global max age", time.Hour, 0, 30 * time.Minute, false},
+		{"over global max age", time.Hour, 0, 2 * time.Hour, true},
+		{"profile allows longer", time.Hour, 3 * 3600, 2 * time.Hour, false},
+		{"profile stricter", 0, 60, 2 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.MaxDownlinkQueueAge = tt.globalAge
+			p, store, srv := newTestProcessor(t, cfg)
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", MaxDownlinkQueueAge: tt.profileAge}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+			session := saveTestSession(t, store, testDevEUI, "")
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+			expired := subscribeSync(t, srv, "downlink.*.downlink_expired")
+
+			frame := &models.DownlinkFrame{
+				DevEUI:    models.EUI64(testDevEUI),
+				FPort:     10,
+				Data:      []byte{0xca, 0xfe},
+				IsPending: true,
+				CreatedAt: time.Now().Add(-tt.queuedFor),
+			}
+			store.CreateDownlinkFrame(ctx, frame)
+
+			p.handleDownlink(session, testGatewayID, testRxInfo(), nil, false)
+
+			tx := nextTX(t, txs)
+			if tt.wantExpired {
+				if tx != nil {
+					t.Fatal("expired frame sent")
+				}
+			} else if tx == nil {
+				t.Fatal("queued frame not sent")
+			}
+
+			stored := store.DownlinkFrames()[0]
+			if (stored.ExpiredAt != nil) != tt.wantExpired || stored.IsPending {
+				t.Errorf("frame pending %v expiredAt %v, want expired %v", stored.IsPending, stored.ExpiredAt, tt.wantExpired)
+			}
+
+			msg, err := expired.NextMsg(200 * time.Millisecond)
+			if (err == nil) != tt.wantExpired {
+				t.Fatalf("DOWNLINK_EXPIRED published = %v, want %v", err == nil, tt.wantExpired)
+			}
+			if err == nil {
+				var event models.DownlinkEvent
+				json.Unmarshal(msg.Data, &event)
+				if event.Type != models.EventTypeDownlinkExpired || event.ID != frame.ID.String() {
+					t.Errorf("event = %+v, want DOWNLINK_EXPIRED for %s", event, frame.ID)
+				}
+			}
+		})
+	}
+}
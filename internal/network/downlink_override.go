@@ -0,0 +1,166 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// 下行接收窗口
+const (
+	WindowRX1 = "RX1"
+	WindowRX2 = "RX2"
+)
+
+// DownlinkOverride 单次下行的频率/速率/窗口覆盖，用于诊断时强制指定信道
+type DownlinkOverride struct {
+	Frequency uint32 `json:"frequency,omitempty"` // Hz
+	DataRate  *int   `json:"dataRate,omitempty"`
+	Window    string `json:"window,omitempty"` // RX1 / RX2
+}
+
+// Empty 是否没有任何覆盖
+func (o *DownlinkOverride) Empty() bool {
+	return o == nil || (o.Frequency == 0 && o.DataRate == nil && o.Window == "")
+}
+
+// Validate 校验覆盖参数是否为频段合法的下行信道和速率
+func (o *DownlinkOverride) Validate(cfg *config.Config) error {
+	if o.Empty() {
+		return nil
+	}
+
+	if o.Window != "" && o.Window != WindowRX1 && o.Window != WindowRX2 {
+		return fmt.Errorf("window must be %s or %s", WindowRX1, WindowRX2)
+	}
+
+	region := configRegion(cfg)
+
+	if o.DataRate != nil && !validDataRate(region, *o.DataRate) {
+		return fmt.Errorf("dataRate %d is not valid for region %s", *o.DataRate, region.Name)
+	}
+
+	if o.Frequency != 0 && !validDownlinkFrequency(cfg, region, o.Frequency) {
+		return fmt.Errorf("frequency %d Hz is not a downlink channel of region %s", o.Frequency, region.Name)
+	}
+
+	return nil
+}
+
+// MaxDownlinkPayloadSize 设备当前下行速率允许的最大 FRMPayload（字节）及该速率。
+// 覆盖指定了速率时使用覆盖速率；指定 RX2 窗口或 C 类设备使用 RX2 速率；否则由会话速率和 RX1DROffset
+// 计算 RX1 速率，受设备配置文件的下行速率上限限制，TDD 模式同时在 RX2 发送时取两者中较小的
+func MaxDownlinkPayloadSize(cfg *config.Config, session *models.DeviceSession, profile *models.DeviceProfile, o *DownlinkOverride) (int, int) {
+	region := configRegion(cfg)
+	rx2DR := region.DefaultRX2DR
+	if region.Name == "CN470" {
+		rx2DR = cfg.CN470.RXWindows.RX2DataRate
+	}
+	rx2DR = profileRX2DR(profile, rx2DR)
+
+	dr := rx2DR
+	switch {
+	case o != nil && o.DataRate != nil:
+		dr = *o.DataRate
+	case (o != nil && o.Window == WindowRX2) || (profile != nil && profile.DeviceClass == models.DeviceClassC):
+	default:
+		rx1, _ := region.GetRX1DataRateOffset(session.DR, session.RX1DROffset)
+		if profile != nil {
+			rx1 = profileDR(clampDR(rx1, profile.MaxDownlinkDR), profile)
+		}
+		dr = int(rx1)
+		if o.Empty() && region.Name == "CN470" && cfg.CN470.GetCN470Mode() == "TDD" {
+			if n, ok := region.MaxPayloadSizePerDR[rx2DR]; ok && n < region.MaxPayloadSizePerDR[dr] {
+				dr = rx2DR
+			}
+		}
+	}
+
+	if n, ok := region.MaxPayloadSizePerDR[dr]; ok {
+		return n, dr
+	}
+	// 速率未知时使用频段最小的上限
+	smallest := 0
+	for _, n := range region.MaxPayloadSizePerDR {
+		if smallest == 0 || n < smallest {
+			smallest = n
+		}
+	}
+	return smallest, dr
+}
+
+// configRegion 配置的频段，未配置时为 CN470
+func configRegion(cfg *config.Config) *lorawan.RegionConfiguration {
+	band := cfg.Network.Band
+	if band == "" {
+		band = "CN470"
+	}
+	return lorawan.GetRegionConfiguration(band)
+}
+
+// validDataRate 速率是否为频段定义的 LoRa 速率
+func validDataRate(region *lorawan.RegionConfiguration, dr int) bool {
+	_, ok := region.DataRateString(dr)
+	return ok
+}
+
+// validDownlinkFrequency 频率是否为当前频段配置中的下行信道或 RX2 频率
+func validDownlinkFrequency(cfg *config.Config, region *lorawan.RegionConfiguration, freq uint32) bool {
+	if region.Name == "CN470" {
+		if freq == cfg.CN470.RXWindows.RX2Frequency {
+			return true
+		}
+		return cfg.CN470.ValidateFrequency(freq) && cfg.CN470.ValidateChannelFrequency(freq, false)
+	}
+
+	if freq == region.DefaultRX2Freq {
+		return true
+	}
+	for _, ch := range region.DefaultChannels {
+		if ch.Frequency == freq {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDownlinkWindow 按覆盖的窗口确定下行延迟，RX2 未指定频率/速率时使用设备的 RX2 参数
+func (p *Processor) resolveDownlinkWindow(o *DownlinkOverride, delay time.Duration, profile *models.DeviceProfile) (*DownlinkOverride, time.Duration) {
+	if o.Empty() || o.Window != WindowRX2 {
+		return o, delay
+	}
+
+	resolved := *o
+	rx2 := p.rx2Override(profile)
+	if resolved.Frequency == 0 {
+		resolved.Frequency = rx2.Frequency
+	}
+	if resolved.DataRate == nil {
+		resolved.DataRate = rx2.DataRate
+	}
+
+	return &resolved, time.Duration(p.config.CN470.RXWindows.RX2Delay) * time.Second
+}
+
+// rx2Override 设备的 RX2 频率/速率，作为覆盖传入以免被下行频率计算改写
+func (p *Processor) rx2Override(profile *models.DeviceProfile) *DownlinkOverride {
+	freq, dr := p.deviceRX2(profile)
+	return &DownlinkOverride{
+		Frequency: freq,
+		DataRate:  &dr,
+		Window:    WindowRX2,
+	}
+}
+
+// classCDownlinkWindow C 类设备的应用下行在 RX2 频率/速率上立即发送，覆盖中指定的频率/速率仍然优先
+func (p *Processor) classCDownlinkWindow(o *DownlinkOverride, profile *models.DeviceProfile) *DownlinkOverride {
+	rx2 := DownlinkOverride{Window: WindowRX2}
+	if o != nil {
+		rx2.Frequency, rx2.DataRate = o.Frequency, o.DataRate
+	}
+	resolved, _ := p.resolveDownlinkWindow(&rx2, 0, profile)
+	return resolved
+}
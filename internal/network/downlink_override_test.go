@@ -0,0 +1,112 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// overrideTestConfig 自定义 FDD：上行 470.3-471.9MHz，下行 500.3-501.9MHz，RX2 505.3MHz DR0
+func overrideTestConfig() *config.Config {
+	return &config.Config{CN470: config.CN470Config{
+		Mode:     "CUSTOM_FDD",
+		Hardware: config.CN470HardwareConfig{SupportsTX500MHz: true},
+		CustomFDD: config.CN470CustomFDD{
+			UplinkStartFreq:   470300000,
+			UplinkEndFreq:     471900000,
+			DownlinkStartFreq: 500300000,
+			DownlinkEndFreq:   501900000,
+			UplinkChannels:    8,
+		},
+		Channels:  config.CN470Channels{ChannelSpacing: 200000},
+		RXWindows: config.CN470RXWindows{RX1Delay: 1, RX2Delay: 2, RX2Frequency: 505300000},
+	}}
+}
+
+func TestDownlinkOverrideValidate(t *testing.T) {
+	dr := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		override *DownlinkOverride
+		wantErr  bool
+	}{
+		{"none", nil, false},
+		{"downlink channel", &DownlinkOverride{Frequency: 500500000}, false},
+		{"RX2 frequency", &DownlinkOverride{Frequency: 505300000}, false},
+		{"uplink channel", &DownlinkOverride{Frequency: 470500000}, true},
+		{"data rate", &DownlinkOverride{DataRate: dr(3)}, false},
+		{"unknown data rate", &DownlinkOverride{DataRate: dr(16)}, true},
+		{"RX2 window", &DownlinkOverride{Window: WindowRX2}, false},
+		{"unknown window", &DownlinkOverride{Window: "RX3"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.override.Validate(overrideTestConfig()); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownlinkOverrideHonoredInTXPK(t *testing.T) {
+	tests := []struct {
+		name     string
+		override map[string]interface{}
+		freq     float64
+		datr     models.DataRateID
+		tmst     uint32
+	}{
+		// 无覆盖时 RX1 由上行频率计算：470.3MHz 加 10MHz
+		{"none", nil, 480.3, "SF7BW125", 101000000},
+		{"frequency and data rate", map[string]interface{}{"frequency": 501100000, "dataRate": 3}, 501.1, "SF9BW125", 101000000},
+		{"RX2 window", map[string]interface{}{"window": "RX2"}, 505.3, "SF12BW125", 102000000},
+		{"RX2 window with data rate", map[string]interface{}{"window": "RX2", "dataRate": 2}, 505.3, "SF10BW125", 102000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, overrideTestConfig())
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			cacheTestUplink(p, testDevEUI, testGatewayID)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}, "override": tt.override})
+			p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if tx.TXPK.Freq != tt.freq || tx.TXPK.DatR != tt.datr {
+				t.Errorf("txpk freq %v datr %s, want %v %s", tx.TXPK.Freq, tx.TXPK.DatR, tt.freq, tt.datr)
+			}
+			if tx.TXPK.Tmst == nil || *tx.TXPK.Tmst != tt.tmst {
+				t.Errorf("txpk tmst = %v, want %d", tx.TXPK.Tmst, tt.tmst)
+			}
+		})
+	}
+}
+
+func TestInvalidDownlinkOverrideNotSent(t *testing.T) {
+	p, store, srv := newTestProcessor(t, overrideTestConfig())
+	createTestDevice(t, store, testDevEUI)
+	saveTestSession(t, store, testDevEUI, "")
+	cacheTestUplink(p, testDevEUI, testGatewayID)
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+	data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}, "override": map[string]interface{}{"frequency": 470500000}})
+	p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+
+	if _, err := txs.NextMsg(100 * time.Millisecond); err == nil {
+		t.Error("downlink with an invalid override was sent")
+	}
+}
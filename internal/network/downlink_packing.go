@@ -0,0 +1,125 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// downlinkPacking 一次下行发送的内容，以及留到后续下行的部分
+type downlinkPacking struct {
+	macCmds  []lorawan.MACCommand  // 本次发送的 MAC 命令，有应用数据时放在 FOpts，否则放在 FPort 0
+	frame    *models.DownlinkFrame // 本次发送的应用下行，可为空
+	deferred []lorawan.MACCommand  // 放不下、留到下一次下行的 MAC 命令
+	fPending bool                  // 还有待发送的内容
+}
+
+// packDownlink 按优先级填充一次下行：先放 MAC 命令（按给定顺序），再放队列中的第一条应用下行，
+// FOpts 与 FRMPayload 合计不超过当前速率的最大负载 maxPayload。MAC 命令和应用数据放不进同一帧时
+// 本次只发 MAC 命令（FPort 0 可超过 FOpts 的 15 字节），应用下行留在队列中；放不下的 MAC 命令
+// 顺延到下一次下行。仍有待发送内容时设置 FPending，请设备尽快上行。
+//
+// 超过 maxPayload 的应用下行由调用方留在队列中，不传入 frames。
+func packDownlink(maxPayload int, macCmds []lorawan.MACCommand, frames []*models.DownlinkFrame) downlinkPacking {
+	if len(frames) > 0 {
+		frame := frames[0]
+		budget := maxPayload - len(frame.Data)
+		if budget > maxFOptsLen {
+			budget = maxFOptsLen
+		}
+		if fit, rest := splitMACCommands(macCmds, budget); len(rest) == 0 {
+			return downlinkPacking{
+				macCmds:  fit,
+				frame:    frame,
+				fPending: len(frames) > 1,
+			}
+		}
+	}
+
+	fit, rest := splitMACCommands(macCmds, maxPayload)
+	return downlinkPacking{
+		macCmds:  fit,
+		deferred: rest,
+		fPending: len(rest) > 0 || len(frames) > 0,
+	}
+}
+
+// splitMACCommands 按顺序取出总长不超过 budget 字节的 MAC 命令，遇到放不下的命令即停止，保持优先级顺序
+func splitMACCommands(cmds []lorawan.MACCommand, budget int) (fit, rest []lorawan.MACCommand) {
+	size := 0
+	for i, cmd := range cmds {
+		if size+1+len(cmd.Payload) > budget {
+			return cmds[:i], cmds[i:]
+		}
+		size += 1 + len(cmd.Payload)
+	}
+	return cmds, nil
+}
+
+// maxDownlinkPayload 本次下行可用的最大负载（FOpts + FRMPayload）：RX1 速率的上限，
+// 同时在 RX2 发送时取两者中较小的；速率未知时使用频段最小的上限
+func (p *Processor) maxDownlinkPayload(session *models.DeviceSession, rxInfo map[string]interface{}) int {
+	smallest := 0
+	for _, n := range p.region.MaxPayloadSizePerDR {
+		if smallest == 0 || n < smallest {
+			smallest = n
+		}
+	}
+
+	datr, _ := rxInfo["datr"].(string)
+	dr, ok := p.getDRIndex(p.rx1DataRate(lorawan.DevAddr(session.DevAddr), datr))
+	if !ok {
+		return smallest
+	}
+	maxPayload, ok := p.region.MaxPayloadSizePerDR[int(dr)]
+	if !ok {
+		return smallest
+	}
+
+	if p.shouldUseRX2() {
+		profile := p.deviceProfile(context.Background(), lorawan.EUI64(session.DevEUI))
+		if n, ok := p.region.MaxPayloadSizePerDR[profileRX2DR(profile, p.getRegionRX2DR())]; ok && n < maxPayload {
+			maxPayload = n
+		}
+	}
+	return maxPayload
+}
+
+// deferMACCommands 把本次放不下的 MAC 命令放回设备的 MAC 命令队列，排在已有命令之前，
+// 下一次下行优先发送
+func (p *Processor) deferMACCommands(ctx context.Context, session *models.DeviceSession, cmds []lorawan.MACCommand) {
+	if len(cmds) == 0 {
+		return
+	}
+	devEUI := lorawan.EUI64(session.DevEUI)
+
+	first := time.Now()
+	if items, err := p.store.GetPendingMACCommands(ctx, devEUI); err == nil && len(items) > 0 && items[0].CreatedAt.Before(first) {
+		first = items[0].CreatedAt
+	}
+
+	for i, cmd := range cmds {
+		item := &models.MACCommandQueueItem{
+			DevEUI:    session.DevEUI,
+			CID:       cmd.CID,
+			Payload:   cmd.Payload,
+			CreatedAt: first.Add(-time.Duration(len(cmds)-i) * time.Millisecond),
+		}
+		if err := p.store.EnqueueMACCommand(ctx, item); err != nil {
+			log.Error().Err(err).
+				Str("devEUI", devEUI.String()).
+				Uint8("cid", cmd.CID).
+				Msg("顺延 MAC 命令失败")
+			continue
+		}
+
+		log.Debug().
+			Str("devEUI", devEUI.String()).
+			Uint8("cid", cmd.CID).
+			Msg("下行负载已满，MAC 命令顺延到下一次下行")
+	}
+}
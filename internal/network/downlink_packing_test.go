@@ -0,0 +1,152 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// packTestCmds 生成 n 个 6 字节的 NewChannelReq，Payload 首字节为序号，用于检查顺序
+func packTestCmds(n int) []lorawan.MACCommand {
+	var cmds []lorawan.MACCommand
+	for i := 0; i < n; i++ {
+		cmds = append(cmds, lorawan.MACCommand{CID: lorawan.NewChannelReq, Payload: []byte{byte(i), 0, 0, 0, 0}})
+	}
+	return cmds
+}
+
+func cmdOrder(cmds []lorawan.MACCommand) []byte {
+	var order []byte
+	for _, cmd := range cmds {
+		order = append(order, cmd.Payload[0])
+	}
+	return order
+}
+
+func TestPackDownlink(t *testing.T) {
+	frame := func(size int) *models.DownlinkFrame { return &models.DownlinkFrame{Data: make([]byte, size)} }
+
+	tests := []struct {
+		name         string
+		maxPayload   int
+		cmds         int
+		frames       []*models.DownlinkFrame
+		wantCmds     []byte
+		wantFrame    bool
+		wantDeferred []byte
+		wantFPending bool
+	}{
+		{"empty", 51, 0, nil, nil, false, nil, false},
+		{"commands and frame fit", 51, 2, []*models.DownlinkFrame{frame(30)}, []byte{0, 1}, true, nil, false},
+		{"more frames queued", 51, 0, []*models.DownlinkFrame{frame(30), frame(10)}, nil, true, nil, true},
+		// 合计超过最大负载，本次只发 MAC 命令，应用下行留到下一次
+		{"frame does not fit with commands", 51, 2, []*models.DownlinkFrame{frame(45)}, []byte{0, 1}, false, nil, true},
+		// 有应用数据时 MAC 命令只能放在 FOpts（15 字节）
+		{"commands exceed FOpts", 242, 3, []*models.DownlinkFrame{frame(10)}, []byte{0, 1, 2}, false, nil, true},
+		{"FPort 0 commands deferred", 51, 10, nil, []byte{0, 1, 2, 3, 4, 5, 6, 7}, false, []byte{8, 9}, true},
+		{"deferred with frame queued", 51, 10, []*models.DownlinkFrame{frame(30)}, []byte{0, 1, 2, 3, 4, 5, 6, 7}, false, []byte{8, 9}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := packDownlink(tt.maxPayload, packTestCmds(tt.cmds), tt.frames)
+			if order := cmdOrder(got.macCmds); !reflect.DeepEqual(order, tt.wantCmds) {
+				t.Errorf("sent commands %v, want %v", order, tt.wantCmds)
+			}
+			if (got.frame != nil) != tt.wantFrame {
+				t.Errorf("frame sent = %v, want %v", got.frame != nil, tt.wantFrame)
+			}
+			if got.frame != nil && got.frame != tt.frames[0] {
+				t.Error("sent frame is not the first queued frame")
+			}
+			if order := cmdOrder(got.deferred); !reflect.DeepEqual(order, tt.wantDeferred) {
+				t.Errorf("deferred commands %v, want %v", order, tt.wantDeferred)
+			}
+			if got.fPending != tt.wantFPending {
+				t.Errorf("fPending = %v, want %v", got.fPending, tt.wantFPending)
+			}
+		})
+	}
+}
+
+func TestPackedDownlinkSplitInPriorityOrder(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Network.PackDownlinks = true
+	p, store, srv := newTestProcessor(t, cfg)
+	ctx := context.Background()
+	createTestDevice(t, store, testDevEUI)
+	session := saveTestSession(t, store, testDevEUI, "")
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+	key, _ := hex.DecodeString(testKey)
+
+	frame := &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), FPort: 10, Data: make([]byte, 30), IsPending: true}
+	store.CreateDownlinkFrame(ctx, frame)
+
+	// SF12 为 CN470 DR0，最大负载 51 字节：10 个 MAC 命令共 60 字节，加上 30 字节应用数据需要两次下行
+	rxInfo := testRxInfo()
+	rxInfo["datr"] = "SF12BW125"
+	p.handleDownlink(session, testGatewayID, rxInfo, packTestCmds(10), false)
+
+	tx := nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("first downlink not sent")
+	}
+	_, mac := decodeDownlink(t, tx)
+	if mac.FPort == nil || *mac.FPort != 0 {
+		t.Fatalf("first downlink FPort = %v, want 0", mac.FPort)
+	}
+	if !mac.FHDR.FCtrl.FPending {
+		t.Error("first downlink FPending not set")
+	}
+	plain, err := lorawan.EncryptFRMPayload(key, testDevAddr, uint32(mac.FHDR.FCnt), false, mac.FRMPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 48 {
+		t.Fatalf("first downlink carries %d bytes of MAC commands, want 48", len(plain))
+	}
+	for i := 0; i < 8; i++ {
+		if plain[i*6] != lorawan.NewChannelReq || plain[i*6+1] != byte(i) {
+			t.Fatalf("first downlink commands % x not in priority order", plain)
+		}
+	}
+
+	// 放不下的命令按原顺序留在队列中，应用下行未发送
+	queued, _ := store.GetPendingMACCommands(ctx, testDevEUI)
+	var queuedOrder []byte
+	for _, item := range queued {
+		queuedOrder = append(queuedOrder, item.Payload[0])
+	}
+	if !reflect.DeepEqual(queuedOrder, []byte{8, 9}) {
+		t.Fatalf("queued commands %v, want [8 9]", queuedOrder)
+	}
+	if pending, _ := store.GetPendingDownlinks(ctx, testDevEUI); len(pending) != 1 {
+		t.Fatalf("%d frames queued after first downlink, want 1", len(pending))
+	}
+
+	// 下一次上行：顺延的命令放在 FOpts，应用下行一起发送
+	p.handleDownlink(session, testGatewayID, rxInfo, p.appendQueuedMACCommands(ctx, session, nil), false)
+
+	tx = nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("second downlink not sent")
+	}
+	_, mac = decodeDownlink(t, tx)
+	if mac.FPort == nil || *mac.FPort != 10 {
+		t.Fatalf("second downlink FPort = %v, want 10", mac.FPort)
+	}
+	if mac.FHDR.FCtrl.FPending {
+		t.Error("second downlink FPending set with nothing left to send")
+	}
+	if fOpts := mac.FHDR.FOpts; len(fOpts) != 12 || fOpts[0] != lorawan.NewChannelReq || fOpts[1] != 8 || fOpts[7] != 9 {
+		t.Errorf("second downlink FOpts % x, want commands 8 and 9", fOpts)
+	}
+	if pending, _ := store.GetPendingDownlinks(ctx, testDevEUI); len(pending) != 0 {
+		t.Errorf("%d frames still queued after second downlink", len(pending))
+	}
+}
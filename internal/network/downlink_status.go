@@ -0,0 +1,188 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// pendingTxInfo 等待网关 TX_ACK 的下行
+type pendingTxInfo struct {
+	devEUI       lorawan.EUI64
+	lastDownlink *models.DeviceLastDownlink
+	retried      bool // 已在 RX2 重发过
+}
+
+// recordLastDownlink 记录设备最近一次下行，并等待网关 TX_ACK。
+// id 为应用下行队列中的帧 ID，ACK 等网络服务器自行产生的下行为空。
+func (p *Processor) recordLastDownlink(session *models.DeviceSession, gatewayID string, fPort *uint8, fCnt uint32, confirmed bool, id string) {
+	devEUI := lorawan.EUI64(session.DevEUI)
+	lastDownlink := &models.DeviceLastDownlink{
+		Time:      time.Now(),
+		FCnt:      fCnt,
+		Confirmed: confirmed,
+		GatewayID: gatewayID,
+		ID:        id,
+	}
+	if fPort != nil {
+		port := *fPort
+		lastDownlink.FPort = &port
+	}
+
+	p.pendingTxMutex.Lock()
+	p.pendingTx[gatewayID] = &pendingTxInfo{devEUI: devEUI, lastDownlink: lastDownlink}
+	p.pendingTxMutex.Unlock()
+
+	if err := p.store.UpdateDeviceLastDownlink(context.Background(), devEUI, lastDownlink); err != nil {
+		log.Error().Err(err).Str("devEUI", hex.EncodeToString(devEUI[:])).Msg("保存最近下行失败")
+	}
+
+	p.publishDownlinkEvent(models.EventTypeDownlinkScheduled, devEUI, lastDownlink, "")
+
+	if confirmed {
+		go p.watchConfirmedDownlink(devEUI, lastDownlink)
+	}
+}
+
+// handleGatewayTxAck 处理网关 TX_ACK，更新最近下行的发射状态
+func (p *Processor) handleGatewayTxAck(msg *nats.Msg) {
+	var txAck struct {
+		GatewayID string                 `json:"gatewayID"`
+		Token     uint16                 `json:"token"`
+		Ack       map[string]interface{} `json:"ack"`
+	}
+	if err := json.Unmarshal(msg.Data, &txAck); err != nil {
+		log.Error().Err(err).Msg("解析 TX_ACK 失败")
+		return
+	}
+
+	if txAck.GatewayID == "" {
+		parts := strings.Split(msg.Subject, ".")
+		if len(parts) == 3 {
+			txAck.GatewayID = parts[1]
+		}
+	}
+
+	p.pendingTxMutex.Lock()
+	pending, ok := p.pendingTx[txAck.GatewayID]
+	if ok {
+		delete(p.pendingTx, txAck.GatewayID)
+	}
+	p.pendingTxMutex.Unlock()
+
+	// 只关联最近 30 秒内调度的下行
+	if !ok || time.Since(pending.lastDownlink.Time) > 30*time.Second {
+		return
+	}
+
+	// 空的 TX_ACK 或 error 为 NONE 表示发射成功
+	txError := ""
+	if ackObj, ok := txAck.Ack["txpk_ack"].(map[string]interface{}); ok {
+		if e, ok := ackObj["error"].(string); ok && e != "NONE" {
+			txError = e
+		}
+	}
+
+	// 时序错误改在 RX2 重发，等待重发的 TX_ACK
+	if txError != "" && p.applyTxAckPolicy(txAck.GatewayID, pending, txError) {
+		return
+	}
+
+	pending.lastDownlink.TxAcked = txError == ""
+	pending.lastDownlink.TxError = txError
+
+	if txError == "" {
+		p.publishDownlinkEvent(models.EventTypeDownlinkTx, pending.devEUI, pending.lastDownlink, "")
+	} else {
+		p.publishDownlinkEvent(models.EventTypeDownlinkFailed, pending.devEUI, pending.lastDownlink, txError)
+	}
+
+	if err := p.store.UpdateDeviceLastDownlink(context.Background(), pending.devEUI, pending.lastDownlink); err != nil {
+		log.Error().Err(err).Str("devEUI", hex.EncodeToString(pending.devEUI[:])).Msg("更新下行发射状态失败")
+		return
+	}
+
+	log.Debug().
+		Str("devEUI", hex.EncodeToString(pending.devEUI[:])).
+		Str("gateway", txAck.GatewayID).
+		Str("txError", txError).
+		Msg("下行 TX_ACK 已记录")
+}
+
+// markLastDownlinkAcked 设备上行带 ACK 时标记确认下行已被确认
+func (p *Processor) markLastDownlinkAcked(device *models.Device) {
+	last := device.LastDownlink
+	if last == nil || !last.Confirmed || last.Acked {
+		return
+	}
+
+	now := time.Now()
+	last.Acked = true
+	last.AckedAt = &now
+
+	if err := p.store.UpdateDeviceLastDownlink(context.Background(), lorawan.EUI64(device.DevEUI), last); err != nil {
+		log.Error().Err(err).Str("devEUI", device.DevEUI.String()).Msg("更新下行确认状态失败")
+	}
+
+	p.publishDownlinkEvent(models.EventTypeDownlinkAck, lorawan.EUI64(device.DevEUI), last, "")
+}
+
+// publishDownlinkEvent 发布下行生命周期事件 downlink.<devEUI>.<type>，由应用服务器写入事件日志
+func (p *Processor) publishDownlinkEvent(typ models.EventType, devEUI lorawan.EUI64, last *models.DeviceLastDownlink, reason string) {
+	event := models.DownlinkEvent{
+		Type:   typ,
+		DevEUI: hex.EncodeToString(devEUI[:]),
+		Error:  reason,
+		Time:   time.Now(),
+	}
+	if last != nil {
+		event.ID = last.ID
+		event.FCnt = last.FCnt
+		event.GatewayID = last.GatewayID
+	}
+
+	data, _ := json.Marshal(event)
+	subject := fmt.Sprintf("downlink.%s.%s", event.DevEUI, strings.ToLower(string(typ)))
+	if err := p.nc.Publish(subject, data); err != nil {
+		log.Error().Err(err).Str("subject", subject).Msg("发布下行事件失败")
+	}
+}
+
+// failDownlinkRequest 记录无法调度的应用下行，请求方等待回复时同时回复失败原因
+func (p *Processor) failDownlinkRequest(msg *nats.Msg, devEUI lorawan.EUI64, id string, reason string) {
+	p.publishDownlinkEvent(models.EventTypeDownlinkFailed, devEUI, &models.DeviceLastDownlink{ID: id}, reason)
+	replyDownlinkRequest(msg, id, reason)
+}
+
+// downlinkRequestReply 应用下行请求的回复，请求方用 NATS request 发送时才有
+type downlinkRequestReply struct {
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"` // scheduled / failed
+	Error  string `json:"error,omitempty"`
+}
+
+// replyDownlinkRequest 回复应用下行请求的处理结果，reason 为空表示已调度
+func replyDownlinkRequest(msg *nats.Msg, id string, reason string) {
+	if msg == nil || msg.Reply == "" {
+		return
+	}
+
+	reply := downlinkRequestReply{ID: id, Status: "scheduled"}
+	if reason != "" {
+		reply.Status = "failed"
+		reply.Error = reason
+	}
+	data, _ := json.Marshal(reply)
+	if err := msg.Respond(data); err != nil {
+		log.Error().Err(err).Msg("回复下行请求失败")
+	}
+}
@@ -0,0 +1,228 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestRecordLastDownlink(t *testing.T) {
+	fPort := uint8(10)
+
+	tests := []struct {
+		name      string
+		fPort     *uint8
+		confirmed bool
+		id        string
+	}{
+		{"application downlink", &fPort, false, "frame-1"},
+		{"confirmed downlink", &fPort, true, "frame-2"},
+		{"network ack", nil, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			events := subscribeSync(t, srv, "downlink.*.downlink_scheduled")
+
+			session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+			p.recordLastDownlink(session, testGatewayID, tt.fPort, 7, tt.confirmed, tt.id)
+
+			device, err := store.GetDevice(context.Background(), testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := device.LastDownlink
+			if last == nil {
+				t.Fatal("LastDownlink not set")
+			}
+			if last.FCnt != 7 || last.Confirmed != tt.confirmed || last.GatewayID != testGatewayID || last.ID != tt.id {
+				t.Errorf("LastDownlink = %+v", last)
+			}
+			if (last.FPort == nil) != (tt.fPort == nil) || (last.FPort != nil && *last.FPort != *tt.fPort) {
+				t.Errorf("FPort = %v, want %v", last.FPort, tt.fPort)
+			}
+			if last.TxAcked || last.Acked || time.Since(last.Time) > time.Minute {
+				t.Errorf("LastDownlink = %+v, want a fresh unacknowledged downlink", last)
+			}
+
+			msg, err := events.NextMsg(time.Second)
+			if err != nil {
+				t.Fatalf("no scheduled event: %v", err)
+			}
+			var event models.DownlinkEvent
+			json.Unmarshal(msg.Data, &event)
+			if event.FCnt != 7 || event.ID != tt.id || event.GatewayID != testGatewayID {
+				t.Errorf("event = %+v", event)
+			}
+		})
+	}
+}
+
+func TestHandleGatewayTxAckUpdatesLastDownlink(t *testing.T) {
+	tests := []struct {
+		name        string
+		ack         string
+		wantTxAcked bool
+		wantTxError string
+	}{
+		{"empty ack", `{}`, true, ""},
+		{"none", `{"txpk_ack":{"error":"NONE"}}`, true, ""},
+		{"config error", `{"txpk_ack":{"error":"TX_FREQ"}}`, false, "TX_FREQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, _ := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+
+			session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+			p.recordLastDownlink(session, testGatewayID, nil, 3, false, "")
+
+			p.handleGatewayTxAck(&nats.Msg{
+				Subject: "gateway." + testGatewayID + ".txack",
+				Data:    []byte(`{"token":1,"ack":` + tt.ack + `}`),
+			})
+
+			device, _ := store.GetDevice(context.Background(), testDevEUI)
+			last := device.LastDownlink
+			if last.TxAcked != tt.wantTxAcked || last.TxError != tt.wantTxError {
+				t.Errorf("TxAcked = %v, TxError = %q, want %v, %q", last.TxAcked, last.TxError, tt.wantTxAcked, tt.wantTxError)
+			}
+		})
+	}
+}
+
+func TestMarkLastDownlinkAcked(t *testing.T) {
+	p, store, _ := newTestProcessor(t, nil)
+	createTestDevice(t, store, testDevEUI)
+
+	session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+	p.recordLastDownlink(session, testGatewayID, nil, 5, true, "frame-1")
+
+	device, _ := store.GetDevice(context.Background(), testDevEUI)
+	p.markLastDownlinkAcked(device)
+
+	device, _ = store.GetDevice(context.Background(), testDevEUI)
+	if last := device.LastDownlink; !last.Acked || last.AckedAt == nil {
+		t.Errorf("LastDownlink = %+v, want acked", last)
+	}
+}
+
+func TestDownlinkLifecycleEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		session bool
+		ack     string // 网关 TX_ACK，空表示网关没有应答
+		acked   bool   // 设备上行确认
+		want    []models.EventType
+	}{
+		{"confirmed downlink", true, `{}`, true, []models.EventType{
+			models.EventTypeDownlinkScheduled, models.EventTypeDownlinkTx, models.EventTypeDownlinkAck}},
+		{"gateway rejects", true, `{"txpk_ack":{"error":"TOO_LATE"}}`, false, []models.EventType{
+			models.EventTypeDownlinkScheduled, models.EventTypeDownlinkFailed}},
+		{"no session", false, "", false, []models.EventType{models.EventTypeDownlinkFailed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			if tt.session {
+				saveTestSession(t, store, testDevEUI, "")
+			}
+			cacheTestUplink(p, testDevEUI, testGatewayID)
+			events := subscribeSync(t, srv, "downlink.*.*")
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}, "confirmed": true, "id": "frame-1"})
+			p.handleDeviceDownlinkRequest(&nats.Msg{Subject: "ns.device." + testDevEUI.String() + ".tx", Data: data})
+			if tt.ack != "" {
+				p.handleGatewayTxAck(&nats.Msg{
+					Subject: "gateway." + testGatewayID + ".txack",
+					Data:    []byte(`{"token":1,"ack":` + tt.ack + `}`),
+				})
+			}
+			if tt.acked {
+				device, _ := store.GetDevice(context.Background(), testDevEUI)
+				p.markLastDownlinkAcked(device)
+			}
+
+			var got []models.EventType
+			for {
+				msg, err := events.NextMsg(100 * time.Millisecond)
+				if err != nil {
+					break
+				}
+				var event models.DownlinkEvent
+				json.Unmarshal(msg.Data, &event)
+				if event.ID != "frame-1" || event.DevEUI != testDevEUI.String() {
+					t.Errorf("%s event = %+v, want frame-1 of %s", event.Type, event, testDevEUI)
+				}
+				if want := "downlink." + testDevEUI.String() + "." + strings.ToLower(string(event.Type)); msg.Subject != want {
+					t.Errorf("subject = %s, want %s", msg.Subject, want)
+				}
+				got = append(got, event.Type)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownlinkRequestReply(t *testing.T) {
+	tests := []struct {
+		name       string
+		queueGroup string
+		cached     bool
+		want       downlinkRequestReply
+	}{
+		{"scheduled", "", true, downlinkRequestReply{ID: "frame-1", Status: "scheduled"}},
+		{"no gateway", "", false, downlinkRequestReply{ID: "frame-1", Status: "failed", Error: "no gateway for device"}},
+		// 多实例部署时没有上行缓存的实例也要回复，请求方不必等到超时
+		{"no uplink cache on this instance", "network-server", false, downlinkRequestReply{
+			ID: "frame-1", Status: "failed", Error: "no uplink cache for device on this instance"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.NATS.QueueGroup = tt.queueGroup
+			p, store, srv := newTestProcessor(t, cfg)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			if tt.cached {
+				cacheTestUplink(p, testDevEUI, testGatewayID)
+			}
+
+			nc := srv.Conn(t)
+			subject := "ns.device." + testDevEUI.String() + ".tx"
+			if _, err := nc.Subscribe(subject, p.handleDeviceDownlinkRequest); err != nil {
+				t.Fatal(err)
+			}
+			nc.Flush()
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}, "id": "frame-1"})
+			msg, err := srv.Conn(t).Request(subject, data, time.Second)
+			if err != nil {
+				t.Fatalf("no reply: %v", err)
+			}
+			var got downlinkRequestReply
+			if err := json.Unmarshal(msg.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("reply = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// dutyCycleWindow 占空比统计窗口
+const dutyCycleWindow = time.Hour
+
+type airtimeEntry struct {
+	at      time.Time
+	airtime time.Duration
+}
+
+// dutyCycleTracker 按网关统计最近一小时的下行空中时间
+type dutyCycleTracker struct {
+	mu       sync.Mutex
+	gateways map[string][]airtimeEntry
+}
+
+func newDutyCycleTracker() *dutyCycleTracker {
+	return &dutyCycleTracker{gateways: make(map[string][]airtimeEntry)}
+}
+
+// Record 记录一次下行的空中时间
+func (d *dutyCycleTracker) Record(gatewayID string, airtime time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.gateways[gatewayID] = append(d.expire(gatewayID, time.Now()), airtimeEntry{at: time.Now(), airtime: airtime})
+}
+
+// Allow 判断网关再发射 airtime 后是否仍在占空比限制内，percent <= 0 表示不限制
+func (d *dutyCycleTracker) Allow(gatewayID string, airtime time.Duration, percent int) bool {
+	if percent <= 0 {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	used := airtime
+	for _, e := range d.expire(gatewayID, time.Now()) {
+		used += e.airtime
+	}
+	return used <= dutyCycleWindow*time.Duration(percent)/100
+}
+
+// expire 丢弃窗口外的记录，调用方持有锁
+func (d *dutyCycleTracker) expire(gatewayID string, now time.Time) []airtimeEntry {
+	entries := d.gateways[gatewayID]
+	i := 0
+	for i < len(entries) && now.Sub(entries[i].at) > dutyCycleWindow {
+		i++
+	}
+	entries = entries[i:]
+	if len(entries) == 0 {
+		delete(d.gateways, gatewayID)
+	} else {
+		d.gateways[gatewayID] = entries
+	}
+	return entries
+}
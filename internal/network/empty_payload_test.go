@@ -0,0 +1,62 @@
+package network
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestEmptyPayloadUplink(t *testing.T) {
+	fPort := uint8(5)
+
+	tests := []struct {
+		name      string
+		mode      string
+		payload   []byte
+		forwarded bool
+		empty     bool
+	}{
+		{"empty payload forwarded", "", nil, true, true},
+		{"empty payload forward mode", "forward", nil, true, true},
+		{"empty payload dropped", "drop", nil, false, false},
+		{"payload not affected by drop", "drop", []byte{1, 2, 3}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.EmptyPayloadUplinks = tt.mode
+			p, store, srv := newTestProcessor(t, cfg)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			sub := subscribeSync(t, srv, "application.*.device.*.rx")
+
+			p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, tt.payload), testGatewayID, testRxInfo())
+
+			msg, err := sub.NextMsg(200 * time.Millisecond)
+			if (err == nil) != tt.forwarded {
+				t.Fatalf("forwarded = %v, want %v", err == nil, tt.forwarded)
+			}
+			if !tt.forwarded {
+				return
+			}
+
+			var up struct {
+				FPort *uint8          `json:"fPort"`
+				Data  json.RawMessage `json:"data"`
+				Empty bool            `json:"empty"`
+			}
+			json.Unmarshal(msg.Data, &up)
+			if up.FPort == nil || *up.FPort != fPort || up.Empty != tt.empty {
+				t.Errorf("uplink fPort %v empty %v, want %d %v", up.FPort, up.Empty, fPort, tt.empty)
+			}
+			// 空负载的 data 为空数组而不是 null
+			if tt.empty && string(up.Data) != `""` {
+				t.Errorf("data = %s, want empty", up.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestEU868DownlinkFrequencyAndDR(t *testing.T) {
+	tests := []struct {
+		name     string
+		class    models.DeviceClass
+		datr     string
+		offset   uint8
+		wantFreq float64
+		wantDatR models.DataRateID
+	}{
+		// RX1 在上行信道，按 RX1 DR 偏移表降低速率
+		{"RX1", models.DeviceClassA, "SF9BW125", 0, 868.3, "SF9BW125"},
+		{"RX1 offset", models.DeviceClassA, "SF9BW125", 2, 868.3, "SF11BW125"},
+		{"RX1 offset clamped to DR0", models.DeviceClassA, "SF9BW125", 5, 868.3, "SF12BW125"},
+		{"RX1 SF7BW250", models.DeviceClassA, "SF7BW250", 1, 868.3, "SF7BW125"},
+		// C 类下行在 RX2：869.525 MHz DR0
+		{"RX2", models.DeviceClassC, "SF9BW125", 0, 869.525, "SF12BW125"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.Band = "EU868"
+			p, store, srv := newTestProcessor(t, cfg)
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "eu868", DeviceClass: tt.class}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+
+			session := saveTestSession(t, store, testDevEUI, "")
+			session.RX1DROffset = tt.offset
+			store.SaveDeviceSession(ctx, session)
+
+			rxInfo := testRxInfo()
+			rxInfo["freq"], rxInfo["datr"] = 868.3, tt.datr
+			p.updateDeviceRxCache(testDevEUI, testGatewayID, rxInfo)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}})
+			p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if tx.TXPK.Freq != tt.wantFreq || tx.TXPK.DatR != tt.wantDatR {
+				t.Errorf("txpk freq, datr = %v, %s, want %v, %s", tx.TXPK.Freq, tx.TXPK.DatR, tt.wantFreq, tt.wantDatR)
+			}
+		})
+	}
+}
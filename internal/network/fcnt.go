@@ -0,0 +1,35 @@
+package network
+
+import (
+	"context"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// advanceFCntUp 在数据库中把会话的 FCntUp 从 last 条件更新为 fCnt，并标记已收到上行。
+// received 为读取会话时是否已收到过上行，入网后第一帧 FCnt=0 被接受后，重放的 FCnt=0 不再匹配。
+// 数据库中的计数器已不是 last（读取会话后同一帧已被接受）时按重放丢弃；更新失败时同样丢弃，宁可漏收也不重复接受。
+func (p *Processor) advanceFCntUp(ctx context.Context, session *models.DeviceSession, last uint32, received bool, fCnt uint32) bool {
+	devEUI := lorawan.EUI64(session.DevEUI)
+	ok, err := p.store.AdvanceDeviceSessionFCntUp(ctx, devEUI, last, received, fCnt)
+	if err != nil {
+		logging.Ctx(ctx).Error().
+			Err(err).
+			Str("devEUI", devEUI.String()).
+			Uint32("fCnt", fCnt).
+			Msg("更新帧计数器失败，丢弃上行")
+		return false
+	}
+	if !ok {
+		p.setFrameResult(ctx, "fcnt replay")
+		logging.Ctx(ctx).Warn().
+			Str("devEUI", devEUI.String()).
+			Uint32("received", fCnt).
+			Uint32("last", last).
+			Msg("帧计数器已被更新，丢弃重放的上行")
+		return false
+	}
+	return true
+}
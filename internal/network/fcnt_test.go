@@ -0,0 +1,66 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestUplinkFCntWidth(t *testing.T) {
+	fPort := uint8(1)
+
+	tests := []struct {
+		name          string
+		supports32Bit bool
+		fCntUp        uint32
+		micFCnt       uint32 // 设备计算 MIC 使用的计数器，低 16 位随帧发送
+		accepted      bool
+		wantFCntUp    uint32
+	}{
+		{"32-bit just under rollover", true, 0xFFFE, 0xFFFF, true, 0xFFFF},
+		{"32-bit rollover", true, 0xFFFF, 0x10000, true, 0x10000},
+		{"32-bit after rollover", true, 0x10000, 0x10001, true, 0x10001},
+		{"32-bit device with 16-bit MIC", true, 0xFFFF, 0, false, 0xFFFF},
+		{"16-bit just under rollover", false, 0xFFFE, 0xFFFF, true, 0xFFFF},
+		{"16-bit rollover", false, 0xFFFF, 0, true, 0},
+		{"16-bit after rollover", false, 0, 1, true, 1},
+		{"16-bit device with 32-bit MIC", false, 0xFFFF, 0x10000, false, 0xFFFF},
+		{"16-bit step back within gap", false, 0x7FFF, 0, false, 0x7FFF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", Supports32BitFCnt: tt.supports32Bit}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+
+			session := saveTestSession(t, store, testDevEUI, "")
+			session.FCntUp = tt.fCntUp
+			session.UplinkReceived = true
+			store.SaveDeviceSession(ctx, session)
+			sub := subscribeSync(t, srv, "application.*.device.*.rx")
+
+			p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, tt.micFCnt, &fPort, []byte{1}), testGatewayID, testRxInfo())
+
+			_, err := sub.NextMsg(200 * time.Millisecond)
+			if (err == nil) != tt.accepted {
+				t.Fatalf("accepted = %v, want %v", err == nil, tt.accepted)
+			}
+			got, err := store.GetDeviceSession(ctx, testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.FCntUp != tt.wantFCntUp {
+				t.Errorf("FCntUp = %#x, want %#x", got.FCntUp, tt.wantFCntUp)
+			}
+		})
+	}
+}
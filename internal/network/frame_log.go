@@ -0,0 +1,76 @@
+package network
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// 上行处理结果保留时间，handleGatewayRX 返回时读取
+const frameResultTTL = 30 * time.Second
+
+// 帧日志中的处理结果
+const (
+	frameResultOK        = "ok"
+	frameResultDuplicate = "duplicate"
+)
+
+// setFrameResult 记录当前上行的处理结果（拒绝原因），写入帧日志；未启用帧日志时不记录
+func (p *Processor) setFrameResult(ctx context.Context, result string) {
+	if p.frameLog == nil {
+		return
+	}
+	if traceID := logging.TraceID(ctx); traceID != "" {
+		p.frameResults.Set(traceID, result, frameResultTTL)
+	}
+}
+
+// logUplinkFrame 把上行写入帧日志，结果取处理过程中 setFrameResult 记录的值，没有时为 ok
+func (p *Processor) logUplinkFrame(gatewayID string, phyBytes []byte, rxpk models.RXPacket, traceID, result string) {
+	if p.frameLog == nil {
+		return
+	}
+
+	if result == "" {
+		result = frameResultOK
+		if v, ok := p.frameResults.Get(traceID); ok {
+			result, _ = v.(string)
+		}
+	}
+
+	rssi := int(rxpk.RSSI)
+	snr := rxpk.LSNR
+	p.frameLog.Log(&models.FrameLog{
+		Direction:  models.FrameDirectionUplink,
+		GatewayID:  gatewayID,
+		PHYPayload: hex.EncodeToString(phyBytes),
+		Frequency:  rxpk.Freq,
+		DataRate:   string(rxpk.DatR),
+		RSSI:       &rssi,
+		SNR:        &snr,
+		Result:     result,
+		TraceID:    traceID,
+	})
+}
+
+// logDownlinkFrame 把发往网关的下行写入帧日志，result 为发送方式
+func (p *Processor) logDownlinkFrame(ctx context.Context, gatewayID string, txpk models.TXPacket, result string) {
+	if p.frameLog == nil {
+		return
+	}
+
+	phyBytes, _ := base64.StdEncoding.DecodeString(txpk.Data)
+	p.frameLog.Log(&models.FrameLog{
+		Direction:  models.FrameDirectionDownlink,
+		GatewayID:  gatewayID,
+		PHYPayload: hex.EncodeToString(phyBytes),
+		Frequency:  txpk.Freq,
+		DataRate:   string(txpk.DatR),
+		Result:     result,
+		TraceID:    logging.TraceID(ctx),
+	})
+}
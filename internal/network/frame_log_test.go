@@ -0,0 +1,128 @@
+package network
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// publishTestRX 以网关桥消息的形式交给处理器
+func publishTestRX(t *testing.T, p *Processor, phyBytes []byte, traceID string) {
+	t.Helper()
+
+	data, _ := json.Marshal(models.GatewayRXMessage{
+		GatewayID: testGatewayID,
+		RXPK:      models.RXPacket{Tmst: 100000000, Freq: 470.3, DatR: "SF7BW125", CodR: "4/5", RSSI: -60, LSNR: 9.5, Data: base64.StdEncoding.EncodeToString(phyBytes)},
+		TraceID:   traceID,
+	})
+	p.handleGatewayRX(&nats.Msg{Subject: "gateway." + testGatewayID + ".rx", Data: data})
+}
+
+func TestFrameLogRecordsFrames(t *testing.T) {
+	fPort := uint8(1)
+
+	type frame struct {
+		direction string
+		result    string // 前缀匹配
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		uplinks func(t *testing.T) [][]byte
+		want    []frame
+	}{
+		{
+			// 确认上行及其 ACK
+			name:    "uplink and downlink",
+			enabled: true,
+			uplinks: func(t *testing.T) [][]byte {
+				phy, _ := newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1}).MarshalBinary()
+				return [][]byte{phy}
+			},
+			want: []frame{{models.FrameDirectionDownlink, "scheduled: "}, {models.FrameDirectionUplink, frameResultOK}},
+		},
+		{
+			name:    "duplicate",
+			enabled: true,
+			uplinks: func(t *testing.T) [][]byte {
+				phy, _ := newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1}).MarshalBinary()
+				return [][]byte{phy, phy}
+			},
+			want: []frame{{models.FrameDirectionUplink, frameResultOK}, {models.FrameDirectionUplink, frameResultDuplicate}},
+		},
+		{
+			name:    "MIC failure",
+			enabled: true,
+			uplinks: func(t *testing.T) [][]byte {
+				phy, _ := newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1}).MarshalBinary()
+				phy[len(phy)-1] ^= 0xff
+				return [][]byte{phy}
+			},
+			want: []frame{{models.FrameDirectionUplink, models.DeviceErrorMICFailure}},
+		},
+		{
+			name:    "invalid PHYPayload",
+			enabled: true,
+			uplinks: func(t *testing.T) [][]byte { return [][]byte{{0x40}} },
+			want:    []frame{{models.FrameDirectionUplink, "invalid PHYPayload: "}},
+		},
+		{
+			name:    "disabled",
+			enabled: false,
+			uplinks: func(t *testing.T) [][]byte {
+				phy, _ := newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1}).MarshalBinary()
+				return [][]byte{phy}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Log.FrameLog = config.FrameLogConfig{Enabled: tt.enabled, Sink: config.FrameLogSinkDatabase}
+			p, store, _ := newTestProcessor(t, cfg)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+
+			uplinks := tt.uplinks(t)
+			for _, phy := range uplinks {
+				publishTestRX(t, p, phy, "0123456789abcdef")
+			}
+			// 关闭时写完队列中的记录
+			if err := p.frameLog.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			records := store.FrameLogs()
+			if len(records) != len(tt.want) {
+				t.Fatalf("%d frames logged, want %d: %+v", len(records), len(tt.want), records)
+			}
+			for i, rec := range records {
+				want := tt.want[i]
+				if rec.Direction != want.direction || !strings.HasPrefix(rec.Result, want.result) {
+					t.Errorf("frame %d = %s %q, want %s %q", i, rec.Direction, rec.Result, want.direction, want.result)
+				}
+				if rec.GatewayID != testGatewayID || rec.TraceID != "0123456789abcdef" || rec.Time.IsZero() || rec.Frequency == 0 || rec.DataRate == "" {
+					t.Errorf("frame %d = %+v", i, rec)
+				}
+				if rec.Direction == models.FrameDirectionUplink {
+					if rec.PHYPayload != hex.EncodeToString(uplinks[0]) && rec.PHYPayload != hex.EncodeToString(uplinks[len(uplinks)-1]) {
+						t.Errorf("frame %d PHYPayload = %s", i, rec.PHYPayload)
+					}
+					if rec.RSSI == nil || *rec.RSSI != -60 || rec.SNR == nil || *rec.SNR != 9.5 {
+						t.Errorf("frame %d RSSI %v SNR %v, want -60 9.5", i, rec.RSSI, rec.SNR)
+					}
+				}
+			}
+		})
+	}
+}
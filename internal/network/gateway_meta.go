@@ -0,0 +1,112 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// 网关元数据缓存时间，标签修改后最多延迟这么久出现在上行中
+const gatewayMetaTTL = time.Minute
+
+// gatewayMeta 随上行转发给应用的网关元数据
+type gatewayMeta struct {
+	Name     string
+	Labels   models.Variables
+	Location *models.Location
+
+	// 网关可发送的频率范围（Hz），0 表示未配置
+	MinFrequency uint32
+	MaxFrequency uint32
+
+	// 各射频链的发送频率范围，为空时下行固定使用 rfch 0
+	Radios models.GatewayRadios
+}
+
+// canTransmit 网关是否能在该频率发送，未配置频率范围时视为可以
+func (m *gatewayMeta) canTransmit(freq uint32) bool {
+	if m == nil {
+		return true
+	}
+	if m.MinFrequency != 0 && freq < m.MinFrequency {
+		return false
+	}
+	if m.MaxFrequency != 0 && freq > m.MaxFrequency {
+		return false
+	}
+	if len(m.Radios) > 0 {
+		_, ok := m.Radios.RFChain(freq)
+		return ok
+	}
+	return true
+}
+
+// rfChain 返回在该频率发送的射频链，未配置或没有匹配的射频链时使用 rfch 0
+func (m *gatewayMeta) rfChain(freq uint32) uint8 {
+	if m == nil {
+		return 0
+	}
+	rfCh, _ := m.Radios.RFChain(freq)
+	return rfCh
+}
+
+// getGatewayMeta 获取网关元数据，未注册的网关返回 nil
+func (p *Processor) getGatewayMeta(ctx context.Context, gatewayID string) *gatewayMeta {
+	if v, ok := p.gatewayCache.Get(gatewayID); ok {
+		meta, _ := v.(*gatewayMeta)
+		return meta
+	}
+
+	id, err := lorawan.ParseGatewayID(gatewayID)
+	if err != nil {
+		return nil
+	}
+
+	var meta *gatewayMeta
+	gateway, err := p.store.GetGateway(ctx, id)
+	switch {
+	case err == nil:
+		meta = &gatewayMeta{
+			Name:     gateway.Name,
+			Labels:   gateway.Labels,
+			Location: gateway.Location,
+
+			MinFrequency: gateway.MinFrequency,
+			MaxFrequency: gateway.MaxFrequency,
+			Radios:       gateway.Radios,
+		}
+	case err != storage.ErrNotFound:
+		// 查询失败不缓存，下次上行重试
+		log.Warn().Err(err).Str("gateway", gatewayID).Msg("获取网关信息失败")
+		return nil
+	}
+
+	// 未注册的网关也缓存，避免每个上行都查库
+	p.gatewayCache.Set(gatewayID, meta, gatewayMetaTTL)
+	return meta
+}
+
+// uplinkRxInfo 为转发给应用的 rxInfo 附加网关 ID、名称、标签和位置
+func (p *Processor) uplinkRxInfo(ctx context.Context, gatewayID string, rxInfo map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(rxInfo)+4)
+	for k, v := range rxInfo {
+		out[k] = v
+	}
+	out["gatewayID"] = gatewayID
+
+	if meta := p.getGatewayMeta(ctx, gatewayID); meta != nil {
+		out["gatewayName"] = meta.Name
+		if len(meta.Labels) > 0 {
+			out["labels"] = meta.Labels
+		}
+		if meta.Location != nil {
+			out["location"] = meta.Location
+		}
+	}
+	return out
+}
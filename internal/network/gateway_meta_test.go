@@ -0,0 +1,74 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestUplinkGatewayMetadata(t *testing.T) {
+	gatewayEUI := models.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	location := &models.Location{Latitude: 31.2304, Longitude: 121.4737, Altitude: 12}
+
+	tests := []struct {
+		name     string
+		gateway  *models.Gateway // nil 表示未注册的网关
+		wantName string
+		labels   map[string]interface{}
+		location *models.Location
+	}{
+		{"labels and location", &models.Gateway{GatewayID: gatewayEUI, Name: "roof", Labels: models.Variables{"site": "sh-01", "floor": "12"}, Location: location},
+			"roof", map[string]interface{}{"site": "sh-01", "floor": "12"}, location},
+		{"no labels", &models.Gateway{GatewayID: gatewayEUI, Name: "basement"}, "basement", nil, nil},
+		{"unregistered gateway", nil, "", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			if tt.gateway != nil {
+				if err := store.CreateGateway(context.Background(), tt.gateway); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sub := subscribeSync(t, srv, "application.*.device.*.rx")
+
+			fPort := uint8(1)
+			p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+
+			msg, err := sub.NextMsg(time.Second)
+			if err != nil {
+				t.Fatal("uplink not forwarded")
+			}
+			var up struct {
+				RxInfo []struct {
+					GatewayID   string                 `json:"gatewayID"`
+					GatewayName string                 `json:"gatewayName"`
+					Labels      map[string]interface{} `json:"labels"`
+					Location    *models.Location       `json:"location"`
+					RSSI        float64                `json:"rssi"`
+				} `json:"rxInfo"`
+			}
+			if err := json.Unmarshal(msg.Data, &up); err != nil || len(up.RxInfo) != 1 {
+				t.Fatalf("rxInfo = %s", msg.Data)
+			}
+			rx := up.RxInfo[0]
+			if rx.GatewayID != testGatewayID || rx.GatewayName != tt.wantName || rx.RSSI != -60 {
+				t.Errorf("rxInfo gateway %s name %q rssi %v, want %s %q -60", rx.GatewayID, rx.GatewayName, rx.RSSI, testGatewayID, tt.wantName)
+			}
+			if !reflect.DeepEqual(rx.Labels, tt.labels) {
+				t.Errorf("labels = %v, want %v", rx.Labels, tt.labels)
+			}
+			if !reflect.DeepEqual(rx.Location, tt.location) {
+				t.Errorf("location = %+v, want %+v", rx.Location, tt.location)
+			}
+		})
+	}
+}
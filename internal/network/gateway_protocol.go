@@ -0,0 +1,44 @@
+package network
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// checkGatewayProtocol 检查网关桥消息版本，不认识的新版本每个网关只告警一次，仍尝试按当前格式处理
+func (p *Processor) checkGatewayProtocol(gatewayID string, version int) {
+	if models.GatewayProtocolCompatible(version) {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d", gatewayID, version)
+	if _, warned := p.protocolWarned.LoadOrStore(key, true); warned {
+		return
+	}
+	log.Warn().
+		Str("gateway", gatewayID).
+		Int("version", version).
+		Int("supported", models.GatewayProtocolVersion).
+		Msg("网关桥消息版本高于网络服务器支持的版本，请升级网络服务器")
+}
+
+// loraTXPacket 构建 LoRa 下行 txpk（天线 0、19dBm、反转极性），发送时机由调用方设置
+func loraTXPacket(freq float64, rfCh uint8, dataRate, codeRate string, phyBytes []byte) models.TXPacket {
+	return models.TXPacket{
+		RFCh: int(rfCh),
+		Powe: 19,
+		Ant:  0,
+		Brd:  0,
+		Freq: freq,
+		Modu: "LORA",
+		DatR: models.DataRateID(dataRate),
+		CodR: codeRate,
+		IPol: true,
+		Size: len(phyBytes),
+		Data: base64.StdEncoding.EncodeToString(phyBytes),
+	}
+}
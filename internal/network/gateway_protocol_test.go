@@ -0,0 +1,55 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+func TestCheckGatewayProtocol(t *testing.T) {
+	const warning = "网关桥消息版本高于网络服务器支持的版本，请升级网络服务器"
+	newer := models.GatewayProtocolVersion + 1
+
+	type message struct {
+		gatewayID string
+		version   int
+	}
+
+	tests := []struct {
+		name         string
+		messages     []message
+		wantWarnings int
+	}{
+		{"legacy and current", []message{{"gw1", 0}, {"gw1", models.GatewayProtocolVersion}}, 0},
+		// 每个网关每个版本只告警一次
+		{"newer version", []message{{"gw1", newer}, {"gw1", newer}, {"gw1", newer}}, 1},
+		{"newer version on two gateways", []message{{"gw1", newer}, {"gw2", newer}, {"gw1", newer}}, 2},
+		{"two newer versions", []message{{"gw1", newer}, {"gw1", newer + 1}}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureFrameLogs(t)
+			p, _, _ := newTestProcessor(t, nil)
+
+			for _, m := range tt.messages {
+				p.checkGatewayProtocol(m.gatewayID, m.version)
+			}
+
+			warnings := 0
+			for _, line := range bytes.Split(logs.Bytes(), []byte("\n")) {
+				var entry struct {
+					Message string `json:"message"`
+				}
+				if json.Unmarshal(line, &entry) == nil && entry.Message == warning {
+					warnings++
+				}
+			}
+			if warnings != tt.wantWarnings {
+				t.Errorf("%d version warnings, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// defaultJoinCollectWindow 未配置 join_collect_window 时的 JOIN 副本收集时间
+const defaultJoinCollectWindow = 200 * time.Millisecond
+
+// gatewayCandidate 收到同一上行的一个网关
+type gatewayCandidate struct {
+	GatewayID string
+	RSSI      float64
+	SNR       float64
+	RxInfo    map[string]interface{}
+}
+
+// gatewayCandidates 同一上行（DevAddr+FCnt+MIC）的全部接收网关，去重时收集
+type gatewayCandidates struct {
+	mu   sync.Mutex
+	list []gatewayCandidate
+}
+
+func newGatewayCandidates(gatewayID string, rxInfo map[string]interface{}) *gatewayCandidates {
+	c := &gatewayCandidates{}
+	c.add(gatewayID, rxInfo)
+	return c
+}
+
+func (c *gatewayCandidates) add(gatewayID string, rxInfo map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, existing := range c.list {
+		if existing.GatewayID == gatewayID {
+			return
+		}
+	}
+	c.list = append(c.list, gatewayCandidate{
+		GatewayID: gatewayID,
+		RSSI:      getFloat64(rxInfo, "rssi"),
+		SNR:       getFloat64(rxInfo, "lsnr"),
+		RxInfo:    rxInfo,
+	})
+}
+
+// ranked 按 SNR 降序、RSSI 降序排列候选网关，返回副本
+func (c *gatewayCandidates) ranked() []gatewayCandidate {
+	c.mu.Lock()
+	ranked := append([]gatewayCandidate(nil), c.list...)
+	c.mu.Unlock()
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].SNR != ranked[j].SNR {
+			return ranked[i].SNR > ranked[j].SNR
+		}
+		return ranked[i].RSSI > ranked[j].RSSI
+	})
+	return ranked
+}
+
+// selectionReason 说明为什么第一名胜出
+func selectionReason(ranked []gatewayCandidate) string {
+	switch {
+	case len(ranked) == 1:
+		return "only candidate"
+	case ranked[0].SNR != ranked[1].SNR:
+		return "best SNR"
+	case ranked[0].RSSI != ranked[1].RSSI:
+		return "best RSSI"
+	default:
+		return "first received"
+	}
+}
+
+// selectDownlinkGateway 在收到设备最近上行的网关中选择信号最好的一个作为下行网关，
+// 并更新设备上行缓存，使下行使用该网关的时间戳
+func (p *Processor) selectDownlinkGateway(devEUI lorawan.EUI64) {
+	p.rxCacheMutex.Lock()
+	info, ok := p.deviceRxCache[devEUI]
+	if !ok || info.Candidates == nil {
+		p.rxCacheMutex.Unlock()
+		return
+	}
+
+	ranked := info.Candidates.ranked()
+	if len(ranked) == 0 {
+		p.rxCacheMutex.Unlock()
+		return
+	}
+	best := ranked[0]
+	info.GatewayID = best.GatewayID
+	info.RxInfo = best.RxInfo
+	p.rxCacheMutex.Unlock()
+
+	p.logGatewaySelection(devEUI, ranked, "下行网关选择")
+}
+
+// logGatewaySelection 按 gateway_selection_log 配置记录候选网关和选择结果
+func (p *Processor) logGatewaySelection(devEUI lorawan.EUI64, ranked []gatewayCandidate, msg string) {
+	if !p.config.Network.GatewaySelectionLog {
+		return
+	}
+
+	candidates := zerolog.Arr()
+	for _, c := range ranked {
+		candidates.Dict(zerolog.Dict().
+			Str("gatewayID", c.GatewayID).
+			Float64("rssi", c.RSSI).
+			Float64("snr", c.SNR))
+	}
+	logging.Frame().Debug().
+		Str("devEUI", devEUI.String()).
+		Array("candidates", candidates).
+		Str("selected", ranked[0].GatewayID).
+		Str("reason", selectionReason(ranked)).
+		Msg(msg)
+}
+
+// joinCollectWindow JOIN 首个副本到达后等待其他网关副本的时间
+func (p *Processor) joinCollectWindow() time.Duration {
+	if p.config.Network.JoinCollectWindow > 0 {
+		return p.config.Network.JoinCollectWindow
+	}
+	return defaultJoinCollectWindow
+}
+
+// selectJoinGateway 等到收集窗口结束，在收到 JOIN 的网关中选择信号最好的一个发送 JOIN ACCEPT
+func (p *Processor) selectJoinGateway(devEUI lorawan.EUI64, candidates *gatewayCandidates, receivedAt time.Time) (string, map[string]interface{}) {
+	if wait := p.joinCollectWindow() - time.Since(receivedAt); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	ranked := candidates.ranked()
+	p.logGatewaySelection(devEUI, ranked, "JOIN ACCEPT 网关选择")
+	return ranked[0].GatewayID, ranked[0].RxInfo
+}
+
+// setRxCandidates 把最近上行的候选网关关联到设备上行缓存
+func (p *Processor) setRxCandidates(devEUI lorawan.EUI64, candidates *gatewayCandidates) {
+	p.rxCacheMutex.Lock()
+	if info, ok := p.deviceRxCache[devEUI]; ok {
+		info.Candidates = candidates
+	}
+	p.rxCacheMutex.Unlock()
+}
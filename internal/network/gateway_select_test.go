@@ -0,0 +1,198 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+)
+
+// captureFrameLogs 把逐帧日志写入缓冲区直到测试结束
+func captureFrameLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	logging.SetFrameSampling(0)
+	t.Cleanup(func() {
+		log.Logger = saved
+		logging.SetFrameSampling(0)
+	})
+	return &buf
+}
+
+// findLogLine 返回第一条 message 为 msg 的日志，其他测试遗留的 goroutine 也可能写日志
+func findLogLine(buf *bytes.Buffer, msg string) []byte {
+	for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+		var entry struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(line, &entry) == nil && entry.Message == msg {
+			return line
+		}
+	}
+	return nil
+}
+
+func TestDownlinkGatewaySelectionLog(t *testing.T) {
+	type rx struct {
+		gatewayID string
+		rssi, snr float64
+	}
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		received   []rx
+		wantWinner string
+		wantReason string
+	}{
+		{"only candidate", true, []rx{{"aa00000000000001", -90, 5}}, "aa00000000000001", "only candidate"},
+		{"best SNR", true, []rx{{"aa00000000000001", -60, 2}, {"aa00000000000002", -100, 7.5}, {"aa00000000000003", -80, -3}}, "aa00000000000002", "best SNR"},
+		{"best RSSI", true, []rx{{"aa00000000000001", -95, 5}, {"aa00000000000002", -70, 5}}, "aa00000000000002", "best RSSI"},
+		{"first received", true, []rx{{"aa00000000000001", -70, 5}, {"aa00000000000002", -70, 5}}, "aa00000000000001", "first received"},
+		{"disabled", false, []rx{{"aa00000000000001", -60, 2}, {"aa00000000000002", -100, 7.5}}, "aa00000000000002", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.GatewaySelectionLog = tt.enabled
+			p, _, _ := newTestProcessor(t, cfg)
+			logs := captureFrameLogs(t)
+
+			var candidates *gatewayCandidates
+			for _, r := range tt.received {
+				rxInfo := map[string]interface{}{"rssi": r.rssi, "lsnr": r.snr}
+				if candidates == nil {
+					candidates = newGatewayCandidates(r.gatewayID, rxInfo)
+				} else {
+					candidates.add(r.gatewayID, rxInfo)
+				}
+			}
+			p.deviceRxCache[testDevEUI] = &DeviceRxInfo{
+				GatewayID:  tt.received[0].gatewayID,
+				Timestamp:  time.Now(),
+				Candidates: candidates,
+			}
+
+			p.selectDownlinkGateway(testDevEUI)
+
+			if got := p.deviceRxCache[testDevEUI].GatewayID; got != tt.wantWinner {
+				t.Errorf("downlink gateway = %s, want %s", got, tt.wantWinner)
+			}
+			line := findLogLine(logs, "下行网关选择")
+			if !tt.enabled {
+				if line != nil {
+					t.Errorf("selection logged while disabled: %s", line)
+				}
+				return
+			}
+
+			var entry struct {
+				Level      string `json:"level"`
+				DevEUI     string `json:"devEUI"`
+				Selected   string `json:"selected"`
+				Reason     string `json:"reason"`
+				Candidates []struct {
+					GatewayID string  `json:"gatewayID"`
+					RSSI      float64 `json:"rssi"`
+					SNR       float64 `json:"snr"`
+				} `json:"candidates"`
+			}
+			if err := json.Unmarshal(line, &entry); err != nil {
+				t.Fatalf("no selection log in %q", logs)
+			}
+			if entry.Level != "debug" || entry.DevEUI != testDevEUI.String() || entry.Selected != tt.wantWinner || entry.Reason != tt.wantReason {
+				t.Errorf("log = %+v", entry)
+			}
+
+			// 日志列出全部候选网关及其信号
+			if len(entry.Candidates) != len(tt.received) {
+				t.Fatalf("logged %d candidates, want %d", len(entry.Candidates), len(tt.received))
+			}
+			for _, r := range tt.received {
+				found := false
+				for _, c := range entry.Candidates {
+					if c.GatewayID == r.gatewayID && c.RSSI == r.rssi && c.SNR == r.snr {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("candidate %s (rssi %v, snr %v) missing from log", r.gatewayID, r.rssi, r.snr)
+				}
+			}
+			if entry.Candidates[0].GatewayID != tt.wantWinner {
+				t.Errorf("first logged candidate = %s, want the winner", entry.Candidates[0].GatewayID)
+			}
+		})
+	}
+}
+
+func TestJoinAcceptBestGateway(t *testing.T) {
+	type joinCopy struct {
+		gatewayID string
+		rssi      float64
+		snr       float64
+		delay     time.Duration // 距首个副本的到达时间
+	}
+
+	tests := []struct {
+		name        string
+		copies      []joinCopy
+		wantGateway string
+	}{
+		{"single gateway", []joinCopy{{"0102030405060701", -110, -5, 0}}, "0102030405060701"},
+		{"best SNR", []joinCopy{{"0102030405060701", -110, -5, 0}, {"0102030405060702", -90, 8, 0}, {"0102030405060703", -80, 2, 0}}, "0102030405060702"},
+		{"same SNR best RSSI", []joinCopy{{"0102030405060701", -110, 5, 0}, {"0102030405060702", -100, 5, 0}, {"0102030405060703", -70, 5, 0}}, "0102030405060703"},
+		// 收集窗口结束后到达的副本不参与选择
+		{"copy after window", []joinCopy{{"0102030405060701", -110, -5, 0}, {"0102030405060702", -60, 10, 300 * time.Millisecond}}, "0102030405060701"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.JoinCollectWindow = 100 * time.Millisecond
+			p, store, srv := newTestProcessor(t, cfg)
+			createTestOTAADevice(t, store)
+			txs := subscribeSync(t, srv, "gateway.*.tx")
+
+			start := time.Now()
+			for _, c := range tt.copies {
+				time.Sleep(time.Until(start.Add(c.delay)))
+				rxInfo := testRxInfo()
+				rxInfo["rssi"] = c.rssi
+				rxInfo["lsnr"] = c.snr
+				p.handleJoinRequest(newTestJoinRequest(t, 0x0001), c.gatewayID, rxInfo)
+			}
+
+			// JOIN 只处理一次，只从选中的网关发送一个 JOIN ACCEPT
+			msg, err := txs.NextMsg(time.Second)
+			if err != nil {
+				t.Fatal("JOIN ACCEPT not sent")
+			}
+			if want := "gateway." + tt.wantGateway + ".tx"; msg.Subject != want {
+				t.Errorf("JOIN ACCEPT sent on %s, want %s", msg.Subject, want)
+			}
+			if extra, err := txs.NextMsg(500 * time.Millisecond); err == nil {
+				t.Errorf("extra downlink sent on %s", extra.Subject)
+			}
+
+			session, err := store.GetDeviceSession(context.Background(), testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := joinNonceOfSession(t, p, session.AppSKey, 0x0001, 4); got != 1 {
+				t.Errorf("session JoinNonce = %d, want 1", got)
+			}
+		})
+	}
+}
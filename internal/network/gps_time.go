@@ -0,0 +1,184 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// statGPSMaxAge 优先使用 tmms：最近一次 tmms 参考点在此时间内时忽略 stat.time
+const statGPSMaxAge = 10 * time.Minute
+
+// gpsReference 网关 GPS 时间参考点
+type gpsReference struct {
+	gps        time.Duration // 自 GPS 起点以来的时长
+	tmst       uint32        // 同一时刻的网关计数器（仅 tmms 来源）
+	hasTmst    bool
+	source     string // tmms / stat
+	receivedAt time.Time
+}
+
+// GPSTimeSource 根据网关上报（rxpk tmms、stat time）维护每个网关的 GPS 时间估计
+type GPSTimeSource struct {
+	mu   sync.RWMutex
+	refs map[string]*gpsReference
+}
+
+// NewGPSTimeSource creates an empty GPS time source
+func NewGPSTimeSource() *GPSTimeSource {
+	return &GPSTimeSource{refs: make(map[string]*gpsReference)}
+}
+
+// UpdateFromRX 用 rxpk 的 tmms（GPS 毫秒）和 tmst 更新参考点，精度最高
+func (g *GPSTimeSource) UpdateFromRX(gatewayID string, tmms uint64, tmst uint32, at time.Time) {
+	g.mu.Lock()
+	g.refs[gatewayID] = &gpsReference{
+		gps:        time.Duration(tmms) * time.Millisecond,
+		tmst:       tmst,
+		hasTmst:    true,
+		source:     "tmms",
+		receivedAt: at,
+	}
+	g.mu.Unlock()
+}
+
+// UpdateFromStat 用 stat.time（网关 UTC 系统时间，秒级精度）更新参考点，
+// 仅在没有较新的 tmms 参考点时生效
+func (g *GPSTimeSource) UpdateFromStat(gatewayID string, statTime string, at time.Time) error {
+	t, err := parseStatTime(statTime)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ref, ok := g.refs[gatewayID]; ok && ref.hasTmst && at.Sub(ref.receivedAt) < statGPSMaxAge {
+		return nil
+	}
+	g.refs[gatewayID] = &gpsReference{
+		gps:        lorawan.TimeToGPS(t),
+		source:     "stat",
+		receivedAt: at,
+	}
+	return nil
+}
+
+// GPSTime 返回网关在 at 时刻的 GPS 时间估计
+func (g *GPSTimeSource) GPSTime(gatewayID string, at time.Time) (time.Duration, bool) {
+	g.mu.RLock()
+	ref, ok := g.refs[gatewayID]
+	g.mu.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	return ref.gps + at.Sub(ref.receivedAt), true
+}
+
+// TmstAt 把 GPS 时间换算为网关计数器值，用于定时下行；没有 tmms 参考点时返回 false
+func (g *GPSTimeSource) TmstAt(gatewayID string, gps time.Duration) (uint32, bool) {
+	g.mu.RLock()
+	ref, ok := g.refs[gatewayID]
+	g.mu.RUnlock()
+	if !ok || !ref.hasTmst {
+		return 0, false
+	}
+	// 计数器 32 位回绕，直接截断即可
+	return ref.tmst + uint32(int64((gps-ref.gps)/time.Microsecond)), true
+}
+
+// Locked 网关是否有 tmms 参考点，即最近上报过 GPS 时间且未报告 GPS 未锁定
+func (g *GPSTimeSource) Locked(gatewayID string) bool {
+	g.mu.RLock()
+	ref, ok := g.refs[gatewayID]
+	g.mu.RUnlock()
+	return ok && ref.hasTmst
+}
+
+// LockedGateways 有 tmms 参考点的网关，即可以发送 Class B 信标的网关
+func (g *GPSTimeSource) LockedGateways() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	ids := make([]string, 0, len(g.refs))
+	for id, ref := range g.refs {
+		if ref.hasTmst {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Invalidate 丢弃网关的 GPS 参考点（网关报告 GPS 未锁定），直到收到新的 tmms 或 stat
+func (g *GPSTimeSource) Invalidate(gatewayID string) {
+	g.mu.Lock()
+	delete(g.refs, gatewayID)
+	g.mu.Unlock()
+}
+
+// gpsDownlinkTmms 上行带 tmms 且网关 GPS 参考点有效时，返回按 GPS 时间发送下行的时刻（毫秒）；
+// 否则返回 false，由调用方回退到 tmst 时序
+func (p *Processor) gpsDownlinkTmms(gatewayID string, rxInfo map[string]interface{}, delay time.Duration) (uint64, bool) {
+	tmms := getUint64(rxInfo, "tmms")
+	if tmms == 0 || delay <= 0 || !p.gpsTime.Locked(gatewayID) {
+		return 0, false
+	}
+	return tmms + uint64(delay.Milliseconds()), true
+}
+
+// parseStatTime 解析 Semtech stat.time，例如 "2014-01-12 08:59:28 GMT"
+func parseStatTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05 MST", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid stat time %q", s)
+}
+
+// handleGatewayStat 用网关 stat.time 更新 GPS 时间估计
+func (p *Processor) handleGatewayStat(msg *nats.Msg) {
+	var statMsg struct {
+		GatewayID string                 `json:"gatewayID"`
+		Stat      map[string]interface{} `json:"stat"`
+	}
+	if err := json.Unmarshal(msg.Data, &statMsg); err != nil {
+		log.Error().Err(err).Msg("解析网关 stat 失败")
+		return
+	}
+
+	statTime, ok := statMsg.Stat["time"].(string)
+	if !ok || statTime == "" {
+		return
+	}
+	if err := p.gpsTime.UpdateFromStat(statMsg.GatewayID, statTime, time.Now()); err != nil {
+		log.Debug().Err(err).Str("gateway", statMsg.GatewayID).Msg("网关 stat 时间无效")
+	}
+}
+
+// nextPingSlot 计算设备经由该网关在 notBefore（GPS 时间）之后、且距现在至少 classBMinLead 的下一个
+// Class B ping slot，返回 GPS 时间，以及可用于定时下行的网关计数器值（hasTmst 为 false 时需按 GPS 时间发送）
+func (p *Processor) nextPingSlot(gatewayID string, devAddr lorawan.DevAddr, periodicity int, notBefore time.Duration) (gps time.Duration, tmst uint32, hasTmst bool, err error) {
+	now, ok := p.gpsTime.GPSTime(gatewayID, time.Now())
+	if !ok {
+		return 0, 0, false, fmt.Errorf("网关 %s 没有 GPS 时间", gatewayID)
+	}
+	if now += classBMinLead; notBefore < now {
+		notBefore = now
+	}
+
+	gps, err = lorawan.NextPingSlot(notBefore, devAddr, periodicity)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	tmst, hasTmst = p.gpsTime.TmstAt(gatewayID, gps)
+	return gps, tmst, hasTmst, nil
+}
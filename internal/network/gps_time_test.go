@@ -0,0 +1,158 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestGPSTimeSource(t *testing.T) {
+	at := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gps := lorawan.TimeToGPS(at)
+	tmms := uint64(gps / time.Millisecond)
+
+	tests := []struct {
+		name       string
+		setup      func(g *GPSTimeSource)
+		query      time.Time
+		wantGPS    time.Duration
+		wantOK     bool
+		wantLocked bool
+	}{
+		{"unknown gateway", func(g *GPSTimeSource) {}, at, 0, false, false},
+		{"tmms reference", func(g *GPSTimeSource) {
+			g.UpdateFromRX(testGatewayID, tmms, 1000000, at)
+		}, at.Add(1500 * time.Millisecond), gps + 1500*time.Millisecond, true, true},
+		{"stat reference", func(g *GPSTimeSource) {
+			g.UpdateFromStat(testGatewayID, "2026-01-01 00:00:00 GMT", at)
+		}, at.Add(time.Second), gps + time.Second, true, false},
+		{"stat ignored while tmms is fresh", func(g *GPSTimeSource) {
+			g.UpdateFromRX(testGatewayID, tmms, 1000000, at)
+			g.UpdateFromStat(testGatewayID, "2026-01-01 00:00:30 GMT", at.Add(time.Minute))
+		}, at.Add(time.Minute), gps + time.Minute, true, true},
+		{"stat replaces stale tmms", func(g *GPSTimeSource) {
+			g.UpdateFromRX(testGatewayID, tmms, 1000000, at)
+			g.UpdateFromStat(testGatewayID, "2026-01-01 00:20:05 GMT", at.Add(20*time.Minute))
+		}, at.Add(20 * time.Minute), gps + 20*time.Minute + 5*time.Second, true, false},
+		{"invalidated", func(g *GPSTimeSource) {
+			g.UpdateFromRX(testGatewayID, tmms, 1000000, at)
+			g.Invalidate(testGatewayID)
+		}, at, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGPSTimeSource()
+			tt.setup(g)
+
+			got, ok := g.GPSTime(testGatewayID, tt.query)
+			if ok != tt.wantOK || got != tt.wantGPS {
+				t.Errorf("GPSTime() = %s, %v, want %s, %v", got, ok, tt.wantGPS, tt.wantOK)
+			}
+			if locked := g.Locked(testGatewayID); locked != tt.wantLocked {
+				t.Errorf("Locked() = %v, want %v", locked, tt.wantLocked)
+			}
+			if ids := g.LockedGateways(); (len(ids) == 1) != tt.wantLocked {
+				t.Errorf("LockedGateways() = %v", ids)
+			}
+		})
+	}
+}
+
+func TestGPSTimeSourceTmstAt(t *testing.T) {
+	gps := 1451260818 * time.Second
+
+	tests := []struct {
+		name string
+		tmst uint32
+		at   time.Duration
+		want uint32
+	}{
+		{"same instant", 1000000, gps, 1000000},
+		{"later", 1000000, gps + 2500*time.Millisecond, 3500000},
+		{"earlier", 5000000, gps - time.Second, 4000000},
+		{"counter wraps", 4294000000, gps + 2*time.Second, 1032704},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGPSTimeSource()
+			g.UpdateFromRX(testGatewayID, uint64(gps/time.Millisecond), tt.tmst, time.Now())
+
+			got, ok := g.TmstAt(testGatewayID, tt.at)
+			if !ok || got != tt.want {
+				t.Errorf("TmstAt(%s) = %d, %v, want %d", tt.at, got, ok, tt.want)
+			}
+		})
+	}
+
+	g := NewGPSTimeSource()
+	g.UpdateFromStat(testGatewayID, "2026-01-01 00:00:00 GMT", time.Now())
+	if _, ok := g.TmstAt(testGatewayID, gps); ok {
+		t.Error("TmstAt() without a tmms reference succeeded")
+	}
+}
+
+func TestParseStatTime(t *testing.T) {
+	want := time.Date(2014, time.January, 12, 8, 59, 28, 0, time.UTC)
+
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{"2014-01-12 08:59:28 GMT", false},
+		{" 2014-01-12 08:59:28 GMT ", false},
+		{"2014-01-12T08:59:28Z", false},
+		{"2014-01-12T16:59:28+08:00", false},
+		{"yesterday", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseStatTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(want) {
+			t.Errorf("parseStatTime(%q) = %s, want %s", tt.in, got, want)
+		}
+	}
+}
+
+func TestNextPingSlotFromGPSTime(t *testing.T) {
+	p, _, _ := newTestProcessor(t, nil)
+
+	if _, _, _, err := p.nextPingSlot(testGatewayID, testDevAddr, 0, 0); err == nil {
+		t.Fatal("nextPingSlot() without GPS time succeeded")
+	}
+
+	// 网关上报的 GPS 时间与本地时钟无关，时隙按网关时间计算
+	now := time.Now()
+	gps := 1451260818*time.Second + 500*time.Millisecond
+	p.gpsTime.UpdateFromRX(testGatewayID, uint64(gps/time.Millisecond), 100000000, now)
+
+	slot, tmst, hasTmst, err := p.nextPingSlot(testGatewayID, testDevAddr, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	earliest := gps + classBMinLead
+	want, _ := lorawan.NextPingSlot(earliest, testDevAddr, 3)
+	if slot < want || slot-want > 50*time.Millisecond {
+		t.Errorf("slot = %s, want %s", slot, want)
+	}
+	if wantTmst := 100000000 + uint32((slot-gps)/time.Microsecond); !hasTmst || tmst != wantTmst {
+		t.Errorf("tmst = %d, %v, want %d", tmst, hasTmst, wantTmst)
+	}
+
+	// notBefore 晚于最早可用时刻时从 notBefore 开始找
+	later := gps + 10*lorawan.BeaconPeriod
+	slot, _, _, err = p.nextPingSlot(testGatewayID, testDevAddr, 3, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := lorawan.NextPingSlot(later, testDevAddr, 3); slot != want {
+		t.Errorf("slot after notBefore = %s, want %s", slot, want)
+	}
+}
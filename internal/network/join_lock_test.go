@@ -0,0 +1,96 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// blockingSessionStore 第一次删除会话时阻塞，让 JOIN 停在持有入网锁的位置
+type blockingSessionStore struct {
+	storage.Store
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSessionStore) DeleteDeviceSession(ctx context.Context, devEUI lorawan.EUI64) error {
+	select {
+	case s.entered <- struct{}{}:
+		<-s.release
+	default:
+	}
+	return s.Store.DeleteDeviceSession(ctx, devEUI)
+}
+
+func TestConcurrentJoinAcceptedOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		concurrent    bool
+		wantAccepts   int
+		wantJoinNonce uint32 // 最终会话的 JoinNonce
+		wantDevNonce  uint16 // 最终会话所属 JOIN 的 DevNonce
+	}{
+		// 第二个 JOIN 在第一个处理中到达，被忽略
+		{"concurrent", true, 1, 1, 0x0001},
+		// 前一个处理完成后到达的 JOIN 正常处理
+		{"sequential", false, 2, 2, 0x0002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestOTAADevice(t, store)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			blocking := &blockingSessionStore{Store: store, entered: make(chan struct{}), release: make(chan struct{})}
+			if tt.concurrent {
+				p.store = blocking
+			}
+
+			done := make(chan struct{})
+			go func() {
+				p.handleJoinRequest(newTestJoinRequest(t, 0x0001), testGatewayID, testRxInfo())
+				close(done)
+			}()
+			if tt.concurrent {
+				select {
+				case <-blocking.entered:
+				case <-time.After(2 * time.Second):
+					t.Fatal("first JOIN not processed")
+				}
+			} else {
+				<-done
+			}
+
+			// 设备用新的 DevNonce 重发 JOIN
+			p.handleJoinRequest(newTestJoinRequest(t, 0x0002), testGatewayID, testRxInfo())
+
+			close(blocking.release)
+			<-done
+
+			accepts := 0
+			for nextTX(t, txs) != nil {
+				accepts++
+			}
+			if accepts != tt.wantAccepts {
+				t.Errorf("sent %d JOIN ACCEPT, want %d", accepts, tt.wantAccepts)
+			}
+
+			session, err := store.GetDeviceSession(context.Background(), testDevEUI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := joinNonceOfSession(t, p, session.AppSKey, tt.wantDevNonce, 4); got != tt.wantJoinNonce {
+				t.Errorf("session JoinNonce = %d, want %d", got, tt.wantJoinNonce)
+			}
+			if unlock, ok := p.joinLocks.TryLock(testDevEUI); !ok {
+				t.Error("join lock still held after JOIN")
+			} else {
+				unlock()
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestNextJoinNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		last    uint32
+		device  bool
+		want    [3]byte
+		wantErr error
+	}{
+		{"first", 0, true, [3]byte{0x01, 0x00, 0x00}, nil},
+		{"little endian", 0x010203, true, [3]byte{0x04, 0x02, 0x01}, nil},
+		{"last value", 1<<24 - 2, true, [3]byte{0xff, 0xff, 0xff}, nil},
+		{"exhausted", 1<<24 - 1, true, [3]byte{}, storage.ErrJoinNonceExhausted},
+		{"unknown device", 0, false, [3]byte{}, storage.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, _ := newTestProcessor(t, nil)
+			if tt.device {
+				createTestDevice(t, store, testDevEUI)
+				store.SetJoinNonce(testDevEUI, tt.last)
+			}
+
+			got, err := p.nextJoinNonce(context.Background(), testDevEUI)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("nextJoinNonce() = %x, %v, want %x, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// joinNonceOfSession 根据会话的 AppSKey 找出 JOIN ACCEPT 使用的 JoinNonce
+func joinNonceOfSession(t *testing.T, p *Processor, appSKey string, devNonce uint16, max uint32) uint32 {
+	t.Helper()
+
+	key, _ := hex.DecodeString(testKey)
+	for n := uint32(1); n <= max; n++ {
+		nonce := [3]byte{byte(n), byte(n >> 8), byte(n >> 16)}
+		_, want, _ := lorawan.DeriveSessionKeys10(key, nonce, [3]byte(p.netID), [2]byte{byte(devNonce), byte(devNonce >> 8)})
+		if hex.EncodeToString(want[:]) == appSKey {
+			return n
+		}
+	}
+	t.Fatalf("session AppSKey %s not derived from any JoinNonce up to %d", appSKey, max)
+	return 0
+}
+
+func TestJoinNonceMonotonic(t *testing.T) {
+	cfg := &config.Config{}
+	p, store, _ := newTestProcessor(t, cfg)
+	createTestOTAADevice(t, store)
+
+	joins := []struct {
+		devNonce        uint16
+		newCache        bool   // 清空去重缓存，模拟 10 秒后设备重发
+		sessionDevNonce uint16 // 处理后会话所属 JOIN 的 DevNonce
+		wantNonce       uint32
+	}{
+		{0x0001, false, 0x0001, 1},
+		{0x0002, false, 0x0002, 2},
+		{0x0002, true, 0x0002, 2}, // DevNonce 重放被拒绝，会话不变，不消耗 JoinNonce
+		{0x1234, false, 0x1234, 3},
+	}
+
+	for i, join := range joins {
+		if join.newCache {
+			p.joinCache = NewSimpleCache()
+		}
+		p.handleJoinRequest(newTestJoinRequest(t, join.devNonce), testGatewayID, testRxInfo())
+
+		session, err := store.GetDeviceSession(context.Background(), testDevEUI)
+		if err != nil {
+			t.Fatalf("join %d: %v", i, err)
+		}
+		if got := joinNonceOfSession(t, p, session.AppSKey, join.sessionDevNonce, 8); got != join.wantNonce {
+			t.Errorf("join %d: JoinNonce = %d, want %d", i, got, join.wantNonce)
+		}
+	}
+
+	// 计数器保存在存储中，重启后的处理器接着使用
+	restarted := NewProcessor(p.nc, store, cfg)
+	if got, err := restarted.nextJoinNonce(context.Background(), testDevEUI); err != nil || got != [3]byte{0x04, 0x00, 0x00} {
+		t.Errorf("nextJoinNonce() after restart = %x, %v, want 040000", got, err)
+	}
+}
@@ -0,0 +1,58 @@
+package network
+
+import (
+	"context"
+	"math"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// JOIN Accept 的 RX2 发送策略（network.join_accept_rx2）
+const (
+	joinRX2Auto   = "auto"
+	joinRX2Always = "always"
+	joinRX2Off    = "off"
+)
+
+// joinAcceptWindows 决定 JOIN Accept 在 RX1 和/或 RX2 发送，设备配置文件的 joinAcceptRX2 优先于全局配置。
+// auto 模式下网关的频率范围不包含 RX1 下行频率时只发 RX2
+func (p *Processor) joinAcceptWindows(ctx context.Context, gatewayID string, rxInfo map[string]interface{}, profile *models.DeviceProfile) (rx1, rx2 bool) {
+	mode := p.config.Network.JoinAcceptRX2
+	if profile != nil && profile.JoinAcceptRX2 != "" {
+		mode = profile.JoinAcceptRX2
+	}
+
+	switch mode {
+	case joinRX2Always:
+		return true, true
+	case joinRX2Off:
+		return true, false
+	}
+
+	rx1Freq := uint32(math.Round(p.calculateDownlinkFrequency(getFloat64(rxInfo, "freq")) * 1000000))
+	meta := p.getGatewayMeta(ctx, gatewayID)
+	if meta.canTransmit(rx1Freq) {
+		return true, false
+	}
+
+	rx2Freq, _ := p.deviceRX2(profile)
+	if !meta.canTransmit(rx2Freq) {
+		log.Warn().
+			Str("gateway", gatewayID).
+			Uint32("rx1Freq", rx1Freq).
+			Uint32("rx2Freq", rx2Freq).
+			Uint32("minFreq", meta.MinFrequency).
+			Uint32("maxFreq", meta.MaxFrequency).
+			Msg("网关频率范围既不包含 RX1 也不包含 RX2 频率，仍尝试 RX2 发送 JOIN ACCEPT")
+	} else {
+		log.Info().
+			Str("gateway", gatewayID).
+			Uint32("rx1Freq", rx1Freq).
+			Uint32("minFreq", meta.MinFrequency).
+			Uint32("maxFreq", meta.MaxFrequency).
+			Msg("网关无法在 RX1 频率发送，JOIN ACCEPT 改用 RX2")
+	}
+	return false, true
+}
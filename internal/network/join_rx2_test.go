@@ -0,0 +1,76 @@
+package network
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestJoinAcceptRX2ByGatewayCapability(t *testing.T) {
+	gatewayEUI := models.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	tests := []struct {
+		name      string
+		mode      string
+		profile   string          // 设备配置文件的 joinAcceptRX2
+		gateway   *models.Gateway // nil 表示未注册的网关
+		wantFreqs []float64
+	}{
+		{"unregistered gateway", "", "", nil, []float64{470.3}},
+		{"gateway covers RX1", "", "", &models.Gateway{GatewayID: gatewayEUI, MinFrequency: 470000000, MaxFrequency: 472000000}, []float64{470.3}},
+		// 网关无法在 RX1 频率发送，只发 RX2
+		{"gateway cannot transmit RX1", "", "", &models.Gateway{GatewayID: gatewayEUI, MinFrequency: 471000000, MaxFrequency: 472000000}, []float64{471.05}},
+		{"gateway covers neither", "", "", &models.Gateway{GatewayID: gatewayEUI, MinFrequency: 500000000, MaxFrequency: 510000000}, []float64{471.05}},
+		{"always", joinRX2Always, "", nil, []float64{470.3, 471.05}},
+		{"off", joinRX2Off, "", &models.Gateway{GatewayID: gatewayEUI, MinFrequency: 471000000, MaxFrequency: 472000000}, []float64{470.3}},
+		{"profile overrides config", joinRX2Off, joinRX2Always, nil, []float64{470.3, 471.05}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := rx2TestConfig()
+			cfg.Network.JoinAcceptRX2 = tt.mode
+			p, store, srv := newTestProcessor(t, cfg)
+			ctx := context.Background()
+			device := createTestOTAADevice(t, store)
+			if tt.profile != "" {
+				profile := &models.DeviceProfile{Name: "rx2", JoinAcceptRX2: tt.profile}
+				if err := store.CreateDeviceProfile(ctx, profile); err != nil {
+					t.Fatal(err)
+				}
+				device.DeviceProfileID = profile.ID
+				if err := store.UpdateDevice(ctx, device); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.gateway != nil {
+				if err := store.CreateGateway(ctx, tt.gateway); err != nil {
+					t.Fatal(err)
+				}
+			}
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			p.handleJoinRequest(newTestJoinRequest(t, 0x0001), testGatewayID, testRxInfo())
+
+			var freqs []float64
+			for tx := nextTX(t, txs); tx != nil; tx = nextTX(t, txs) {
+				if data, _ := base64.StdEncoding.DecodeString(tx.TXPK.Data); len(data) == 0 || lorawan.MType(data[0]>>5) != lorawan.JoinAccept {
+					t.Fatalf("downlink %s is not a JOIN ACCEPT", tx.TXPK.Data)
+				}
+				freqs = append(freqs, tx.TXPK.Freq)
+			}
+			if len(freqs) != len(tt.wantFreqs) {
+				t.Fatalf("JOIN ACCEPT sent on %v MHz, want %v", freqs, tt.wantFreqs)
+			}
+			for i := range freqs {
+				if freqs[i] != tt.wantFreqs[i] {
+					t.Errorf("JOIN ACCEPT sent on %v MHz, want %v", freqs, tt.wantFreqs)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package network
+
+import (
+	"encoding/hex"
+	"math"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// sessionMACVersion JOIN 时协商的 MAC 版本：按 LoRaWAN 1.1 入网时记录配置文件中的版本，否则为空（1.0.x）
+func sessionMACVersion(profile *models.DeviceProfile, lorawan11 bool) string {
+	if !lorawan11 || profile == nil {
+		return ""
+	}
+	return profile.MACVersion
+}
+
+// isSession11 会话是否按 LoRaWAN 1.1 入网，决定数据帧 MIC 的计算方式
+func isSession11(session *models.DeviceSession) bool {
+	return lorawan.IsMACVersion11(session.MACVersion)
+}
+
+// validUplinkMIC 按会话版本校验上行 MIC。LoRaWAN 1.1 的 MIC 由 FNwkSIntKey 和 SNwkSIntKey 各取一半，
+// 后者覆盖上行速率、信道以及 ACK 时被确认的下行 FCnt
+func (p *Processor) validUplinkMIC(phy *lorawan.PHYPayload, macPayload *lorawan.MACPayload, session *models.DeviceSession, fullFCnt uint32, rxInfo map[string]interface{}) (bool, error) {
+	fNwkSIntKey := sessionKey(session.FNwkSIntKey)
+	if !isSession11(session) {
+		return phy.ValidateUplinkDataMIC(lorawan.LoRaWAN1_0, fullFCnt, 0, 0, fNwkSIntKey, lorawan.AES128Key{})
+	}
+
+	var confFCnt uint32
+	if macPayload.FHDR.FCtrl.ACK {
+		confFCnt = session.ConfFCnt // 最近一次确认下行，应用下行为 AFCntDown
+	}
+	datr, _ := rxInfo["datr"].(string)
+	txDR, _ := p.getDRIndex(datr)
+	txCH := p.uplinkChannelIndex(getFloat64(rxInfo, "freq"))
+
+	return phy.ValidateUplinkDataMIC11(fullFCnt, confFCnt, txDR, txCH, fNwkSIntKey, sessionKey(session.SNwkSIntKey))
+}
+
+// downlinkFCnt 下行帧使用的计数器：LoRaWAN 1.1 会话中 FPort > 0 的应用下行使用 AFCntDown，
+// FPort 0 和只带 MAC 命令的下行使用 NFCntDown；1.0.x 会话只有 NFCntDown 一个下行计数器
+func downlinkFCnt(session *models.DeviceSession, fPort *uint8) *uint32 {
+	if isSession11(session) && fPort != nil && *fPort > 0 {
+		return &session.AFCntDown
+	}
+	return &session.NFCntDown
+}
+
+// setDownlinkMIC 按会话版本设置下行 MIC，fCnt 为 downlinkFCnt 选出的计数器；LoRaWAN 1.1 的 ACK 下行
+// 在 B0 中带上被确认的上行 FCnt
+func (p *Processor) setDownlinkMIC(phy *lorawan.PHYPayload, session *models.DeviceSession, fCnt uint32, ack bool) error {
+	key := sessionKey(session.SNwkSIntKey)
+	if !isSession11(session) {
+		return phy.SetDownlinkDataMIC(lorawan.LoRaWAN1_0, fCnt, key)
+	}
+
+	var confFCnt uint32
+	if ack {
+		confFCnt = session.FCntUp
+	}
+	return phy.SetDownlinkDataMIC11(fCnt, confFCnt, key)
+}
+
+// encryptFOpts LoRaWAN 1.1 会话的 FOpts 用 NwkSEncKey 加密，上行解密是同一运算；1.0.x 会话的 FOpts 为明文。
+// fCnt 为该帧使用的完整计数器，应用下行（FPort > 0）按 AFCntDown 计
+func encryptFOpts(session *models.DeviceSession, uplink bool, fPort *uint8, fCnt uint32, fOpts []byte) ([]byte, error) {
+	if !isSession11(session) || len(fOpts) == 0 {
+		return fOpts, nil
+	}
+	aFCntDown := !uplink && fPort != nil && *fPort > 0
+	return lorawan.EncryptFOpts11(sessionKey(session.NwkSEncKey), uplink, aFCntDown, lorawan.DevAddr(session.DevAddr), fCnt, fOpts)
+}
+
+// uplinkChannelIndex 上行频率（MHz）对应的信道号：CN470 按信道计划计算，其余频段在默认信道中查找，找不到时为 0
+func (p *Processor) uplinkChannelIndex(freqMHz float64) uint8 {
+	freq := uint32(math.Round(freqMHz * 1000000))
+	if p.region.Name == "CN470" {
+		if ch, err := p.region.GetCN470ChannelIndex(freq); err == nil {
+			return uint8(ch)
+		}
+		return 0
+	}
+	for i, ch := range p.region.DefaultChannels {
+		if ch.Frequency == freq {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+// sessionKey 解析会话中以十六进制保存的密钥
+func sessionKey(s string) lorawan.AES128Key {
+	var key lorawan.AES128Key
+	b, _ := hex.DecodeString(s)
+	copy(key[:], b)
+	return key
+}
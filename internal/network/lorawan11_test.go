@@ -0,0 +1,143 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestDownlinkFOptsEncryption(t *testing.T) {
+	cmd := []byte{lorawan.DevStatusReq}
+
+	tests := []struct {
+		name       string
+		macVersion string
+		want       func(session *models.DeviceSession) []byte
+	}{
+		{"LoRaWAN 1.0 plain", "", func(*models.DeviceSession) []byte { return cmd }},
+		// 应用下行按 AFCntDown 加密
+		{"LoRaWAN 1.1 encrypted", "1.1.0", func(session *models.DeviceSession) []byte {
+			enc, _ := lorawan.EncryptFOpts11(sessionKey(testKey), false, true, testDevAddr, session.AFCntDown, cmd)
+			return enc
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+			createTestDevice(t, store, testDevEUI)
+			session := saveTestSession(t, store, testDevEUI, tt.macVersion)
+			session.AFCntDown, session.NFCntDown = 7, 3
+			store.CreateDownlinkFrame(ctx, &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), FPort: 10, Data: []byte{0xca, 0xfe}})
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+			want := tt.want(session)
+
+			p.handleDownlink(session, testGatewayID, testRxInfo(), []lorawan.MACCommand{{CID: lorawan.DevStatusReq}}, false)
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			_, mac := decodeDownlink(t, tx)
+			if mac.FPort == nil || *mac.FPort != 10 {
+				t.Fatalf("FPort = %v, want the queued application downlink", mac.FPort)
+			}
+			if !bytes.Equal(mac.FHDR.FOpts, want) {
+				t.Errorf("FOpts = %x, want %x", mac.FHDR.FOpts, want)
+			}
+		})
+	}
+}
+
+func TestACKFOptsEncryption(t *testing.T) {
+	p, store, _ := newTestProcessor(t, nil)
+	createTestDevice(t, store, testDevEUI)
+	session := saveTestSession(t, store, testDevEUI, "1.1.0")
+	session.NFCntDown = 3
+
+	phy := p.createACKResponse(session, []lorawan.MACCommand{{CID: lorawan.DevStatusReq}}, false)
+	var mac lorawan.MACPayload
+	if err := mac.Unmarshal(phy.MACPayload, phy.MHDR.MType, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// 单独的 ACK 没有 FPort，按 NFCntDown 加密
+	want, _ := lorawan.EncryptFOpts11(sessionKey(testKey), false, false, testDevAddr, 3, []byte{lorawan.DevStatusReq})
+	if !bytes.Equal(mac.FHDR.FOpts, want) {
+		t.Errorf("FOpts = %x, want %x", mac.FHDR.FOpts, want)
+	}
+}
+
+func TestUplinkFOptsDecryption(t *testing.T) {
+	tests := []struct {
+		name          string
+		encrypt       bool
+		wantLinkCheck bool
+	}{
+		{"encrypted FOpts", true, true},
+		// 1.1 设备不会发送明文 FOpts，按密文解出的不是 LinkCheckReq
+		{"plain FOpts", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "1.1.0")
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			fOpts := []byte{lorawan.LinkCheckReq}
+			if tt.encrypt {
+				fOpts, _ = lorawan.EncryptFOpts11(sessionKey(testKey), true, false, testDevAddr, 1, fOpts)
+			}
+			p.handleDataUp(newTestUplink11(t, p, 1, fOpts), testGatewayID, testRxInfo())
+
+			gotLinkCheck := false
+			if tx := nextTX(t, txs); tx != nil {
+				_, mac := decodeDownlink(t, tx)
+				if mac.FPort != nil && *mac.FPort == 0 {
+					key, _ := hex.DecodeString(testKey)
+					data, _ := crypto.DecryptFRMPayload(key, false, [4]byte(testDevAddr), uint32(mac.FHDR.FCnt), mac.FRMPayload)
+					cmds, _ := lorawan.ParseMACCommands(false, data)
+					for _, cmd := range cmds {
+						gotLinkCheck = gotLinkCheck || cmd.CID == lorawan.LinkCheckAns
+					}
+				}
+			}
+			if gotLinkCheck != tt.wantLinkCheck {
+				t.Errorf("LinkCheckAns sent = %v, want %v", gotLinkCheck, tt.wantLinkCheck)
+			}
+		})
+	}
+}
+
+// newTestUplink11 builds an unconfirmed LoRaWAN 1.1 uplink from testDevAddr carrying fOpts as is,
+// with the MIC of the test session keys for the data rate and channel of testRxInfo
+func newTestUplink11(t *testing.T, p *Processor, fCnt uint32, fOpts []byte) *lorawan.PHYPayload {
+	t.Helper()
+
+	mac := lorawan.MACPayload{
+		FHDR: lorawan.FHDR{DevAddr: testDevAddr, FCnt: uint16(fCnt), FOpts: fOpts},
+	}
+	macBytes, err := mac.Marshal(lorawan.UnconfirmedDataUp, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phy := &lorawan.PHYPayload{
+		MHDR:       lorawan.MHDR{MType: lorawan.UnconfirmedDataUp, Major: lorawan.LoRaWAN1_0},
+		MACPayload: macBytes,
+	}
+	rxInfo := testRxInfo()
+	txDR, _ := p.getDRIndex(rxInfo["datr"].(string))
+	txCH := p.uplinkChannelIndex(getFloat64(rxInfo, "freq"))
+	if err := phy.SetUplinkDataMIC11(fCnt, 0, txDR, txCH, sessionKey(testKey), sessionKey(testKey)); err != nil {
+		t.Fatal(err)
+	}
+	return phy
+}
@@ -2,9 +2,13 @@ package network
 
 import (
 	"encoding/hex"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
@@ -14,18 +18,42 @@ import (
 type MACCommandHandler struct {
 	store  storage.Store
 	region *lorawan.RegionConfiguration
+	adr    *ADRAlgorithm
+
+	// 已下发、等待 LinkADRAns 确认的 LinkADRReq
+	pendingADR map[models.EUI64]pendingLinkADR
+	pendingMu  sync.Mutex
+
+	// 每个设备最近上行的 SNR，供 ADR 计算
+	adrHistory map[models.EUI64][]models.ADRHistory
+	historyMu  sync.Mutex
+}
+
+// linkADRAnsTimeout 超过这么久未收到 LinkADRAns 视为丢失，可以重新下发
+const linkADRAnsTimeout = 10 * time.Minute
+
+// pendingLinkADR 已下发的 LinkADRReq 参数，设备全部确认后写入会话
+type pendingLinkADR struct {
+	dataRate uint8
+	txPower  uint8
+	nbTrans  uint8
+	sentAt   time.Time
 }
 
-// NewMACCommandHandler 创建 MAC 命令处理器
-func NewMACCommandHandler(store storage.Store, region string) *MACCommandHandler {
+// NewMACCommandHandler 创建 MAC 命令处理器，adrCfg 为 ADR 目标 SNR、窗口和速率/功率范围
+func NewMACCommandHandler(store storage.Store, region string, adrCfg config.CN470ADR) *MACCommandHandler {
 	return &MACCommandHandler{
-		store:  store,
-		region: lorawan.GetRegionConfiguration(region),
+		store:      store,
+		region:     lorawan.GetRegionConfiguration(region),
+		adr:        NewADRAlgorithm(adrCfg),
+		pendingADR: make(map[models.EUI64]pendingLinkADR),
+		adrHistory: make(map[models.EUI64][]models.ADRHistory),
 	}
 }
 
 // HandleUplink 处理上行 MAC 命令
-func (h *MACCommandHandler) HandleUplink(session *models.DeviceSession, commands []lorawan.MACCommand) []lorawan.MACCommand {
+// profile 为设备配置文件，可为空，用于限制 LinkADRReq 下发的数据速率
+func (h *MACCommandHandler) HandleUplink(session *models.DeviceSession, profile *models.DeviceProfile, commands []lorawan.MACCommand) []lorawan.MACCommand {
 	var responses []lorawan.MACCommand
 
 	for _, cmd := range commands {
@@ -53,10 +81,9 @@ func (h *MACCommandHandler) HandleUplink(session *models.DeviceSession, commands
 		}
 	}
 
-	// 检查是否需要发送 ADR 请求
-	if session.ADR && h.shouldSendADRReq(session) {
-		adrReq := h.createADRReq(session)
-		if adrReq != nil {
+	// 设备置位 ADR 时，按 SNR 余量调整速率和功率
+	if session.ADR {
+		if adrReq := h.adrReq(session, profile); adrReq != nil {
 			responses = append(responses, *adrReq)
 		}
 	}
@@ -102,7 +129,38 @@ func (h *MACCommandHandler) handleLinkADRAns(session *models.DeviceSession, payl
 		Bool("channelMaskACK", channelMaskACK).
 		Msg("收到 LinkADRAns")
 
-	// TODO: 根据响应更新 ADR 状态
+	h.pendingMu.Lock()
+	req, pending := h.pendingADR[session.DevEUI]
+	delete(h.pendingADR, session.DevEUI)
+	h.pendingMu.Unlock()
+
+	if !pending {
+		return
+	}
+	if powerACK && dataRateACK && channelMaskACK {
+		if req.dataRate != session.DR || req.txPower != session.TXPower {
+			// 速率或功率变化后旧的 SNR 样本不再代表当前链路
+			h.ForgetADR(session.DevEUI)
+		}
+		session.DR = req.dataRate
+		session.TXPower = req.txPower
+		session.NbTrans = req.nbTrans
+		log.Info().
+			Str("devEUI", hex.EncodeToString(session.DevEUI[:])).
+			Uint8("dr", req.dataRate).
+			Uint8("txPower", req.txPower).
+			Uint8("nbTrans", req.nbTrans).
+			Msg("设备已接受 LinkADRReq")
+	} else {
+		// 任一位拒绝时整条 LinkADRReq 都不生效
+		log.Warn().
+			Str("devEUI", hex.EncodeToString(session.DevEUI[:])).
+			Uint8("dr", req.dataRate).
+			Uint8("txPower", req.txPower).
+			Uint8("nbTrans", req.nbTrans).
+			Uint8("status", status).
+			Msg("设备拒绝 LinkADRReq，速率、功率和 NbTrans 保持不变")
+	}
 }
 
 // handleDevStatusAns 处理设备状态响应
@@ -159,21 +217,110 @@ func (h *MACCommandHandler) handleNewChannelAns(session *models.DeviceSession, p
 		Msg("收到 NewChannelAns")
 }
 
-// shouldSendADRReq 判断是否需要发送 ADR 请求
-func (h *MACCommandHandler) shouldSendADRReq(session *models.DeviceSession) bool {
-	// TODO: 实现 ADR 算法
-	// - 检查历史 SNR/RSSI
-	// - 计算最优数据速率
-	// - 决定是否需要调整
-	return false
+// RecordUplink 记录一次上行的 SNR 样本，保留最近 HistorySize 个；同一 FCnt 的重传合并为一个样本，
+// SNR 取较大值。FCnt 回退（重新入网）时重新统计
+func (h *MACCommandHandler) RecordUplink(devEUI models.EUI64, sample models.ADRHistory) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+
+	history := h.adrHistory[devEUI]
+	if n := len(history); n > 0 {
+		last := &history[n-1]
+		switch {
+		case sample.FCnt == last.FCnt:
+			if sample.MaxSNR > last.MaxSNR {
+				last.MaxSNR = sample.MaxSNR
+			}
+			return
+		case sample.FCnt < last.FCnt:
+			history = nil
+		}
+	}
+	history = append(history, sample)
+	if len(history) > h.adr.historySize {
+		history = history[len(history)-h.adr.historySize:]
+	}
+	h.adrHistory[devEUI] = history
+}
+
+// ForgetADR 清除设备的 SNR 历史
+func (h *MACCommandHandler) ForgetADR(devEUI models.EUI64) {
+	h.historyMu.Lock()
+	delete(h.adrHistory, devEUI)
+	h.historyMu.Unlock()
+}
+
+// adrReq 根据 SNR 历史计算目标速率和功率，与会话当前值不同时创建 LinkADRReq；
+// 上一条 LinkADRReq 尚未确认时不重复下发
+func (h *MACCommandHandler) adrReq(session *models.DeviceSession, profile *models.DeviceProfile) *lorawan.MACCommand {
+	if h.LinkADRPending(session.DevEUI) {
+		return nil
+	}
+
+	h.historyMu.Lock()
+	history := append([]models.ADRHistory(nil), h.adrHistory[session.DevEUI]...)
+	h.historyMu.Unlock()
+
+	dataRate, txPower := h.adr.CalculateADR(history, session.DR, session.TXPower)
+	dataRate = profileDR(dataRate, profile)
+	if dataRate == session.DR && txPower == session.TXPower {
+		return nil
+	}
+
+	log.Info().
+		Str("devEUI", hex.EncodeToString(session.DevEUI[:])).
+		Float64("maxSNR", maxADRSNR(history)).
+		Int("samples", len(history)).
+		Uint8("dr", session.DR).
+		Uint8("txPower", session.TXPower).
+		Uint8("targetDR", dataRate).
+		Uint8("targetTXPower", txPower).
+		Msg("ADR 调整速率和功率")
+
+	return h.linkADRReq(session, profile, dataRate, txPower, sessionNbTrans(session))
+}
+
+// NbTransReq 创建调整 NbTrans 的 LinkADRReq（速率和功率保持当前值），并等待 LinkADRAns 确认
+func (h *MACCommandHandler) NbTransReq(session *models.DeviceSession, profile *models.DeviceProfile, nbTrans uint8) *lorawan.MACCommand {
+	return h.linkADRReq(session, profile, session.DR, session.TXPower, nbTrans)
 }
 
-// createADRReq 创建 ADR 请求
-func (h *MACCommandHandler) createADRReq(session *models.DeviceSession) *lorawan.MACCommand {
-	dataRate := session.DR
-	txPower := session.TXPower
+// LinkADRPending 设备是否还有未确认的 LinkADRReq（速率、功率或 NbTrans 调整）
+func (h *MACCommandHandler) LinkADRPending(devEUI models.EUI64) bool {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	req, ok := h.pendingADR[devEUI]
+	return ok && time.Since(req.sentAt) < linkADRAnsTimeout
+}
+
+// linkADRReq 创建 LinkADRReq 并记录为待确认，收到 LinkADRAns 全部确认后写入会话
+func (h *MACCommandHandler) linkADRReq(session *models.DeviceSession, profile *models.DeviceProfile, dataRate, txPower, nbTrans uint8) *lorawan.MACCommand {
+	cmd := h.createADRReq(session, profile, dataRate, txPower, nbTrans)
+
+	h.pendingMu.Lock()
+	h.pendingADR[session.DevEUI] = pendingLinkADR{
+		dataRate: cmd.Payload[0] >> 4,
+		txPower:  cmd.Payload[0] & 0x0F,
+		nbTrans:  nbTrans,
+		sentAt:   time.Now(),
+	}
+	h.pendingMu.Unlock()
+
+	return cmd
+}
+
+// createADRReq 创建 ADR 请求，数据速率限制在设备配置文件支持的速率内
+func (h *MACCommandHandler) createADRReq(session *models.DeviceSession, profile *models.DeviceProfile, dr, txPower, nbTrans uint8) *lorawan.MACCommand {
+	dataRate := profileDR(dr, profile)
+	if dataRate != dr {
+		log.Debug().
+			Str("devEUI", hex.EncodeToString(session.DevEUI[:])).
+			Uint8("dr", dr).
+			Uint8("supportedDR", dataRate).
+			Msg("设备不支持该数据速率，LinkADRReq 已调整")
+	}
 	var chMask uint16
-	redundancy := uint8(1) // NbTrans = 1
+	redundancy := nbTrans & 0x0F // Redundancy 低 4 位为 NbTrans
 
 	// CN470特殊处理
 	if h.region.Name == "CN470" {
@@ -194,9 +341,8 @@ func (h *MACCommandHandler) createADRReq(session *models.DeviceSession) *lorawan
 		payload[1] = byte(chMask)
 		payload[2] = byte(chMask >> 8)
 
-		// CN470: ChMaskCntl 字段编码子频段
-		// Bits 2:0 RFU, bits 6:3 ChMaskCntl
-		payload[3] = (chMaskCntl << 3) | redundancy
+		// Redundancy: bit 7 RFU, bits 6:4 ChMaskCntl, bits 3:0 NbTrans
+		payload[3] = (chMaskCntl&0x07)<<4 | redundancy
 
 		log.Debug().
 			Int("subBand", subBand).
@@ -225,7 +371,7 @@ func (h *MACCommandHandler) createADRReq(session *models.DeviceSession) *lorawan
 	}
 }
 
-// ADR 算法实现
+// ADRAlgorithm 按最近上行的 SNR 余量计算目标数据速率和发射功率
 type ADRAlgorithm struct {
 	minDataRate int
 	maxDataRate int
@@ -236,72 +382,78 @@ type ADRAlgorithm struct {
 	historySize int
 }
 
-// CalculateADR 计算 ADR 参数
-func (a *ADRAlgorithm) CalculateADR(history []models.ADRHistory) (dataRate, txPower uint8, nbTrans uint8) {
-	if len(history) < a.historySize {
-		return 0, 0, 1 // 历史数据不足
-	}
+// adrStepDB SNR 余量每 3 dB 调整一级速率或功率
+const adrStepDB = 3
 
-	// 计算平均 SNR
-	var sumSNR float64
-	var minGateways int = 100
-	for _, h := range history {
-		sumSNR += h.MaxSNR
-		if h.GatewayCount < minGateways {
-			minGateways = h.GatewayCount
-		}
+// NewADRAlgorithm 使用 ADR 配置创建算法，窗口大小至少为 1
+func NewADRAlgorithm(cfg config.CN470ADR) *ADRAlgorithm {
+	historySize := cfg.HistorySize
+	if historySize < 1 {
+		historySize = 1
+	}
+	return &ADRAlgorithm{
+		minDataRate: cfg.MinDataRate,
+		maxDataRate: cfg.MaxDataRate,
+		minTxPower:  cfg.MinTXPower,
+		maxTxPower:  cfg.MaxTXPower,
+		targetSNR:   float64(cfg.TargetSNR),
+		marginSNR:   float64(cfg.MarginSNR),
+		historySize: historySize,
 	}
-	avgSNR := sumSNR / float64(len(history))
+}
 
-	// 计算 SNR 余量
-	margin := avgSNR - a.targetSNR - a.marginSNR
+// CalculateADR 计算目标速率和功率（TXPower 为索引，值越大功率越小）。窗口未满时保持当前值。
+// 余量 = 窗口内最大 SNR - TargetSNR - MarginSNR，每 3 dB 一级：余量为正时先提高速率，
+// 到最大速率后再降低功率；余量为负时提高功率，速率不降（由设备的 ADRACKReq 回退）。
+// 结果限制在配置的速率和功率范围内
+func (a *ADRAlgorithm) CalculateADR(history []models.ADRHistory, currentDR, currentTXPower uint8) (dataRate, txPower uint8) {
+	if len(history) < a.historySize {
+		return currentDR, currentTXPower
+	}
 
-	// 调整数据速率
-	currentDR := int(history[len(history)-1].TXPower >> 4)
-	newDR := currentDR
+	margin := maxADRSNR(history) - a.targetSNR - a.marginSNR
+	nStep := int(math.Floor(margin / adrStepDB))
 
-	if margin > 3 {
-		// SNR 很好，可以提高数据速率
-		newDR = currentDR + 1
-		if newDR > a.maxDataRate {
-			newDR = a.maxDataRate
-		}
-	} else if margin < -3 {
-		// SNR 较差，降低数据速率
-		newDR = currentDR - 1
-		if newDR < a.minDataRate {
-			newDR = a.minDataRate
-		}
+	dr := int(currentDR)
+	power := int(currentTXPower)
+	for nStep > 0 && dr < a.maxDataRate {
+		dr++
+		nStep--
+	}
+	for nStep > 0 && power < a.maxTxPower {
+		power++
+		nStep--
+	}
+	for nStep < 0 && power > a.minTxPower {
+		power--
+		nStep++
 	}
 
-	// 调整发射功率
-	currentTxPower := int(history[len(history)-1].TXPower & 0x0F)
-	newTxPower := currentTxPower
+	dr = clampInt(dr, a.minDataRate, a.maxDataRate)
+	power = clampInt(power, a.minTxPower, a.maxTxPower)
+	return uint8(dr), uint8(power)
+}
 
-	if newDR == currentDR {
-		if margin > 0 {
-			// 降低发射功率以节省能量
-			newTxPower = currentTxPower + 1 // 注意：值越大功率越小
-			if newTxPower > a.maxTxPower {
-				newTxPower = a.maxTxPower
-			}
-		} else if margin < 0 {
-			// 增加发射功率
-			newTxPower = currentTxPower - 1
-			if newTxPower < a.minTxPower {
-				newTxPower = a.minTxPower
-			}
+// maxADRSNR 窗口内的最大 SNR
+func maxADRSNR(history []models.ADRHistory) float64 {
+	if len(history) == 0 {
+		return 0
+	}
+	max := history[0].MaxSNR
+	for _, h := range history[1:] {
+		if h.MaxSNR > max {
+			max = h.MaxSNR
 		}
 	}
+	return max
+}
 
-	// 根据网关数量调整重传次数
-	if minGateways <= 1 {
-		nbTrans = 3
-	} else if minGateways <= 3 {
-		nbTrans = 2
-	} else {
-		nbTrans = 1
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
 	}
-
-	return uint8(newDR), uint8(newTxPower), nbTrans
+	if v > max {
+		return max
+	}
+	return v
 }
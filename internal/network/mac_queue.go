@@ -0,0 +1,51 @@
+package network
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// maxFOptsLen FOpts 最多 15 字节
+const maxFOptsLen = 15
+
+// appendQueuedMACCommands 把手动下发队列中的 MAC 命令追加到本次下行 FOpts，
+// 放不下的命令留在队列中等待下一次下行
+func (p *Processor) appendQueuedMACCommands(ctx context.Context, session *models.DeviceSession, cmds []lorawan.MACCommand) []lorawan.MACCommand {
+	devEUI := lorawan.EUI64(session.DevEUI)
+	items, err := p.store.GetPendingMACCommands(ctx, devEUI)
+	if err != nil {
+		log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("获取 MAC 命令队列失败")
+		return cmds
+	}
+
+	size := 0
+	for _, cmd := range cmds {
+		size += 1 + len(cmd.Payload)
+	}
+
+	for _, item := range items {
+		if size+1+len(item.Payload) > maxFOptsLen {
+			break
+		}
+
+		if err := p.store.DeleteMACCommand(ctx, item.ID); err != nil {
+			// 可能已被并发的下行取走
+			continue
+		}
+
+		cmds = append(cmds, lorawan.MACCommand{CID: item.CID, Payload: item.Payload})
+		size += 1 + len(item.Payload)
+
+		log.Info().
+			Str("devEUI", devEUI.String()).
+			Uint8("cid", item.CID).
+			Hex("payload", item.Payload).
+			Msg("下发队列中的 MAC 命令")
+	}
+
+	return cmds
+}
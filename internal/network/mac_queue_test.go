@@ -0,0 +1,93 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestAppendQueuedMACCommands(t *testing.T) {
+	devStatus := models.MACCommandQueueItem{CID: lorawan.DevStatusReq}
+	rxTiming := models.MACCommandQueueItem{CID: lorawan.RXTimingSetupReq, Payload: []byte{0x02}}
+	linkADR := models.MACCommandQueueItem{CID: lorawan.LinkADRReq, Payload: []byte{0x52, 0xff, 0x00, 0x01}}
+
+	tests := []struct {
+		name       string
+		pending    []lorawan.MACCommand // 本次下行已有的 MAC 命令
+		queued     []models.MACCommandQueueItem
+		wantCIDs   []byte
+		wantQueued int
+	}{
+		{"empty queue", nil, nil, nil, 0},
+		{"queued commands appended in order", nil, []models.MACCommandQueueItem{devStatus, rxTiming}, []byte{lorawan.DevStatusReq, lorawan.RXTimingSetupReq}, 0},
+		{"after pending commands", []lorawan.MACCommand{{CID: lorawan.DevStatusReq}}, []models.MACCommandQueueItem{rxTiming}, []byte{lorawan.DevStatusReq, lorawan.RXTimingSetupReq}, 0},
+		// 3 个 LinkADRReq 共 15 字节，第 4 个留在队列中
+		{"FOpts full", nil, []models.MACCommandQueueItem{linkADR, linkADR, linkADR, linkADR}, []byte{lorawan.LinkADRReq, lorawan.LinkADRReq, lorawan.LinkADRReq}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, _ := newTestProcessor(t, nil)
+			ctx := context.Background()
+			for _, item := range tt.queued {
+				item.DevEUI = models.EUI64(testDevEUI)
+				store.EnqueueMACCommand(ctx, &item)
+			}
+
+			session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+			cmds := p.appendQueuedMACCommands(ctx, session, tt.pending)
+
+			var cids []byte
+			for _, cmd := range cmds {
+				cids = append(cids, cmd.CID)
+			}
+			if !bytes.Equal(cids, tt.wantCIDs) {
+				t.Errorf("commands %x, want %x", cids, tt.wantCIDs)
+			}
+			if left, _ := store.GetPendingMACCommands(ctx, testDevEUI); len(left) != tt.wantQueued {
+				t.Errorf("%d commands left in the queue, want %d", len(left), tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestQueuedMACCommandDelivered(t *testing.T) {
+	p, store, srv := newTestProcessor(t, nil)
+	ctx := context.Background()
+	session := saveTestSession(t, store, testDevEUI, "")
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+	store.EnqueueMACCommand(ctx, &models.MACCommandQueueItem{
+		DevEUI:  models.EUI64(testDevEUI),
+		CID:     lorawan.RXTimingSetupReq,
+		Payload: []byte{0x02},
+	})
+
+	cmds := p.appendQueuedMACCommands(ctx, session, nil)
+	cacheTestUplink(p, testDevEUI, testGatewayID)
+	p.handleDownlink(session, testGatewayID, p.getLastRxInfoForDevice(testDevEUI), cmds, false)
+
+	tx := nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("no downlink sent")
+	}
+	_, mac := decodeDownlink(t, tx)
+	if mac.FPort == nil || *mac.FPort != 0 {
+		t.Fatalf("FPort = %v, want 0 for MAC commands only", mac.FPort)
+	}
+
+	key, _ := hex.DecodeString(testKey)
+	plain, _ := crypto.DecryptFRMPayload(key, false, [4]byte(testDevAddr), uint32(mac.FHDR.FCnt), mac.FRMPayload)
+	got, err := lorawan.ParseMACCommands(false, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].CID != lorawan.RXTimingSetupReq || !bytes.Equal(got[0].Payload, []byte{0x02}) {
+		t.Errorf("delivered %+v, want RXTimingSetupReq 02", got)
+	}
+}
@@ -0,0 +1,199 @@
+package network
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// MaintenanceSubject 切换维护模式的 NATS 主题，请求带 reply 时返回 MaintenanceStatus
+const MaintenanceSubject = "ns.maintenance"
+
+// maxHeldDownlinks 每个网关维护期间最多暂存的 C 类下行数，暂存已满时新的下行留在设备队列中
+const maxHeldDownlinks = 100
+
+// MaintenanceRequest 开启或结束维护，GatewayID 为空表示全局维护，Enabled 为空时只查询状态
+type MaintenanceRequest struct {
+	GatewayID string `json:"gatewayID,omitempty"`
+	Enabled   *bool  `json:"enabled,omitempty"`
+}
+
+// MaintenanceStatus 当前维护状态和各网关暂存的下行数
+type MaintenanceStatus struct {
+	Global   bool           `json:"global"`
+	Gateways []string       `json:"gateways"`
+	Held     map[string]int `json:"held"`
+}
+
+// heldDownlink 维护期间暂存的 C 类下行。A 类下行依赖上行后的接收窗口，不暂存：
+// 应用下行留在设备队列中，维护结束后的下一次上行时发送
+type heldDownlink struct {
+	devAddr  lorawan.DevAddr
+	phy      lorawan.PHYPayload
+	rxInfo   map[string]interface{}
+	override *DownlinkOverride
+	at       time.Time
+}
+
+// maintenanceMode 维护期间暂停下行发送，只接收上行
+type maintenanceMode struct {
+	mu       sync.Mutex
+	global   bool
+	gateways map[string]bool
+	held     map[string][]heldDownlink
+}
+
+func newMaintenanceMode(global bool, gateways []string) *maintenanceMode {
+	m := &maintenanceMode{
+		global:   global,
+		gateways: make(map[string]bool, len(gateways)),
+		held:     make(map[string][]heldDownlink),
+	}
+	for _, id := range gateways {
+		m.gateways[id] = true
+	}
+	return m
+}
+
+// active 网关是否处于维护中
+func (m *maintenanceMode) active(gatewayID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.global || m.gateways[gatewayID]
+}
+
+// hold 网关处于维护中时暂存下行并返回 true
+func (m *maintenanceMode) hold(gatewayID string, d heldDownlink) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.global && !m.gateways[gatewayID] {
+		return false
+	}
+	m.held[gatewayID] = append(m.held[gatewayID], d)
+	return true
+}
+
+// canHold 网关暂存的下行是否未满；已满时调用方不构建下行，留在设备队列中
+func (m *maintenanceMode) canHold(gatewayID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.held[gatewayID]) < maxHeldDownlinks
+}
+
+// set 切换维护状态，返回不再处于维护中的网关暂存的下行
+func (m *maintenanceMode) set(req MaintenanceRequest) map[string][]heldDownlink {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if req.GatewayID == "" {
+		m.global = *req.Enabled
+	} else if *req.Enabled {
+		m.gateways[req.GatewayID] = true
+	} else {
+		delete(m.gateways, req.GatewayID)
+	}
+
+	released := make(map[string][]heldDownlink)
+	for id, queue := range m.held {
+		if m.global || m.gateways[id] {
+			continue
+		}
+		released[id] = queue
+		delete(m.held, id)
+	}
+	return released
+}
+
+func (m *maintenanceMode) status() MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := MaintenanceStatus{
+		Global:   m.global,
+		Gateways: make([]string, 0, len(m.gateways)),
+		Held:     make(map[string]int, len(m.held)),
+	}
+	for id := range m.gateways {
+		status.Gateways = append(status.Gateways, id)
+	}
+	sort.Strings(status.Gateways)
+	for id, queue := range m.held {
+		status.Held[id] = len(queue)
+	}
+	return status
+}
+
+// holdDownlink 网关维护中时不发送下行，返回 true。立即发送的 C 类下行（delay 为 0）暂存到维护结束；
+// 接收窗口内的下行（JOIN ACCEPT、ACK 等）维护结束时窗口早已过期，直接丢弃，设备会重试
+func (p *Processor) holdDownlink(gatewayID string, devAddr lorawan.DevAddr, phy lorawan.PHYPayload, rxInfo map[string]interface{}, delay time.Duration, override *DownlinkOverride) bool {
+	if delay > 0 {
+		if !p.maintenance.active(gatewayID) {
+			return false
+		}
+		logging.Frame().Info().
+			Str("gateway", gatewayID).
+			Str("devAddr", devAddr.String()).
+			Msg("维护模式，不发送接收窗口内的下行")
+		return true
+	}
+
+	held := p.maintenance.hold(gatewayID, heldDownlink{
+		devAddr:  devAddr,
+		phy:      phy,
+		rxInfo:   rxInfo,
+		override: override,
+		at:       time.Now(),
+	})
+	if held {
+		logging.Frame().Info().
+			Str("gateway", gatewayID).
+			Str("devAddr", devAddr.String()).
+			Msg("维护模式，暂存下行")
+	}
+	return held
+}
+
+// handleMaintenance 切换维护模式，结束维护时立即发送暂存的 C 类下行
+func (p *Processor) handleMaintenance(msg *nats.Msg) {
+	var req MaintenanceRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		log.Error().Err(err).Msg("解析维护模式请求失败")
+		return
+	}
+
+	var released map[string][]heldDownlink
+	if req.Enabled != nil {
+		released = p.maintenance.set(req)
+		log.Info().
+			Str("gateway", req.GatewayID).
+			Bool("enabled", *req.Enabled).
+			Msg("维护模式已切换")
+	}
+
+	for gatewayID, queue := range released {
+		for _, d := range queue {
+			// C 类设备持续接收，立即发送
+			p.scheduleDownlinkWithOverride(gatewayID, d.devAddr, d.phy, d.rxInfo, 0, d.override)
+		}
+		log.Info().
+			Str("gateway", gatewayID).
+			Int("downlinks", len(queue)).
+			Dur("oldest", time.Since(queue[0].at)).
+			Msg("维护结束，发送暂存的下行")
+	}
+
+	if msg.Reply != "" {
+		data, _ := json.Marshal(p.maintenance.status())
+		if err := msg.Respond(data); err != nil {
+			log.Error().Err(err).Msg("回复维护状态失败")
+		}
+	}
+}
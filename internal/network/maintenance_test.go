@@ -0,0 +1,150 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// setMaintenance 通过 NATS 请求处理函数切换维护模式
+func setMaintenance(p *Processor, gatewayID string, enabled bool) {
+	data, _ := json.Marshal(MaintenanceRequest{GatewayID: gatewayID, Enabled: &enabled})
+	p.handleMaintenance(&nats.Msg{Subject: MaintenanceSubject, Data: data})
+}
+
+func TestMaintenanceModeHoldAndRelease(t *testing.T) {
+	tests := []struct {
+		name         string
+		global       bool
+		gateways     []string
+		end          MaintenanceRequest
+		wantHeld     []string // hold 返回 true 的网关
+		wantReleased []string
+		wantStill    map[string]int // 结束后仍暂存的下行数
+	}{
+		{"global", true, nil, MaintenanceRequest{}, []string{"gw1", "gw2", "gw3"}, []string{"gw1", "gw2", "gw3"}, map[string]int{}},
+		{"one gateway", false, []string{"gw1"}, MaintenanceRequest{GatewayID: "gw1"}, []string{"gw1"}, []string{"gw1"}, map[string]int{}},
+		// 全局维护结束，单独维护的网关继续暂存
+		{"gateway still in maintenance", true, []string{"gw1"}, MaintenanceRequest{}, []string{"gw1", "gw2", "gw3"}, []string{"gw2", "gw3"}, map[string]int{"gw1": 1}},
+		{"other gateway ends", false, []string{"gw1", "gw2"}, MaintenanceRequest{GatewayID: "gw2"}, []string{"gw1", "gw2"}, []string{"gw2"}, map[string]int{"gw1": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMaintenanceMode(tt.global, tt.gateways)
+
+			var held []string
+			for _, id := range []string{"gw1", "gw2", "gw3"} {
+				if m.hold(id, heldDownlink{devAddr: testDevAddr, at: time.Now()}) {
+					held = append(held, id)
+				}
+			}
+			if !reflect.DeepEqual(held, tt.wantHeld) {
+				t.Errorf("held on %v, want %v", held, tt.wantHeld)
+			}
+
+			disabled := false
+			tt.end.Enabled = &disabled
+			var released []string
+			for id, queue := range m.set(tt.end) {
+				if len(queue) != 1 {
+					t.Errorf("released %d downlinks for %s, want 1", len(queue), id)
+				}
+				released = append(released, id)
+			}
+			sort.Strings(released)
+			if !reflect.DeepEqual(released, tt.wantReleased) {
+				t.Errorf("released %v, want %v", released, tt.wantReleased)
+			}
+			if got := m.status().Held; !reflect.DeepEqual(got, tt.wantStill) {
+				t.Errorf("still held %v, want %v", got, tt.wantStill)
+			}
+		})
+	}
+}
+
+func TestMaintenanceHoldsClassCDownlinks(t *testing.T) {
+	p, _, srv := newTestProcessor(t, nil)
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+	phy := lorawan.PHYPayload{MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataDown}, MACPayload: []byte{0xda, 0x1b, 0x01, 0x26, 0x00, 0x01, 0x00}}
+
+	setMaintenance(p, testGatewayID, true)
+
+	// 立即发送的 C 类下行暂存，接收窗口内的下行直接丢弃
+	p.scheduleDownlink(testGatewayID, testDevAddr, phy, testRxInfo(), 0)
+	p.scheduleDownlink(testGatewayID, testDevAddr, phy, testRxInfo(), time.Second)
+	if tx := nextTX(t, txs); tx != nil {
+		t.Fatal("downlink sent during maintenance")
+	}
+	if held := p.maintenance.status().Held[testGatewayID]; held != 1 {
+		t.Fatalf("%d downlinks held, want 1", held)
+	}
+
+	setMaintenance(p, testGatewayID, false)
+
+	tx := nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("held downlink not sent after maintenance")
+	}
+	if !tx.TXPK.Imme {
+		t.Error("released Class C downlink not sent immediately")
+	}
+	if extra := nextTX(t, txs); extra != nil {
+		t.Error("downlink in a receive window sent after maintenance")
+	}
+	if held := p.maintenance.status().Held; len(held) != 0 {
+		t.Errorf("downlinks still held after maintenance: %v", held)
+	}
+}
+
+func TestMaintenanceKeepsClassADownlinksQueued(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Network.OpportunisticDownlink = true
+	p, store, srv := newTestProcessor(t, cfg)
+	ctx := context.Background()
+	createTestDevice(t, store, testDevEUI)
+	saveTestSession(t, store, testDevEUI, "")
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+	fPort := uint8(1)
+
+	frame := &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), FPort: 10, Data: []byte{0xca, 0xfe}, IsPending: true}
+	store.CreateDownlinkFrame(ctx, frame)
+
+	setMaintenance(p, "", true)
+
+	// 上行照常接收，下行留在队列中
+	p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+	if tx := nextTX(t, txs); tx != nil {
+		t.Fatal("downlink sent during maintenance")
+	}
+	if pending, _ := store.GetPendingDownlinks(ctx, testDevEUI); len(pending) != 1 {
+		t.Fatalf("%d frames queued during maintenance, want 1", len(pending))
+	}
+	if session, _ := store.GetDeviceSession(ctx, testDevEUI); session.FCntUp != 1 {
+		t.Errorf("FCntUp = %d, uplink not processed during maintenance", session.FCntUp)
+	}
+
+	setMaintenance(p, "", false)
+
+	// 维护结束后的下一次上行时发送
+	p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, 2, &fPort, []byte{1}), testGatewayID, testRxInfo())
+	tx := nextTX(t, txs)
+	if tx == nil {
+		t.Fatal("queued downlink not sent after maintenance")
+	}
+	if _, mac := decodeDownlink(t, tx); mac.FPort == nil || *mac.FPort != 10 {
+		t.Errorf("FPort = %v, want 10", mac.FPort)
+	}
+	if pending, _ := store.GetPendingDownlinks(ctx, testDevEUI); len(pending) != 0 {
+		t.Errorf("%d frames still queued after delivery", len(pending))
+	}
+}
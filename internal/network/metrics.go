@@ -0,0 +1,76 @@
+package network
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// 网络服务器 Prometheus 指标，由 cmd/network-server 按 metrics.addr 暴露
+var (
+	uplinksReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lorawan_ns",
+		Name:      "uplinks_received_total",
+		Help:      "Uplink frames received from gateways (before deduplication), by message type.",
+	}, []string{"mtype"})
+
+	joinsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lorawan_ns",
+		Name:      "joins_total",
+		Help:      "Join requests handled, by result (accepted / rejected).",
+	}, []string{"result"})
+
+	micFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lorawan_ns",
+		Name:      "mic_failures_total",
+		Help:      "Uplinks dropped because the MIC check failed, by message type.",
+	}, []string{"mtype"})
+
+	duplicateFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lorawan_ns",
+		Name:      "duplicate_frames_dropped_total",
+		Help:      "Uplink copies dropped by deduplication, by message type.",
+	}, []string{"mtype"})
+
+	downlinksScheduled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lorawan_ns",
+		Name:      "downlinks_scheduled_total",
+		Help:      "Downlinks published to gateways, by timing mode (gps / context / timestamp / immediate / classb / beacon / multicast).",
+	}, []string{"timing"})
+
+	downlinkScheduleLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "lorawan_ns",
+		Name:      "downlink_schedule_latency_seconds",
+		Help:      "Time spent scheduling a downlink, from scheduleDownlink to the gateway TX publish.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	})
+)
+
+// join 结果
+const (
+	joinAccepted = "accepted"
+	joinRejected = "rejected"
+)
+
+// mtypeLabel 指标中使用的消息类型标签
+func mtypeLabel(mtype lorawan.MType) string {
+	switch mtype {
+	case lorawan.JoinRequest:
+		return "join_request"
+	case lorawan.UnconfirmedDataUp:
+		return "unconfirmed_data_up"
+	case lorawan.ConfirmedDataUp:
+		return "confirmed_data_up"
+	default:
+		return "other"
+	}
+}
+
+// observeDownlinkScheduled 记录一次成功发布的下行及其调度耗时
+func observeDownlinkScheduled(timing string, start time.Time) {
+	downlinksScheduled.WithLabelValues(timing).Inc()
+	downlinkScheduleLatency.Observe(time.Since(start).Seconds())
+}
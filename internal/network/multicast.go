@@ -0,0 +1,220 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// MulticastDownlinkSubject 组播下行请求的 NATS 主题，请求带 reply 时返回 MulticastDownlinkReply
+func MulticastDownlinkSubject(groupID uuid.UUID) string {
+	return fmt.Sprintf("ns.multicast.%s.tx", groupID)
+}
+
+// MulticastDownlinkRequest 组播下行请求，Data 为明文 FRMPayload
+type MulticastDownlinkRequest struct {
+	FPort uint8  `json:"fPort"`
+	Data  []byte `json:"data"`
+}
+
+// MulticastDownlinkReply 组播下行的处理结果
+type MulticastDownlinkReply struct {
+	Status   string   `json:"status"` // scheduled / failed
+	Error    string   `json:"error,omitempty"`
+	FCnt     uint32   `json:"fCnt"`
+	Gateways []string `json:"gateways,omitempty"`
+}
+
+// handleMulticastDownlink 用组播会话密钥加密一次，向覆盖组成员的每个网关各发送一次。
+// 目前只支持 C 类组播：在组的频率/速率上立即发送
+func (p *Processor) handleMulticastDownlink(msg *nats.Msg) {
+	parts := strings.Split(msg.Subject, ".")
+	if len(parts) != 4 {
+		return
+	}
+	groupID, err := uuid.Parse(parts[2])
+	if err != nil {
+		log.Error().Err(err).Str("subject", msg.Subject).Msg("解析组播组 ID 失败")
+		return
+	}
+
+	var req MulticastDownlinkRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		log.Error().Err(err).Msg("解析组播下行请求失败")
+		return
+	}
+
+	reply, err := p.sendMulticastDownlink(context.Background(), groupID, req)
+	if err != nil {
+		log.Error().Err(err).Str("multicastGroup", groupID.String()).Msg("组播下行失败")
+		reply = &MulticastDownlinkReply{Status: "failed", Error: err.Error()}
+	}
+	if msg.Reply != "" {
+		data, _ := json.Marshal(reply)
+		if err := msg.Respond(data); err != nil {
+			log.Error().Err(err).Msg("回复组播下行请求失败")
+		}
+	}
+}
+
+// sendMulticastDownlink 构建组播下行并发布给覆盖组成员的网关，错误信息返回给请求方
+func (p *Processor) sendMulticastDownlink(ctx context.Context, groupID uuid.UUID, req MulticastDownlinkRequest) (*MulticastDownlinkReply, error) {
+	if !lorawan.ValidApplicationFPort(req.FPort) {
+		return nil, fmt.Errorf("fPort must be between 1 and 223")
+	}
+
+	group, err := p.store.GetMulticastGroup(ctx, groupID)
+	if err == storage.ErrNotFound {
+		return nil, fmt.Errorf("multicast group not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if group.GroupType == models.MulticastGroupClassB {
+		return nil, fmt.Errorf("class B multicast is not supported yet")
+	}
+	if n, ok := p.region.MaxPayloadSizePerDR[group.DR]; ok && len(req.Data) > n {
+		return nil, fmt.Errorf("payload of %d bytes exceeds the DR%d maximum of %d", len(req.Data), group.DR, n)
+	}
+
+	gateways := p.multicastGateways(group)
+	if len(gateways) == 0 {
+		return nil, fmt.Errorf("no gateway has heard from any group member")
+	}
+
+	fCnt, err := p.store.NextMulticastGroupFCnt(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	phy := multicastPHYPayload(group, fCnt, req.FPort, req.Data)
+
+	freq := group.Frequency
+	if freq == 0 {
+		freq = p.getRegionRX2Freq()
+	}
+
+	scheduled := make([]string, 0, len(gateways))
+	for _, gatewayID := range gateways {
+		if p.maintenance.active(gatewayID) {
+			logging.Frame().Info().
+				Str("gateway", gatewayID).
+				Str("multicastGroup", group.ID.String()).
+				Msg("维护模式，跳过组播下行")
+			continue
+		}
+		if p.publishMulticast(ctx, gatewayID, group, phy, freq) {
+			scheduled = append(scheduled, gatewayID)
+		}
+	}
+	if len(scheduled) == 0 {
+		return nil, fmt.Errorf("no gateway accepted the multicast downlink")
+	}
+
+	logging.Frame().Info().
+		Str("multicastGroup", group.ID.String()).
+		Str("mcAddr", group.McAddr.String()).
+		Uint32("fCnt", fCnt).
+		Uint8("fPort", req.FPort).
+		Int("dataLen", len(req.Data)).
+		Int("members", len(group.DevEUIs)).
+		Strs("gateways", scheduled).
+		Msg("组播下行已调度")
+
+	return &MulticastDownlinkReply{Status: "scheduled", FCnt: fCnt, Gateways: scheduled}, nil
+}
+
+// multicastGateways 组成员最近上行经过的网关（去重、排序），从未上行的成员不计入
+func (p *Processor) multicastGateways(group *models.MulticastGroup) []string {
+	seen := make(map[string]bool)
+	var gateways []string
+	for _, devEUI := range group.DevEUIs {
+		gatewayID := p.getLastGatewayForDevice(lorawan.EUI64(devEUI))
+		if gatewayID == "" || seen[gatewayID] {
+			continue
+		}
+		seen[gatewayID] = true
+		gateways = append(gateways, gatewayID)
+	}
+	sort.Strings(gateways)
+	return gateways
+}
+
+// multicastPHYPayload 用组播会话密钥加密 FRMPayload 并计算 MIC，组播下行固定为非确认帧
+func multicastPHYPayload(group *models.MulticastGroup, fCnt uint32, fPort uint8, data []byte) lorawan.PHYPayload {
+	macPayload := lorawan.MACPayload{
+		FHDR: lorawan.FHDR{
+			DevAddr: lorawan.DevAddr(group.McAddr),
+			FCnt:    uint16(fCnt & 0xFFFF),
+		},
+		FPort: &fPort,
+	}
+
+	appSKey, _ := hex.DecodeString(group.McAppSKey)
+	macPayload.FRMPayload, _ = crypto.DecryptFRMPayload(appSKey, false, [4]byte(group.McAddr), fCnt, data)
+	macBytes, _ := macPayload.Marshal(lorawan.UnconfirmedDataDown, false)
+
+	phy := lorawan.PHYPayload{
+		MHDR: lorawan.MHDR{
+			MType: lorawan.UnconfirmedDataDown,
+			Major: lorawan.LoRaWAN1_0,
+		},
+		MACPayload: macBytes,
+	}
+	phy.SetDownlinkDataMIC(lorawan.LoRaWAN1_0, fCnt, sessionKey(group.McNwkSKey))
+	return phy
+}
+
+// publishMulticast 把组播下行发布给网关立即发送，成功返回 true
+func (p *Processor) publishMulticast(ctx context.Context, gatewayID string, group *models.MulticastGroup, phy lorawan.PHYPayload, freq uint32) bool {
+	start := time.Now()
+
+	phyBytes, _ := phy.MarshalBinary()
+	dataRate := p.getDRString(uint8(group.DR))
+	codeRate := p.config.Network.DownlinkCodeRate
+	if codeRate == "" {
+		codeRate = defaultCodeRate
+	}
+	if airtime, err := lorawan.TimeOnAir(dataRate, codeRate, len(phyBytes), false); err == nil {
+		p.dutyCycle.Record(gatewayID, airtime)
+	}
+
+	rfCh := p.getGatewayMeta(ctx, gatewayID).rfChain(freq)
+	txpk := loraTXPacket(float64(freq)/1000000.0, rfCh, dataRate, codeRate, phyBytes)
+	txpk.Imme = true
+
+	msg := models.GatewayTXMessage{
+		Version:   models.GatewayProtocolVersion,
+		GatewayID: gatewayID,
+		TXPK:      txpk,
+		TraceID:   logging.TraceID(ctx),
+	}
+
+	data, _ := json.Marshal(msg)
+	subject := fmt.Sprintf("gateway.%s.tx", gatewayID)
+
+	if err := p.nc.Publish(subject, data); err != nil {
+		logging.Ctx(ctx).Error().
+			Err(err).
+			Str("subject", subject).
+			Msg("发布下行消息失败")
+		p.logDownlinkFrame(ctx, gatewayID, txpk, "publish failed: "+err.Error())
+		return false
+	}
+	p.logDownlinkFrame(ctx, gatewayID, txpk, "immediate: multicast "+group.ID.String())
+	observeDownlinkScheduled("multicast", start)
+	return true
+}
@@ -0,0 +1,130 @@
+package network
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+const (
+	// nbTransWindow 估算丢包率使用的最近上行数
+	nbTransWindow = 20
+	// nbTransMinSamples 样本少于此数时不调整 NbTrans
+	nbTransMinSamples = 10
+)
+
+// uplinkLossTracker 按 FCnt 间隔估算每个设备的上行丢包率
+type uplinkLossTracker struct {
+	mu    sync.Mutex
+	fCnts map[lorawan.EUI64][]uint32
+}
+
+func newUplinkLossTracker() *uplinkLossTracker {
+	return &uplinkLossTracker{fCnts: make(map[lorawan.EUI64][]uint32)}
+}
+
+// Record 记录一次上行，返回最近窗口内的丢包率和样本数。
+// 同一 FCnt 的重传只计一次；FCnt 回退（重新入网）时重新统计。
+func (t *uplinkLossTracker) Record(devEUI lorawan.EUI64, fCnt uint32) (loss float64, samples int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window := t.fCnts[devEUI]
+	if n := len(window); n > 0 {
+		last := window[n-1]
+		switch {
+		case fCnt == last:
+		case fCnt < last:
+			window = []uint32{fCnt}
+		default:
+			window = append(window, fCnt)
+		}
+	} else {
+		window = []uint32{fCnt}
+	}
+	if len(window) > nbTransWindow {
+		window = window[len(window)-nbTransWindow:]
+	}
+	t.fCnts[devEUI] = window
+
+	samples = len(window)
+	expected := window[samples-1] - window[0] + 1
+	return 1 - float64(samples)/float64(expected), samples
+}
+
+// Forget 清除设备的丢包统计
+func (t *uplinkLossTracker) Forget(devEUI lorawan.EUI64) {
+	t.mu.Lock()
+	delete(t.fCnts, devEUI)
+	t.mu.Unlock()
+}
+
+// sessionNbTrans 会话当前的 NbTrans，0（未设置）按规范默认 1
+func sessionNbTrans(session *models.DeviceSession) uint8 {
+	if session.NbTrans == 0 {
+		return 1
+	}
+	return session.NbTrans
+}
+
+// adrNbTrans 根据丢包率决定 NbTrans：丢包少时减少重传，丢包多时增加，结果限制在 [1, max]
+func adrNbTrans(current uint8, max int, loss float64) uint8 {
+	next := int(current)
+	switch {
+	case loss < 0.05:
+		next--
+	case loss < 0.10:
+	case loss < 0.30:
+		next++
+	default:
+		next = max
+	}
+
+	if next > max {
+		next = max
+	}
+	if next < 1 {
+		next = 1
+	}
+	return uint8(next)
+}
+
+// appendNbTransReq ADR 开启且设备配置文件允许时，按丢包率调整 NbTrans
+func (p *Processor) appendNbTransReq(ctx context.Context, session *models.DeviceSession, fCnt uint32, cmds []lorawan.MACCommand) []lorawan.MACCommand {
+	devEUI := lorawan.EUI64(session.DevEUI)
+	loss, samples := p.uplinkLoss.Record(devEUI, fCnt)
+
+	if !session.ADR || samples < nbTransMinSamples {
+		return cmds
+	}
+	profile := p.deviceProfile(ctx, devEUI)
+	if profile == nil || profile.MaxNbTrans <= 0 {
+		return cmds
+	}
+
+	current := sessionNbTrans(session)
+	next := adrNbTrans(current, profile.MaxNbTrans, loss)
+	if next == current || p.macHandler.LinkADRPending(session.DevEUI) {
+		return cmds
+	}
+	for _, cmd := range cmds {
+		// 本次已有 ADR 速率调整的 LinkADRReq，不再追加
+		if cmd.CID == lorawan.LinkADRReq {
+			return cmds
+		}
+	}
+
+	log.Info().
+		Str("devEUI", devEUI.String()).
+		Float64("loss", loss).
+		Int("samples", samples).
+		Uint8("nbTrans", current).
+		Uint8("newNbTrans", next).
+		Msg("ADR 调整 NbTrans")
+
+	return append(cmds, *p.macHandler.NbTransReq(session, profile, next))
+}
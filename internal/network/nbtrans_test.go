@@ -0,0 +1,141 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestUplinkLossTracker(t *testing.T) {
+	tests := []struct {
+		name        string
+		fCnts       []uint32
+		wantLoss    float64
+		wantSamples int
+	}{
+		{"single", []uint32{5}, 0, 1},
+		{"contiguous", []uint32{1, 2, 3, 4}, 0, 4},
+		{"one lost", []uint32{1, 2, 4}, 0.25, 3},
+		{"retransmission counted once", []uint32{1, 1, 2, 2, 3}, 0, 3},
+		{"rejoin restarts", []uint32{10, 12, 14, 1, 2}, 0, 2},
+		// 窗口只保留最近 20 个上行，更早的丢包不再计入
+		{"window", append([]uint32{1, 5}, seqFCnts(10, 29)...), 0, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newUplinkLossTracker()
+			var loss float64
+			var samples int
+			for _, fCnt := range tt.fCnts {
+				loss, samples = tracker.Record(testDevEUI, fCnt)
+			}
+			if loss != tt.wantLoss || samples != tt.wantSamples {
+				t.Errorf("Record() = %v, %d, want %v, %d", loss, samples, tt.wantLoss, tt.wantSamples)
+			}
+		})
+	}
+}
+
+func seqFCnts(from, to uint32) []uint32 {
+	var fCnts []uint32
+	for f := from; f <= to; f++ {
+		fCnts = append(fCnts, f)
+	}
+	return fCnts
+}
+
+func TestAdrNbTrans(t *testing.T) {
+	tests := []struct {
+		current uint8
+		max     int
+		loss    float64
+		want    uint8
+	}{
+		{3, 3, 0, 2},
+		{1, 3, 0.01, 1},
+		{2, 3, 0.07, 2},
+		{1, 3, 0.2, 2},
+		{3, 3, 0.2, 3},
+		{1, 3, 0.5, 3},
+		{5, 3, 0.07, 3},
+	}
+
+	for _, tt := range tests {
+		if got := adrNbTrans(tt.current, tt.max, tt.loss); got != tt.want {
+			t.Errorf("adrNbTrans(%d, %d, %v) = %d, want %d", tt.current, tt.max, tt.loss, got, tt.want)
+		}
+	}
+}
+
+func TestLossyLinkRaisesNbTrans(t *testing.T) {
+	tests := []struct {
+		name        string
+		nbTrans     uint8
+		fCnts       []uint32
+		maxNbTrans  int
+		ansStatus   byte
+		wantReq     uint8 // 0 表示不下发
+		wantSession uint8
+	}{
+		// 13 个中丢 3 个，约 23%
+		{"lossy link", 1, []uint32{1, 2, 3, 5, 6, 7, 9, 10, 11, 13}, 3, 0x07, 2, 2},
+		{"heavy loss", 1, []uint32{1, 3, 5, 7, 9, 11, 13, 15, 17, 19}, 3, 0x07, 3, 3},
+		{"good link lowers", 3, seqFCnts(1, 10), 3, 0x07, 2, 2},
+		{"device rejects", 1, []uint32{1, 2, 3, 5, 6, 7, 9, 10, 11, 13}, 3, 0x06, 2, 1},
+		{"profile disabled", 1, []uint32{1, 3, 5, 7, 9, 11, 13, 15, 17, 19}, 0, 0x07, 0, 1},
+		{"too few samples", 1, []uint32{1, 3, 5, 7, 9}, 3, 0x07, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, _ := newTestProcessor(t, nil)
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", MaxNbTrans: tt.maxNbTrans}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+			session := saveTestSession(t, store, testDevEUI, "")
+			session.ADR = true
+			session.NbTrans = tt.nbTrans
+
+			var reqs []lorawan.MACCommand
+			for _, fCnt := range tt.fCnts {
+				for _, cmd := range p.appendNbTransReq(ctx, session, fCnt, nil) {
+					if cmd.CID == lorawan.LinkADRReq {
+						reqs = append(reqs, cmd)
+					}
+				}
+			}
+
+			if tt.wantReq == 0 {
+				if len(reqs) != 0 {
+					t.Fatalf("sent %d LinkADRReq, want none", len(reqs))
+				}
+				return
+			}
+			// 等待 LinkADRAns 期间不重复下发
+			if len(reqs) != 1 {
+				t.Fatalf("sent %d LinkADRReq, want 1", len(reqs))
+			}
+			if got := reqs[0].Payload[3] & 0x0F; got != tt.wantReq {
+				t.Errorf("LinkADRReq NbTrans = %d, want %d", got, tt.wantReq)
+			}
+			if session.NbTrans != tt.nbTrans {
+				t.Errorf("session NbTrans changed to %d before LinkADRAns", session.NbTrans)
+			}
+
+			p.macHandler.HandleUplink(session, profile, []lorawan.MACCommand{{CID: lorawan.LinkADRAns, Payload: []byte{tt.ansStatus}}})
+			if session.NbTrans != tt.wantSession {
+				t.Errorf("session NbTrans = %d after LinkADRAns %#02x, want %d", session.NbTrans, tt.ansStatus, tt.wantSession)
+			}
+			if p.macHandler.LinkADRPending(session.DevEUI) {
+				t.Error("LinkADRReq still pending after LinkADRAns")
+			}
+		})
+	}
+}
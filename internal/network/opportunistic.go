@@ -0,0 +1,52 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// phyOverhead MHDR、FHDR（不含 FOpts）、FPort 和 MIC 的字节数
+const phyOverhead = 13
+
+// allowOpportunisticDownlink 判断网关占空比是否允许在本次 RX 窗口发送队列中的应用下行
+func (p *Processor) allowOpportunisticDownlink(gatewayID string, rxInfo map[string]interface{}, frame *models.DownlinkFrame) bool {
+	datr, _ := rxInfo["datr"].(string)
+	codr, _ := rxInfo["codr"].(string)
+
+	airtime, err := lorawan.TimeOnAir(datr, codr, phyOverhead+len(frame.Data), false)
+	if err != nil {
+		// 无法估算时按不限制处理
+		return true
+	}
+
+	if !p.dutyCycle.Allow(gatewayID, airtime, p.config.CN470.MAC.MaxDutyCycle) {
+		logging.Frame().Info().
+			Str("gateway", gatewayID).
+			Str("frameID", frame.ID.String()).
+			Dur("airtime", airtime).
+			Msg("网关占空比已满，应用下行留在队列中")
+		return false
+	}
+	return true
+}
+
+// markDownlinkFrameSent 把已发送的应用下行移出队列
+func (p *Processor) markDownlinkFrameSent(ctx context.Context, frame *models.DownlinkFrame) {
+	now := time.Now()
+	frame.IsPending = false
+	frame.TransmittedAt = &now
+
+	if err := p.store.UpdateDownlinkFrame(ctx, frame); err != nil {
+		log.Error().Err(err).
+			Str("devEUI", hex.EncodeToString(frame.DevEUI[:])).
+			Str("frameID", frame.ID.String()).
+			Msg("更新下行队列状态失败")
+	}
+}
@@ -0,0 +1,100 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestOpportunisticDownlink(t *testing.T) {
+	fPort := uint8(1)
+
+	tests := []struct {
+		name          string
+		opportunistic bool
+		dutyCycle     int           // mac.max_duty_cycle（百分比）
+		used          time.Duration // 网关最近一小时已用的空中时间
+		delivered     bool
+	}{
+		{"delivered after unconfirmed uplink", true, 0, 0, true},
+		{"within duty cycle", true, 1, 10 * time.Second, true},
+		{"duty cycle exhausted", true, 1, 36 * time.Second, false},
+		{"option disabled", false, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.OpportunisticDownlink = tt.opportunistic
+			cfg.CN470.MAC.MaxDutyCycle = tt.dutyCycle
+			p, store, srv := newTestProcessor(t, cfg)
+			ctx := context.Background()
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			if tt.used > 0 {
+				p.dutyCycle.Record(testGatewayID, tt.used)
+			}
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			frame := &models.DownlinkFrame{DevEUI: models.EUI64(testDevEUI), FPort: 10, Data: []byte{0xca, 0xfe}, IsPending: true}
+			store.CreateDownlinkFrame(ctx, frame)
+
+			p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+
+			tx := nextTX(t, txs)
+			if (tx != nil) != tt.delivered {
+				t.Fatalf("downlink sent = %v, want %v", tx != nil, tt.delivered)
+			}
+
+			pending, _ := store.GetPendingDownlinks(ctx, testDevEUI)
+			if tt.delivered == (len(pending) != 0) {
+				t.Errorf("%d frames still queued, delivered %v", len(pending), tt.delivered)
+			}
+			if !tt.delivered {
+				return
+			}
+
+			_, mac := decodeDownlink(t, tx)
+			if mac.FPort == nil || *mac.FPort != 10 {
+				t.Fatalf("FPort = %v, want 10", mac.FPort)
+			}
+			key, _ := hex.DecodeString(testKey)
+			plain, _ := crypto.DecryptFRMPayload(key, false, [4]byte(testDevAddr), uint32(mac.FHDR.FCnt), mac.FRMPayload)
+			if !bytes.Equal(plain, frame.Data) {
+				t.Errorf("payload = %x, want %x", plain, frame.Data)
+			}
+		})
+	}
+}
+
+func TestDutyCycleTracker(t *testing.T) {
+	d := newDutyCycleTracker()
+	if !d.Allow(testGatewayID, time.Hour, 0) {
+		t.Error("percent 0 limited airtime")
+	}
+
+	// 1% 为每小时 36 秒
+	d.Record(testGatewayID, 30*time.Second)
+	if !d.Allow(testGatewayID, 6*time.Second, 1) {
+		t.Error("airtime up to the limit rejected")
+	}
+	if d.Allow(testGatewayID, 7*time.Second, 1) {
+		t.Error("airtime over the limit allowed")
+	}
+	if !d.Allow("aabbccddeeff0011", 30*time.Second, 1) {
+		t.Error("airtime of another gateway counted")
+	}
+
+	// 窗口外的记录不计入
+	d.gateways[testGatewayID][0].at = time.Now().Add(-2 * dutyCycleWindow)
+	if !d.Allow(testGatewayID, 36*time.Second, 1) {
+		t.Error("expired airtime still counted")
+	}
+}
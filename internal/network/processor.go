@@ -3,7 +3,6 @@ package network
 import (
 	"context"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -15,6 +14,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/framelog"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
@@ -28,12 +29,16 @@ type TimestampTracker struct {
 	mu sync.RWMutex
 	// 每个网关的时间戳历史
 	gatewayTimestamps map[string]*GatewayTimestampInfo
+
+	driftThreshold int64            // 漂移阈值（微秒），0 使用默认 500ms
+	onAlert        func(ClockAlert) // 时钟变为不可靠或重置时回调
 }
 type GatewayTimestampInfo struct {
 	LastUplink     uint64    // 最后一次上行时间戳
 	LastUplinkTime time.Time // 最后一次上行的系统时间
 	TimestampDrift int64     // 时间戳漂移量
 	ResetCount     int       // 检测到的重置次数
+	DriftCount     int       // 漂移超过阈值的次数
 	IsReliable     bool      // 时间戳是否可靠
 	WarmupCount    int       // 新增：预热计数
 }
@@ -104,6 +109,9 @@ type DeviceRxInfo struct {
 	GatewayID string
 	RxInfo    map[string]interface{}
 	Timestamp time.Time
+
+	// 收到同一上行的所有网关，下行时从中选择信号最好的
+	Candidates *gatewayCandidates
 }
 
 // Processor 处理 LoRaWAN 数据包
@@ -120,7 +128,46 @@ type Processor struct {
 
 	// 添加去重缓存
 	joinCache        *SimpleCache
+	gatewayCache     *SimpleCache // 网关元数据（标签、位置）
+	profileCache     *SimpleCache // 设备帧计数器位宽
+	ackCache         *SimpleCache // 已发送的确认上行 ACK，设备重传时重发
 	timestampTracker *TimestampTracker
+	gpsTime          *GPSTimeSource // 网关 GPS 时间估计（Class B）
+	dutyCycle        *dutyCycleTracker
+	uplinkLimiter    *uplinkRateLimiter // 每设备上行限速
+	uplinkLoss       *uplinkLossTracker // 上行丢包率（ADR NbTrans）
+
+	// 设备会话锁，串行化下行计数器分配
+	deviceLocks *deviceLocker
+	// 入网锁，同一设备同时只处理一个 JOIN
+	joinLocks *deviceLocker
+
+	// 等待 TX_ACK 的下行，按网关索引
+	pendingTx      map[string]*pendingTxInfo
+	lastRX1        map[string]*scheduledRX1 // TX_ACK 时序错误时在 RX2 重发
+	pendingTxMutex sync.Mutex
+
+	// 上行帧异步批量写入，未启用时为 nil（同步写入）
+	frameWriter *storage.UplinkFrameWriter
+
+	// 重放检查的布隆过滤器快速路径，未启用时为 nil（每次查询存储）
+	replayFilter *replayFilter
+
+	// JOIN ACCEPT 下发的 NetID，DevAddr 按其 NwkID 前缀分配
+	netID lorawan.NetID
+
+	// 协议调试帧日志，未启用时为 nil
+	frameLog     *framelog.Logger
+	frameResults *SimpleCache
+
+	// 维护模式，暂停下行发送
+	maintenance *maintenanceMode
+
+	// Class B 信标和 ping slot 下行，未启用时为 nil
+	classB *ClassBScheduler
+
+	// 已告警过的不兼容网关桥消息版本
+	protocolWarned sync.Map
 }
 
 // 修改NewProcessor构造函数
@@ -130,18 +177,56 @@ func NewProcessor(nc *nats.Conn, store storage.Store, cfg *config.Config) *Proce
 		regionName = "CN470"
 	}
 
-	return &Processor{
+	p := &Processor{
 		nc:            nc,
 		store:         store,
 		region:        lorawan.GetRegionConfiguration(regionName),
-		macHandler:    NewMACCommandHandler(store, regionName),
+		macHandler:    NewMACCommandHandler(store, regionName, cfg.CN470.ADR),
 		config:        cfg,
 		deviceRxCache: make(map[lorawan.EUI64]*DeviceRxInfo),
 		joinCache:     NewSimpleCache(), // 使用简单缓存
+		gatewayCache:  NewSimpleCache(),
+		profileCache:  NewSimpleCache(),
+		ackCache:      NewSimpleCache(),
 		timestampTracker: &TimestampTracker{
 			gatewayTimestamps: make(map[string]*GatewayTimestampInfo),
+			driftThreshold:    cfg.Network.ClockDriftThreshold.Microseconds(),
 		},
+		gpsTime:       NewGPSTimeSource(),
+		dutyCycle:     newDutyCycleTracker(),
+		uplinkLimiter: newUplinkRateLimiter(),
+		uplinkLoss:    newUplinkLossTracker(),
+		deviceLocks:   newDeviceLocker(),
+		joinLocks:     newDeviceLocker(),
+		pendingTx:     make(map[string]*pendingTxInfo),
+		lastRX1:       make(map[string]*scheduledRX1),
+		maintenance:   newMaintenanceMode(cfg.Network.Maintenance, cfg.Network.MaintenanceGateways),
+		frameResults:  NewSimpleCache(),
 	}
+
+	if cfg.Network.ClockAlerts {
+		p.timestampTracker.onAlert = p.publishClockAlert
+	}
+
+	if cfg.CN470.MAC.SupportsClassB {
+		p.classB = NewClassBScheduler(p)
+	}
+
+	if cfg.Database.UplinkBatch.Enabled {
+		p.frameWriter = storage.NewUplinkFrameWriter(store, cfg.Database.UplinkBatch)
+	}
+
+	if cfg.Network.ReplayFilter.Enabled {
+		p.replayFilter = newReplayFilter(cfg.Network.ReplayFilter.Entries, cfg.Network.ReplayFilter.FalsePositiveRate)
+	}
+
+	frameLog, err := framelog.New(cfg.Log.FrameLog, store)
+	if err != nil {
+		log.Error().Err(err).Msg("创建帧日志失败，帧日志未启用")
+	}
+	p.frameLog = frameLog
+
+	return p
 }
 
 // UpdateAndCheck 更新并检查时间戳可靠性 - 优化版
@@ -151,6 +236,14 @@ func (t *TimestampTracker) UpdateAndCheck(gatewayID string, uplinkTmst uint64, i
 		return true, 0
 	}
 
+	// 告警在释放锁之后回调
+	var alert *ClockAlert
+	defer func() {
+		if alert != nil && t.onAlert != nil {
+			t.onAlert(*alert)
+		}
+	}()
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -219,7 +312,10 @@ func (t *TimestampTracker) UpdateAndCheck(gatewayID string, uplinkTmst uint64, i
 	drift = timestampDiff - expectedDiff
 
 	// 阈值定义
-	const DRIFT_THRESHOLD = int64(500000)    // 500ms漂移阈值
+	DRIFT_THRESHOLD := int64(500000) // 500ms漂移阈值
+	if t.driftThreshold > 0 {
+		DRIFT_THRESHOLD = t.driftThreshold
+	}
 	const RESET_THRESHOLD = int64(-10000000) // 10秒回退表示重置
 
 	// 判断可靠性
@@ -235,13 +331,18 @@ func (t *TimestampTracker) UpdateAndCheck(gatewayID string, uplinkTmst uint64, i
 			Uint64("last", info.LastUplink).
 			Int("resetCount", info.ResetCount).
 			Msg("检测到网关时间戳重置")
+
+		alert = newClockAlert(ClockAlertReset, gatewayID, drift, info)
 	} else if math.Abs(float64(drift)) > float64(DRIFT_THRESHOLD) {
 		// 漂移过大
+		info.DriftCount++
 		if info.IsReliable {
 			log.Warn().
 				Str("gateway", gatewayID).
 				Int64("drift", drift).
 				Msg("时间戳漂移超过阈值")
+
+			alert = newClockAlert(ClockAlertDrift, gatewayID, drift, info)
 		}
 		info.IsReliable = false
 	} else {
@@ -317,8 +418,12 @@ func (p *Processor) Start(ctx context.Context) error {
 		return fmt.Errorf("CN470配置验证失败: %w", err)
 	}
 
+	if err := p.loadNetID(); err != nil {
+		return fmt.Errorf("NetID配置验证失败: %w", err)
+	}
+
 	// 订阅网关接收数据（上行）
-	subRx, err := p.nc.Subscribe("gateway.*.rx", p.handleGatewayRX)
+	subRx, err := p.queueSubscribe("gateway.*.rx", p.handleGatewayRX)
 	if err != nil {
 		return fmt.Errorf("订阅上行失败: %w", err)
 	}
@@ -328,8 +433,47 @@ func (p *Processor) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("订阅下行失败: %w", err)
 	}
+
+	// 订阅组播下行请求，多实例时只由一个实例发送
+	subMulticast, err := p.queueSubscribe("ns.multicast.*.tx", p.handleMulticastDownlink)
+	if err != nil {
+		return fmt.Errorf("订阅组播下行失败: %w", err)
+	}
+
+	// 订阅网关 TX_ACK
+	subTxAck, err := p.nc.Subscribe("gateway.*.txack", p.handleGatewayTxAck)
+	if err != nil {
+		return fmt.Errorf("订阅 TX_ACK 失败: %w", err)
+	}
+
+	// 订阅网关状态，用 stat.time 估计 GPS 时间
+	subStat, err := p.nc.Subscribe("gateway.*.stat", p.handleGatewayStat)
+	if err != nil {
+		return fmt.Errorf("订阅网关状态失败: %w", err)
+	}
+
+	// 订阅维护模式切换
+	subMaintenance, err := p.nc.Subscribe(MaintenanceSubject, p.handleMaintenance)
+	if err != nil {
+		return fmt.Errorf("订阅维护模式失败: %w", err)
+	}
+
+	// 管理端查询内存缓存状态
+	subCacheDebug, err := p.nc.Subscribe(CacheDebugSubject, p.handleCacheDebug)
+	if err != nil {
+		return fmt.Errorf("订阅缓存诊断失败: %w", err)
+	}
 	// 启动时间戳清理
 	go p.timestampTracker.StartCleanup(ctx)
+	if p.config.Network.ClockAlerts {
+		go p.publishClockStats(ctx)
+	}
+	if p.classB != nil {
+		go p.classB.Run(ctx)
+	}
+	if p.replayFilter != nil {
+		go p.loadReplayFilter(ctx)
+	}
 	log.Info().
 		Str("region", p.region.Name).
 		Msg("Network Server 处理器启动，已订阅上行和下行消息")
@@ -337,6 +481,19 @@ func (p *Processor) Start(ctx context.Context) error {
 	<-ctx.Done()
 	subRx.Unsubscribe()
 	subTx.Unsubscribe()
+	subMulticast.Unsubscribe()
+	subTxAck.Unsubscribe()
+	subStat.Unsubscribe()
+	subMaintenance.Unsubscribe()
+	subCacheDebug.Unsubscribe()
+
+	if p.frameWriter != nil {
+		p.frameWriter.Close()
+		log.Info().Msg("上行帧缓冲已写入数据库")
+	}
+	if err := p.frameLog.Close(); err != nil {
+		log.Error().Err(err).Msg("关闭帧日志失败")
+	}
 	return nil
 }
 
@@ -350,7 +507,7 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 	}
 	devEUIStr := parts[2]
 
-	log.Info().
+	logging.Frame().Info().
 		Str("subject", msg.Subject).
 		Str("devEUI", devEUIStr).
 		Msg("收到设备下行请求")
@@ -362,6 +519,8 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 		Data      []byte `json:"data"`
 		Confirmed bool   `json:"confirmed"`
 		ID        string `json:"id"`
+
+		Override *DownlinkOverride `json:"override,omitempty"`
 	}
 
 	if err := json.Unmarshal(msg.Data, &downReq); err != nil {
@@ -379,19 +538,56 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], devEUIBytes)
 
+	// 应用下行只能使用 1-223；FPort 0 的 MAC 命令走 FOpts 队列
+	if !lorawan.ValidApplicationFPort(downReq.FPort) {
+		log.Error().Str("devEUI", devEUIStr).Uint8("fPort", downReq.FPort).Msg("下行 FPort 无效")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, "fPort must be between 1 and 223")
+		return
+	}
+
+	if err := downReq.Override.Validate(p.config); err != nil {
+		log.Error().Err(err).Str("devEUI", devEUIStr).Msg("下行参数覆盖无效")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, err.Error())
+		return
+	}
+
 	ctx := context.Background()
 
+	// 锁定设备会话，直到下行计数器保存
+	unlock := p.deviceLocks.Lock(devEUI)
+	defer unlock()
+
 	// 获取设备会话
 	session, err := p.store.GetDeviceSession(ctx, devEUI)
 	if err != nil {
 		log.Error().Err(err).Str("devEUI", devEUIStr).Msg("获取设备会话失败")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, "device session not found")
 		return
 	}
 
+	// C 类设备随时可以接收，不需要等待上行，立即在 RX2 发送；
+	// 启用 Class B 时 B 类设备的下行安排到下一个 ping slot
+	profile := p.deviceProfile(ctx, devEUI)
+	classC := profile != nil && profile.DeviceClass == models.DeviceClassC
+	classB := profile != nil && profile.DeviceClass == models.DeviceClassB && p.classB != nil
+
 	// 获取最近使用的网关信息
 	gatewayID := p.getLastGatewayForDevice(devEUI)
+	if gatewayID == "" && (classB || classC) {
+		log.Error().Str("devEUI", devEUIStr).Msg("B/C 类设备从未上行，无法选择网关")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, "device has never been heard from")
+		return
+	}
+	if gatewayID == "" && p.config.NATS.QueueGroup != "" {
+		// 多实例部署时设备上行可能由其他实例处理，由持有上行缓存的实例发送；
+		// 仍然回复请求方，不发布失败事件，其他实例可能已经调度
+		logging.Frame().Debug().Str("devEUI", devEUIStr).Msg("本实例没有设备上行缓存，忽略下行请求")
+		replyDownlinkRequest(msg, downReq.ID, "no uplink cache for device on this instance")
+		return
+	}
 	if gatewayID == "" {
 		log.Error().Str("devEUI", devEUIStr).Msg("无法找到设备的网关")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, "no gateway for device")
 		return
 	}
 
@@ -399,6 +595,49 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 	lastRxInfo := p.getLastRxInfoForDevice(devEUI)
 	if lastRxInfo == nil {
 		log.Error().Str("devEUI", devEUIStr).Msg("无法找到设备的上行信息")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, "no recent uplink for device")
+		return
+	}
+
+	// 网关维护中：A 类下行留在设备队列中，维护结束后的下一次上行时发送；
+	// C 类下行暂存到维护结束，暂存已满时同样留在队列中
+	if !classB && p.maintenance.active(gatewayID) && (!classC || !p.maintenance.canHold(gatewayID)) {
+		logging.Frame().Info().
+			Str("devEUI", devEUIStr).
+			Str("gateway", gatewayID).
+			Bool("classC", classC).
+			Msg("维护模式，下行留在设备队列中")
+		replyDownlinkRequest(msg, downReq.ID, "")
+		return
+	}
+
+	var slot classBSlot
+	if classB {
+		slot, err = p.classB.Reserve(gatewayID, devEUI, lorawan.DevAddr(session.DevAddr), profile)
+		if err != nil {
+			log.Error().Err(err).Str("devEUI", devEUIStr).Str("gatewayID", gatewayID).Msg("无法安排 Class B ping slot")
+			p.failDownlinkRequest(msg, devEUI, downReq.ID, "no class B ping slot available")
+			return
+		}
+	}
+
+	// 负载不能超过本次下行所用速率的上限，否则网关无法发送
+	maxPayload := p.maxDownlinkPayload(session, lastRxInfo)
+	switch {
+	case classB:
+		if n, ok := p.region.MaxPayloadSizePerDR[slot.dr]; ok {
+			maxPayload = n
+		}
+	case classC || !downReq.Override.Empty():
+		maxPayload, _ = MaxDownlinkPayloadSize(p.config, session, profile, downReq.Override)
+	}
+	if len(downReq.Data) > maxPayload {
+		log.Error().
+			Str("devEUI", devEUIStr).
+			Int("dataLen", len(downReq.Data)).
+			Int("maxPayload", maxPayload).
+			Msg("下行负载超过当前速率的最大负载")
+		p.failDownlinkRequest(msg, devEUI, downReq.ID, fmt.Sprintf("payload of %d bytes exceeds the %d byte maximum at the current data rate", len(downReq.Data), maxPayload))
 		return
 	}
 
@@ -411,6 +650,8 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 	}
 
 	// 构建 MAC payload
+	fCnt := downlinkFCnt(session, &downReq.FPort)
+	sentFCnt := *fCnt
 	macPayload := lorawan.MACPayload{
 		FHDR: lorawan.FHDR{
 			DevAddr: lorawan.DevAddr(session.DevAddr),
@@ -418,33 +659,20 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 				ADR: false,
 				ACK: false,
 			},
-			FCnt: uint16(session.NFCntDown & 0xFFFF),
+			FCnt: uint16(sentFCnt & 0xFFFF),
 		},
 		FPort: &downReq.FPort,
 	}
 
-	// 加密数据（使用 DecryptFRMPayload，因为在 LoRaWAN 中加密和解密是相同操作）
-	if downReq.FPort == 0 {
-		// Port 0: 使用 NwkSEncKey（MAC 命令）
-		key, _ := hex.DecodeString(session.NwkSEncKey)
-		macPayload.FRMPayload, _ = crypto.DecryptFRMPayload(
-			key,
-			false,
-			[4]byte(session.DevAddr),
-			session.NFCntDown,
-			downReq.Data,
-		)
-	} else {
-		// 应用数据：使用 AppSKey
-		key, _ := hex.DecodeString(session.AppSKey)
-		macPayload.FRMPayload, _ = crypto.DecryptFRMPayload(
-			key,
-			false,
-			[4]byte(session.DevAddr),
-			session.NFCntDown,
-			downReq.Data,
-		)
-	}
+	// 应用数据使用 AppSKey 加密（DecryptFRMPayload 加解密是相同操作）
+	appSKey, _ := hex.DecodeString(session.AppSKey)
+	macPayload.FRMPayload, _ = crypto.DecryptFRMPayload(
+		appSKey,
+		false,
+		[4]byte(session.DevAddr),
+		sentFCnt,
+		downReq.Data,
+	)
 
 	// 序列化 MAC payload
 	macBytes, _ := macPayload.Marshal(mtype, false)
@@ -459,51 +687,56 @@ func (p *Processor) handleDeviceDownlinkRequest(msg *nats.Msg) {
 	}
 
 	// 设置 MIC
-	sNwkSIntKey, _ := hex.DecodeString(session.SNwkSIntKey)
-	var key lorawan.AES128Key
-	copy(key[:], sNwkSIntKey)
-	phyPayload.SetDownlinkDataMIC(lorawan.LoRaWAN1_0, session.NFCntDown, key)
+	p.setDownlinkMIC(&phyPayload, session, sentFCnt, macPayload.FHDR.FCtrl.ACK)
 
 	// 更新帧计数器
-	session.NFCntDown++
+	*fCnt++
+	if downReq.Confirmed {
+		session.ConfFCnt = sentFCnt
+	}
 	p.store.SaveDeviceSession(ctx, session)
 
-	log.Info().
+	logging.Frame().Info().
 		Str("devEUI", devEUIStr).
 		Str("gatewayID", gatewayID).
-		Uint32("fcnt", session.NFCntDown-1).
+		Uint32("fcnt", sentFCnt).
 		Uint8("fPort", downReq.FPort).
 		Int("dataLen", len(downReq.Data)).
+		Bool("classB", classB).
+		Bool("classC", classC).
 		Msg("调度设备下行")
 
-	// 计算下行延迟
-	delay := time.Duration(p.config.CN470.RXWindows.RX1Delay) * time.Second
+	if classB {
+		p.classB.Schedule(ctx, gatewayID, lorawan.DevAddr(session.DevAddr), phyPayload, slot)
+	} else {
+		// 计算下行延迟
+		override, delay := p.resolveDownlinkWindow(downReq.Override, sessionRX1Delay(session), profile)
+		if classC {
+			override, delay = p.classCDownlinkWindow(downReq.Override, profile), 0
+		}
 
-	// 发送到网关
-	p.scheduleDownlink(gatewayID, lorawan.DevAddr(session.DevAddr), phyPayload, lastRxInfo, delay)
+		// 发送到网关
+		p.scheduleDownlinkWithOverride(gatewayID, lorawan.DevAddr(session.DevAddr), phyPayload, lastRxInfo, delay, override)
+	}
+	p.recordLastDownlink(session, gatewayID, &downReq.FPort, sentFCnt, downReq.Confirmed, downReq.ID)
+	replyDownlinkRequest(msg, downReq.ID, "")
 }
 
 // handleGatewayRX 处理网关接收数据
 func (p *Processor) handleGatewayRX(msg *nats.Msg) {
-	var rxMsg struct {
-		GatewayID string                 `json:"gatewayID"`
-		RXPK      map[string]interface{} `json:"rxpk"`
-		Context   string                 `json:"context"` // ✅ 添加 context
-		Timestamp int64                  `json:"timestamp"`
-	}
-
+	var rxMsg models.GatewayRXMessage
 	if err := json.Unmarshal(msg.Data, &rxMsg); err != nil {
 		log.Error().Err(err).Msg("解析 RX 消息失败")
 		return
 	}
+	p.checkGatewayProtocol(rxMsg.GatewayID, rxMsg.Version)
 
 	// 获取 PHY payload
-	dataStr, ok := rxMsg.RXPK["data"].(string)
-	if !ok {
+	if rxMsg.RXPK.Data == "" {
 		return
 	}
 
-	phyPayloadBytes, err := base64.StdEncoding.DecodeString(dataStr)
+	phyPayloadBytes, err := base64.StdEncoding.DecodeString(rxMsg.RXPK.Data)
 	if err != nil {
 		log.Error().Err(err).Msg("解码 PHY payload 失败")
 		return
@@ -513,12 +746,33 @@ func (p *Processor) handleGatewayRX(msg *nats.Msg) {
 	var phyPayload lorawan.PHYPayload
 	if err := phyPayload.UnmarshalBinary(phyPayloadBytes); err != nil {
 		log.Error().Err(err).Msg("解析 PHY payload 失败")
+		p.logUplinkFrame(rxMsg.GatewayID, phyPayloadBytes, rxMsg.RXPK, rxMsg.TraceID, "invalid PHYPayload: "+err.Error())
 		return
 	}
-	rxInfo := rxMsg.RXPK
+	rxInfo := rxMsg.RXPK.RxInfo()
+	uplinksReceived.WithLabelValues(mtypeLabel(phyPayload.MHDR.MType)).Inc()
+
+	// 记录网关时间戳，用于定时下行前的可靠性判断
+	if tmst := getUint64(rxInfo, "tmst"); tmst > 0 {
+		p.timestampTracker.UpdateAndCheck(rxMsg.GatewayID, tmst, false)
+
+		// GPS 同步的网关会带 tmms（自 GPS 起点的毫秒数）
+		if tmms := getUint64(rxInfo, "tmms"); tmms > 0 {
+			p.gpsTime.UpdateFromRX(rxMsg.GatewayID, tmms, uint32(tmst), time.Now())
+		}
+	}
+
 	if rxMsg.Context != "" {
 		rxInfo["context"] = rxMsg.Context // ✅ 传递 context
 	}
+
+	// 追踪 ID 随 rxInfo 传到上行处理、下行和应用消息；旧版网关桥没有时在此生成
+	if rxMsg.TraceID == "" {
+		rxMsg.TraceID = logging.NewTraceID()
+	}
+	rxInfo[logging.TraceIDField] = rxMsg.TraceID
+	defer p.logUplinkFrame(rxMsg.GatewayID, phyPayloadBytes, rxMsg.RXPK, rxMsg.TraceID, "")
+
 	// 根据消息类型处理
 	switch phyPayload.MHDR.MType {
 	case lorawan.JoinRequest:
@@ -529,6 +783,7 @@ func (p *Processor) handleGatewayRX(msg *nats.Msg) {
 		log.Warn().
 			Uint8("mtype", uint8(phyPayload.MHDR.MType)).
 			Msg("未处理的消息类型")
+		p.setFrameResult(traceContext(rxInfo), "unhandled message type")
 	}
 }
 
@@ -543,10 +798,12 @@ func reverseEUI64(eui lorawan.EUI64) lorawan.EUI64 {
 // handleJoinRequest 处理入网请求
 // handleJoinRequest 处理入网请求 - ChirpStack 风格实现
 func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string, rxInfo map[string]interface{}) {
+	ctx := traceContext(rxInfo)
+
 	// 解析 Join Request
 	var joinReq lorawan.JoinRequestPayload
 	if err := joinReq.UnmarshalBinary(phy.MACPayload); err != nil {
-		log.Error().Err(err).Msg("解析 Join Request 失败")
+		logging.Ctx(ctx).Error().Err(err).Msg("解析 Join Request 失败")
 		return
 	}
 
@@ -556,23 +813,33 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		hex.EncodeToString(joinReq.DevNonce[:]),
 	)
 
-	if _, found := p.joinCache.Get(joinKey); found {
-		log.Debug().
+	if v, found := p.joinCache.Get(joinKey); found {
+		// 记录其他网关收到的副本，供 JOIN ACCEPT 选择网关
+		if candidates, ok := v.(*gatewayCandidates); ok {
+			candidates.add(gatewayID, rxInfo)
+		}
+		logging.Ctx(ctx).Debug().
 			Str("devEUI", joinReq.DevEUI.String()).
+			Str("gateway", gatewayID).
 			Msg("忽略重复的 JOIN REQUEST")
+		p.setFrameResult(ctx, frameResultDuplicate)
+		duplicateFrames.WithLabelValues(mtypeLabel(phy.MHDR.MType)).Inc()
 		return
 	}
 
 	// 标记已处理（10秒过期）
-	p.joinCache.Set(joinKey, true, 10*time.Second)
+	receivedAt := time.Now()
+	joinCandidates := newGatewayCandidates(gatewayID, rxInfo)
+	p.joinCache.Set(joinKey, joinCandidates, 10*time.Second)
 
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Str("joinEUI", joinReq.JoinEUI.String()).
 		Hex("devNonce", joinReq.DevNonce[:]).
 		Msg("收到 JOIN REQUEST")
 
-	ctx := context.Background()
+	// LoRaWAN 1.1 的 JSIntKey 和 JOIN ACCEPT MIC 使用空口字节序的 DevEUI/JoinEUI
+	wireDevEUI, wireJoinEUI := joinReq.DevEUI, joinReq.JoinEUI
 
 	// 获取设备密钥
 	keys, err := p.store.GetDeviceKeys(ctx, joinReq.DevEUI)
@@ -581,59 +848,147 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		reversedDevEUI := reverseEUI64(joinReq.DevEUI)
 		keys, err = p.store.GetDeviceKeys(ctx, reversedDevEUI)
 		if err != nil {
-			log.Error().
+			logging.Ctx(ctx).Error().
 				Err(err).
 				Str("devEUI", joinReq.DevEUI.String()).
 				Msg("获取设备密钥失败")
+			p.setFrameResult(ctx, "unknown device")
+			joinsTotal.WithLabelValues(joinRejected).Inc()
 			return
 		}
 		joinReq.DevEUI = reversedDevEUI
 	}
 
 	// 验证 MIC
-	appKeyBytes, err := hex.DecodeString(keys.AppKey)
+	appKey, err := lorawan.ParseAES128Key(keys.AppKey)
 	if err != nil {
-		log.Error().Err(err).Msg("解析AppKey失败")
+		logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("解析AppKey失败")
 		return
 	}
 	// 添加这行日志来查看实际使用的AppKey
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Str("usedAppKey", keys.AppKey). // ← 这里会显示您使用的AppKey
 		Msg("正在使用的AppKey")
-	var appKey lorawan.AES128Key
-	copy(appKey[:], appKeyBytes)
 
-	micOK, err := phy.ValidateUplinkJoinMIC(appKey)
+	// LoRaWAN 1.1 设备（配置文件 MAC 版本 1.1 且配置了 NwkKey）的 JOIN 使用 NwkKey 校验和加密，
+	// 1.0.x 设备使用 AppKey
+	profile := p.deviceProfile(ctx, joinReq.DevEUI)
+	lorawan11 := profile != nil && lorawan.IsMACVersion11(profile.MACVersion) && keys.NwkKey != ""
+	rootKey, rootKeyName := appKey, "AppKey"
+	if lorawan11 {
+		if rootKey, err = lorawan.ParseAES128Key(keys.NwkKey); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("解析NwkKey失败")
+			return
+		}
+		rootKeyName = "NwkKey"
+	}
+
+	micOK, err := phy.ValidateUplinkJoinMIC(rootKey)
 	if err != nil || !micOK {
-		log.Error().
+		logging.Ctx(ctx).Error().
 			Str("devEUI", joinReq.DevEUI.String()).
 			Bool("micOK", micOK).
+			Bool("lorawan11", lorawan11).
 			Msg("JOIN REQUEST MIC验证失败")
+		p.recordDeviceError(ctx, joinReq.DevEUI, models.DeviceErrorMICFailure, "join request MIC check failed, "+rootKeyName+" mismatch", nil, gatewayID)
+		micFailures.WithLabelValues(mtypeLabel(phy.MHDR.MType)).Inc()
+		joinsTotal.WithLabelValues(joinRejected).Inc()
 		return
 	}
 
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Msg("✅ JOIN REQUEST MIC验证成功")
 
+	// 不同 DevNonce 的 JOIN 同时到达时会互相删除对方刚建立的会话，
+	// 只处理先到的一个，设备收不到 JOIN ACCEPT 会自行重试
+	unlockJoin, ok := p.joinLocks.TryLock(joinReq.DevEUI)
+	if !ok {
+		logging.Ctx(ctx).Warn().
+			Str("devEUI", joinReq.DevEUI.String()).
+			Hex("devNonce", joinReq.DevNonce[:]).
+			Msg("设备正在处理另一个 JOIN，忽略本次 JOIN REQUEST")
+		return
+	}
+	defer unlockJoin()
+
 	// 获取设备信息
 	device, err := p.store.GetDevice(ctx, joinReq.DevEUI)
 	if err != nil {
-		log.Error().Err(err).Msg("获取设备信息失败")
+		logging.Ctx(ctx).Error().Err(err).Msg("获取设备信息失败")
+		return
+	}
+
+	// 仅 ABP 的设备不能通过 OTAA 入网
+	if profile != nil && profile.ABPOnly {
+		p.rejectABPOnlyJoin(ctx, device, joinReq.DevNonce)
+		joinsTotal.WithLabelValues(joinRejected).Inc()
+		return
+	}
+
+	// 拒绝重放的 JOIN：DevNonce 在空口为小端序
+	devNonce := uint16(joinReq.DevNonce[0]) | uint16(joinReq.DevNonce[1])<<8
+	reason, err := p.checkDevNonce(ctx, joinReq.JoinEUI, joinReq.DevEUI, devNonce, lorawan11)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("检查DevNonce失败")
+		return
+	}
+	if reason != "" {
+		p.rejectDevNonceReplay(ctx, device, joinReq.JoinEUI, devNonce, reason, gatewayID)
+		joinsTotal.WithLabelValues(joinRejected).Inc()
 		return
 	}
 
 	// 生成网络参数
-	devAddr := p.generateDevAddr()
-	joinNonce := p.generateJoinNonce()
-	netID := [3]byte{0x01, 0xa6, 0xdb}
+	devAddr := p.allocateDevAddr(ctx, device)
+	joinNonce, err := p.nextJoinNonce(ctx, joinReq.DevEUI)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("分配JoinNonce失败")
+		return
+	}
+	netID := [3]byte(p.netID)
 
 	// 生成会话密钥
-	appSKey := p.deriveAppSKey(joinNonce, netID, joinReq.DevNonce, keys.AppKey)
-	fNwkSIntKey := p.deriveFNwkSIntKey(joinNonce, netID, joinReq.DevNonce, keys.NwkKey)
-	sNwkSIntKey := p.deriveSNwkSIntKey(joinNonce, netID, joinReq.DevNonce, keys.NwkKey)
-	nwkSEncKey := p.deriveNwkSEncKey(joinNonce, netID, joinReq.DevNonce, keys.NwkKey)
+	var appSKey, fNwkSIntKey, sNwkSIntKey, nwkSEncKey lorawan.AES128Key
+	if lorawan11 {
+		appSKey, fNwkSIntKey, sNwkSIntKey, nwkSEncKey, err = lorawan.DeriveSessionKeys11(rootKey[:], appKey[:], joinNonce, wireJoinEUI, joinReq.DevNonce)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("派生LoRaWAN 1.1会话密钥失败")
+			return
+		}
+	} else {
+		// LoRaWAN 1.0.x 设备没有单独的 NwkKey，使用 AppKey
+		nwkKey := keys.NwkKey
+		if nwkKey == "" {
+			nwkKey = keys.AppKey
+		}
+		appSKey, err = p.deriveAppSKey(joinNonce, netID, joinReq.DevNonce, keys.AppKey)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("派生AppSKey失败")
+			return
+		}
+		fNwkSIntKey, err = p.deriveFNwkSIntKey(joinNonce, netID, joinReq.DevNonce, nwkKey)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("解析NwkKey失败")
+			return
+		}
+		sNwkSIntKey, _ = p.deriveSNwkSIntKey(joinNonce, netID, joinReq.DevNonce, nwkKey)
+		nwkSEncKey, _ = p.deriveNwkSEncKey(joinNonce, netID, joinReq.DevNonce, nwkKey)
+	}
+
+	// JOIN 将被接受，记录 DevNonce；此前失败的 JOIN 不占用 DevNonce
+	reason, err = p.recordDevNonce(ctx, joinReq.JoinEUI, joinReq.DevEUI, devNonce)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("devEUI", joinReq.DevEUI.String()).Msg("记录DevNonce失败")
+		return
+	}
+	if reason != "" {
+		p.rejectDevNonceReplay(ctx, device, joinReq.JoinEUI, devNonce, reason, gatewayID)
+		joinsTotal.WithLabelValues(joinRejected).Inc()
+		return
+	}
+
 	// ✅ 增强：清理设备相关的所有缓存
 	// 清理设备接收缓存
 	p.rxCacheMutex.Lock()
@@ -643,19 +998,19 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 	delete(p.deviceRxCache, reversedDevEUI)
 	p.rxCacheMutex.Unlock()
 
-	log.Debug().
+	logging.Ctx(ctx).Debug().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Msg("清理设备缓存")
 	// ✅ 新增：清理旧会话
 	// 每次新的 JOIN 成功时，删除旧的设备会话
 	err = p.store.DeleteDeviceSession(ctx, joinReq.DevEUI)
 	if err != nil && err != storage.ErrNotFound {
-		log.Warn().
+		logging.Ctx(ctx).Warn().
 			Err(err).
 			Str("devEUI", joinReq.DevEUI.String()).
 			Msg("删除旧设备会话失败，但继续处理JOIN")
 	} else if err == nil {
-		log.Info().
+		logging.Ctx(ctx).Info().
 			Str("devEUI", joinReq.DevEUI.String()).
 			Msg("✅ 已清理旧设备会话")
 	}
@@ -668,12 +1023,12 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 	device.DevAddr = &newDevAddr // 更新新的DevAddr
 
 	if err := p.store.UpdateDevice(ctx, device); err != nil {
-		log.Error().
+		logging.Ctx(ctx).Error().
 			Err(err).
 			Str("devEUI", joinReq.DevEUI.String()).
 			Msg("重置设备帧计数器失败")
 	} else {
-		log.Info().
+		logging.Ctx(ctx).Info().
 			Str("devEUI", joinReq.DevEUI.String()).
 			Str("newDevAddr", devAddr.String()).
 			Msg("✅ 设备帧计数器已重置")
@@ -688,20 +1043,29 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		FNwkSIntKey: hex.EncodeToString(fNwkSIntKey[:]),
 		SNwkSIntKey: hex.EncodeToString(sNwkSIntKey[:]),
 		NwkSEncKey:  hex.EncodeToString(nwkSEncKey[:]),
+		MACVersion:  sessionMACVersion(profile, lorawan11),
 		FCntUp:      0, // ✅ 明确设置为0
 		NFCntDown:   0, // ✅ 明确设置为0
 		AFCntDown:   0, // ✅ 明确设置为0
 		ConfFCnt:    0, // ✅ 明确设置为0
-		RX1Delay:    5, // 标准5秒延迟
-		RX2DR:       uint8(p.region.DefaultRX2DR),
-		RX2Freq:     p.getRegionRX2Freq(),
+		RX1Delay:    p.joinRxDelay(profile),
+		NbTrans:     1,
 	}
+	rx2Freq, rx2DR := p.deviceRX2(profile)
+	session.RX2Freq, session.RX2DR = rx2Freq, uint8(rx2DR)
 
 	if err := p.store.SaveDeviceSession(ctx, session); err != nil {
-		log.Error().Err(err).Msg("保存设备会话失败")
+		logging.Ctx(ctx).Error().Err(err).Msg("保存设备会话失败")
 		return
 	}
 
+	// 新会话的 FCnt 从 0 开始，丢包统计重新开始
+	p.uplinkLoss.Forget(joinReq.DevEUI)
+	if p.classB != nil {
+		p.classB.Forget(joinReq.DevEUI)
+	}
+	p.macHandler.ForgetADR(models.EUI64(joinReq.DevEUI))
+
 	// 更新设备网关缓存
 	p.updateDeviceRxCache(joinReq.DevEUI, gatewayID, rxInfo)
 
@@ -711,29 +1075,30 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		NetID:     netID,
 		DevAddr:   devAddr,
 		DLSettings: lorawan.DLSettings{
+			OptNeg:      lorawan11,
 			RX1DROffset: 0,
-			RX2DataRate: uint8(p.region.DefaultRX2DR),
+			RX2DataRate: session.RX2DR,
 		},
-		RxDelay: 5, // 5 秒延迟
+		RxDelay: session.RX1Delay,
 	}
 
 	// CN470 添加 CFList
-	if p.region.Name == "CN470" && p.shouldUseCFList() {
+	if p.region.Name == "CN470" && p.shouldUseCFList(profile) {
 		cfList := p.generateCN470CFList()
 		if len(cfList) == 16 {
 			joinAccept.CFList = cfList
-			log.Info().
+			logging.Ctx(ctx).Info().
 				Hex("cfList", cfList).
 				Msg("✅ 添加 CN470 CFList")
 		} else {
-			log.Error().
+			logging.Ctx(ctx).Error().
 				Int("len", len(cfList)).
 				Msg("❌ CFList 长度错误")
 		}
 	}
 
 	// 在生成JOIN ACCEPT后，序列化前添加
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Hex("joinNonce", joinNonce[:]).
 		Hex("netID", netID[:]).
 		Str("devAddr", devAddr.String()).
@@ -746,11 +1111,11 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 	// 序列化并加密 Join Accept
 	joinAcceptBytes, err := joinAccept.MarshalBinary()
 	if err != nil {
-		log.Error().Err(err).Msg("序列化JOIN ACCEPT失败")
+		logging.Ctx(ctx).Error().Err(err).Msg("序列化JOIN ACCEPT失败")
 		return
 	}
 
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Hex("marshaledBytes", joinAcceptBytes).
 		Int("len", len(joinAcceptBytes)).
 		Msg("JOIN ACCEPT序列化后（加密前）")
@@ -764,26 +1129,36 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		MACPayload: joinAcceptBytes,
 	}
 
-	// 使用修改后的方法，传入 JOIN REQUEST 的参数
-	if err := acceptPHY.SetJoinAcceptMIC(appKey); err != nil {
-		log.Error().Err(err).Msg("设置JOIN ACCEPT MIC失败")
+	// 使用修改后的方法，传入 JOIN REQUEST 的参数；LoRaWAN 1.1 使用 JSIntKey
+	if lorawan11 {
+		jsIntKey, err := lorawan.DeriveJSIntKey(rootKey[:], wireDevEUI)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("派生JSIntKey失败")
+			return
+		}
+		if err := acceptPHY.SetJoinAcceptMIC11(jsIntKey, lorawan.JoinReqTypeJoinRequest, wireJoinEUI, joinReq.DevNonce); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("设置JOIN ACCEPT MIC失败")
+			return
+		}
+	} else if err := acceptPHY.SetJoinAcceptMIC(appKey); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("设置JOIN ACCEPT MIC失败")
 		return
 	}
 	// 调试：记录加密前的状态
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Hex("joinAcceptPlain", joinAcceptBytes).
 		Hex("micPlain", acceptPHY.MIC[:]).
 		Int("plainLen", len(joinAcceptBytes)).
 		Msg("JOIN ACCEPT 加密前")
 	// 加密 JOIN ACCEPT payload（包括MIC）
-	if err := acceptPHY.EncryptJoinAcceptPayload(appKey); err != nil {
-		log.Error().Err(err).Msg("加密JOIN ACCEPT失败")
+	if err := acceptPHY.EncryptJoinAcceptPayload(rootKey); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("加密JOIN ACCEPT失败")
 		return
 	}
 
 	// 调试日志
 	phyBytes, _ := acceptPHY.MarshalBinary()
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Str("devAddr", devAddr.String()).
 		Str("joinAcceptHex", hex.EncodeToString(phyBytes)).
@@ -792,7 +1167,7 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		Hex("encryptedHex", phyBytes).
 		Msg("生成 JOIN ACCEPT")
 	// 在生成JOIN ACCEPT后添加
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Str("devAddr", devAddr.String()).
 		Hex("joinNonce", joinNonce[:]).
@@ -809,14 +1184,23 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 		// 默认使用标准的5秒延迟
 		joinAcceptDelay = 5 * time.Second
 	}
-	// 发送 Join Accept - 使用标准5秒延迟
-	p.scheduleDownlink(gatewayID, devAddr, acceptPHY, rxInfo, joinAcceptDelay)
+	// 收集其他网关的副本后，选择信号最好的网关发送，不阻塞上行处理
+	go func() {
+		gatewayID, rxInfo := p.selectJoinGateway(joinReq.DevEUI, joinCandidates, receivedAt)
 
-	// 如果启用了 RX2 备份
-	if p.shouldScheduleRX2() {
-		go func() {
-			// 等待一小段时间避免竞争
-			time.Sleep(100 * time.Millisecond)
+		// 按网关能力选择 RX1 / RX2
+		sendRX1, sendRX2 := p.joinAcceptWindows(ctx, gatewayID, rxInfo, profile)
+
+		// 发送 Join Accept - 使用标准5秒延迟
+		if sendRX1 {
+			p.scheduleDownlink(gatewayID, devAddr, acceptPHY, rxInfo, joinAcceptDelay)
+		}
+
+		if sendRX2 {
+			if sendRX1 {
+				// 等待一小段时间避免竞争
+				time.Sleep(100 * time.Millisecond)
+			}
 
 			// RX2 使用配置的延迟
 			var rx2Delay time.Duration
@@ -827,56 +1211,47 @@ func (p *Processor) handleJoinRequest(phy *lorawan.PHYPayload, gatewayID string,
 				rx2Delay = 6 * time.Second
 			}
 
-			// RX2 参数
-			rx2Info := make(map[string]interface{})
-			for k, v := range rxInfo {
-				rx2Info[k] = v
-			}
-			rx2Info["freq"] = float64(p.getRegionRX2Freq()) / 1000000.0
-			rx2Info["datr"] = p.getDRString(uint8(p.region.DefaultRX2DR))
+			// RX2 参数：直接使用设备的 RX2 参数，不经过下行频率计算
+			rx2 := p.rx2Override(profile)
 
-			log.Debug().
-				Float64("rx2Freq", rx2Info["freq"].(float64)).
-				Str("rx2DR", rx2Info["datr"].(string)).
+			logging.Ctx(ctx).Debug().
+				Uint32("rx2Freq", rx2.Frequency).
+				Int("rx2DR", *rx2.DataRate).
 				Dur("rx2Delay", rx2Delay).
 				Msg("调度 RX2 JOIN ACCEPT")
 
-			p.scheduleDownlink(gatewayID, devAddr, acceptPHY, rx2Info, rx2Delay)
-		}()
-	}
+			p.scheduleDownlinkWithOverride(gatewayID, devAddr, acceptPHY, rxInfo, rx2Delay, rx2)
+		}
+	}()
 
 	// 发布入网事件
 	p.publishJoinEvent(device, devAddr)
+	joinsTotal.WithLabelValues(joinAccepted).Inc()
 
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", joinReq.DevEUI.String()).
 		Str("devAddr", devAddr.String()).
 		Msg("✅ JOIN 处理完成")
 }
 
-// 辅助函数：是否应该使用 CFList
-func (p *Processor) shouldUseCFList() bool {
-	// 基于配置或设备特性判断
-	// E78-470LN22S 可能不支持 CFList
-	if os.Getenv("DISABLE_CFLIST") == "true" {
-		return false
+// shouldUseCFList JOIN ACCEPT 是否携带 CFList：设备配置文件 supportsCFList 优先
+// （E78-470LN22S 等型号不支持 CFList），未设置时 DISABLE_CFLIST=true 可全局关闭
+func (p *Processor) shouldUseCFList(profile *models.DeviceProfile) bool {
+	if profile != nil && profile.SupportsCFList != nil {
+		return *profile.SupportsCFList
 	}
-	return true
-}
-
-// 辅助函数：是否应该调度 RX2
-func (p *Processor) shouldScheduleRX2() bool {
-	// 可以基于配置决定
-	return os.Getenv("ENABLE_RX2_JOIN") == "true"
+	return os.Getenv("DISABLE_CFLIST") != "true"
 }
 
 // handleDataUp 处理上行数据 - 修改：添加缓存更新和上行帧保存
 func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxInfo map[string]interface{}) {
+	ctx := traceContext(rxInfo)
+
 	// 解析 MAC payload
 	var macPayload lorawan.MACPayload
 	isUplink := phy.MHDR.MType == lorawan.UnconfirmedDataUp || phy.MHDR.MType == lorawan.ConfirmedDataUp
 	if err := macPayload.Unmarshal(phy.MACPayload, phy.MHDR.MType, isUplink); err != nil {
-		log.Error().Err(err).Msg("解析 MAC payload 失败")
+		logging.Ctx(ctx).Error().Err(err).Msg("解析 MAC payload 失败")
 		return
 	}
 
@@ -886,8 +1261,17 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 		macPayload.FHDR.FCnt,
 		hex.EncodeToString(phy.MIC[:]),
 	)
-	if _, found := p.joinCache.Get(uplinkKey); found {
-		log.Debug().
+	if v, found := p.joinCache.Get(uplinkKey); found {
+		// 记录其他网关收到的副本，供下行选择网关
+		if candidates, ok := v.(*gatewayCandidates); ok {
+			candidates.add(gatewayID, rxInfo)
+		}
+		p.setFrameResult(ctx, frameResultDuplicate)
+		duplicateFrames.WithLabelValues(mtypeLabel(phy.MHDR.MType)).Inc()
+		if phy.MHDR.MType == lorawan.ConfirmedDataUp && p.resendACK(uplinkKey, gatewayID, rxInfo) {
+			return
+		}
+		logging.FrameCtx(ctx).Debug().
 			Str("devAddr", macPayload.FHDR.DevAddr.String()).
 			Uint16("fcnt", macPayload.FHDR.FCnt).
 			Msg("忽略重复的上行数据")
@@ -895,57 +1279,74 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 	}
 
 	// 标记已处理（5秒过期）
-	p.joinCache.Set(uplinkKey, true, 30*time.Second)
-
-	ctx := context.Background()
+	candidates := newGatewayCandidates(gatewayID, rxInfo)
+	p.joinCache.Set(uplinkKey, candidates, 30*time.Second)
 
 	// 通过 DevAddr 查找设备会话
 	sessions, err := p.store.GetDeviceSessionByDevAddr(ctx, macPayload.FHDR.DevAddr)
 	if err != nil || len(sessions) == 0 {
-		log.Warn().
+		logging.Ctx(ctx).Warn().
 			Str("devAddr", macPayload.FHDR.DevAddr.String()).
 			Msg("未找到设备会话")
+		p.setFrameResult(ctx, "unknown device")
 		return
 	}
 
 	// 验证 MIC 并找到正确的设备
 	var validSession *models.DeviceSession
+	var supports32Bit bool
 	for _, session := range sessions {
-		fNwkSIntKey, _ := hex.DecodeString(session.FNwkSIntKey)
-		_, _ = hex.DecodeString(session.SNwkSIntKey)
-
-		var key lorawan.AES128Key
-		copy(key[:], fNwkSIntKey)
-
-		valid, err := phy.ValidateUplinkDataMIC(
-			lorawan.LoRaWAN1_0,
-			session.FCntUp,
-			0, 0,
-			key,
-			lorawan.AES128Key{},
+		// 16 位计数器设备不重建高 16 位
+		is32Bit := p.supports32BitFCnt(ctx, lorawan.EUI64(session.DevEUI))
+		valid, err := p.validUplinkMIC(phy, &macPayload, session,
+			lorawan.FullFCnt(session.FCntUp, macPayload.FHDR.FCnt, is32Bit),
+			rxInfo,
 		)
 
 		if err == nil && valid {
 			validSession = session
+			supports32Bit = is32Bit
 			break
 		}
 	}
 
 	if validSession == nil {
-		log.Warn().Msg("MIC 验证失败")
+		logging.Ctx(ctx).Warn().Msg("MIC 验证失败")
+		micFailures.WithLabelValues(mtypeLabel(phy.MHDR.MType)).Inc()
+		// 无法确定是哪个设备，同一 DevAddr 下的设备都记录
+		fCnt := uint32(macPayload.FHDR.FCnt)
+		for _, session := range sessions {
+			p.recordDeviceError(ctx, lorawan.EUI64(session.DevEUI), models.DeviceErrorMICFailure,
+				"uplink MIC check failed, session keys mismatch", &fCnt, gatewayID)
+		}
 		return
 	}
 
+	// 锁定设备会话，ACK/MAC 下行与 API 下行不能同时分配计数器
+	unlock := p.deviceLocks.Lock(lorawan.EUI64(validSession.DevEUI))
+	defer unlock()
+
+	// 加锁后重新读取下行计数器，期间可能已有其他下行
+	if fresh, err := p.store.GetDeviceSession(ctx, lorawan.EUI64(validSession.DevEUI)); err == nil {
+		validSession.NFCntDown = fresh.NFCntDown
+		validSession.AFCntDown = fresh.AFCntDown
+		validSession.FCntDown = fresh.FCntDown
+		validSession.ConfFCnt = fresh.ConfFCnt
+	}
+
 	// 更新设备网关缓存
 	p.updateDeviceRxCache(lorawan.EUI64(validSession.DevEUI), gatewayID, rxInfo)
+	p.setRxCandidates(lorawan.EUI64(validSession.DevEUI), candidates)
 
 	// 更新帧计数器
-	fullFCnt := lorawan.GetFullFCnt(validSession.FCntUp, macPayload.FHDR.FCnt)
+	fullFCnt := lorawan.FullFCnt(validSession.FCntUp, macPayload.FHDR.FCnt, supports32Bit)
+	lastFCntUp := validSession.FCntUp
+	uplinkReceived := validSession.UplinkReceived
 
 	// 特殊处理：如果设备发送 fcnt=0 且服务器期望 fcnt=1
-	// 这可能是设备重启了
-	if fullFCnt == 0 && validSession.FCntUp == 1 {
-		log.Warn().
+	// 这可能是设备重启了，仅设备配置文件允许计数器重置时接受
+	if fullFCnt == 0 && validSession.FCntUp == 1 && p.fCntResetsAllowed(ctx, lorawan.EUI64(validSession.DevEUI)) {
+		logging.Ctx(ctx).Warn().
 			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
 			Uint32("received", fullFCnt).
 			Uint32("expected", validSession.FCntUp).
@@ -953,34 +1354,60 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 
 		// 重置会话的帧计数器
 		validSession.FCntUp = 0
+		validSession.UplinkReceived = false
 		validSession.FCntDown = 0
 		validSession.NFCntDown = 0
 		validSession.AFCntDown = 0
+	} else if !supports32Bit && lorawan.FCnt16RolledOver(validSession.FCntUp, macPayload.FHDR.FCnt) {
+		// 16 位计数器从 65535 回绕到 0
+		logging.Ctx(ctx).Info().
+			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
+			Uint32("last", validSession.FCntUp).
+			Uint32("received", fullFCnt).
+			Msg("16 位帧计数器回绕")
 	} else if fullFCnt < validSession.FCntUp {
 		// 其他情况下，如果收到的帧计数器小于期望值
-		log.Warn().
+		logging.Ctx(ctx).Warn().
 			Uint32("received", fullFCnt).
 			Uint32("expected", validSession.FCntUp+1).
 			Msg("帧计数器无效")
+		p.recordDeviceError(ctx, lorawan.EUI64(validSession.DevEUI), models.DeviceErrorFCntRejected,
+			fmt.Sprintf("frame counter %d below expected %d", fullFCnt, validSession.FCntUp+1), &fullFCnt, gatewayID)
 		return
 	}
 
-	// 正常情况：帧计数器必须大于上次的值
-	if fullFCnt == validSession.FCntUp && fullFCnt != 0 {
-		log.Warn().
+	// 正常情况：帧计数器必须大于上次接受的值；入网后还没收到上行时 FCnt=0 是第一帧
+	if fullFCnt == validSession.FCntUp && validSession.UplinkReceived {
+		// 去重窗口之后的确认上行重传
+		p.setFrameResult(ctx, "fcnt replay")
+		if phy.MHDR.MType == lorawan.ConfirmedDataUp && p.resendACK(uplinkKey, gatewayID, rxInfo) {
+			return
+		}
+		logging.Ctx(ctx).Warn().
 			Uint32("received", fullFCnt).
 			Msg("收到重复的帧计数器")
 		return
 	}
 
+	// 去重之后仍超过速率的上行丢弃
+	if p.throttleUplink(ctx, lorawan.EUI64(validSession.DevEUI), fullFCnt) {
+		p.setFrameResult(ctx, "throttled")
+		return
+	}
+
+	// 持久化的帧计数器条件更新，服务重启或多实例时内存去重失效也不会重复接受同一帧
+	if !p.advanceFCntUp(ctx, validSession, lastFCntUp, uplinkReceived, fullFCnt) {
+		return
+	}
 	validSession.FCntUp = fullFCnt
+	validSession.UplinkReceived = true
 
 	// 解密 FRM payload
 	var data []byte
 	if macPayload.FPort != nil && len(macPayload.FRMPayload) > 0 {
 		var key []byte
-		if *macPayload.FPort == 0 {
-			// MAC 命令使用 NwkSEncKey
+		if *macPayload.FPort == 0 || *macPayload.FPort == lorawan.RelayFPort {
+			// MAC 命令和中继转发使用 NwkSEncKey
 			key, _ = hex.DecodeString(validSession.NwkSEncKey)
 		} else {
 			// 应用数据使用 AppSKey
@@ -995,7 +1422,9 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 			macPayload.FRMPayload,
 		)
 		if err != nil {
-			log.Error().Err(err).Msg("解密失败")
+			logging.Ctx(ctx).Error().Err(err).Msg("解密失败")
+			p.recordDeviceError(ctx, lorawan.EUI64(validSession.DevEUI), models.DeviceErrorDecryptFailure,
+				err.Error(), &fullFCnt, gatewayID)
 			return
 		}
 	}
@@ -1003,15 +1432,26 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 	// 处理 MAC 命令
 	var macCommands []lorawan.MACCommand
 	if len(macPayload.FHDR.FOpts) > 0 {
-		macCommands, _ = lorawan.ParseMACCommands(true, macPayload.FHDR.FOpts)
+		fOpts, err := encryptFOpts(validSession, true, macPayload.FPort, fullFCnt, macPayload.FHDR.FOpts)
+		if err != nil {
+			logging.Ctx(ctx).Warn().Err(err).Msg("解密 FOpts 失败")
+		} else {
+			macCommands, _ = lorawan.ParseMACCommands(true, fOpts)
+		}
 	}
 	if macPayload.FPort != nil && *macPayload.FPort == 0 && len(data) > 0 {
 		moreCmds, _ := lorawan.ParseMACCommands(true, data)
 		macCommands = append(macCommands, moreCmds...)
 	}
 
+	// 设备配置文件的 ADR 策略优先于全局开关
+	validSession.ADR = p.resolveADR(ctx, validSession, macPayload.FHDR.FCtrl.ADR)
+	p.recordADRSample(validSession, fullFCnt, rxInfo)
+
 	// 处理 MAC 命令
-	downlinkCmds := p.macHandler.HandleUplink(validSession, macCommands)
+	downlinkCmds := p.macHandler.HandleUplink(validSession, p.deviceProfile(ctx, lorawan.EUI64(validSession.DevEUI)), macCommands)
+	downlinkCmds = p.appendNbTransReq(ctx, validSession, fullFCnt, downlinkCmds)
+	downlinkCmds = p.appendQueuedMACCommands(ctx, validSession, downlinkCmds)
 
 	// 更新设备会话
 	p.store.SaveDeviceSession(ctx, validSession)
@@ -1019,13 +1459,18 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 	// 获取设备信息
 	device, err := p.store.GetDevice(ctx, lorawan.EUI64(validSession.DevEUI))
 	if err != nil {
-		log.Error().
+		logging.Ctx(ctx).Error().
 			Err(err).
 			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
 			Msg("获取设备信息失败")
 		return
 	}
 
+	// 上行 ACK 确认了最近的确认下行
+	if macPayload.FHDR.FCtrl.ACK {
+		p.markLastDownlinkAcked(device)
+	}
+
 	// ✅ 新增：保存上行帧到数据库
 	phyBytes, _ := phy.MarshalBinary()
 	uplinkFrame := &models.UplinkFrame{
@@ -1054,47 +1499,83 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 		ReceivedAt: time.Now(),
 	}
 
-	if err := p.store.SaveUplinkFrame(ctx, uplinkFrame); err != nil {
-		log.Error().
+	if err := p.saveUplinkFrame(ctx, uplinkFrame); err != nil {
+		logging.Ctx(ctx).Error().
 			Err(err).
 			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
 			Msg("保存上行帧失败")
 	}
 
-	// 发布上行数据
-	p.publishUplinkData(validSession, macPayload, data, rxInfo, device.ApplicationID)
+	// 应用层时钟同步请求由网络服务器直接应答，上行仍转发给应用
+	if p.config.Network.AppClockSync && macPayload.FPort != nil && *macPayload.FPort == lorawan.ClockSyncFPort && len(data) > 0 {
+		p.handleClockSyncUplink(validSession, gatewayID, data, uplinkFrame.ReceivedAt)
+	}
+
+	// 发布上行数据；中继转发（FPort 226）不是应用数据，解出的终端帧另行处理
+	if macPayload.FPort != nil && *macPayload.FPort == lorawan.RelayFPort {
+		p.handleRelayUplink(lorawan.EUI64(validSession.DevEUI), gatewayID, rxInfo, data)
+	} else if isEmptyAppUplink(macPayload) && p.config.Network.EmptyPayloadUplinks == "drop" {
+		logging.Ctx(ctx).Debug().
+			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
+			Uint8("fPort", *macPayload.FPort).
+			Msg("丢弃空负载上行")
+	} else {
+		p.publishUplinkData(validSession, macPayload, data, uplinkFrame.PHYPayload, p.uplinkRxInfo(ctx, gatewayID, rxInfo), device.ApplicationID)
+	}
 
 	// ✅ 专门处理 ConfirmedDataUp - 关键修复
 	if phy.MHDR.MType == lorawan.ConfirmedDataUp {
-		log.Info().
+		logging.FrameCtx(ctx).Info().
 			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
 			Str("gatewayID", gatewayID).
 			Uint32("fCnt", fullFCnt).
 			Uint32("currentNFCntDown", validSession.NFCntDown).
 			Msg("收到 ConfirmedDataUp，发送 ACK")
 
+		// 队列中有应用下行时 ACK 随最早的一帧发送，队列为空才单独发送 ACK
+		pending, err := p.store.GetPendingDownlinks(ctx, lorawan.EUI64(validSession.DevEUI))
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("获取待发送数据失败")
+		}
+		if len(pending) > 0 {
+			if ack := p.handleDownlink(validSession, gatewayID, rxInfo, downlinkCmds, true); ack != nil {
+				p.rememberACK(uplinkKey, ack)
+			}
+			return
+		}
+
 		// ✅ 关键修复：先创建ACK再更新计数器
-		ackPHY := p.createACKResponse(validSession, downlinkCmds)
+		// ACK 只有 FOpts 可用，超出 15 字节的 MAC 命令顺延
+		ackCmds, rest := splitMACCommands(downlinkCmds, maxFOptsLen)
+		p.deferMACCommands(ctx, validSession, rest)
+		fPending := len(rest) > 0
+		ackPHY := p.createACKResponse(validSession, ackCmds, fPending)
+		p.logADRTarget(ctx, validSession, ackCmds)
 
 		// ✅ 然后更新下行计数器
 		validSession.NFCntDown++
 
 		// ✅ 立即保存设备会话
 		if err := p.store.SaveDeviceSession(ctx, validSession); err != nil {
-			log.Error().Err(err).Msg("保存设备会话失败")
+			logging.Ctx(ctx).Error().Err(err).Msg("保存设备会话失败")
 			return
 		}
 
-		// ✅ 使用修复后的RX1延迟
-		rx1Delay := 5 * time.Second // 标准1秒延迟
-		if p.config.CN470.RXWindows.RX1Delay > 0 {
-			rx1Delay = time.Duration(p.config.CN470.RXWindows.RX1Delay) * time.Second
-		}
+		// RX1 延迟必须与设备 JOIN 时收到的 RxDelay 一致
+		rx1Delay := sessionRX1Delay(validSession)
 
 		lorawanDevAddr := lorawan.DevAddr(validSession.DevAddr)
 		p.scheduleDownlink(gatewayID, lorawanDevAddr, ackPHY, rxInfo, rx1Delay)
-
-		log.Info().
+		p.recordLastDownlink(validSession, gatewayID, nil, validSession.NFCntDown-1, false, "")
+		p.rememberACK(uplinkKey, &sentACK{
+			devEUI:   lorawan.EUI64(validSession.DevEUI),
+			devAddr:  lorawanDevAddr,
+			phy:      ackPHY,
+			fCntDown: validSession.NFCntDown - 1,
+			rx1Delay: rx1Delay,
+		})
+
+		logging.FrameCtx(ctx).Info().
 			Str("devEUI", hex.EncodeToString(validSession.DevEUI[:])).
 			Str("gatewayID", gatewayID).
 			Uint32("downlinkFCnt", validSession.NFCntDown-1). // ✅ 使用实际ACK的计数器
@@ -1104,8 +1585,8 @@ func (p *Processor) handleDataUp(phy *lorawan.PHYPayload, gatewayID string, rxIn
 		return // 已处理ACK，直接返回
 	}
 
-	// 处理其他需要下行的情况（非确认数据但有MAC命令）
-	if len(downlinkCmds) > 0 || macPayload.FHDR.FCtrl.ADRACKReq {
+	// 处理其他需要下行的情况（非确认数据但有MAC命令，或开启了机会下行）
+	if len(downlinkCmds) > 0 || macPayload.FHDR.FCtrl.ADRACKReq || p.config.Network.OpportunisticDownlink {
 		// CN470 特殊处理：检查是否需要调整信道
 		if p.region.Name == "CN470" {
 			p.handleCN470ChannelManagement(validSession, rxInfo)
@@ -1167,10 +1648,7 @@ func (p *Processor) createTestACK(session *models.DeviceSession) lorawan.PHYPayl
 	}
 
 	// 设置MIC
-	sNwkSIntKey, _ := hex.DecodeString(session.SNwkSIntKey)
-	var key lorawan.AES128Key
-	copy(key[:], sNwkSIntKey)
-	phyPayload.SetDownlinkDataMIC(lorawan.LoRaWAN1_0, session.NFCntDown, key)
+	p.setDownlinkMIC(&phyPayload, session, session.NFCntDown, macPayload.FHDR.FCtrl.ACK)
 
 	// 调试
 	phyBytes, _ := phyPayload.MarshalBinary()
@@ -1183,7 +1661,7 @@ func (p *Processor) createTestACK(session *models.DeviceSession) lorawan.PHYPayl
 }
 
 // ✅ 正确的createACKResponse函数 - 匹配ChirpStack行为
-func (p *Processor) createACKResponse(session *models.DeviceSession, macCommands []lorawan.MACCommand) lorawan.PHYPayload {
+func (p *Processor) createACKResponse(session *models.DeviceSession, macCommands []lorawan.MACCommand, fPending bool) lorawan.PHYPayload {
 	// ❌ 注释掉自动添加MAC命令的代码 - 这是导致问题的根源！
 	/*
 		if len(macCommands) == 0 {
@@ -1205,8 +1683,9 @@ func (p *Processor) createACKResponse(session *models.DeviceSession, macCommands
 		FHDR: lorawan.FHDR{
 			DevAddr: lorawan.DevAddr(session.DevAddr),
 			FCtrl: lorawan.FCtrl{
-				ADR: false, // 关闭ADR
-				ACK: true,  // ✅ ACK位
+				ADR:      false, // 关闭ADR
+				ACK:      true,  // ✅ ACK位
+				FPending: fPending,
 			},
 			FCnt: uint16(session.NFCntDown & 0xFFFF),
 		},
@@ -1220,15 +1699,12 @@ func (p *Processor) createACKResponse(session *models.DeviceSession, macCommands
 			macCmdBytes = []byte{}
 		}
 
-		// 验证FOpts长度（最大15字节）
-		if len(macCmdBytes) > 15 {
-			log.Warn().
-				Int("len", len(macCmdBytes)).
-				Msg("MAC命令超过15字节，需要使用FRMPayload")
-			macCmdBytes = macCmdBytes[:15] // 截断到15字节
+		// LoRaWAN 1.1 的 FOpts 需加密，ACK 没有 FPort，使用 NFCntDown
+		macPayload.FHDR.FOpts, err = encryptFOpts(session, false, nil, session.NFCntDown, macCmdBytes)
+		if err != nil {
+			log.Error().Err(err).Msg("加密FOpts失败")
+			return lorawan.PHYPayload{}
 		}
-
-		macPayload.FHDR.FOpts = macCmdBytes
 	}
 
 	// 序列化MAC payload
@@ -1248,10 +1724,7 @@ func (p *Processor) createACKResponse(session *models.DeviceSession, macCommands
 	}
 
 	// 设置MIC
-	sNwkSIntKey, _ := hex.DecodeString(session.SNwkSIntKey)
-	var key lorawan.AES128Key
-	copy(key[:], sNwkSIntKey)
-	phyPayload.SetDownlinkDataMIC(lorawan.LoRaWAN1_0, session.NFCntDown, key)
+	p.setDownlinkMIC(&phyPayload, session, session.NFCntDown, macPayload.FHDR.FCtrl.ACK)
 
 	// 调试日志
 	phyBytes, _ := phyPayload.MarshalBinary()
@@ -1264,6 +1737,9 @@ func (p *Processor) createACKResponse(session *models.DeviceSession, macCommands
 	if macPayload.FHDR.FCtrl.ACK {
 		fctrlByte |= 0x20
 	}
+	if macPayload.FHDR.FCtrl.FPending {
+		fctrlByte |= 0x10
+	}
 	if len(macPayload.FHDR.FOpts) > 0 {
 		fctrlByte |= uint8(len(macPayload.FHDR.FOpts) & 0x0F) // FOptsLen在低4位
 	}
@@ -1294,7 +1770,7 @@ func (p *Processor) updateDeviceRxCache(devEUI lorawan.EUI64, gatewayID string,
 		Timestamp: time.Now(),
 	}
 
-	log.Debug().
+	logging.Frame().Debug().
 		Str("devEUI", hex.EncodeToString(devEUI[:])).
 		Str("gatewayID", gatewayID).
 		Msg("更新设备网关缓存")
@@ -1302,12 +1778,14 @@ func (p *Processor) updateDeviceRxCache(devEUI lorawan.EUI64, gatewayID string,
 
 // getLastGatewayForDevice 获取设备最后使用的网关
 func (p *Processor) getLastGatewayForDevice(devEUI lorawan.EUI64) string {
+	p.selectDownlinkGateway(devEUI)
+
 	// 首先尝试从内存缓存获取
 	p.rxCacheMutex.RLock()
 	if info, ok := p.deviceRxCache[devEUI]; ok {
 		if time.Since(info.Timestamp) < 5*time.Minute {
 			p.rxCacheMutex.RUnlock()
-			log.Debug().
+			logging.Frame().Debug().
 				Str("devEUI", hex.EncodeToString(devEUI[:])).
 				Str("gatewayID", info.GatewayID).
 				Msg("从缓存获取网关ID")
@@ -1391,40 +1869,96 @@ func (p *Processor) getLastRxInfoForDevice(devEUI lorawan.EUI64) map[string]inte
 	}
 }
 
-// handleDownlink 处理下行
-func (p *Processor) handleDownlink(session *models.DeviceSession, gatewayID string, rxInfo map[string]interface{}, macCmds []lorawan.MACCommand, confirmed bool) {
-	ctx := context.Background()
+// handleDownlink 处理下行：发送队列中最早的应用下行，MAC 命令放在 FOpts（不超过 15 字节）或
+// 没有应用数据时放在 FPort 0；confirmed 为真时对确认上行设置 ACK，并返回发出的帧供设备重传时重发
+func (p *Processor) handleDownlink(session *models.DeviceSession, gatewayID string, rxInfo map[string]interface{}, macCmds []lorawan.MACCommand, confirmed bool) *sentACK {
+	ctx := traceContext(rxInfo)
+
+	// 网关维护中：不分配计数器也不取出应用下行，MAC 命令放回队列，维护结束后的下一次上行时发送
+	if p.maintenance.active(gatewayID) {
+		p.deferMACCommands(ctx, session, macCmds)
+		logging.Frame().Info().
+			Str("gateway", gatewayID).
+			Str("devEUI", lorawan.EUI64(session.DevEUI).String()).
+			Msg("维护模式，下行留在队列中等待下一次上行")
+		return nil
+	}
 
 	// 检查待发送的应用数据
 	frames, err := p.store.GetPendingDownlinks(ctx, lorawan.EUI64(session.DevEUI))
 	if err != nil {
-		log.Error().Err(err).Msg("获取待发送数据失败")
+		logging.Ctx(ctx).Error().Err(err).Msg("获取待发送数据失败")
+	}
+	frames = p.expireStaleDownlinks(ctx, lorawan.EUI64(session.DevEUI), frames)
+
+	// 超过当前速率最大负载的应用下行在网关处一定发送失败，留在队列中等待速率提高或排队过期
+	maxPayload := p.maxDownlinkPayload(session, rxInfo)
+	if len(frames) > 0 && len(frames[0].Data) > maxPayload {
+		logging.Ctx(ctx).Warn().
+			Str("devEUI", lorawan.EUI64(session.DevEUI).String()).
+			Str("frameID", frames[0].ID.String()).
+			Int("dataLen", len(frames[0].Data)).
+			Int("maxPayload", maxPayload).
+			Msg("应用下行超过当前速率的最大负载，暂不发送")
+		frames = nil
 	}
 
 	// 构建下行帧
 	var fPort uint8
 	var data []byte
 	var mtype lorawan.MType
+	var frame *models.DownlinkFrame
+	var fPending bool
+
+	packed := p.config.Network.PackDownlinks
+	if packed {
+		// MAC 命令和应用下行按速率最大负载打包，放不下的留到下一次下行
+		pack := packDownlink(maxPayload, macCmds, frames)
+		if pack.frame != nil && !confirmed && !p.allowOpportunisticDownlink(gatewayID, rxInfo, pack.frame) {
+			if len(macCmds) == 0 {
+				return nil
+			}
+			pack = packDownlink(maxPayload, macCmds, nil)
+			pack.fPending = true
+		}
+		macCmds, fPending = pack.macCmds, pack.fPending
+		p.deferMACCommands(ctx, session, pack.deferred)
+		if pack.frame != nil {
+			frames = []*models.DownlinkFrame{pack.frame}
+		} else {
+			frames = nil
+		}
+	}
 
-	if len(frames) > 0 && len(macCmds) == 0 {
-		// 有应用数据
-		frame := frames[0]
+	if !packed && len(frames) > 0 {
+		// 取队列中最早的应用下行；MAC 命令超过 FOpts 的 15 字节时本次只在 FPort 0 发送 MAC 命令，
+		// 应用下行留在队列中
+		if _, rest := splitMACCommands(macCmds, maxFOptsLen); len(rest) > 0 {
+			frames = nil
+			fPending = true
+		} else if !confirmed && !p.allowOpportunisticDownlink(gatewayID, rxInfo, frames[0]) {
+			if len(macCmds) == 0 {
+				return nil
+			}
+			frames = nil
+			fPending = true
+		} else {
+			fPending = len(frames) > 1
+		}
+	}
+
+	mtype = lorawan.UnconfirmedDataDown
+	if len(frames) > 0 {
+		// 有应用数据，MAC 命令放在 FOpts 中
+		frame = frames[0]
 		fPort = uint8(frame.FPort)
 		data = frame.Data
 		if frame.Confirmed {
 			mtype = lorawan.ConfirmedDataDown
-		} else {
-			mtype = lorawan.UnconfirmedDataDown
-		}
-	} else if confirmed || len(macCmds) > 0 {
-		// 只有 ACK 或 MAC 命令
-		if confirmed {
-			mtype = lorawan.UnconfirmedDataDown
-		} else {
-			mtype = lorawan.UnconfirmedDataDown
 		}
-	} else {
-		return
+	} else if !confirmed && len(macCmds) == 0 {
+		// 既没有需要 ACK 的确认上行，也没有要发送的内容
+		return nil
 	}
 
 	// 构建 MAC payload
@@ -1432,16 +1966,16 @@ func (p *Processor) handleDownlink(session *models.DeviceSession, gatewayID stri
 		FHDR: lorawan.FHDR{
 			DevAddr: lorawan.DevAddr(session.DevAddr),
 			FCtrl: lorawan.FCtrl{
-				ADR: session.ADR,
-				ACK: confirmed,
+				ADR:      session.ADR,
+				ACK:      confirmed,
+				FPending: fPending,
 			},
-			FCnt: uint16(session.NFCntDown & 0xFFFF),
 		},
 	}
 
 	// 添加 MAC 命令
 	if len(macCmds) > 0 {
-		if len(data) == 0 {
+		if frame == nil {
 			// MAC 命令在 FRMPayload 中
 			fPort = 0
 			data, _ = lorawan.EncodeMACCommands(macCmds)
@@ -1451,9 +1985,17 @@ func (p *Processor) handleDownlink(session *models.DeviceSession, gatewayID stri
 		}
 	}
 
-	if len(data) > 0 {
+	if len(data) > 0 || frame != nil {
 		macPayload.FPort = &fPort
+	}
+
+	// LoRaWAN 1.1 的应用下行和 MAC 命令下行各用一个计数器，需在确定 FPort 之后选择
+	fCnt := downlinkFCnt(session, macPayload.FPort)
+	sentFCnt := *fCnt
+	macPayload.FHDR.FCnt = uint16(sentFCnt & 0xFFFF)
+	macPayload.FHDR.FOpts, _ = encryptFOpts(session, false, macPayload.FPort, sentFCnt, macPayload.FHDR.FOpts)
 
+	if macPayload.FPort != nil {
 		// 加密数据（使用 DecryptFRMPayload，因为在 LoRaWAN 中加密和解密是相同操作）
 		var key []byte
 		if fPort == 0 {
@@ -1466,7 +2008,7 @@ func (p *Processor) handleDownlink(session *models.DeviceSession, gatewayID stri
 			key,
 			false,
 			[4]byte(session.DevAddr),
-			session.NFCntDown,
+			sentFCnt,
 			data,
 		)
 	}
@@ -1484,135 +2026,199 @@ func (p *Processor) handleDownlink(session *models.DeviceSession, gatewayID stri
 	}
 
 	// 设置 MIC
-	sNwkSIntKey, _ := hex.DecodeString(session.SNwkSIntKey)
-	var key lorawan.AES128Key
-	copy(key[:], sNwkSIntKey)
-	phyPayload.SetDownlinkDataMIC(lorawan.LoRaWAN1_0, session.NFCntDown, key)
-
-	// 更新计数器
-	session.NFCntDown++
+	p.setDownlinkMIC(&phyPayload, session, sentFCnt, macPayload.FHDR.FCtrl.ACK)
+	p.logADRTarget(ctx, session, macCmds)
 
-	// CN470 特殊处理：确保使用正确的下行计数器
-	if p.region.Name == "CN470" {
-		session.ConfFCnt = session.NFCntDown
+	// 更新计数器，确认下行记下所用计数器，设备 ACK 时上行 MIC 需要它
+	*fCnt++
+	if mtype == lorawan.ConfirmedDataDown {
+		session.ConfFCnt = sentFCnt
 	}
 
 	p.store.SaveDeviceSession(ctx, session)
 
 	// 计算下行时间和频率
-	delay := time.Duration(p.config.CN470.RXWindows.RX1Delay) * time.Second
+	delay := sessionRX1Delay(session)
 
 	// 第一接收窗口 (RX1)
 	p.scheduleDownlink(gatewayID, lorawan.DevAddr(session.DevAddr), phyPayload, rxInfo, delay)
 
+	frameID := ""
+	if frame != nil {
+		frameID = frame.ID.String()
+		p.markDownlinkFrameSent(ctx, frame)
+	}
+	p.recordLastDownlink(session, gatewayID, macPayload.FPort, sentFCnt, mtype == lorawan.ConfirmedDataDown, frameID)
+
 	// 检查是否需要RX2窗口
 	if p.shouldUseRX2() {
-		// 准备 RX2 参数
-		rx2Info := make(map[string]interface{})
-		for k, v := range rxInfo {
-			rx2Info[k] = v
-		}
-
-		// 使用配置中的RX2频率和数据速率
-		rx2Info["freq"] = float64(p.config.CN470.RXWindows.RX2Frequency)
-		rx2Info["datr"] = p.getDRString(uint8(p.config.CN470.RXWindows.RX2DataRate))
-
-		// 使用配置中的RX2延迟
+		// 使用配置中的RX2频率、数据速率和延迟
 		rx2Delay := time.Duration(p.config.CN470.RXWindows.RX2Delay) * time.Second
-		p.scheduleDownlink(gatewayID, lorawan.DevAddr(session.DevAddr), phyPayload, rx2Info, rx2Delay)
+		rx2 := p.rx2Override(p.deviceProfile(ctx, lorawan.EUI64(session.DevEUI)))
+		p.scheduleDownlinkWithOverride(gatewayID, lorawan.DevAddr(session.DevAddr), phyPayload, rxInfo, rx2Delay, rx2)
+	}
+
+	if !confirmed {
+		return nil
+	}
+	return &sentACK{
+		devEUI:   lorawan.EUI64(session.DevEUI),
+		devAddr:  lorawan.DevAddr(session.DevAddr),
+		phy:      phyPayload,
+		fCntDown: sentFCnt,
+		rx1Delay: delay,
 	}
 }
 
 func (p *Processor) scheduleDownlink(gatewayID string, devAddr lorawan.DevAddr, phy lorawan.PHYPayload, rxInfo map[string]interface{}, delay time.Duration) {
-	phyBytes, _ := phy.MarshalBinary()
+	p.scheduleDownlinkWithOverride(gatewayID, devAddr, phy, rxInfo, delay, nil)
+}
 
-	// 获取上行频率并计算下行频率
-	uplinkFreq := getFloat64(rxInfo, "freq")
-	uplinkFreqUint32 := uint32(uplinkFreq * 1000000)
+// scheduleDownlinkWithOverride 调度下行，override 非空时其频率/速率优先于自动计算结果
+func (p *Processor) scheduleDownlinkWithOverride(gatewayID string, devAddr lorawan.DevAddr, phy lorawan.PHYPayload, rxInfo map[string]interface{}, delay time.Duration, override *DownlinkOverride) {
+	ctx := traceContext(rxInfo)
+	start := time.Now()
 
-	// 根据配置计算下行频率
-	var downlinkFreq float64
-	var mode string
+	if relay := relayedVia(rxInfo); relay != "" {
+		logging.Ctx(ctx).Warn().
+			Str("devAddr", devAddr.String()).
+			Str("relay", relay).
+			Msg("经中继接入的设备暂不支持下行，丢弃")
+		return
+	}
 
-	if p.region.Name == "CN470" {
-		mode = p.config.CN470.GetCN470Mode()
-		var downlinkFreqUint32 uint32
+	if p.holdDownlink(gatewayID, devAddr, phy, rxInfo, delay, override) {
+		return
+	}
 
-		switch mode {
-		case "STANDARD_FDD":
-			downlinkFreqUint32 = uplinkFreqUint32 + 30000000
-			if downlinkFreqUint32 < 500300000 || downlinkFreqUint32 > 509700000 {
-				downlinkFreqUint32 = p.config.CN470.RXWindows.RX2Frequency
-			}
-		case "CUSTOM_FDD":
-			downlinkFreqUint32 = uplinkFreqUint32 + 10000000
-			if downlinkFreqUint32 < 480300000 || downlinkFreqUint32 > 489900000 {
-				downlinkFreqUint32 = p.config.CN470.RXWindows.RX2Frequency
-			}
-		case "TDD":
-			downlinkFreqUint32 = uplinkFreqUint32
-		default:
-			downlinkFreqUint32 = p.config.CN470.GetDownlinkFrequencyAdaptive(uplinkFreqUint32)
-		}
+	phyBytes, _ := phy.MarshalBinary()
 
-		downlinkFreq = float64(downlinkFreqUint32) / 1000000.0
-	} else {
-		downlinkFreq = uplinkFreq
-		mode = "OTHER"
-	}
+	// 根据频段和 CN470 模式由上行频率计算 RX1 下行频率
+	uplinkFreq := getFloat64(rxInfo, "freq")
+	downlinkFreq := p.calculateDownlinkFrequency(uplinkFreq)
 
 	// 获取数据速率
 	dataRate := ""
 	if dr, ok := rxInfo["datr"].(string); ok {
 		dataRate = dr
 	}
+	if override.Empty() {
+		dataRate = p.rx1DataRate(devAddr, dataRate)
+	}
+
+	// 应用单次下行覆盖
+	if !override.Empty() {
+		if override.Frequency != 0 {
+			downlinkFreq = float64(override.Frequency) / 1000000.0
+		}
+		if override.DataRate != nil {
+			dataRate = p.getDRString(uint8(*override.DataRate))
+		}
+		logging.FrameCtx(ctx).Info().
+			Str("devAddr", devAddr.String()).
+			Float64("freq", downlinkFreq).
+			Str("dataRate", dataRate).
+			Str("window", override.Window).
+			Msg("使用下行参数覆盖")
+	}
 
 	// 获取编码率
-	codeRate := "4/5"
-	if codr, ok := rxInfo["codr"].(string); ok && codr != "" {
-		codeRate = codr
+	codeRate := p.downlinkCodeRate(ctx, devAddr, rxInfo)
+
+	// 网关时间戳不可靠时不能按时间戳调度
+	gated := p.timingGated(gatewayID, phy)
+	if gated && p.config.Network.DownlinkTimingGate == "rx2" && override.Empty() {
+		downlinkFreq = float64(p.getRegionRX2Freq()) / 1000000.0
+		dataRate = p.getDRString(uint8(p.getRegionRX2DR()))
+	}
+
+	if airtime, err := lorawan.TimeOnAir(dataRate, codeRate, len(phyBytes), false); err == nil {
+		p.dutyCycle.Record(gatewayID, airtime)
+	}
+
+	// 按网关射频配置选择发送该频率的射频链
+	rfCh := p.getGatewayMeta(ctx, gatewayID).rfChain(uint32(math.Round(downlinkFreq * 1000000)))
+
+	// 网关 GPS 同步时按 GPS 绝对时间发送，不依赖 tmst 计数器，计数器不可靠时同样可用
+	if tmms, ok := p.gpsDownlinkTmms(gatewayID, rxInfo, delay); ok {
+		if override.Empty() {
+			p.rememberRX1(gatewayID, devAddr, phy, rxInfo)
+		}
+
+		txpk := loraTXPacket(downlinkFreq, rfCh, dataRate, codeRate, phyBytes)
+		txpk.Tmms = &tmms
+
+		msg := models.GatewayTXMessage{
+			Version:   models.GatewayProtocolVersion,
+			GatewayID: gatewayID,
+			TXPK:      txpk,
+			TraceID:   logging.TraceID(ctx),
+		}
+
+		data, _ := json.Marshal(msg)
+		subject := fmt.Sprintf("gateway.%s.tx", gatewayID)
+
+		if err := p.nc.Publish(subject, data); err != nil {
+			logging.Ctx(ctx).Error().
+				Err(err).
+				Str("subject", subject).
+				Msg("发布下行消息失败")
+			p.logDownlinkFrame(ctx, gatewayID, txpk, "publish failed: "+err.Error())
+			return
+		}
+		p.logDownlinkFrame(ctx, gatewayID, txpk, fmt.Sprintf("scheduled: tmms %d", tmms))
+		observeDownlinkScheduled("gps", start)
+
+		logging.FrameCtx(ctx).Info().
+			Str("devAddr", devAddr.String()).
+			Str("gateway", gatewayID).
+			Float64("freq", downlinkFreq).
+			Str("dataRate", dataRate).
+			Uint64("uplinkTmms", getUint64(rxInfo, "tmms")).
+			Uint64("downlinkTmms", tmms).
+			Dur("delay", delay).
+			Str("region", p.region.Name).
+			Msg("使用 GPS 时间下行模式")
+
+		return
 	}
 
 	// ✅ 检查是否有 context
 	contextStr, hasContext := rxInfo["context"].(string)
 
 	// ✅ 如果有 context，使用 context + timing 模式
-	if hasContext && delay > 0 {
+	if hasContext && delay > 0 && !gated {
+		if override.Empty() {
+			p.rememberRX1(gatewayID, devAddr, phy, rxInfo)
+		}
+
 		// 构建消息，包含 context 和 timing
-		msg := map[string]interface{}{
-			"gatewayID": gatewayID,
-			"txpk": map[string]interface{}{
-				"imme": false, // 使用延时模式
-				"rfch": 0,
-				"powe": 19,
-				"ant":  0,
-				"brd":  0,
-				"freq": downlinkFreq,
-				"modu": "LORA",
-				"datr": dataRate,
-				"codr": codeRate,
-				"ipol": true,
-				"size": len(phyBytes),
-				"data": base64.StdEncoding.EncodeToString(phyBytes),
-			},
-			"context": contextStr,
-			"timing": map[string]interface{}{
-				"delay": fmt.Sprintf("%dms", delay.Milliseconds()),
+		msg := models.GatewayTXMessage{
+			Version:   models.GatewayProtocolVersion,
+			GatewayID: gatewayID,
+			TXPK:      loraTXPacket(downlinkFreq, rfCh, dataRate, codeRate, phyBytes), // 延时模式，由网关桥按 context 计算时间戳
+			Context:   contextStr,
+			Timing: &models.TXTiming{
+				Delay: fmt.Sprintf("%dms", delay.Milliseconds()),
 			},
+			TraceID: logging.TraceID(ctx),
 		}
 
 		data, _ := json.Marshal(msg)
 		subject := fmt.Sprintf("gateway.%s.tx", gatewayID)
 
 		if err := p.nc.Publish(subject, data); err != nil {
-			log.Error().
+			logging.Ctx(ctx).Error().
 				Err(err).
 				Str("subject", subject).
 				Msg("发布下行消息失败")
+			p.logDownlinkFrame(ctx, gatewayID, msg.TXPK, "publish failed: "+err.Error())
 			return
 		}
+		p.logDownlinkFrame(ctx, gatewayID, msg.TXPK, fmt.Sprintf("scheduled: context, delay %s", delay))
+		observeDownlinkScheduled("context", start)
 
-		log.Info().
+		logging.FrameCtx(ctx).Info().
 			Str("devAddr", devAddr.String()).
 			Str("gateway", gatewayID).
 			Float64("freq", downlinkFreq).
@@ -1639,6 +2245,11 @@ func (p *Processor) scheduleDownlink(gatewayID string, devAddr lorawan.DevAddr,
 		reason = "timestamp_out_of_range"
 	}
 
+	if !useImmediate && gated {
+		useImmediate = true
+		reason = "timestamp_unreliable"
+	}
+
 	// 零延迟或JOIN ACCEPT之外的情况，考虑使用即时发送
 	if !useImmediate && delay == 0 {
 		useImmediate = true
@@ -1646,65 +2257,47 @@ func (p *Processor) scheduleDownlink(gatewayID string, devAddr lorawan.DevAddr,
 	}
 
 	// 构建下行包
-	var txpk map[string]interface{}
+	txpk := loraTXPacket(downlinkFreq, rfCh, dataRate, codeRate, phyBytes)
 
 	if useImmediate {
-		txpk = map[string]interface{}{
-			"imme": true,
-			"rfch": 0,
-			"powe": 19,
-			"ant":  0,
-			"brd":  0,
-			"freq": downlinkFreq,
-			"modu": "LORA",
-			"datr": dataRate,
-			"codr": codeRate,
-			"ipol": true,
-			"size": len(phyBytes),
-			"data": base64.StdEncoding.EncodeToString(phyBytes),
-		}
+		txpk.Imme = true
 	} else {
 		// 计算下行时间戳
 		//const RX1_DELAY_ADJUSTMENT = 30000 // 30ms额外余量
 		//delayMicroseconds := uint64(delay.Microseconds()) + RX1_DELAY_ADJUSTMENT
 		delayMicroseconds := uint64(delay.Microseconds())
-		downlinkTmst := uplinkTmst + delayMicroseconds
-
-		txpk = map[string]interface{}{
-			"imme": false,
-			"rfch": 0,
-			"powe": 19,
-			"ant":  0,
-			"brd":  0,
-			"tmst": downlinkTmst,
-			"freq": downlinkFreq,
-			"modu": "LORA",
-			"datr": dataRate,
-			"codr": codeRate,
-			"ipol": true,
-			"size": len(phyBytes),
-			"data": base64.StdEncoding.EncodeToString(phyBytes),
-		}
+		downlinkTmst := uint32(uplinkTmst + delayMicroseconds)
+		txpk.Tmst = &downlinkTmst
 	}
 
-	msg := map[string]interface{}{
-		"gatewayID": gatewayID,
-		"txpk":      txpk,
+	msg := models.GatewayTXMessage{
+		Version:   models.GatewayProtocolVersion,
+		GatewayID: gatewayID,
+		TXPK:      txpk,
+		TraceID:   logging.TraceID(ctx),
 	}
 
 	data, _ := json.Marshal(msg)
 	subject := fmt.Sprintf("gateway.%s.tx", gatewayID)
 
 	if err := p.nc.Publish(subject, data); err != nil {
-		log.Error().
+		logging.Ctx(ctx).Error().
 			Err(err).
 			Str("subject", subject).
 			Msg("发布下行消息失败")
+		p.logDownlinkFrame(ctx, gatewayID, txpk, "publish failed: "+err.Error())
 		return
 	}
+	if useImmediate {
+		p.logDownlinkFrame(ctx, gatewayID, txpk, "immediate: "+reason)
+		observeDownlinkScheduled("immediate", start)
+	} else {
+		p.logDownlinkFrame(ctx, gatewayID, txpk, fmt.Sprintf("scheduled: tmst %d", *txpk.Tmst))
+		observeDownlinkScheduled("timestamp", start)
+	}
 
 	// 记录日志
-	logEvent := log.Info().
+	logEvent := logging.Ctx(ctx).Info().
 		Str("devAddr", devAddr.String()).
 		Str("gateway", gatewayID).
 		Float64("freq", downlinkFreq).
@@ -1764,6 +2357,35 @@ func getImmediateReason(unreliable bool, overflow bool) string {
 	return "forced"
 }
 
+// Unreliable 网关时间戳当前是否不可靠（预热完成后漂移过大，或检测到重置后尚未恢复）。
+// 首次预热中的网关不视为不可靠，以免服务重启后的下行全部改为即时发送。
+func (t *TimestampTracker) Unreliable(gatewayID string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	info, exists := t.gatewayTimestamps[gatewayID]
+	if !exists {
+		return false
+	}
+	return !info.IsReliable && (info.WarmupCount >= 3 || info.ResetCount > 0)
+}
+
+// timingGated 是否因网关时间戳不可靠而禁止定时下行，JOIN ACCEPT 不受限制
+func (p *Processor) timingGated(gatewayID string, phy lorawan.PHYPayload) bool {
+	if p.config.Network.DownlinkTimingGate == "off" || phy.MHDR.MType == lorawan.JoinAccept {
+		return false
+	}
+	if !p.timestampTracker.Unreliable(gatewayID) {
+		return false
+	}
+
+	log.Warn().
+		Str("gateway", gatewayID).
+		Str("gate", p.config.Network.DownlinkTimingGate).
+		Msg("网关时间戳不可靠，放弃定时下行")
+	return true
+}
+
 // 添加定期清理过期的时间戳信息
 func (t *TimestampTracker) StartCleanup(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Minute)
@@ -1822,11 +2444,12 @@ func (p *Processor) calculateDownlinkFrequency(uplinkFreq float64) float64 {
 		return float64(downlinkFreqUint32) / 1000000.0
 	}
 
-	return uplinkFreq
+	// 其他频段按频段的 RX1 信道映射（EU868 为上行信道本身）
+	return float64(p.region.RX1Frequency(uint32(math.Round(uplinkFreq*1000000)))) / 1000000.0
 }
 
 // publishUplinkData 发布上行数据到应用服务器
-func (p *Processor) publishUplinkData(session *models.DeviceSession, mac lorawan.MACPayload, data []byte, rxInfo map[string]interface{}, applicationID uuid.UUID) {
+func (p *Processor) publishUplinkData(session *models.DeviceSession, mac lorawan.MACPayload, data, phyPayload []byte, rxInfo map[string]interface{}, applicationID uuid.UUID) {
 	// ✅ 关键修复：将 rxInfo 包装成数组
 	rxInfoArray := []map[string]interface{}{rxInfo}
 	msg := map[string]interface{}{
@@ -1836,9 +2459,18 @@ func (p *Processor) publishUplinkData(session *models.DeviceSession, mac lorawan
 		"fCnt":          session.FCntUp,
 		"fPort":         mac.FPort,
 		"data":          data,
+		"phyPayload":    phyPayload, // 是否转发给集成由应用配置决定
 		"rxInfo":        rxInfoArray,
 		"adr":           mac.FHDR.FCtrl.ADR,
 	}
+	if traceID, ok := rxInfo[logging.TraceIDField].(string); ok {
+		msg[logging.TraceIDField] = traceID
+	}
+	if isEmptyAppUplink(mac) {
+		// 空应用帧：data 为空数组而不是 null，与无 FPort 的纯 MAC 上行区分
+		msg["data"] = []byte{}
+		msg["empty"] = true
+	}
 
 	msgData, _ := json.Marshal(msg)
 	subject := fmt.Sprintf("application.*.device.%s.rx", hex.EncodeToString(session.DevEUI[:]))
@@ -1862,41 +2494,80 @@ func (p *Processor) publishJoinEvent(device *models.Device, devAddr lorawan.DevA
 
 // === 辅助函数 ===
 
-func (p *Processor) generateDevAddr() lorawan.DevAddr {
-	// 简化实现：随机生成
-	var addr lorawan.DevAddr
-	binary.BigEndian.PutUint32(addr[:], uint32(time.Now().UnixNano()))
-	return addr
+// isEmptyAppUplink 是否为带应用 FPort 但 FRMPayload 为空的上行
+func isEmptyAppUplink(mac lorawan.MACPayload) bool {
+	return mac.FPort != nil && *mac.FPort != 0 && len(mac.FRMPayload) == 0
+}
+
+// saveUplinkFrame 保存上行帧，启用批量写入时进入缓冲队列
+func (p *Processor) saveUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error {
+	if p.frameWriter != nil {
+		return p.frameWriter.SaveUplinkFrame(ctx, frame)
+	}
+	return p.store.SaveUplinkFrame(ctx, frame)
 }
 
-func (p *Processor) generateJoinNonce() [3]byte {
+// allocateDevAddr 为入网设备分配 DevAddr，配置允许时沿用上次入网的地址
+func (p *Processor) allocateDevAddr(ctx context.Context, device *models.Device) lorawan.DevAddr {
+	if p.config.Network.ReuseDevAddrOnRejoin && device.DevAddr != nil {
+		var zero models.DevAddr
+		if *device.DevAddr != zero {
+			addr := lorawan.DevAddr(*device.DevAddr)
+			if p.devAddrAllowed(device.TenantID, addr) {
+				log.Info().
+					Str("devEUI", device.DevEUI.String()).
+					Str("devAddr", device.DevAddr.String()).
+					Msg("重新入网，沿用原 DevAddr")
+				return addr
+			}
+			log.Warn().
+				Str("devEUI", device.DevEUI.String()).
+				Str("devAddr", device.DevAddr.String()).
+				Msg("原 DevAddr 不在租户地址区间或 NetID 前缀内，重新分配")
+		}
+	}
+	return p.generateDevAddr(ctx, device)
+}
+
+// nextJoinNonce 从数据库分配设备的下一个 JoinNonce，按设备严格递增，重启后也不会重复
+func (p *Processor) nextJoinNonce(ctx context.Context, devEUI lorawan.EUI64) ([3]byte, error) {
 	var nonce [3]byte
-	t := time.Now().UnixNano()
-	nonce[0] = byte(t >> 16)
-	nonce[1] = byte(t >> 8)
-	nonce[2] = byte(t)
-	return nonce
+	n, err := p.store.NextJoinNonce(ctx, devEUI)
+	if err != nil {
+		return nonce, err
+	}
+	// JoinNonce 在空口和密钥派生中都是小端序
+	nonce[0] = byte(n)
+	nonce[1] = byte(n >> 8)
+	nonce[2] = byte(n >> 16)
+	return nonce, nil
 }
 
 // 密钥推导函数（使用标准 LoRaWAN 实现）
-func (p *Processor) deriveAppSKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, appKey string) lorawan.AES128Key {
-	keyBytes, _ := hex.DecodeString(appKey)
-	_, appSKey, _ := lorawan.DeriveSessionKeys10(keyBytes, joinNonce, netID, devNonce)
-	return appSKey
+func (p *Processor) deriveAppSKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, appKey string) (lorawan.AES128Key, error) {
+	key, err := lorawan.ParseAES128Key(appKey)
+	if err != nil {
+		return lorawan.AES128Key{}, fmt.Errorf("AppKey: %w", err)
+	}
+	_, appSKey, err := lorawan.DeriveSessionKeys10(key[:], joinNonce, netID, devNonce)
+	return appSKey, err
 }
 
-func (p *Processor) deriveFNwkSIntKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, nwkKey string) lorawan.AES128Key {
-	keyBytes, _ := hex.DecodeString(nwkKey)
-	nwkSKey, _, _ := lorawan.DeriveSessionKeys10(keyBytes, joinNonce, netID, devNonce)
-	return nwkSKey
+func (p *Processor) deriveFNwkSIntKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, nwkKey string) (lorawan.AES128Key, error) {
+	key, err := lorawan.ParseAES128Key(nwkKey)
+	if err != nil {
+		return lorawan.AES128Key{}, fmt.Errorf("NwkKey: %w", err)
+	}
+	nwkSKey, _, err := lorawan.DeriveSessionKeys10(key[:], joinNonce, netID, devNonce)
+	return nwkSKey, err
 }
 
-func (p *Processor) deriveSNwkSIntKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, nwkKey string) lorawan.AES128Key {
+func (p *Processor) deriveSNwkSIntKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, nwkKey string) (lorawan.AES128Key, error) {
 	// For LoRaWAN 1.0.x, SNwkSIntKey = FNwkSIntKey = NwkSKey
 	return p.deriveFNwkSIntKey(joinNonce, netID, devNonce, nwkKey)
 }
 
-func (p *Processor) deriveNwkSEncKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, nwkKey string) lorawan.AES128Key {
+func (p *Processor) deriveNwkSEncKey(joinNonce [3]byte, netID [3]byte, devNonce [2]byte, nwkKey string) (lorawan.AES128Key, error) {
 	// For LoRaWAN 1.0.x, NwkSEncKey = NwkSKey
 	return p.deriveFNwkSIntKey(joinNonce, netID, devNonce, nwkKey)
 }
@@ -1911,6 +2582,14 @@ func (p *Processor) getRegionRX2Freq() uint32 {
 	return p.region.DefaultRX2Freq
 }
 
+// getRegionRX2DR CN470 使用配置的 RX2 数据速率
+func (p *Processor) getRegionRX2DR() int {
+	if p.region.Name == "CN470" {
+		return p.config.CN470.RXWindows.RX2DataRate
+	}
+	return p.region.DefaultRX2DR
+}
+
 // 修改getRegionTXPower函数
 func (p *Processor) getRegionTXPower() int {
 	if p.region.Name == "CN470" {
@@ -1958,6 +2637,15 @@ func (p *Processor) validateCN470Configuration() error {
 		}
 	}
 
+	// RX2 参数原样用于所有 RX2 下行，启动时确认硬件可以发射
+	rx2 := p.config.CN470.RXWindows
+	if !p.config.CN470.ValidateFrequency(rx2.RX2Frequency) {
+		return fmt.Errorf("RX2频率 %d Hz 超出硬件支持范围", rx2.RX2Frequency)
+	}
+	if rx2.RX2DataRate < 0 || rx2.RX2DataRate > 5 {
+		return fmt.Errorf("RX2数据速率 DR%d 无效（CN470 支持 DR0-DR5）", rx2.RX2DataRate)
+	}
+
 	log.Info().
 		Str("mode", mode).
 		Bool("supports_500mhz", p.config.CN470.Hardware.SupportsTX500MHz).
@@ -2047,6 +2735,9 @@ func (p *Processor) generateCN470CFList() []byte {
 		}
 	}
 
+	// 校验信道与启用信道一致，并紧凑排列（硬件范围检查在校验中完成）
+	frequencies = p.validateCFListChannels(frequencies)
+
 	// 将频率编码到CFList中
 	// 频率以100Hz为单位，小端序，每个频率占3字节
 	for i, freq := range frequencies {
@@ -2054,14 +2745,6 @@ func (p *Processor) generateCN470CFList() []byte {
 			break // CFList最多支持5个频率
 		}
 
-		// 验证频率是否在硬件支持范围内
-		if !p.config.CN470.ValidateFrequency(freq) {
-			log.Warn().
-				Uint32("freq", freq).
-				Msg("频率不在硬件支持范围内，跳过")
-			continue
-		}
-
 		// 转换为100Hz单位
 		freqIn100Hz := freq / 100
 
@@ -2161,26 +2844,9 @@ func (p *Processor) getDRString(dr uint8) string {
 			return "SF12BW125"
 		}
 	}
-	// EU868 数据速率格式
-	if p.region.Name == "EU868" {
-		switch dr {
-		case 0:
-			return "SF12BW125"
-		case 1:
-			return "SF11BW125"
-		case 2:
-			return "SF10BW125"
-		case 3:
-			return "SF9BW125"
-		case 4:
-			return "SF8BW125"
-		case 5:
-			return "SF7BW125"
-		case 6:
-			return "SF7BW250"
-		default:
-			return "SF12BW125"
-		}
+	// 其他频段按频段的数据速率表
+	if datr, ok := p.region.DataRateString(int(dr)); ok {
+		return datr
 	}
 	// 默认返回
 	return "SF12BW125"
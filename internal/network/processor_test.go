@@ -0,0 +1,249 @@
+package network
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+const testGatewayID = "0102030405060708"
+
+var testDevEUI = lorawan.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x01}
+
+// newTestProcessor creates a processor on an in-memory store and a test NATS server;
+// a nil cfg uses the zero config (CN470)
+func newTestProcessor(t *testing.T, cfg *config.Config) (*Processor, *storagetest.MemoryStore, *natstest.Server) {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	srv := natstest.Run(t)
+	store := storagetest.New()
+	return NewProcessor(srv.Conn(t), store, cfg), store, srv
+}
+
+// createTestDevice stores a device with the given EUI
+func createTestDevice(t *testing.T, store *storagetest.MemoryStore, devEUI lorawan.EUI64) *models.Device {
+	t.Helper()
+
+	device := &models.Device{DevEUI: models.EUI64(devEUI), Name: "test"}
+	if err := store.CreateDevice(context.Background(), device); err != nil {
+		t.Fatal(err)
+	}
+	return device
+}
+
+// subscribeSync subscribes a new client of srv to subject
+func subscribeSync(t *testing.T, srv *natstest.Server, subject string) *nats.Subscription {
+	t.Helper()
+
+	nc := srv.Conn(t)
+	sub, err := nc.SubscribeSync(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+	return sub
+}
+
+const testKey = "2b7e151628aed2a6abf7158809cf4f3c"
+
+var testDevAddr = lorawan.DevAddr{0x26, 0x01, 0x1b, 0xda}
+
+// saveTestSession stores an activated session with test keys; macVersion "" is 1.0.x
+func saveTestSession(t *testing.T, store *storagetest.MemoryStore, devEUI lorawan.EUI64, macVersion string) *models.DeviceSession {
+	t.Helper()
+
+	session := &models.DeviceSession{
+		DevEUI:      models.EUI64(devEUI),
+		DevAddr:     models.DevAddr(testDevAddr),
+		MACVersion:  macVersion,
+		FNwkSIntKey: testKey,
+		SNwkSIntKey: testKey,
+		NwkSEncKey:  testKey,
+		AppSKey:     testKey,
+		RX1Delay:    1,
+	}
+	if err := store.SaveDeviceSession(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// cacheTestUplink records a recent uplink of devEUI through gatewayID so downlinks can be routed
+func cacheTestUplink(p *Processor, devEUI lorawan.EUI64, gatewayID string) {
+	p.rxCacheMutex.Lock()
+	defer p.rxCacheMutex.Unlock()
+	p.deviceRxCache[devEUI] = &DeviceRxInfo{
+		GatewayID: gatewayID,
+		RxInfo: map[string]interface{}{
+			"tmst": float64(100000000), // 与 JSON 解码的 rxpk 一致
+			"freq": 470.3,
+			"datr": "SF7BW125",
+			"codr": "4/5",
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// nextTX waits for a downlink published to the gateway, nil when none arrives
+func nextTX(t *testing.T, sub *nats.Subscription) *models.GatewayTXMessage {
+	t.Helper()
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		return nil
+	}
+	var tx models.GatewayTXMessage
+	if err := json.Unmarshal(msg.Data, &tx); err != nil {
+		t.Fatalf("decode tx message: %v", err)
+	}
+	return &tx
+}
+
+// decodeDownlink parses the PHYPayload and MACPayload of a published downlink
+func decodeDownlink(t *testing.T, tx *models.GatewayTXMessage) (lorawan.PHYPayload, lorawan.MACPayload) {
+	t.Helper()
+
+	data, err := base64.StdEncoding.DecodeString(tx.TXPK.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var phy lorawan.PHYPayload
+	if err := phy.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	var mac lorawan.MACPayload
+	if err := mac.Unmarshal(phy.MACPayload, phy.MHDR.MType, false); err != nil {
+		t.Fatal(err)
+	}
+	return phy, mac
+}
+
+// testRxInfo returns the rxpk metadata of an uplink as decoded from gateway JSON
+func testRxInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"tmst": float64(100000000),
+		"freq": 470.3,
+		"datr": "SF7BW125",
+		"codr": "4/5",
+		"rssi": float64(-60),
+		"lsnr": 9.5,
+	}
+}
+
+// newTestUplink builds a LoRaWAN 1.0 data uplink from testDevAddr with a valid MIC;
+// payload is encrypted with the test AppSKey, or NwkSEncKey on FPort 0
+func newTestUplink(t *testing.T, mtype lorawan.MType, fCnt uint32, fPort *uint8, payload []byte) *lorawan.PHYPayload {
+	t.Helper()
+
+	key, _ := hex.DecodeString(testKey)
+	mac := lorawan.MACPayload{
+		FHDR:  lorawan.FHDR{DevAddr: testDevAddr, FCnt: uint16(fCnt)},
+		FPort: fPort,
+	}
+	if len(payload) > 0 {
+		mac.FRMPayload, _ = crypto.DecryptFRMPayload(key, true, [4]byte(testDevAddr), fCnt, payload)
+	}
+	macBytes, err := mac.Marshal(mtype, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phy := &lorawan.PHYPayload{
+		MHDR:       lorawan.MHDR{MType: mtype, Major: lorawan.LoRaWAN1_0},
+		MACPayload: macBytes,
+	}
+	var aesKey lorawan.AES128Key
+	copy(aesKey[:], key)
+	if err := phy.SetUplinkDataMIC(lorawan.LoRaWAN1_0, fCnt, 0, 0, aesKey, aesKey); err != nil {
+		t.Fatal(err)
+	}
+	return phy
+}
+
+// newTestJoinRequest builds a LoRaWAN 1.0 JOIN REQUEST of testDevEUI signed with testKey
+func newTestJoinRequest(t *testing.T, devNonce uint16) *lorawan.PHYPayload {
+	t.Helper()
+
+	phy := &lorawan.PHYPayload{
+		MHDR:       lorawan.MHDR{MType: lorawan.JoinRequest, Major: lorawan.LoRaWAN1_0},
+		MACPayload: make([]byte, 18),
+	}
+	copy(phy.MACPayload[8:16], testDevEUI[:])
+	phy.MACPayload[16] = byte(devNonce)
+	phy.MACPayload[17] = byte(devNonce >> 8)
+
+	key, _ := hex.DecodeString(testKey)
+	mic, err := lorawan.CalculateMIC(key, append([]byte{byte(phy.MHDR.MType<<5) | byte(phy.MHDR.Major)}, phy.MACPayload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	phy.MIC = mic
+	return phy
+}
+
+// createTestOTAADevice stores testDevEUI with testKey as its AppKey
+func createTestOTAADevice(t *testing.T, store *storagetest.MemoryStore) *models.Device {
+	t.Helper()
+
+	device := createTestDevice(t, store, testDevEUI)
+	if err := store.SetDeviceKeys(context.Background(), &models.DeviceKeys{DevEUI: models.EUI64(testDevEUI), AppKey: testKey}); err != nil {
+		t.Fatal(err)
+	}
+	return device
+}
+
+func TestDeviceDownlinkRequestFPort(t *testing.T) {
+	tests := []struct {
+		fPort    int
+		wantSent bool
+	}{
+		{0, false}, // MAC 命令走 FOpts 队列
+		{1, true},
+		{223, true},
+		{224, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("fPort %d", tt.fPort), func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			cacheTestUplink(p, testDevEUI, testGatewayID)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+			failed := subscribeSync(t, srv, "downlink.*.downlink_failed")
+
+			data, _ := json.Marshal(map[string]interface{}{"fPort": tt.fPort, "data": []byte{1}, "id": "frame-1"})
+			p.handleDeviceDownlinkRequest(&nats.Msg{Subject: "ns.device." + testDevEUI.String() + ".tx", Data: data})
+
+			tx := nextTX(t, txs)
+			if (tx != nil) != tt.wantSent {
+				t.Fatalf("downlink sent = %v, want %v", tx != nil, tt.wantSent)
+			}
+			if tt.wantSent {
+				if _, mac := decodeDownlink(t, tx); mac.FPort == nil || int(*mac.FPort) != tt.fPort {
+					t.Errorf("FPort = %v, want %d", mac.FPort, tt.fPort)
+				}
+				return
+			}
+			if _, err := failed.NextMsg(100 * time.Millisecond); err != nil {
+				t.Error("no downlink_failed event for a rejected FPort")
+			}
+		})
+	}
+}
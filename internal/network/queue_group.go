@@ -0,0 +1,21 @@
+package network
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// queueSubscribe 订阅上行主题，配置了 nats.queue_group 时加入队列组，
+// 由 NATS 在多个网络服务器实例间分摊消息。
+//
+// 只用于上行：下行请求、TX_ACK 和网关状态依赖实例内存中的上行缓存、
+// 待确认下行和时间参考，需要每个实例都收到。
+func (p *Processor) queueSubscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	group := p.config.NATS.QueueGroup
+	if group == "" {
+		return p.nc.Subscribe(subject, handler)
+	}
+
+	log.Info().Str("subject", subject).Str("queue", group).Msg("使用 NATS 队列组订阅")
+	return p.nc.QueueSubscribe(subject, group, handler)
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/natstest"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+func TestQueueSubscribeSplitsUplinks(t *testing.T) {
+	const uplinks = 10
+
+	tests := []struct {
+		name  string
+		group string
+		want  [2]int64 // 每个实例收到的上行数
+	}{
+		{"queue group", "network-server", [2]int64{5, 5}},
+		{"no queue group", "", [2]int64{uplinks, uplinks}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := natstest.Run(t)
+			cfg := &config.Config{}
+			cfg.NATS.QueueGroup = tt.group
+
+			var counts [2]atomic.Int64
+			for i := range counts {
+				i := i
+				nc := srv.Conn(t)
+				p := NewProcessor(nc, storagetest.New(), cfg)
+				if _, err := p.queueSubscribe("gateway.*.rx", func(*nats.Msg) { counts[i].Add(1) }); err != nil {
+					t.Fatal(err)
+				}
+				nc.Flush()
+			}
+
+			pub := srv.Conn(t)
+			for i := 0; i < uplinks; i++ {
+				pub.Publish("gateway."+testGatewayID+".rx", []byte("{}"))
+			}
+			pub.Flush()
+
+			deadline := time.Now().Add(time.Second)
+			for time.Now().Before(deadline) && counts[0].Load()+counts[1].Load() < tt.want[0]+tt.want[1] {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond) // 多收的消息也要计入
+			got := [2]int64{counts[0].Load(), counts[1].Load()}
+			if got != tt.want {
+				t.Errorf("uplinks per instance = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package network
+
+import (
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// rxInfoRelayKey 经中继转发的上行在 rxInfo 中记录中继的 DevEUI
+const rxInfoRelayKey = "relayDevEUI"
+
+// relayedVia 返回转发该上行的中继 DevEUI，直接收到的上行返回空
+func relayedVia(rxInfo map[string]interface{}) string {
+	relay, _ := rxInfo[rxInfoRelayKey].(string)
+	return relay
+}
+
+// handleRelayUplink 解出中继 FPort 226 上行中的终端帧，按普通上行处理。
+// 终端的下行需经中继 ForwardDownlinkReq 转发，目前不支持，终端只会收到上行处理结果
+func (p *Processor) handleRelayUplink(relayDevEUI lorawan.EUI64, gatewayID string, rxInfo map[string]interface{}, data []byte) {
+	ctx := traceContext(rxInfo)
+	relayEUI := relayDevEUI.String()
+
+	// TS011 只允许一级中继
+	if relayedVia(rxInfo) != "" {
+		logging.Ctx(ctx).Warn().Str("relay", relayEUI).Msg("丢弃多级中继转发的上行")
+		return
+	}
+
+	fwd, err := lorawan.ParseRelayForwardUplink(data)
+	if err != nil {
+		logging.Ctx(ctx).Warn().Err(err).Str("relay", relayEUI).Msg("解析中继转发上行失败")
+		return
+	}
+
+	var inner lorawan.PHYPayload
+	if err := inner.UnmarshalBinary(fwd.PHYPayload); err != nil {
+		logging.Ctx(ctx).Warn().Err(err).Str("relay", relayEUI).Msg("解析中继转发的终端 PHY payload 失败")
+		return
+	}
+
+	// 终端的无线参数取自中继的接收元数据，网关时间戳只对中继有效
+	innerRxInfo := make(map[string]interface{}, len(rxInfo)+1)
+	for k, v := range rxInfo {
+		innerRxInfo[k] = v
+	}
+	delete(innerRxInfo, "context")
+	delete(innerRxInfo, "tmst")
+	delete(innerRxInfo, "tmms")
+	innerRxInfo["freq"] = float64(fwd.Frequency) / 1000000.0
+	innerRxInfo["datr"] = p.getDRString(fwd.DataRate)
+	innerRxInfo["dr"] = int(fwd.DataRate)
+	innerRxInfo["rssi"] = float64(fwd.RSSI)
+	innerRxInfo["lsnr"] = float64(fwd.SNR)
+	innerRxInfo[rxInfoRelayKey] = relayEUI
+
+	logging.Ctx(ctx).Info().
+		Str("relay", relayEUI).
+		Str("gateway", gatewayID).
+		Uint8("mtype", uint8(inner.MHDR.MType)).
+		Uint32("freq", fwd.Frequency).
+		Uint8("dr", fwd.DataRate).
+		Int("rssi", fwd.RSSI).
+		Int("snr", fwd.SNR).
+		Uint8("worChannel", fwd.WORChannel).
+		Msg("收到中继转发的终端上行")
+
+	// 终端帧异步处理，不阻塞中继自身的 ACK
+	switch inner.MHDR.MType {
+	case lorawan.JoinRequest:
+		go p.handleJoinRequest(&inner, gatewayID, innerRxInfo)
+	case lorawan.UnconfirmedDataUp, lorawan.ConfirmedDataUp:
+		go p.handleDataUp(&inner, gatewayID, innerRxInfo)
+	default:
+		logging.Ctx(ctx).Warn().
+			Str("relay", relayEUI).
+			Uint8("mtype", uint8(inner.MHDR.MType)).
+			Msg("中继转发了未处理的消息类型")
+	}
+}
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+var (
+	testRelayDevEUI  = lorawan.EUI64{0x70, 0xb3, 0xd5, 0x7e, 0xd0, 0x00, 0x00, 0x0f}
+	testRelayDevAddr = lorawan.DevAddr{0x26, 0x01, 0x1b, 0xee}
+)
+
+// newRelayUplink 构造中继在 FPort 226 上发送的 ForwardUplinkReq，payload 使用 NwkSEncKey 加密
+func newRelayUplink(t *testing.T, fCnt uint32, forward []byte) *lorawan.PHYPayload {
+	t.Helper()
+
+	key, _ := hex.DecodeString(testKey)
+	fPort := uint8(lorawan.RelayFPort)
+	mac := lorawan.MACPayload{
+		FHDR:  lorawan.FHDR{DevAddr: testRelayDevAddr, FCnt: uint16(fCnt)},
+		FPort: &fPort,
+	}
+	mac.FRMPayload, _ = crypto.DecryptFRMPayload(key, true, [4]byte(testRelayDevAddr), fCnt, forward)
+	macBytes, err := mac.Marshal(lorawan.UnconfirmedDataUp, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phy := &lorawan.PHYPayload{
+		MHDR:       lorawan.MHDR{MType: lorawan.UnconfirmedDataUp, Major: lorawan.LoRaWAN1_0},
+		MACPayload: macBytes,
+	}
+	var aesKey lorawan.AES128Key
+	copy(aesKey[:], key)
+	if err := phy.SetUplinkDataMIC(lorawan.LoRaWAN1_0, fCnt, 0, 0, aesKey, aesKey); err != nil {
+		t.Fatal(err)
+	}
+	return phy
+}
+
+func TestRelayForwardedUplinkProcessed(t *testing.T) {
+	fPort := uint8(1)
+	innerPHY, err := newTestUplink(t, lorawan.UnconfirmedDataUp, 1, &fPort, []byte{0x42}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DR5、RSSI -80、SNR 7、WOR 信道 1、470.3MHz
+	header := []byte{0x3b, 0x58, 0x01, 0x18, 0xc3, 0x47}
+
+	tests := []struct {
+		name      string
+		forward   []byte
+		rxInfo    map[string]interface{}
+		wantInner bool
+	}{
+		{"forwarded uplink", append(header, innerPHY...), testRxInfo(), true},
+		{"metadata only", header, testRxInfo(), false},
+		{"invalid inner frame", append(header, 0x40), testRxInfo(), false},
+		// 中继自身也是经中继接入的，TS011 只允许一级中继
+		{"nested relay", append(header, innerPHY...), func() map[string]interface{} {
+			rxInfo := testRxInfo()
+			rxInfo[rxInfoRelayKey] = "70b3d57ed000000e"
+			return rxInfo
+		}(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			ctx := context.Background()
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			createTestDevice(t, store, testRelayDevEUI)
+			relaySession := &models.DeviceSession{
+				DevEUI:      models.EUI64(testRelayDevEUI),
+				DevAddr:     models.DevAddr(testRelayDevAddr),
+				FNwkSIntKey: testKey,
+				SNwkSIntKey: testKey,
+				NwkSEncKey:  testKey,
+				AppSKey:     testKey,
+				RX1Delay:    1,
+			}
+			if err := store.SaveDeviceSession(ctx, relaySession); err != nil {
+				t.Fatal(err)
+			}
+			ups := subscribeSync(t, srv, "application.*.device.*.rx")
+
+			p.handleDataUp(newRelayUplink(t, 1, tt.forward), testGatewayID, tt.rxInfo)
+
+			// 中继帧本身不作为应用数据转发
+			msg, err := ups.NextMsg(time.Second)
+			if !tt.wantInner {
+				if err == nil {
+					t.Fatalf("uplink forwarded: %s", msg.Data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("relayed end-device uplink not processed")
+			}
+			var up struct {
+				DevEUI string `json:"devEUI"`
+				FPort  uint8  `json:"fPort"`
+				Data   []byte `json:"data"`
+				RxInfo []struct {
+					GatewayID   string   `json:"gatewayID"`
+					RelayDevEUI string   `json:"relayDevEUI"`
+					RSSI        float64  `json:"rssi"`
+					LSNR        float64  `json:"lsnr"`
+					Freq        float64  `json:"freq"`
+					Tmst        *float64 `json:"tmst"`
+				} `json:"rxInfo"`
+			}
+			if err := json.Unmarshal(msg.Data, &up); err != nil || len(up.RxInfo) != 1 {
+				t.Fatalf("uplink = %s", msg.Data)
+			}
+			if up.DevEUI != testDevEUI.String() || up.FPort != 1 || len(up.Data) != 1 || up.Data[0] != 0x42 {
+				t.Errorf("uplink devEUI %s fPort %d data %x, want %s 1 42", up.DevEUI, up.FPort, up.Data, testDevEUI)
+			}
+			// 无线参数取自中继的接收元数据
+			rx := up.RxInfo[0]
+			if rx.RelayDevEUI != testRelayDevEUI.String() || rx.GatewayID != testGatewayID || rx.RSSI != -80 || rx.LSNR != 7 || rx.Freq != 470.3 || rx.Tmst != nil {
+				t.Errorf("rxInfo = %+v", rx)
+			}
+			if extra, err := ups.NextMsg(200 * time.Millisecond); err == nil {
+				t.Errorf("extra uplink forwarded: %s", extra.Data)
+			}
+
+			if session, _ := store.GetDeviceSession(ctx, testDevEUI); session.FCntUp != 1 {
+				t.Errorf("end-device FCntUp = %d, want 1", session.FCntUp)
+			}
+			if session, _ := store.GetDeviceSession(ctx, testRelayDevEUI); session.FCntUp != 1 {
+				t.Errorf("relay FCntUp = %d, want 1", session.FCntUp)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// 重放过滤器默认容量与误判率
+const (
+	defaultReplayFilterEntries = 1000000
+	defaultReplayFilterFPRate  = 0.001
+)
+
+// replayFilter 重放检查（DevNonce、帧计数器）的布隆过滤器快速路径：
+// 过滤器中没有的键一定没有出现过，直接放行而不查数据库；命中时可能是误判，
+// 再查询权威存储。过滤器只增不删，超过容量后误判率上升，但结果仍然正确。
+//
+// 启动时过滤器为空，在用存储中已有的键预热并调用 markLoaded 之前，
+// 所有检查都回退到存储，避免重启后把已用过的键当成没见过。
+type replayFilter struct {
+	mu     sync.RWMutex
+	bits   []uint64
+	m      uint64 // 位数
+	k      uint32 // 哈希函数个数
+	loaded atomic.Bool
+
+	fastPath uint64 // 未命中过滤器、跳过存储查询的次数
+	lookups  uint64 // 回退到存储查询的次数
+}
+
+// newReplayFilter 按预计键数和目标误判率创建过滤器，参数不合法时使用默认值
+func newReplayFilter(entries int, fpRate float64) *replayFilter {
+	if entries <= 0 {
+		entries = defaultReplayFilterEntries
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = defaultReplayFilterFPRate
+	}
+
+	// m = -n·ln(p) / (ln2)²，k = m/n·ln2
+	m := uint64(math.Ceil(-float64(entries) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint32(math.Round(float64(m) / float64(entries) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &replayFilter{
+		bits: make([]uint64, m/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hashes 用两个 64 位哈希做双重哈希，得到 k 个位置
+func (f *replayFilter) hashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	h1 := h.Sum64()
+	h.Write([]byte{0xff})
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
+
+// Add 记录一个已使用的键
+func (f *replayFilter) Add(key []byte) {
+	if f == nil {
+		return
+	}
+	h1, h2 := f.hashes(key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := uint32(0); i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) % f.m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// MayContain 键可能出现过时返回 true；返回 false 表示一定没有出现过
+func (f *replayFilter) MayContain(key []byte) bool {
+	h1, h2 := f.hashes(key)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := uint32(0); i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) % f.m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// markLoaded 过滤器已包含存储中的全部键，之后未命中的检查可以跳过存储
+func (f *replayFilter) markLoaded() {
+	if f == nil {
+		return
+	}
+	f.loaded.Store(true)
+}
+
+// Seen 判断键是否已经使用过：过滤器已预热且未命中时直接返回 false，
+// 否则调用 lookup 查询权威存储；nil 过滤器总是查询存储
+func (f *replayFilter) Seen(key []byte, lookup func() (bool, error)) (bool, error) {
+	if f == nil {
+		return lookup()
+	}
+	if f.loaded.Load() && !f.MayContain(key) {
+		atomic.AddUint64(&f.fastPath, 1)
+		return false, nil
+	}
+
+	atomic.AddUint64(&f.lookups, 1)
+	return lookup()
+}
+
+// Stats 返回快速路径放行次数和存储查询次数
+func (f *replayFilter) Stats() (fastPath, lookups uint64) {
+	if f == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&f.fastPath), atomic.LoadUint64(&f.lookups)
+}
@@ -0,0 +1,129 @@
+package network
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestReplayFilterSeen(t *testing.T) {
+	tests := []struct {
+		name        string
+		loaded      bool
+		key         string
+		wantSeen    bool
+		wantLookups uint64
+	}{
+		// 已预热且未命中，直接放行
+		{"new key fast path", true, "new", false, 0},
+		// 命中过滤器，回退到存储
+		{"used key checks store", true, "used", true, 1},
+		// 未预热时总是查询存储
+		{"not loaded", false, "new", false, 1},
+		{"not loaded used key", false, "used", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newReplayFilter(1000, 0.001)
+			f.Add([]byte("used"))
+			if tt.loaded {
+				f.markLoaded()
+			}
+
+			lookups := uint64(0)
+			seen, err := f.Seen([]byte(tt.key), func() (bool, error) {
+				lookups++
+				return tt.key == "used", nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen != tt.wantSeen {
+				t.Errorf("Seen() = %v, want %v", seen, tt.wantSeen)
+			}
+			if lookups != tt.wantLookups {
+				t.Errorf("store queried %d times, want %d", lookups, tt.wantLookups)
+			}
+			fastPath, statLookups := f.Stats()
+			if statLookups != tt.wantLookups || fastPath != 1-tt.wantLookups {
+				t.Errorf("Stats() = %d, %d", fastPath, statLookups)
+			}
+		})
+	}
+}
+
+func TestReplayFilterNil(t *testing.T) {
+	var f *replayFilter
+	f.Add([]byte("key"))
+	f.markLoaded()
+
+	// 未启用时每次都查询存储
+	lookups := 0
+	for i := 0; i < 2; i++ {
+		f.Seen([]byte("key"), func() (bool, error) {
+			lookups++
+			return false, nil
+		})
+	}
+	if lookups != 2 {
+		t.Errorf("store queried %d times, want 2", lookups)
+	}
+	if fastPath, statLookups := f.Stats(); fastPath != 0 || statLookups != 0 {
+		t.Errorf("Stats() = %d, %d", fastPath, statLookups)
+	}
+}
+
+func TestReplayFilterFastPathsNonReplays(t *testing.T) {
+	const entries = 10000
+	f := newReplayFilter(entries, 0.01)
+	key := func(n uint32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, n)
+		return b
+	}
+	for i := uint32(0); i < entries; i++ {
+		f.Add(key(i))
+	}
+	f.markLoaded()
+
+	// 已添加的键一定命中
+	for i := uint32(0); i < entries; i++ {
+		if !f.MayContain(key(i)) {
+			t.Fatalf("added key %d not in filter", i)
+		}
+	}
+
+	// 没见过的键绝大多数走快速路径，误判率接近配置值
+	for i := uint32(entries); i < 2*entries; i++ {
+		f.Seen(key(i), func() (bool, error) { return false, nil })
+	}
+	fastPath, lookups := f.Stats()
+	if fastPath+lookups != entries {
+		t.Fatalf("Stats() = %d, %d", fastPath, lookups)
+	}
+	if rate := float64(lookups) / entries; rate > 0.02 {
+		t.Errorf("false positive rate = %.4f, want about 0.01", rate)
+	}
+}
+
+func TestNewReplayFilterDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		fpRate  float64
+	}{
+		{"zero entries", 0, 0.001},
+		{"zero rate", 1000000, 0},
+		{"rate one", 1000000, 1},
+	}
+
+	want := newReplayFilter(defaultReplayFilterEntries, defaultReplayFilterFPRate)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newReplayFilter(tt.entries, tt.fpRate)
+			if f.m != want.m || f.k != want.k {
+				t.Errorf("m, k = %d, %d, want %d, %d", f.m, f.k, want.m, want.k)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// testRadios 两条射频链各负责一段下行频率
+var testRadios = models.GatewayRadios{
+	{RFCh: 0, MinFrequency: 470000000, MaxFrequency: 479900000},
+	{RFCh: 1, MinFrequency: 480000000, MaxFrequency: 489900000},
+}
+
+func TestGatewayMetaRFChain(t *testing.T) {
+	tests := []struct {
+		name        string
+		meta        *gatewayMeta
+		freq        uint32
+		wantRFCh    uint8
+		canTransmit bool
+	}{
+		{"unregistered gateway", nil, 480300000, 0, true},
+		{"no radio configuration", &gatewayMeta{}, 480300000, 0, true},
+		{"first chain", &gatewayMeta{Radios: testRadios}, 470300000, 0, true},
+		{"second chain", &gatewayMeta{Radios: testRadios}, 480300000, 1, true},
+		{"upper edge", &gatewayMeta{Radios: testRadios}, 489900000, 1, true},
+		// 没有射频链覆盖该频率
+		{"no matching chain", &gatewayMeta{Radios: testRadios}, 500300000, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.meta.rfChain(tt.freq); got != tt.wantRFCh {
+				t.Errorf("rfChain(%d) = %d, want %d", tt.freq, got, tt.wantRFCh)
+			}
+			if got := tt.meta.canTransmit(tt.freq); got != tt.canTransmit {
+				t.Errorf("canTransmit(%d) = %v, want %v", tt.freq, got, tt.canTransmit)
+			}
+		})
+	}
+}
+
+func TestDownlinkRFChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		radios   models.GatewayRadios // nil 表示未注册的网关
+		wantRFCh int
+	}{
+		{"unregistered gateway", nil, 0},
+		// 默认配置下 470.3MHz 上行的 RX1 在 480.3MHz
+		{"configured chain", testRadios, 1},
+		{"single chain", models.GatewayRadios{{RFCh: 2, MinFrequency: 470000000, MaxFrequency: 510000000}}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			session := saveTestSession(t, store, testDevEUI, "")
+			if tt.radios != nil {
+				gw := &models.Gateway{GatewayID: models.EUI64{1, 2, 3, 4, 5, 6, 7, 8}, Radios: tt.radios}
+				if err := store.CreateGateway(context.Background(), gw); err != nil {
+					t.Fatal(err)
+				}
+			}
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			p.handleDownlink(session, testGatewayID, testRxInfo(), []lorawan.MACCommand{{CID: lorawan.DevStatusReq}}, false)
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("downlink not sent")
+			}
+			if tx.TXPK.Freq != 480.3 || tx.TXPK.RFCh != tt.wantRFCh {
+				t.Errorf("txpk freq %v rfch %d, want 480.3 rfch %d", tx.TXPK.Freq, tx.TXPK.RFCh, tt.wantRFCh)
+			}
+		})
+	}
+}
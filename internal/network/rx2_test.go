@@ -0,0 +1,103 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// rx2TestConfig TDD 模式，RX2 频率故意不在信道栅格上
+func rx2TestConfig() *config.Config {
+	return &config.Config{CN470: config.CN470Config{
+		Mode:      "TDD",
+		Hardware:  config.CN470HardwareConfig{SupportsTX470_490MHz: true},
+		TDD:       config.CN470TDD{StartFreq: 470300000, EndFreq: 471900000, Channels: 8},
+		Channels:  config.CN470Channels{ChannelSpacing: 200000},
+		RXWindows: config.CN470RXWindows{RX1Delay: 1, RX2Delay: 2, RX2Frequency: 471050000, RX2DataRate: 2},
+	}}
+}
+
+func TestRX2UsesConfiguredParameters(t *testing.T) {
+	p, store, srv := newTestProcessor(t, rx2TestConfig())
+	createTestDevice(t, store, testDevEUI)
+	session := saveTestSession(t, store, testDevEUI, "")
+	txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+	p.handleDownlink(session, testGatewayID, testRxInfo(), []lorawan.MACCommand{{CID: lorawan.DevStatusReq}}, false)
+
+	// TDD 模式 RX1 之后再在 RX2 发送一次
+	rx1, rx2 := nextTX(t, txs), nextTX(t, txs)
+	if rx1 == nil || rx2 == nil {
+		t.Fatal("RX1 and RX2 downlinks not both sent")
+	}
+	if rx1.TXPK.Freq != 470.3 {
+		t.Errorf("RX1 freq = %v, want 470.3", rx1.TXPK.Freq)
+	}
+	if rx2.TXPK.Freq != 471.05 || rx2.TXPK.DatR != "SF10BW125" {
+		t.Errorf("RX2 freq %v datr %s, want 471.05 SF10BW125", rx2.TXPK.Freq, rx2.TXPK.DatR)
+	}
+	if rx2.TXPK.Tmst == nil || *rx2.TXPK.Tmst != 102000000 {
+		t.Errorf("RX2 tmst = %v, want 102000000", rx2.TXPK.Tmst)
+	}
+}
+
+func TestRX2Override(t *testing.T) {
+	rx2DR := 4
+
+	tests := []struct {
+		name    string
+		mode    string
+		band    string
+		profile *models.DeviceProfile
+		freq    uint32
+		dr      int
+	}{
+		{"standard FDD", "STANDARD_FDD", "", nil, 471050000, 2},
+		{"custom FDD", "CUSTOM_FDD", "", nil, 471050000, 2},
+		{"TDD", "TDD", "", nil, 471050000, 2},
+		{"device profile", "TDD", "", &models.DeviceProfile{RX2Frequency: 470900000, RX2DR: &rx2DR}, 470900000, 4},
+		{"EU868 default", "", "EU868", nil, 869525000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := rx2TestConfig()
+			cfg.CN470.Mode = tt.mode
+			cfg.Network.Band = tt.band
+			p, _, _ := newTestProcessor(t, cfg)
+
+			o := p.rx2Override(tt.profile)
+			if o.Frequency != tt.freq || o.DataRate == nil || *o.DataRate != tt.dr || o.Window != WindowRX2 {
+				t.Errorf("rx2Override() = %d DR%v %s, want %d DR%d RX2", o.Frequency, o.DataRate, o.Window, tt.freq, tt.dr)
+			}
+		})
+	}
+}
+
+func TestValidateCN470RX2(t *testing.T) {
+	tests := []struct {
+		name    string
+		freq    uint32
+		dr      int
+		wantErr bool
+	}{
+		{"valid", 471050000, 2, false},
+		{"outside hardware range", 505300000, 2, true},
+		{"invalid data rate", 471050000, 6, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := rx2TestConfig()
+			cfg.CN470.RXWindows.RX2Frequency = tt.freq
+			cfg.CN470.RXWindows.RX2DataRate = tt.dr
+			p, _, _ := newTestProcessor(t, cfg)
+
+			if err := p.validateCN470Configuration(); (err != nil) != tt.wantErr {
+				t.Errorf("validateCN470Configuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package network
+
+import (
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// joinRxDelay JOIN ACCEPT 中下发给设备的数据 RX1 延迟（RxDelay 字段，1-15 秒），
+// 设备配置文件设置了 rx1_delay 时优先使用
+//
+// 与 join_accept_delay1 无关：后者只决定 JOIN ACCEPT 自身的发送时刻
+func (p *Processor) joinRxDelay(profile *models.DeviceProfile) uint8 {
+	delay := p.config.CN470.RXWindows.RX1Delay
+	if profile != nil && profile.RX1Delay > 0 {
+		delay = profile.RX1Delay
+	}
+	if delay < 1 {
+		return 1
+	}
+	if delay > 15 {
+		return 15
+	}
+	return uint8(delay)
+}
+
+// sessionRX1Delay 数据下行的 RX1 延迟，使用 JOIN 时告知设备的值（0 按规范视为 1 秒）
+func sessionRX1Delay(session *models.DeviceSession) time.Duration {
+	if session.RX1Delay == 0 {
+		return time.Second
+	}
+	return time.Duration(session.RX1Delay) * time.Second
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestJoinRxDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  int
+		profile *models.DeviceProfile
+		want    uint8
+	}{
+		{"unset", 0, nil, 1},
+		{"config", 3, nil, 3},
+		{"profile overrides config", 3, &models.DeviceProfile{RX1Delay: 5}, 5},
+		{"profile unset", 3, &models.DeviceProfile{}, 3},
+		{"clamped to 15", 20, nil, 15},
+		{"negative", -1, nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.CN470.RXWindows.RX1Delay = tt.config
+			p, _, _ := newTestProcessor(t, cfg)
+
+			if got := p.joinRxDelay(tt.profile); got != tt.want {
+				t.Errorf("joinRxDelay() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataDownlinkUsesSessionRX1Delay(t *testing.T) {
+	fPort := uint8(1)
+
+	tests := []struct {
+		name     string
+		rx1Delay uint8
+		ack      bool // true 为确认上行的 ACK，false 为应用下行
+		tmst     uint32
+	}{
+		// 配置的 rx1_delay 为 1 秒，下行必须使用会话中设备收到的值
+		{"ACK, default delay", 0, true, 101000000},
+		{"ACK, session 1s", 1, true, 101000000},
+		{"ACK, session 5s", 5, true, 105000000},
+		{"application downlink, session 3s", 3, false, 103000000},
+		{"application downlink, session 5s", 5, false, 105000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, overrideTestConfig())
+			createTestDevice(t, store, testDevEUI)
+			session := saveTestSession(t, store, testDevEUI, "")
+			session.RX1Delay = tt.rx1Delay
+			store.SaveDeviceSession(context.Background(), session)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			if tt.ack {
+				p.handleDataUp(newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1}), testGatewayID, testRxInfo())
+			} else {
+				cacheTestUplink(p, testDevEUI, testGatewayID)
+				data, _ := json.Marshal(map[string]interface{}{"fPort": 1, "data": []byte{1}})
+				p.handleDeviceDownlinkRequest(&nats.Msg{Subject: fmt.Sprintf("ns.device.%s.tx", testDevEUI), Data: data})
+			}
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if tx.TXPK.Tmst == nil || *tx.TXPK.Tmst != tt.tmst {
+				t.Errorf("txpk tmst = %v, want %d", tx.TXPK.Tmst, tt.tmst)
+			}
+			if _, err := txs.NextMsg(100 * time.Millisecond); err == nil {
+				t.Error("more than one downlink sent")
+			}
+		})
+	}
+}
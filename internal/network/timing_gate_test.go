@@ -0,0 +1,57 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestDownlinkTimingGate(t *testing.T) {
+	tests := []struct {
+		name       string
+		gate       string
+		unreliable bool
+		mtype      lorawan.MType
+		immediate  bool
+		freq       float64
+	}{
+		{"reliable gateway", "", false, lorawan.UnconfirmedDataDown, false, 480.3},
+		{"unreliable gateway", "", true, lorawan.UnconfirmedDataDown, true, 480.3},
+		{"unreliable gateway immediate", "immediate", true, lorawan.UnconfirmedDataDown, true, 480.3},
+		{"unreliable gateway rx2", "rx2", true, lorawan.UnconfirmedDataDown, true, 505.3},
+		{"gate off", "off", true, lorawan.UnconfirmedDataDown, false, 480.3},
+		// JOIN ACCEPT 不受限制
+		{"join accept", "", true, lorawan.JoinAccept, false, 480.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := overrideTestConfig()
+			cfg.Network.DownlinkTimingGate = tt.gate
+			p, _, srv := newTestProcessor(t, cfg)
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+			if tt.unreliable {
+				p.timestampTracker.gatewayTimestamps[testGatewayID] = &GatewayTimestampInfo{WarmupCount: 3}
+			}
+
+			phy := lorawan.PHYPayload{MHDR: lorawan.MHDR{MType: tt.mtype, Major: lorawan.LoRaWAN1_0}}
+			rxInfo := map[string]interface{}{"tmst": float64(100000000), "freq": 470.3, "datr": "SF7BW125", "codr": "4/5"}
+			p.scheduleDownlink(testGatewayID, testDevAddr, phy, rxInfo, time.Second)
+
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("no downlink sent")
+			}
+			if tx.TXPK.Imme != tt.immediate {
+				t.Errorf("imme = %v, want %v", tx.TXPK.Imme, tt.immediate)
+			}
+			if !tt.immediate && (tx.TXPK.Tmst == nil || *tx.TXPK.Tmst != 101000000) {
+				t.Errorf("tmst = %v, want 101000000", tx.TXPK.Tmst)
+			}
+			if tx.TXPK.Freq != tt.freq {
+				t.Errorf("freq = %v, want %v", tx.TXPK.Freq, tt.freq)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package network
+
+import (
+	"context"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+)
+
+// traceContext 返回带上行追踪 ID 的 context，追踪 ID 由网关桥生成并随 rxInfo 传递
+func traceContext(rxInfo map[string]interface{}) context.Context {
+	traceID, _ := rxInfo[logging.TraceIDField].(string)
+	return logging.WithTraceID(context.Background(), traceID)
+}
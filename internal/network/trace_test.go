@@ -0,0 +1,91 @@
+package network
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestTraceIDPropagation(t *testing.T) {
+	traceIDPattern := regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+	tests := []struct {
+		name    string
+		traceID string // 网关桥带来的追踪 ID，空表示旧版网关桥
+	}{
+		{"from bridge", "0123456789abcdef"},
+		{"generated", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureFrameLogs(t)
+			p, store, srv := newTestProcessor(t, nil)
+			createTestDevice(t, store, testDevEUI)
+			saveTestSession(t, store, testDevEUI, "")
+			ups := subscribeSync(t, srv, "application.*.device.*.rx")
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			fPort := uint8(1)
+			phyBytes, err := newTestUplink(t, lorawan.ConfirmedDataUp, 1, &fPort, []byte{1}).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := json.Marshal(models.GatewayRXMessage{
+				GatewayID: testGatewayID,
+				RXPK:      models.RXPacket{Tmst: 100000000, Freq: 470.3, DatR: "SF7BW125", CodR: "4/5", RSSI: -60, LSNR: 9.5, Data: base64.StdEncoding.EncodeToString(phyBytes)},
+				TraceID:   tt.traceID,
+			})
+			p.handleGatewayRX(&nats.Msg{Subject: "gateway." + testGatewayID + ".rx", Data: data})
+
+			// 应用消息带追踪 ID
+			msg, err := ups.NextMsg(time.Second)
+			if err != nil {
+				t.Fatal("uplink not forwarded")
+			}
+			var up struct {
+				TraceID string `json:"traceID"`
+			}
+			json.Unmarshal(msg.Data, &up)
+			traceID := tt.traceID
+			if traceID == "" {
+				if !traceIDPattern.MatchString(up.TraceID) {
+					t.Fatalf("generated trace ID = %q", up.TraceID)
+				}
+				traceID = up.TraceID
+			} else if up.TraceID != traceID {
+				t.Errorf("uplink trace ID = %q, want %q", up.TraceID, traceID)
+			}
+
+			// ACK 下行带同一个追踪 ID
+			tx := nextTX(t, txs)
+			if tx == nil {
+				t.Fatal("ACK not sent")
+			}
+			if tx.TraceID != traceID {
+				t.Errorf("downlink trace ID = %q, want %q", tx.TraceID, traceID)
+			}
+
+			// 处理该上行的日志带追踪 ID
+			traced := 0
+			for _, line := range bytes.Split(logs.Bytes(), []byte("\n")) {
+				var entry map[string]interface{}
+				if json.Unmarshal(line, &entry) == nil && entry[logging.TraceIDField] == traceID {
+					traced++
+				}
+			}
+			if traced == 0 {
+				t.Errorf("no log line with trace ID %s:\n%s", traceID, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// Semtech UDP 协议 TX_ACK error 取值
+const (
+	txAckNone            = "NONE"
+	txAckTooLate         = "TOO_LATE"
+	txAckTooEarly        = "TOO_EARLY"
+	txAckCollisionPacket = "COLLISION_PACKET"
+	txAckCollisionBeacon = "COLLISION_BEACON"
+	txAckTxFreq          = "TX_FREQ"
+	txAckTxPower         = "TX_POWER"
+	txAckGPSUnlocked     = "GPS_UNLOCKED"
+)
+
+// txAckPolicy 网关拒绝下行后的处理方式
+type txAckPolicy int
+
+const (
+	txAckPolicyNone        txAckPolicy = iota // 发射成功
+	txAckPolicyRetryRX2                       // 时序或冲突错误，改在 RX2 重发
+	txAckPolicyConfigError                    // 频率/功率超出网关能力，配置错误，不重试
+	txAckPolicyNoGPS                          // 网关 GPS 未锁定，改用计数器（context）时序
+	txAckPolicyFail                           // 未知错误，只记录失败
+)
+
+// txAckPolicyFor 把 TX_ACK error 映射到处理方式
+func txAckPolicyFor(txError string) txAckPolicy {
+	switch txError {
+	case "", txAckNone:
+		return txAckPolicyNone
+	case txAckTooLate, txAckTooEarly, txAckCollisionPacket, txAckCollisionBeacon:
+		return txAckPolicyRetryRX2
+	case txAckTxFreq, txAckTxPower:
+		return txAckPolicyConfigError
+	case txAckGPSUnlocked:
+		return txAckPolicyNoGPS
+	default:
+		return txAckPolicyFail
+	}
+}
+
+// scheduledRX1 最近一次按 RX1 调度的下行，TX_ACK 报时序错误时用于 RX2 重发
+type scheduledRX1 struct {
+	devAddr lorawan.DevAddr
+	phy     lorawan.PHYPayload
+	rxInfo  map[string]interface{}
+	at      time.Time
+}
+
+// rememberRX1 记录网关最近的 RX1 下行
+func (p *Processor) rememberRX1(gatewayID string, devAddr lorawan.DevAddr, phy lorawan.PHYPayload, rxInfo map[string]interface{}) {
+	p.pendingTxMutex.Lock()
+	p.lastRX1[gatewayID] = &scheduledRX1{devAddr: devAddr, phy: phy, rxInfo: rxInfo, at: time.Now()}
+	p.pendingTxMutex.Unlock()
+}
+
+// applyTxAckPolicy 按 TX_ACK 错误处理被拒绝的下行，返回 true 表示已在 RX2 重发
+func (p *Processor) applyTxAckPolicy(gatewayID string, pending *pendingTxInfo, txError string) bool {
+	switch txAckPolicyFor(txError) {
+	case txAckPolicyRetryRX2:
+		return p.retryInRX2(gatewayID, pending, txError)
+
+	case txAckPolicyConfigError:
+		log.Error().
+			Str("gateway", gatewayID).
+			Str("devEUI", pending.devEUI.String()).
+			Str("txError", txError).
+			Msg("网关拒绝下行：频率或功率超出网关能力，请检查频段和网关配置")
+
+	case txAckPolicyNoGPS:
+		// GPS 时间不可用，Class B 等需要 GPS 的调度改用计数器时序
+		p.gpsTime.Invalidate(gatewayID)
+		log.Warn().
+			Str("gateway", gatewayID).
+			Msg("网关 GPS 未锁定，改用计数器时序下行")
+
+	case txAckPolicyFail:
+		log.Warn().
+			Str("gateway", gatewayID).
+			Str("devEUI", pending.devEUI.String()).
+			Str("txError", txError).
+			Msg("网关拒绝下行")
+	}
+	return false
+}
+
+// retryInRX2 在 RX2 重发 RX1 被拒绝的下行，每个下行只重发一次
+func (p *Processor) retryInRX2(gatewayID string, pending *pendingTxInfo, txError string) bool {
+	// TDD 等模式已同时调度了 RX2
+	if pending.retried || p.shouldUseRX2() {
+		return false
+	}
+
+	p.pendingTxMutex.Lock()
+	rx1, ok := p.lastRX1[gatewayID]
+	delete(p.lastRX1, gatewayID)
+	p.pendingTxMutex.Unlock()
+
+	if !ok || rx1.at.Before(pending.lastDownlink.Time.Add(-time.Second)) {
+		return false
+	}
+
+	// 重发的 TX_ACK 仍关联到同一个下行
+	pending.retried = true
+	pending.lastDownlink.Time = time.Now()
+	p.pendingTxMutex.Lock()
+	p.pendingTx[gatewayID] = pending
+	p.pendingTxMutex.Unlock()
+
+	rx2Delay := time.Duration(p.config.CN470.RXWindows.RX2Delay) * time.Second
+	rx2 := p.rx2Override(p.deviceProfile(context.Background(), pending.devEUI))
+	p.scheduleDownlinkWithOverride(gatewayID, rx1.devAddr, rx1.phy, rx1.rxInfo, rx2Delay, rx2)
+
+	logging.Frame().Info().
+		Str("gateway", gatewayID).
+		Str("devEUI", pending.devEUI.String()).
+		Str("txError", txError).
+		Dur("rx2Delay", rx2Delay).
+		Msg("RX1 被网关拒绝，改在 RX2 重发")
+	return true
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestTxAckPolicyFor(t *testing.T) {
+	tests := []struct {
+		txError string
+		want    txAckPolicy
+	}{
+		{"", txAckPolicyNone},
+		{"NONE", txAckPolicyNone},
+		{"TOO_LATE", txAckPolicyRetryRX2},
+		{"TOO_EARLY", txAckPolicyRetryRX2},
+		{"COLLISION_PACKET", txAckPolicyRetryRX2},
+		{"COLLISION_BEACON", txAckPolicyRetryRX2},
+		{"TX_FREQ", txAckPolicyConfigError},
+		{"TX_POWER", txAckPolicyConfigError},
+		{"GPS_UNLOCKED", txAckPolicyNoGPS},
+		{"SOMETHING_ELSE", txAckPolicyFail},
+	}
+
+	for _, tt := range tests {
+		if got := txAckPolicyFor(tt.txError); got != tt.want {
+			t.Errorf("txAckPolicyFor(%q) = %d, want %d", tt.txError, got, tt.want)
+		}
+	}
+}
+
+func TestTxAckPolicyApplied(t *testing.T) {
+	tests := []struct {
+		name        string
+		acks        []string // 依次收到的 TX_ACK error
+		wantRetry   bool     // 在 RX2 重发
+		wantTxError string   // 最终记录的发射错误
+		wantGPS     bool     // 网关 GPS 参考点仍有效
+	}{
+		{"too late retried in RX2", []string{"TOO_LATE"}, true, "", true},
+		{"collision retried in RX2", []string{"COLLISION_PACKET"}, true, "", true},
+		{"retry acked", []string{"TOO_EARLY", "NONE"}, true, "", true},
+		{"retried only once", []string{"TOO_LATE", "TOO_LATE"}, true, "TOO_LATE", true},
+		{"frequency not retried", []string{"TX_FREQ"}, false, "TX_FREQ", true},
+		{"power not retried", []string{"TX_POWER"}, false, "TX_POWER", true},
+		{"GPS unlocked", []string{"GPS_UNLOCKED"}, false, "GPS_UNLOCKED", false},
+		{"unknown error", []string{"SOMETHING_ELSE"}, false, "SOMETHING_ELSE", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, srv := newTestProcessor(t, overrideTestConfig())
+			createTestDevice(t, store, testDevEUI)
+			p.gpsTime.UpdateFromRX(testGatewayID, 1451260818000, 100000000, time.Now())
+			txs := subscribeSync(t, srv, "gateway."+testGatewayID+".tx")
+
+			rxInfo := testRxInfo()
+			rxInfo["context"] = "eyJ0bXN0IjoxMDAwMDAwMDB9" // {"tmst":100000000}
+			phy := lorawan.PHYPayload{
+				MHDR:       lorawan.MHDR{MType: lorawan.UnconfirmedDataDown, Major: lorawan.LoRaWAN1_0},
+				MACPayload: []byte{0xda, 0x1b, 0x01, 0x26, 0x00, 0x03, 0x00},
+			}
+			p.scheduleDownlink(testGatewayID, testDevAddr, phy, rxInfo, time.Second)
+			session := &models.DeviceSession{DevEUI: models.EUI64(testDevEUI)}
+			p.recordLastDownlink(session, testGatewayID, nil, 3, false, "")
+
+			if rx1 := nextTX(t, txs); rx1 == nil || rx1.Timing == nil || rx1.Timing.Delay != "1000ms" {
+				t.Fatalf("RX1 downlink = %+v", rx1)
+			}
+
+			retries := 0
+			for _, txError := range tt.acks {
+				p.handleGatewayTxAck(&nats.Msg{
+					Subject: "gateway." + testGatewayID + ".txack",
+					Data:    []byte(`{"token":1,"ack":{"txpk_ack":{"error":"` + txError + `"}}}`),
+				})
+
+				msg, err := txs.NextMsg(100 * time.Millisecond)
+				if err != nil {
+					continue
+				}
+				retries++
+				var tx models.GatewayTXMessage
+				if err := json.Unmarshal(msg.Data, &tx); err != nil {
+					t.Fatal(err)
+				}
+				if tx.TXPK.Freq != 505.3 || tx.Timing == nil || tx.Timing.Delay != "2000ms" {
+					t.Errorf("retry = %.1f MHz, timing %+v, want RX2 505.3 MHz after 2000ms", tx.TXPK.Freq, tx.Timing)
+				}
+			}
+			if (retries == 1) != tt.wantRetry || retries > 1 {
+				t.Errorf("%d RX2 retries, want retry %v", retries, tt.wantRetry)
+			}
+
+			device, _ := store.GetDevice(context.Background(), testDevEUI)
+			last := device.LastDownlink
+			if last.TxError != tt.wantTxError {
+				t.Errorf("TxError = %q, want %q", last.TxError, tt.wantTxError)
+			}
+			if wantAcked := tt.wantTxError == "" && len(tt.acks) > 1; last.TxAcked != wantAcked {
+				t.Errorf("TxAcked = %v, want %v", last.TxAcked, wantAcked)
+			}
+			if got := p.gpsTime.Locked(testGatewayID); got != tt.wantGPS {
+				t.Errorf("gateway GPS locked = %v, want %v", got, tt.wantGPS)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// uplinkRateWindow 上行限速窗口
+const uplinkRateWindow = time.Minute
+
+// uplinkRateLimiter 按设备的固定窗口上行限速
+type uplinkRateLimiter struct {
+	mu      sync.Mutex
+	windows map[lorawan.EUI64]*uplinkWindow
+
+	throttled uint64 // 累计丢弃的上行数
+}
+
+type uplinkWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+func newUplinkRateLimiter() *uplinkRateLimiter {
+	return &uplinkRateLimiter{windows: make(map[lorawan.EUI64]*uplinkWindow)}
+}
+
+// Allow 判断设备本窗口内是否还能上行，limit <= 0 不限制。
+// 被拒绝时返回本窗口已丢弃的数量（含本次）。
+func (l *uplinkRateLimiter) Allow(devEUI lorawan.EUI64, limit int) (allowed bool, dropped int) {
+	if limit <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[devEUI]
+	if !ok || now.Sub(w.start) >= uplinkRateWindow {
+		// 持锁时顺便清理过期设备
+		for k, old := range l.windows {
+			if now.Sub(old.start) >= uplinkRateWindow {
+				delete(l.windows, k)
+			}
+		}
+		w = &uplinkWindow{start: now}
+		l.windows[devEUI] = w
+	}
+
+	if w.count < limit {
+		w.count++
+		return true, 0
+	}
+
+	w.dropped++
+	atomic.AddUint64(&l.throttled, 1)
+	return false, w.dropped
+}
+
+// Throttled 返回累计丢弃的上行数
+func (l *uplinkRateLimiter) Throttled() uint64 {
+	return atomic.LoadUint64(&l.throttled)
+}
+
+// maxUplinkRate 返回设备每分钟允许的上行数：设备配置文件优先，否则使用全局配置
+func (p *Processor) maxUplinkRate(ctx context.Context, devEUI lorawan.EUI64) int {
+	if profile := p.deviceProfile(ctx, devEUI); profile != nil && profile.MaxUplinkRate > 0 {
+		return profile.MaxUplinkRate
+	}
+	return p.config.Network.MaxUplinksPerMinute
+}
+
+// throttleUplink 设备超过上行速率时返回 true，上行应被丢弃；
+// 每个窗口第一次丢弃时写入事件日志
+func (p *Processor) throttleUplink(ctx context.Context, devEUI lorawan.EUI64, fCnt uint32) bool {
+	limit := p.maxUplinkRate(ctx, devEUI)
+	allowed, dropped := p.uplinkLimiter.Allow(devEUI, limit)
+	if allowed {
+		return false
+	}
+
+	log.Warn().
+		Str("devEUI", devEUI.String()).
+		Uint32("fCnt", fCnt).
+		Int("limit", limit).
+		Int("dropped", dropped).
+		Msg("设备上行超过速率限制，已丢弃")
+
+	if dropped == 1 {
+		eui := models.EUI64(devEUI)
+		event := &models.EventLog{
+			DevEUI:      &eui,
+			Type:        models.EventTypeUplink,
+			Level:       models.EventLevelWarning,
+			Code:        "UPLINK_THROTTLED",
+			Description: fmt.Sprintf("Device exceeded %d uplinks per minute, excess uplinks dropped", limit),
+			Details: models.Variables{
+				"limit": limit,
+				"fCnt":  fCnt,
+			},
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := p.store.CreateEventLog(ctx, event); err != nil {
+				log.Error().Err(err).Str("devEUI", devEUI.String()).Msg("记录上行限速事件失败")
+			}
+		}()
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+func TestUplinkRateLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		uplinks     int
+		wantAllowed int
+	}{
+		{"unlimited", 0, 10, 10},
+		{"under limit", 5, 3, 3},
+		{"at limit", 3, 3, 3},
+		{"over limit", 3, 7, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newUplinkRateLimiter()
+
+			allowed := 0
+			for i := 0; i < tt.uplinks; i++ {
+				ok, dropped := l.Allow(testDevEUI, tt.limit)
+				if ok {
+					allowed++
+				} else if dropped != i+1-allowed {
+					t.Errorf("uplink %d: dropped = %d, want %d", i, dropped, i+1-allowed)
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("allowed %d uplinks, want %d", allowed, tt.wantAllowed)
+			}
+			if got := l.Throttled(); got != uint64(tt.uplinks-tt.wantAllowed) {
+				t.Errorf("Throttled() = %d, want %d", got, tt.uplinks-tt.wantAllowed)
+			}
+
+			// 其他设备单独计数
+			if ok, _ := l.Allow(lorawan.EUI64{1}, tt.limit); !ok {
+				t.Error("other device throttled")
+			}
+		})
+	}
+}
+
+func TestUplinkRateLimiterWindow(t *testing.T) {
+	l := newUplinkRateLimiter()
+	l.Allow(testDevEUI, 1)
+	if ok, _ := l.Allow(testDevEUI, 1); ok {
+		t.Fatal("second uplink in the window allowed")
+	}
+
+	// 窗口结束后重新计数
+	l.windows[testDevEUI].start = time.Now().Add(-uplinkRateWindow)
+	if ok, _ := l.Allow(testDevEUI, 1); !ok {
+		t.Error("uplink after the window throttled")
+	}
+	if ok, dropped := l.Allow(testDevEUI, 1); ok || dropped != 1 {
+		t.Errorf("Allow() in the new window = %v, %d, want throttled with 1 dropped", ok, dropped)
+	}
+}
+
+func TestUplinkThrottled(t *testing.T) {
+	fPort := uint8(1)
+
+	tests := []struct {
+		name         string
+		globalLimit  int
+		profileLimit int
+		wantAccepted int
+		wantEvents   int
+	}{
+		{"unlimited", 0, 0, 5, 0},
+		{"global limit", 2, 0, 2, 1},
+		{"profile overrides global", 2, 4, 4, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Network.MaxUplinksPerMinute = tt.globalLimit
+			p, store, srv := newTestProcessor(t, cfg)
+			ctx := context.Background()
+
+			profile := &models.DeviceProfile{Name: "profile", MaxUplinkRate: tt.profileLimit}
+			store.CreateDeviceProfile(ctx, profile)
+			device := createTestDevice(t, store, testDevEUI)
+			device.DeviceProfileID = profile.ID
+			store.UpdateDevice(ctx, device)
+			saveTestSession(t, store, testDevEUI, "")
+			sub := subscribeSync(t, srv, "application.*.device.*.rx")
+
+			for fCnt := uint32(1); fCnt <= 5; fCnt++ {
+				p.handleDataUp(newTestUplink(t, lorawan.UnconfirmedDataUp, fCnt, &fPort, []byte{1}), testGatewayID, testRxInfo())
+			}
+
+			accepted := 0
+			for {
+				if _, err := sub.NextMsg(200 * time.Millisecond); err != nil {
+					break
+				}
+				accepted++
+			}
+			if accepted != tt.wantAccepted {
+				t.Errorf("forwarded %d uplinks, want %d", accepted, tt.wantAccepted)
+			}
+
+			// 被丢弃的上行不推进 FCntUp
+			session, _ := store.GetDeviceSession(ctx, testDevEUI)
+			if session.FCntUp != uint32(tt.wantAccepted) {
+				t.Errorf("FCntUp = %d, want %d", session.FCntUp, tt.wantAccepted)
+			}
+
+			// 每个窗口只记录一次事件
+			var throttled int
+			deadline := time.Now().Add(time.Second)
+			for {
+				events, _, _ := store.ListEventLogs(ctx, storage.EventLogFilters{}, 100, 0)
+				throttled = 0
+				for _, e := range events {
+					if e.Code == "UPLINK_THROTTLED" {
+						throttled++
+					}
+				}
+				if throttled > 0 || tt.wantEvents == 0 || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if throttled != tt.wantEvents {
+				t.Errorf("%d UPLINK_THROTTLED events, want %d", throttled, tt.wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// Downlink events persisted per device per window; a misbehaving device
+// retrying in a loop must not flood event_logs
+const (
+	downlinkEventLimit  = 30
+	downlinkEventWindow = time.Minute
+)
+
+// eventRateLimiter is a fixed-window per-key rate limiter
+type eventRateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+func newEventRateLimiter(limit int, window time.Duration) *eventRateLimiter {
+	return &eventRateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// Allow reports whether another event for key fits in the current window.
+// When a new window starts, the number of events dropped in the previous one is returned.
+func (l *eventRateLimiter) Allow(key string) (allowed bool, dropped int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		if ok {
+			dropped = w.dropped
+		}
+		// Drop stale keys while we hold the lock
+		for k, old := range l.windows {
+			if now.Sub(old.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		w.dropped++
+		return false, dropped
+	}
+	w.count++
+	return true, dropped
+}
+
+// handleDownlinkEvent persists downlink lifecycle events into event_logs
+func (s *NATSSubscriber) handleDownlinkEvent(msg *nats.Msg) {
+	var event models.DownlinkEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		log.Error().Err(err).Msg("Failed to unmarshal downlink event")
+		return
+	}
+
+	allowed, dropped := s.downlinkLimiter.Allow(event.DevEUI)
+	if dropped > 0 {
+		log.Warn().
+			Str("devEUI", event.DevEUI).
+			Int("dropped", dropped).
+			Msg("Downlink events dropped by rate limit")
+	}
+	if !allowed {
+		return
+	}
+
+	devEUI, err := hex.DecodeString(event.DevEUI)
+	if err != nil || len(devEUI) != 8 {
+		log.Error().Str("devEUI", event.DevEUI).Msg("Invalid DevEUI in downlink event")
+		return
+	}
+
+	s.saveDownlinkEvent(context.Background(), (*models.EUI64)(devEUI), event)
+}
+
+// saveDownlinkEvent writes a downlink lifecycle event log entry
+func (s *NATSSubscriber) saveDownlinkEvent(ctx context.Context, devEUI *models.EUI64, event models.DownlinkEvent) {
+	level := models.EventLevelInfo
+	stage := strings.ToLower(strings.TrimPrefix(string(event.Type), "DOWNLINK_"))
+	description := fmt.Sprintf("Downlink %s - FCnt: %d", stage, event.FCnt)
+	if event.Type == models.EventTypeDownlinkQueued {
+		description = "Downlink queued"
+	} else if event.Type == models.EventTypeDownlinkFailed {
+		level = models.EventLevelWarning
+		description = fmt.Sprintf("Downlink failed: %s", event.Error)
+	} else if event.Type == models.EventTypeDownlinkExpired {
+		level = models.EventLevelWarning
+		description = fmt.Sprintf("Downlink expired: %s", event.Error)
+	}
+
+	details := models.Variables{
+		"fCnt": event.FCnt,
+		"time": event.Time,
+	}
+	if event.ID != "" {
+		details["id"] = event.ID
+	}
+	if event.GatewayID != "" {
+		details["gatewayID"] = event.GatewayID
+	}
+	if event.Error != "" {
+		details["error"] = event.Error
+	}
+
+	entry := &models.EventLog{
+		DevEUI:      devEUI,
+		Type:        event.Type,
+		Level:       level,
+		Description: description,
+		Details:     details,
+	}
+	if err := s.store.CreateEventLog(ctx, entry); err != nil {
+		log.Error().Err(err).Msg("Failed to create downlink event log")
+	}
+}
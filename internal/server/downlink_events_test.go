@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage/storagetest"
+)
+
+const testDevEUI = "70b3d57ed0000001"
+
+// downlinkEventMsg encodes a lifecycle event as published by the network server
+func downlinkEventMsg(typ models.EventType, fCnt uint32, reason string) *nats.Msg {
+	data, _ := json.Marshal(models.DownlinkEvent{
+		Type:      typ,
+		DevEUI:    testDevEUI,
+		ID:        "frame-1",
+		FCnt:      fCnt,
+		GatewayID: "0102030405060708",
+		Error:     reason,
+		Time:      time.Now(),
+	})
+	return &nats.Msg{Subject: "downlink." + testDevEUI + ".x", Data: data}
+}
+
+// storedEvents returns the stored event logs in the order they were written
+func storedEvents(t *testing.T, store *storagetest.MemoryStore) []*models.EventLog {
+	t.Helper()
+
+	events, _, err := store.ListEventLogs(context.Background(), storage.EventLogFilters{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events
+}
+
+func TestDownlinkLifecycleEventLogs(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*nats.Msg
+		want   []models.EventType
+		levels []models.EventLevel
+	}{
+		{
+			"delivered",
+			[]*nats.Msg{
+				downlinkEventMsg(models.EventTypeDownlinkScheduled, 4, ""),
+				downlinkEventMsg(models.EventTypeDownlinkTx, 4, ""),
+				downlinkEventMsg(models.EventTypeDownlinkAck, 4, ""),
+			},
+			[]models.EventType{models.EventTypeDownlinkScheduled, models.EventTypeDownlinkTx, models.EventTypeDownlinkAck},
+			[]models.EventLevel{models.EventLevelInfo, models.EventLevelInfo, models.EventLevelInfo},
+		},
+		{
+			"rejected by gateway",
+			[]*nats.Msg{
+				downlinkEventMsg(models.EventTypeDownlinkScheduled, 4, ""),
+				downlinkEventMsg(models.EventTypeDownlinkFailed, 4, "TOO_LATE"),
+			},
+			[]models.EventType{models.EventTypeDownlinkScheduled, models.EventTypeDownlinkFailed},
+			[]models.EventLevel{models.EventLevelInfo, models.EventLevelWarning},
+		},
+		{
+			"invalid DevEUI",
+			[]*nats.Msg{{Subject: "downlink.x.x", Data: []byte(`{"type":"DOWNLINK_TX","devEUI":"zz"}`)}},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storagetest.New()
+			s := NewNATSSubscriber(nil, store)
+
+			for _, msg := range tt.events {
+				s.handleDownlinkEvent(msg)
+			}
+
+			events := storedEvents(t, store)
+			if len(events) != len(tt.want) {
+				t.Fatalf("%d events stored, want %d", len(events), len(tt.want))
+			}
+			for i, e := range events {
+				if e.Type != tt.want[i] || e.Level != tt.levels[i] {
+					t.Errorf("event %d = %s/%s, want %s/%s", i, e.Type, e.Level, tt.want[i], tt.levels[i])
+				}
+				if e.DevEUI == nil || e.DevEUI.String() != testDevEUI || e.Details["id"] != "frame-1" {
+					t.Errorf("event %d = %+v, want frame-1 of %s", i, e, testDevEUI)
+				}
+			}
+		})
+	}
+}
+
+func TestDownlinkEventsRateLimited(t *testing.T) {
+	store := storagetest.New()
+	s := NewNATSSubscriber(nil, store)
+
+	for i := 0; i < downlinkEventLimit+5; i++ {
+		s.handleDownlinkEvent(downlinkEventMsg(models.EventTypeDownlinkFailed, uint32(i), "TOO_LATE"))
+	}
+	if n := len(storedEvents(t, store)); n != downlinkEventLimit {
+		t.Errorf("%d events stored, want %d", n, downlinkEventLimit)
+	}
+}
+
+func TestEventRateLimiter(t *testing.T) {
+	l := newEventRateLimiter(2, 20*time.Millisecond)
+
+	for i, want := range []bool{true, true, false, false} {
+		if allowed, _ := l.Allow("a"); allowed != want {
+			t.Errorf("call %d: allowed = %v, want %v", i, allowed, want)
+		}
+	}
+	if allowed, _ := l.Allow("b"); !allowed {
+		t.Error("limit shared across keys")
+	}
+
+	// a new window reports what the previous one dropped
+	time.Sleep(25 * time.Millisecond)
+	if allowed, dropped := l.Allow("a"); !allowed || dropped != 2 {
+		t.Errorf("new window: allowed = %v, dropped = %d, want true, 2", allowed, dropped)
+	}
+}
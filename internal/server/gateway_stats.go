@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// Gateway stats older than this are pruned hourly
+const (
+	gatewayStatsRetention     = 7 * 24 * time.Hour
+	gatewayStatsPruneInterval = time.Hour
+)
+
+// handleGatewayStat persists the counters and location from a gateway stat frame
+// published by the gateway bridge
+func (s *NATSSubscriber) handleGatewayStat(msg *nats.Msg) {
+	var statMsg struct {
+		GatewayID string `json:"gatewayID"`
+		Parsed    struct {
+			Lati *float64 `json:"lati"`
+			Long *float64 `json:"long"`
+			RXNb uint64   `json:"rxnb"`
+			RXOK uint64   `json:"rxok"`
+			TXNb uint64   `json:"txnb"`
+		} `json:"parsed"`
+		Timestamp int64 `json:"timestamp"`
+	}
+	if err := json.Unmarshal(msg.Data, &statMsg); err != nil {
+		log.Error().Err(err).Str("subject", msg.Subject).Msg("Failed to unmarshal gateway stat")
+		return
+	}
+
+	gatewayID, err := lorawan.ParseGatewayID(statMsg.GatewayID)
+	if err != nil {
+		log.Warn().Err(err).Str("gatewayID", statMsg.GatewayID).Msg("Invalid gateway ID in stat")
+		return
+	}
+
+	stats := &models.GatewayStats{
+		GatewayID:         models.EUI64(gatewayID),
+		Time:              time.Now(),
+		RXPacketsReceived: int(statMsg.Parsed.RXNb),
+		RXPacketsValid:    int(statMsg.Parsed.RXOK),
+		TXPacketsEmitted:  int(statMsg.Parsed.TXNb),
+		Latitude:          statMsg.Parsed.Lati,
+		Longitude:         statMsg.Parsed.Long,
+	}
+	if statMsg.Timestamp > 0 {
+		stats.Time = time.Unix(statMsg.Timestamp, 0)
+	}
+
+	if err := s.store.SaveGatewayStats(context.Background(), stats); err != nil {
+		log.Error().Err(err).Str("gatewayID", statMsg.GatewayID).Msg("Failed to save gateway stats")
+	}
+}
+
+// pruneGatewayStats deletes gateway stats older than the retention period until ctx is done
+func (s *NATSSubscriber) pruneGatewayStats(ctx context.Context) {
+	ticker := time.NewTicker(gatewayStatsPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.store.DeleteGatewayStatsBefore(ctx, time.Now().Add(-gatewayStatsRetention))
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to prune gateway stats")
+			} else if deleted > 0 {
+				log.Debug().Int64("deleted", deleted).Msg("Pruned gateway stats")
+			}
+		}
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 
+	"github.com/lorawan-server/lorawan-server-pro/internal/codec"
+	"github.com/lorawan-server/lorawan-server-pro/internal/logging"
 	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/network"
 	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
 	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
@@ -21,6 +24,8 @@ type NATSSubscriber struct {
 	nc    *nats.Conn
 	store storage.Store
 	subs  []*nats.Subscription
+
+	downlinkLimiter *eventRateLimiter
 }
 
 // NewNATSSubscriber creates NATS subscriber
@@ -29,6 +34,8 @@ func NewNATSSubscriber(nc *nats.Conn, store storage.Store) *NATSSubscriber {
 		nc:    nc,
 		store: store,
 		subs:  make([]*nats.Subscription, 0),
+
+		downlinkLimiter: newEventRateLimiter(downlinkEventLimit, downlinkEventWindow),
 	}
 }
 
@@ -62,6 +69,21 @@ func (s *NATSSubscriber) Start(ctx context.Context) error {
 	}
 	s.subs = append(s.subs, sub4)
 
+	// Subscribe to downlink lifecycle events (scheduled, tx, ack, failed)
+	sub5, err := s.nc.Subscribe("downlink.*.*", s.handleDownlinkEvent)
+	if err != nil {
+		return fmt.Errorf("subscribe downlink events: %w", err)
+	}
+	s.subs = append(s.subs, sub5)
+
+	// Subscribe to gateway stats from the gateway bridge
+	sub6, err := s.nc.Subscribe("gateway.*.stat", s.handleGatewayStat)
+	if err != nil {
+		return fmt.Errorf("subscribe gateway stats: %w", err)
+	}
+	s.subs = append(s.subs, sub6)
+	go s.pruneGatewayStats(ctx)
+
 	log.Info().
 		Int("subscriptions", len(s.subs)).
 		Msg("NATS subscriber started")
@@ -90,9 +112,11 @@ func (s *NATSSubscriber) handleApplicationUplink(msg *nats.Msg) {
 		FCnt          uint32                   `json:"fCnt"`
 		FPort         uint8                    `json:"fPort"`
 		Data          []byte                   `json:"data"`
+		Empty         bool                     `json:"empty"`
 		Object        interface{}              `json:"object,omitempty"`
 		RXInfo        []map[string]interface{} `json:"rxInfo"`
 		TXInfo        map[string]interface{}   `json:"txInfo"`
+		TraceID       string                   `json:"traceID"`
 	}
 
 	if err := json.Unmarshal(msg.Data, &uplinkMsg); err != nil {
@@ -101,7 +125,7 @@ func (s *NATSSubscriber) handleApplicationUplink(msg *nats.Msg) {
 	}
 
 	// Log event
-	ctx := context.Background()
+	ctx := logging.WithTraceID(context.Background(), uplinkMsg.TraceID)
 
 	appID, _ := uuid.Parse(uplinkMsg.ApplicationID)
 	devEUI, _ := hex.DecodeString(uplinkMsg.DevEUI)
@@ -116,14 +140,18 @@ func (s *NATSSubscriber) handleApplicationUplink(msg *nats.Msg) {
 			"fCnt":     uplinkMsg.FCnt,
 			"fPort":    uplinkMsg.FPort,
 			"dataSize": len(uplinkMsg.Data),
+			"empty":    uplinkMsg.Empty,
 		},
 	}
+	if uplinkMsg.TraceID != "" {
+		event.Details[logging.TraceIDField] = uplinkMsg.TraceID
+	}
 
 	if err := s.store.CreateEventLog(ctx, event); err != nil {
-		log.Error().Err(err).Msg("Failed to create event log")
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed to create event log")
 	}
 
-	log.Info().
+	logging.Ctx(ctx).Info().
 		Str("devEUI", uplinkMsg.DevEUI).
 		Uint32("fCnt", uplinkMsg.FCnt).
 		Uint8("fPort", uplinkMsg.FPort).
@@ -286,6 +314,11 @@ func (s *NATSSubscriber) handleApplicationDownlink(msg *nats.Msg) {
 		Data      []byte `json:"data"`
 		Confirmed bool   `json:"confirmed"`
 		Reference string `json:"reference"`
+
+		// 由应用的 PayloadCodec 编码，data 为空时使用
+		Object map[string]interface{} `json:"object,omitempty"`
+
+		Override *network.DownlinkOverride `json:"override,omitempty"`
 	}
 
 	if err := json.Unmarshal(msg.Data, &downReq); err != nil {
@@ -293,6 +326,14 @@ func (s *NATSSubscriber) handleApplicationDownlink(msg *nats.Msg) {
 		return
 	}
 
+	if !lorawan.ValidApplicationFPort(downReq.FPort) {
+		log.Error().
+			Str("devEUI", downReq.DevEUI).
+			Uint8("fPort", downReq.FPort).
+			Msg("Rejected downlink: fPort must be between 1 and 223")
+		return
+	}
+
 	// Forward to network server
 	ctx := context.Background()
 	devEUI, err := hex.DecodeString(downReq.DevEUI)
@@ -308,6 +349,19 @@ func (s *NATSSubscriber) handleApplicationDownlink(msg *nats.Msg) {
 		return
 	}
 
+	if len(downReq.Data) == 0 && downReq.Object != nil {
+		app, err := s.store.GetApplication(ctx, device.ApplicationID)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get application")
+			return
+		}
+		downReq.Data, err = codec.EncodeObject(app.PayloadCodec, app.PayloadEncoder, downReq.FPort, downReq.Object)
+		if err != nil {
+			log.Error().Err(err).Str("devEUI", downReq.DevEUI).Msg("Failed to encode downlink object")
+			return
+		}
+	}
+
 	// Create downlink frame record
 	frame := &models.DownlinkFrame{
 		DevEUI:        device.DevEUI,
@@ -323,6 +377,13 @@ func (s *NATSSubscriber) handleApplicationDownlink(msg *nats.Msg) {
 		return
 	}
 
+	s.saveDownlinkEvent(ctx, &device.DevEUI, models.DownlinkEvent{
+		Type:   models.EventTypeDownlinkQueued,
+		DevEUI: downReq.DevEUI,
+		ID:     frame.ID.String(),
+		Time:   time.Now(),
+	})
+
 	// Publish to network server
 	nsMsg := map[string]interface{}{
 		"devEUI":    downReq.DevEUI,
@@ -331,6 +392,9 @@ func (s *NATSSubscriber) handleApplicationDownlink(msg *nats.Msg) {
 		"confirmed": downReq.Confirmed,
 		"id":        frame.ID.String(),
 	}
+	if !downReq.Override.Empty() {
+		nsMsg["override"] = downReq.Override
+	}
 
 	data, _ := json.Marshal(nsMsg)
 	subject := fmt.Sprintf("ns.device.%s.tx", downReq.DevEUI)
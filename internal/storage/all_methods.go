@@ -8,6 +8,7 @@ import (
     "time"
     
     "github.com/google/uuid"
+    "github.com/lib/pq"
     "github.com/lorawan-server/lorawan-server-pro/internal/models"
     "github.com/lorawan-server/lorawan-server-pro/pkg/crypto"
 )
@@ -222,16 +223,16 @@ func (s *PostgresStore) CreateTenant(ctx context.Context, tenant *models.Tenant)
         INSERT INTO tenants (
             id, created_at, updated_at, name, description, max_gateway_count,
             max_device_count, max_user_count, can_have_gateways, private_gateways,
-            billing_email, billing_plan, is_active
+            billing_email, billing_plan, is_active, allowed_regions
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
         )`
     
     _, err := s.getDB().ExecContext(ctx, query,
         tenant.ID, tenant.CreatedAt, tenant.UpdatedAt, tenant.Name, tenant.Description,
         tenant.MaxGatewayCount, tenant.MaxDeviceCount, tenant.MaxUserCount,
         tenant.CanHaveGateways, tenant.PrivateGateways, tenant.BillingEmail,
-        tenant.BillingPlan, tenant.IsActive,
+        tenant.BillingPlan, tenant.IsActive, pq.Array(tenant.AllowedRegions),
     )
     
     if err != nil {
@@ -249,7 +250,7 @@ func (s *PostgresStore) GetTenant(ctx context.Context, id uuid.UUID) (*models.Te
     query := `
         SELECT id, created_at, updated_at, name, description, max_gateway_count,
                max_device_count, max_user_count, can_have_gateways, private_gateways,
-               billing_email, billing_plan, is_active, suspended_at
+               billing_email, billing_plan, is_active, suspended_at, allowed_regions
         FROM tenants
         WHERE id = $1`
     
@@ -259,6 +260,7 @@ func (s *PostgresStore) GetTenant(ctx context.Context, id uuid.UUID) (*models.Te
         &tenant.MaxGatewayCount, &tenant.MaxDeviceCount, &tenant.MaxUserCount,
         &tenant.CanHaveGateways, &tenant.PrivateGateways, &tenant.BillingEmail,
         &tenant.BillingPlan, &tenant.IsActive, &tenant.SuspendedAt,
+        pq.Array(&tenant.AllowedRegions),
     )
     
     if err == sql.ErrNoRows {
@@ -277,7 +279,7 @@ func (s *PostgresStore) UpdateTenant(ctx context.Context, tenant *models.Tenant)
             updated_at = $2, name = $3, description = $4, max_gateway_count = $5,
             max_device_count = $6, max_user_count = $7, can_have_gateways = $8,
             private_gateways = $9, billing_email = $10, billing_plan = $11,
-            is_active = $12, suspended_at = $13
+            is_active = $12, suspended_at = $13, allowed_regions = $14
         WHERE id = $1`
     
     result, err := s.getDB().ExecContext(ctx, query,
@@ -285,6 +287,7 @@ func (s *PostgresStore) UpdateTenant(ctx context.Context, tenant *models.Tenant)
         tenant.MaxGatewayCount, tenant.MaxDeviceCount, tenant.MaxUserCount,
         tenant.CanHaveGateways, tenant.PrivateGateways, tenant.BillingEmail,
         tenant.BillingPlan, tenant.IsActive, tenant.SuspendedAt,
+        pq.Array(tenant.AllowedRegions),
     )
     
     if err != nil {
@@ -378,15 +381,17 @@ func (s *PostgresStore) CreateApplication(ctx context.Context, app *models.Appli
         INSERT INTO applications (
             id, created_at, updated_at, tenant_id, name, description,
             http_integration, mqtt_integration, payload_codec,
-            payload_decoder, payload_encoder
+            payload_decoder, payload_encoder, confirmed_timeout,
+            forward_phy_payload, forward_fields
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
         )`
     
     _, err := s.getDB().ExecContext(ctx, query,
         app.ID, app.CreatedAt, app.UpdatedAt, app.TenantID, app.Name,
         app.Description, app.HTTPIntegration, app.MQTTIntegration,
         app.PayloadCodec, app.PayloadDecoder, app.PayloadEncoder,
+        app.ConfirmedTimeout, app.ForwardPHYPayload, app.ForwardFields,
     )
     
     if err != nil {
@@ -404,22 +409,36 @@ func (s *PostgresStore) GetApplication(ctx context.Context, id uuid.UUID) (*mode
     query := `
         SELECT id, created_at, updated_at, tenant_id, name, description,
                http_integration, mqtt_integration, payload_codec,
-               payload_decoder, payload_encoder
+               payload_decoder, payload_encoder, confirmed_timeout,
+               forward_phy_payload, forward_fields
         FROM applications
         WHERE id = $1`
     
     app := &models.Application{}
+    var forwardFields []byte
     err := s.getDB().QueryRowContext(ctx, query, id).Scan(
         &app.ID, &app.CreatedAt, &app.UpdatedAt, &app.TenantID, &app.Name,
         &app.Description, &app.HTTPIntegration, &app.MQTTIntegration,
         &app.PayloadCodec, &app.PayloadDecoder, &app.PayloadEncoder,
+        &app.ConfirmedTimeout, &app.ForwardPHYPayload, &forwardFields,
     )
     
     if err == sql.ErrNoRows {
         return nil, ErrNotFound
     }
     
-    return app, err
+    if err != nil {
+        return nil, err
+    }
+    
+    if forwardFields != nil {
+        app.ForwardFields = &models.ForwardFieldFilter{}
+        if err := app.ForwardFields.Scan(forwardFields); err != nil {
+            return nil, err
+        }
+    }
+    
+    return app, nil
 }
 
 // UpdateApplication updates an application
@@ -430,13 +449,16 @@ func (s *PostgresStore) UpdateApplication(ctx context.Context, app *models.Appli
         UPDATE applications SET
             updated_at = $2, name = $3, description = $4,
             http_integration = $5, mqtt_integration = $6,
-            payload_codec = $7, payload_decoder = $8, payload_encoder = $9
+            payload_codec = $7, payload_decoder = $8, payload_encoder = $9,
+            confirmed_timeout = $10, forward_phy_payload = $11,
+            forward_fields = $12
         WHERE id = $1`
     
     result, err := s.getDB().ExecContext(ctx, query,
         app.ID, app.UpdatedAt, app.Name, app.Description,
         app.HTTPIntegration, app.MQTTIntegration,
         app.PayloadCodec, app.PayloadDecoder, app.PayloadEncoder,
+        app.ConfirmedTimeout, app.ForwardPHYPayload, app.ForwardFields,
     )
     
     if err != nil {
@@ -515,15 +537,12 @@ func (s *PostgresStore) ListApplications(ctx context.Context, tenantID uuid.UUID
     return apps, count, nil
 }
 
-// [继续实现其他方法...]
-// 由于篇幅限制，这里只展示了部分方法的实现
-// 完整实现应包括所有 Store 接口中定义的方法
-
-// TODO: 实现以下方法组：
-// - Device methods (CreateDevice, GetDevice, etc.)
-// - Gateway methods (CreateGateway, GetGateway, etc.)
-// - DeviceProfile methods
-// - Frame methods
-// - EventLog methods
-// - DeviceKeys methods
-// - DeviceSession methods
+// 其余 Store 方法按实体分文件实现：
+// - Device / DeviceKeys methods: device_methods.go
+// - DeviceSession methods: device_session_methods.go
+// - Used DevNonce methods: dev_nonce_methods.go
+// - DeviceProfile methods: device_profile_methods.go
+// - Gateway methods: gateway_methods.go, gateway_stats_methods.go
+// - Frame methods: frame_methods.go, frame_log_methods.go
+// - EventLog methods: event_methods.go
+// - MulticastGroup methods: multicast_methods.go
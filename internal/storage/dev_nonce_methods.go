@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// ========== Used DevNonce Methods ==========
+
+// RecordDevNonce records a DevNonce the device has joined with. It reports
+// false when the nonce was already recorded for (JoinEUI, DevEUI).
+func (s *PostgresStore) RecordDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (bool, error) {
+	result, err := s.getDB().ExecContext(ctx, `
+		INSERT INTO used_dev_nonces (join_eui, dev_eui, dev_nonce, created_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT DO NOTHING`,
+		joinEUI[:], devEUI[:], int(devNonce),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DevNonceUsed reports whether the device has already joined with devNonce
+func (s *PostgresStore) DevNonceUsed(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (bool, error) {
+	var used bool
+	err := s.getDB().QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM used_dev_nonces
+			WHERE join_eui = $1 AND dev_eui = $2 AND dev_nonce = $3
+		)`,
+		joinEUI[:], devEUI[:], int(devNonce),
+	).Scan(&used)
+	return used, err
+}
+
+// LastDevNonce returns the highest DevNonce recorded for the device, with
+// ErrNotFound when it has never joined
+func (s *PostgresStore) LastDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64) (uint16, error) {
+	var devNonce sql.NullInt64
+	err := s.getDB().QueryRowContext(ctx,
+		"SELECT MAX(dev_nonce) FROM used_dev_nonces WHERE join_eui = $1 AND dev_eui = $2",
+		joinEUI[:], devEUI[:],
+	).Scan(&devNonce)
+	if err != nil {
+		return 0, err
+	}
+	if !devNonce.Valid {
+		return 0, ErrNotFound
+	}
+	return uint16(devNonce.Int64), nil
+}
+
+// ForEachDevNonce calls fn for every recorded DevNonce
+func (s *PostgresStore) ForEachDevNonce(ctx context.Context, fn func(joinEUI, devEUI lorawan.EUI64, devNonce uint16)) error {
+	rows, err := s.getDB().QueryContext(ctx, "SELECT join_eui, dev_eui, dev_nonce FROM used_dev_nonces")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var joinEUI, devEUI []byte
+		var devNonce int
+		if err := rows.Scan(&joinEUI, &devEUI, &devNonce); err != nil {
+			return err
+		}
+
+		var j, d lorawan.EUI64
+		copy(j[:], joinEUI)
+		copy(d[:], devEUI)
+		fn(j, d, uint16(devNonce))
+	}
+
+	return rows.Err()
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"strings"
 	"time"
 
@@ -28,9 +29,9 @@ func (s *PostgresStore) CreateDevice(ctx context.Context, device *models.Device)
             dev_eui, created_at, updated_at, tenant_id, join_eui, dev_addr,
             name, description, application_id, device_profile_id, is_disabled,
             app_s_key, nwk_s_enc_key, s_nwk_s_int_key, f_nwk_s_int_key,
-            f_cnt_up, n_f_cnt_down, a_f_cnt_down, dr
+            f_cnt_up, n_f_cnt_down, a_f_cnt_down, dr, forward_disabled
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20
         )`
 
 	_, err := s.getDB().ExecContext(ctx, query,
@@ -38,7 +39,7 @@ func (s *PostgresStore) CreateDevice(ctx context.Context, device *models.Device)
 		device.JoinEUI, device.DevAddr, device.Name, device.Description,
 		device.ApplicationID, device.DeviceProfileID, device.IsDisabled,
 		device.AppSKey, device.NwkSEncKey, device.SNwkSIntKey, device.FNwkSIntKey,
-		device.FCntUp, device.NFCntDown, device.AFCntDown, device.DR,
+		device.FCntUp, device.NFCntDown, device.AFCntDown, device.DR, device.ForwardDisabled,
 	)
 
 	if err != nil {
@@ -58,12 +59,13 @@ func (s *PostgresStore) GetDevice(ctx context.Context, devEUI lorawan.EUI64) (*m
                name, description, application_id, device_profile_id, is_disabled,
                last_seen_at, battery_level, battery_level_updated_at,
                app_s_key, nwk_s_enc_key, s_nwk_s_int_key, f_nwk_s_int_key,
-               f_cnt_up, n_f_cnt_down, a_f_cnt_down, dr
+               f_cnt_up, n_f_cnt_down, a_f_cnt_down, dr, last_downlink, last_error,
+               forward_disabled
         FROM devices
         WHERE dev_eui = $1`
 
 	device := &models.Device{}
-	var devEUIBytes, joinEUIBytes, devAddrBytes []byte
+	var devEUIBytes, joinEUIBytes, devAddrBytes, lastDownlink, lastError []byte
 
 	err := s.getDB().QueryRowContext(ctx, query, devEUI[:]).Scan(
 		&devEUIBytes, &device.CreatedAt, &device.UpdatedAt, &device.TenantID,
@@ -72,6 +74,7 @@ func (s *PostgresStore) GetDevice(ctx context.Context, devEUI lorawan.EUI64) (*m
 		&device.LastSeenAt, &device.BatteryLevel, &device.BatteryLevelUpdatedAt,
 		&device.AppSKey, &device.NwkSEncKey, &device.SNwkSIntKey, &device.FNwkSIntKey,
 		&device.FCntUp, &device.NFCntDown, &device.AFCntDown, &device.DR,
+		&lastDownlink, &lastError, &device.ForwardDisabled,
 	)
 
 	if err == sql.ErrNoRows {
@@ -92,6 +95,18 @@ func (s *PostgresStore) GetDevice(ctx context.Context, devEUI lorawan.EUI64) (*m
 		device.DevAddr = &models.DevAddr{}
 		copy((*device.DevAddr)[:], devAddrBytes)
 	}
+	if lastDownlink != nil {
+		device.LastDownlink = &models.DeviceLastDownlink{}
+		if err := device.LastDownlink.Scan(lastDownlink); err != nil {
+			return nil, err
+		}
+	}
+	if lastError != nil {
+		device.LastError = &models.DeviceLastError{}
+		if err := device.LastError.Scan(lastError); err != nil {
+			return nil, err
+		}
+	}
 
 	return device, nil
 }
@@ -156,7 +171,7 @@ func (s *PostgresStore) UpdateDevice(ctx context.Context, device *models.Device)
             last_seen_at = $6, battery_level = $7, battery_level_updated_at = $8,
             f_cnt_up = $9, n_f_cnt_down = $10, a_f_cnt_down = $11, dr = $12,
             app_s_key = $13, nwk_s_enc_key = $14, s_nwk_s_int_key = $15, f_nwk_s_int_key = $16,
-            dev_addr = $17
+            dev_addr = $17, forward_disabled = $18
         WHERE dev_eui = $1`
 
 	result, err := s.getDB().ExecContext(ctx, query,
@@ -164,7 +179,7 @@ func (s *PostgresStore) UpdateDevice(ctx context.Context, device *models.Device)
 		device.IsDisabled, device.LastSeenAt, device.BatteryLevel,
 		device.BatteryLevelUpdatedAt, device.FCntUp, device.NFCntDown,
 		device.AFCntDown, device.DR, device.AppSKey, device.NwkSEncKey,
-		device.SNwkSIntKey, device.FNwkSIntKey, devAddrBytes,
+		device.SNwkSIntKey, device.FNwkSIntKey, devAddrBytes, device.ForwardDisabled,
 	)
 
 	if err != nil {
@@ -183,6 +198,72 @@ func (s *PostgresStore) UpdateDevice(ctx context.Context, device *models.Device)
 	return nil
 }
 
+// UpdateDeviceLastError records the last uplink processing error of a device
+func (s *PostgresStore) UpdateDeviceLastError(ctx context.Context, devEUI lorawan.EUI64, lastError *models.DeviceLastError) error {
+	result, err := s.getDB().ExecContext(ctx,
+		"UPDATE devices SET last_error = $2 WHERE dev_eui = $1",
+		devEUI[:], lastError,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateDeviceLastDownlink updates the last downlink metadata of a device
+func (s *PostgresStore) UpdateDeviceLastDownlink(ctx context.Context, devEUI lorawan.EUI64, lastDownlink *models.DeviceLastDownlink) error {
+	result, err := s.getDB().ExecContext(ctx,
+		"UPDATE devices SET last_downlink = $2 WHERE dev_eui = $1",
+		devEUI[:], lastDownlink,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// maxJoinNonce JoinNonce is a 24-bit counter
+const maxJoinNonce = 1<<24 - 1
+
+// NextJoinNonce increments and returns the device's JoinNonce. The counter
+// only ever increases, so a JOIN Accept never reuses a JoinNonce.
+func (s *PostgresStore) NextJoinNonce(ctx context.Context, devEUI lorawan.EUI64) (uint32, error) {
+	var nonce uint32
+	err := s.getDB().QueryRowContext(ctx,
+		"UPDATE devices SET join_nonce = join_nonce + 1 WHERE dev_eui = $1 AND join_nonce < $2 RETURNING join_nonce",
+		devEUI[:], maxJoinNonce,
+	).Scan(&nonce)
+	if err != sql.ErrNoRows {
+		return nonce, err
+	}
+
+	// 区分设备不存在和计数器用尽
+	if _, err := s.GetDevice(ctx, devEUI); err != nil {
+		return 0, err
+	}
+	return 0, ErrJoinNonceExhausted
+}
+
 // DeleteDevice deletes a device
 func (s *PostgresStore) DeleteDevice(ctx context.Context, devEUI lorawan.EUI64) error {
 	result, err := s.getDB().ExecContext(ctx, "DELETE FROM devices WHERE dev_eui = $1", devEUI[:])
@@ -202,6 +283,53 @@ func (s *PostgresStore) DeleteDevice(ctx context.Context, devEUI lorawan.EUI64)
 	return nil
 }
 
+// devicePurgeTables lists the tables holding per-device data, dependents before devices
+var devicePurgeTables = []string{
+	"mac_command_queue",
+	"multicast_group_devices",
+	"used_dev_nonces",
+	"adr_history",
+	"device_activations",
+	"event_logs",
+	"downlink_frames",
+	"uplink_frames",
+	"device_sessions",
+	"device_keys",
+	"devices",
+}
+
+// PurgeDevice deletes a device and all of its related data in one transaction,
+// returning the number of rows deleted per table
+func (s *PostgresStore) PurgeDevice(ctx context.Context, devEUI lorawan.EUI64) (map[string]int64, error) {
+	var counts map[string]int64
+	err := s.withTx(ctx, func(store *PostgresStore) error {
+		counts = make(map[string]int64, len(devicePurgeTables))
+		for _, table := range devicePurgeTables {
+			result, err := store.getDB().ExecContext(ctx,
+				"DELETE FROM "+table+" WHERE dev_eui = $1", devEUI[:])
+			if err != nil {
+				return fmt.Errorf("purge %s: %w", table, err)
+			}
+
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			counts[table] = rows
+		}
+
+		if counts["devices"] == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
 // ListDevices lists devices
 func (s *PostgresStore) ListDevices(ctx context.Context, applicationID uuid.UUID, limit, offset int) ([]*models.Device, int64, error) {
 	// Get count
@@ -217,7 +345,7 @@ func (s *PostgresStore) ListDevices(ctx context.Context, applicationID uuid.UUID
 	query := `
         SELECT dev_eui, created_at, updated_at, tenant_id, join_eui, dev_addr,
                name, description, application_id, device_profile_id, is_disabled,
-               last_seen_at, battery_level, f_cnt_up
+               last_seen_at, battery_level, f_cnt_up, forward_disabled
         FROM devices
         WHERE application_id = $1
         ORDER BY created_at DESC
@@ -238,7 +366,7 @@ func (s *PostgresStore) ListDevices(ctx context.Context, applicationID uuid.UUID
 			&devEUIBytes, &device.CreatedAt, &device.UpdatedAt, &device.TenantID,
 			&joinEUIBytes, &devAddrBytes, &device.Name, &device.Description,
 			&device.ApplicationID, &device.DeviceProfileID, &device.IsDisabled,
-			&device.LastSeenAt, &device.BatteryLevel, &device.FCntUp,
+			&device.LastSeenAt, &device.BatteryLevel, &device.FCntUp, &device.ForwardDisabled,
 		)
 		if err != nil {
 			return nil, 0, err
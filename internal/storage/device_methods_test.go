@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+var (
+	createTableRe = regexp.MustCompile(`(?s)CREATE TABLE public\.(\w+) \((.*?)\n\);`)
+	devEUIColumn  = regexp.MustCompile(`(?m)^\s+dev_eui bytea`)
+)
+
+// TestDevicePurgeTablesCoverSchema checks that purging a device deletes from every
+// table with a dev_eui column, and from devices only after its dependents
+func TestDevicePurgeTablesCoverSchema(t *testing.T) {
+	purged := make(map[string]int)
+	for i, table := range devicePurgeTables {
+		purged[table] = i
+	}
+	if last := devicePurgeTables[len(devicePurgeTables)-1]; last != "devices" {
+		t.Errorf("last purged table = %s, want devices", last)
+	}
+
+	for _, schema := range []string{"../../data/lorawan_as_schema.sql", "../../data/lorawan_ns_schema.sql"} {
+		sql, err := os.ReadFile(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables := createTableRe.FindAllStringSubmatch(string(sql), -1)
+		if len(tables) == 0 {
+			t.Fatalf("%s: no tables found", schema)
+		}
+		for _, m := range tables {
+			if !devEUIColumn.MatchString(m[2]) {
+				continue
+			}
+			if _, ok := purged[m[1]]; !ok {
+				t.Errorf("%s: table %s has a dev_eui column but is not purged", schema, m[1])
+			}
+		}
+	}
+}
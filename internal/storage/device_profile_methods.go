@@ -3,15 +3,55 @@ package storage
 import (
     "context"
     "database/sql"
+    "fmt"
     "strings"
     "time"
     
     "github.com/google/uuid"
+    "github.com/lib/pq"
     "github.com/lorawan-server/lorawan-server-pro/internal/models"
 )
 
 // ========== Device Profile Methods ==========
 
+// deviceProfileColumns is the column list shared by the profile SELECTs. Columns
+// without NOT NULL read as their schema defaults when NULL.
+const deviceProfileColumns = `
+        id, created_at, updated_at, tenant_id, name, COALESCE(description, ''),
+        COALESCE(mac_version, '1.0.3'), COALESCE(reg_params_revision, 'A'),
+        COALESCE(max_eirp, 14), COALESCE(max_duty_cycle, 0), COALESCE(rf_region, 'EU868'),
+        COALESCE(supports_join, true), COALESCE(supports_32_bit_f_cnt, true),
+        COALESCE(supports_class_b, false), COALESCE(class_b_timeout, 0),
+        COALESCE(ping_slot_period, 128), COALESCE(ping_slot_dr, 0), COALESCE(ping_slot_freq, 0),
+        COALESCE(supports_class_c, false), COALESCE(class_c_timeout, 0),
+        COALESCE(uplink_interval, 0), COALESCE(adr_mode, 'auto'), max_downlink_dr,
+        max_uplink_rate, max_nb_trans, abp_only, max_downlink_queue_age, downlink_code_rate,
+        supported_data_rates, device_class, fcnt_resets_allowed, rx1_delay, rx2_dr, rx2_freq,
+        supports_cflist, join_accept_rx2`
+
+// scanDeviceProfile scans a row selected with deviceProfileColumns
+func scanDeviceProfile(row interface{ Scan(dest ...interface{}) error }) (*models.DeviceProfile, error) {
+    profile := &models.DeviceProfile{}
+    err := row.Scan(
+        &profile.ID, &profile.CreatedAt, &profile.UpdatedAt, &profile.TenantID,
+        &profile.Name, &profile.Description, &profile.MACVersion,
+        &profile.RegParamsRevision, &profile.MaxEIRP, &profile.MaxDutyCycle,
+        &profile.RFRegion, &profile.SupportsJoin, &profile.Supports32BitFCnt,
+        &profile.SupportsClassB, &profile.ClassBTimeout, &profile.PingSlotPeriod,
+        &profile.PingSlotDR, &profile.PingSlotFreq, &profile.SupportsClassC,
+        &profile.ClassCTimeout, &profile.UplinkInterval, &profile.ADRMode,
+        &profile.MaxDownlinkDR, &profile.MaxUplinkRate, &profile.MaxNbTrans,
+        &profile.ABPOnly, &profile.MaxDownlinkQueueAge, &profile.DownlinkCodeRate,
+        pq.Array(&profile.SupportedDataRates), &profile.DeviceClass,
+        &profile.FCntResetsAllowed, &profile.RX1Delay, &profile.RX2DR, &profile.RX2Frequency,
+        &profile.SupportsCFList, &profile.JoinAcceptRX2,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return profile, nil
+}
+
 // CreateDeviceProfile creates a new device profile
 func (s *PostgresStore) CreateDeviceProfile(ctx context.Context, profile *models.DeviceProfile) error {
     if profile.ID == uuid.Nil {
@@ -29,10 +69,15 @@ func (s *PostgresStore) CreateDeviceProfile(ctx context.Context, profile *models
             rf_region, supports_join, supports_32_bit_f_cnt,
             supports_class_b, class_b_timeout, ping_slot_period,
             ping_slot_dr, ping_slot_freq, supports_class_c,
-            class_c_timeout, uplink_interval
+            class_c_timeout, uplink_interval, adr_mode, max_downlink_dr,
+            max_uplink_rate, max_nb_trans, abp_only, max_downlink_queue_age,
+            downlink_code_rate, supported_data_rates, device_class,
+            fcnt_resets_allowed, rx1_delay, rx2_dr, rx2_freq,
+            supports_cflist, join_accept_rx2
         ) VALUES (
             $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
-            $14, $15, $16, $17, $18, $19, $20, $21
+            $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26,
+            $27, $28, $29, $30, $31, $32, $33, $34, $35, $36
         )`
     
     _, err := s.getDB().ExecContext(ctx, query,
@@ -42,7 +87,12 @@ func (s *PostgresStore) CreateDeviceProfile(ctx context.Context, profile *models
         profile.RFRegion, profile.SupportsJoin, profile.Supports32BitFCnt,
         profile.SupportsClassB, profile.ClassBTimeout, profile.PingSlotPeriod,
         profile.PingSlotDR, profile.PingSlotFreq, profile.SupportsClassC,
-        profile.ClassCTimeout, profile.UplinkInterval,
+        profile.ClassCTimeout, profile.UplinkInterval, adrModeValue(profile.ADRMode),
+        profile.MaxDownlinkDR, profile.MaxUplinkRate, profile.MaxNbTrans,
+        profile.ABPOnly, profile.MaxDownlinkQueueAge, profile.DownlinkCodeRate,
+        pq.Array(profileDataRates(profile.SupportedDataRates)), deviceClassValue(profile.DeviceClass),
+        profile.FCntResetsAllowed, profile.RX1Delay, profile.RX2DR, profile.RX2Frequency,
+        profile.SupportsCFList, profile.JoinAcceptRX2,
     )
     
     if err != nil {
@@ -57,21 +107,9 @@ func (s *PostgresStore) CreateDeviceProfile(ctx context.Context, profile *models
 
 // GetDeviceProfile gets a device profile by ID
 func (s *PostgresStore) GetDeviceProfile(ctx context.Context, id uuid.UUID) (*models.DeviceProfile, error) {
-    query := `
-        SELECT id, created_at, updated_at, tenant_id, name, description,
-               mac_version, reg_params_revision, max_eirp, max_duty_cycle,
-               rf_region, supports_join, supports_32_bit_f_cnt
-        FROM device_profiles
-        WHERE id = $1`
-    
-    profile := &models.DeviceProfile{}
-    err := s.getDB().QueryRowContext(ctx, query, id).Scan(
-        &profile.ID, &profile.CreatedAt, &profile.UpdatedAt, &profile.TenantID,
-        &profile.Name, &profile.Description, &profile.MACVersion,
-        &profile.RegParamsRevision, &profile.MaxEIRP, &profile.MaxDutyCycle,
-        &profile.RFRegion, &profile.SupportsJoin, &profile.Supports32BitFCnt,
-    )
+    query := "SELECT " + deviceProfileColumns + " FROM device_profiles WHERE id = $1"
     
+    profile, err := scanDeviceProfile(s.getDB().QueryRowContext(ctx, query, id))
     if err == sql.ErrNoRows {
         return nil, ErrNotFound
     }
@@ -79,17 +117,39 @@ func (s *PostgresStore) GetDeviceProfile(ctx context.Context, id uuid.UUID) (*mo
     return profile, err
 }
 
-// UpdateDeviceProfile updates a device profile
+// UpdateDeviceProfile updates a device profile. The tenant and creation time
+// cannot be changed.
 func (s *PostgresStore) UpdateDeviceProfile(ctx context.Context, profile *models.DeviceProfile) error {
     profile.UpdatedAt = time.Now()
     
     query := `
         UPDATE device_profiles SET
-            updated_at = $2, name = $3, description = $4
+            updated_at = $2, name = $3, description = $4, mac_version = $5,
+            reg_params_revision = $6, max_eirp = $7, max_duty_cycle = $8,
+            rf_region = $9, supports_join = $10, supports_32_bit_f_cnt = $11,
+            supports_class_b = $12, class_b_timeout = $13, ping_slot_period = $14,
+            ping_slot_dr = $15, ping_slot_freq = $16, supports_class_c = $17,
+            class_c_timeout = $18, uplink_interval = $19, adr_mode = $20,
+            max_downlink_dr = $21, max_uplink_rate = $22, max_nb_trans = $23,
+            abp_only = $24, max_downlink_queue_age = $25, downlink_code_rate = $26,
+            supported_data_rates = $27, device_class = $28,
+            fcnt_resets_allowed = $29, rx1_delay = $30, rx2_dr = $31, rx2_freq = $32,
+            supports_cflist = $33, join_accept_rx2 = $34
         WHERE id = $1`
     
     result, err := s.getDB().ExecContext(ctx, query,
         profile.ID, profile.UpdatedAt, profile.Name, profile.Description,
+        profile.MACVersion, profile.RegParamsRevision, profile.MaxEIRP,
+        profile.MaxDutyCycle, profile.RFRegion, profile.SupportsJoin,
+        profile.Supports32BitFCnt, profile.SupportsClassB, profile.ClassBTimeout,
+        profile.PingSlotPeriod, profile.PingSlotDR, profile.PingSlotFreq,
+        profile.SupportsClassC, profile.ClassCTimeout, profile.UplinkInterval,
+        adrModeValue(profile.ADRMode), profile.MaxDownlinkDR, profile.MaxUplinkRate,
+        profile.MaxNbTrans, profile.ABPOnly, profile.MaxDownlinkQueueAge,
+        profile.DownlinkCodeRate, pq.Array(profileDataRates(profile.SupportedDataRates)),
+        deviceClassValue(profile.DeviceClass), profile.FCntResetsAllowed,
+        profile.RX1Delay, profile.RX2DR, profile.RX2Frequency,
+        profile.SupportsCFList, profile.JoinAcceptRX2,
     )
     
     if err != nil {
@@ -108,10 +168,14 @@ func (s *PostgresStore) UpdateDeviceProfile(ctx context.Context, profile *models
     return nil
 }
 
-// DeleteDeviceProfile deletes a device profile
+// DeleteDeviceProfile deletes a device profile. It returns ErrInvalidData
+// while devices still reference the profile.
 func (s *PostgresStore) DeleteDeviceProfile(ctx context.Context, id uuid.UUID) error {
     result, err := s.getDB().ExecContext(ctx, "DELETE FROM device_profiles WHERE id = $1", id)
     if err != nil {
+        if strings.Contains(err.Error(), "foreign key") {
+            return ErrInvalidData
+        }
         return err
     }
     
@@ -127,29 +191,25 @@ func (s *PostgresStore) DeleteDeviceProfile(ctx context.Context, id uuid.UUID) e
     return nil
 }
 
-// ListDeviceProfiles lists device profiles
+// ListDeviceProfiles lists device profiles, all tenants when tenantID is nil
 func (s *PostgresStore) ListDeviceProfiles(ctx context.Context, tenantID *uuid.UUID, limit, offset int) ([]*models.DeviceProfile, int64, error) {
     var args []interface{}
-    countQuery := "SELECT COUNT(*) FROM device_profiles"
-    query := `SELECT id, created_at, updated_at, tenant_id, name, description,
-                     rf_region, supports_join
-              FROM device_profiles`
-    
+    where := ""
     if tenantID != nil {
-        countQuery += " WHERE tenant_id = $1"
-        query += " WHERE tenant_id = $1"
+        where = " WHERE tenant_id = $1"
         args = append(args, *tenantID)
     }
     
     // Get count
     var count int64
-    err := s.getDB().QueryRowContext(ctx, countQuery, args...).Scan(&count)
+    err := s.getDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM device_profiles"+where, args...).Scan(&count)
     if err != nil {
         return nil, 0, err
     }
     
     // Get rows
-    query += " ORDER BY created_at DESC LIMIT $2 OFFSET $3"
+    query := "SELECT " + deviceProfileColumns + " FROM device_profiles" + where +
+        fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
     args = append(args, limit, offset)
     
     rows, err := s.getDB().QueryContext(ctx, query, args...)
@@ -158,18 +218,38 @@ func (s *PostgresStore) ListDeviceProfiles(ctx context.Context, tenantID *uuid.U
     }
     defer rows.Close()
     
-    var profiles []*models.DeviceProfile
+    profiles := []*models.DeviceProfile{}
     for rows.Next() {
-        profile := &models.DeviceProfile{}
-        err := rows.Scan(
-            &profile.ID, &profile.CreatedAt, &profile.UpdatedAt, &profile.TenantID,
-            &profile.Name, &profile.Description, &profile.RFRegion, &profile.SupportsJoin,
-        )
+        profile, err := scanDeviceProfile(rows)
         if err != nil {
             return nil, 0, err
         }
         profiles = append(profiles, profile)
     }
     
-    return profiles, count, nil
+    return profiles, count, rows.Err()
+}
+
+// adrModeValue 空的 ADR 策略按 auto 保存
+func adrModeValue(mode models.ADRMode) models.ADRMode {
+    if mode == "" {
+        return models.ADRModeAuto
+    }
+    return mode
+}
+
+// profileDataRates 未配置时写入空数组，supported_data_rates 不允许为 NULL
+func profileDataRates(rates []int64) []int64 {
+    if rates == nil {
+        return []int64{}
+    }
+    return rates
+}
+
+// deviceClassValue 空的设备类别按 A 保存
+func deviceClassValue(class models.DeviceClass) models.DeviceClass {
+    if class == "" {
+        return models.DeviceClassA
+    }
+    return class
 }
@@ -11,34 +11,33 @@ import (
 
 // ========== Device Session Methods ==========
 
-// GetDeviceSession gets a device session
-func (s *PostgresStore) GetDeviceSession(ctx context.Context, devEUI lorawan.EUI64) (*models.DeviceSession, error) {
-    query := `
-        SELECT dev_eui, dev_addr, join_eui, app_s_key, f_nwk_s_int_key,
-               s_nwk_s_int_key, nwk_s_enc_key, f_cnt_up, n_f_cnt_down,
-               a_f_cnt_down, conf_f_cnt, rx1_delay, rx1_dr_offset,
-               rx2_dr, rx2_freq, tx_power, dr, adr,
-               last_dev_status_request, created_at, updated_at
-        FROM device_sessions
-        WHERE dev_eui = $1`
-    
+// deviceSessionColumns is the column list shared by the session SELECTs. Counters and
+// radio settings are nullable in older schemas, so NULLs read as the column defaults.
+const deviceSessionColumns = `
+        dev_eui, dev_addr, join_eui, app_s_key, f_nwk_s_int_key,
+        s_nwk_s_int_key, nwk_s_enc_key, COALESCE(f_cnt_up, 0), COALESCE(n_f_cnt_down, 0),
+        COALESCE(a_f_cnt_down, 0), COALESCE(conf_f_cnt, 0), COALESCE(rx1_delay, 1),
+        COALESCE(rx1_dr_offset, 0), COALESCE(rx2_dr, 0), COALESCE(rx2_freq, 0),
+        COALESCE(tx_power, 0), COALESCE(dr, 0), COALESCE(adr, false), COALESCE(nb_trans, 1),
+        mac_version, last_dev_status_request, created_at, updated_at,
+        COALESCE(uplink_received, f_cnt_up > 0)`
+
+// scanDeviceSession scans a row selected with deviceSessionColumns
+func scanDeviceSession(row interface{ Scan(dest ...interface{}) error }) (*models.DeviceSession, error) {
     session := &models.DeviceSession{}
     var devEUIBytes, devAddrBytes, joinEUIBytes []byte
+    var lastDevStatusRequest sql.NullTime
     
-    err := s.getDB().QueryRowContext(ctx, query, devEUI[:]).Scan(
+    err := row.Scan(
         &devEUIBytes, &devAddrBytes, &joinEUIBytes,
         &session.AppSKey, &session.FNwkSIntKey, &session.SNwkSIntKey,
         &session.NwkSEncKey, &session.FCntUp, &session.NFCntDown,
         &session.AFCntDown, &session.ConfFCnt, &session.RX1Delay,
         &session.RX1DROffset, &session.RX2DR, &session.RX2Freq,
-        &session.TXPower, &session.DR, &session.ADR,
-        &session.LastDevStatusRequest, &session.CreatedAt, &session.UpdatedAt,
+        &session.TXPower, &session.DR, &session.ADR, &session.NbTrans,
+        &session.MACVersion, &lastDevStatusRequest, &session.CreatedAt, &session.UpdatedAt,
+        &session.UplinkReceived,
     )
-    
-    if err == sql.ErrNoRows {
-        return nil, ErrNotFound
-    }
-    
     if err != nil {
         return nil, err
     }
@@ -46,24 +45,45 @@ func (s *PostgresStore) GetDeviceSession(ctx context.Context, devEUI lorawan.EUI
     copy(session.DevEUI[:], devEUIBytes)
     copy(session.DevAddr[:], devAddrBytes)
     copy(session.JoinEUI[:], joinEUIBytes)
+    session.LastDevStatusRequest = lastDevStatusRequest.Time
     
     return session, nil
 }
 
+// GetDeviceSession gets a device session
+func (s *PostgresStore) GetDeviceSession(ctx context.Context, devEUI lorawan.EUI64) (*models.DeviceSession, error) {
+    query := `SELECT ` + deviceSessionColumns + `
+        FROM device_sessions
+        WHERE dev_eui = $1`
+    
+    session, err := scanDeviceSession(s.getDB().QueryRowContext(ctx, query, devEUI[:]))
+    if err == sql.ErrNoRows {
+        return nil, ErrNotFound
+    }
+    
+    return session, err
+}
+
 // SaveDeviceSession saves a device session
 func (s *PostgresStore) SaveDeviceSession(ctx context.Context, session *models.DeviceSession) error {
     session.UpdatedAt = time.Now()
+    if session.CreatedAt.IsZero() {
+        session.CreatedAt = session.UpdatedAt
+    }
+    // 从未请求过 DevStatus 时存 NULL
+    lastDevStatusRequest := sql.NullTime{Time: session.LastDevStatusRequest, Valid: !session.LastDevStatusRequest.IsZero()}
     
     query := `
         INSERT INTO device_sessions (
             dev_eui, dev_addr, join_eui, app_s_key, f_nwk_s_int_key,
             s_nwk_s_int_key, nwk_s_enc_key, f_cnt_up, n_f_cnt_down,
             a_f_cnt_down, conf_f_cnt, rx1_delay, rx1_dr_offset,
-            rx2_dr, rx2_freq, tx_power, dr, adr,
-            last_dev_status_request, created_at, updated_at
+            rx2_dr, rx2_freq, tx_power, dr, adr, nb_trans,
+            mac_version, last_dev_status_request, created_at, updated_at,
+            uplink_received
         ) VALUES (
             $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
-            $13, $14, $15, $16, $17, $18, $19, $20, $21
+            $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24
         )
         ON CONFLICT (dev_eui) DO UPDATE SET
             dev_addr = EXCLUDED.dev_addr,
@@ -83,8 +103,11 @@ func (s *PostgresStore) SaveDeviceSession(ctx context.Context, session *models.D
             tx_power = EXCLUDED.tx_power,
             dr = EXCLUDED.dr,
             adr = EXCLUDED.adr,
+            nb_trans = EXCLUDED.nb_trans,
+            mac_version = EXCLUDED.mac_version,
             last_dev_status_request = EXCLUDED.last_dev_status_request,
-            updated_at = EXCLUDED.updated_at`
+            updated_at = EXCLUDED.updated_at,
+            uplink_received = EXCLUDED.uplink_received`
     
     _, err := s.getDB().ExecContext(ctx, query,
         session.DevEUI[:], session.DevAddr[:], session.JoinEUI[:],
@@ -92,13 +115,37 @@ func (s *PostgresStore) SaveDeviceSession(ctx context.Context, session *models.D
         session.NwkSEncKey, session.FCntUp, session.NFCntDown,
         session.AFCntDown, session.ConfFCnt, session.RX1Delay,
         session.RX1DROffset, session.RX2DR, session.RX2Freq,
-        session.TXPower, session.DR, session.ADR,
-        session.LastDevStatusRequest, session.CreatedAt, session.UpdatedAt,
+        session.TXPower, session.DR, session.ADR, session.NbTrans,
+        session.MACVersion, lastDevStatusRequest, session.CreatedAt, session.UpdatedAt,
+        session.UplinkReceived,
     )
     
     return err
 }
 
+// AdvanceDeviceSessionFCntUp atomically sets the session's FCntUp to fCnt and marks an uplink as
+// received if the stored counter is still last and its received flag is still received.
+// It returns false when the stored counter has moved on, i.e. the uplink was already accepted
+// (by this or another server instance) after the session was read. Comparing the flag as well
+// keeps a replayed first uplink with FCnt 0 from matching the counter a join left at 0.
+func (s *PostgresStore) AdvanceDeviceSessionFCntUp(ctx context.Context, devEUI lorawan.EUI64, last uint32, received bool, fCnt uint32) (bool, error) {
+    result, err := s.getDB().ExecContext(ctx, `
+        UPDATE device_sessions SET f_cnt_up = $3, uplink_received = true, updated_at = $5
+        WHERE dev_eui = $1 AND f_cnt_up = $2 AND COALESCE(uplink_received, f_cnt_up > 0) = $4`,
+        devEUI[:], last, fCnt, received, time.Now(),
+    )
+    if err != nil {
+        return false, err
+    }
+    
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    
+    return rows == 1, nil
+}
+
 // DeleteDeviceSession deletes a device session
 func (s *PostgresStore) DeleteDeviceSession(ctx context.Context, devEUI lorawan.EUI64) error {
     result, err := s.getDB().ExecContext(ctx, "DELETE FROM device_sessions WHERE dev_eui = $1", devEUI[:])
@@ -118,14 +165,14 @@ func (s *PostgresStore) DeleteDeviceSession(ctx context.Context, devEUI lorawan.
     return nil
 }
 
-// GetDeviceSessionByDevAddr gets device sessions by DevAddr
+// GetDeviceSessionByDevAddr gets all device sessions using devAddr, most recently
+// updated first. DevAddrs are not unique, so the caller picks the session whose keys
+// validate the uplink MIC. Returns an empty slice when no session uses devAddr.
 func (s *PostgresStore) GetDeviceSessionByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.DeviceSession, error) {
-    query := `
-        SELECT dev_eui, dev_addr, join_eui, app_s_key, f_nwk_s_int_key,
-               s_nwk_s_int_key, nwk_s_enc_key, f_cnt_up, n_f_cnt_down,
-               a_f_cnt_down, conf_f_cnt
+    query := `SELECT ` + deviceSessionColumns + `
         FROM device_sessions
-        WHERE dev_addr = $1`
+        WHERE dev_addr = $1
+        ORDER BY updated_at DESC`
     
     rows, err := s.getDB().QueryContext(ctx, query, devAddr[:])
     if err != nil {
@@ -133,27 +180,14 @@ func (s *PostgresStore) GetDeviceSessionByDevAddr(ctx context.Context, devAddr l
     }
     defer rows.Close()
     
-    var sessions []*models.DeviceSession
+    sessions := make([]*models.DeviceSession, 0)
     for rows.Next() {
-        session := &models.DeviceSession{}
-        var devEUIBytes, devAddrBytes, joinEUIBytes []byte
-        
-        err := rows.Scan(
-            &devEUIBytes, &devAddrBytes, &joinEUIBytes,
-            &session.AppSKey, &session.FNwkSIntKey, &session.SNwkSIntKey,
-            &session.NwkSEncKey, &session.FCntUp, &session.NFCntDown,
-            &session.AFCntDown, &session.ConfFCnt,
-        )
+        session, err := scanDeviceSession(rows)
         if err != nil {
             return nil, err
         }
-        
-        copy(session.DevEUI[:], devEUIBytes)
-        copy(session.DevAddr[:], devAddrBytes)
-        copy(session.JoinEUI[:], joinEUIBytes)
-        
         sessions = append(sessions, session)
     }
     
-    return sessions, nil
+    return sessions, rows.Err()
 }
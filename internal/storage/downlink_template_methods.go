@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// ========== Downlink Template Methods ==========
+
+const downlinkTemplateColumns = `id, created_at, updated_at, application_id, name,
+               COALESCE(description, ''), f_port, data, confirmed`
+
+// CreateDownlinkTemplate creates a named downlink template for an application
+func (s *PostgresStore) CreateDownlinkTemplate(ctx context.Context, tmpl *models.DownlinkTemplate) error {
+	if tmpl.ID == uuid.Nil {
+		tmpl.ID = uuid.New()
+	}
+
+	now := time.Now()
+	tmpl.CreatedAt = now
+	tmpl.UpdatedAt = now
+
+	_, err := s.getDB().ExecContext(ctx, `
+		INSERT INTO downlink_templates (
+			id, created_at, updated_at, application_id, name, description,
+			f_port, data, confirmed
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		tmpl.ID, tmpl.CreatedAt, tmpl.UpdatedAt, tmpl.ApplicationID, tmpl.Name,
+		tmpl.Description, tmpl.FPort, tmpl.Data, tmpl.Confirmed,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetDownlinkTemplate gets an application's downlink template by name
+func (s *PostgresStore) GetDownlinkTemplate(ctx context.Context, applicationID uuid.UUID, name string) (*models.DownlinkTemplate, error) {
+	query := `
+        SELECT ` + downlinkTemplateColumns + `
+        FROM downlink_templates
+        WHERE application_id = $1 AND name = $2`
+
+	tmpl := &models.DownlinkTemplate{}
+	err := s.getDB().QueryRowContext(ctx, query, applicationID, name).Scan(
+		&tmpl.ID, &tmpl.CreatedAt, &tmpl.UpdatedAt, &tmpl.ApplicationID, &tmpl.Name,
+		&tmpl.Description, &tmpl.FPort, &tmpl.Data, &tmpl.Confirmed,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// ListDownlinkTemplates lists an application's downlink templates by name
+func (s *PostgresStore) ListDownlinkTemplates(ctx context.Context, applicationID uuid.UUID) ([]*models.DownlinkTemplate, error) {
+	query := `
+        SELECT ` + downlinkTemplateColumns + `
+        FROM downlink_templates
+        WHERE application_id = $1
+        ORDER BY name`
+
+	rows, err := s.getDB().QueryContext(ctx, query, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*models.DownlinkTemplate
+	for rows.Next() {
+		tmpl := &models.DownlinkTemplate{}
+		if err := rows.Scan(
+			&tmpl.ID, &tmpl.CreatedAt, &tmpl.UpdatedAt, &tmpl.ApplicationID, &tmpl.Name,
+			&tmpl.Description, &tmpl.FPort, &tmpl.Data, &tmpl.Confirmed,
+		); err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+
+	return templates, rows.Err()
+}
+
+// UpdateDownlinkTemplate updates a downlink template, which may also be renamed
+func (s *PostgresStore) UpdateDownlinkTemplate(ctx context.Context, tmpl *models.DownlinkTemplate) error {
+	tmpl.UpdatedAt = time.Now()
+
+	result, err := s.getDB().ExecContext(ctx, `
+		UPDATE downlink_templates SET
+			updated_at = $2, name = $3, description = $4,
+			f_port = $5, data = $6, confirmed = $7
+		WHERE id = $1`,
+		tmpl.ID, tmpl.UpdatedAt, tmpl.Name, tmpl.Description,
+		tmpl.FPort, tmpl.Data, tmpl.Confirmed,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteDownlinkTemplate deletes a downlink template
+func (s *PostgresStore) DeleteDownlinkTemplate(ctx context.Context, id uuid.UUID) error {
+	result, err := s.getDB().ExecContext(ctx, "DELETE FROM downlink_templates WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// frameLogColumns is the number of columns written per frame log record
+const frameLogColumns = 10
+
+// maxFrameLogBatch keeps a batch under the PostgreSQL bind parameter limit
+const maxFrameLogBatch = 65535 / frameLogColumns
+
+// SaveFrameLogs 使用多行 INSERT 批量保存帧日志
+func (s *PostgresStore) SaveFrameLogs(ctx context.Context, records []*models.FrameLog) error {
+	for len(records) > 0 {
+		n := len(records)
+		if n > maxFrameLogBatch {
+			n = maxFrameLogBatch
+		}
+		if err := s.saveFrameLogBatch(ctx, records[:n]); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+func (s *PostgresStore) saveFrameLogBatch(ctx context.Context, records []*models.FrameLog) error {
+	var query strings.Builder
+	query.WriteString(`
+        INSERT INTO frame_logs (
+            time, direction, gateway_id, phy_payload, frequency,
+            data_rate, rssi, snr, result, trace_id
+        ) VALUES `)
+
+	args := make([]interface{}, 0, len(records)*frameLogColumns)
+	for i, rec := range records {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := 0; j < frameLogColumns; j++ {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+		query.WriteString(")")
+
+		args = append(args,
+			rec.Time, rec.Direction, rec.GatewayID, rec.PHYPayload, rec.Frequency,
+			rec.DataRate, rec.RSSI, rec.SNR, rec.Result, rec.TraceID,
+		)
+	}
+
+	_, err := s.getDB().ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// DeleteFrameLogsBefore 删除早于 before 的帧日志，返回删除的条数
+func (s *PostgresStore) DeleteFrameLogsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.getDB().ExecContext(ctx, "DELETE FROM frame_logs WHERE time < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
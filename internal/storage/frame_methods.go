@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -90,6 +91,37 @@ func (s *PostgresStore) ListUplinkFrames(ctx context.Context, devEUI lorawan.EUI
 	return frames, count, nil
 }
 
+// GetUplinkFrame gets a stored uplink frame by ID
+func (s *PostgresStore) GetUplinkFrame(ctx context.Context, id uuid.UUID) (*models.UplinkFrame, error) {
+	query := `
+        SELECT id, dev_eui, dev_addr, application_id, phy_payload,
+               tx_info, rx_info, f_cnt, f_port, dr, adr,
+               data, object, confirmed, received_at
+        FROM uplink_frames
+        WHERE id = $1`
+
+	frame := &models.UplinkFrame{}
+	var devEUIBytes, devAddrBytes []byte
+
+	err := s.getDB().QueryRowContext(ctx, query, id).Scan(
+		&frame.ID, &devEUIBytes, &devAddrBytes, &frame.ApplicationID,
+		&frame.PHYPayload, &frame.TXInfo, &frame.RXInfo, &frame.FCnt,
+		&frame.FPort, &frame.DR, &frame.ADR, &frame.Data, &frame.Object,
+		&frame.Confirmed, &frame.ReceivedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	copy(frame.DevEUI[:], devEUIBytes)
+	copy(frame.DevAddr[:], devAddrBytes)
+
+	return frame, nil
+}
+
 // CreateDownlinkFrame creates a downlink frame
 func (s *PostgresStore) CreateDownlinkFrame(ctx context.Context, frame *models.DownlinkFrame) error {
 	if frame.ID == uuid.Nil {
@@ -154,16 +186,45 @@ func (s *PostgresStore) GetPendingDownlinks(ctx context.Context, devEUI lorawan.
 	return frames, nil
 }
 
+// GetDownlinkFrame gets a downlink frame by ID
+func (s *PostgresStore) GetDownlinkFrame(ctx context.Context, id uuid.UUID) (*models.DownlinkFrame, error) {
+	query := `
+        SELECT id, dev_eui, application_id, f_port, data, confirmed,
+               is_pending, retry_count, created_at, transmitted_at,
+               acked_at, reference
+        FROM downlink_frames
+        WHERE id = $1`
+
+	frame := &models.DownlinkFrame{}
+	var devEUIBytes []byte
+
+	err := s.getDB().QueryRowContext(ctx, query, id).Scan(
+		&frame.ID, &devEUIBytes, &frame.ApplicationID, &frame.FPort,
+		&frame.Data, &frame.Confirmed, &frame.IsPending, &frame.RetryCount,
+		&frame.CreatedAt, &frame.TransmittedAt, &frame.AckedAt, &frame.Reference,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	copy(frame.DevEUI[:], devEUIBytes)
+	return frame, nil
+}
+
 // UpdateDownlinkFrame updates a downlink frame
 func (s *PostgresStore) UpdateDownlinkFrame(ctx context.Context, frame *models.DownlinkFrame) error {
 	query := `
         UPDATE downlink_frames SET
-            is_pending = $2, retry_count = $3, transmitted_at = $4, acked_at = $5
+            is_pending = $2, retry_count = $3, transmitted_at = $4, acked_at = $5,
+            expired_at = $6
         WHERE id = $1`
 
 	result, err := s.getDB().ExecContext(ctx, query,
 		frame.ID, frame.IsPending, frame.RetryCount,
-		frame.TransmittedAt, frame.AckedAt,
+		frame.TransmittedAt, frame.AckedAt, frame.ExpiredAt,
 	)
 
 	if err != nil {
@@ -205,9 +266,56 @@ func (s *PostgresStore) DeleteDownlinkFrame(ctx context.Context, id uuid.UUID) e
 	return nil
 }
 
-// SaveUplinkFrame 保存上行帧
+// uplinkFrameColumns 是 uplink_frames 每行写入的列数
+const uplinkFrameColumns = 15
+
 // SaveUplinkFrame 保存上行帧
 func (s *PostgresStore) SaveUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error {
+	return s.SaveUplinkFrames(ctx, []*models.UplinkFrame{frame})
+}
+
+// SaveUplinkFrames 使用一条多行 INSERT 批量保存上行帧
+func (s *PostgresStore) SaveUplinkFrames(ctx context.Context, frames []*models.UplinkFrame) error {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+        INSERT INTO uplink_frames (
+            id, dev_eui, dev_addr, application_id, phy_payload,
+            tx_info, rx_info, f_cnt, f_port, dr, adr,
+            data, object, confirmed, received_at
+        ) VALUES `)
+
+	args := make([]interface{}, 0, len(frames)*uplinkFrameColumns)
+	for i, frame := range frames {
+		frameArgs, err := uplinkFrameArgs(frame)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := range frameArgs {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+		query.WriteString(")")
+
+		args = append(args, frameArgs...)
+	}
+
+	_, err := s.getDB().ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// uplinkFrameArgs 生成上行帧的 INSERT 参数，顺序与 SaveUplinkFrames 的列一致
+func uplinkFrameArgs(frame *models.UplinkFrame) ([]interface{}, error) {
 	if frame.ID == uuid.Nil {
 		frame.ID = uuid.New()
 	}
@@ -219,29 +327,19 @@ func (s *PostgresStore) SaveUplinkFrame(ctx context.Context, frame *models.Uplin
 	// ✅ 关键修复：将 map 转换为 JSON
 	txInfoJSON, err := json.Marshal(frame.TXInfo)
 	if err != nil {
-		return fmt.Errorf("marshal tx_info: %w", err)
+		return nil, fmt.Errorf("marshal tx_info: %w", err)
 	}
 
 	rxInfoJSON, err := json.Marshal(frame.RXInfo)
 	if err != nil {
-		return fmt.Errorf("marshal rx_info: %w", err)
+		return nil, fmt.Errorf("marshal rx_info: %w", err)
 	}
 
 	objectJSON, err := json.Marshal(frame.Object)
 	if err != nil {
-		return fmt.Errorf("marshal object: %w", err)
+		return nil, fmt.Errorf("marshal object: %w", err)
 	}
 
-	query := `
-        INSERT INTO uplink_frames (
-            id, dev_eui, dev_addr, application_id, phy_payload,
-            tx_info, rx_info, f_cnt, f_port, dr, adr,
-            data, object, confirmed, received_at
-        ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 
-            $11, $12, $13, $14, $15
-        )`
-
 	// 处理可选的 FPort 字段
 	var fPort sql.NullInt16
 	if frame.FPort != nil {
@@ -251,7 +349,7 @@ func (s *PostgresStore) SaveUplinkFrame(ctx context.Context, frame *models.Uplin
 		}
 	}
 
-	_, err = s.getDB().ExecContext(ctx, query,
+	return []interface{}{
 		frame.ID,
 		frame.DevEUI[:],
 		frame.DevAddr[:],
@@ -267,9 +365,7 @@ func (s *PostgresStore) SaveUplinkFrame(ctx context.Context, frame *models.Uplin
 		objectJSON, // ✅ 使用JSON格式
 		frame.Confirmed,
 		frame.ReceivedAt,
-	)
-
-	return err
+	}, nil
 }
 
 // GetLastGatewayForDevice 获取设备最后使用的网关
@@ -3,6 +3,7 @@ package storage
 import (
     "context"
     "database/sql"
+    "fmt"
     "strings"
     "time"
     
@@ -27,16 +28,17 @@ func (s *PostgresStore) CreateGateway(ctx context.Context, gateway *models.Gatew
         INSERT INTO gateways (
             gateway_id, created_at, updated_at, tenant_id, name, description,
             location, model, min_frequency, max_frequency, network_server_id,
-            gateway_profile_id, tags, metadata
+            gateway_profile_id, tags, metadata, labels, radios
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
         )`
     
     _, err := s.getDB().ExecContext(ctx, query,
         gateway.GatewayID[:], gateway.CreatedAt, gateway.UpdatedAt, gateway.TenantID,
         gateway.Name, gateway.Description, gateway.Location, gateway.Model,
         gateway.MinFrequency, gateway.MaxFrequency, gateway.NetworkServerID,
-        gateway.GatewayProfileID, gateway.Tags, gateway.Metadata,
+        gateway.GatewayProfileID, gateway.Tags, gateway.Metadata, gateway.Labels,
+        gateway.Radios,
     )
     
     if err != nil {
@@ -54,7 +56,8 @@ func (s *PostgresStore) GetGateway(ctx context.Context, gatewayID lorawan.EUI64)
     query := `
         SELECT gateway_id, created_at, updated_at, tenant_id, name, description,
                location, model, min_frequency, max_frequency, last_seen_at,
-               first_seen_at, network_server_id, gateway_profile_id, tags, metadata
+               first_seen_at, network_server_id, gateway_profile_id, tags, metadata, labels,
+               radios
         FROM gateways
         WHERE gateway_id = $1`
     
@@ -66,7 +69,7 @@ func (s *PostgresStore) GetGateway(ctx context.Context, gatewayID lorawan.EUI64)
         &gateway.Name, &gateway.Description, &gateway.Location, &gateway.Model,
         &gateway.MinFrequency, &gateway.MaxFrequency, &gateway.LastSeenAt,
         &gateway.FirstSeenAt, &gateway.NetworkServerID, &gateway.GatewayProfileID,
-        &gateway.Tags, &gateway.Metadata,
+        &gateway.Tags, &gateway.Metadata, &gateway.Labels, &gateway.Radios,
     )
     
     if err == sql.ErrNoRows {
@@ -90,13 +93,15 @@ func (s *PostgresStore) UpdateGateway(ctx context.Context, gateway *models.Gatew
         UPDATE gateways SET
             updated_at = $2, name = $3, description = $4, location = $5,
             model = $6, min_frequency = $7, max_frequency = $8,
-            last_seen_at = $9, first_seen_at = $10, tags = $11, metadata = $12
+            last_seen_at = $9, first_seen_at = $10, tags = $11, metadata = $12,
+            labels = $13, radios = $14
         WHERE gateway_id = $1`
     
     result, err := s.getDB().ExecContext(ctx, query,
         gateway.GatewayID[:], gateway.UpdatedAt, gateway.Name, gateway.Description,
         gateway.Location, gateway.Model, gateway.MinFrequency, gateway.MaxFrequency,
         gateway.LastSeenAt, gateway.FirstSeenAt, gateway.Tags, gateway.Metadata,
+        gateway.Labels, gateway.Radios,
     )
     
     if err != nil {
@@ -134,13 +139,37 @@ func (s *PostgresStore) DeleteGateway(ctx context.Context, gatewayID lorawan.EUI
     return nil
 }
 
-// ListGateways lists gateways
-func (s *PostgresStore) ListGateways(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Gateway, int64, error) {
+// ListGateways lists gateways with filters
+func (s *PostgresStore) ListGateways(ctx context.Context, tenantID uuid.UUID, filters GatewayFilters, limit, offset int) ([]*models.Gateway, int64, error) {
+    where := " WHERE tenant_id = $1"
+    args := []interface{}{tenantID}
+    argCount := 1
+    
+    if filters.Online != nil {
+        argCount++
+        if *filters.Online {
+            where += fmt.Sprintf(" AND last_seen_at > $%d", argCount)
+        } else {
+            where += fmt.Sprintf(" AND (last_seen_at IS NULL OR last_seen_at <= $%d)", argCount)
+        }
+        args = append(args, filters.OnlineSince)
+    }
+    
+    if filters.LastSeenAfter != nil {
+        argCount++
+        where += fmt.Sprintf(" AND last_seen_at >= $%d", argCount)
+        args = append(args, *filters.LastSeenAfter)
+    }
+    
+    if filters.LastSeenBefore != nil {
+        argCount++
+        where += fmt.Sprintf(" AND last_seen_at <= $%d", argCount)
+        args = append(args, *filters.LastSeenBefore)
+    }
+    
     // Get count
     var count int64
-    err := s.getDB().QueryRowContext(ctx,
-        "SELECT COUNT(*) FROM gateways WHERE tenant_id = $1", tenantID,
-    ).Scan(&count)
+    err := s.getDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM gateways"+where, args...).Scan(&count)
     if err != nil {
         return nil, 0, err
     }
@@ -148,13 +177,18 @@ func (s *PostgresStore) ListGateways(ctx context.Context, tenantID uuid.UUID, li
     // Get rows
     query := `
         SELECT gateway_id, created_at, updated_at, tenant_id, name, description,
-               location, last_seen_at, first_seen_at
-        FROM gateways
-        WHERE tenant_id = $1
-        ORDER BY created_at DESC
-        LIMIT $2 OFFSET $3`
+               location, last_seen_at, first_seen_at, labels
+        FROM gateways` + where + " ORDER BY " + gatewayOrderBy(filters)
     
-    rows, err := s.getDB().QueryContext(ctx, query, tenantID, limit, offset)
+    argCount++
+    query += fmt.Sprintf(" LIMIT $%d", argCount)
+    args = append(args, limit)
+    
+    argCount++
+    query += fmt.Sprintf(" OFFSET $%d", argCount)
+    args = append(args, offset)
+    
+    rows, err := s.getDB().QueryContext(ctx, query, args...)
     if err != nil {
         return nil, 0, err
     }
@@ -168,7 +202,7 @@ func (s *PostgresStore) ListGateways(ctx context.Context, tenantID uuid.UUID, li
         err := rows.Scan(
             &gatewayIDBytes, &gateway.CreatedAt, &gateway.UpdatedAt, &gateway.TenantID,
             &gateway.Name, &gateway.Description, &gateway.Location,
-            &gateway.LastSeenAt, &gateway.FirstSeenAt,
+            &gateway.LastSeenAt, &gateway.FirstSeenAt, &gateway.Labels,
         )
         if err != nil {
             return nil, 0, err
@@ -180,3 +214,20 @@ func (s *PostgresStore) ListGateways(ctx context.Context, tenantID uuid.UUID, li
     
     return gateways, count, nil
 }
+
+// gatewayOrderBy builds the ORDER BY clause, never-seen gateways sort last
+func gatewayOrderBy(filters GatewayFilters) string {
+    dir := "ASC"
+    if filters.Desc {
+        dir = "DESC"
+    }
+    
+    switch filters.SortBy {
+    case GatewaySortLastSeen:
+        return "last_seen_at " + dir + " NULLS LAST, gateway_id"
+    case GatewaySortName:
+        return "name " + dir + ", gateway_id"
+    default:
+        return "created_at " + dir + ", gateway_id"
+    }
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// SaveGatewayStats saves the counters from one gateway stat frame
+func (s *PostgresStore) SaveGatewayStats(ctx context.Context, stats *models.GatewayStats) error {
+	if stats.ID == uuid.Nil {
+		stats.ID = uuid.New()
+	}
+	if stats.Time.IsZero() {
+		stats.Time = time.Now()
+	}
+
+	_, err := s.getDB().ExecContext(ctx, `
+        INSERT INTO gateway_stats (
+            id, gateway_id, time, rx_packets_received, rx_packets_valid,
+            tx_packets_emitted, latitude, longitude, metadata
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		stats.ID, stats.GatewayID[:], stats.Time, stats.RXPacketsReceived, stats.RXPacketsValid,
+		stats.TXPacketsEmitted, stats.Latitude, stats.Longitude, stats.Metadata,
+	)
+	return err
+}
+
+// GetGatewayStats returns the gateway's stats in [from, to) summed per interval bucket,
+// oldest first. Bucket times are aligned to the interval; empty buckets are omitted and
+// the location is the average reported in the bucket.
+func (s *PostgresStore) GetGatewayStats(ctx context.Context, gatewayID lorawan.EUI64, from, to time.Time, interval time.Duration) ([]*models.GatewayStats, error) {
+	rows, err := s.getDB().QueryContext(ctx, `
+        SELECT to_timestamp(floor(extract(epoch FROM time) / $4) * $4) AT TIME ZONE 'UTC' AS bucket,
+               SUM(rx_packets_received), SUM(rx_packets_valid), SUM(tx_packets_emitted),
+               AVG(latitude), AVG(longitude)
+        FROM gateway_stats
+        WHERE gateway_id = $1 AND time >= $2 AND time < $3
+        GROUP BY bucket
+        ORDER BY bucket`,
+		gatewayID[:], from, to, interval.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := make([]*models.GatewayStats, 0)
+	for rows.Next() {
+		stats := &models.GatewayStats{GatewayID: models.EUI64(gatewayID)}
+		if err := rows.Scan(
+			&stats.Time, &stats.RXPacketsReceived, &stats.RXPacketsValid, &stats.TXPacketsEmitted,
+			&stats.Latitude, &stats.Longitude,
+		); err != nil {
+			return nil, err
+		}
+		series = append(series, stats)
+	}
+	return series, rows.Err()
+}
+
+// DeleteGatewayStatsBefore deletes stats older than before and returns the number of rows deleted
+func (s *PostgresStore) DeleteGatewayStatsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.getDB().ExecContext(ctx, "DELETE FROM gateway_stats WHERE time < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// ========== MAC Command Queue Methods ==========
+
+// EnqueueMACCommand queues a MAC command for the device's next downlink
+func (s *PostgresStore) EnqueueMACCommand(ctx context.Context, item *models.MACCommandQueueItem) error {
+	if item.ID == uuid.Nil {
+		item.ID = uuid.New()
+	}
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+
+	_, err := s.getDB().ExecContext(ctx, `
+		INSERT INTO mac_command_queue (id, dev_eui, cid, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		item.ID, item.DevEUI[:], int16(item.CID), item.Payload, item.CreatedAt,
+	)
+	return err
+}
+
+// GetPendingMACCommands returns the queued MAC commands of a device, oldest first
+func (s *PostgresStore) GetPendingMACCommands(ctx context.Context, devEUI lorawan.EUI64) ([]*models.MACCommandQueueItem, error) {
+	rows, err := s.getDB().QueryContext(ctx, `
+		SELECT id, dev_eui, cid, payload, created_at
+		FROM mac_command_queue
+		WHERE dev_eui = $1
+		ORDER BY created_at`,
+		devEUI[:],
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.MACCommandQueueItem
+	for rows.Next() {
+		item := &models.MACCommandQueueItem{}
+		var devEUIBytes []byte
+		var cid int16
+		if err := rows.Scan(&item.ID, &devEUIBytes, &cid, &item.Payload, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		copy(item.DevEUI[:], devEUIBytes)
+		item.CID = uint8(cid)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// DeleteMACCommand removes a queued MAC command
+func (s *PostgresStore) DeleteMACCommand(ctx context.Context, id uuid.UUID) error {
+	result, err := s.getDB().ExecContext(ctx, "DELETE FROM mac_command_queue WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
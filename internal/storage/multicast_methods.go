@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// ========== Multicast Group Methods ==========
+
+const multicastGroupColumns = `g.id, g.created_at, g.updated_at, g.application_id, g.name,
+               g.mc_addr, g.mc_nwk_s_key, g.mc_app_s_key, g.f_cnt, g.group_type, g.dr, g.frequency,
+               ARRAY(SELECT d.dev_eui FROM multicast_group_devices d
+                     WHERE d.multicast_group_id = g.id ORDER BY d.dev_eui)`
+
+// scanMulticastGroup scans a row selected with multicastGroupColumns
+func scanMulticastGroup(row interface{ Scan(...interface{}) error }) (*models.MulticastGroup, error) {
+	group := &models.MulticastGroup{}
+	var mcAddr []byte
+	var devEUIs pq.ByteaArray
+	if err := row.Scan(
+		&group.ID, &group.CreatedAt, &group.UpdatedAt, &group.ApplicationID, &group.Name,
+		&mcAddr, &group.McNwkSKey, &group.McAppSKey, &group.FCnt, &group.GroupType, &group.DR, &group.Frequency,
+		&devEUIs,
+	); err != nil {
+		return nil, err
+	}
+
+	copy(group.McAddr[:], mcAddr)
+	group.DevEUIs = make([]models.EUI64, len(devEUIs))
+	for i, devEUI := range devEUIs {
+		copy(group.DevEUIs[i][:], devEUI)
+	}
+	return group, nil
+}
+
+// CreateMulticastGroup creates a multicast group and its member list in one transaction
+func (s *PostgresStore) CreateMulticastGroup(ctx context.Context, group *models.MulticastGroup) error {
+	if group.ID == uuid.Nil {
+		group.ID = uuid.New()
+	}
+
+	now := time.Now()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+
+	return s.withTx(ctx, func(store *PostgresStore) error {
+		_, err := store.getDB().ExecContext(ctx, `
+			INSERT INTO multicast_groups (
+				id, created_at, updated_at, application_id, name, mc_addr,
+				mc_nwk_s_key, mc_app_s_key, f_cnt, group_type, dr, frequency
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			group.ID, group.CreatedAt, group.UpdatedAt, group.ApplicationID, group.Name, group.McAddr[:],
+			group.McNwkSKey, group.McAppSKey, group.FCnt, group.GroupType, group.DR, group.Frequency,
+		)
+		if err != nil {
+			return multicastError(err)
+		}
+		return store.setMulticastGroupDevices(ctx, group)
+	})
+}
+
+// GetMulticastGroup gets a multicast group with its members
+func (s *PostgresStore) GetMulticastGroup(ctx context.Context, id uuid.UUID) (*models.MulticastGroup, error) {
+	query := `
+        SELECT ` + multicastGroupColumns + `
+        FROM multicast_groups g
+        WHERE g.id = $1`
+
+	group, err := scanMulticastGroup(s.getDB().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// ListMulticastGroups lists multicast groups by name, optionally only those of
+// one tenant's applications and of one application
+func (s *PostgresStore) ListMulticastGroups(ctx context.Context, tenantID, applicationID *uuid.UUID, limit, offset int) ([]*models.MulticastGroup, int64, error) {
+	var conds []string
+	args := []interface{}{}
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		conds = append(conds, fmt.Sprintf("g.application_id IN (SELECT id FROM applications WHERE tenant_id = $%d)", len(args)))
+	}
+	if applicationID != nil {
+		args = append(args, *applicationID)
+		conds = append(conds, fmt.Sprintf("g.application_id = $%d", len(args)))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var count int64
+	if err := s.getDB().QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM multicast_groups g "+where, args...,
+	).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+        SELECT ` + multicastGroupColumns + `
+        FROM multicast_groups g
+        ` + where + `
+        ORDER BY g.name` + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+
+	rows, err := s.getDB().QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var groups []*models.MulticastGroup
+	for rows.Next() {
+		group, err := scanMulticastGroup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, count, rows.Err()
+}
+
+// UpdateMulticastGroup updates a multicast group and replaces its members.
+// The frame counter is only advanced by NextMulticastGroupFCnt.
+func (s *PostgresStore) UpdateMulticastGroup(ctx context.Context, group *models.MulticastGroup) error {
+	group.UpdatedAt = time.Now()
+
+	return s.withTx(ctx, func(store *PostgresStore) error {
+		result, err := store.getDB().ExecContext(ctx, `
+			UPDATE multicast_groups SET
+				updated_at = $2, name = $3, mc_addr = $4, mc_nwk_s_key = $5,
+				mc_app_s_key = $6, group_type = $7, dr = $8, frequency = $9
+			WHERE id = $1`,
+			group.ID, group.UpdatedAt, group.Name, group.McAddr[:], group.McNwkSKey,
+			group.McAppSKey, group.GroupType, group.DR, group.Frequency,
+		)
+		if err != nil {
+			return multicastError(err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return store.setMulticastGroupDevices(ctx, group)
+	})
+}
+
+// DeleteMulticastGroup deletes a multicast group; its member list is removed by cascade
+func (s *PostgresStore) DeleteMulticastGroup(ctx context.Context, id uuid.UUID) error {
+	result, err := s.getDB().ExecContext(ctx, "DELETE FROM multicast_groups WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// NextMulticastGroupFCnt atomically takes the group's next downlink frame counter
+func (s *PostgresStore) NextMulticastGroupFCnt(ctx context.Context, id uuid.UUID) (uint32, error) {
+	var fCnt uint32
+	err := s.getDB().QueryRowContext(ctx, `
+		UPDATE multicast_groups SET f_cnt = f_cnt + 1
+		WHERE id = $1
+		RETURNING f_cnt - 1`, id,
+	).Scan(&fCnt)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return fCnt, nil
+}
+
+// setMulticastGroupDevices replaces the group's member list
+func (s *PostgresStore) setMulticastGroupDevices(ctx context.Context, group *models.MulticastGroup) error {
+	if _, err := s.getDB().ExecContext(ctx,
+		"DELETE FROM multicast_group_devices WHERE multicast_group_id = $1", group.ID,
+	); err != nil {
+		return err
+	}
+
+	for _, devEUI := range group.DevEUIs {
+		_, err := s.getDB().ExecContext(ctx, `
+			INSERT INTO multicast_group_devices (multicast_group_id, dev_eui, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`,
+			group.ID, devEUI[:], group.UpdatedAt,
+		)
+		if err != nil {
+			return multicastError(err)
+		}
+	}
+
+	return nil
+}
+
+// withTx runs fn in a transaction, or in the current one if the store is already transactional.
+// A transaction of its own is run again from the start on serialization failures and deadlocks,
+// so fn must not keep state across calls. In the current transaction the caller owns the retry.
+func (s *PostgresStore) withTx(ctx context.Context, fn func(store *PostgresStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	return retryTx(ctx, s.policy, s.breaker, func() error {
+		txStore, err := s.BeginTx(ctx)
+		if err != nil {
+			return err
+		}
+		store := txStore.(*PostgresStore)
+		defer store.Rollback()
+
+		if err := fn(store); err != nil {
+			return err
+		}
+		return store.Commit()
+	})
+}
+
+// multicastError maps constraint violations to storage errors
+func multicastError(err error) error {
+	switch {
+	case strings.Contains(err.Error(), "duplicate key"):
+		return ErrDuplicateKey
+	case strings.Contains(err.Error(), "foreign key"):
+		return ErrInvalidData
+	}
+	return err
+}
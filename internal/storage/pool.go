@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+// PoolConfig configures the database connection pool
+type PoolConfig struct {
+	MaxOpenConns    int           // upper bound on open connections
+	MaxIdleConns    int           // idle connections kept for reuse, never more than MaxOpenConns
+	ConnMaxLifetime time.Duration // connections older than this are closed and replaced
+}
+
+// DefaultPoolConfig returns the pool settings used when none are configured
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Hour,
+	}
+}
+
+// PoolConfigFromConfig builds pool settings from the database config, using defaults for unset values
+func PoolConfigFromConfig(cfg config.DatabaseConfig) PoolConfig {
+	pool := DefaultPoolConfig()
+	if cfg.MaxOpenConns > 0 {
+		pool.MaxOpenConns = cfg.MaxOpenConns
+	}
+	if cfg.MaxIdleConns > 0 {
+		pool.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if pool.MaxIdleConns > pool.MaxOpenConns {
+		pool.MaxIdleConns = pool.MaxOpenConns
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		pool.ConnMaxLifetime = cfg.ConnMaxLifetime
+	}
+	return pool
+}
+
+// SetPoolConfig applies connection pool limits to the underlying sql.DB
+func (s *PostgresStore) SetPoolConfig(pool PoolConfig) {
+	s.db.SetMaxOpenConns(pool.MaxOpenConns)
+	s.db.SetMaxIdleConns(pool.MaxIdleConns)
+	s.db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+}
+
+// PoolStats are connection pool counters exposed for monitoring
+type PoolStats struct {
+	MaxOpen           int     `json:"maxOpen"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"inUse"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"waitCount"`
+	WaitDurationMs    float64 `json:"waitDurationMs"`
+	MaxIdleClosed     int64   `json:"maxIdleClosed"`
+	MaxLifetimeClosed int64   `json:"maxLifetimeClosed"`
+}
+
+// PoolStats returns the current connection pool counters
+func (s *PostgresStore) PoolStats() PoolStats {
+	st := s.db.Stats()
+	return PoolStats{
+		MaxOpen:           st.MaxOpenConnections,
+		Open:              st.OpenConnections,
+		InUse:             st.InUse,
+		Idle:              st.Idle,
+		WaitCount:         st.WaitCount,
+		WaitDurationMs:    float64(st.WaitDuration) / float64(time.Millisecond),
+		MaxIdleClosed:     st.MaxIdleClosed,
+		MaxLifetimeClosed: st.MaxLifetimeClosed,
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+// poolTestDriver hands out connections that do nothing, so pool behavior can be observed without a database
+type poolTestDriver struct{}
+
+func (poolTestDriver) Open(string) (driver.Conn, error) { return poolTestConn{}, nil }
+
+type poolTestConn struct{}
+
+func (poolTestConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (poolTestConn) Close() error                        { return nil }
+func (poolTestConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("pooltest", poolTestDriver{})
+}
+
+func TestPoolConfigFromConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.DatabaseConfig
+		want PoolConfig
+	}{
+		{"defaults", config.DatabaseConfig{}, DefaultPoolConfig()},
+		{"configured", config.DatabaseConfig{MaxOpenConns: 50, MaxIdleConns: 10, ConnMaxLifetime: 5 * time.Minute}, PoolConfig{50, 10, 5 * time.Minute}},
+		{"idle capped at open", config.DatabaseConfig{MaxOpenConns: 4, MaxIdleConns: 10}, PoolConfig{4, 4, time.Hour}},
+		{"default idle capped at small open", config.DatabaseConfig{MaxOpenConns: 2}, PoolConfig{2, 2, time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PoolConfigFromConfig(tt.cfg); got != tt.want {
+				t.Errorf("PoolConfigFromConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPoolConfigLimitsConnections(t *testing.T) {
+	db, err := sql.Open("pooltest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &PostgresStore{db: db}
+	s.SetPoolConfig(PoolConfig{MaxOpenConns: 3, MaxIdleConns: 1, ConnMaxLifetime: time.Hour})
+
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+	}
+
+	// A fourth connection has to wait for one to be released
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.Conn(waitCtx); err == nil {
+		t.Fatal("opened more connections than MaxOpenConns")
+	}
+
+	stats := s.PoolStats()
+	if stats.MaxOpen != 3 || stats.Open != 3 || stats.InUse != 3 || stats.WaitCount != 1 || stats.WaitDurationMs <= 0 {
+		t.Errorf("PoolStats() with all connections in use = %+v", stats)
+	}
+
+	// Only MaxIdleConns connections are kept once released
+	for _, c := range conns {
+		c.Close()
+	}
+	stats = s.PoolStats()
+	if stats.Open != 1 || stats.Idle != 1 || stats.InUse != 0 || stats.MaxIdleClosed != 2 {
+		t.Errorf("PoolStats() after release = %+v", stats)
+	}
+}
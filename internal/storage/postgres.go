@@ -12,6 +12,9 @@ import (
 type PostgresStore struct {
 	db *sql.DB
 	tx *sql.Tx
+
+	policy  RetryPolicy
+	breaker *circuitBreaker
 }
 
 // NewPostgresStore creates a new PostgreSQL store
@@ -25,7 +28,19 @@ func NewPostgresStore(dsn string) (*PostgresStore, error) {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
-	return &PostgresStore{db: db}, nil
+	policy := DefaultRetryPolicy()
+	return &PostgresStore{db: db, policy: policy, breaker: newCircuitBreaker(policy)}, nil
+}
+
+// SetRetryPolicy replaces the retry and circuit breaker settings
+func (s *PostgresStore) SetRetryPolicy(policy RetryPolicy) {
+	s.policy = policy
+	s.breaker = newCircuitBreaker(policy)
+}
+
+// ResilienceStats returns retry and circuit breaker counters
+func (s *PostgresStore) ResilienceStats() ResilienceStats {
+	return s.breaker.stats()
 }
 
 // Close closes the database connection
@@ -35,11 +50,15 @@ func (s *PostgresStore) Close() error {
 
 // BeginTx starts a new transaction
 func (s *PostgresStore) BeginTx(ctx context.Context) (Store, error) {
+	if !s.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
+	s.breaker.record(err)
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresStore{db: s.db, tx: tx}, nil
+	return &PostgresStore{db: s.db, tx: tx, policy: s.policy, breaker: s.breaker}, nil
 }
 
 // Commit commits the transaction
@@ -58,14 +77,21 @@ func (s *PostgresStore) Rollback() error {
 	return s.tx.Rollback()
 }
 
-// getDB returns tx if in transaction, otherwise db
+// getDB returns tx if in transaction, otherwise db.
+// Calls outside a transaction retry transient errors; calls inside one are retried
+// only as a whole by withTx. All calls go through the circuit breaker.
 func (s *PostgresStore) getDB() interface {
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
-	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) rowScanner
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 } {
 	if s.tx != nil {
-		return s.tx
+		return &resilientConn{conn: s.tx, breaker: s.breaker, inTx: true}
+	}
+	return &resilientConn{
+		conn:    s.db,
+		breaker: s.breaker,
+		retries: s.policy.MaxRetries,
+		backoff: s.policy.Backoff,
 	}
-	return s.db
 }
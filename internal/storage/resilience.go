@@ -0,0 +1,415 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+// ErrCircuitOpen is returned while the database circuit breaker is open
+var ErrCircuitOpen = errors.New("database circuit breaker open")
+
+// RetryPolicy configures retries and the circuit breaker for database calls
+type RetryPolicy struct {
+	MaxRetries       int           // retries after the first attempt for transient errors, negative disables
+	Backoff          time.Duration // delay before the first retry, doubled after each retry
+	BreakerThreshold int           // consecutive transient failures before the breaker opens, negative disables
+	BreakerCooldown  time.Duration // how long the breaker stays open before a trial call
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:       2,
+		Backoff:          50 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  10 * time.Second,
+	}
+}
+
+// RetryPolicyFromConfig builds a policy from the database config, using defaults for unset values
+func RetryPolicyFromConfig(cfg config.DatabaseConfig) RetryPolicy {
+	policy := DefaultRetryPolicy()
+	if cfg.MaxRetries != 0 {
+		policy.MaxRetries = cfg.MaxRetries
+	}
+	if cfg.RetryBackoff != 0 {
+		policy.Backoff = cfg.RetryBackoff
+	}
+	if cfg.BreakerThreshold != 0 {
+		policy.BreakerThreshold = cfg.BreakerThreshold
+	}
+	if cfg.BreakerCooldown != 0 {
+		policy.BreakerCooldown = cfg.BreakerCooldown
+	}
+	return policy
+}
+
+// ResilienceStats are counters exposed for monitoring
+type ResilienceStats struct {
+	Retries        uint64 `json:"retries"`
+	TransientFails uint64 `json:"transientFailures"`
+	Rejected       uint64 `json:"rejected"`
+	BreakerOpens   uint64 `json:"breakerOpens"`
+	BreakerOpen    bool   `json:"breakerOpen"`
+}
+
+// RegisterResilienceMetrics registers the counters returned by stats with the default
+// Prometheus registry under namespace, read on every scrape
+func RegisterResilienceMetrics(namespace string, stats func() ResilienceStats) {
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_retries_total",
+		Help:      "Database calls retried after a transient error.",
+	}, func() float64 { return float64(stats().Retries) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_transient_failures_total",
+		Help:      "Database calls that failed with a transient error.",
+	}, func() float64 { return float64(stats().TransientFails) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_breaker_rejections_total",
+		Help:      "Database calls rejected while the circuit breaker was open.",
+	}, func() float64 { return float64(stats().Rejected) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_breaker_opens_total",
+		Help:      "Times the database circuit breaker opened.",
+	}, func() float64 { return float64(stats().BreakerOpens) })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_breaker_open",
+		Help:      "1 while the database circuit breaker is open, 0 otherwise.",
+	}, func() float64 {
+		if stats().BreakerOpen {
+			return 1
+		}
+		return 0
+	})
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker fails fast after repeated transient failures
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+
+	threshold int
+	cooldown  time.Duration
+
+	retries        uint64
+	transientFails uint64
+	rejected       uint64
+	opens          uint64
+}
+
+func newCircuitBreaker(policy RetryPolicy) *circuitBreaker {
+	return &circuitBreaker{threshold: policy.BreakerThreshold, cooldown: policy.BreakerCooldown}
+}
+
+// allow reports whether a call may proceed
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			atomic.AddUint64(&b.rejected, 1)
+			return false
+		}
+		// 冷却结束，放行一次试探请求
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		atomic.AddUint64(&b.rejected, 1)
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call
+func (b *circuitBreaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isTransientError(err) {
+		if b.state != breakerClosed {
+			log.Info().Msg("数据库恢复，熔断器关闭")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	atomic.AddUint64(&b.transientFails, 1)
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			atomic.AddUint64(&b.opens, 1)
+			log.Error().
+				Err(err).
+				Int("failures", b.failures).
+				Dur("cooldown", b.cooldown).
+				Msg("数据库连续失败，熔断器打开")
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) stats() ResilienceStats {
+	b.mu.Lock()
+	open := b.state == breakerOpen
+	b.mu.Unlock()
+
+	return ResilienceStats{
+		Retries:        atomic.LoadUint64(&b.retries),
+		TransientFails: atomic.LoadUint64(&b.transientFails),
+		Rejected:       atomic.LoadUint64(&b.rejected),
+		BreakerOpens:   atomic.LoadUint64(&b.opens),
+		BreakerOpen:    open,
+	}
+}
+
+// isTransientError reports whether err is worth retrying. A canceled or expired
+// context is the caller giving up, not the database failing; context.DeadlineExceeded
+// would otherwise match net.Error below.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08": // connection exception
+			return true
+		case pqErr.Code == "57P01", pqErr.Code == "57P03": // admin shutdown, cannot connect now
+			return true
+		case pqErr.Code == "40001", pqErr.Code == "40P01": // serialization failure, deadlock
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isReadOnly reports whether query only reads, so running it a second time is harmless
+func isReadOnly(query string) bool {
+	q := strings.TrimSpace(query)
+	return len(q) >= 6 && strings.EqualFold(q[:6], "SELECT")
+}
+
+// isNotAppliedError reports whether err proves the statement was not applied: the
+// connection could not be established, or the server rolled the statement back.
+// Only such errors are retried for writes; after a reset mid-statement the server
+// may already have applied it. Inside a transaction the server rolls back the whole
+// transaction, not the statement, so there only retryTx may act on them.
+func isNotAppliedError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "08001", "08004", "57P03": // cannot establish connection, rejected, cannot connect now
+			return true
+		case "40001", "40P01": // serialization failure, deadlock: rolled back by the server
+			return true
+		}
+	}
+	return false
+}
+
+// isTxRetryableError reports whether err aborted the whole transaction in a way that
+// makes running it again from the start worthwhile
+func isTxRetryableError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01" // serialization failure, deadlock
+	}
+	return false
+}
+
+// retryTx runs fn, which must begin, run and commit one transaction, again from the
+// start while it fails with a serialization failure or deadlock
+func retryTx(ctx context.Context, policy RetryPolicy, breaker *circuitBreaker, fn func() error) error {
+	delay := policy.Backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isTxRetryableError(err) || attempt >= policy.MaxRetries {
+			return err
+		}
+
+		atomic.AddUint64(&breaker.retries, 1)
+		log.Warn().Err(err).Int("attempt", attempt+1).Msg("事务冲突，重新执行事务")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// sqlConn is implemented by both *sql.DB and *sql.Tx
+type sqlConn interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// rowScanner is the part of *sql.Row used by the store
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// errRow is returned instead of *sql.Row when the call never reached the database
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+// resilientConn wraps a connection with retries and the circuit breaker
+type resilientConn struct {
+	conn    sqlConn
+	breaker *circuitBreaker
+	retries int
+	backoff time.Duration
+	inTx    bool // conn is a *sql.Tx, statements are never retried
+}
+
+// do runs fn through the circuit breaker, retrying transient errors. Statements that
+// may write are only retried when the error proves they were not applied.
+func (c *resilientConn) do(ctx context.Context, query string, fn func() error) error {
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	if c.inTx {
+		// 事务绑定单个连接，出错后事务已中止，只能由 retryTx 整体重跑
+		err := fn()
+		c.breaker.record(err)
+		return err
+	}
+
+	retryable := isNotAppliedError
+	if isReadOnly(query) {
+		retryable = isTransientError
+	}
+
+	delay := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		c.breaker.record(err)
+		if err == nil || !retryable(err) || attempt >= c.retries {
+			return err
+		}
+
+		atomic.AddUint64(&c.breaker.retries, 1)
+		log.Warn().Err(err).Int("attempt", attempt+1).Msg("数据库临时错误，重试")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+
+		if !c.breaker.allow() {
+			return ErrCircuitOpen
+		}
+	}
+}
+
+func (c *resilientConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := c.do(ctx, query, func() error {
+		var err error
+		rows, err = c.conn.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (c *resilientConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) rowScanner {
+	var row *sql.Row
+	err := c.do(ctx, query, func() error {
+		row = c.conn.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	if row == nil {
+		return errRow{err: err}
+	}
+	return row
+}
+
+func (c *resilientConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := c.do(ctx, query, func() error {
+		var err error
+		result, err = c.conn.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+)
+
+var errPermanent = errors.New("syntax error")
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bad conn", driver.ErrBadConn, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"pq connection exception", &pq.Error{Code: "08006"}, true},
+		{"pq admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"pq deadlock", &pq.Error{Code: "40P01"}, true},
+		{"pq unique violation", &pq.Error{Code: "23505"}, false},
+		{"net error", &net.OpError{Op: "read", Err: errors.New("timeout")}, true},
+		{"context canceled", context.Canceled, false},
+		{"context deadline exceeded", context.DeadlineExceeded, false},
+		{"wrapped deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"permanent", errPermanent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.want {
+				t.Errorf("isTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNotAppliedError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad conn", driver.ErrBadConn, true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("no route")}, true},
+		{"reset mid-statement", syscall.ECONNRESET, false},
+		{"read timeout", &net.OpError{Op: "read", Err: errors.New("timeout")}, false},
+		{"pq cannot connect now", &pq.Error{Code: "57P03"}, true},
+		{"pq serialization failure", &pq.Error{Code: "40001"}, true},
+		{"pq connection failure", &pq.Error{Code: "08006"}, false},
+		{"permanent", errPermanent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotAppliedError(tt.err); got != tt.want {
+				t.Errorf("isNotAppliedError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestConn(retries, threshold int) *resilientConn {
+	return &resilientConn{
+		breaker: newCircuitBreaker(RetryPolicy{BreakerThreshold: threshold, BreakerCooldown: time.Hour}),
+		retries: retries,
+		backoff: time.Millisecond,
+	}
+}
+
+func TestResilientConnRetries(t *testing.T) {
+	const read = "SELECT 1"
+	const write = "UPDATE devices SET name = $1"
+
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		failures int // fn fails this many times before succeeding
+		calls    int
+		wantErr  bool
+	}{
+		{"success", read, nil, 0, 1, false},
+		{"transient read recovers", read, syscall.ECONNRESET, 2, 3, false},
+		{"transient read exhausts retries", read, syscall.ECONNRESET, 5, 3, true},
+		{"permanent read is not retried", read, errPermanent, 5, 1, true},
+		{"read past the deadline is not retried", read, context.DeadlineExceeded, 5, 1, true},
+		{"write not sent is retried", write, driver.ErrBadConn, 1, 2, false},
+		{"write reset is not retried", write, syscall.ECONNRESET, 5, 1, true},
+		{"permanent write is not retried", write, errPermanent, 5, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConn(2, -1)
+			calls := 0
+			err := c.do(context.Background(), tt.query, func() error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("fn called %d times, want %d", calls, tt.calls)
+			}
+			if got := c.breaker.stats().Retries; got != uint64(tt.calls-1) {
+				t.Errorf("Retries = %d, want %d", got, tt.calls-1)
+			}
+		})
+	}
+}
+
+func TestResilientConnInTxDoesNotRetry(t *testing.T) {
+	for _, err := range []error{syscall.ECONNRESET, driver.ErrBadConn, &pq.Error{Code: "40001"}} {
+		c := newTestConn(2, -1)
+		c.inTx = true
+		calls := 0
+		c.do(context.Background(), "SELECT 1", func() error { calls++; return err })
+		if calls != 1 {
+			t.Errorf("%v: fn called %d times in a transaction, want 1", err, calls)
+		}
+	}
+}
+
+func TestRetryTx(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failures int // the transaction fails this many times before committing
+		calls    int
+		wantErr  bool
+	}{
+		{"success", nil, 0, 1, false},
+		{"serialization failure reruns", &pq.Error{Code: "40001"}, 1, 2, false},
+		{"deadlock reruns", fmt.Errorf("purge devices: %w", &pq.Error{Code: "40P01"}), 2, 3, false},
+		{"conflict exhausts retries", &pq.Error{Code: "40001"}, 5, 3, true},
+		{"unique violation is not rerun", &pq.Error{Code: "23505"}, 5, 1, true},
+		{"connection reset is not rerun", syscall.ECONNRESET, 5, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+			breaker := newCircuitBreaker(policy)
+			calls := 0
+			err := retryTx(context.Background(), policy, breaker, func() error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retryTx() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("transaction run %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	c := newTestConn(0, 3)
+	fail := func() error { return syscall.ECONNREFUSED }
+
+	for i := 0; i < 3; i++ {
+		if err := c.do(context.Background(), "SELECT 1", fail); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("call %d: err = %v", i, err)
+		}
+	}
+
+	called := false
+	err := c.do(context.Background(), "SELECT 1", func() error { called = true; return nil })
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Fatalf("open breaker: err = %v, called = %v", err, called)
+	}
+
+	stats := c.breaker.stats()
+	if !stats.BreakerOpen || stats.BreakerOpens != 1 || stats.Rejected != 1 || stats.TransientFails != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestCircuitBreakerPermanentErrorsKeepItClosed(t *testing.T) {
+	c := newTestConn(0, 2)
+	for i := 0; i < 5; i++ {
+		c.do(context.Background(), "SELECT 1", func() error { return errPermanent })
+	}
+	if stats := c.breaker.stats(); stats.BreakerOpen || stats.TransientFails != 0 {
+		t.Errorf("stats = %+v, want breaker closed", stats)
+	}
+}
+
+func TestCircuitBreakerIgnoresContextErrors(t *testing.T) {
+	c := newTestConn(0, 2)
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded, context.DeadlineExceeded} {
+		c.do(context.Background(), "SELECT 1", func() error { return err })
+	}
+	if stats := c.breaker.stats(); stats.BreakerOpen || stats.TransientFails != 0 {
+		t.Errorf("stats = %+v, want breaker closed", stats)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := newCircuitBreaker(RetryPolicy{BreakerThreshold: 1, BreakerCooldown: time.Millisecond})
+	b.record(syscall.ECONNREFUSED)
+	if b.allow() {
+		t.Fatal("breaker allowed a call right after opening")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker rejected the trial call after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("breaker allowed a second call while half open")
+	}
+
+	b.record(nil)
+	if !b.allow() || b.stats().BreakerOpen {
+		t.Error("successful trial call did not close the breaker")
+	}
+}
+
+func TestRetryPolicyFromConfigDefaults(t *testing.T) {
+	if got, want := RetryPolicyFromConfig(config.DatabaseConfig{}), DefaultRetryPolicy(); got != want {
+		t.Errorf("unset config = %+v, want defaults %+v", got, want)
+	}
+	if got := RetryPolicyFromConfig(config.DatabaseConfig{MaxRetries: -1}); got.MaxRetries != -1 {
+		t.Errorf("MaxRetries = %d, want -1", got.MaxRetries)
+	}
+}
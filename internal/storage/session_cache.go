@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+// defaultSessionCacheTTL is used when network.device_session_ttl is not set
+const defaultSessionCacheTTL = 31 * 24 * time.Hour
+
+// Redis keys: the session JSON by DevEUI, the set of DevEUIs using a DevAddr, and a
+// marker set when that set was filled from a full load of the underlying store
+const (
+	sessionKeyPrefix            = "lorawan:ds:"
+	sessionDevAddrKeyPrefix     = "lorawan:ds:addr:"
+	sessionDevAddrFullKeyPrefix = "lorawan:ds:addr-full:"
+)
+
+// SessionCacheStore is a write-through Redis cache for device sessions in front of
+// another Store. Sessions are cached by DevEUI and DevAddr with a TTL; a miss or a
+// Redis error falls back to the underlying store, which stays authoritative.
+// All other methods, and session writes inside BeginTx, go straight to the underlying store.
+type SessionCacheStore struct {
+	Store
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewSessionCacheStore connects to Redis and wraps store; ttl <= 0 uses 31 days
+func NewSessionCacheStore(store Store, cfg config.RedisConfig, ttl time.Duration) (*SessionCacheStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ping redis: %w", err)
+	}
+
+	if ttl <= 0 {
+		ttl = defaultSessionCacheTTL
+	}
+	return &SessionCacheStore{Store: store, client: client, ttl: ttl}, nil
+}
+
+// WithSessionCache wraps store with the Redis session cache when redis.addr is configured,
+// using network.device_session_ttl. If Redis cannot be reached, store is returned unchanged.
+func WithSessionCache(store Store, cfg *config.Config) Store {
+	if cfg.Redis.Addr == "" {
+		return store
+	}
+
+	cached, err := NewSessionCacheStore(store, cfg.Redis, cfg.Network.DeviceSessionTTL)
+	if err != nil {
+		log.Warn().Err(err).Str("addr", cfg.Redis.Addr).Msg("连接 Redis 失败，设备会话直接读写数据库")
+		return store
+	}
+	log.Info().Str("addr", cfg.Redis.Addr).Dur("ttl", cached.ttl).Msg("设备会话使用 Redis 缓存")
+	return cached
+}
+
+// Close closes the Redis client and the underlying store
+func (s *SessionCacheStore) Close() error {
+	s.client.Close()
+	return s.Store.Close()
+}
+
+// GetDeviceSession reads the session from Redis, loading it from the underlying store on a miss
+func (s *SessionCacheStore) GetDeviceSession(ctx context.Context, devEUI lorawan.EUI64) (*models.DeviceSession, error) {
+	if session, ok := s.getCached(ctx, hex.EncodeToString(devEUI[:])); ok {
+		return session, nil
+	}
+
+	session, err := s.Store.GetDeviceSession(ctx, devEUI)
+	if err != nil {
+		return nil, err
+	}
+	s.cache(ctx, session)
+	return session, nil
+}
+
+// GetDeviceSessionByDevAddr reads the sessions using devAddr from Redis. The DevAddr index
+// is only trusted after all sessions using devAddr were loaded from the underlying store;
+// until then, or if any of its sessions is missing, they are loaded from the underlying store.
+func (s *SessionCacheStore) GetDeviceSessionByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.DeviceSession, error) {
+	if sessions, ok := s.getCachedByDevAddr(ctx, devAddr); ok {
+		return sessions, nil
+	}
+
+	sessions, err := s.Store.GetDeviceSessionByDevAddr(ctx, devAddr)
+	if err != nil {
+		return nil, err
+	}
+	complete := true
+	for _, session := range sessions {
+		if !s.cache(ctx, session) {
+			complete = false
+		}
+	}
+	if complete && len(sessions) > 0 {
+		fullKey := sessionDevAddrFullKeyPrefix + hex.EncodeToString(devAddr[:])
+		if err := s.client.Set(ctx, fullKey, 1, s.ttl).Err(); err != nil {
+			log.Warn().Err(err).Str("devAddr", devAddr.String()).Msg("写入 Redis DevAddr 索引标记失败")
+		}
+	}
+	return sessions, nil
+}
+
+// SaveDeviceSession saves to the underlying store, then updates the cache
+func (s *SessionCacheStore) SaveDeviceSession(ctx context.Context, session *models.DeviceSession) error {
+	if err := s.Store.SaveDeviceSession(ctx, session); err != nil {
+		return err
+	}
+	s.cache(ctx, session)
+	return nil
+}
+
+// AdvanceDeviceSessionFCntUp advances the counter in the underlying store and evicts the
+// cached session, whose FCntUp is now stale until the next save
+func (s *SessionCacheStore) AdvanceDeviceSessionFCntUp(ctx context.Context, devEUI lorawan.EUI64, last uint32, received bool, fCnt uint32) (bool, error) {
+	ok, err := s.Store.AdvanceDeviceSessionFCntUp(ctx, devEUI, last, received, fCnt)
+	s.evict(ctx, devEUI)
+	return ok, err
+}
+
+// DeleteDeviceSession deletes from the underlying store and evicts the cached session
+func (s *SessionCacheStore) DeleteDeviceSession(ctx context.Context, devEUI lorawan.EUI64) error {
+	err := s.Store.DeleteDeviceSession(ctx, devEUI)
+	s.evict(ctx, devEUI)
+	return err
+}
+
+// DeleteDevice deletes the device and evicts its cached session
+func (s *SessionCacheStore) DeleteDevice(ctx context.Context, devEUI lorawan.EUI64) error {
+	err := s.Store.DeleteDevice(ctx, devEUI)
+	s.evict(ctx, devEUI)
+	return err
+}
+
+// PurgeDevice purges the device and evicts its cached session
+func (s *SessionCacheStore) PurgeDevice(ctx context.Context, devEUI lorawan.EUI64) (map[string]int64, error) {
+	counts, err := s.Store.PurgeDevice(ctx, devEUI)
+	s.evict(ctx, devEUI)
+	return counts, err
+}
+
+// PoolStats forwards the underlying store's connection pool statistics
+func (s *SessionCacheStore) PoolStats() PoolStats {
+	if pool, ok := s.Store.(interface{ PoolStats() PoolStats }); ok {
+		return pool.PoolStats()
+	}
+	return PoolStats{}
+}
+
+// ResilienceStats forwards the underlying store's retry and circuit breaker counters
+func (s *SessionCacheStore) ResilienceStats() ResilienceStats {
+	if rs, ok := s.Store.(interface{ ResilienceStats() ResilienceStats }); ok {
+		return rs.ResilienceStats()
+	}
+	return ResilienceStats{}
+}
+
+func (s *SessionCacheStore) getCached(ctx context.Context, devEUIHex string) (*models.DeviceSession, bool) {
+	data, err := s.client.Get(ctx, sessionKeyPrefix+devEUIHex).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Warn().Err(err).Str("devEUI", devEUIHex).Msg("读取 Redis 设备会话失败，回退数据库")
+		}
+		return nil, false
+	}
+
+	var session models.DeviceSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, false
+	}
+	return &session, true
+}
+
+func (s *SessionCacheStore) getCachedByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.DeviceSession, bool) {
+	addrHex := hex.EncodeToString(devAddr[:])
+	// 索引只由单个会话写入时可能缺少同一 DevAddr 的其他设备，未经完整加载不使用
+	full, err := s.client.Exists(ctx, sessionDevAddrFullKeyPrefix+addrHex).Result()
+	if err != nil || full == 0 {
+		if err != nil {
+			log.Warn().Err(err).Str("devAddr", devAddr.String()).Msg("读取 Redis DevAddr 索引失败，回退数据库")
+		}
+		return nil, false
+	}
+
+	devEUIs, err := s.client.SMembers(ctx, sessionDevAddrKeyPrefix+addrHex).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("devAddr", devAddr.String()).Msg("读取 Redis DevAddr 索引失败，回退数据库")
+		return nil, false
+	}
+	if len(devEUIs) == 0 {
+		return nil, false
+	}
+
+	sessions := make([]*models.DeviceSession, 0, len(devEUIs))
+	for _, devEUIHex := range devEUIs {
+		session, ok := s.getCached(ctx, devEUIHex)
+		if !ok {
+			return nil, false
+		}
+		// 重新入网后设备换了 DevAddr，旧索引中的成员在下次保存时移除
+		if lorawan.DevAddr(session.DevAddr) != devAddr {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	if len(sessions) == 0 {
+		return nil, false
+	}
+	return sessions, true
+}
+
+// cache writes the session and its DevAddr index, dropping the device from the index
+// of its previous DevAddr. On failure the session is evicted so a stale copy is never served
+// and false is returned.
+func (s *SessionCacheStore) cache(ctx context.Context, session *models.DeviceSession) bool {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return false
+	}
+	devEUIHex := hex.EncodeToString(session.DevEUI[:])
+	addrKey := sessionDevAddrKeyPrefix + hex.EncodeToString(session.DevAddr[:])
+
+	var oldAddrKey string
+	if old, ok := s.getCached(ctx, devEUIHex); ok && old.DevAddr != session.DevAddr {
+		oldAddrKey = sessionDevAddrKeyPrefix + hex.EncodeToString(old.DevAddr[:])
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKeyPrefix+devEUIHex, data, s.ttl)
+		pipe.SAdd(ctx, addrKey, devEUIHex)
+		pipe.Expire(ctx, addrKey, s.ttl)
+		if oldAddrKey != "" {
+			pipe.SRem(ctx, oldAddrKey, devEUIHex)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("devEUI", devEUIHex).Msg("写入 Redis 设备会话失败")
+		s.client.Del(ctx, sessionDevAddrFullKeyPrefix+hex.EncodeToString(session.DevAddr[:]))
+		s.evict(ctx, lorawan.EUI64(session.DevEUI))
+		return false
+	}
+	return true
+}
+
+// evict removes the cached session and its DevAddr index entry. The session may still
+// exist in the underlying store, so the index is no longer complete until the next full load.
+func (s *SessionCacheStore) evict(ctx context.Context, devEUI lorawan.EUI64) {
+	devEUIHex := hex.EncodeToString(devEUI[:])
+	if old, ok := s.getCached(ctx, devEUIHex); ok {
+		addrHex := hex.EncodeToString(old.DevAddr[:])
+		s.client.Del(ctx, sessionDevAddrFullKeyPrefix+addrHex)
+		s.client.SRem(ctx, sessionDevAddrKeyPrefix+addrHex, devEUIHex)
+	}
+	if err := s.client.Del(ctx, sessionKeyPrefix+devEUIHex).Err(); err != nil {
+		log.Error().Err(err).Str("devEUI", devEUIHex).Msg("删除 Redis 设备会话失败")
+	}
+}
@@ -0,0 +1,1288 @@
+// Package storagetest provides an in-memory storage.Store for tests. It keeps the
+// semantics callers rely on (ErrNotFound, pending queues in creation order, the
+// conditional FCntUp advance, monotonic JoinNonces) without a database. Values are
+// copied on the way in and out, so callers cannot modify stored rows by accident.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+	"github.com/lorawan-server/lorawan-server-pro/internal/storage"
+	"github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
+)
+
+const maxJoinNonce = 1<<24 - 1
+
+type devNonceKey struct {
+	joinEUI, devEUI lorawan.EUI64
+	devNonce        uint16
+}
+
+// MemoryStore is an in-memory storage.Store; the zero value is not usable, use New
+type MemoryStore struct {
+	mu sync.Mutex
+
+	users        map[uuid.UUID]*models.User
+	tenants      map[uuid.UUID]*models.Tenant
+	applications map[uuid.UUID]*models.Application
+	devices      map[lorawan.EUI64]*models.Device
+	joinNonces   map[lorawan.EUI64]uint32
+	keys         map[lorawan.EUI64]*models.DeviceKeys
+	sessions     map[lorawan.EUI64]*models.DeviceSession
+	devNonces    map[devNonceKey]struct{}
+	macCommands  []*models.MACCommandQueueItem
+	gateways     map[lorawan.EUI64]*models.Gateway
+	gatewayStats []*models.GatewayStats
+	profiles     map[uuid.UUID]*models.DeviceProfile
+	uplinks      []*models.UplinkFrame
+	downlinks    []*models.DownlinkFrame
+	templates    map[uuid.UUID]*models.DownlinkTemplate
+	multicast    map[uuid.UUID]*models.MulticastGroup
+	events       []*models.EventLog
+	frameLogs    []*models.FrameLog
+}
+
+var _ storage.Store = (*MemoryStore)(nil)
+
+// New returns an empty store
+func New() *MemoryStore {
+	return &MemoryStore{
+		users:        make(map[uuid.UUID]*models.User),
+		tenants:      make(map[uuid.UUID]*models.Tenant),
+		applications: make(map[uuid.UUID]*models.Application),
+		devices:      make(map[lorawan.EUI64]*models.Device),
+		joinNonces:   make(map[lorawan.EUI64]uint32),
+		keys:         make(map[lorawan.EUI64]*models.DeviceKeys),
+		sessions:     make(map[lorawan.EUI64]*models.DeviceSession),
+		devNonces:    make(map[devNonceKey]struct{}),
+		gateways:     make(map[lorawan.EUI64]*models.Gateway),
+		profiles:     make(map[uuid.UUID]*models.DeviceProfile),
+		templates:    make(map[uuid.UUID]*models.DownlinkTemplate),
+		multicast:    make(map[uuid.UUID]*models.MulticastGroup),
+	}
+}
+
+func newID(id uuid.UUID) uuid.UUID {
+	if id == uuid.Nil {
+		return uuid.New()
+	}
+	return id
+}
+
+func touch(created, updated *time.Time) {
+	now := time.Now()
+	if created.IsZero() {
+		*created = now
+	}
+	*updated = now
+}
+
+// page applies limit and offset the way the SQL store does; limit <= 0 returns everything
+func page(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit > 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// ========== Transactions ==========
+
+// BeginTx returns the store itself; writes are applied immediately
+func (s *MemoryStore) BeginTx(ctx context.Context) (storage.Store, error) { return s, nil }
+
+// Commit is a no-op
+func (s *MemoryStore) Commit() error { return nil }
+
+// Rollback is a no-op
+func (s *MemoryStore) Rollback() error { return nil }
+
+// Close is a no-op
+func (s *MemoryStore) Close() error { return nil }
+
+// ========== Users ==========
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.ID = newID(user.ID)
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return storage.ErrDuplicateKey
+		}
+	}
+	touch(&user.CreatedAt, &user.UpdatedAt)
+	u := *user
+	s.users[user.ID] = &u
+	return nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[user.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	user.UpdatedAt = time.Now()
+	u := *user
+	s.users[user.ID] = &u
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *MemoryStore) ListUsers(ctx context.Context, tenantID *uuid.UUID, limit, offset int) ([]*models.User, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []*models.User
+	for _, u := range s.users {
+		if tenantID == nil || (u.TenantID != nil && *u.TenantID == *tenantID) {
+			cp := *u
+			users = append(users, &cp)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.After(users[j].CreatedAt) })
+	start, end := page(len(users), limit, offset)
+	return users[start:end], int64(len(users)), nil
+}
+
+// ========== Tenants ==========
+
+func (s *MemoryStore) CreateTenant(ctx context.Context, tenant *models.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenant.ID = newID(tenant.ID)
+	touch(&tenant.CreatedAt, &tenant.UpdatedAt)
+	t := *tenant
+	s.tenants[tenant.ID] = &t
+	return nil
+}
+
+func (s *MemoryStore) GetTenant(ctx context.Context, id uuid.UUID) (*models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (s *MemoryStore) UpdateTenant(ctx context.Context, tenant *models.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenant.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	tenant.UpdatedAt = time.Now()
+	t := *tenant
+	s.tenants[tenant.ID] = &t
+	return nil
+}
+
+func (s *MemoryStore) DeleteTenant(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.tenants, id)
+	return nil
+}
+
+func (s *MemoryStore) ListTenants(ctx context.Context, limit, offset int) ([]*models.Tenant, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tenants []*models.Tenant
+	for _, t := range s.tenants {
+		cp := *t
+		tenants = append(tenants, &cp)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].CreatedAt.After(tenants[j].CreatedAt) })
+	start, end := page(len(tenants), limit, offset)
+	return tenants[start:end], int64(len(tenants)), nil
+}
+
+// ========== Applications ==========
+
+func (s *MemoryStore) CreateApplication(ctx context.Context, app *models.Application) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app.ID = newID(app.ID)
+	touch(&app.CreatedAt, &app.UpdatedAt)
+	a := *app
+	s.applications[app.ID] = &a
+	return nil
+}
+
+func (s *MemoryStore) GetApplication(ctx context.Context, id uuid.UUID) (*models.Application, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.applications[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (s *MemoryStore) UpdateApplication(ctx context.Context, app *models.Application) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.applications[app.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	app.UpdatedAt = time.Now()
+	a := *app
+	s.applications[app.ID] = &a
+	return nil
+}
+
+func (s *MemoryStore) DeleteApplication(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.applications[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.applications, id)
+	return nil
+}
+
+func (s *MemoryStore) ListApplications(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Application, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var apps []*models.Application
+	for _, a := range s.applications {
+		if a.TenantID == tenantID {
+			cp := *a
+			apps = append(apps, &cp)
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].CreatedAt.After(apps[j].CreatedAt) })
+	start, end := page(len(apps), limit, offset)
+	return apps[start:end], int64(len(apps)), nil
+}
+
+// ========== Devices ==========
+
+func (s *MemoryStore) CreateDevice(ctx context.Context, device *models.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devEUI := lorawan.EUI64(device.DevEUI)
+	if _, ok := s.devices[devEUI]; ok {
+		return storage.ErrDuplicateKey
+	}
+	touch(&device.CreatedAt, &device.UpdatedAt)
+	d := *device
+	s.devices[devEUI] = &d
+	return nil
+}
+
+func (s *MemoryStore) GetDevice(ctx context.Context, devEUI lorawan.EUI64) (*models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[devEUI]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *d
+	return &cp, nil
+}
+
+func (s *MemoryStore) GetDeviceByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []*models.Device
+	for _, d := range s.devices {
+		if d.DevAddr != nil && lorawan.DevAddr(*d.DevAddr) == devAddr && !d.IsDisabled {
+			cp := *d
+			devices = append(devices, &cp)
+		}
+	}
+	return devices, nil
+}
+
+func (s *MemoryStore) UpdateDevice(ctx context.Context, device *models.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devEUI := lorawan.EUI64(device.DevEUI)
+	old, ok := s.devices[devEUI]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	device.UpdatedAt = time.Now()
+	d := *device
+	// LastDownlink and LastError are only written by their own methods
+	d.LastDownlink, d.LastError = old.LastDownlink, old.LastError
+	s.devices[devEUI] = &d
+	return nil
+}
+
+func (s *MemoryStore) DeleteDevice(ctx context.Context, devEUI lorawan.EUI64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.devices[devEUI]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.devices, devEUI)
+	return nil
+}
+
+// PurgeDevice deletes the device and everything stored for it, returning the number
+// of rows deleted per table as the SQL store does
+func (s *MemoryStore) PurgeDevice(ctx context.Context, devEUI lorawan.EUI64) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.devices[devEUI]; !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	counts := make(map[string]int64)
+	var macCommands []*models.MACCommandQueueItem
+	for _, item := range s.macCommands {
+		if lorawan.EUI64(item.DevEUI) == devEUI {
+			counts["mac_command_queue"]++
+		} else {
+			macCommands = append(macCommands, item)
+		}
+	}
+	s.macCommands = macCommands
+
+	for _, group := range s.multicast {
+		var members []models.EUI64
+		for _, member := range group.DevEUIs {
+			if lorawan.EUI64(member) == devEUI {
+				counts["multicast_group_devices"]++
+			} else {
+				members = append(members, member)
+			}
+		}
+		group.DevEUIs = members
+	}
+
+	for key := range s.devNonces {
+		if key.devEUI == devEUI {
+			delete(s.devNonces, key)
+			counts["used_dev_nonces"]++
+		}
+	}
+
+	var events []*models.EventLog
+	for _, e := range s.events {
+		if e.DevEUI != nil && lorawan.EUI64(*e.DevEUI) == devEUI {
+			counts["event_logs"]++
+		} else {
+			events = append(events, e)
+		}
+	}
+	s.events = events
+
+	var downlinks []*models.DownlinkFrame
+	for _, f := range s.downlinks {
+		if lorawan.EUI64(f.DevEUI) == devEUI {
+			counts["downlink_frames"]++
+		} else {
+			downlinks = append(downlinks, f)
+		}
+	}
+	s.downlinks = downlinks
+
+	var uplinks []*models.UplinkFrame
+	for _, f := range s.uplinks {
+		if lorawan.EUI64(f.DevEUI) == devEUI {
+			counts["uplink_frames"]++
+		} else {
+			uplinks = append(uplinks, f)
+		}
+	}
+	s.uplinks = uplinks
+
+	if _, ok := s.sessions[devEUI]; ok {
+		delete(s.sessions, devEUI)
+		counts["device_sessions"]++
+	}
+	if _, ok := s.keys[devEUI]; ok {
+		delete(s.keys, devEUI)
+		counts["device_keys"]++
+	}
+	delete(s.devices, devEUI)
+	delete(s.joinNonces, devEUI)
+	counts["devices"]++
+	return counts, nil
+}
+
+func (s *MemoryStore) UpdateDeviceLastDownlink(ctx context.Context, devEUI lorawan.EUI64, lastDownlink *models.DeviceLastDownlink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[devEUI]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	cp := *lastDownlink
+	d.LastDownlink = &cp
+	return nil
+}
+
+func (s *MemoryStore) UpdateDeviceLastError(ctx context.Context, devEUI lorawan.EUI64, lastError *models.DeviceLastError) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[devEUI]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	cp := *lastError
+	d.LastError = &cp
+	return nil
+}
+
+func (s *MemoryStore) NextJoinNonce(ctx context.Context, devEUI lorawan.EUI64) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.devices[devEUI]; !ok {
+		return 0, storage.ErrNotFound
+	}
+	if s.joinNonces[devEUI] >= maxJoinNonce {
+		return 0, storage.ErrJoinNonceExhausted
+	}
+	s.joinNonces[devEUI]++
+	return s.joinNonces[devEUI], nil
+}
+
+// SetJoinNonce sets the device's last used JoinNonce, e.g. to test exhaustion
+func (s *MemoryStore) SetJoinNonce(devEUI lorawan.EUI64, nonce uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joinNonces[devEUI] = nonce
+}
+
+func (s *MemoryStore) ListDevices(ctx context.Context, applicationID uuid.UUID, limit, offset int) ([]*models.Device, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []*models.Device
+	for _, d := range s.devices {
+		if d.ApplicationID == applicationID {
+			cp := *d
+			devices = append(devices, &cp)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].CreatedAt.After(devices[j].CreatedAt) })
+	start, end := page(len(devices), limit, offset)
+	return devices[start:end], int64(len(devices)), nil
+}
+
+// ========== Device keys ==========
+
+func (s *MemoryStore) SetDeviceKeys(ctx context.Context, keys *models.DeviceKeys) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys.UpdatedAt = time.Now()
+	k := *keys
+	s.keys[lorawan.EUI64(keys.DevEUI)] = &k
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceKeys(ctx context.Context, devEUI lorawan.EUI64) (*models.DeviceKeys, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[devEUI]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *k
+	return &cp, nil
+}
+
+func (s *MemoryStore) DeleteDeviceKeys(ctx context.Context, devEUI lorawan.EUI64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[devEUI]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.keys, devEUI)
+	return nil
+}
+
+// ========== Device sessions ==========
+
+func (s *MemoryStore) GetDeviceSession(ctx context.Context, devEUI lorawan.EUI64) (*models.DeviceSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[devEUI]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *session
+	return &cp, nil
+}
+
+func (s *MemoryStore) SaveDeviceSession(ctx context.Context, session *models.DeviceSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	touch(&session.CreatedAt, &session.UpdatedAt)
+	cp := *session
+	s.sessions[lorawan.EUI64(session.DevEUI)] = &cp
+	return nil
+}
+
+func (s *MemoryStore) DeleteDeviceSession(ctx context.Context, devEUI lorawan.EUI64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[devEUI]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.sessions, devEUI)
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceSessionByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.DeviceSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*models.DeviceSession, 0)
+	for _, session := range s.sessions {
+		if lorawan.DevAddr(session.DevAddr) == devAddr {
+			cp := *session
+			sessions = append(sessions, &cp)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt) })
+	return sessions, nil
+}
+
+// AdvanceDeviceSessionFCntUp sets FCntUp to fCnt only when the stored session still has
+// FCntUp = last and the same UplinkReceived flag, like the conditional UPDATE
+func (s *MemoryStore) AdvanceDeviceSessionFCntUp(ctx context.Context, devEUI lorawan.EUI64, last uint32, received bool, fCnt uint32) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[devEUI]
+	if !ok || session.FCntUp != last || session.UplinkReceived != received {
+		return false, nil
+	}
+	session.FCntUp = fCnt
+	session.UplinkReceived = true
+	session.UpdatedAt = time.Now()
+	return true, nil
+}
+
+// ========== Used DevNonces ==========
+
+func (s *MemoryStore) RecordDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := devNonceKey{joinEUI, devEUI, devNonce}
+	if _, ok := s.devNonces[key]; ok {
+		return false, nil
+	}
+	s.devNonces[key] = struct{}{}
+	return true, nil
+}
+
+func (s *MemoryStore) DevNonceUsed(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.devNonces[devNonceKey{joinEUI, devEUI, devNonce}]
+	return ok, nil
+}
+
+func (s *MemoryStore) LastDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64) (uint16, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	var last uint16
+	for key := range s.devNonces {
+		if key.joinEUI == joinEUI && key.devEUI == devEUI && (!found || key.devNonce > last) {
+			found, last = true, key.devNonce
+		}
+	}
+	if !found {
+		return 0, storage.ErrNotFound
+	}
+	return last, nil
+}
+
+func (s *MemoryStore) ForEachDevNonce(ctx context.Context, fn func(joinEUI, devEUI lorawan.EUI64, devNonce uint16)) error {
+	s.mu.Lock()
+	keys := make([]devNonceKey, 0, len(s.devNonces))
+	for key := range s.devNonces {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		fn(key.joinEUI, key.devEUI, key.devNonce)
+	}
+	return nil
+}
+
+// ========== MAC command queue ==========
+
+func (s *MemoryStore) EnqueueMACCommand(ctx context.Context, item *models.MACCommandQueueItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item.ID = newID(item.ID)
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+	cp := *item
+	s.macCommands = append(s.macCommands, &cp)
+	return nil
+}
+
+func (s *MemoryStore) GetPendingMACCommands(ctx context.Context, devEUI lorawan.EUI64) ([]*models.MACCommandQueueItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []*models.MACCommandQueueItem
+	for _, item := range s.macCommands {
+		if lorawan.EUI64(item.DevEUI) == devEUI {
+			cp := *item
+			items = append(items, &cp)
+		}
+	}
+	return items, nil
+}
+
+func (s *MemoryStore) DeleteMACCommand(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.macCommands {
+		if item.ID == id {
+			s.macCommands = append(s.macCommands[:i], s.macCommands[i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+// ========== Gateways ==========
+
+func (s *MemoryStore) CreateGateway(ctx context.Context, gateway *models.Gateway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := lorawan.EUI64(gateway.GatewayID)
+	if _, ok := s.gateways[id]; ok {
+		return storage.ErrDuplicateKey
+	}
+	touch(&gateway.CreatedAt, &gateway.UpdatedAt)
+	g := *gateway
+	s.gateways[id] = &g
+	return nil
+}
+
+func (s *MemoryStore) GetGateway(ctx context.Context, gatewayID lorawan.EUI64) (*models.Gateway, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.gateways[gatewayID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *g
+	return &cp, nil
+}
+
+func (s *MemoryStore) UpdateGateway(ctx context.Context, gateway *models.Gateway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := lorawan.EUI64(gateway.GatewayID)
+	if _, ok := s.gateways[id]; !ok {
+		return storage.ErrNotFound
+	}
+	gateway.UpdatedAt = time.Now()
+	g := *gateway
+	s.gateways[id] = &g
+	return nil
+}
+
+func (s *MemoryStore) DeleteGateway(ctx context.Context, gatewayID lorawan.EUI64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.gateways[gatewayID]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.gateways, gatewayID)
+	return nil
+}
+
+func (s *MemoryStore) ListGateways(ctx context.Context, tenantID uuid.UUID, filters storage.GatewayFilters, limit, offset int) ([]*models.Gateway, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seenAfter := func(g *models.Gateway, t time.Time) bool {
+		return g.LastSeenAt != nil && g.LastSeenAt.After(t)
+	}
+
+	var gateways []*models.Gateway
+	for _, g := range s.gateways {
+		if g.TenantID != tenantID {
+			continue
+		}
+		if filters.Online != nil && seenAfter(g, filters.OnlineSince) != *filters.Online {
+			continue
+		}
+		if filters.LastSeenAfter != nil && (g.LastSeenAt == nil || g.LastSeenAt.Before(*filters.LastSeenAfter)) {
+			continue
+		}
+		if filters.LastSeenBefore != nil && (g.LastSeenAt == nil || g.LastSeenAt.After(*filters.LastSeenBefore)) {
+			continue
+		}
+		cp := *g
+		gateways = append(gateways, &cp)
+	}
+
+	sort.SliceStable(gateways, func(i, j int) bool {
+		a, b := gateways[i], gateways[j]
+		// Never-seen gateways sort last in both directions, like NULLS LAST
+		if filters.SortBy == storage.GatewaySortLastSeen && (a.LastSeenAt == nil || b.LastSeenAt == nil) {
+			return a.LastSeenAt != nil && b.LastSeenAt == nil
+		}
+		if filters.Desc {
+			a, b = b, a
+		}
+		switch filters.SortBy {
+		case storage.GatewaySortName:
+			return a.Name < b.Name
+		case storage.GatewaySortLastSeen:
+			return a.LastSeenAt.Before(*b.LastSeenAt)
+		default:
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+	})
+
+	start, end := page(len(gateways), limit, offset)
+	return gateways[start:end], int64(len(gateways)), nil
+}
+
+func (s *MemoryStore) SaveGatewayStats(ctx context.Context, stats *models.GatewayStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.ID = newID(stats.ID)
+	cp := *stats
+	s.gatewayStats = append(s.gatewayStats, &cp)
+	return nil
+}
+
+// GetGatewayStats returns the stored rows in [from, to); interval is ignored
+func (s *MemoryStore) GetGatewayStats(ctx context.Context, gatewayID lorawan.EUI64, from, to time.Time, interval time.Duration) ([]*models.GatewayStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stats []*models.GatewayStats
+	for _, st := range s.gatewayStats {
+		if lorawan.EUI64(st.GatewayID) == gatewayID && !st.Time.Before(from) && st.Time.Before(to) {
+			cp := *st
+			stats = append(stats, &cp)
+		}
+	}
+	return stats, nil
+}
+
+func (s *MemoryStore) DeleteGatewayStatsBefore(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []*models.GatewayStats
+	for _, st := range s.gatewayStats {
+		if !st.Time.Before(before) {
+			kept = append(kept, st)
+		}
+	}
+	deleted := int64(len(s.gatewayStats) - len(kept))
+	s.gatewayStats = kept
+	return deleted, nil
+}
+
+// ========== Device profiles ==========
+
+func (s *MemoryStore) CreateDeviceProfile(ctx context.Context, profile *models.DeviceProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile.ID = newID(profile.ID)
+	touch(&profile.CreatedAt, &profile.UpdatedAt)
+	p := *profile
+	s.profiles[profile.ID] = &p
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceProfile(ctx context.Context, id uuid.UUID) (*models.DeviceProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.profiles[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (s *MemoryStore) UpdateDeviceProfile(ctx context.Context, profile *models.DeviceProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profiles[profile.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	profile.UpdatedAt = time.Now()
+	p := *profile
+	s.profiles[profile.ID] = &p
+	return nil
+}
+
+func (s *MemoryStore) DeleteDeviceProfile(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profiles[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.profiles, id)
+	return nil
+}
+
+func (s *MemoryStore) ListDeviceProfiles(ctx context.Context, tenantID *uuid.UUID, limit, offset int) ([]*models.DeviceProfile, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var profiles []*models.DeviceProfile
+	for _, p := range s.profiles {
+		if tenantID == nil || (p.TenantID != nil && *p.TenantID == *tenantID) {
+			cp := *p
+			profiles = append(profiles, &cp)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].CreatedAt.After(profiles[j].CreatedAt) })
+	start, end := page(len(profiles), limit, offset)
+	return profiles[start:end], int64(len(profiles)), nil
+}
+
+// ========== Frames ==========
+
+func (s *MemoryStore) CreateUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error {
+	return s.SaveUplinkFrame(ctx, frame)
+}
+
+func (s *MemoryStore) SaveUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame.ID = newID(frame.ID)
+	if frame.ReceivedAt.IsZero() {
+		frame.ReceivedAt = time.Now()
+	}
+	cp := *frame
+	s.uplinks = append(s.uplinks, &cp)
+	return nil
+}
+
+func (s *MemoryStore) SaveUplinkFrames(ctx context.Context, frames []*models.UplinkFrame) error {
+	for _, frame := range frames {
+		if err := s.SaveUplinkFrame(ctx, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListUplinkFrames returns the device's uplinks, newest first
+func (s *MemoryStore) ListUplinkFrames(ctx context.Context, devEUI lorawan.EUI64, limit, offset int) ([]*models.UplinkFrame, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var frames []*models.UplinkFrame
+	for i := len(s.uplinks) - 1; i >= 0; i-- {
+		if lorawan.EUI64(s.uplinks[i].DevEUI) == devEUI {
+			cp := *s.uplinks[i]
+			frames = append(frames, &cp)
+		}
+	}
+	start, end := page(len(frames), limit, offset)
+	return frames[start:end], int64(len(frames)), nil
+}
+
+func (s *MemoryStore) GetUplinkFrame(ctx context.Context, id uuid.UUID) (*models.UplinkFrame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.uplinks {
+		if f.ID == id {
+			cp := *f
+			return &cp, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// GetLastGatewayForDevice returns the first gateway of the device's latest uplink
+// with RX info, "" when there is none
+func (s *MemoryStore) GetLastGatewayForDevice(ctx context.Context, devEUI lorawan.EUI64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.uplinks) - 1; i >= 0; i-- {
+		f := s.uplinks[i]
+		if lorawan.EUI64(f.DevEUI) != devEUI {
+			continue
+		}
+		// read through JSON like rx_info->0->>'gatewayID' in the SQL store
+		raw, err := json.Marshal(f.RXInfo)
+		if err != nil {
+			return "", err
+		}
+		var rxInfo []struct {
+			GatewayID string `json:"gatewayID"`
+		}
+		if json.Unmarshal(raw, &rxInfo) == nil && len(rxInfo) > 0 {
+			return rxInfo[0].GatewayID, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *MemoryStore) CreateDownlinkFrame(ctx context.Context, frame *models.DownlinkFrame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame.ID = newID(frame.ID)
+	if frame.CreatedAt.IsZero() {
+		frame.CreatedAt = time.Now()
+	}
+	frame.IsPending = true
+	cp := *frame
+	s.downlinks = append(s.downlinks, &cp)
+	return nil
+}
+
+// GetPendingDownlinks returns the device's pending downlinks, oldest first
+func (s *MemoryStore) GetPendingDownlinks(ctx context.Context, devEUI lorawan.EUI64) ([]*models.DownlinkFrame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var frames []*models.DownlinkFrame
+	for _, f := range s.downlinks {
+		if lorawan.EUI64(f.DevEUI) == devEUI && f.IsPending {
+			cp := *f
+			frames = append(frames, &cp)
+		}
+	}
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].CreatedAt.Before(frames[j].CreatedAt) })
+	return frames, nil
+}
+
+func (s *MemoryStore) GetDownlinkFrame(ctx context.Context, id uuid.UUID) (*models.DownlinkFrame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.downlinks {
+		if f.ID == id {
+			cp := *f
+			return &cp, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *MemoryStore) UpdateDownlinkFrame(ctx context.Context, frame *models.DownlinkFrame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.downlinks {
+		if f.ID == frame.ID {
+			cp := *frame
+			s.downlinks[i] = &cp
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+func (s *MemoryStore) DeleteDownlinkFrame(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.downlinks {
+		if f.ID == id {
+			s.downlinks = append(s.downlinks[:i], s.downlinks[i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+// DownlinkFrames returns all stored downlink frames, pending or not, in creation order
+func (s *MemoryStore) DownlinkFrames() []*models.DownlinkFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frames := make([]*models.DownlinkFrame, len(s.downlinks))
+	for i, f := range s.downlinks {
+		cp := *f
+		frames[i] = &cp
+	}
+	return frames
+}
+
+// ========== Downlink templates ==========
+
+func (s *MemoryStore) CreateDownlinkTemplate(ctx context.Context, tmpl *models.DownlinkTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.templates {
+		if t.ApplicationID == tmpl.ApplicationID && t.Name == tmpl.Name {
+			return storage.ErrDuplicateKey
+		}
+	}
+	tmpl.ID = newID(tmpl.ID)
+	touch(&tmpl.CreatedAt, &tmpl.UpdatedAt)
+	cp := *tmpl
+	s.templates[tmpl.ID] = &cp
+	return nil
+}
+
+func (s *MemoryStore) GetDownlinkTemplate(ctx context.Context, applicationID uuid.UUID, name string) (*models.DownlinkTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.templates {
+		if t.ApplicationID == applicationID && t.Name == name {
+			cp := *t
+			return &cp, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *MemoryStore) ListDownlinkTemplates(ctx context.Context, applicationID uuid.UUID) ([]*models.DownlinkTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var templates []*models.DownlinkTemplate
+	for _, t := range s.templates {
+		if t.ApplicationID == applicationID {
+			cp := *t
+			templates = append(templates, &cp)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (s *MemoryStore) UpdateDownlinkTemplate(ctx context.Context, tmpl *models.DownlinkTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[tmpl.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	for _, t := range s.templates {
+		if t.ID != tmpl.ID && t.ApplicationID == tmpl.ApplicationID && t.Name == tmpl.Name {
+			return storage.ErrDuplicateKey
+		}
+	}
+	tmpl.UpdatedAt = time.Now()
+	cp := *tmpl
+	s.templates[tmpl.ID] = &cp
+	return nil
+}
+
+func (s *MemoryStore) DeleteDownlinkTemplate(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.templates, id)
+	return nil
+}
+
+// ========== Multicast groups ==========
+
+func (s *MemoryStore) CreateMulticastGroup(ctx context.Context, group *models.MulticastGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	group.ID = newID(group.ID)
+	touch(&group.CreatedAt, &group.UpdatedAt)
+	cp := *group
+	cp.DevEUIs = append([]models.EUI64(nil), group.DevEUIs...)
+	s.multicast[group.ID] = &cp
+	return nil
+}
+
+func (s *MemoryStore) GetMulticastGroup(ctx context.Context, id uuid.UUID) (*models.MulticastGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.multicast[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cp := *g
+	cp.DevEUIs = append([]models.EUI64(nil), g.DevEUIs...)
+	return &cp, nil
+}
+
+func (s *MemoryStore) ListMulticastGroups(ctx context.Context, tenantID, applicationID *uuid.UUID, limit, offset int) ([]*models.MulticastGroup, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var groups []*models.MulticastGroup
+	for _, g := range s.multicast {
+		if tenantID != nil {
+			if app, ok := s.applications[g.ApplicationID]; !ok || app.TenantID != *tenantID {
+				continue
+			}
+		}
+		if applicationID == nil || g.ApplicationID == *applicationID {
+			cp := *g
+			cp.DevEUIs = append([]models.EUI64(nil), g.DevEUIs...)
+			groups = append(groups, &cp)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].CreatedAt.After(groups[j].CreatedAt) })
+	start, end := page(len(groups), limit, offset)
+	return groups[start:end], int64(len(groups)), nil
+}
+
+func (s *MemoryStore) UpdateMulticastGroup(ctx context.Context, group *models.MulticastGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.multicast[group.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	group.UpdatedAt = time.Now()
+	cp := *group
+	cp.DevEUIs = append([]models.EUI64(nil), group.DevEUIs...)
+	s.multicast[group.ID] = &cp
+	return nil
+}
+
+func (s *MemoryStore) DeleteMulticastGroup(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.multicast[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.multicast, id)
+	return nil
+}
+
+// NextMulticastGroupFCnt returns the group's frame counter and increments it
+func (s *MemoryStore) NextMulticastGroupFCnt(ctx context.Context, id uuid.UUID) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.multicast[id]
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+	fCnt := g.FCnt
+	g.FCnt++
+	return fCnt, nil
+}
+
+// ========== Event logs ==========
+
+func (s *MemoryStore) CreateEventLog(ctx context.Context, event *models.EventLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.ID = newID(event.ID)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	cp := *event
+	s.events = append(s.events, &cp)
+	return nil
+}
+
+// ListEventLogs returns matching events, newest first
+func (s *MemoryStore) ListEventLogs(ctx context.Context, filters storage.EventLogFilters, limit, offset int) ([]*models.EventLog, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches := func(e *models.EventLog) bool {
+		switch {
+		case filters.TenantID != nil && (e.TenantID == nil || *e.TenantID != *filters.TenantID):
+			return false
+		case filters.ApplicationID != nil && (e.ApplicationID == nil || *e.ApplicationID != *filters.ApplicationID):
+			return false
+		case filters.DevEUI != nil && (e.DevEUI == nil || lorawan.EUI64(*e.DevEUI) != *filters.DevEUI):
+			return false
+		case filters.GatewayID != nil && (e.GatewayID == nil || lorawan.EUI64(*e.GatewayID) != *filters.GatewayID):
+			return false
+		case filters.Type != nil && e.Type != *filters.Type:
+			return false
+		case filters.Level != nil && e.Level != *filters.Level:
+			return false
+		case filters.StartTime != nil && e.CreatedAt.Before(*filters.StartTime):
+			return false
+		case filters.EndTime != nil && e.CreatedAt.After(*filters.EndTime):
+			return false
+		}
+		return true
+	}
+
+	var events []*models.EventLog
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if matches(s.events[i]) {
+			cp := *s.events[i]
+			events = append(events, &cp)
+		}
+	}
+	start, end := page(len(events), limit, offset)
+	return events[start:end], int64(len(events)), nil
+}
+
+// ========== Frame logs ==========
+
+func (s *MemoryStore) SaveFrameLogs(ctx context.Context, records []*models.FrameLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range records {
+		cp := *r
+		s.frameLogs = append(s.frameLogs, &cp)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteFrameLogsBefore(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []*models.FrameLog
+	for _, r := range s.frameLogs {
+		if !r.Time.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	deleted := int64(len(s.frameLogs) - len(kept))
+	s.frameLogs = kept
+	return deleted, nil
+}
+
+// FrameLogs returns the saved frame log records in order
+func (s *MemoryStore) FrameLogs() []*models.FrameLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]*models.FrameLog, len(s.frameLogs))
+	for i, r := range s.frameLogs {
+		cp := *r
+		records[i] = &cp
+	}
+	return records
+}
@@ -16,6 +16,9 @@ var (
 	ErrNotFound     = errors.New("not found")
 	ErrDuplicateKey = errors.New("duplicate key")
 	ErrInvalidData  = errors.New("invalid data")
+
+	// ErrJoinNonceExhausted is returned when a device has used all 2^24 JoinNonce values
+	ErrJoinNonceExhausted = errors.New("join nonce exhausted")
 )
 
 // Store defines the storage interface
@@ -53,6 +56,10 @@ type Store interface {
 	GetDeviceByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.Device, error)
 	UpdateDevice(ctx context.Context, device *models.Device) error
 	DeleteDevice(ctx context.Context, devEUI lorawan.EUI64) error
+	PurgeDevice(ctx context.Context, devEUI lorawan.EUI64) (map[string]int64, error)
+	UpdateDeviceLastDownlink(ctx context.Context, devEUI lorawan.EUI64, lastDownlink *models.DeviceLastDownlink) error
+	UpdateDeviceLastError(ctx context.Context, devEUI lorawan.EUI64, lastError *models.DeviceLastError) error
+	NextJoinNonce(ctx context.Context, devEUI lorawan.EUI64) (uint32, error)
 	ListDevices(ctx context.Context, applicationID uuid.UUID, limit, offset int) ([]*models.Device, int64, error)
 
 	// Device keys methods
@@ -65,13 +72,28 @@ type Store interface {
 	SaveDeviceSession(ctx context.Context, session *models.DeviceSession) error
 	DeleteDeviceSession(ctx context.Context, devEUI lorawan.EUI64) error
 	GetDeviceSessionByDevAddr(ctx context.Context, devAddr lorawan.DevAddr) ([]*models.DeviceSession, error)
+	AdvanceDeviceSessionFCntUp(ctx context.Context, devEUI lorawan.EUI64, last uint32, received bool, fCnt uint32) (bool, error)
+
+	// Used DevNonce methods
+	RecordDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (bool, error)
+	DevNonceUsed(ctx context.Context, joinEUI, devEUI lorawan.EUI64, devNonce uint16) (bool, error)
+	LastDevNonce(ctx context.Context, joinEUI, devEUI lorawan.EUI64) (uint16, error)
+	ForEachDevNonce(ctx context.Context, fn func(joinEUI, devEUI lorawan.EUI64, devNonce uint16)) error
+
+	// MAC command queue methods
+	EnqueueMACCommand(ctx context.Context, item *models.MACCommandQueueItem) error
+	GetPendingMACCommands(ctx context.Context, devEUI lorawan.EUI64) ([]*models.MACCommandQueueItem, error)
+	DeleteMACCommand(ctx context.Context, id uuid.UUID) error
 
 	// Gateway methods
 	CreateGateway(ctx context.Context, gateway *models.Gateway) error
 	GetGateway(ctx context.Context, gatewayID lorawan.EUI64) (*models.Gateway, error)
 	UpdateGateway(ctx context.Context, gateway *models.Gateway) error
 	DeleteGateway(ctx context.Context, gatewayID lorawan.EUI64) error
-	ListGateways(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Gateway, int64, error)
+	ListGateways(ctx context.Context, tenantID uuid.UUID, filters GatewayFilters, limit, offset int) ([]*models.Gateway, int64, error)
+	SaveGatewayStats(ctx context.Context, stats *models.GatewayStats) error
+	GetGatewayStats(ctx context.Context, gatewayID lorawan.EUI64, from, to time.Time, interval time.Duration) ([]*models.GatewayStats, error)
+	DeleteGatewayStatsBefore(ctx context.Context, before time.Time) (int64, error)
 
 	// Device profile methods
 	CreateDeviceProfile(ctx context.Context, profile *models.DeviceProfile) error
@@ -83,22 +105,65 @@ type Store interface {
 	// Frame methods
 	CreateUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error
 	ListUplinkFrames(ctx context.Context, devEUI lorawan.EUI64, limit, offset int) ([]*models.UplinkFrame, int64, error)
+	GetUplinkFrame(ctx context.Context, id uuid.UUID) (*models.UplinkFrame, error)
 
 	CreateDownlinkFrame(ctx context.Context, frame *models.DownlinkFrame) error
 	GetPendingDownlinks(ctx context.Context, devEUI lorawan.EUI64) ([]*models.DownlinkFrame, error)
+	GetDownlinkFrame(ctx context.Context, id uuid.UUID) (*models.DownlinkFrame, error)
 	UpdateDownlinkFrame(ctx context.Context, frame *models.DownlinkFrame) error
 	DeleteDownlinkFrame(ctx context.Context, id uuid.UUID) error // Add this line
+
+	// Downlink template methods
+	CreateDownlinkTemplate(ctx context.Context, tmpl *models.DownlinkTemplate) error
+	GetDownlinkTemplate(ctx context.Context, applicationID uuid.UUID, name string) (*models.DownlinkTemplate, error)
+	ListDownlinkTemplates(ctx context.Context, applicationID uuid.UUID) ([]*models.DownlinkTemplate, error)
+	UpdateDownlinkTemplate(ctx context.Context, tmpl *models.DownlinkTemplate) error
+	DeleteDownlinkTemplate(ctx context.Context, id uuid.UUID) error
+
+	// Multicast group methods
+	CreateMulticastGroup(ctx context.Context, group *models.MulticastGroup) error
+	GetMulticastGroup(ctx context.Context, id uuid.UUID) (*models.MulticastGroup, error)
+	ListMulticastGroups(ctx context.Context, tenantID, applicationID *uuid.UUID, limit, offset int) ([]*models.MulticastGroup, int64, error)
+	UpdateMulticastGroup(ctx context.Context, group *models.MulticastGroup) error
+	DeleteMulticastGroup(ctx context.Context, id uuid.UUID) error
+	NextMulticastGroupFCnt(ctx context.Context, id uuid.UUID) (uint32, error)
+
 	// Event log methods
 	CreateEventLog(ctx context.Context, event *models.EventLog) error
 	ListEventLogs(ctx context.Context, filters EventLogFilters, limit, offset int) ([]*models.EventLog, int64, error)
 	// 上行帧相关
 	SaveUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error
+	SaveUplinkFrames(ctx context.Context, frames []*models.UplinkFrame) error
 	GetLastGatewayForDevice(ctx context.Context, devEUI lorawan.EUI64) (string, error)
 
+	// 协议调试帧日志
+	SaveFrameLogs(ctx context.Context, records []*models.FrameLog) error
+	DeleteFrameLogsBefore(ctx context.Context, before time.Time) (int64, error)
+
 	// Close the store
 	Close() error
 }
 
+// Gateway list sort orders
+const (
+	GatewaySortCreatedAt = "created_at"
+	GatewaySortLastSeen  = "last_seen"
+	GatewaySortName      = "name"
+)
+
+// GatewayFilters represents filters and ordering for gateway lists
+type GatewayFilters struct {
+	// Online filters on status; a gateway is online when last seen after OnlineSince
+	Online      *bool
+	OnlineSince time.Time
+
+	LastSeenAfter  *time.Time
+	LastSeenBefore *time.Time
+
+	SortBy string // GatewaySort*, defaults to created_at
+	Desc   bool
+}
+
 // EventLogFilters represents filters for event logs
 type EventLogFilters struct {
 	TenantID      *uuid.UUID
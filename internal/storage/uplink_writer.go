@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// ErrWriterClosed is returned when saving to a closed uplink frame writer
+var ErrWriterClosed = errors.New("uplink frame writer closed")
+
+// maxUplinkBatchSize keeps a batch under the PostgreSQL bind parameter limit
+const maxUplinkBatchSize = 65535 / uplinkFrameColumns
+
+// UplinkFrameWriter buffers uplink frames and writes them in batches
+type UplinkFrameWriter struct {
+	store    Store
+	size     int
+	interval time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *models.UplinkFrame
+	done   chan struct{}
+}
+
+// NewUplinkFrameWriter creates a writer and starts its flush loop
+func NewUplinkFrameWriter(store Store, cfg config.UplinkBatchConfig) *UplinkFrameWriter {
+	w := &UplinkFrameWriter{
+		store:    store,
+		size:     cfg.Size,
+		interval: cfg.Interval,
+		done:     make(chan struct{}),
+	}
+
+	if w.size <= 0 {
+		w.size = 100
+	}
+	if w.size > maxUplinkBatchSize {
+		w.size = maxUplinkBatchSize
+	}
+	if w.interval <= 0 {
+		w.interval = time.Second
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = w.size * 10
+	}
+	w.queue = make(chan *models.UplinkFrame, queueSize)
+
+	go w.run()
+
+	return w
+}
+
+// SaveUplinkFrame queues a frame, blocking while the queue is full
+func (w *UplinkFrameWriter) SaveUplinkFrame(ctx context.Context, frame *models.UplinkFrame) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	select {
+	case w.queue <- frame:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting frames and waits until all queued frames are written
+func (w *UplinkFrameWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		<-w.done
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	<-w.done
+	return nil
+}
+
+func (w *UplinkFrameWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]*models.UplinkFrame, 0, w.size)
+	for {
+		select {
+		case frame, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, frame)
+			if len(batch) >= w.size {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (w *UplinkFrameWriter) flush(batch []*models.UplinkFrame) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := w.store.SaveUplinkFrames(ctx, batch); err != nil {
+		log.Error().Err(err).Int("frames", len(batch)).Msg("批量保存上行帧失败")
+		return
+	}
+
+	log.Debug().Int("frames", len(batch)).Msg("批量保存上行帧")
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lorawan-server/lorawan-server-pro/internal/config"
+	"github.com/lorawan-server/lorawan-server-pro/internal/models"
+)
+
+// batchRecorder records the batches written by an UplinkFrameWriter
+type batchRecorder struct {
+	Store
+
+	mu      sync.Mutex
+	batches []int
+	frames  int
+}
+
+func (r *batchRecorder) SaveUplinkFrames(ctx context.Context, frames []*models.UplinkFrame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, len(frames))
+	r.frames += len(frames)
+	return nil
+}
+
+func (r *batchRecorder) written() (int, []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames, append([]int(nil), r.batches...)
+}
+
+func TestUplinkFrameWriterFlushesOnClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		frames      int
+		wantBatches []int
+	}{
+		{"single partial batch", 10, 5, []int{5}},
+		{"full batches and remainder", 10, 25, []int{10, 10, 5}},
+		{"exact batches", 10, 20, []int{10, 10}},
+		{"nothing queued", 10, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &batchRecorder{}
+			w := NewUplinkFrameWriter(store, config.UplinkBatchConfig{Size: tt.size, Interval: time.Hour})
+
+			for i := 0; i < tt.frames; i++ {
+				if err := w.SaveUplinkFrame(context.Background(), &models.UplinkFrame{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Close()
+
+			frames, batches := store.written()
+			if frames != tt.frames {
+				t.Errorf("%d frames written, want %d", frames, tt.frames)
+			}
+			if len(batches) != len(tt.wantBatches) {
+				t.Fatalf("batches = %v, want %v", batches, tt.wantBatches)
+			}
+			for i := range batches {
+				if batches[i] != tt.wantBatches[i] {
+					t.Errorf("batches = %v, want %v", batches, tt.wantBatches)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestUplinkFrameWriterFlushesOnInterval(t *testing.T) {
+	store := &batchRecorder{}
+	w := NewUplinkFrameWriter(store, config.UplinkBatchConfig{Size: 100, Interval: 10 * time.Millisecond})
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		w.SaveUplinkFrame(context.Background(), &models.UplinkFrame{})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if frames, _ := store.written(); frames == 3 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queued frames not written within the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUplinkFrameWriterClosed(t *testing.T) {
+	w := NewUplinkFrameWriter(&batchRecorder{}, config.UplinkBatchConfig{})
+	w.Close()
+
+	if err := w.SaveUplinkFrame(context.Background(), &models.UplinkFrame{}); err != ErrWriterClosed {
+		t.Errorf("SaveUplinkFrame after Close = %v, want ErrWriterClosed", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestNewUplinkFrameWriterLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.UplinkBatchConfig
+		wantSize     int
+		wantInterval time.Duration
+		wantQueue    int
+	}{
+		{"defaults", config.UplinkBatchConfig{}, 100, time.Second, 1000},
+		{"configured", config.UplinkBatchConfig{Size: 50, Interval: time.Minute, QueueSize: 7}, 50, time.Minute, 7},
+		{"size above parameter limit", config.UplinkBatchConfig{Size: 1 << 20}, maxUplinkBatchSize, time.Second, maxUplinkBatchSize * 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewUplinkFrameWriter(&batchRecorder{}, tt.cfg)
+			defer w.Close()
+
+			if w.size != tt.wantSize || w.interval != tt.wantInterval || cap(w.queue) != tt.wantQueue {
+				t.Errorf("size %d, interval %s, queue %d; want %d, %s, %d",
+					w.size, w.interval, cap(w.queue), tt.wantSize, tt.wantInterval, tt.wantQueue)
+			}
+		})
+	}
+}
+
+func TestUplinkFrameArgsMatchColumns(t *testing.T) {
+	fPort := uint8(2)
+	for _, frame := range []*models.UplinkFrame{{}, {FPort: &fPort}} {
+		args, err := uplinkFrameArgs(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(args) != uplinkFrameColumns {
+			t.Errorf("%d args, want %d", len(args), uplinkFrameColumns)
+		}
+		if frame.ReceivedAt.IsZero() {
+			t.Error("ReceivedAt not set")
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
     "fmt"
     "reflect"
     "strings"
+    
+    "github.com/lorawan-server/lorawan-server-pro/pkg/lorawan"
 )
 
 // Validator validates structs
@@ -83,6 +85,14 @@ func (v *Validator) validateField(field reflect.Value, fieldType reflect.StructF
             
         case "len":
             // Validate exact length
+            
+        case "aeskey":
+            // 16 字节 AES 密钥的 hex 编码，空值交给 required 判断
+            if field.Kind() == reflect.String && field.String() != "" {
+                if _, err := lorawan.ParseAES128Key(field.String()); err != nil {
+                    return err
+                }
+            }
         }
     }
     
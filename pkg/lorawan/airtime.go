@@ -0,0 +1,55 @@
+package lorawan
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ValidCodeRate 判断 codr 是否为合法的 LoRa 编码率（4/5、4/6、4/7、4/8）
+func ValidCodeRate(codr string) bool {
+	switch codr {
+	case "4/5", "4/6", "4/7", "4/8":
+		return true
+	}
+	return false
+}
+
+// TimeOnAir 计算 LoRa 帧的空中时间（Semtech AN1200.13）。
+// datr 形如 "SF12BW125"，codr 形如 "4/5"；crc 上行为 true，下行为 false。
+func TimeOnAir(datr, codr string, payloadLen int, crc bool) (time.Duration, error) {
+	var sf, bw int
+	if _, err := fmt.Sscanf(datr, "SF%dBW%d", &sf, &bw); err != nil || sf < 6 || sf > 12 || bw <= 0 {
+		return 0, fmt.Errorf("invalid LoRa data rate %q", datr)
+	}
+
+	cr := 1
+	if codr != "" {
+		var denom int
+		if _, err := fmt.Sscanf(codr, "4/%d", &denom); err != nil || denom < 5 || denom > 8 {
+			return 0, fmt.Errorf("invalid coding rate %q", codr)
+		}
+		cr = denom - 4
+	}
+
+	// 符号时间（秒）
+	tSym := math.Pow(2, float64(sf)) / float64(bw*1000)
+	tPreamble := (8 + 4.25) * tSym
+
+	de := 0
+	if sf >= 11 && bw == 125 {
+		de = 1
+	}
+	crcBits := 0
+	if crc {
+		crcBits = 16
+	}
+
+	// 显式头部（H=0）
+	num := float64(8*payloadLen - 4*sf + 28 + crcBits)
+	den := float64(4 * (sf - 2*de))
+	symbols := 8 + math.Max(math.Ceil(num/den)*float64(cr+4), 0)
+
+	seconds := tPreamble + symbols*tSym
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,63 @@
+package lorawan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeOnAir(t *testing.T) {
+	tests := []struct {
+		name       string
+		datr, codr string
+		size       int
+		crc        bool
+		want       time.Duration
+		wantErr    bool
+	}{
+		// 与 Semtech LoRa 计算器一致（8 符号前导码，显式头部）
+		{"SF7 uplink", "SF7BW125", "4/5", 10, true, 41216 * time.Microsecond, false},
+		{"SF12 uplink", "SF12BW125", "4/5", 10, true, 991232 * time.Microsecond, false},
+		{"SF7 downlink", "SF7BW125", "4/5", 10, false, 36096 * time.Microsecond, false},
+		{"SF12 downlink", "SF12BW125", "4/5", 13, false, 1155072 * time.Microsecond, false},
+		{"SF9 coding rate 4/8", "SF9BW125", "4/8", 20, true, 246784 * time.Microsecond, false},
+		{"SF7 500 kHz", "SF7BW500", "4/5", 10, true, 10304 * time.Microsecond, false},
+		{"default coding rate", "SF7BW125", "", 10, true, 41216 * time.Microsecond, false},
+		{"FSK", "50000", "", 10, true, 0, true},
+		{"invalid spreading factor", "SF13BW125", "4/5", 10, true, 0, true},
+		{"invalid coding rate", "SF7BW125", "4/9", 10, true, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TimeOnAir(tt.datr, tt.codr, tt.size, tt.crc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TimeOnAir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Round(time.Microsecond) != tt.want {
+				t.Errorf("TimeOnAir(%s, %s, %d, %v) = %s, want %s", tt.datr, tt.codr, tt.size, tt.crc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidCodeRate(t *testing.T) {
+	tests := []struct {
+		codr string
+		want bool
+	}{
+		{"4/5", true},
+		{"4/6", true},
+		{"4/7", true},
+		{"4/8", true},
+		{"4/9", false},
+		{"4/4", false},
+		{"", false},
+		{"45", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidCodeRate(tt.codr); got != tt.want {
+			t.Errorf("ValidCodeRate(%q) = %v, want %v", tt.codr, got, tt.want)
+		}
+	}
+}
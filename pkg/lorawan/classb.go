@@ -0,0 +1,134 @@
+package lorawan
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Class B 信标与 ping slot 时序（LoRaWAN 1.0.4 / RP002）
+const (
+	BeaconPeriod   = 128 * time.Second
+	BeaconReserved = 2120 * time.Millisecond
+	PingSlotLength = 30 * time.Millisecond
+
+	// gpsLeapSeconds GPS 时间领先 UTC 的闰秒数
+	gpsLeapSeconds = 18 * time.Second
+)
+
+// GPSEpoch GPS 时间起点 1980-01-06 00:00:00 UTC
+var GPSEpoch = time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC)
+
+// TimeToGPS 把 UTC 时间换算为自 GPS 起点以来的时长
+func TimeToGPS(t time.Time) time.Duration {
+	return t.Sub(GPSEpoch) + gpsLeapSeconds
+}
+
+// GPSToTime 把 GPS 时长换算为 UTC 时间
+func GPSToTime(gps time.Duration) time.Time {
+	return GPSEpoch.Add(gps - gpsLeapSeconds)
+}
+
+// BeaconStart 返回 GPS 时间所在信标周期的起点
+func BeaconStart(gps time.Duration) time.Duration {
+	return gps - gps%BeaconPeriod
+}
+
+// PingPeriod 返回 periodicity（0-7）对应的 ping slot 间隔（以 30ms 时隙计）
+func PingPeriod(periodicity int) (int, error) {
+	if periodicity < 0 || periodicity > 7 {
+		return 0, fmt.Errorf("ping slot periodicity must be between 0 and 7, got %d", periodicity)
+	}
+	return 1 << (5 + uint(periodicity)), nil
+}
+
+// PingOffset 计算设备在信标周期内的 ping slot 随机偏移
+func PingOffset(beacon time.Duration, devAddr DevAddr, periodicity int) (int, error) {
+	period, err := PingPeriod(periodicity)
+	if err != nil {
+		return 0, err
+	}
+
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		return 0, err
+	}
+
+	var b [16]byte
+	binary.LittleEndian.PutUint32(b[0:4], uint32(beacon/time.Second))
+	copy(b[4:8], devAddr[:])
+	block.Encrypt(b[:], b[:])
+
+	return (int(b[0]) + int(b[1])*256) % period, nil
+}
+
+// NextPingSlot 返回 gps 之后设备的下一个 ping slot 起点（GPS 时长）
+func NextPingSlot(gps time.Duration, devAddr DevAddr, periodicity int) (time.Duration, error) {
+	period, err := PingPeriod(periodicity)
+	if err != nil {
+		return 0, err
+	}
+
+	for beacon := BeaconStart(gps); ; beacon += BeaconPeriod {
+		offset, err := PingOffset(beacon, devAddr, periodicity)
+		if err != nil {
+			return 0, err
+		}
+		for slot := offset; slot < 4096; slot += period {
+			t := beacon + BeaconReserved + time.Duration(slot)*PingSlotLength
+			if t > gps {
+				return t, nil
+			}
+		}
+	}
+}
+
+// BeaconLayout 返回区域信标帧中两段 RFU 的字节数（RP002：CN470 为 3/1，EU868 等为 2/0）
+func BeaconLayout(region string) (rfu1, rfu2 int) {
+	if region == "CN470" {
+		return 3, 1
+	}
+	return 2, 0
+}
+
+// BeaconPayload 构造信标帧 RFU | Time | CRC | GwSpecific | RFU | CRC。
+// Time 为信标周期起点的 GPS 秒数，GwSpecific 为 InfoDesc 0（网关天线坐标）
+func BeaconPayload(beacon time.Duration, region string, lat, lng float64) []byte {
+	rfu1, rfu2 := BeaconLayout(region)
+	b := make([]byte, rfu1+6+7+rfu2+2)
+
+	binary.LittleEndian.PutUint32(b[rfu1:], uint32(beacon/time.Second))
+	binary.LittleEndian.PutUint16(b[rfu1+4:], beaconCRC(b[:rfu1+4]))
+
+	info := b[rfu1+6:]
+	info[0] = 0
+	putInt24(info[1:4], int32(lat*(1<<23)/90))
+	putInt24(info[4:7], int32(lng*(1<<23)/180))
+
+	binary.LittleEndian.PutUint16(b[len(b)-2:], beaconCRC(b[rfu1+6:len(b)-2]))
+	return b
+}
+
+// putInt24 按小端序写入 24 位有符号整数
+func putInt24(b []byte, v int32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// beaconCRC CRC-16-CCITT（多项式 0x1021，初值 0）
+func beaconCRC(data []byte) uint16 {
+	var crc uint16
+	for _, d := range data {
+		crc ^= uint16(d) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,158 @@
+package lorawan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeToGPS(t *testing.T) {
+	tests := []struct {
+		name string
+		utc  time.Time
+		want time.Duration
+	}{
+		{"gps epoch", GPSEpoch, 18 * time.Second},
+		{"2026-01-01", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), 1451260818 * time.Second},
+		{"sub-second", time.Date(2026, time.January, 1, 0, 0, 0, 250e6, time.UTC), 1451260818*time.Second + 250*time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeToGPS(tt.utc); got != tt.want {
+				t.Errorf("TimeToGPS(%s) = %s, want %s", tt.utc, got, tt.want)
+			}
+			if got := GPSToTime(tt.want); !got.Equal(tt.utc) {
+				t.Errorf("GPSToTime(%s) = %s, want %s", tt.want, got, tt.utc)
+			}
+		})
+	}
+}
+
+func TestBeaconStart(t *testing.T) {
+	tests := []struct {
+		gps  time.Duration
+		want time.Duration
+	}{
+		{0, 0},
+		{127999 * time.Millisecond, 0},
+		{128 * time.Second, 128 * time.Second},
+		{1000 * time.Second, 896 * time.Second},
+		{1451260818 * time.Second, 1451260800 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := BeaconStart(tt.gps); got != tt.want {
+			t.Errorf("BeaconStart(%s) = %s, want %s", tt.gps, got, tt.want)
+		}
+	}
+}
+
+func TestPingPeriod(t *testing.T) {
+	tests := []struct {
+		periodicity int
+		want        int
+		wantErr     bool
+	}{
+		{0, 32, false},
+		{4, 512, false},
+		{7, 4096, false},
+		{-1, 0, true},
+		{8, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := PingPeriod(tt.periodicity)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("PingPeriod(%d) = %d, %v, want %d, wantErr %v", tt.periodicity, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPingOffset(t *testing.T) {
+	// Rand = aes128_encrypt(16 字节 0x00, BeaconTime | DevAddr | pad16)，偏移为 (Rand[0] + Rand[1]*256) mod pingPeriod；
+	// Rand 为独立计算的 AES 结果，零密钥加密零块即 FIPS-197 的 66e94bd4...
+	tests := []struct {
+		name        string
+		beacon      time.Duration
+		devAddr     DevAddr
+		periodicity int
+		want        int
+	}{
+		// Rand = 66e94bd4ef8a2c3b884cfa59ca342b2e
+		{"zero block period 32", 0, DevAddr{}, 0, 59750 % 32},
+		{"zero block period 4096", 0, DevAddr{}, 7, 59750 % 4096},
+		// BeaconTime 1451260800，Rand = d856ac3dd82bee49d82a72bf062da536
+		{"period 32", 1451260800 * time.Second, DevAddr{0x26, 0x01, 0x1b, 0xda}, 0, 24},
+		{"period 256", 1451260800 * time.Second, DevAddr{0x26, 0x01, 0x1b, 0xda}, 3, 216},
+		{"period 4096", 1451260800 * time.Second, DevAddr{0x26, 0x01, 0x1b, 0xda}, 7, 1752},
+		// 下一个信标周期，Rand = e3468aab489c27a290c997db6b3374c4
+		{"next beacon", 1451260928 * time.Second, DevAddr{0x26, 0x01, 0x1b, 0xda}, 7, 1763},
+		// 另一个设备，Rand = 2a41290ac3b8d94ed69a2818005ec055
+		{"other device", 1451260800 * time.Second, DevAddr{0x01, 0x02, 0x03, 0x04}, 5, 298},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PingOffset(tt.beacon, tt.devAddr, tt.periodicity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("PingOffset(%s, %s, %d) = %d, want %d", tt.beacon, tt.devAddr, tt.periodicity, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := PingOffset(0, DevAddr{}, 8); err == nil {
+		t.Error("PingOffset accepted periodicity 8")
+	}
+}
+
+func TestNextPingSlot(t *testing.T) {
+	devAddr := DevAddr{0x26, 0x01, 0x1b, 0xda}
+	beacon := 1451260800 * time.Second
+
+	tests := []struct {
+		name        string
+		gps         time.Duration
+		periodicity int
+	}{
+		{"beacon start", beacon, 7},
+		{"inside reserved window", beacon + time.Second, 0},
+		{"mid period", beacon + 60*time.Second, 3},
+		{"end of period", beacon + BeaconPeriod - time.Millisecond, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextPingSlot(tt.gps, devAddr, tt.periodicity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got <= tt.gps {
+				t.Fatalf("NextPingSlot(%s) = %s, not after the given time", tt.gps, got)
+			}
+
+			// 落在所在信标周期内设备自己的时隙上
+			start := BeaconStart(got)
+			offset, _ := PingOffset(start, devAddr, tt.periodicity)
+			period, _ := PingPeriod(tt.periodicity)
+			since := got - start - BeaconReserved
+			if since < 0 || since%PingSlotLength != 0 {
+				t.Fatalf("slot %s is not on the ping slot grid of beacon %s", got, start)
+			}
+			if slot := int(since / PingSlotLength); slot >= 4096 || (slot-offset)%period != 0 || slot < offset {
+				t.Errorf("slot %d, want offset %d + n*%d", slot, offset, period)
+			}
+
+			// 两者之间没有更早的时隙
+			if prev := got - time.Duration(period)*PingSlotLength; prev > tt.gps && BeaconStart(prev) == start && prev-start >= BeaconReserved+time.Duration(offset)*PingSlotLength {
+				t.Errorf("earlier slot %s skipped", prev)
+			}
+		})
+	}
+
+	if _, err := NextPingSlot(beacon, devAddr, 8); err == nil {
+		t.Error("NextPingSlot accepted periodicity 8")
+	}
+}
@@ -0,0 +1,85 @@
+package lorawan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// 应用层时钟同步（LoRaWAN TS003）
+const (
+	ClockSyncFPort = 202
+
+	ClockSyncPackageVersion byte = 0x00
+	ClockSyncAppTime        byte = 0x01
+
+	clockSyncPackageID      = 1
+	clockSyncPackageVersion = 1
+)
+
+// AppTimeReq 设备上报的本地时间
+type AppTimeReq struct {
+	DeviceTime  uint32 // 设备的 GPS 秒
+	TokenReq    uint8
+	AnsRequired bool
+}
+
+// AppTimeAns 时间校正应答
+type AppTimeAns struct {
+	TimeCorrection int32 // 秒，设备时间加上该值即为网络时间
+	TokenAns       uint8
+}
+
+// ClockSyncRequest 时钟同步端口上的一条上行命令
+type ClockSyncRequest struct {
+	CID     byte
+	AppTime *AppTimeReq // CID 为 AppTime 时有效
+}
+
+// ParseClockSyncRequests 解析时钟同步端口的上行负载，可包含多条命令
+func ParseClockSyncRequests(data []byte) ([]ClockSyncRequest, error) {
+	var reqs []ClockSyncRequest
+	for i := 0; i < len(data); {
+		cid := data[i]
+		i++
+
+		switch cid {
+		case ClockSyncPackageVersion:
+			reqs = append(reqs, ClockSyncRequest{CID: cid})
+		case ClockSyncAppTime:
+			if i+5 > len(data) {
+				return reqs, fmt.Errorf("AppTimeReq requires 5 bytes, got %d", len(data)-i)
+			}
+			reqs = append(reqs, ClockSyncRequest{CID: cid, AppTime: &AppTimeReq{
+				DeviceTime:  binary.LittleEndian.Uint32(data[i : i+4]),
+				TokenReq:    data[i+4] & 0x0f,
+				AnsRequired: data[i+4]&0x10 != 0,
+			}})
+			i += 5
+		default:
+			return reqs, fmt.Errorf("unsupported clock sync command: 0x%02x", cid)
+		}
+	}
+	return reqs, nil
+}
+
+// AppTimeCorrection 计算设备时间相对网络 GPS 时间的校正值（秒，四舍五入）
+func AppTimeCorrection(deviceTime uint32, serverGPS time.Duration) int32 {
+	server := serverGPS.Round(time.Second) / time.Second
+	// 设备时间是 GPS 秒的低 32 位
+	return int32(uint32(server) - deviceTime)
+}
+
+// MarshalBinary 编码 AppTimeAns 命令（含 CID）
+func (a AppTimeAns) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 6)
+	b[0] = ClockSyncAppTime
+	binary.LittleEndian.PutUint32(b[1:5], uint32(a.TimeCorrection))
+	b[5] = a.TokenAns & 0x0f
+	return b, nil
+}
+
+// ClockSyncPackageVersionAns 返回 PackageVersionAns 命令（含 CID）
+func ClockSyncPackageVersionAns() []byte {
+	return []byte{ClockSyncPackageVersion, clockSyncPackageID, clockSyncPackageVersion}
+}
@@ -0,0 +1,100 @@
+package lorawan
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseClockSyncRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []ClockSyncRequest
+		wantErr bool
+	}{
+		{"package version", []byte{0x00}, []ClockSyncRequest{{CID: ClockSyncPackageVersion}}, false},
+		{
+			"app time",
+			[]byte{0x01, 0x12, 0x34, 0x56, 0x78, 0x13},
+			[]ClockSyncRequest{{CID: ClockSyncAppTime, AppTime: &AppTimeReq{DeviceTime: 0x78563412, TokenReq: 3, AnsRequired: true}}},
+			false,
+		},
+		{
+			"version then app time",
+			[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x0f},
+			[]ClockSyncRequest{{CID: ClockSyncPackageVersion}, {CID: ClockSyncAppTime, AppTime: &AppTimeReq{TokenReq: 15}}},
+			false,
+		},
+		{"truncated app time", []byte{0x01, 0x12, 0x34}, nil, true},
+		{"unknown command", []byte{0x00, 0x7f}, []ClockSyncRequest{{CID: ClockSyncPackageVersion}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClockSyncRequests(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClockSyncRequests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseClockSyncRequests() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppTimeCorrection(t *testing.T) {
+	server := 1451260818 * time.Second
+
+	tests := []struct {
+		name       string
+		deviceTime uint32
+		server     time.Duration
+		want       int32
+	}{
+		{"in sync", 1451260818, server, 0},
+		{"device behind", 1451260800, server, 18},
+		{"device ahead", 1451260900, server, -82},
+		{"rounds up", 1451260818, server + 500*time.Millisecond, 1},
+		{"rounds down", 1451260818, server + 499*time.Millisecond, 0},
+		{"device never set", 0, server, 1451260818},
+		{"32-bit wrap", 0xfffffff0, 0x100000010 * time.Second, 0x20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AppTimeCorrection(tt.deviceTime, tt.server); got != tt.want {
+				t.Errorf("AppTimeCorrection(%d, %s) = %d, want %d", tt.deviceTime, tt.server, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppTimeAnsMarshalBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		ans  AppTimeAns
+		want []byte
+	}{
+		{"positive", AppTimeAns{TimeCorrection: 18, TokenAns: 3}, []byte{0x01, 0x12, 0x00, 0x00, 0x00, 0x03}},
+		{"negative", AppTimeAns{TimeCorrection: -82, TokenAns: 15}, []byte{0x01, 0xae, 0xff, 0xff, 0xff, 0x0f}},
+		{"token masked", AppTimeAns{TimeCorrection: 0, TokenAns: 0x13}, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x03}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ans.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("MarshalBinary() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+
+	if got := ClockSyncPackageVersionAns(); !bytes.Equal(got, []byte{0x00, 0x01, 0x01}) {
+		t.Errorf("ClockSyncPackageVersionAns() = %x", got)
+	}
+}
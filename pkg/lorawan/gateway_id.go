@@ -0,0 +1,60 @@
+package lorawan
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Gateway ID representations used in NATS subjects and messages
+const (
+	GatewayIDLower = "lower" // 0102030405060708 (default)
+	GatewayIDUpper = "upper" // 0102030405ABCDEF
+	GatewayIDColon = "colon" // 01:02:03:04:05:ab:cd:ef
+)
+
+// ValidGatewayIDFormat reports whether format is a known representation, empty means lower
+func ValidGatewayIDFormat(format string) bool {
+	switch format {
+	case "", GatewayIDLower, GatewayIDUpper, GatewayIDColon:
+		return true
+	}
+	return false
+}
+
+// FormatGatewayID returns the gateway ID in the given representation
+func FormatGatewayID(id EUI64, format string) string {
+	switch format {
+	case GatewayIDUpper:
+		return strings.ToUpper(id.String())
+	case GatewayIDColon:
+		parts := make([]string, len(id))
+		for i, b := range id {
+			parts[i] = hex.EncodeToString([]byte{b})
+		}
+		return strings.Join(parts, ":")
+	default:
+		return id.String()
+	}
+}
+
+// ParseGatewayID parses a gateway ID in any supported representation
+func ParseGatewayID(s string) (EUI64, error) {
+	var id EUI64
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(b) != len(id) {
+		return id, fmt.Errorf("invalid gateway ID %q", s)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// NormalizeGatewayID converts a gateway ID in any representation to the given one
+func NormalizeGatewayID(s string, format string) (string, error) {
+	id, err := ParseGatewayID(s)
+	if err != nil {
+		return "", err
+	}
+	return FormatGatewayID(id, format), nil
+}
@@ -0,0 +1,76 @@
+package lorawan
+
+import "testing"
+
+func TestFormatGatewayID(t *testing.T) {
+	id := EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0xab, 0xcd, 0xef}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "0102030405abcdef"},
+		{GatewayIDLower, "0102030405abcdef"},
+		{GatewayIDUpper, "0102030405ABCDEF"},
+		{GatewayIDColon, "01:02:03:04:05:ab:cd:ef"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got := FormatGatewayID(id, tt.format)
+			if got != tt.want {
+				t.Fatalf("FormatGatewayID(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+			// 每种格式都能解析回原 ID
+			if parsed, err := ParseGatewayID(got); err != nil || parsed != id {
+				t.Errorf("ParseGatewayID(%q) = %s, %v", got, parsed, err)
+			}
+		})
+	}
+}
+
+func TestParseGatewayID(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantErr bool
+	}{
+		{"0102030405abcdef", false},
+		{"0102030405ABCDEF", false},
+		{"01:02:03:04:05:ab:cd:ef", false},
+		{"0102030405abcd", true},
+		{"0102030405abcdef00", true},
+		{"0102030405abcdeg", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			id, err := ParseGatewayID(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGatewayID(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if !tt.wantErr && id != (EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0xab, 0xcd, 0xef}) {
+				t.Errorf("ParseGatewayID(%q) = %s", tt.s, id)
+			}
+		})
+	}
+}
+
+func TestNormalizeGatewayID(t *testing.T) {
+	tests := []struct {
+		s, format, want string
+	}{
+		{"0102030405abcdef", GatewayIDUpper, "0102030405ABCDEF"},
+		{"0102030405ABCDEF", GatewayIDColon, "01:02:03:04:05:ab:cd:ef"},
+		{"01:02:03:04:05:ab:cd:ef", "", "0102030405abcdef"},
+	}
+
+	for _, tt := range tests {
+		if got, err := NormalizeGatewayID(tt.s, tt.format); err != nil || got != tt.want {
+			t.Errorf("NormalizeGatewayID(%q, %q) = %q, %v, want %q", tt.s, tt.format, got, err, tt.want)
+		}
+	}
+	if _, err := NormalizeGatewayID("gateway", GatewayIDLower); err == nil {
+		t.Error("NormalizeGatewayID accepted an invalid ID")
+	}
+}
@@ -0,0 +1,174 @@
+package lorawan
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// JoinReqTypeJoinRequest JoinReqType of a Join-request (rejoin types 0-2 use 0x00-0x02)
+const JoinReqTypeJoinRequest byte = 0xFF
+
+// IsMACVersion11 reports whether a device profile MAC version (e.g. "1.1.0") is LoRaWAN 1.1
+func IsMACVersion11(macVersion string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(macVersion, "LoRaWAN "), "1.1")
+}
+
+// DeriveJSIntKey derives the LoRaWAN 1.1 JSIntKey = aes128_encrypt(NwkKey, 0x06 | DevEUI | pad16).
+// devEUI is in over-the-air (little-endian) byte order, as in the Join-request.
+func DeriveJSIntKey(nwkKey []byte, devEUI [8]byte) (key [16]byte, err error) {
+	return deriveJSKey(nwkKey, 0x06, devEUI)
+}
+
+// DeriveJSEncKey derives the LoRaWAN 1.1 JSEncKey = aes128_encrypt(NwkKey, 0x05 | DevEUI | pad16).
+// devEUI is in over-the-air (little-endian) byte order, as in the Join-request.
+func DeriveJSEncKey(nwkKey []byte, devEUI [8]byte) (key [16]byte, err error) {
+	return deriveJSKey(nwkKey, 0x05, devEUI)
+}
+
+func deriveJSKey(nwkKey []byte, prefix byte, devEUI [8]byte) (key [16]byte, err error) {
+	msg := make([]byte, 16)
+	msg[0] = prefix
+	copy(msg[1:9], devEUI[:])
+
+	block, err := aes.NewCipher(nwkKey)
+	if err != nil {
+		return key, err
+	}
+	block.Encrypt(key[:], msg)
+	return key, nil
+}
+
+// SetJoinAcceptMIC11 sets the MIC of a LoRaWAN 1.1 Join-accept (OptNeg set):
+// MIC = aes128_cmac(JSIntKey, JoinReqType | JoinEUI | DevNonce | MHDR | JoinNonce | NetID | DevAddr | DLSettings | RxDelay | CFList).
+// joinEUI and devNonce are in over-the-air byte order, as in the Join-request.
+func (p *PHYPayload) SetJoinAcceptMIC11(jsIntKey AES128Key, joinReqType byte, joinEUI [8]byte, devNonce [2]byte) error {
+	data := make([]byte, 0, 1+8+2+1+len(p.MACPayload))
+	data = append(data, joinReqType)
+	data = append(data, joinEUI[:]...)
+	data = append(data, devNonce[:]...)
+	data = append(data, byte(p.MHDR.MType<<5)|byte(p.MHDR.Major))
+	data = append(data, p.MACPayload...)
+
+	mic, err := CalculateMIC(jsIntKey[:], data)
+	if err != nil {
+		return fmt.Errorf("calculate JOIN ACCEPT MIC: %w", err)
+	}
+	p.MIC = mic
+	return nil
+}
+
+// SetUplinkDataMIC11 sets the LoRaWAN 1.1 uplink MIC = cmacS[0..1] | cmacF[0..1], where cmacF is
+// computed with FNwkSIntKey over B0 and cmacS with SNwkSIntKey over B1 (ConfFCnt, TxDr, TxCh).
+// fCnt is the full 32 bit FCntUp; confFCnt is the FCntDown of the acknowledged downlink, 0 without ACK.
+func (p *PHYPayload) SetUplinkDataMIC11(fCnt, confFCnt uint32, txDR, txCH byte, fNwkSIntKey, sNwkSIntKey AES128Key) error {
+	macPayload := &MACPayload{}
+	if err := macPayload.Unmarshal(p.MACPayload, p.MHDR.MType, true); err != nil {
+		return fmt.Errorf("unmarshal MAC payload: %w", err)
+	}
+
+	msg := make([]byte, 0, 1+len(p.MACPayload))
+	msg = append(msg, byte(p.MHDR.MType<<5)|byte(p.MHDR.Major))
+	msg = append(msg, p.MACPayload...)
+
+	b0 := micBlock(0, macPayload.FHDR.DevAddr, fCnt, len(msg))
+	b1 := micBlock(0, macPayload.FHDR.DevAddr, fCnt, len(msg))
+	binary.LittleEndian.PutUint16(b1[1:3], uint16(confFCnt))
+	b1[3] = txDR
+	b1[4] = txCH
+
+	cmacF, err := aesCMACPRF(fNwkSIntKey[:], append(b0, msg...))
+	if err != nil {
+		return fmt.Errorf("calculate MIC: %w", err)
+	}
+	cmacS, err := aesCMACPRF(sNwkSIntKey[:], append(b1, msg...))
+	if err != nil {
+		return fmt.Errorf("calculate MIC: %w", err)
+	}
+
+	copy(p.MIC[0:2], cmacS[0:2])
+	copy(p.MIC[2:4], cmacF[0:2])
+	return nil
+}
+
+// ValidateUplinkDataMIC11 validates a LoRaWAN 1.1 uplink MIC, see SetUplinkDataMIC11
+func (p *PHYPayload) ValidateUplinkDataMIC11(fCnt, confFCnt uint32, txDR, txCH byte, fNwkSIntKey, sNwkSIntKey AES128Key) (bool, error) {
+	origMIC := p.MIC
+	defer func() { p.MIC = origMIC }()
+
+	if err := p.SetUplinkDataMIC11(fCnt, confFCnt, txDR, txCH, fNwkSIntKey, sNwkSIntKey); err != nil {
+		return false, err
+	}
+	return p.MIC == origMIC, nil
+}
+
+// SetDownlinkDataMIC11 sets the LoRaWAN 1.1 downlink MIC = aes128_cmac(SNwkSIntKey, B0 | msg)[0..3],
+// with ConfFCnt in B0. confFCnt is the FCntUp of the acknowledged confirmed uplink, 0 without ACK.
+func (p *PHYPayload) SetDownlinkDataMIC11(fCnt, confFCnt uint32, sNwkSIntKey AES128Key) error {
+	macPayload := &MACPayload{}
+	if err := macPayload.Unmarshal(p.MACPayload, p.MHDR.MType, false); err != nil {
+		return fmt.Errorf("unmarshal MAC payload: %w", err)
+	}
+
+	msg := make([]byte, 0, 1+len(p.MACPayload))
+	msg = append(msg, byte(p.MHDR.MType<<5)|byte(p.MHDR.Major))
+	msg = append(msg, p.MACPayload...)
+
+	b0 := micBlock(1, macPayload.FHDR.DevAddr, fCnt, len(msg))
+	binary.LittleEndian.PutUint16(b0[1:3], uint16(confFCnt))
+
+	mic, err := aesCMACPRF(sNwkSIntKey[:], append(b0, msg...))
+	if err != nil {
+		return fmt.Errorf("calculate MIC: %w", err)
+	}
+	copy(p.MIC[:], mic[0:4])
+	return nil
+}
+
+// EncryptFOpts11 encrypts LoRaWAN 1.1 FOpts with NwkSEncKey; decryption is the same operation.
+// FOpts = FOpts xor aes128_encrypt(NwkSEncKey, A) with A = 0x01 | 3 x 0x00 | FCntID | Dir | DevAddr | FCnt | 0x00 | 0x01,
+// where FCntID is 0x02 for downlinks counted by AFCntDown (FPort > 0) and 0x01 for FCntUp and NFCntDown.
+// fCnt is the full 32 bit frame counter of the frame.
+func EncryptFOpts11(nwkSEncKey AES128Key, uplink, aFCntDown bool, devAddr DevAddr, fCnt uint32, fOpts []byte) ([]byte, error) {
+	if len(fOpts) > 15 {
+		return nil, fmt.Errorf("FOpts must not exceed 15 bytes, got %d", len(fOpts))
+	}
+
+	a := make([]byte, 16)
+	a[0] = 0x01
+	a[4] = 0x01
+	if aFCntDown {
+		a[4] = 0x02
+	}
+	if !uplink {
+		a[5] = 0x01
+	}
+	copy(a[6:10], devAddr[:])
+	binary.LittleEndian.PutUint32(a[10:14], fCnt)
+	a[15] = 0x01
+
+	block, err := aes.NewCipher(nwkSEncKey[:])
+	if err != nil {
+		return nil, err
+	}
+	s := make([]byte, 16)
+	block.Encrypt(s, a)
+
+	out := make([]byte, len(fOpts))
+	for i := range fOpts {
+		out[i] = fOpts[i] ^ s[i]
+	}
+	return out, nil
+}
+
+// micBlock builds the B0/B1 block: 0x49 | 4 x 0x00 | Dir | DevAddr | FCnt | 0x00 | len(msg)
+func micBlock(dir byte, devAddr DevAddr, fCnt uint32, msgLen int) []byte {
+	b := make([]byte, 16)
+	b[0] = 0x49
+	b[5] = dir
+	copy(b[6:10], devAddr[:])
+	binary.LittleEndian.PutUint32(b[10:14], fCnt)
+	b[15] = byte(msgLen)
+	return b
+}
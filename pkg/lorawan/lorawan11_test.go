@@ -0,0 +1,185 @@
+package lorawan
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// 以下期望值均由 OpenSSL 的 AES-128-ECB 和 CMAC 按规范的块格式独立计算
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustKey(t *testing.T, s string) AES128Key {
+	t.Helper()
+	var key AES128Key
+	copy(key[:], mustHex(t, s))
+	return key
+}
+
+var (
+	testDevAddr11     = DevAddr{0x04, 0x03, 0x02, 0x01} // 空口字节序
+	testFNwkSIntKey11 = "11111111111111111111111111111111"
+	testSNwkSIntKey11 = "22222222222222222222222222222222"
+	testNwkSEncKey11  = "33333333333333333333333333333333"
+)
+
+func TestDeriveJSIntKey(t *testing.T) {
+	nwkKey := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	key, err := DeriveJSIntKey(nwkKey, [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(key[:]), "9c66a4d1260f3d78d41c3db7decc62ad"; got != want {
+		t.Errorf("JSIntKey = %s, want %s", got, want)
+	}
+
+	if _, err := DeriveJSIntKey(nwkKey[:15], [8]byte{}); err == nil {
+		t.Error("short NwkKey accepted")
+	}
+}
+
+func TestSetJoinAcceptMIC11(t *testing.T) {
+	p := &PHYPayload{
+		MHDR: MHDR{MType: JoinAccept, Major: LoRaWAN1_0},
+		// JoinNonce | NetID | DevAddr | DLSettings | RxDelay
+		MACPayload: mustHex(t, "aabbcc010000040302010001"),
+	}
+	joinEUI := [8]byte{0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18}
+
+	if err := p.SetJoinAcceptMIC11(mustKey(t, "9c66a4d1260f3d78d41c3db7decc62ad"), JoinReqTypeJoinRequest, joinEUI, [2]byte{0x01, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(p.MIC[:]), "db8d91da"; got != want {
+		t.Errorf("MIC = %s, want %s", got, want)
+	}
+}
+
+func TestUplinkDataMIC11(t *testing.T) {
+	newUplink := func() *PHYPayload {
+		return &PHYPayload{
+			MHDR: MHDR{MType: UnconfirmedDataUp, Major: LoRaWAN1_0},
+			// DevAddr | FCtrl(ADR) | FCnt 1 | FPort 1 | FRMPayload
+			MACPayload: mustHex(t, "0403020180010001aabb"),
+		}
+	}
+	fNwk, sNwk := mustKey(t, testFNwkSIntKey11), mustKey(t, testSNwkSIntKey11)
+
+	p := newUplink()
+	if err := p.SetUplinkDataMIC11(1, 5, 2, 3, fNwk, sNwk); err != nil {
+		t.Fatal(err)
+	}
+	// 前两字节来自 SNwkSIntKey（B1），后两字节来自 FNwkSIntKey（B0）
+	if got, want := hex.EncodeToString(p.MIC[:]), "9af04d54"; got != want {
+		t.Fatalf("MIC = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name     string
+		fCnt     uint32
+		confFCnt uint32
+		txDR     byte
+		txCH     byte
+		want     bool
+	}{
+		{"same parameters", 1, 5, 2, 3, true},
+		{"other frame counter", 2, 5, 2, 3, false},
+		{"other ConfFCnt", 1, 6, 2, 3, false},
+		{"other data rate", 1, 5, 3, 3, false},
+		{"other channel", 1, 5, 2, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uplink := newUplink()
+			uplink.MIC = p.MIC
+			ok, err := uplink.ValidateUplinkDataMIC11(tt.fCnt, tt.confFCnt, tt.txDR, tt.txCH, fNwk, sNwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Errorf("valid = %v, want %v", ok, tt.want)
+			}
+			if uplink.MIC != p.MIC {
+				t.Error("validation changed the MIC")
+			}
+		})
+	}
+}
+
+func TestSetDownlinkDataMIC11(t *testing.T) {
+	tests := []struct {
+		name     string
+		fCnt     uint32
+		confFCnt uint32
+		want     string
+	}{
+		{"no ACK", 1, 0, "b296f457"},
+		{"ACK of uplink 5", 1, 5, "54d8a327"},
+		// B0 带完整的 32 位计数器
+		{"counter above 16 bits", 0x10002, 0, "4c537fb5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PHYPayload{
+				MHDR:       MHDR{MType: UnconfirmedDataDown, Major: LoRaWAN1_0},
+				MACPayload: mustHex(t, "0403020180010001aabb"),
+			}
+			if err := p.SetDownlinkDataMIC11(tt.fCnt, tt.confFCnt, mustKey(t, testSNwkSIntKey11)); err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(p.MIC[:]); got != tt.want {
+				t.Errorf("MIC = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptFOpts11(t *testing.T) {
+	fOpts := []byte{0x02, 0x03, 0x07}
+
+	tests := []struct {
+		name      string
+		uplink    bool
+		aFCntDown bool
+		want      string
+	}{
+		{"uplink", true, false, "e4aa03"},
+		{"downlink NFCntDown", false, false, "b81cc6"},
+		{"downlink AFCntDown", false, true, "6c3dd8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := mustKey(t, testNwkSEncKey11)
+			enc, err := EncryptFOpts11(key, tt.uplink, tt.aFCntDown, testDevAddr11, 1, fOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(enc); got != tt.want {
+				t.Fatalf("encrypted FOpts = %s, want %s", got, tt.want)
+			}
+
+			// 解密是同一运算
+			dec, err := EncryptFOpts11(key, tt.uplink, tt.aFCntDown, testDevAddr11, 1, enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dec, fOpts) {
+				t.Errorf("decrypted FOpts = %x, want %x", dec, fOpts)
+			}
+		})
+	}
+
+	if _, err := EncryptFOpts11(mustKey(t, testNwkSEncKey11), true, false, testDevAddr11, 1, make([]byte, 16)); err == nil {
+		t.Error("16 byte FOpts accepted")
+	}
+}
@@ -66,6 +66,11 @@ func ParseMACCommands(uplink bool, data []byte) ([]MACCommand, error) {
     return commands, nil
 }
 
+// DownlinkMACCommandPayloadLength returns the payload length of a downlink MAC command, -1 if unknown
+func DownlinkMACCommandPayloadLength(cid byte) int {
+    return getMACCommandPayloadLength(false, cid)
+}
+
 // getMACCommandPayloadLength returns the payload length for a MAC command
 func getMACCommandPayloadLength(uplink bool, cid byte) int {
     if uplink {
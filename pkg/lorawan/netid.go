@@ -0,0 +1,53 @@
+package lorawan
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// NetID 网络标识：高 3 位为类型，低 21 位为 ID（LoRaWAN Backend Interfaces 6.1）
+type NetID [3]byte
+
+// nwkIDBits 各类型 NetID 的 NwkID 位数，即 DevAddr 中紧跟类型前缀的网络标识位数
+var nwkIDBits = [8]int{6, 6, 9, 11, 12, 13, 15, 17}
+
+// ParseNetID 解析 6 位十六进制的 NetID
+func ParseNetID(s string) (NetID, error) {
+	var netID NetID
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 3 {
+		return netID, fmt.Errorf("invalid NetID %q", s)
+	}
+	copy(netID[:], b)
+	return netID, nil
+}
+
+// String 返回十六进制的 NetID
+func (n NetID) String() string {
+	return hex.EncodeToString(n[:])
+}
+
+// Type 返回 NetID 类型（0-7）
+func (n NetID) Type() int {
+	return int(n[0] >> 5)
+}
+
+// NwkID 返回 DevAddr 中携带的网络标识：NetID ID 的低位，位数由类型决定
+func (n NetID) NwkID() uint32 {
+	id := uint32(n[0]&0x1f)<<16 | uint32(n[1])<<8 | uint32(n[2])
+	return id & (1<<nwkIDBits[n.Type()] - 1)
+}
+
+// DevAddrPrefix 返回本网络 DevAddr 的固定高位（类型前缀 + NwkID）及其掩码，
+// 设备地址 addr 属于本网络当且仅当 addr&mask == prefix
+func (n NetID) DevAddrPrefix() (prefix, mask uint32) {
+	t := n.Type()
+	typeBits := t + 1
+	addrBits := 32 - typeBits - nwkIDBits[t]
+
+	// 类型前缀为 t 个 1 后跟一个 0
+	typePrefix := uint32(1)<<typeBits - 2
+	prefix = (typePrefix<<nwkIDBits[t] | n.NwkID()) << addrBits
+	mask = ^uint32(0) << addrBits
+	return prefix, mask
+}
@@ -166,7 +166,7 @@ func GetFullFCnt(fCntUp uint32, fCnt uint16) uint32 {
 	upperBits := fCntUp & 0xFFFF0000
 
 	// Check for rollover
-	if uint16(fCntUp) > fCnt && (uint16(fCntUp)-fCnt) > 0x8000 {
+	if FCnt16RolledOver(fCntUp, fCnt) {
 		// Rollover occurred
 		upperBits += 0x10000
 	}
@@ -174,6 +174,23 @@ func GetFullFCnt(fCntUp uint32, fCnt uint16) uint32 {
 	return upperBits | uint32(fCnt)
 }
 
+// FullFCnt gets the frame counter used for MIC and replay checks.
+// Devices with 16-bit counters never set the upper bits, so the 16-bit
+// value is used as is and wraps from 65535 to 0.
+func FullFCnt(fCntUp uint32, fCnt uint16, supports32Bit bool) uint32 {
+	if !supports32Bit {
+		return uint32(fCnt)
+	}
+	return GetFullFCnt(fCntUp, fCnt)
+}
+
+// FCnt16RolledOver reports whether a 16-bit counter wrapped between the
+// last received value and fCnt
+func FCnt16RolledOver(fCntUp uint32, fCnt uint16) bool {
+	last := uint16(fCntUp)
+	return last > fCnt && last-fCnt > 0x8000
+}
+
 // EncryptFRMPayload encrypts/decrypts FRM payload
 func EncryptFRMPayload(key []byte, devAddr DevAddr, fCnt uint32, uplink bool, payload []byte) ([]byte, error) {
 	if len(payload) == 0 {
@@ -353,6 +370,9 @@ func (j *JoinAcceptPayload) MarshalBinary() ([]byte, error) {
 	copy(data[3:6], j.NetID[:])
 	copy(data[6:10], j.DevAddr[:])
 	data[10] = (j.DLSettings.RX1DROffset << 4) | (j.DLSettings.RX2DataRate & 0x0F)
+	if j.DLSettings.OptNeg {
+		data[10] |= 0x80
+	}
 	data[11] = j.RxDelay
 
 	if len(j.CFList) > 0 {
@@ -370,6 +390,7 @@ func (j *JoinAcceptPayload) UnmarshalBinary(data []byte) error {
 	copy(j.JoinNonce[:], data[0:3])
 	copy(j.NetID[:], data[3:6])
 	copy(j.DevAddr[:], data[6:10])
+	j.DLSettings.OptNeg = data[10]&0x80 != 0
 	j.DLSettings.RX1DROffset = (data[10] >> 4) & 0x07
 	j.DLSettings.RX2DataRate = data[10] & 0x0F
 	j.RxDelay = data[11]
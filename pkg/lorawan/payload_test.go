@@ -0,0 +1,60 @@
+package lorawan
+
+import "testing"
+
+func TestFCnt16RolledOver(t *testing.T) {
+	tests := []struct {
+		name   string
+		fCntUp uint32
+		fCnt   uint16
+		want   bool
+	}{
+		{"0xFFFF to 0", 0xFFFF, 0, true},
+		{"0xFFFF to 5", 0xFFFF, 5, true},
+		{"upper bits ignored", 0x3FFFF, 0, true},
+		{"just under the last counter", 0xFFFE, 0xFFFF, false},
+		{"same counter", 0xFFFF, 0xFFFF, false},
+		{"forward", 10, 11, false},
+		{"gap just over half", 0x8001, 0, true},
+		{"gap at the limit", 0x8000, 0, false},
+		{"small step back", 100, 99, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FCnt16RolledOver(tt.fCntUp, tt.fCnt); got != tt.want {
+				t.Errorf("FCnt16RolledOver(%#x, %#x) = %v, want %v", tt.fCntUp, tt.fCnt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFullFCnt(t *testing.T) {
+	tests := []struct {
+		name          string
+		fCntUp        uint32
+		fCnt          uint16
+		supports32Bit bool
+		want          uint32
+	}{
+		{"32-bit forward", 10, 11, true, 11},
+		{"32-bit just under rollover", 0xFFFE, 0xFFFF, true, 0xFFFF},
+		{"32-bit 0xFFFF to 0", 0xFFFF, 0, true, 0x10000},
+		{"32-bit second rollover", 0x1FFFF, 1, true, 0x20001},
+		{"32-bit keeps upper bits", 0x10005, 6, true, 0x10006},
+		{"32-bit gap at the limit", 0x8000, 0, true, 0},
+		{"32-bit gap just over half", 0x8001, 0, true, 0x10000},
+		{"16-bit forward", 10, 11, false, 11},
+		{"16-bit just under rollover", 0xFFFE, 0xFFFF, false, 0xFFFF},
+		{"16-bit 0xFFFF to 0", 0xFFFF, 0, false, 0},
+		{"16-bit ignores upper bits", 0x1FFFF, 1, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FullFCnt(tt.fCntUp, tt.fCnt, tt.supports32Bit); got != tt.want {
+				t.Errorf("FullFCnt(%#x, %#x, %v) = %#x, want %#x", tt.fCntUp, tt.fCnt, tt.supports32Bit, got, tt.want)
+			}
+		})
+	}
+}
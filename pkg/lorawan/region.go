@@ -61,6 +61,24 @@ func GetRegionConfiguration(region string) *RegionConfiguration {
 	}
 }
 
+// MaxPHYPayloadSize returns the largest PHYPayload allowed in the region.
+// FRMPayload max of the fastest DR plus MHDR, FHDR with full FOpts, FPort and MIC,
+// capped at the 255 byte LoRa physical limit.
+func (r *RegionConfiguration) MaxPHYPayloadSize() int {
+	maxN := 0
+	for _, n := range r.MaxPayloadSizePerDR {
+		if n > maxN {
+			maxN = n
+		}
+	}
+
+	size := maxN + 1 + 7 + 15 + 1 + 4
+	if size > 255 {
+		size = 255
+	}
+	return size
+}
+
 // EU868Configuration for EU 868MHz band
 var EU868Configuration = RegionConfiguration{
 	Name: "EU868",
@@ -112,6 +130,15 @@ var US915Configuration = RegionConfiguration{
 		{SpreadFactor: 8, Bandwidth: 125},  // DR2
 		{SpreadFactor: 7, Bandwidth: 125},  // DR3
 		{SpreadFactor: 8, Bandwidth: 500},  // DR4
+		{},                                 // DR5 (LR-FHSS)
+		{},                                 // DR6 (LR-FHSS)
+		{},                                 // DR7 RFU
+		{SpreadFactor: 12, Bandwidth: 500}, // DR8 (downlink only)
+		{SpreadFactor: 11, Bandwidth: 500}, // DR9
+		{SpreadFactor: 10, Bandwidth: 500}, // DR10
+		{SpreadFactor: 9, Bandwidth: 500},  // DR11
+		{SpreadFactor: 8, Bandwidth: 500},  // DR12
+		{SpreadFactor: 7, Bandwidth: 500},  // DR13
 	},
 	MaxPayloadSizePerDR: map[int]int{
 		0: 11,
@@ -211,6 +238,35 @@ func (r *RegionConfiguration) GetRX1DataRateOffset(uplinkDR, rx1DROffset uint8)
 	return uint8(dr), nil
 }
 
+// RX1Frequency returns the RX1 downlink frequency (Hz) for an uplink frequency.
+// Most plans (EU868 and similar) answer on the uplink channel; US915 maps the
+// uplink channel onto one of its 8 downlink channels. CN470 modes are handled
+// by GetCN470DownlinkFrequency.
+func (r *RegionConfiguration) RX1Frequency(uplinkFreq uint32) uint32 {
+	if r.Name != "US915" {
+		return uplinkFreq
+	}
+
+	// 125 kHz 上行信道 0-63：902.3 MHz 起每 200 kHz；500 kHz 上行信道 64-71：903.0 MHz 起每 1.6 MHz
+	var ch uint32
+	if uplinkFreq >= 903000000 && (uplinkFreq-903000000)%1600000 == 0 {
+		ch = 64 + (uplinkFreq-903000000)/1600000
+	} else if uplinkFreq >= 902300000 {
+		ch = (uplinkFreq - 902300000) / 200000
+	}
+	return 923300000 + (ch%8)*600000
+}
+
+// DataRateString returns the LoRa datr string (e.g. SF12BW125) of a data rate,
+// false when the region does not define the data rate as LoRa
+func (r *RegionConfiguration) DataRateString(dr int) (string, bool) {
+	if dr < 0 || dr >= len(r.DataRates) || r.DataRates[dr].SpreadFactor == 0 {
+		return "", false
+	}
+	d := r.DataRates[dr]
+	return fmt.Sprintf("SF%dBW%d", d.SpreadFactor, d.Bandwidth), true
+}
+
 // GetCN470DownlinkFrequency 根据模式和上行频率计算下行频率
 func (r *RegionConfiguration) GetCN470DownlinkFrequency(uplinkFreq uint32, mode CN470Mode) uint32 {
 	if r.Name != "CN470" {
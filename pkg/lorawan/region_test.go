@@ -0,0 +1,115 @@
+package lorawan
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetRX1DataRateOffset(t *testing.T) {
+	tests := []struct {
+		region   *RegionConfiguration
+		uplinkDR uint8
+		offset   uint8
+		want     uint8
+	}{
+		{&CN470Configuration, 5, 0, 5},
+		{&CN470Configuration, 5, 1, 4},
+		{&CN470Configuration, 5, 5, 0},
+		{&CN470Configuration, 3, 2, 1},
+		// 低于 DR0 时限制为 DR0
+		{&CN470Configuration, 2, 3, 0},
+		{&CN470Configuration, 0, 5, 0},
+		// 超出表格的偏移同样限制为 DR0
+		{&CN470Configuration, 1, 7, 0},
+		{&EU868Configuration, 5, 0, 5},
+		{&EU868Configuration, 5, 2, 3},
+		{&EU868Configuration, 4, 4, 0},
+		{&EU868Configuration, 1, 5, 0},
+		// DR6 (SF7BW250) 不在表格中，按 DR - offset 计算
+		{&EU868Configuration, 6, 0, 6},
+		{&EU868Configuration, 6, 1, 5},
+		{&EU868Configuration, 6, 5, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s DR%d offset %d", tt.region.Name, tt.uplinkDR, tt.offset), func(t *testing.T) {
+			got, err := tt.region.GetRX1DataRateOffset(tt.uplinkDR, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GetRX1DataRateOffset(%d, %d) = %d, want %d", tt.uplinkDR, tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRX1DROffsetTables(t *testing.T) {
+	// CN470 与 EU868 的 RX1 速率都是 max(0, DR - offset)（RP002），逐项核对表格
+	for _, region := range []*RegionConfiguration{&CN470Configuration, &EU868Configuration} {
+		for dr := 0; dr <= 5; dr++ {
+			for offset := 0; offset <= 5; offset++ {
+				want := dr - offset
+				if want < 0 {
+					want = 0
+				}
+				if got := region.RX1DROffsetTable[dr][offset]; got != want {
+					t.Errorf("%s RX1DROffsetTable[%d][%d] = %d, want %d", region.Name, dr, offset, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestRX1Frequency(t *testing.T) {
+	tests := []struct {
+		region     *RegionConfiguration
+		uplinkFreq uint32
+		want       uint32
+	}{
+		// EU868 在上行信道回复
+		{&EU868Configuration, 868100000, 868100000},
+		{&EU868Configuration, 867500000, 867500000},
+		// US915 上行信道映射到 8 个下行信道之一
+		{&US915Configuration, 902300000, 923300000},
+		{&US915Configuration, 902500000, 923900000},
+		{&US915Configuration, 903900000, 923300000},
+		{&US915Configuration, 914900000, 927500000},
+		{&US915Configuration, 903000000, 923300000},
+		{&US915Configuration, 904600000, 923900000},
+	}
+
+	for _, tt := range tests {
+		if got := tt.region.RX1Frequency(tt.uplinkFreq); got != tt.want {
+			t.Errorf("%s RX1Frequency(%d) = %d, want %d", tt.region.Name, tt.uplinkFreq, got, tt.want)
+		}
+	}
+}
+
+func TestDataRateString(t *testing.T) {
+	tests := []struct {
+		region *RegionConfiguration
+		dr     int
+		want   string
+		wantOK bool
+	}{
+		{&EU868Configuration, 0, "SF12BW125", true},
+		{&EU868Configuration, 5, "SF7BW125", true},
+		{&EU868Configuration, 6, "SF7BW250", true},
+		{&EU868Configuration, 7, "", false},
+		{&EU868Configuration, -1, "", false},
+		{&CN470Configuration, 3, "SF9BW125", true},
+		{&US915Configuration, 8, "SF12BW500", true},
+		// LR-FHSS 和 RFU 速率不是 LoRa
+		{&US915Configuration, 5, "", false},
+		{&US915Configuration, 7, "", false},
+		{&US915Configuration, 13, "SF7BW500", true},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.region.DataRateString(tt.dr)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s DataRateString(%d) = %q, %v, want %q, %v", tt.region.Name, tt.dr, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
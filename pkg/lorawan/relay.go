@@ -0,0 +1,41 @@
+package lorawan
+
+import "fmt"
+
+// 中继（LoRaWAN TS011）：中继把收到的终端上行装入 FPort 226 的 ForwardUplinkReq 转给网络服务器，
+// FRMPayload 与 FPort 0 一样使用 NwkSEncKey 加密
+const RelayFPort = 226
+
+// relayForwardHeaderLen Uplink Metadata (3) + Frequency (3)
+const relayForwardHeaderLen = 6
+
+// RelayUplink 中继转发的一个终端上行
+type RelayUplink struct {
+	DataRate   uint8  // 终端上行的 DR
+	RSSI       int    // 中继接收的 RSSI (dBm)
+	SNR        int    // 中继接收的 SNR (dB)
+	WORChannel uint8  // 唤醒（WOR）信道
+	Frequency  uint32 // 终端上行频率 (Hz)
+	PHYPayload []byte // 终端的完整 PHYPayload
+}
+
+// ParseRelayForwardUplink 解析 FPort 226 上的 ForwardUplinkReq。
+// Uplink Metadata 为 3 字节小端：SNR[4:0]（+20 偏移）、RSSI[11:5]（-15 偏移，取负）、WOR 信道[13:12]、DR[17:14]；
+// Frequency 为 3 字节小端，单位 100Hz
+func ParseRelayForwardUplink(data []byte) (*RelayUplink, error) {
+	if len(data) <= relayForwardHeaderLen {
+		return nil, fmt.Errorf("ForwardUplinkReq requires more than %d bytes, got %d", relayForwardHeaderLen, len(data))
+	}
+
+	meta := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+	freq := uint32(data[3]) | uint32(data[4])<<8 | uint32(data[5])<<16
+
+	return &RelayUplink{
+		DataRate:   uint8(meta >> 14 & 0x0f),
+		RSSI:       -int(meta>>5&0x7f) - 15,
+		SNR:        int(meta&0x1f) - 20,
+		WORChannel: uint8(meta >> 12 & 0x03),
+		Frequency:  freq * 100,
+		PHYPayload: data[relayForwardHeaderLen:],
+	}, nil
+}
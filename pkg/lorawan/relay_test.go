@@ -0,0 +1,45 @@
+package lorawan
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseRelayForwardUplink(t *testing.T) {
+	phy := []byte{0x40, 0xda, 0x1b, 0x01, 0x26}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    RelayUplink
+		wantErr bool
+	}{
+		// DR5、RSSI -80、SNR 7、WOR 信道 1、470.3MHz
+		{"forwarded uplink", append([]byte{0x3b, 0x58, 0x01, 0x18, 0xc3, 0x47}, phy...),
+			RelayUplink{DataRate: 5, RSSI: -80, SNR: 7, WORChannel: 1, Frequency: 470300000, PHYPayload: phy}, false},
+		// 各字段取最小值
+		{"minimum values", append([]byte{0x00, 0x00, 0x00, 0x28, 0x76, 0x84}, phy...),
+			RelayUplink{DataRate: 0, RSSI: -15, SNR: -20, WORChannel: 0, Frequency: 868100000, PHYPayload: phy}, false},
+		{"header only", []byte{0x3b, 0x58, 0x01, 0x18, 0xc3, 0x47}, RelayUplink{}, true},
+		{"empty", nil, RelayUplink{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRelayForwardUplink(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRelayForwardUplink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.DataRate != tt.want.DataRate || got.RSSI != tt.want.RSSI || got.SNR != tt.want.SNR ||
+				got.WORChannel != tt.want.WORChannel || got.Frequency != tt.want.Frequency {
+				t.Errorf("ParseRelayForwardUplink() = %+v, want %+v", got, tt.want)
+			}
+			if !bytes.Equal(got.PHYPayload, tt.want.PHYPayload) {
+				t.Errorf("PHYPayload = %x, want %x", got.PHYPayload, tt.want.PHYPayload)
+			}
+		})
+	}
+}
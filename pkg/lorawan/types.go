@@ -55,6 +55,20 @@ func (k AES128Key) String() string {
 	return hex.EncodeToString(k[:])
 }
 
+// ParseAES128Key parses a 32 character hex string into a key
+func ParseAES128Key(s string) (AES128Key, error) {
+	var key AES128Key
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return key, fmt.Errorf("key must be hex encoded: %w", err)
+	}
+	if len(b) != len(key) {
+		return key, fmt.Errorf("key must be %d bytes, got %d", len(key), len(b))
+	}
+	copy(key[:], b)
+	return key, nil
+}
+
 // MType represents the message type
 type MType byte
 
@@ -90,6 +104,17 @@ type MHDR struct {
 	Major Major
 }
 
+// Application FPort range; FPort 0 carries MAC commands and 224 is reserved for the test protocol
+const (
+	MinApplicationFPort uint8 = 1
+	MaxApplicationFPort uint8 = 223
+)
+
+// ValidApplicationFPort reports whether an FPort may carry application data
+func ValidApplicationFPort(fPort uint8) bool {
+	return fPort >= MinApplicationFPort && fPort <= MaxApplicationFPort
+}
+
 // MACPayload represents the MAC payload
 type MACPayload struct {
 	FHDR       FHDR
@@ -133,6 +158,7 @@ type JoinAcceptPayload struct {
 
 // DLSettings represents downlink settings
 type DLSettings struct {
+	OptNeg      bool // LoRaWAN 1.1: the Join-accept was built with 1.1 keys (bit 7)
 	RX1DROffset uint8
 	RX2DataRate uint8
 }
@@ -0,0 +1,51 @@
+package lorawan
+
+import "testing"
+
+func TestParseAES128Key(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		wantErr bool
+	}{
+		{"valid", "2b7e151628aed2a6abf7158809cf4f3c", false},
+		{"upper case", "2B7E151628AED2A6ABF7158809CF4F3C", false},
+		{"not hex", "2b7e151628aed2a6abf7158809cf4fzz", true},
+		{"odd length", "2b7e151628aed2a6abf7158809cf4f3", true},
+		{"too short", "2b7e151628aed2a6abf7158809cf4f", true},
+		{"too long", "2b7e151628aed2a6abf7158809cf4f3c00", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseAES128Key(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAES128Key(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if !tt.wantErr && key.String() != "2b7e151628aed2a6abf7158809cf4f3c" {
+				t.Errorf("key = %s", key)
+			}
+		})
+	}
+}
+
+func TestValidApplicationFPort(t *testing.T) {
+	tests := []struct {
+		fPort uint8
+		want  bool
+	}{
+		{0, false},
+		{1, true},
+		{100, true},
+		{223, true},
+		{224, false},
+		{255, false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidApplicationFPort(tt.fPort); got != tt.want {
+			t.Errorf("ValidApplicationFPort(%d) = %v, want %v", tt.fPort, got, tt.want)
+		}
+	}
+}